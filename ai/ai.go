@@ -3,392 +3,290 @@ package ai
 import (
 	"context"
 	"fmt"
-	"os"
+	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
-	"github.com/anthropics/anthropic-sdk-go/option"
 	"github.com/iltempo/interplay/sequence"
 )
 
-const commandSystemPromptTemplate = `You are a musical assistant for Interplay, a MIDI sequencer. Your job is to translate user requests into Interplay commands.
-
-Available commands:
-- set <step> <note|rest> [vel:<value>] [gate:<percent>] [dur:<steps>]: Set a step to play a note or rest (e.g., "set 1 C3", "set 1 rest", or "set 1 C3 vel:120 gate:85 dur:4")
-- rest <step>: Set a step to rest/silence (same as "set <step> rest")
-- velocity <step> <value>: Set velocity 0-127 (higher = louder)
-- gate <step> <percent>: Set gate length 1-100%% (lower = shorter/staccato)
-- humanize <type> <amount>: Add random variation (velocity 0-64, timing 0-50ms, gate 0-50)
-- swing <percent>: Add swing/groove (0-75%%, 0=straight, 50=triplet swing, 66=hard swing)
-- cc <cc-number> <value>: Set global CC parameter (e.g., "cc 74 127" for filter cutoff)
-- cc-step <step> <cc-number> <value>: Set per-step CC automation
-- cc-apply <cc-number>: Apply global CC to all steps with notes
-- cc-clear <step> [cc-number]: Clear CC automation from a step
-- cc-show: Display all CC automation
-- tempo <bpm>: Change tempo
-- length <steps>: Change the total number of steps in the pattern
-- clear: Clear all steps to rests
-- reset: Reset to default pattern
-- save <name>: Save current pattern
-- load <name>: Load a saved pattern
-
-RHYTHM AND TIMING (48-step grid for high-resolution rhythm):
-The default pattern is 48 steps, representing 3 bars of 16th notes in 4/4 time.
-- Each step = 1/16th note
-- Steps 1-16 = bar 1, steps 17-32 = bar 2, steps 33-48 = bar 3
-- Quarter note positions: 1, 5, 9, 13 (bar 1), 17, 21, 25, 29 (bar 2), 33, 37, 41, 45 (bar 3)
-- 8th note positions: add steps 3, 7, 11, 15 between quarters
-- Triplet feel: use swing command or place notes on steps 1, 4, 7, 10, 13, 16 (approximation)
-
-When recreating songs, ALWAYS:
-1. First identify the song's tempo (BPM) and set it
-2. Identify the time signature (adjust length if not 4/4: 3/4 = 36 steps for 3 bars)
-3. Map the bass/melody rhythm to the step grid based on note values
-4. Add groove and feel - this is CRITICAL for recognizable rhythms:
-   - Use varied velocities: accents on downbeats (vel:110-127), softer on off-beats (vel:70-90)
-   - Add swing for groovy/funky/jazz/soul songs (swing 30-50)
-   - Add humanization to avoid robotic feel (humanize timing 15, humanize velocity 20)
-   - Use gate variations: shorter notes for staccato/punchy, longer for legato/flowing
-5. ALWAYS add humanization and consider swing - patterns without groove sound lifeless
-
-UNDERSTANDING DURATION AND GATE (critical for longer notes):
-- Duration (dur): How many steps the note SPANS (1-%d). dur:1=16th note, dur:4=quarter note, dur:8=half note
-- Gate: What PERCENTAGE of the duration the note actually sounds (1-100%%)
-- Formula: soundingSteps = duration × (gate / 100), minimum 1 step
-- IMPORTANT: For single-step notes (dur:1), gate has NO effect because minimum is 1 step
-- Examples:
-  - dur:4 gate:100 = note sounds for all 4 steps (legato)
-  - dur:4 gate:50 = note sounds for 2 steps, silent for 2 steps (detached)
-  - dur:4 gate:25 = note sounds for 1 step, silent for 3 steps (staccato)
-  - dur:1 gate:50 = still sounds for 1 step (gate has no effect on single-step notes)
-
-Parameter limits (IMPORTANT: values are plain numbers, NO %% symbols in commands):
-- Steps: 1-%d (pattern length)
-- Notes: C0-C8 (e.g., C3, D#4, Bb2)
-- Velocity (vel): 0-127 plain number (higher = louder)
-- Gate: 1-100 plain number (represents percent, but use plain number)
-- Duration (dur): 1-%d steps (quarter note = dur:4)
-- CC numbers: 0-127 plain number (74 = filter cutoff, 71 = resonance)
-- CC values: 0-127 plain number
-- Tempo: 20-300 plain number
-- Swing: 0-75 plain number (represents percent, 0=straight, 50=triplet, 66=hard)
-- Humanization: velocity 0-64, timing 0-50, gate 0-50 (all plain numbers)
-
-CRITICAL: Always use plain numbers in commands, NEVER add %% symbols.
-Examples: "gate 1 85" (correct), "swing 50" (correct), NOT "gate 1 85%%" or "swing 50%%"
-
-Current pattern state will be provided. Respond ONLY with the commands to execute, one per line, no explanations. Be concise and musical.
-
-Examples:
-User: "make step 1 louder"
-You: velocity 1 127
-
-User: "make it feel more alive"
-You: humanize velocity 20
-humanize timing 15
-humanize gate 10
-
-User: "add some swing"
-You: swing 50
-
-User: "create a funky bass line"
-You: clear
-tempo 110
-set 1 E2 vel:120 dur:2
-set 4 G2 vel:85
-set 5 E2 vel:110 dur:2
-set 8 A2 vel:90
-set 9 E2 vel:115 dur:2
-set 11 B2 vel:80
-set 13 E2 vel:120 dur:2
-set 15 D3 vel:95
-swing 35
-humanize velocity 20
-humanize timing 12
-
-User: "set the length to 32"
-You: length 32
-`
-
-const chatSystemPromptTemplate = `You are a musical assistant for Interplay, a MIDI sequencer. You help users understand their patterns, suggest ideas, answer questions, and discuss music theory.
-
-Available commands in Interplay:
-- set <step> <note|rest> [vel:<value>] [gate:<percent>] [dur:<steps>]: Set a step to play a note or rest
-- rest <step>: Set a step to rest/silence (same as "set <step> rest")
-- velocity <step> <value>: Set velocity 0-127
-- gate <step> <percent>: Set gate length 1-100%%
-- humanize <type> <amount>: Add random variation (velocity 0-64, timing 0-50ms, gate 0-50)
-- swing <percent>: Add swing/groove (0-75%%, 0=straight, 50=triplet swing, 66=hard swing)
-- cc <cc-number> <value>: Set global CC parameter (e.g., "cc 74 127" for filter cutoff)
-- cc-step <step> <cc-number> <value>: Set per-step CC automation
-- cc-apply <cc-number>: Apply global CC to all steps with notes
-- cc-clear <step> [cc-number]: Clear CC automation from a step
-- cc-show: Display all CC automation
-- tempo <bpm>: Change tempo
-- length <steps>: Change the total number of steps in the pattern
-- clear: Clear all steps to rests
-- reset: Reset to default pattern
-- save <name>: Save current pattern
-- load <name>: Load a saved pattern
-- list: List all saved patterns
-- delete <name>: Delete a saved pattern
-- verbose [on|off]: Toggle step-by-step output
-- ai: Enter AI session mode (you!)
-
-RHYTHM AND TIMING (48-step grid for high-resolution rhythm):
-The default pattern is 48 steps, representing 3 bars of 16th notes in 4/4 time.
-- Each step = 1/16th note
-- Steps 1-16 = bar 1, steps 17-32 = bar 2, steps 33-48 = bar 3
-- Quarter note positions: 1, 5, 9, 13 (bar 1), 17, 21, 25, 29 (bar 2), 33, 37, 41, 45 (bar 3)
-- 8th note positions: add steps 3, 7, 11, 15 between quarters
-- Triplet feel: use swing command or place notes on steps 1, 4, 7, 10, 13, 16 (approximation)
-
-When recreating songs, ALWAYS:
-1. First identify the song's tempo (BPM) and set it
-2. Identify the time signature (adjust length if not 4/4: 3/4 = 36 steps for 3 bars)
-3. Map the bass/melody rhythm to the step grid based on note values
-4. Add groove and feel - this is CRITICAL for recognizable rhythms:
-   - Use varied velocities: accents on downbeats (vel:110-127), softer on off-beats (vel:70-90)
-   - Add swing for groovy/funky/jazz/soul songs (swing 30-50)
-   - Add humanization to avoid robotic feel (humanize timing 15, humanize velocity 20)
-   - Use gate variations: shorter notes for staccato/punchy, longer for legato/flowing
-5. ALWAYS add humanization and consider swing - patterns without groove sound lifeless
-
-UNDERSTANDING DURATION AND GATE (critical for longer notes):
-- Duration (dur): How many steps the note SPANS (1-%d). dur:1=16th note, dur:4=quarter note, dur:8=half note
-- Gate: What PERCENTAGE of the duration the note actually sounds (1-100%%)
-- Formula: soundingSteps = duration × (gate / 100), minimum 1 step
-- IMPORTANT: For single-step notes (dur:1), gate has NO effect because minimum is 1 step
-- Examples:
-  - dur:4 gate:100 = note sounds for all 4 steps (legato)
-  - dur:4 gate:50 = note sounds for 2 steps, silent for 2 steps (detached)
-  - dur:4 gate:25 = note sounds for 1 step, silent for 3 steps (staccato)
-  - dur:1 gate:50 = still sounds for 1 step (gate has no effect on single-step notes)
-
-Parameter limits (IMPORTANT: values are plain numbers, NO %% symbols in commands):
-- Steps: 1-%d (pattern length)
-- Notes: C0-C8 (e.g., C3, D#4, Bb2)
-- Velocity: 0-127 plain number (higher = louder)
-- Gate: 1-100 plain number (represents percent, but use plain number in commands)
-- Duration: 1-%d steps (quarter note = dur:4)
-- CC numbers: 0-127 plain number (74 = filter cutoff, 71 = resonance, etc.)
-- CC values: 0-127 plain number
-- Tempo: 20-300 plain number
-- Swing: 0-75 plain number (represents percent, 0=straight, 50=triplet, 66=hard)
-- Humanization: velocity 0-64, timing 0-50, gate 0-50 (all plain numbers)
-
-CRITICAL: Commands use plain numbers only, NEVER add %% symbols.
-Examples: "gate 1 85" (correct), "swing 50" (correct), NOT "gate 1 85%%" or "swing 50%%"
-
-Humanization is enabled by default with subtle settings - adds organic feel.
-
-When discussing patterns:
-- Analyze the musical character
-- Suggest variations or improvements
-- Explain music theory concepts simply
-- Be encouraging and creative
-
-Current pattern state will be provided. Respond conversationally and helpfully.`
-
-const sessionSystemPromptTemplate = `You are a musical assistant in an interactive session with a user working on a MIDI pattern in Interplay.
-
-Available commands:
-- set <step> <note|rest> [vel:<value>] [gate:<percent>] [dur:<steps>]: Set a step to play a note or rest
-- rest <step>: Set a step to rest/silence (same as "set <step> rest")
-- velocity <step> <value>: Set velocity 0-127
-- gate <step> <percent>: Set gate length 1-100%%
-- humanize <type> <amount>: Add random variation (types: velocity 0-64, timing 0-50ms, gate 0-50)
-- swing <percent>: Add swing/groove (0-75%%)
-- cc <cc-number> <value>: Set global CC parameter (e.g., "cc 74 127" for filter cutoff)
-- cc-step <step> <cc-number> <value>: Set per-step CC automation
-- cc-apply <cc-number>: Apply global CC to all steps with notes
-- cc-clear <step> [cc-number]: Clear CC automation from a step
-- cc-show: Display all CC automation
-- tempo <bpm>: Change tempo
-- length <steps>: Change the total number of steps in the pattern
-- clear: Clear all steps to rests
-- reset: Reset to default pattern
-- save <name>: Save current pattern
-- load <name>: Load a saved pattern
-- list: List all saved patterns
-- delete <name>: Delete a saved pattern
-- show: Display current pattern
-- verbose [on|off]: Toggle step-by-step output
-
-RHYTHM AND TIMING (48-step grid for high-resolution rhythm):
-The default pattern is 48 steps, representing 3 bars of 16th notes in 4/4 time.
-- Each step = 1/16th note
-- Steps 1-16 = bar 1, steps 17-32 = bar 2, steps 33-48 = bar 3
-- Quarter note positions: 1, 5, 9, 13 (bar 1), 17, 21, 25, 29 (bar 2), 33, 37, 41, 45 (bar 3)
-- 8th note positions: add steps 3, 7, 11, 15 between quarters
-- Triplet feel: use swing command or place notes on steps 1, 4, 7, 10, 13, 16 (approximation)
-
-When recreating songs, ALWAYS:
-1. First identify the song's tempo (BPM) and set it
-2. Identify the time signature (adjust length if not 4/4: 3/4 = 36 steps for 3 bars)
-3. Map the bass/melody rhythm to the step grid based on note values
-4. Add groove and feel - this is CRITICAL for recognizable rhythms:
-   - Use varied velocities: accents on downbeats (vel:110-127), softer on off-beats (vel:70-90)
-   - Add swing for groovy/funky/jazz/soul songs (swing 30-50)
-   - Add humanization to avoid robotic feel (humanize timing 15, humanize velocity 20)
-   - Use gate variations: shorter notes for staccato/punchy, longer for legato/flowing
-5. ALWAYS add humanization and consider swing - patterns without groove sound lifeless
-
-UNDERSTANDING DURATION AND GATE (critical for longer notes):
-- Duration (dur): How many steps the note SPANS (1-%d). dur:1=16th note, dur:4=quarter note, dur:8=half note
-- Gate: What PERCENTAGE of the duration the note actually sounds (1-100%%)
-- Formula: soundingSteps = duration × (gate / 100), minimum 1 step
-- IMPORTANT: For single-step notes (dur:1), gate has NO effect because minimum is 1 step
-- Examples:
-  - dur:4 gate:100 = note sounds for all 4 steps (legato)
-  - dur:4 gate:50 = note sounds for 2 steps, silent for 2 steps (detached)
-  - dur:4 gate:25 = note sounds for 1 step, silent for 3 steps (staccato)
-  - dur:1 gate:50 = still sounds for 1 step (gate has no effect on single-step notes)
-
-Parameter limits (IMPORTANT: values are plain numbers, NO %% symbols in commands):
-- Steps: 1-%d (pattern length)
-- Notes: C0-C8 (e.g., C3, D#4, Bb2)
-- Velocity: 0-127 plain number (higher = louder)
-- Gate: 1-100 plain number (represents percent, but use plain number in commands)
-- Duration: 1-%d steps (quarter note = dur:4)
-- CC numbers: 0-127 plain number (74 = filter cutoff, 71 = resonance, etc.)
-- CC values: 0-127 plain number
-- Tempo: 20-300 plain number
-- Swing: 0-75 plain number (represents percent, 0=straight, 50=triplet, 66=hard)
-- Humanization: velocity 0-64, timing 0-50, gate 0-50 (all plain numbers, defaults: velocity ±8, timing ±10, gate ±5)
-
-CRITICAL: Commands use plain numbers only, NEVER add %% symbols.
-Examples: "gate 1 85" (correct), "swing 50" (correct), NOT "gate 1 85%%" or "swing 50%%"
-
-Your role in this interactive session:
-1. Have natural conversations about music and the pattern
-2. Answer questions and explain music theory
-3. When the user asks you to modify the pattern, respond with commands to execute
-4. Be conversational - explain what you're doing and why
-5. Ask for clarification when needed
-6. Be encouraging and creative
-
-Response format:
-- For questions/discussion: Just respond conversationally
-- For modifications: Explain what you'll do, then output commands in a special format
-
-When outputting commands to execute, use this EXACT format:
-[EXECUTE]
-command1
-command2
-[/EXECUTE]
-
-Be natural, helpful, and musical. Current pattern state will be provided with each message.`
-
-// Client wraps the Claude API client
+// DefaultModel is the model used unless SetModel picks another
+const DefaultModel = anthropic.ModelClaude3_5HaikuLatest
+
+// Client holds an AI conversation with the model of one of several
+// providers (see providerFor)
 type Client struct {
-	client          anthropic.Client
-	conversationHistory []anthropic.MessageParam
+	provider            provider
+	model               string            // model as selected, e.g. "ollama:llama3.1"
+	apiModel            string            // model name sent to the provider
+	instrument          string            // target instrument description, see SetInstrument
+	genreName           string            // genre preset, see SetGenre
+	genre               string            // genre preset text
+	style               string            // style preset description, see SetStyle
+	recentCommands      []string          // see SetRecentCommands
+	offline             bool              // only local models, see SetOffline
+	usage               map[string]*Usage // per model this session
+	timeout             time.Duration     // per request, see SetTimeout
+	defaultParams       Params            // generation parameters for every model, see SetDefaultParams
+	noCache             bool              // skip the response cache, see SetCache
+	conversationHistory []message
 }
 
-// New creates a new AI client
+// New creates a new AI client for Claude
 func New(apiKey string) (*Client, error) {
-	if apiKey == "" {
-		return nil, fmt.Errorf("ANTHROPIC_API_KEY not set")
+	p, err := newAnthropic(apiKey)
+	if err != nil {
+		return nil, err
 	}
 
-	client := anthropic.NewClient(option.WithAPIKey(apiKey))
-
 	return &Client{
-		client: client,
+		provider: p,
+		model:    string(DefaultModel),
+		apiModel: string(DefaultModel),
 	}, nil
 }
 
-// NewFromEnv creates a new AI client using ANTHROPIC_API_KEY env var
+// NewForModel creates a new AI client for model, configured from the
+// environment (e.g., "gpt-4o" needs OPENAI_API_KEY)
+func NewForModel(model string) (*Client, error) {
+	c := &Client{}
+	if err := c.SetModel(model); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetModel selects the model used for requests (e.g., "claude-3-5-haiku-latest",
+// "gpt-4o", "gemini-2.0-flash", "ollama:llama3.1"). The conversation carries over.
+func (c *Client) SetModel(model string) error {
+	if c.offline && !IsLocal(model) {
+		return fmt.Errorf("offline mode: only local models (%s<name>)", ollamaPrefix)
+	}
+	p, apiModel, err := providerFor(model)
+	if err != nil {
+		return err
+	}
+	c.provider, c.model, c.apiModel = p, model, apiModel
+	return nil
+}
+
+// Model returns the selected model
+func (c *Client) Model() string {
+	return c.model
+}
+
+// SetOffline restricts SetModel to local models, so nothing is sent over
+// the internet
+func (c *Client) SetOffline(on bool) {
+	c.offline = on
+}
+
+// SetTimeout limits how long each request may take (0 restores DefaultTimeout)
+func (c *Client) SetTimeout(d time.Duration) {
+	c.timeout = d
+}
+
+// Timeout returns the request time limit
+func (c *Client) Timeout() time.Duration {
+	if c.timeout <= 0 {
+		return DefaultTimeout
+	}
+	return c.timeout
+}
+
+// Offline reports whether the client is restricted to local models
+func (c *Client) Offline() bool {
+	return c.offline
+}
+
+// Provider names the API serving the selected model
+func (c *Client) Provider() string {
+	return c.provider.name()
+}
+
+// SetInstrument describes the target synth in the system prompt ("" removes it)
+func (c *Client) SetInstrument(description string) {
+	c.instrument = description
+}
+
+// SetStyle describes a style preset (tempo, swing, density, notes) in the
+// system prompt ("" removes it)
+func (c *Client) SetStyle(description string) {
+	c.style = description
+}
+
+// NewFromEnv creates a new AI client for the first vendor with an API key
+// set: ANTHROPIC_API_KEY, OPENAI_API_KEY, then GEMINI_API_KEY
 func NewFromEnv() (*Client, error) {
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	return New(apiKey)
+	model, ok := envModel()
+	if !ok {
+		return nil, fmt.Errorf("no AI API key set (ANTHROPIC_API_KEY, OPENAI_API_KEY or GEMINI_API_KEY)")
+	}
+	return NewForModel(model)
+}
+
+// maxRecentCommands limits how many of the user's recent commands are sent
+// as context
+const maxRecentCommands = 10
+
+// SetRecentCommands tells the AI which commands the user ran last (oldest
+// first), so its edits can follow the direction the user is taking
+func (c *Client) SetRecentCommands(commands []string) {
+	if len(commands) > maxRecentCommands {
+		commands = commands[len(commands)-maxRecentCommands:]
+	}
+	c.recentCommands = commands
+}
+
+// describeAnalysis summarizes the pattern's key, density, velocity and
+// rhythm as context for the model
+func describeAnalysis(p *sequence.Pattern) string {
+	a := p.Analyze()
+	summary := "Analysis: " + a.Summary()
+	if a.Notes > 1 {
+		summary += fmt.Sprintf(", velocity spread ±%.0f", a.VelocityStdDev)
+	}
+	return summary
+}
+
+// describeBars maps bar numbers to step ranges in the pattern's meter, so
+// requests like "a fill in bar 3" land on the right steps
+func describeBars(p *sequence.Pattern) string {
+	length, stepsPerBar := p.Length(), p.StepsPerBar()
+	var bars []string
+	for bar := 0; bar*stepsPerBar < length; bar++ {
+		first := bar*stepsPerBar + 1
+		last := min(first+stepsPerBar-1, length)
+		bars = append(bars, fmt.Sprintf("bar %d = steps %d-%d", bar+1, first, last))
+	}
+	return fmt.Sprintf("Bars (%s, %d steps each): %s", p.Meter(), stepsPerBar, strings.Join(bars, ", "))
+}
+
+// describeContext is the pattern, its analysis and bar layout, and the
+// user's recent commands, sent with each request
+func (c *Client) describeContext(p *sequence.Pattern) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Current pattern:\n%s\n%s\n%s", p.String(), describeAnalysis(p), describeBars(p))
+	if convention := sequence.OctaveConvention(); convention != sequence.OctaveRoland {
+		fmt.Fprintf(&sb, "\nNote names use the %s octave convention: middle C (MIDI 60) is %s, so write notes that way.", convention, sequence.MIDIToNoteName(60))
+	}
+	if len(c.recentCommands) > 0 {
+		sb.WriteString("\nRecent commands (oldest first): " + strings.Join(c.recentCommands, "; "))
+	}
+	return sb.String()
 }
 
-// GenerateCommands asks Claude to generate commands based on user request
+// GenerateCommands asks Claude to generate commands based on user request.
+// Responses are cached: the same request on the same pattern with the same
+// model returns the cached commands without a request.
 func (c *Client) GenerateCommands(ctx context.Context, userRequest string, p *sequence.Pattern) ([]string, error) {
-	patternLen := p.Length()
-	systemPrompt := fmt.Sprintf(commandSystemPromptTemplate, patternLen, patternLen, patternLen)
-	userMessage := fmt.Sprintf("Current pattern:\n%s\n\nUser request: %s", p.String(), userRequest)
-
-	message, err := c.client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.ModelClaude3_5HaikuLatest,
-		MaxTokens: 1024,
-		System: []anthropic.TextBlockParam{
-			{Text: systemPrompt},
-		},
-		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(userMessage)),
-		},
-	})
+	systemPrompt := c.systemPrompt("commands", p)
+	userMessage := fmt.Sprintf("%s\n\nUser request: %s", c.describeContext(p), userRequest)
+	key := c.cacheKey(systemPrompt, userMessage)
+	if commands, ok := c.cachedResponse(key); ok {
+		slog.Info("AI request cached", "kind", "commands", "model", c.model)
+		return commands, nil
+	}
 
+	commands, _, err := c.requestCommands(ctx, systemPrompt, userMessage)
 	if err != nil {
-		return nil, fmt.Errorf("claude API error: %w", err)
+		return nil, err
+	}
+	if err := c.cacheResponse(key, userRequest, commands); err != nil {
+		slog.Warn("AI cache write failed", "error", err)
 	}
+	return commands, nil
+}
 
-	// Extract text from response
-	var responseText string
-	for _, block := range message.Content {
-		switch b := block.AsAny().(type) {
-		case anthropic.TextBlock:
-			responseText += b.Text
-		}
+// GenerateCommandsWithModel is GenerateCommands for model instead of the
+// selected one, which stays selected. It also returns the response as the
+// model wrote it, so a reply that doesn't parse can be kept. Every call makes
+// a request: the cache only holds commands, and repeated runs are meant to
+// sample the model again. Its usage is saved to UsageFile but not counted in
+// this session's.
+func (c *Client) GenerateCommandsWithModel(ctx context.Context, userRequest string, p *sequence.Pattern, model string) ([]string, string, error) {
+	other := *c
+	other.usage, other.conversationHistory = nil, nil
+	if err := other.SetModel(model); err != nil {
+		return nil, "", err
+	}
+	systemPrompt := other.systemPrompt("commands", p)
+	userMessage := fmt.Sprintf("%s\n\nUser request: %s", other.describeContext(p), userRequest)
+	return other.requestCommands(ctx, systemPrompt, userMessage)
+}
+
+// requestCommands sends a commands request and parses the reply, one
+// command per line, returning the reply's text as well
+func (c *Client) requestCommands(ctx context.Context, systemPrompt, userMessage string) ([]string, string, error) {
+	r, err := c.send(ctx, request{
+		kind:      "commands",
+		system:    systemPrompt,
+		messages:  []message{{role: "user", text: userMessage}},
+		maxTokens: 1024,
+	}, nil, nil)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Parse commands (one per line)
-	lines := strings.Split(strings.TrimSpace(responseText), "\n")
 	var commands []string
-	for _, line := range lines {
+	for _, line := range strings.Split(strings.TrimSpace(r.text), "\n") {
 		line = strings.TrimSpace(line)
 		if line != "" && !strings.HasPrefix(line, "#") {
 			commands = append(commands, line)
 		}
 	}
-
-	return commands, nil
+	return commands, r.text, nil
 }
 
 // Chat asks Claude a question about the pattern and returns a conversational response
 // Maintains conversation history for follow-up questions
 func (c *Client) Chat(ctx context.Context, question string, p *sequence.Pattern) (string, error) {
-	patternLen := p.Length()
-	systemPrompt := fmt.Sprintf(chatSystemPromptTemplate, patternLen, patternLen, patternLen)
+	systemPrompt := c.systemPrompt("chat", p)
 
 	// Build user message with pattern context
-	userMessage := fmt.Sprintf("Current pattern:\n%s\n\n%s", p.String(), question)
+	userMessage := fmt.Sprintf("%s\n\n%s", c.describeContext(p), question)
 
-	// Add user message to history
-	c.conversationHistory = append(c.conversationHistory,
-		anthropic.NewUserMessage(anthropic.NewTextBlock(userMessage)))
+	// Add user message to history; a failed or cancelled request leaves
+	// no trace in it
+	start := len(c.conversationHistory)
+	c.conversationHistory = append(c.conversationHistory, message{role: "user", text: userMessage})
 
 	// Send conversation with full history
-	message, err := c.client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.ModelClaude3_5HaikuLatest,
-		MaxTokens: 1024,
-		System: []anthropic.TextBlockParam{
-			{Text: systemPrompt},
-		},
-		Messages: c.conversationHistory,
-	})
-
+	r, err := c.send(ctx, request{
+		kind:      "chat",
+		system:    systemPrompt,
+		messages:  c.conversationHistory,
+		maxTokens: 1024,
+	}, nil, nil)
 	if err != nil {
-		return "", fmt.Errorf("claude API error: %w", err)
-	}
-
-	// Extract text from response
-	var responseText string
-	for _, block := range message.Content {
-		switch b := block.AsAny().(type) {
-		case anthropic.TextBlock:
-			responseText += b.Text
-		}
+		c.conversationHistory = c.conversationHistory[:start]
+		return "", err
 	}
 
 	// Add assistant response to history
-	c.conversationHistory = append(c.conversationHistory,
-		anthropic.NewAssistantMessage(anthropic.NewTextBlock(responseText)))
+	c.conversationHistory = append(c.conversationHistory, message{role: "assistant", text: r.text})
+
+	return strings.TrimSpace(r.text), nil
+}
 
-	return strings.TrimSpace(responseText), nil
+// Critique streams a review of the pattern (groove, harmony, dynamics,
+// suggestions) to onText. No tools are offered, so the pattern can't
+// change. The review joins the conversation, so an AI session can act on it.
+func (c *Client) Critique(ctx context.Context, p *sequence.Pattern, onText func(string)) (*SessionResponse, error) {
+	userMessage := fmt.Sprintf("%s\n\nCritique this pattern.", c.describeContext(p))
+	history := append(c.conversationHistory, message{role: "user", text: userMessage})
+	r, err := c.send(ctx, request{
+		kind:      "critique",
+		system:    c.systemPrompt("critique", p),
+		messages:  history,
+		maxTokens: 1024,
+	}, onText, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.conversationHistory = append(history, message{role: "assistant", text: r.text})
+	return &SessionResponse{Message: r.text, Usage: r.usage}, nil
 }
 
 // ClearHistory clears the conversation history
@@ -396,89 +294,136 @@ func (c *Client) ClearHistory() {
 	c.conversationHistory = nil
 }
 
-// SessionResponse contains the AI's response and any commands to execute
+// StreamHandler receives a session reply while it streams in. Either
+// callback may be nil; without Tool the model is offered no tools.
+type StreamHandler struct {
+	Text func(text string)                   // reply text as it arrives
+	Tool func(call ToolCall) (string, error) // runs a tool call; the result or error goes back to the model
+}
+
+// SessionResponse contains the AI's response, the tools it called and the
+// usage of all requests it took
 type SessionResponse struct {
-	Message  string
-	Commands []string
+	Message   string
+	ToolCalls []ToolCall
+	Usage     Usage
 }
 
 // Session has an interactive conversation with the AI, maintaining history
-// Returns the response message and any commands to execute
+// Returns the response message; no tools are offered
 func (c *Client) Session(ctx context.Context, userInput string, p *sequence.Pattern) (*SessionResponse, error) {
-	patternLen := p.Length()
-	systemPrompt := fmt.Sprintf(sessionSystemPromptTemplate, patternLen, patternLen, patternLen)
+	return c.SessionStream(ctx, userInput, p, StreamHandler{})
+}
 
-	// Build user message with pattern context
-	userMessage := fmt.Sprintf("Current pattern:\n%s\n\n%s", p.String(), userInput)
+// SessionStream is Session with the reply streamed to handler as it is
+// generated. If handler.Tool is set, the model edits the pattern through
+// tool calls; each runs as soon as the model has written it, and its result
+// or error is sent back so the model can correct itself.
+func (c *Client) SessionStream(ctx context.Context, userInput string, p *sequence.Pattern, handler StreamHandler) (*SessionResponse, error) {
+	systemPrompt, compact := c.sessionPrompt(p)
 
-	// Add user message to history
-	c.conversationHistory = append(c.conversationHistory,
-		anthropic.NewUserMessage(anthropic.NewTextBlock(userMessage)))
+	// Build user message with pattern context
+	userMessage := fmt.Sprintf("%s\n\n%s", c.describeContext(p), userInput)
 
-	// Send conversation with full history
-	message, err := c.client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.ModelClaude3_5HaikuLatest,
-		MaxTokens: 1024,
-		System: []anthropic.TextBlockParam{
-			{Text: systemPrompt},
-		},
-		Messages: c.conversationHistory,
-	})
+	// Add user message to history; a failed or cancelled request leaves
+	// no trace in it
+	history := append(c.conversationHistory, message{role: "user", text: userMessage})
 
-	if err != nil {
-		return nil, fmt.Errorf("claude API error: %w", err)
+	req := request{
+		kind:      "session",
+		system:    systemPrompt,
+		maxTokens: 1024,
 	}
-
-	// Extract text from response
-	var responseText string
-	for _, block := range message.Content {
-		switch b := block.AsAny().(type) {
-		case anthropic.TextBlock:
-			responseText += b.Text
-		}
+	if handler.Tool != nil {
+		req.tools = toolsFor(compact)
 	}
 
-	// Add assistant response to history
-	c.conversationHistory = append(c.conversationHistory,
-		anthropic.NewAssistantMessage(anthropic.NewTextBlock(responseText)))
-
-	// Parse response for commands
-	response := &SessionResponse{
-		Message:  responseText,
-		Commands: extractCommands(responseText),
+	response, history, err := c.runTools(ctx, req, history, maxToolRounds, handler)
+	if err != nil {
+		return nil, err
 	}
-
+	c.conversationHistory = history
 	return response, nil
 }
 
-// extractCommands extracts commands from [EXECUTE]...[/EXECUTE] blocks
-func extractCommands(text string) []string {
-	var commands []string
-
-	// Find [EXECUTE] blocks
-	executeStart := "[EXECUTE]"
-	executeEnd := "[/EXECUTE]"
+// Variation asks for variation n of count of the pattern, changing about
+// amount percent of its steps through handler.Tool. It is not part of the
+// conversation.
+func (c *Client) Variation(ctx context.Context, p *sequence.Pattern, amount, n, count int, handler StreamHandler) (*SessionResponse, error) {
+	systemPrompt, compact := c.sessionPrompt(p)
+	instruction := fmt.Sprintf("Make variation %d of %d of this pattern: change about %d%% of its steps "+
+		"(notes, rests, velocities, gate lengths) while keeping its groove and character. "+
+		"Each variation should take a different direction. Make the changes with tools and describe them in one sentence.",
+		n, count, amount)
+	req := request{
+		kind:      "vary",
+		system:    systemPrompt,
+		maxTokens: 1024,
+		tools:     toolsFor(compact),
+	}
+	messages := []message{{role: "user", text: fmt.Sprintf("%s\n\n%s", c.describeContext(p), instruction)}}
+	response, _, err := c.runTools(ctx, req, messages, maxToolRounds, handler)
+	return response, err
+}
 
-	startIdx := strings.Index(text, executeStart)
-	if startIdx == -1 {
-		return commands
+// maxSongRounds allows a song request more tool rounds than a session,
+// since it writes several patterns
+const maxSongRounds = 24
+
+// Song asks for a whole song: several patterns made with the songTools and
+// the other tools, and their arrangement. It is not part of the conversation.
+func (c *Client) Song(ctx context.Context, userRequest string, p *sequence.Pattern, handler StreamHandler) (*SessionResponse, error) {
+	req := request{
+		kind:      "song",
+		system:    c.systemPrompt("song", p),
+		maxTokens: 4096,
+		tools:     append(toolsFor(c.provider.local()), songTools...),
 	}
+	messages := []message{{role: "user", text: fmt.Sprintf("%s\n\n%s", c.describeContext(p), userRequest)}}
+	response, _, err := c.runTools(ctx, req, messages, maxSongRounds, handler)
+	return response, err
+}
 
-	endIdx := strings.Index(text[startIdx:], executeEnd)
-	if endIdx == -1 {
-		return commands
+// sessionPrompt returns the session system prompt, compact for local models
+func (c *Client) sessionPrompt(p *sequence.Pattern) (prompt string, compact bool) {
+	if c.provider.local() {
+		return c.systemPrompt("session-compact", p), true
 	}
+	return c.systemPrompt("session", p), false
+}
 
-	// Extract commands between markers
-	commandBlock := text[startIdx+len(executeStart) : startIdx+endIdx]
-	lines := strings.Split(strings.TrimSpace(commandBlock), "\n")
+// runTools sends the conversation in history, running the model's tool
+// calls and sending their results back until it answers in text, or for at
+// most rounds requests. Returns the history with the model's turns added.
+func (c *Client) runTools(ctx context.Context, req request, history []message, rounds int, handler StreamHandler) (*SessionResponse, []message, error) {
+	response := &SessionResponse{}
+	for round := 1; ; round++ {
+		// Last round: the model has to wrap up in text
+		req.textOnly = round == rounds
+
+		// Send conversation with full history, streaming the reply
+		req.messages = history
+		var results []toolResult
+		r, err := c.send(ctx, req, handler.Text, func(call ToolCall) {
+			response.ToolCalls = append(response.ToolCalls, call)
+			result, err := handler.Tool(call)
+			if err != nil {
+				results = append(results, toolResult{id: call.ID, content: err.Error(), isError: true})
+			} else {
+				results = append(results, toolResult{id: call.ID, content: result})
+			}
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		response.Message += r.text
+		response.Usage.Add(r.usage)
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line != "" {
-			commands = append(commands, line)
+		// Add assistant response (and tool results) to history
+		history = append(history, message{role: "assistant", text: r.text, toolCalls: r.toolCalls, thinking: r.thinking})
+		if len(results) == 0 {
+			return response, history, nil
 		}
+		history = append(history, message{role: "user", toolResults: results})
 	}
-
-	return commands
 }
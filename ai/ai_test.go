@@ -1,92 +1,24 @@
 package ai
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
-)
-
-// TestExtractCommands tests the extraction of commands from [EXECUTE] blocks
-func TestExtractCommands(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected []string
-	}{
-		{
-			name: "Single command",
-			input: `I'll set step 1 to C4.
-[EXECUTE]
-set 1 C4
-[/EXECUTE]
-Done!`,
-			expected: []string{"set 1 C4"},
-		},
-		{
-			name: "Multiple commands",
-			input: `Let me transpose it down.
-[EXECUTE]
-set 1 C2
-set 5 C2
-set 9 G1
-[/EXECUTE]
-Try it out!`,
-			expected: []string{"set 1 C2", "set 5 C2", "set 9 G1"},
-		},
-		{
-			name: "Commands with extra whitespace",
-			input: `[EXECUTE]
-  set 1 C4
-
-  tempo 120
-  velocity 1 100
-[/EXECUTE]`,
-			expected: []string{"set 1 C4", "tempo 120", "velocity 1 100"},
-		},
-		{
-			name:     "No execute block",
-			input:    "This is just a conversational response with no commands.",
-			expected: nil,
-		},
-		{
-			name:     "Empty execute block",
-			input:    "[EXECUTE]\n\n[/EXECUTE]",
-			expected: nil,
-		},
-		{
-			name:     "Unclosed execute block",
-			input:    "[EXECUTE]\nset 1 C4\n",
-			expected: nil,
-		},
-		{
-			name: "Execute block with no opening tag",
-			input: `set 1 C4
-[/EXECUTE]`,
-			expected: nil,
-		},
-		{
-			name: "Complex response with commands",
-			input: `I'll make it darker and more brooding by transposing down an octave.
-[EXECUTE]
-set 1 C2
-set 4 D#2
-set 5 G2
-set 9 C2
-set 13 F2
-[/EXECUTE]
-This should give it a much heavier feel!`,
-			expected: []string{"set 1 C2", "set 4 D#2", "set 5 G2", "set 9 C2", "set 13 F2"},
-		},
-	}
+	"time"
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := extractCommands(tt.input)
-			if !reflect.DeepEqual(result, tt.expected) {
-				t.Errorf("extractCommands() = %v, want %v", result, tt.expected)
-			}
-		})
-	}
-}
+	"github.com/iltempo/interplay/sequence"
+)
 
 // TestClearHistory tests that conversation history is properly cleared
 func TestClearHistory(t *testing.T) {
@@ -113,7 +45,9 @@ func TestClearHistory(t *testing.T) {
 // TestNewFromEnv tests client creation from environment
 func TestNewFromEnv(t *testing.T) {
 	// Test with no API key set (should fail gracefully)
-	t.Setenv("ANTHROPIC_API_KEY", "")
+	for _, key := range []string{"ANTHROPIC_API_KEY", "OPENAI_API_KEY", "GEMINI_API_KEY", "GOOGLE_API_KEY"} {
+		t.Setenv(key, "")
+	}
 
 	client, err := NewFromEnv()
 	if err == nil {
@@ -165,3 +99,716 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+// TestToolCallCommand tests mapping tool calls to command arguments
+func TestToolCallCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		tool     string
+		input    string
+		expected []string
+		wantErr  bool
+	}{
+		{"Note with options", "set_step", `{"step": 1, "note": "C2", "velocity": 110, "duration": 4}`, []string{"set", "1", "C2", "vel:110", "dur:4"}, false},
+		{"Note only", "set_step", `{"step": 5, "note": "G#2"}`, []string{"set", "5", "G#2"}, false},
+		{"Injected text stays one argument", "set_step", `{"step": 1, "note": "C2; clear"}`, []string{"set", "1", "C2; clear"}, false},
+		{"Tempo", "set_tempo", `{"bpm": 120}`, []string{"tempo", "120"}, false},
+		{"Fractional tempo", "set_tempo", `{"bpm": 122.5}`, []string{"tempo", "122.5"}, false},
+		{"Humanize", "set_humanize", `{"type": "timing", "amount": 10}`, []string{"humanize", "timing", "10"}, false},
+		{"Saved CC", "set_cc", `{"cc": 74, "value": 90, "save": true}`, []string{"cc", "74", "90", "--save"}, false},
+		{"Missing required input", "set_volume", `{}`, nil, true},
+		{"Missing required pointer input", "set_step_cc", `{"step": 1, "cc": 74}`, nil, true},
+		{"Clear step CC", "clear_step_cc", `{"step": 3}`, []string{"cc-clear", "3"}, false},
+		{"No input", "clear_pattern", ``, []string{"clear"}, false},
+		{"Unknown tool", "delete_everything", `{}`, nil, true},
+		{"Invalid input", "set_tempo", `{"bpm": "fast"}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToolCall{Name: tt.tool, Input: json.RawMessage(tt.input)}.Command()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Command() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Command() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestToolParams tests that every tool is described with its required inputs
+func TestToolParams(t *testing.T) {
+	params := toolParams(tools)
+	if len(params) != len(tools) {
+		t.Fatalf("toolParams() returned %d tools, want %d", len(params), len(tools))
+	}
+	for _, p := range params {
+		tool := p.OfTool
+		properties := tool.InputSchema.Properties.(map[string]any)
+		for _, name := range tool.InputSchema.Required {
+			if _, ok := properties[name]; !ok {
+				t.Errorf("%s: required input %q has no schema", tool.Name, name)
+			}
+		}
+	}
+}
+
+// TestProviderFor tests picking the provider from the model name
+func TestProviderFor(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("GEMINI_API_KEY", "")
+	t.Setenv("GOOGLE_API_KEY", "")
+	t.Setenv("OLLAMA_HOST", "gpu-box:11434")
+
+	tests := []struct {
+		model    string
+		provider string
+		apiModel string
+		wantErr  bool
+	}{
+		{"claude-sonnet-4-5", "claude", "claude-sonnet-4-5", false},
+		{"gpt-4o", "openai", "gpt-4o", false},
+		{"o3-mini", "openai", "o3-mini", false},
+		{"gemini-2.0-flash", "", "", true}, // no key
+		{"ollama:llama3.1", "ollama", "llama3.1", false},
+		{"ollama:", "", "", true},
+		{"mistral-large", "", "", true},
+	}
+	for _, tt := range tests {
+		p, apiModel, err := providerFor(tt.model)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("providerFor(%q) error = %v, wantErr %v", tt.model, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (p.name() != tt.provider || apiModel != tt.apiModel) {
+			t.Errorf("providerFor(%q) = %s %q, want %s %q", tt.model, p.name(), apiModel, tt.provider, tt.apiModel)
+		}
+	}
+
+	if got := ollamaURL(); got != "http://gpu-box:11434/v1/chat/completions" {
+		t.Errorf("ollamaURL() = %q", got)
+	}
+}
+
+// TestOpenAISession tests a tool-using session against a fake Chat
+// Completions server: the tool call arrives in pieces, its result goes back
+// as a tool message, and the second reply is text
+func TestOpenAISession(t *testing.T) {
+	orig := UsageFile
+	defer func() { UsageFile = orig }()
+	UsageFile = filepath.Join(t.TempDir(), "ai-usage.json")
+
+	var requests []chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		requests = append(requests, req)
+
+		events := []string{
+			`{"choices":[{"delta":{"content":"Adding a kick."}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","function":{"name":"set_step","arguments":"{\"step\": 1,"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":" \"note\": \"C1\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		}
+		if len(requests) > 1 {
+			events = []string{`{"choices":[{"delta":{"content":"Done."},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":3}}`}
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := &Client{provider: newOpenAI("ollama", server.URL, ""), model: "ollama:test", apiModel: "test"}
+	var text strings.Builder
+	var calls []string
+	response, err := client.SessionStream(context.Background(), "add a kick", sequence.New(16), StreamHandler{
+		Text: func(s string) { text.WriteString(s) },
+		Tool: func(call ToolCall) (string, error) {
+			parts, err := call.Command()
+			calls = append(calls, strings.Join(parts, " "))
+			return "ok", err
+		},
+	})
+	if err != nil {
+		t.Fatalf("SessionStream() error: %v", err)
+	}
+
+	if text.String() != "Adding a kick.Done." || response.Message != text.String() {
+		t.Errorf("text = %q, message = %q", text.String(), response.Message)
+	}
+	if !reflect.DeepEqual(calls, []string{"set 1 C1"}) {
+		t.Errorf("tool calls = %v", calls)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	// Local models get the compact prompt and only the core tools
+	if requests[0].Model != "test" || len(requests[0].Tools) != len(coreTools) || !requests[0].Stream {
+		t.Errorf("first request = model %q, %d tools, stream %v", requests[0].Model, len(requests[0].Tools), requests[0].Stream)
+	}
+	if system := requests[0].Messages[0].Content; !strings.HasPrefix(system, "You are a music assistant") || !strings.Contains(system, "from 1 to 16.") {
+		t.Errorf("system prompt = %q", system)
+	}
+	last := requests[1].Messages[len(requests[1].Messages)-1]
+	if last.Role != "tool" || last.ToolCallID != "call_a" || last.Content != "ok" {
+		t.Errorf("tool result message = %+v", last)
+	}
+	if len(client.conversationHistory) != 4 {
+		t.Errorf("history has %d turns, want 4", len(client.conversationHistory))
+	}
+
+	// Both requests are counted; the local model is free
+	want := Usage{Requests: 2, InputTokens: 12, OutputTokens: 3}
+	if response.Usage != want || client.SessionUsage()["ollama:test"] != want {
+		t.Errorf("usage = %+v, session %+v, want %+v", response.Usage, client.SessionUsage(), want)
+	}
+	if total, err := LoadUsage(); err != nil || total["ollama:test"] != want {
+		t.Errorf("LoadUsage() = %+v, %v", total, err)
+	}
+}
+
+// TestSystemPrompts tests filling the built-in and user prompt templates
+func TestSystemPrompts(t *testing.T) {
+	orig := PromptsDir
+	defer func() {
+		PromptsDir = orig
+		promptTemplates = builtinTemplates
+	}()
+	PromptsDir = t.TempDir()
+
+	client := &Client{}
+	for _, name := range promptNames {
+		prompt := client.systemPrompt(name, sequence.New(32))
+		if !strings.Contains(prompt, "32") || strings.Contains(prompt, "{{") || strings.Contains(prompt, "%!") {
+			t.Errorf("%s prompt not filled in:\n%s", name, prompt)
+		}
+	}
+
+	client.SetInstrument("Target instrument: Minilogue")
+	if err := client.SetGenre("techno"); err != nil {
+		t.Fatal(err)
+	}
+	client.SetStyle("STYLE: techno")
+	prompt := client.systemPrompt("session", sequence.New(16))
+	if !strings.Contains(prompt, "STYLE: techno\n\nTarget") {
+		t.Errorf("session prompt lacks style:\n%s", prompt)
+	}
+	if !strings.HasSuffix(prompt, "Target instrument: Minilogue") || !strings.Contains(prompt, "Genre: techno\nStyle: techno") {
+		t.Errorf("session prompt lacks genre or instrument:\n%s", prompt)
+	}
+	if err := client.SetGenre("polka"); err == nil {
+		t.Error("SetGenre(polka) should fail")
+	}
+
+	// User templates and genres take precedence; broken templates are reported
+	os.MkdirAll(filepath.Join(PromptsDir, "genres"), 0755)
+	os.WriteFile(filepath.Join(PromptsDir, "chat.tmpl"), []byte("Chat about {{.Bars}} bars ({{.GenreName}})"), 0644)
+	os.WriteFile(filepath.Join(PromptsDir, "session.tmpl"), []byte("{{.Lenght}} steps"), 0644)
+	os.WriteFile(filepath.Join(PromptsDir, "genres", "polka.txt"), []byte("Oom-pah.\n"), 0644)
+
+	err := LoadPrompts()
+	if err == nil || !strings.Contains(err.Error(), "session.tmpl") {
+		t.Errorf("LoadPrompts() error = %v, want session.tmpl error", err)
+	}
+	if err := client.SetGenre("polka"); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.systemPrompt("chat", sequence.New(48)); got != "Chat about 3 bars (polka)" {
+		t.Errorf("user chat prompt = %q", got)
+	}
+	if got := client.systemPrompt("session", sequence.New(48)); !strings.HasPrefix(got, "You are a musical assistant") {
+		t.Errorf("broken user template should fall back to the built-in one, got %q", got)
+	}
+	if genres := Genres(); !reflect.DeepEqual(genres[len(genres)-3:], []string{"jazz", "polka", "techno"}) {
+		t.Errorf("Genres() = %v", genres)
+	}
+}
+
+// TestDescribeContext tests the pattern context sent with each request
+func TestDescribeContext(t *testing.T) {
+	p := sequence.New(40)
+	p.SetNote(1, 36)
+	p.SetNote(5, 43)
+	p.SetVelocity(5, 80)
+
+	client := &Client{}
+	client.SetRecentCommands([]string{"clear", "tempo 120", "set 1 C2", "set 5 G2", "velocity 5 80",
+		"swing 20", "length 40", "humanize timing 5", "set 9 C2", "rest 9", "gate 1 50"})
+
+	context := client.describeContext(p)
+	for _, want := range []string{
+		"Current pattern:\n",
+		"Analysis: key ",
+		", velocity spread ±10",
+		"Bars (4/4 in 16ths, 16 steps each): bar 1 = steps 1-16, bar 2 = steps 17-32, bar 3 = steps 33-40",
+		"Recent commands (oldest first): tempo 120; set 1 C2;", // the oldest is dropped
+	} {
+		if !strings.Contains(context, want) {
+			t.Errorf("context lacks %q:\n%s", want, context)
+		}
+	}
+	if strings.Contains(context, "clear;") {
+		t.Errorf("context should keep only the last %d commands:\n%s", maxRecentCommands, context)
+	}
+
+	p.SetMeter(6, 8, 16)
+	if want := "Bars (6/8 in 16ths, 12 steps each): bar 1 = steps 1-12, bar 2 = steps 13-24, bar 3 = steps 25-36, bar 4 = steps 37-40"; !strings.Contains(client.describeContext(p), want) {
+		t.Errorf("context lacks %q in 6/8", want)
+	}
+}
+
+// TestRequestUsage tests the cost estimate
+func TestRequestUsage(t *testing.T) {
+	tests := []struct {
+		model string
+		want  Usage
+	}{
+		{"gpt-4o", Usage{Requests: 1, InputTokens: 1000000, OutputTokens: 100000, Cost: 3.5}},
+		{"gpt-4o-mini", Usage{Requests: 1, InputTokens: 1000000, OutputTokens: 100000, Cost: 0.21}},
+		{"claude-3-5-haiku-latest", Usage{Requests: 1, InputTokens: 1000000, OutputTokens: 100000, Cost: 1.2}},
+		{"ollama:llama3.1", Usage{Requests: 1, InputTokens: 1000000, OutputTokens: 100000}},
+		{"mystery-model", Usage{Requests: 1, InputTokens: 1000000, OutputTokens: 100000, Unpriced: 1}},
+	}
+	for _, tt := range tests {
+		got := requestUsage(tt.model, 1000000, 100000)
+		if got.Requests != tt.want.Requests || got.Unpriced != tt.want.Unpriced || math.Abs(got.Cost-tt.want.Cost) > 1e-9 {
+			t.Errorf("requestUsage(%s) = %+v, want %+v", tt.model, got, tt.want)
+		}
+	}
+}
+
+// TestSendRetry tests that rate limit and server errors are retried with
+// backoff, other errors are not, and slow requests time out
+func TestSendRetry(t *testing.T) {
+	orig := UsageFile
+	defer func() { UsageFile = orig }()
+	UsageFile = filepath.Join(t.TempDir(), "ai-usage.json")
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	tests := []struct {
+		name         string
+		statuses     []int // response to each request; 200 once they run out
+		wantRequests int
+		wantErr      string
+	}{
+		{"success", nil, 1, ""},
+		{"rate limited", []int{429, 503}, 3, ""},
+		{"gives up", []int{500, 500, 500, 500, 500}, maxRetries + 1, "500 Internal Server Error"},
+		{"bad request", []int{400}, 1, "400 Bad Request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= len(tt.statuses) {
+					http.Error(w, `{"error":{"message":"try again"}}`, tt.statuses[requests-1])
+					return
+				}
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n")
+			}))
+			defer server.Close()
+
+			client := &Client{provider: newOpenAI("ollama", server.URL, ""), model: "ollama:test", apiModel: "test"}
+			_, err := client.Chat(context.Background(), "hello", sequence.New(16))
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Chat() error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Chat() error = %v, want %q", err, tt.wantErr)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", requests, tt.wantRequests)
+			}
+			// A failed request is left out of the conversation
+			wantHistory := 2
+			if err != nil {
+				wantHistory = 0
+			}
+			if len(client.conversationHistory) != wantHistory {
+				t.Errorf("history has %d turns, want %d", len(client.conversationHistory), wantHistory)
+			}
+		})
+	}
+
+	// This server never answers; the client gives up
+	hang := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer server.Close()
+	defer close(hang)
+	client := &Client{provider: newOpenAI("ollama", server.URL, ""), model: "ollama:test", apiModel: "test"}
+
+	client.SetTimeout(20 * time.Millisecond)
+	if _, err := client.Chat(context.Background(), "hello", sequence.New(16)); err == nil || !strings.Contains(err.Error(), "no response within 20ms") {
+		t.Errorf("Chat() error = %v, want timeout", err)
+	}
+
+	client.SetTimeout(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := client.Chat(ctx, "hello", sequence.New(16)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Chat() error = %v, want context.Canceled", err)
+	}
+}
+
+// TestSaveHistory tests that a conversation with tool calls survives
+// saving and loading
+func TestSaveHistory(t *testing.T) {
+	orig := ChatsDir
+	defer func() { ChatsDir = orig }()
+	ChatsDir = filepath.Join(t.TempDir(), "chats")
+
+	client := &Client{model: "ollama:test"}
+	if err := client.SaveHistory("empty"); err == nil {
+		t.Error("saving an empty conversation should fail")
+	}
+
+	history := []message{
+		{role: "user", text: "add a kick"},
+		{role: "assistant", text: "Adding one.", toolCalls: []ToolCall{{ID: "call_1", Name: "set_step", Input: json.RawMessage(`{"step":1,"note":"C1"}`)}}},
+		{role: "user", toolResults: []toolResult{{id: "call_1", content: "step 1 out of range", isError: true}}},
+		{role: "assistant", text: "Done."},
+	}
+	client.conversationHistory = history
+	if err := client.SaveHistory("kick"); err != nil {
+		t.Fatalf("SaveHistory() error: %v", err)
+	}
+
+	loaded := &Client{}
+	if err := loaded.LoadHistory("kick"); err != nil {
+		t.Fatalf("LoadHistory() error: %v", err)
+	}
+	// Tool input is saved indented
+	input := &loaded.conversationHistory[1].toolCalls[0].Input
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, *input); err != nil {
+		t.Fatal(err)
+	}
+	*input = compact.Bytes()
+	if !reflect.DeepEqual(loaded.conversationHistory, history) {
+		t.Errorf("loaded history = %+v, want %+v", loaded.conversationHistory, history)
+	}
+	if names, err := SavedChats(); err != nil || !reflect.DeepEqual(names, []string{"kick"}) {
+		t.Errorf("SavedChats() = %v, %v", names, err)
+	}
+
+	for _, name := range []string{"missing", "../kick", ".hidden", ""} {
+		if err := loaded.LoadHistory(name); err == nil {
+			t.Errorf("LoadHistory(%q) should fail", name)
+		}
+	}
+	if loaded.HistoryLen() != len(history) {
+		t.Error("a failed load should keep the conversation")
+	}
+}
+
+// TestCritique tests that a critique is a tool-free request that joins
+// the conversation
+func TestCritique(t *testing.T) {
+	orig := UsageFile
+	defer func() { UsageFile = orig }()
+	UsageFile = filepath.Join(t.TempDir(), "ai-usage.json")
+
+	var req chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Groove: solid.\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := &Client{provider: newOpenAI("ollama", server.URL, ""), model: "ollama:test", apiModel: "test"}
+	var text strings.Builder
+	response, err := client.Critique(context.Background(), sequence.New(32), func(s string) { text.WriteString(s) })
+	if err != nil {
+		t.Fatalf("Critique() error: %v", err)
+	}
+	if response.Message != "Groove: solid." || text.String() != response.Message {
+		t.Errorf("critique = %q, streamed %q", response.Message, text.String())
+	}
+	if len(req.Tools) != 0 || !strings.Contains(req.Messages[0].Content, "32 steps") || !strings.HasSuffix(req.Messages[1].Content, "Critique this pattern.") {
+		t.Errorf("request = %d tools, messages %+v", len(req.Tools), req.Messages)
+	}
+	if len(client.conversationHistory) != 2 {
+		t.Errorf("history has %d turns, want 2", len(client.conversationHistory))
+	}
+}
+
+func TestDiscoverModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"qwen3"},{"id":"nomic-embed-text"},{"id":"models/llama3.1"}]}`)
+	}))
+	defer server.Close()
+	for _, key := range []string{"ANTHROPIC_API_KEY", "OPENAI_API_KEY", "GEMINI_API_KEY", "GOOGLE_API_KEY"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("OLLAMA_HOST", server.URL)
+	defer func() {
+		delete(discovered, "ollama")
+		CustomModels = nil
+	}()
+	CustomModels = []string{"claude-sonnet-9"}
+
+	before := Models()
+	if !slices.Contains(before, DefaultLocalModel) || !slices.Contains(before, "claude-sonnet-9") {
+		t.Errorf("before discovery, Models() = %v, want the fallback and custom models", before)
+	}
+	if err := DiscoverModels(context.Background()); err != nil {
+		t.Fatalf("DiscoverModels() error = %v", err)
+	}
+	after := Models()
+	for _, want := range []string{"ollama:qwen3", "ollama:llama3.1", "claude-sonnet-9", string(DefaultModel)} {
+		if !slices.Contains(after, want) {
+			t.Errorf("Models() = %v, missing %s", after, want)
+		}
+	}
+	if slices.Contains(after, DefaultLocalModel) || slices.Contains(after, "ollama:nomic-embed-text") {
+		t.Errorf("Models() = %v, want the listed local models replacing the fallback, without embeddings", after)
+	}
+
+	// A server that doesn't answer keeps the previous list and reports the error
+	t.Setenv("OLLAMA_HOST", "127.0.0.1:1")
+	if err := DiscoverModels(context.Background()); err == nil || !strings.Contains(err.Error(), "ollama") {
+		t.Errorf("DiscoverModels() error = %v, want ollama error", err)
+	}
+	if !slices.Contains(Models(), "ollama:qwen3") {
+		t.Error("a failed listing should keep the models listed before")
+	}
+}
+
+func TestModelParams(t *testing.T) {
+	origParams, origUsage := ParamsFile, UsageFile
+	defer func() { ParamsFile, UsageFile = origParams, origUsage }()
+	ParamsFile = filepath.Join(t.TempDir(), "model-params.json")
+	UsageFile = filepath.Join(t.TempDir(), "ai-usage.json")
+
+	var last chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = chatRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&last); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	hot := 0.9
+	client := &Client{provider: newOpenAI("ollama", server.URL, ""), model: "ollama:test", apiModel: "test"}
+	client.SetDefaultParams(Params{Temperature: &hot, MaxTokens: 500})
+	if _, err := client.Chat(context.Background(), "hi", sequence.New(16)); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if last.Temperature == nil || *last.Temperature != 0.9 || last.MaxTokens != 500 {
+		t.Errorf("defaults: temperature %v, max tokens %d", last.Temperature, last.MaxTokens)
+	}
+
+	// Parameters set for the model override the defaults and are kept
+	cold := 0.1
+	if err := client.SetModelParams(Params{Temperature: &cold}); err != nil {
+		t.Fatalf("SetModelParams() error = %v", err)
+	}
+	if _, err := client.Chat(context.Background(), "hi", sequence.New(16)); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if last.Temperature == nil || *last.Temperature != 0.1 || last.MaxTokens != 500 {
+		t.Errorf("model params: temperature %v, max tokens %d", last.Temperature, last.MaxTokens)
+	}
+	if saved, _ := LoadParams(); saved["ollama:test"].Temperature == nil {
+		t.Errorf("LoadParams() = %v, want the model's temperature", saved)
+	}
+
+	tooHot := 1.5
+	for _, tt := range []struct {
+		model string
+		p     Params
+	}{
+		{"ollama:test", Params{Thinking: 2000}},
+		{"claude-sonnet-4-5", Params{Thinking: 100}},
+		{"claude-sonnet-4-5", Params{Temperature: &tooHot}},
+		{"gpt-4o", Params{MaxTokens: -1}},
+	} {
+		if err := tt.p.validate(tt.model); err == nil {
+			t.Errorf("validate(%s, %v) should fail", tt.model, tt.p)
+		}
+	}
+	if err := (Params{Temperature: &tooHot}).validate("gpt-4o"); err != nil {
+		t.Errorf("temperature 1.5 should be fine for gpt-4o: %v", err)
+	}
+}
+
+func TestAnthropicThinking(t *testing.T) {
+	// Thinking goes back before the tool calls it led to
+	params := anthropicMessages([]message{{
+		role:      "assistant",
+		thinking:  []thinkingBlock{{text: "hmm", signature: "sig"}},
+		toolCalls: []ToolCall{{ID: "t1", Name: "set_step", Input: json.RawMessage(`{}`)}},
+	}})
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thinking, tool := bytes.Index(data, []byte(`"type":"thinking"`)), bytes.Index(data, []byte(`"type":"tool_use"`))
+	if thinking < 0 || tool < 0 || thinking > tool {
+		t.Errorf("thinking should precede tool use: %s", data)
+	}
+}
+
+func TestGenerateCommandsCache(t *testing.T) {
+	origCache, origUsage, origParams := CacheDir, UsageFile, ParamsFile
+	defer func() { CacheDir, UsageFile, ParamsFile = origCache, origUsage, origParams }()
+	CacheDir = filepath.Join(t.TempDir(), "ai-cache")
+	UsageFile = filepath.Join(t.TempDir(), "ai-usage.json")
+	ParamsFile = filepath.Join(t.TempDir(), "model-params.json")
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"set 1 C3\\nset 5 G3\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := &Client{provider: newOpenAI("ollama", server.URL, ""), model: "ollama:test", apiModel: "test"}
+	p := sequence.New(16)
+	generate := func() []string {
+		t.Helper()
+		commands, err := client.GenerateCommands(context.Background(), "a bassline", p)
+		if err != nil {
+			t.Fatalf("GenerateCommands() error = %v", err)
+		}
+		return commands
+	}
+
+	first := generate()
+	if second := generate(); !reflect.DeepEqual(first, second) || requests != 1 {
+		t.Errorf("repeat: got %v after %d requests, want %v from the cache", second, requests, first)
+	}
+
+	// A changed pattern is a different request
+	p.SetNote(3, 40)
+	generate()
+	if requests != 2 {
+		t.Errorf("changed pattern: %d requests, want 2", requests)
+	}
+
+	client.SetCache(false)
+	generate()
+	if requests != 3 {
+		t.Errorf("cache off: %d requests, want 3", requests)
+	}
+}
+
+func TestResolveModel(t *testing.T) {
+	tests := []struct {
+		name, want string
+		wantErr    bool
+	}{
+		{"gpt-5", "gpt-5", false}, // prefixed names pass through
+		{"ollama:mistral", "ollama:mistral", false},
+		{"haiku", "claude-haiku-4-5", false}, // the newest of the listed haikus
+		{"sonnet", "claude-sonnet-4-5", false},
+		{"nonsense", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveModel(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ResolveModel(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestGenerateCommandsWithModel(t *testing.T) {
+	origUsage, origParams := UsageFile, ParamsFile
+	defer func() { UsageFile, ParamsFile = origUsage, origParams }()
+	UsageFile = filepath.Join(t.TempDir(), "ai-usage.json")
+	ParamsFile = filepath.Join(t.TempDir(), "model-params.json")
+
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Model string }
+		json.NewDecoder(r.Body).Decode(&body)
+		models = append(models, body.Model)
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"set 1 C3\\n# bass\\n\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	client, err := NewForModel("ollama:first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands, raw, err := client.GenerateCommandsWithModel(context.Background(), "a bassline", sequence.New(16), "ollama:second")
+	if err != nil {
+		t.Fatalf("GenerateCommandsWithModel() error = %v", err)
+	}
+	if !reflect.DeepEqual(commands, []string{"set 1 C3"}) || raw != "set 1 C3\n# bass\n" {
+		t.Errorf("got %q, raw %q", commands, raw)
+	}
+	if !reflect.DeepEqual(models, []string{"second"}) || client.Model() != "ollama:first" {
+		t.Errorf("requested %v, selected %q; want second, with first still selected", models, client.Model())
+	}
+	if _, _, err := client.GenerateCommandsWithModel(context.Background(), "a bassline", sequence.New(16), "nonsense"); err == nil {
+		t.Error("unknown model should fail")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	defer SetLimits(nil)
+	if err := SetLimits(map[string]Limit{"acme": {RPM: 1}}); err == nil {
+		t.Error("unknown provider should fail")
+	}
+	if err := SetLimits(map[string]Limit{"*": {Concurrent: 1}, "ollama": {RPM: 600}}); err != nil {
+		t.Fatalf("SetLimits() error = %v", err)
+	}
+
+	// 600 per minute spaces requests 100ms apart
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := acquire(context.Background(), "ollama")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("3 requests took %s, want at least 200ms", elapsed)
+	}
+
+	// One request in flight at a time: the next waits, and gives up with its context
+	release, err := acquire(context.Background(), "claude")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := acquire(ctx, "claude"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("acquire() with no free slot: error = %v", err)
+	}
+	release()
+	if release, err := acquire(context.Background(), "claude"); err != nil {
+		t.Errorf("acquire() after release: %v", err)
+	} else {
+		release()
+	}
+
+	// Providers without limits never wait
+	if err := SetLimits(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquire(ctx, "claude"); err != nil {
+		t.Errorf("unlimited acquire() error = %v", err)
+	}
+}
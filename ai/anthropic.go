@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// anthropicProvider talks to the Claude API through the Anthropic SDK
+type anthropicProvider struct {
+	client anthropic.Client
+}
+
+func newAnthropic(apiKey string) (*anthropicProvider, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY not set")
+	}
+	// Client.send does the retrying
+	return &anthropicProvider{client: anthropic.NewClient(option.WithAPIKey(apiKey), option.WithMaxRetries(0))}, nil
+}
+
+func (p *anthropicProvider) name() string {
+	return "claude"
+}
+
+func (p *anthropicProvider) local() bool {
+	return false
+}
+
+// models lists the models of the Models API
+func (p *anthropicProvider) models(ctx context.Context) ([]string, error) {
+	var ids []string
+	pager := p.client.Models.ListAutoPaging(ctx, anthropic.ModelListParams{})
+	for pager.Next() {
+		ids = append(ids, pager.Current().ID)
+	}
+	return ids, pager.Err()
+}
+
+// send streams a Messages API request
+func (p *anthropicProvider) send(ctx context.Context, req request, onText func(string), onToolCall func(ToolCall)) (*reply, error) {
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.Model(req.model),
+		MaxTokens: int64(req.maxTokens),
+		System: []anthropic.TextBlockParam{
+			{Text: req.system},
+		},
+		Messages: anthropicMessages(req.messages),
+	}
+	if len(req.tools) > 0 {
+		params.Tools = toolParams(req.tools)
+	}
+	if req.textOnly {
+		params.ToolChoice = anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}
+	}
+	if req.thinking > 0 {
+		// The budget counts towards max_tokens, and thinking needs the
+		// default temperature
+		params.MaxTokens += int64(req.thinking)
+		params.Thinking = anthropic.ThinkingConfigParamOfEnabled(int64(req.thinking))
+	} else if req.temperature != nil {
+		params.Temperature = anthropic.Float(*req.temperature)
+	}
+
+	stream := p.client.Messages.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	message := anthropic.Message{}
+	for stream.Next() {
+		event := stream.Current()
+		if err := message.Accumulate(event); err != nil {
+			return nil, err
+		}
+		switch e := event.AsAny().(type) {
+		case anthropic.ContentBlockDeltaEvent:
+			if text, ok := e.Delta.AsAny().(anthropic.TextDelta); ok {
+				onText(text.Text)
+			}
+		case anthropic.ContentBlockStopEvent:
+			block := message.Content[len(message.Content)-1]
+			if block.Type == "tool_use" {
+				onToolCall(ToolCall{ID: block.ID, Name: block.Name, Input: block.Input})
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	r := &reply{
+		inputTokens:  message.Usage.InputTokens,
+		outputTokens: message.Usage.OutputTokens,
+		stopReason:   string(message.StopReason),
+	}
+	for _, block := range message.Content {
+		switch b := block.AsAny().(type) {
+		case anthropic.TextBlock:
+			r.text += b.Text
+		case anthropic.ToolUseBlock:
+			r.toolCalls = append(r.toolCalls, ToolCall{ID: b.ID, Name: b.Name, Input: b.Input})
+		case anthropic.ThinkingBlock:
+			r.thinking = append(r.thinking, thinkingBlock{text: b.Thinking, signature: b.Signature})
+		case anthropic.RedactedThinkingBlock:
+			r.thinking = append(r.thinking, thinkingBlock{redacted: b.Data})
+		}
+	}
+	return r, nil
+}
+
+// anthropicMessages converts the conversation to Messages API turns
+func anthropicMessages(messages []message) []anthropic.MessageParam {
+	params := make([]anthropic.MessageParam, 0, len(messages))
+	for _, m := range messages {
+		var blocks []anthropic.ContentBlockParamUnion
+		// Thinking has to precede the tool calls it led to
+		for _, t := range m.thinking {
+			if t.redacted != "" {
+				blocks = append(blocks, anthropic.NewRedactedThinkingBlock(t.redacted))
+			} else {
+				blocks = append(blocks, anthropic.NewThinkingBlock(t.signature, t.text))
+			}
+		}
+		if m.text != "" {
+			blocks = append(blocks, anthropic.NewTextBlock(m.text))
+		}
+		for _, call := range m.toolCalls {
+			blocks = append(blocks, anthropic.NewToolUseBlock(call.ID, call.Input, call.Name))
+		}
+		for _, result := range m.toolResults {
+			blocks = append(blocks, anthropic.NewToolResultBlock(result.id, result.content, result.isError))
+		}
+		if m.role == "assistant" {
+			params = append(params, anthropic.NewAssistantMessage(blocks...))
+		} else {
+			params = append(params, anthropic.NewUserMessage(blocks...))
+		}
+	}
+	return params
+}
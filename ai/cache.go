@@ -0,0 +1,68 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CacheDir keeps GenerateCommands responses, so repeating a prompt on the
+// same pattern (e.g. in a scripted demo) costs no tokens
+var CacheDir = "ai-cache"
+
+// cachedCommands is a cached GenerateCommands response
+type cachedCommands struct {
+	Model    string   `json:"model"`
+	Request  string   `json:"request"`
+	Commands []string `json:"commands"`
+}
+
+// SetCache turns the response cache on or off (it is on by default)
+func (c *Client) SetCache(on bool) {
+	c.noCache = !on
+}
+
+// cacheKey identifies a request by the model, its parameters, the prompts
+// and the pattern they describe
+func (c *Client) cacheKey(system, userMessage string) string {
+	params, _ := c.ModelParams()
+	sum := sha256.Sum256([]byte(c.model + "\x00" + params.String() + "\x00" + system + "\x00" + userMessage))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedResponse returns the commands cached under key, if any
+func (c *Client) cachedResponse(key string) ([]string, bool) {
+	if c.noCache {
+		return nil, false
+	}
+	data, err := os.ReadFile(filepath.Join(CacheDir, key+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var cached cachedCommands
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, false
+	}
+	return cached.Commands, true
+}
+
+// cacheResponse stores commands under key
+func (c *Client) cacheResponse(key, userRequest string, commands []string) error {
+	if c.noCache {
+		return nil
+	}
+	data, err := json.MarshalIndent(cachedCommands{Model: c.model, Request: userRequest, Commands: commands}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(CacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create AI cache: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(CacheDir, key+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write AI cache: %w", err)
+	}
+	return nil
+}
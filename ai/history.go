@@ -0,0 +1,150 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChatsDir is where conversations are saved; main points it into the
+// configured data directory, next to patterns/
+var ChatsDir = "chats"
+
+// AutosaveChat is the name the latest conversation is saved under after
+// each request
+const AutosaveChat = "last"
+
+// chatFile is a saved conversation
+type chatFile struct {
+	Model    string      `json:"model"`
+	Messages []chatEntry `json:"messages"`
+}
+
+// chatEntry is one saved turn, see message
+type chatEntry struct {
+	Role        string          `json:"role"`
+	Text        string          `json:"text,omitempty"`
+	ToolCalls   []savedToolCall `json:"tool_calls,omitempty"`
+	ToolResults []savedResult   `json:"tool_results,omitempty"`
+}
+
+type savedToolCall struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+type savedResult struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+	IsError bool   `json:"is_error,omitempty"`
+}
+
+// chatPath returns the file a conversation is saved in
+func chatPath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid conversation name: %q", name)
+	}
+	return filepath.Join(ChatsDir, name+".json"), nil
+}
+
+// HistoryLen returns the number of turns in the conversation
+func (c *Client) HistoryLen() int {
+	return len(c.conversationHistory)
+}
+
+// SaveHistory saves the conversation in ChatsDir
+func (c *Client) SaveHistory(name string) error {
+	path, err := chatPath(name)
+	if err != nil {
+		return err
+	}
+	if len(c.conversationHistory) == 0 {
+		return fmt.Errorf("no conversation to save")
+	}
+
+	chat := chatFile{Model: c.model}
+	for _, m := range c.conversationHistory {
+		entry := chatEntry{Role: m.role, Text: m.text}
+		for _, call := range m.toolCalls {
+			entry.ToolCalls = append(entry.ToolCalls, savedToolCall{ID: call.ID, Name: call.Name, Input: call.Input})
+		}
+		for _, result := range m.toolResults {
+			entry.ToolResults = append(entry.ToolResults, savedResult{ID: result.id, Content: result.content, IsError: result.isError})
+		}
+		chat.Messages = append(chat.Messages, entry)
+	}
+
+	data, err := json.MarshalIndent(chat, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation: %w", err)
+	}
+	if err := os.MkdirAll(ChatsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create chats directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write conversation: %w", err)
+	}
+	return nil
+}
+
+// LoadHistory replaces the conversation with one saved in ChatsDir. The
+// model stays as it is; the conversation carries over like with SetModel.
+func (c *Client) LoadHistory(name string) error {
+	path, err := chatPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("conversation '%s' not found", name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read conversation: %w", err)
+	}
+	var chat chatFile
+	if err := json.Unmarshal(data, &chat); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	history := make([]message, 0, len(chat.Messages))
+	for i, entry := range chat.Messages {
+		if entry.Role != "user" && entry.Role != "assistant" {
+			return fmt.Errorf("%s: message %d has unknown role %q", path, i+1, entry.Role)
+		}
+		m := message{role: entry.Role, text: entry.Text}
+		for _, call := range entry.ToolCalls {
+			m.toolCalls = append(m.toolCalls, ToolCall{ID: call.ID, Name: call.Name, Input: call.Input})
+		}
+		for _, result := range entry.ToolResults {
+			m.toolResults = append(m.toolResults, toolResult{id: result.ID, content: result.Content, isError: result.IsError})
+		}
+		history = append(history, m)
+	}
+	c.conversationHistory = history
+	return nil
+}
+
+// SavedChats lists the saved conversations, sorted
+func SavedChats() ([]string, error) {
+	entries, err := os.ReadDir(ChatsDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chats directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
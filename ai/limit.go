@@ -0,0 +1,113 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Limit throttles the requests to one provider, shared by all clients
+type Limit struct {
+	RPM        int // requests started per minute (0 for no limit)
+	Concurrent int // requests in flight at once (0 for no limit)
+}
+
+// limiter enforces a Limit: requests are spaced evenly over the minute and
+// wait for a free slot
+type limiter struct {
+	limit Limit
+	slots chan struct{} // nil without a concurrency limit
+	mu    sync.Mutex
+	next  time.Time // earliest start of the next request
+}
+
+// providerNames are the providers limits can be set for
+var providerNames = []string{"claude", "openai", "gemini", "ollama"}
+
+var (
+	limitsMu sync.Mutex
+	limiters = map[string]*limiter{}
+)
+
+// SetLimits sets the limits per provider ("claude", "openai", "gemini",
+// "ollama"). Limits under "*" apply to every provider that doesn't set its
+// own; providers without limits are not throttled.
+func SetLimits(limits map[string]Limit) error {
+	for name, limit := range limits {
+		if name != "*" && !slices.Contains(providerNames, name) {
+			return fmt.Errorf("unknown AI provider %q (use %v)", name, providerNames)
+		}
+		if limit.RPM < 0 || limit.Concurrent < 0 {
+			return fmt.Errorf("%s: limits must not be negative", name)
+		}
+	}
+
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	limiters = map[string]*limiter{}
+	for _, name := range providerNames {
+		limit := limits[name]
+		if limit.RPM == 0 {
+			limit.RPM = limits["*"].RPM
+		}
+		if limit.Concurrent == 0 {
+			limit.Concurrent = limits["*"].Concurrent
+		}
+		if limit == (Limit{}) {
+			continue
+		}
+		l := &limiter{limit: limit}
+		if limit.Concurrent > 0 {
+			l.slots = make(chan struct{}, limit.Concurrent)
+		}
+		limiters[name] = l
+	}
+	return nil
+}
+
+// acquire waits until provider may start a request. The returned function
+// frees its slot once the request is done.
+func acquire(ctx context.Context, provider string) (func(), error) {
+	limitsMu.Lock()
+	l := limiters[provider]
+	limitsMu.Unlock()
+	if l == nil {
+		return func() {}, nil
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	if l.limit.RPM > 0 {
+		l.mu.Lock()
+		start := time.Now()
+		if l.next.After(start) {
+			start = l.next
+		}
+		l.next = start.Add(time.Minute / time.Duration(l.limit.RPM))
+		l.mu.Unlock()
+		if wait := time.Until(start); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return release, nil
+}
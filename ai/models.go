@@ -0,0 +1,139 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// fallbackModels are offered for a vendor until its API has listed its
+// models, see DiscoverModels
+var fallbackModels = map[string][]string{
+	"claude": {string(DefaultModel), "claude-haiku-4-5", "claude-sonnet-4-5", "claude-opus-4-1"},
+	"openai": {DefaultOpenAIModel, "gpt-4o-mini", "gpt-4.1", "o3-mini"},
+	"gemini": {DefaultGeminiModel, "gemini-2.5-flash", "gemini-2.5-pro"},
+	"ollama": {DefaultLocalModel, ollamaPrefix + "llama3.1", ollamaPrefix + "qwen2.5"},
+}
+
+// CustomModels are model IDs added in the config file (ai_models), offered
+// alongside the listed ones, e.g. a release newer than the fallback list
+var CustomModels []string
+
+var (
+	modelsMu   sync.Mutex
+	discovered = map[string][]string{} // models listed by each vendor's API
+)
+
+// nonChatModels marks model IDs that vendors list but that can't chat
+// (embeddings, speech, images)
+var nonChatModels = []string{"embed", "tts", "whisper", "dall-e", "audio", "realtime", "transcribe", "image", "moderation"}
+
+// isChatModel reports whether a listed model can be used with 'model'
+func isChatModel(id string) bool {
+	if vendorOf(id) == "" {
+		return false
+	}
+	for _, word := range nonChatModels {
+		if strings.Contains(id, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Models returns the models to choose from, sorted: each vendor's listed
+// models (or its fallback list until DiscoverModels has reached it) and
+// CustomModels
+func Models() []string {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	var models []string
+	for vendor, fallback := range fallbackModels {
+		if listed, ok := discovered[vendor]; ok {
+			models = append(models, listed...)
+		} else {
+			models = append(models, fallback...)
+		}
+	}
+	models = append(models, CustomModels...)
+	slices.Sort(models)
+	return slices.Compact(models)
+}
+
+// modelProviders returns a provider for each vendor that can be asked for
+// its models: those with an API key set, and the local server
+func modelProviders() []provider {
+	var providers []provider
+	if key := os.Getenv("ANTHROPIC_API_KEY"); key != "" {
+		if p, err := newAnthropic(key); err == nil {
+			providers = append(providers, p)
+		}
+	}
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		providers = append(providers, newOpenAI("openai", openAIURL, key))
+	}
+	if key := geminiKey(); key != "" {
+		providers = append(providers, newOpenAI("gemini", geminiURL, key))
+	}
+	return append(providers, newOpenAI("ollama", ollamaURL(), ""))
+}
+
+// DiscoverModels asks each vendor with an API key, and the local server,
+// which models it serves; Models then offers those. Vendors that can't be
+// reached keep their fallback list and their errors are returned. No local
+// server running is only an error if OLLAMA_HOST points at one.
+func DiscoverModels(ctx context.Context) error {
+	var errs []error
+	for _, p := range modelProviders() {
+		listed, err := p.models(ctx)
+		if err != nil {
+			if p.name() != "ollama" || os.Getenv("OLLAMA_HOST") != "" {
+				errs = append(errs, fmt.Errorf("%s: %w", p.name(), err))
+			}
+			continue
+		}
+		listed = slices.DeleteFunc(listed, func(id string) bool { return !isChatModel(id) })
+		modelsMu.Lock()
+		discovered[p.name()] = listed
+		modelsMu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// ResolveModel expands a short name like "haiku" to a listed model
+// containing it, the last in sorted order (usually the newest). Names with
+// a vendor prefix are returned as they are.
+func ResolveModel(name string) (string, error) {
+	if vendorOf(name) != "" {
+		return name, nil
+	}
+	var found string
+	for _, model := range Models() {
+		if strings.Contains(model, name) {
+			found = model
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("no model matches %q (see 'models')", name)
+	}
+	return found, nil
+}
+
+// DefaultModels returns the default model of each vendor with an API key set
+func DefaultModels() []string {
+	var models []string
+	if os.Getenv("ANTHROPIC_API_KEY") != "" {
+		models = append(models, string(DefaultModel))
+	}
+	if os.Getenv("OPENAI_API_KEY") != "" {
+		models = append(models, DefaultOpenAIModel)
+	}
+	if geminiKey() != "" {
+		models = append(models, DefaultGeminiModel)
+	}
+	return models
+}
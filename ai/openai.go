@@ -0,0 +1,328 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Chat Completions endpoints. Gemini and Ollama both serve the OpenAI
+// format, so one provider covers all three.
+const (
+	openAIURL = "https://api.openai.com/v1/chat/completions"
+	geminiURL = "https://generativelanguage.googleapis.com/v1beta/openai/chat/completions"
+)
+
+// ollamaURL returns the Chat Completions endpoint of the Ollama server in
+// OLLAMA_HOST (default localhost:11434)
+func ollamaURL() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		host = "localhost:11434"
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/") + "/v1/chat/completions"
+}
+
+// openAIProvider talks to an OpenAI-compatible Chat Completions API
+type openAIProvider struct {
+	vendor string // "openai", "gemini" or "ollama"
+	url    string
+	apiKey string // sent as a bearer token unless empty
+}
+
+func newOpenAI(vendor, url, apiKey string) *openAIProvider {
+	return &openAIProvider{vendor: vendor, url: url, apiKey: apiKey}
+}
+
+func (p *openAIProvider) name() string {
+	return p.vendor
+}
+
+func (p *openAIProvider) local() bool {
+	return p.vendor == "ollama"
+}
+
+// models lists the models of the server's /models endpoint. Gemini names
+// them "models/<id>"; local ones get the ollama: prefix.
+func (p *openAIProvider) models(ctx context.Context) ([]string, error) {
+	url := strings.TrimSuffix(p.url, "/chat/completions") + "/models"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, chatError(resp)
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid model list: %w", err)
+	}
+	ids := make([]string, 0, len(list.Data))
+	for _, model := range list.Data {
+		id := strings.TrimPrefix(model.ID, "models/")
+		if p.local() {
+			id = ollamaPrefix + id
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+type chatRequest struct {
+	Model               string         `json:"model"`
+	Messages            []chatMessage  `json:"messages"`
+	MaxTokens           int            `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int            `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64       `json:"temperature,omitempty"`
+	Tools               []chatTool     `json:"tools,omitempty"`
+	ToolChoice          string         `json:"tool_choice,omitempty"`
+	Stream              bool           `json:"stream"`
+	StreamOptions       *streamOptions `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type chatToolCall struct {
+	Index    int          `json:"index,omitempty"` // position in a streamed reply
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function chatFunction `json:"function"`
+}
+
+type chatFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type chatTool struct {
+	Type     string       `json:"type"`
+	Function chatToolSpec `json:"function"`
+}
+
+type chatToolSpec struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// chatChunk is one event of a streamed reply
+type chatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string         `json:"content"`
+			ToolCalls []chatToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// chatTools describes the tools in the Chat Completions format
+func chatTools(offered []tool) []chatTool {
+	specs := make([]chatTool, len(offered))
+	for i, t := range offered {
+		parameters := map[string]any{"type": "object", "properties": t.properties}
+		if len(t.required) > 0 {
+			parameters["required"] = t.required
+		}
+		specs[i] = chatTool{Type: "function", Function: chatToolSpec{
+			Name:        t.name,
+			Description: t.description,
+			Parameters:  parameters,
+		}}
+	}
+	return specs
+}
+
+// chatMessages converts the conversation to Chat Completions messages;
+// tool results become "tool" messages of their own
+func chatMessages(system string, messages []message) []chatMessage {
+	out := []chatMessage{{Role: "system", Content: system}}
+	for _, m := range messages {
+		for _, result := range m.toolResults {
+			content := result.content
+			if result.isError {
+				content = "Error: " + content
+			}
+			out = append(out, chatMessage{Role: "tool", ToolCallID: result.id, Content: content})
+		}
+		if m.text == "" && len(m.toolCalls) == 0 && len(m.toolResults) > 0 {
+			continue
+		}
+		msg := chatMessage{Role: m.role, Content: m.text}
+		for _, call := range m.toolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, chatToolCall{
+				ID:       call.ID,
+				Type:     "function",
+				Function: chatFunction{Name: call.Name, Arguments: string(call.Input)},
+			})
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// send streams a Chat Completions request
+func (p *openAIProvider) send(ctx context.Context, req request, onText func(string), onToolCall func(ToolCall)) (*reply, error) {
+	body := chatRequest{
+		Model:    req.model,
+		Messages: chatMessages(req.system, req.messages),
+		Stream:   true,
+	}
+	if p.vendor == "openai" {
+		// Newer OpenAI models only take max_completion_tokens, which other
+		// servers don't know; token usage is only streamed when asked for
+		body.MaxCompletionTokens = req.maxTokens
+		body.StreamOptions = &streamOptions{IncludeUsage: true}
+	} else {
+		body.MaxTokens = req.maxTokens
+	}
+	if !isOpenAIReasoning(req.model) {
+		// Reasoning models only run at their default temperature
+		body.Temperature = req.temperature
+	}
+	if len(req.tools) > 0 {
+		body.Tools = chatTools(req.tools)
+		if req.textOnly {
+			body.ToolChoice = "none"
+		}
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, chatError(resp)
+	}
+
+	r := &reply{}
+	var calls []*chatToolCall
+	byIndex := map[int]*chatToolCall{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk chatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("invalid stream event: %w", err)
+		}
+		if chunk.Usage != nil {
+			r.inputTokens = chunk.Usage.PromptTokens
+			r.outputTokens = chunk.Usage.CompletionTokens
+		}
+		for _, choice := range chunk.Choices {
+			if text := choice.Delta.Content; text != "" {
+				r.text += text
+				onText(text)
+			}
+			// Tool call arguments arrive in pieces; a new ID at a known
+			// index (some servers send every call at index 0) starts a new call
+			for _, delta := range choice.Delta.ToolCalls {
+				call, ok := byIndex[delta.Index]
+				if !ok || (delta.ID != "" && call.ID != "" && delta.ID != call.ID) {
+					call = &chatToolCall{}
+					byIndex[delta.Index] = call
+					calls = append(calls, call)
+				}
+				if delta.ID != "" {
+					call.ID = delta.ID
+				}
+				if delta.Function.Name != "" {
+					call.Function.Name = delta.Function.Name
+				}
+				call.Function.Arguments += delta.Function.Arguments
+			}
+			if choice.FinishReason != "" {
+				r.stopReason = choice.FinishReason
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, call := range calls {
+		id := call.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i+1)
+		}
+		input := strings.TrimSpace(call.Function.Arguments)
+		if input == "" {
+			input = "{}"
+		}
+		toolCall := ToolCall{ID: id, Name: call.Function.Name, Input: json.RawMessage(input)}
+		r.toolCalls = append(r.toolCalls, toolCall)
+		onToolCall(toolCall)
+	}
+	return r, nil
+}
+
+// chatError turns an error response into an error, preferring the API's message
+func chatError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &e) == nil && e.Error.Message != "" {
+		message = e.Error.Message
+	}
+	return &statusError{code: resp.StatusCode, message: resp.Status + ": " + message}
+}
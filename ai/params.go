@@ -0,0 +1,155 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ParamsFile keeps the generation parameters set per model with 'model-config'
+var ParamsFile = "model-params.json"
+
+// minThinking is the smallest extended thinking budget Claude accepts
+const minThinking = 1024
+
+// Params are generation parameters. Zero values keep the defaults: the
+// provider's temperature, the request's own token limit, no thinking.
+type Params struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"` // reply limit in tokens
+	Thinking    int      `json:"thinking,omitempty"`   // extended thinking budget in tokens (Claude only, -1 for off)
+}
+
+// ThinkingOff turns thinking off for a model even if the defaults turn it on
+const ThinkingOff = -1
+
+// merge returns p with the parameters set in over replacing its own
+func (p Params) merge(over Params) Params {
+	if over.Temperature != nil {
+		p.Temperature = over.Temperature
+	}
+	if over.MaxTokens != 0 {
+		p.MaxTokens = over.MaxTokens
+	}
+	if over.Thinking != 0 {
+		p.Thinking = over.Thinking
+	}
+	return p
+}
+
+// String formats the parameters, e.g. "temperature 0.2, max tokens 2048, thinking off"
+func (p Params) String() string {
+	parts := []string{"temperature default", "max tokens default", "thinking off"}
+	if p.Temperature != nil {
+		parts[0] = "temperature " + strconv.FormatFloat(*p.Temperature, 'g', -1, 64)
+	}
+	if p.MaxTokens > 0 {
+		parts[1] = fmt.Sprintf("max tokens %d", p.MaxTokens)
+	}
+	if p.Thinking > 0 {
+		parts[2] = fmt.Sprintf("thinking %d tokens", p.Thinking)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// validate checks the parameters against what model's vendor accepts
+func (p Params) validate(model string) error {
+	maxTemperature := 2.0
+	if vendorOf(model) == "claude" {
+		maxTemperature = 1
+	}
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > maxTemperature) {
+		return fmt.Errorf("temperature must be 0-%g for %s, got %g", maxTemperature, model, *p.Temperature)
+	}
+	if p.MaxTokens < 0 {
+		return fmt.Errorf("max tokens must be positive, got %d", p.MaxTokens)
+	}
+	if p.Thinking > 0 {
+		if vendorOf(model) != "claude" {
+			return fmt.Errorf("extended thinking is only available for Claude models")
+		}
+		if p.Thinking < minThinking {
+			return fmt.Errorf("thinking budget must be at least %d tokens, got %d", minThinking, p.Thinking)
+		}
+	}
+	return nil
+}
+
+// SetDefaultParams sets the parameters used for every model, e.g. from
+// the config file; those set per model with SetModelParams take precedence
+func (c *Client) SetDefaultParams(p Params) {
+	c.defaultParams = p
+}
+
+// ModelParams returns the parameters in effect for the selected model
+func (c *Client) ModelParams() (Params, error) {
+	saved, err := LoadParams()
+	if err != nil {
+		return c.defaultParams, err
+	}
+	return c.defaultParams.merge(saved[c.model]), nil
+}
+
+// SetModelParams sets the parameters for the selected model, keeping
+// them in ParamsFile. Parameters left at zero fall back to the defaults.
+func (c *Client) SetModelParams(p Params) error {
+	if err := p.validate(c.model); err != nil {
+		return err
+	}
+	saved, err := LoadParams()
+	if err != nil {
+		return err
+	}
+	if p == (Params{}) {
+		delete(saved, c.model)
+	} else {
+		saved[c.model] = p
+	}
+	return saveParams(saved)
+}
+
+// SavedParams returns the parameters set for the selected model alone
+func (c *Client) SavedParams() (Params, error) {
+	saved, err := LoadParams()
+	if err != nil {
+		return Params{}, err
+	}
+	return saved[c.model], nil
+}
+
+// LoadParams reads the parameters per model kept in ParamsFile
+func LoadParams() (map[string]Params, error) {
+	params := map[string]Params{}
+	data, err := os.ReadFile(ParamsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return params, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model parameters: %w", err)
+	}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ParamsFile, err)
+	}
+	return params, nil
+}
+
+func saveParams(params map[string]Params) error {
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(ParamsFile); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to save model parameters: %w", err)
+		}
+	}
+	if err := os.WriteFile(ParamsFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to save model parameters: %w", err)
+	}
+	return nil
+}
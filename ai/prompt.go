@@ -0,0 +1,166 @@
+package ai
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// PromptsDir holds user prompt templates (<name>.tmpl) and genre presets
+// (genres/<name>.txt); they take precedence over the built-in ones
+var PromptsDir = "prompts"
+
+//go:embed prompts
+var builtinPrompts embed.FS
+
+// promptNames are the system prompt templates: one per request kind, and a
+// compact session prompt for small local models
+var promptNames = []string{"commands", "chat", "session", "session-compact", "critique", "song"}
+
+// promptData is what prompt templates can use
+type promptData struct {
+	Length      int    // steps in the pattern
+	Bars        int    // bars in the pattern (rounded up)
+	StepsPerBar int    // steps in a bar, from the meter: 16 in 4/4 with 16ths
+	Meter       string // time signature and step note value, e.g. "6/8 in 16ths"
+	Instrument  string // device profile description ("" without one)
+	GenreName   string // genre preset name ("" without one)
+	Genre       string // genre preset text
+	Style       string // style preset description ("" without one)
+}
+
+var (
+	builtinTemplates = parseBuiltinPrompts()
+	promptTemplates  = builtinTemplates
+)
+
+// parseBuiltinPrompts parses the built-in templates, which must be valid
+func parseBuiltinPrompts() map[string]*template.Template {
+	templates := make(map[string]*template.Template, len(promptNames))
+	for _, name := range promptNames {
+		data, err := builtinPrompts.ReadFile("prompts/" + name + ".tmpl")
+		if err != nil {
+			panic(err)
+		}
+		templates[name] = template.Must(template.New(name).Parse(string(data)))
+	}
+	return templates
+}
+
+// LoadPrompts reads user prompt templates from PromptsDir, replacing the
+// built-in ones they are named after. A template that fails to parse or
+// run is reported and the built-in one kept.
+func LoadPrompts() error {
+	templates := make(map[string]*template.Template, len(promptNames))
+	var errs []error
+	for _, name := range promptNames {
+		templates[name] = builtinTemplates[name]
+		path := filepath.Join(PromptsDir, name+".tmpl")
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			var t *template.Template
+			if t, err = template.New(name).Parse(string(data)); err == nil {
+				// Try it out, so mistakes like {{.Lenght}} show up now
+				if err = t.Execute(new(strings.Builder), promptData{Length: 16, Bars: 1, StepsPerBar: 16, Meter: "4/4 in 16ths"}); err == nil {
+					templates[name] = t
+					continue
+				}
+			}
+		}
+		errs = append(errs, fmt.Errorf("prompt %s: %w", path, err))
+	}
+	promptTemplates = templates
+	return errors.Join(errs...)
+}
+
+// systemPrompt fills the named prompt template for the pattern
+func (c *Client) systemPrompt(name string, p *sequence.Pattern) string {
+	stepsPerBar := p.StepsPerBar()
+	data := promptData{
+		Length:      p.Length(),
+		Bars:        (p.Length() + stepsPerBar - 1) / stepsPerBar,
+		StepsPerBar: stepsPerBar,
+		Meter:       p.Meter(),
+		Instrument:  c.instrument,
+		GenreName:   c.genreName,
+		Genre:       c.genre,
+		Style:       c.style,
+	}
+	var sb strings.Builder
+	if err := promptTemplates[name].Execute(&sb, data); err != nil {
+		slog.Error("prompt template failed", "name", name, "error", err)
+		sb.Reset()
+		builtinTemplates[name].Execute(&sb, data)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// loadGenre reads a genre preset from PromptsDir, falling back to the
+// built-in ones
+func loadGenre(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid genre name: %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(PromptsDir, "genres", name+".txt"))
+	if err != nil {
+		data, err = builtinPrompts.ReadFile("prompts/genres/" + name + ".txt")
+	}
+	if err != nil {
+		return "", fmt.Errorf("unknown genre: %s (see 'genre' for the list)", name)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Genres lists the available genre presets, built-in and user-defined
+func Genres() []string {
+	seen := map[string]bool{}
+	add := func(entries []fs.DirEntry) {
+		for _, entry := range entries {
+			if name, ok := strings.CutSuffix(entry.Name(), ".txt"); ok && !entry.IsDir() {
+				seen[name] = true
+			}
+		}
+	}
+	builtin, _ := builtinPrompts.ReadDir("prompts/genres")
+	add(builtin)
+	user, _ := os.ReadDir(filepath.Join(PromptsDir, "genres"))
+	add(user)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetGenre adds a genre preset's style guidance to the prompts ("" removes it)
+func (c *Client) SetGenre(name string) error {
+	if name == "" {
+		c.genreName, c.genre = "", ""
+		return nil
+	}
+	text, err := loadGenre(name)
+	if err != nil {
+		return err
+	}
+	c.genreName, c.genre = name, text
+	return nil
+}
+
+// Genre returns the active genre preset ("" without one)
+func (c *Client) Genre() string {
+	return c.genreName
+}
@@ -0,0 +1,298 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Default models used when a vendor is picked by its API key alone
+const (
+	DefaultOpenAIModel = "gpt-4o"
+	DefaultGeminiModel = "gemini-2.0-flash"
+)
+
+// ollamaPrefix marks a local model, e.g. "ollama:llama3.1", served by
+// Ollama or any other OpenAI-compatible server at OLLAMA_HOST (such as
+// llama.cpp's llama-server)
+const ollamaPrefix = "ollama:"
+
+// DefaultLocalModel is the model used in offline mode unless a local one is picked
+const DefaultLocalModel = ollamaPrefix + "llama3.2"
+
+// IsLocal reports whether model runs on a local server rather than a vendor's API
+func IsLocal(model string) bool {
+	return strings.HasPrefix(model, ollamaPrefix)
+}
+
+// message is one turn of a conversation, kept independent of the provider
+// so the history survives switching models
+type message struct {
+	role        string          // "user" or "assistant"
+	text        string          // may be empty when the turn only carries tool calls or results
+	toolCalls   []ToolCall      // tools the assistant called
+	toolResults []toolResult    // results of the previous turn's tool calls (user turns)
+	thinking    []thinkingBlock // Claude's extended thinking, sent back while it uses tools
+}
+
+// thinkingBlock is a block of extended thinking, signed so Claude can
+// check it is returned unchanged
+type thinkingBlock struct {
+	text      string
+	signature string
+	redacted  string // encrypted thinking, in place of text and signature
+}
+
+// toolResult answers one tool call
+type toolResult struct {
+	id      string
+	content string
+	isError bool
+}
+
+// request is a provider-independent API request
+type request struct {
+	kind        string // request type for the log ("commands", "chat", "session")
+	model       string // model name as the provider knows it
+	system      string
+	messages    []message
+	maxTokens   int
+	tools       []tool   // pattern editing tools to offer
+	textOnly    bool     // tools are offered, but the model has to answer in text
+	temperature *float64 // nil for the provider's default
+	thinking    int      // extended thinking budget in tokens (0 for none)
+}
+
+// reply is a complete model response
+type reply struct {
+	text         string
+	toolCalls    []ToolCall
+	thinking     []thinkingBlock
+	inputTokens  int64
+	outputTokens int64
+	stopReason   string
+	usage        Usage // tokens and estimated cost, filled in by Client.send
+}
+
+// provider sends requests to one vendor's API. Text is passed to onText as
+// it streams in, and each tool call to onToolCall once its input is complete.
+// Local providers run small models that get compact prompts.
+type provider interface {
+	name() string
+	local() bool
+	send(ctx context.Context, req request, onText func(string), onToolCall func(ToolCall)) (*reply, error)
+	models(ctx context.Context) ([]string, error) // model IDs the API serves, as 'model' takes them
+}
+
+// providerFor returns the provider serving model, configured from the
+// environment, and the name to send it the model by:
+//
+//	claude-...      Anthropic (ANTHROPIC_API_KEY)
+//	gpt-..., o1...  OpenAI (OPENAI_API_KEY)
+//	gemini-...      Google (GEMINI_API_KEY or GOOGLE_API_KEY)
+//	ollama:<name>   local server (OLLAMA_HOST, default Ollama at localhost:11434)
+func providerFor(model string) (provider, string, error) {
+	switch vendorOf(model) {
+	case "claude":
+		p, err := newAnthropic(os.Getenv("ANTHROPIC_API_KEY"))
+		if err != nil {
+			return nil, "", err
+		}
+		return p, model, nil
+	case "openai":
+		key := os.Getenv("OPENAI_API_KEY")
+		if key == "" {
+			return nil, "", fmt.Errorf("OPENAI_API_KEY not set")
+		}
+		return newOpenAI("openai", openAIURL, key), model, nil
+	case "gemini":
+		key := geminiKey()
+		if key == "" {
+			return nil, "", fmt.Errorf("GEMINI_API_KEY not set")
+		}
+		return newOpenAI("gemini", geminiURL, key), model, nil
+	case "ollama":
+		name := strings.TrimPrefix(model, ollamaPrefix)
+		if name == "" {
+			return nil, "", fmt.Errorf("usage: ollama:<model>, e.g. ollama:llama3.1")
+		}
+		return newOpenAI("ollama", ollamaURL(), ""), name, nil
+	}
+	return nil, "", fmt.Errorf("unknown model %q (use claude-..., gpt-..., gemini-... or ollama:<model>)", model)
+}
+
+// vendorOf returns the vendor serving model, going by its prefix ("" if
+// none does), named like the providers
+func vendorOf(model string) string {
+	switch {
+	case strings.HasPrefix(model, "claude"):
+		return "claude"
+	case strings.HasPrefix(model, "gpt-"), strings.HasPrefix(model, "chatgpt"), isOpenAIReasoning(model):
+		return "openai"
+	case strings.HasPrefix(model, "gemini"):
+		return "gemini"
+	case IsLocal(model):
+		return "ollama"
+	}
+	return ""
+}
+
+// isOpenAIReasoning reports whether model is an OpenAI o-series model (o1, o3-mini, ...)
+func isOpenAIReasoning(model string) bool {
+	return len(model) > 1 && model[0] == 'o' && model[1] >= '0' && model[1] <= '9'
+}
+
+func geminiKey() string {
+	if key := os.Getenv("GEMINI_API_KEY"); key != "" {
+		return key
+	}
+	return os.Getenv("GOOGLE_API_KEY")
+}
+
+// envModel picks a default model for the first vendor with an API key set
+func envModel() (string, bool) {
+	switch {
+	case os.Getenv("ANTHROPIC_API_KEY") != "":
+		return string(DefaultModel), true
+	case os.Getenv("OPENAI_API_KEY") != "":
+		return DefaultOpenAIModel, true
+	case geminiKey() != "":
+		return DefaultGeminiModel, true
+	}
+	return "", false
+}
+
+// DefaultTimeout limits how long a request may take unless SetTimeout
+// picks another limit
+const DefaultTimeout = 60 * time.Second
+
+// maxRetries is how often a request failing with a rate limit (429) or
+// server error (5xx) is retried
+const maxRetries = 3
+
+// retryDelay is the wait before the first retry, doubled for each further one
+var retryDelay = time.Second
+
+// statusError is an HTTP error response from an API
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// retryable reports whether err is a rate limit or server error, which
+// may go away when the request is repeated
+func retryable(err error) bool {
+	code := 0
+	var se *statusError
+	var ae *anthropic.Error
+	switch {
+	case errors.As(err, &se):
+		code = se.code
+	case errors.As(err, &ae):
+		code = ae.StatusCode
+	}
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// send makes a request through the client's provider, retrying rate limit
+// and server errors with exponential backoff. A request that has already
+// streamed part of its reply is not retried, so nothing is shown twice.
+func (c *Client) send(ctx context.Context, req request, onText func(string), onToolCall func(ToolCall)) (*reply, error) {
+	req.model = c.apiModel
+	params, err := c.ModelParams()
+	if err != nil {
+		return nil, err
+	}
+	if params.MaxTokens > 0 {
+		req.maxTokens = params.MaxTokens
+	}
+	req.temperature, req.thinking = params.Temperature, params.Thinking
+	if onText == nil {
+		onText = func(string) {}
+	}
+	if onToolCall == nil {
+		onToolCall = func(ToolCall) {}
+	}
+
+	for attempt := 0; ; attempt++ {
+		// Waiting for the provider's limits doesn't count against the timeout
+		release, err := acquire(ctx, c.provider.name())
+		if err != nil {
+			return nil, err
+		}
+		r, streamed, err := c.sendOnce(ctx, req, onText, onToolCall)
+		release()
+		if err == nil || streamed || attempt == maxRetries || !retryable(err) {
+			return r, err
+		}
+		wait := retryDelay << attempt
+		slog.Warn("AI request retry", "kind", req.kind, "model", c.model, "wait", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// sendOnce makes one request within the client's timeout, logging its
+// latency, token usage and errors, and counting its usage. streamed reports
+// whether any of the reply was passed on before an error.
+func (c *Client) sendOnce(ctx context.Context, req request, onText func(string), onToolCall func(ToolCall)) (r *reply, streamed bool, err error) {
+	timeout := c.Timeout()
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var firstToken time.Duration
+	text := func(s string) {
+		if firstToken == 0 {
+			firstToken = time.Since(start)
+		}
+		streamed = true
+		onText(s)
+	}
+	toolCall := func(call ToolCall) {
+		streamed = true
+		onToolCall(call)
+	}
+
+	r, err = c.provider.send(attemptCtx, req, text, toolCall)
+	latency := time.Since(start)
+	if err != nil {
+		slog.Error("AI request failed", "kind", req.kind, "model", c.model, "latency", latency, "error", err)
+		switch {
+		case ctx.Err() != nil:
+			return nil, streamed, ctx.Err()
+		case attemptCtx.Err() == context.DeadlineExceeded:
+			return nil, streamed, fmt.Errorf("%s API error: no response within %s", c.provider.name(), timeout)
+		}
+		return nil, streamed, fmt.Errorf("%s API error: %w", c.provider.name(), err)
+	}
+	r.usage = requestUsage(c.model, r.inputTokens, r.outputTokens)
+	slog.Info("AI request",
+		"kind", req.kind,
+		"model", c.model,
+		"latency", latency,
+		"first_token", firstToken,
+		"input_tokens", r.inputTokens,
+		"output_tokens", r.outputTokens,
+		"cost", r.usage.Cost,
+		"stop_reason", r.stopReason,
+	)
+	if err := c.recordUsage(r.usage); err != nil {
+		slog.Warn("AI usage not saved", "error", err)
+	}
+	return r, false, nil
+}
@@ -0,0 +1,360 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// maxToolRounds limits how many times a session reply may call tools and
+// continue before the model must answer in text
+const maxToolRounds = 8
+
+// ToolCall is a pattern edit the model requested through tool use
+type ToolCall struct {
+	ID    string
+	Name  string
+	Input json.RawMessage
+}
+
+// toolInput holds the arguments of any tool; pointers tell an optional
+// zero value from a missing one
+type toolInput struct {
+	Step     int     `json:"step"`
+	Note     string  `json:"note"`
+	Velocity *int    `json:"velocity"`
+	Gate     *int    `json:"gate"`
+	Duration *int    `json:"duration"`
+	BPM      float64 `json:"bpm"`
+	Percent  int     `json:"percent"`
+	Type     string  `json:"type"`
+	Amount   int     `json:"amount"`
+	Steps    int     `json:"steps"`
+	CC       *int    `json:"cc"`
+	Value    *int    `json:"value"`
+	Pan      string  `json:"pan"`
+	Save     bool    `json:"save"`
+	Name     string  `json:"name"`
+	From     string  `json:"from"`
+	Order    string  `json:"order"`
+}
+
+// tool describes one tool for the API and how its input becomes command
+// arguments
+type tool struct {
+	name        string
+	description string
+	properties  map[string]any
+	required    []string
+	command     func(in toolInput) []string
+}
+
+func integer(description string, min, max int) map[string]any {
+	return map[string]any{"type": "integer", "description": description, "minimum": min, "maximum": max}
+}
+
+// number is integer for arguments that may be fractional.
+func number(description string, min, max float64) map[string]any {
+	return map[string]any{"type": "number", "description": description, "minimum": min, "maximum": max}
+}
+
+func str(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func itoa(n int) string {
+	return strconv.Itoa(n)
+}
+
+// tools are the pattern edits offered to the model in sessions. Each runs
+// the matching Interplay command with arguments built from typed input, so
+// the command handlers validate them exactly as if the user had typed them.
+var tools = []tool{
+	{
+		name:        "set_step",
+		description: "Set a step to play a note. Velocity, gate and duration are optional.",
+		properties: map[string]any{
+			"step":     integer("Step number, 1 to the pattern length", 1, 512),
+			"note":     str("Note name with octave, e.g. C3, D#4, Bb2"),
+			"velocity": integer("Velocity, higher is louder", 1, 127),
+			"gate":     integer("Percentage of the duration the note sounds", 1, 100),
+			"duration": integer("Steps the note spans (4 = quarter note)", 1, 512),
+		},
+		required: []string{"step", "note"},
+		command: func(in toolInput) []string {
+			parts := []string{"set", itoa(in.Step), in.Note}
+			if in.Velocity != nil {
+				parts = append(parts, "vel:"+itoa(*in.Velocity))
+			}
+			if in.Gate != nil {
+				parts = append(parts, "gate:"+itoa(*in.Gate))
+			}
+			if in.Duration != nil {
+				parts = append(parts, "dur:"+itoa(*in.Duration))
+			}
+			return parts
+		},
+	},
+	{
+		name:        "rest_step",
+		description: "Silence a step.",
+		properties:  map[string]any{"step": integer("Step number", 1, 512)},
+		required:    []string{"step"},
+		command:     func(in toolInput) []string { return []string{"rest", itoa(in.Step)} },
+	},
+	{
+		name:        "set_velocity",
+		description: "Change the velocity of a step.",
+		properties: map[string]any{
+			"step":     integer("Step number", 1, 512),
+			"velocity": integer("Velocity, higher is louder", 0, 127),
+		},
+		required: []string{"step", "velocity"},
+		command: func(in toolInput) []string {
+			return []string{"velocity", itoa(in.Step), itoa(*in.Velocity)}
+		},
+	},
+	{
+		name:        "set_gate",
+		description: "Change the gate (percentage of its duration a note sounds) of a step.",
+		properties: map[string]any{
+			"step": integer("Step number", 1, 512),
+			"gate": integer("Gate percentage", 1, 100),
+		},
+		required: []string{"step", "gate"},
+		command: func(in toolInput) []string {
+			return []string{"gate", itoa(in.Step), itoa(*in.Gate)}
+		},
+	},
+	{
+		name:        "set_tempo",
+		description: "Change the tempo.",
+		properties:  map[string]any{"bpm": number("Beats per minute, fractions allowed (e.g. 122.5)", 20, 300)},
+		required:    []string{"bpm"},
+		command:     func(in toolInput) []string { return []string{"tempo", sequence.FormatBPM(in.BPM)} },
+	},
+	{
+		name:        "set_swing",
+		description: "Set swing: 0 is straight, 50 triplet swing, 66 hard swing.",
+		properties:  map[string]any{"percent": integer("Swing percentage", 0, 75)},
+		required:    []string{"percent"},
+		command:     func(in toolInput) []string { return []string{"swing", itoa(in.Percent)} },
+	},
+	{
+		name:        "set_humanize",
+		description: "Set random variation: velocity 0-64, timing 0-50 ms, gate 0-50.",
+		properties: map[string]any{
+			"type":   map[string]any{"type": "string", "enum": []string{"velocity", "timing", "gate"}},
+			"amount": integer("Amount of variation, 0 turns it off", 0, 64),
+		},
+		required: []string{"type", "amount"},
+		command:  func(in toolInput) []string { return []string{"humanize", in.Type, itoa(in.Amount)} },
+	},
+	{
+		name:        "set_length",
+		description: "Change the number of steps in the pattern (16 steps = one 4/4 bar).",
+		properties:  map[string]any{"steps": integer("Pattern length in steps", 1, 512)},
+		required:    []string{"steps"},
+		command:     func(in toolInput) []string { return []string{"length", itoa(in.Steps)} },
+	},
+	{
+		name:        "clear_pattern",
+		description: "Set all steps to rests.",
+		properties:  map[string]any{},
+		command:     func(in toolInput) []string { return []string{"clear"} },
+	},
+	{
+		name:        "set_cc",
+		description: "Set a global CC value sent at the start of each loop (e.g. CC 74 filter cutoff). Set save to keep it with the saved pattern.",
+		properties: map[string]any{
+			"cc":    integer("CC number", 0, 127),
+			"value": integer("CC value", 0, 127),
+			"save":  map[string]any{"type": "boolean", "description": "Save with the pattern"},
+		},
+		required: []string{"cc", "value"},
+		command: func(in toolInput) []string {
+			parts := []string{"cc", itoa(*in.CC), itoa(*in.Value)}
+			if in.Save {
+				parts = append(parts, "--save")
+			}
+			return parts
+		},
+	},
+	{
+		name:        "set_step_cc",
+		description: "Automate a CC value on one step.",
+		properties: map[string]any{
+			"step":  integer("Step number", 1, 512),
+			"cc":    integer("CC number", 0, 127),
+			"value": integer("CC value", 0, 127),
+		},
+		required: []string{"step", "cc", "value"},
+		command: func(in toolInput) []string {
+			return []string{"cc-step", itoa(in.Step), itoa(*in.CC), itoa(*in.Value)}
+		},
+	},
+	{
+		name:        "clear_step_cc",
+		description: "Remove CC automation from a step: one CC, or all of them if cc is omitted.",
+		properties: map[string]any{
+			"step": integer("Step number", 1, 512),
+			"cc":   integer("CC number", 0, 127),
+		},
+		required: []string{"step"},
+		command: func(in toolInput) []string {
+			parts := []string{"cc-clear", itoa(in.Step)}
+			if in.CC != nil {
+				parts = append(parts, itoa(*in.CC))
+			}
+			return parts
+		},
+	},
+	{
+		name:        "set_volume",
+		description: "Set the pattern volume (CC 7, saved with the pattern).",
+		properties:  map[string]any{"value": integer("Volume", 0, 127)},
+		required:    []string{"value"},
+		command:     func(in toolInput) []string { return []string{"volume", itoa(*in.Value)} },
+	},
+	{
+		name:        "set_pan",
+		description: "Pan one step (CC 10).",
+		properties: map[string]any{
+			"step": integer("Step number", 1, 512),
+			"pan":  str("0-127, C for center, L1-L64 left or R1-R63 right"),
+		},
+		required: []string{"step", "pan"},
+		command:  func(in toolInput) []string { return []string{"pan", itoa(in.Step), in.Pan} },
+	},
+	{
+		name:        "set_expression",
+		description: "Set expression (CC 11) on one step, for swells and dynamics.",
+		properties: map[string]any{
+			"step":  integer("Step number", 1, 512),
+			"value": integer("Expression", 0, 127),
+		},
+		required: []string{"step", "value"},
+		command: func(in toolInput) []string {
+			return []string{"expression", itoa(in.Step), itoa(*in.Value)}
+		},
+	},
+}
+
+// songTools build a song out of several patterns, see Client.Song. Their
+// commands are handled by the caller rather than typed commands: new_pattern
+// switches which pattern the other tools edit.
+var songTools = []tool{
+	{
+		name:        "new_pattern",
+		description: "Start a new pattern of the song; the other tools edit it until the next new_pattern. It starts empty with the current length and tempo, or as a copy of an earlier pattern.",
+		properties: map[string]any{
+			"name": str("Short name for the section, e.g. intro, verse, drop (letters, digits, - and _)"),
+			"from": str("Optional: an earlier pattern of this song to start from"),
+		},
+		required: []string{"name"},
+		command: func(in toolInput) []string {
+			parts := []string{"song-pattern", in.Name}
+			if in.From != "" {
+				parts = append(parts, in.From)
+			}
+			return parts
+		},
+	},
+	{
+		name:        "arrange",
+		description: "Set the song's order once all patterns are made: pattern names with loop counts.",
+		properties: map[string]any{
+			"name":  str("Song name (letters, digits, - and _)"),
+			"order": str("Patterns in playing order with loops, e.g. \"intro*2 verse*4 drop*4 outro*2\""),
+		},
+		required: []string{"name", "order"},
+		command: func(in toolInput) []string {
+			return append([]string{"song-arrange", in.Name}, strings.Fields(in.Order)...)
+		},
+	},
+}
+
+// coreTools are the tools offered to small local models, which pick the
+// right one more reliably from a short list
+var coreTools = map[string]bool{
+	"set_step":      true,
+	"rest_step":     true,
+	"set_velocity":  true,
+	"set_tempo":     true,
+	"set_swing":     true,
+	"set_length":    true,
+	"clear_pattern": true,
+}
+
+// toolsFor returns the tools to offer: all of them, or only coreTools if compact
+func toolsFor(compact bool) []tool {
+	if !compact {
+		return tools
+	}
+	var offered []tool
+	for _, t := range tools {
+		if coreTools[t.name] {
+			offered = append(offered, t)
+		}
+	}
+	return offered
+}
+
+// ToolCommands returns the names of the commands the pattern tools run:
+// the edits the model may make, and nothing that saves, deletes or
+// changes settings
+func ToolCommands() []string {
+	zero := 0
+	sample := toolInput{Velocity: &zero, Gate: &zero, Duration: &zero, CC: &zero, Value: &zero}
+	names := make([]string, len(tools))
+	for i, t := range tools {
+		names[i] = t.command(sample)[0]
+	}
+	return names
+}
+
+// toolParams describes the tools for the API
+func toolParams(offered []tool) []anthropic.ToolUnionParam {
+	params := make([]anthropic.ToolUnionParam, len(offered))
+	for i, t := range offered {
+		params[i] = anthropic.ToolUnionParam{OfTool: &anthropic.ToolParam{
+			Name:        t.name,
+			Description: anthropic.String(t.description),
+			InputSchema: anthropic.ToolInputSchemaParam{
+				Properties: t.properties,
+				Required:   t.required,
+			},
+		}}
+	}
+	return params
+}
+
+// Command returns the Interplay command the tool call runs, as arguments
+// (command name first). Arguments are never re-parsed from text, so a bad
+// value can't turn into a different command.
+func (call ToolCall) Command() ([]string, error) {
+	for _, t := range append(tools[:len(tools):len(tools)], songTools...) {
+		if t.name != call.Name {
+			continue
+		}
+		var in toolInput
+		var present map[string]json.RawMessage
+		if len(call.Input) > 0 {
+			if err := json.Unmarshal(call.Input, &in); err != nil {
+				return nil, fmt.Errorf("invalid input for %s: %w", call.Name, err)
+			}
+			json.Unmarshal(call.Input, &present)
+		}
+		for _, name := range t.required {
+			if _, ok := present[name]; !ok {
+				return nil, fmt.Errorf("%s needs %q", call.Name, name)
+			}
+		}
+		return t.command(in), nil
+	}
+	return nil, fmt.Errorf("unknown tool: %s", call.Name)
+}
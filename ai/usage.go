@@ -0,0 +1,174 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// UsageFile accumulates token usage and estimated cost across sessions
+var UsageFile = "ai-usage.json"
+
+// usageMu serializes updates of UsageFile by requests running at once
+var usageMu sync.Mutex
+
+// Usage counts AI requests, their tokens and estimated cost
+type Usage struct {
+	Requests     int     `json:"requests"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	Cost         float64 `json:"cost"`               // estimated, in US dollars
+	Unpriced     int     `json:"unpriced,omitempty"` // requests to models without a known price
+}
+
+// Add counts other in u
+func (u *Usage) Add(other Usage) {
+	u.Requests += other.Requests
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.Cost += other.Cost
+	u.Unpriced += other.Unpriced
+}
+
+// String formats the usage, e.g. "1520 in / 230 out tokens, ~$0.0021"
+func (u Usage) String() string {
+	cost := fmt.Sprintf("~$%.4f", u.Cost)
+	if u.Unpriced > 0 {
+		cost += " (some requests unpriced)"
+	}
+	return fmt.Sprintf("%d in / %d out tokens, %s", u.InputTokens, u.OutputTokens, cost)
+}
+
+// price is a model's list price in US dollars per million tokens
+type price struct {
+	input, output float64
+}
+
+// prices are published list prices by model name prefix; the longest
+// matching prefix wins. Costs are estimates: they ignore caching, batch
+// discounts and later price changes.
+var prices = map[string]price{
+	"claude-3-haiku":    {0.25, 1.25},
+	"claude-3-5-haiku":  {0.80, 4},
+	"claude-haiku-4":    {1, 5},
+	"claude-3-5-sonnet": {3, 15},
+	"claude-3-7-sonnet": {3, 15},
+	"claude-sonnet-4":   {3, 15},
+	"claude-opus-4":     {15, 75},
+	"gpt-4o":            {2.50, 10},
+	"gpt-4o-mini":       {0.15, 0.60},
+	"gpt-4.1":           {2, 8},
+	"gpt-4.1-mini":      {0.40, 1.60},
+	"gpt-4.1-nano":      {0.10, 0.40},
+	"o3-mini":           {1.10, 4.40},
+	"o4-mini":           {1.10, 4.40},
+	"gemini-1.5-flash":  {0.075, 0.30},
+	"gemini-1.5-pro":    {1.25, 5},
+	"gemini-2.0-flash":  {0.10, 0.40},
+	"gemini-2.5-flash":  {0.30, 2.50},
+	"gemini-2.5-pro":    {1.25, 10},
+}
+
+// priceOf returns the price of model; local models are free
+func priceOf(model string) (price, bool) {
+	if IsLocal(model) {
+		return price{}, true
+	}
+	best, found := "", false
+	for prefix := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, found = prefix, true
+		}
+	}
+	return prices[best], found
+}
+
+// requestUsage is the usage of one request to model
+func requestUsage(model string, inputTokens, outputTokens int64) Usage {
+	u := Usage{Requests: 1, InputTokens: inputTokens, OutputTokens: outputTokens}
+	if p, ok := priceOf(model); ok {
+		u.Cost = (float64(inputTokens)*p.input + float64(outputTokens)*p.output) / 1e6
+	} else {
+		u.Unpriced = 1
+	}
+	return u
+}
+
+// recordUsage counts a request in the session and in UsageFile
+func (c *Client) recordUsage(u Usage) error {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	if c.usage == nil {
+		c.usage = map[string]*Usage{}
+	}
+	if c.usage[c.model] == nil {
+		c.usage[c.model] = &Usage{}
+	}
+	c.usage[c.model].Add(u)
+
+	total, err := LoadUsage()
+	if err != nil {
+		return err
+	}
+	sum := total[c.model]
+	sum.Add(u)
+	total[c.model] = sum
+	return saveUsage(total)
+}
+
+// SessionUsage returns the usage per model since the client was created
+func (c *Client) SessionUsage() map[string]Usage {
+	usage := make(map[string]Usage, len(c.usage))
+	for model, u := range c.usage {
+		usage[model] = *u
+	}
+	return usage
+}
+
+// LoadUsage reads the usage per model accumulated in UsageFile
+func LoadUsage() (map[string]Usage, error) {
+	usage := map[string]Usage{}
+	data, err := os.ReadFile(UsageFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return usage, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AI usage: %w", err)
+	}
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", UsageFile, err)
+	}
+	return usage, nil
+}
+
+func saveUsage(usage map[string]Usage) error {
+	data, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(UsageFile); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to save AI usage: %w", err)
+		}
+	}
+	if err := os.WriteFile(UsageFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to save AI usage: %w", err)
+	}
+	return nil
+}
+
+// UsageModels returns the models in usage, sorted
+func UsageModels(usage map[string]Usage) []string {
+	models := make([]string, 0, len(usage))
+	for model := range usage {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
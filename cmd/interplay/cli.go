@@ -0,0 +1,299 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/iltempo/interplay/ai"
+	"github.com/iltempo/interplay/commands"
+	"github.com/iltempo/interplay/config"
+	"github.com/iltempo/interplay/mcp"
+	"github.com/iltempo/interplay/midi"
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// subcommand is a non-interactive operation run as 'interplay <name> ...'
+type subcommand struct {
+	usage string
+	run   func(args []string, cfg config.Config, stdout io.Writer) error
+}
+
+// subcommands run without entering the REPL, for shell scripts and Makefiles
+var subcommands = map[string]subcommand{
+	"export": {"export --pattern <name> [--out <file.mid>] [--loops <n>]", runExport},
+	"list":   {"list", runList},
+	"mcp":    {"mcp [--port <name|index>] [--load <name>]", runMCP},
+	"play":   {"play <name> [--loops <n>] [--port <name|index>] [--realtime]", runPlay},
+}
+
+// printUsage describes flags and subcommands for -h
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: interplay [flags]")
+	fmt.Fprintln(out, "       interplay <command> [args]")
+	fmt.Fprintln(out, "\nCommands:")
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s\n", subcommands[name].usage)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// runSubcommand runs args[0] as a subcommand if it is one.
+// Returns false if args don't start with a subcommand name.
+func runSubcommand(args []string) (handled bool, exitCode int) {
+	if len(args) == 0 {
+		return false, 0
+	}
+	sub, ok := subcommands[args[0]]
+	if !ok {
+		return false, 0
+	}
+
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return true, 1
+	}
+	useDataDir(cfg.DataDir)
+	if err := ai.LoadPrompts(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	if err := sub.run(args[1:], cfg, os.Stdout); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Usage: interplay %s\n", sub.usage)
+		}
+		return true, 1
+	}
+	return true, 0
+}
+
+// parseInterspersed parses flags that may appear before or after positional
+// arguments (e.g., 'play foo --loops 4') and returns the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// runExport: export --pattern <name> [--out <file.mid>] [--loops <n>]
+func runExport(args []string, cfg config.Config, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	name := fs.String("pattern", "", "saved pattern to export")
+	out := fs.String("out", "", "output MIDI file (default <pattern>.mid)")
+	loops := fs.Int("loops", 1, "number of times to repeat the pattern")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// Allow 'export foo' as well as 'export --pattern foo'
+	if *name == "" && len(positional) == 1 {
+		*name = positional[0]
+		positional = nil
+	}
+	if *name == "" || len(positional) > 0 {
+		return fmt.Errorf("export needs exactly one pattern name")
+	}
+	if *out == "" {
+		*out = *name + ".mid"
+	}
+
+	pattern, err := sequence.Load(*name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create MIDI file: %w", err)
+	}
+	if err := pattern.WriteMIDIFile(f, *loops); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write MIDI file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write MIDI file: %w", err)
+	}
+
+	fmt.Fprintf(stdout, "Exported '%s' to %s (%d loop(s))\n", *name, *out, *loops)
+	return nil
+}
+
+// runList: list
+// Prints one saved pattern name per line, for use in shell scripts
+func runList(args []string, cfg config.Config, stdout io.Writer) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("list takes no arguments")
+	}
+
+	names, err := sequence.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Fprintln(stdout, name)
+	}
+	return nil
+}
+
+// runPlay: play <name> [--loops <n>] [--port <name|index>] [--realtime]
+// Plays a saved pattern for a number of loops, then exits
+func runPlay(args []string, cfg config.Config, stdout io.Writer) error {
+	fs := flag.NewFlagSet("play", flag.ContinueOnError)
+	loops := fs.Int("loops", 1, "number of loops to play")
+	portQuery := fs.String("port", cfg.Port, "MIDI port index or name substring (default port 0)")
+	realtime := fs.Bool("realtime", false, "raise the playback thread's priority and make GC rarer")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("play needs exactly one pattern name")
+	}
+	if *loops < 1 {
+		return fmt.Errorf("loops must be at least 1, got %d", *loops)
+	}
+
+	pattern, err := sequence.Load(positional[0])
+	if err != nil {
+		return err
+	}
+
+	midiOut, err := openPort(*portQuery)
+	if err != nil {
+		return err
+	}
+	defer midiOut.Close()
+
+	engine := playback.New(midiOut, pattern)
+	if err := engine.SetChannel(cfg.Channel); err != nil {
+		return err
+	}
+	if *realtime {
+		useRealtime(engine, stdout)
+	}
+	events := engine.Subscribe(0)
+	defer engine.Unsubscribe(events)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	fmt.Fprintf(stdout, "Playing '%s' for %d loop(s)...\n", positional[0], *loops)
+	engine.Start()
+	defer engine.Stop()
+
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type == playback.EventLoop && ev.Loop >= *loops {
+				return nil
+			}
+			if ev.Type == playback.EventSendFailed {
+				return fmt.Errorf("MIDI device lost: %w", ev.Err)
+			}
+		case <-sigChan:
+			fmt.Fprintln(stdout, "Stopped.")
+			return nil
+		}
+	}
+}
+
+// openPort opens the MIDI port matching query (see matchPorts), or port 0
+// if query is empty. Ambiguous matches are errors since there is no prompt.
+func openPort(query string) (*midi.Output, error) {
+	portIndex := 0
+	if query != "" {
+		ports, err := midi.ListPorts()
+		if err != nil {
+			return nil, fmt.Errorf("error listing MIDI ports: %w", err)
+		}
+		matches := matchPorts(ports, query)
+		switch {
+		case len(matches) == 0:
+			return nil, fmt.Errorf("no MIDI port matches %q", query)
+		case len(matches) > 1:
+			return nil, fmt.Errorf("MIDI port %q is ambiguous, matches: %s", query, describePorts(ports, matches))
+		}
+		portIndex = matches[0]
+	}
+
+	midiOut, err := midi.Open(portIndex)
+	if err != nil {
+		return nil, fmt.Errorf("error opening MIDI port: %w", err)
+	}
+	return midiOut, nil
+}
+
+// runMCP: mcp [--port <name|index>] [--load <name>]
+// Plays a pattern and serves the Model Context Protocol on stdin/stdout,
+// for MCP clients that launch Interplay as a subprocess
+func runMCP(args []string, cfg config.Config, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mcp", flag.ContinueOnError)
+	portQuery := fs.String("port", cfg.Port, "MIDI port index or name substring (default port 0)")
+	load := fs.String("load", "", "start with a saved pattern")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("mcp takes no arguments")
+	}
+
+	// stdout carries the protocol; command output goes to stderr,
+	// which MCP clients show in their logs
+	os.Stdout = os.Stderr
+
+	midiOut, err := openPort(*portQuery)
+	if err != nil {
+		return err
+	}
+	defer midiOut.Close()
+
+	pattern, err := startupPattern(cfg, *load, func(string) bool { return false })
+	if err != nil {
+		return err
+	}
+	engine := playback.New(midiOut, pattern)
+	if err := engine.SetChannel(cfg.Channel); err != nil {
+		return err
+	}
+	engine.Start()
+	defer engine.Stop()
+
+	cmdHandler := commands.New(engine.GetNextPattern(), engine)
+	configureHandler(cmdHandler, cfg, engine, midiOut, os.Stderr)
+	if *load != "" {
+		cmdHandler.MarkSaved(*load)
+	}
+
+	fmt.Fprintln(os.Stderr, "Interplay MCP server ready on stdio")
+	return mcp.New(cmdHandler, engine.GetNextPattern()).Serve(os.Stdin, stdout)
+}
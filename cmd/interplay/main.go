@@ -0,0 +1,752 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/iltempo/interplay/ai"
+	"github.com/iltempo/interplay/commands"
+	"github.com/iltempo/interplay/comparison"
+	"github.com/iltempo/interplay/config"
+	"github.com/iltempo/interplay/device"
+	"github.com/iltempo/interplay/httpapi"
+	"github.com/iltempo/interplay/midi"
+	"github.com/iltempo/interplay/osc"
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/remote"
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/style"
+	"github.com/iltempo/interplay/theme"
+	"github.com/iltempo/interplay/tui"
+	"github.com/mattn/go-isatty"
+)
+
+// isTerminal returns true if stdin is a terminal (TTY)
+func isTerminal() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
+// colorsEnabled decides whether to use ANSI colors: off with --no-color,
+// when NO_COLOR is set (https://no-color.org), or when stdout is not a terminal
+func colorsEnabled(noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
+}
+
+// processBatchInput reads and executes commands from reader
+// Returns (success, shouldExit) where success indicates no errors occurred
+// and shouldExit indicates if an explicit exit command was found
+func processBatchInput(reader io.Reader, handler *commands.Handler) (bool, bool) {
+	scanner := bufio.NewScanner(reader)
+	hadErrors := false
+	shouldExit := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		line = strings.TrimSpace(line)
+
+		// Skip empty lines
+		if line == "" {
+			continue
+		}
+
+		// Print comments (for user visibility)
+		if strings.HasPrefix(line, "#") {
+			fmt.Println(line)
+			continue
+		}
+
+		// Check for explicit exit command
+		if strings.ToLower(line) == "exit" || strings.ToLower(line) == "quit" {
+			shouldExit = true
+			continue
+		}
+
+		// Echo command for progress feedback
+		fmt.Println(">", line)
+
+		// Show waiting indicator for AI commands (they can take several seconds)
+		if strings.HasPrefix(strings.ToLower(line), "ai ") {
+			fmt.Println("⏳ Waiting for AI response...")
+		}
+
+		// Process command
+		if err := handler.Execute(line); err != nil {
+			fmt.Fprintln(os.Stderr, theme.Error(fmt.Sprintf("Error: %v", err)))
+			hadErrors = true
+		}
+	}
+
+	// Check for scanner errors
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		return false, shouldExit
+	}
+
+	return !hadErrors, shouldExit
+}
+
+// matchPorts finds the ports selected by query: a port index, an exact
+// name, or a case-insensitive substring of one or more names
+func matchPorts(ports []string, query string) []int {
+	if query == "" {
+		return nil
+	}
+	if index, err := strconv.Atoi(query); err == nil {
+		if index >= 0 && index < len(ports) {
+			return []int{index}
+		}
+		return nil
+	}
+
+	var matches []int
+	for i, port := range ports {
+		if strings.EqualFold(port, query) {
+			return []int{i}
+		}
+		if strings.Contains(strings.ToLower(port), strings.ToLower(query)) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// describePorts lists ports as "0: name, 2: name"
+func describePorts(ports []string, indexes []int) string {
+	descriptions := make([]string, len(indexes))
+	for i, index := range indexes {
+		descriptions[i] = fmt.Sprintf("%d: %s", index, ports[index])
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// configFlags maps command-line flags to config keys; flags given on the
+// command line override the config file and environment
+var configFlags = map[string]string{
+	"port":       "port",
+	"channel":    "channel",
+	"model":      "ai_model",
+	"data-dir":   "data_dir",
+	"device":     "device",
+	"verbose":    "verbose",
+	"offline":    "offline",
+	"ai-timeout": "ai_timeout",
+	"tempo":      "tempo",
+	"length":     "length",
+}
+
+// loadConfig reads the config file and environment, then applies any
+// config flags set on the command line
+func loadConfig(path string) (config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	var flagErr error
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := configFlags[f.Name]; ok && flagErr == nil {
+			if err := cfg.Set(key, f.Value.String()); err != nil {
+				flagErr = fmt.Errorf("--%s: %w", f.Name, err)
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, flagErr
+	}
+	return cfg, cfg.Validate()
+}
+
+// aiParams returns the AI generation parameters set in cfg
+func aiParams(cfg config.Config) ai.Params {
+	p := ai.Params{MaxTokens: cfg.AIMaxTokens, Thinking: cfg.AIThinking}
+	if cfg.AITemperature >= 0 {
+		p.Temperature = &cfg.AITemperature
+	}
+	return p
+}
+
+// aiLimits returns the per-provider AI limits set in cfg
+func aiLimits(cfg config.Config) map[string]ai.Limit {
+	limits := map[string]ai.Limit{}
+	rpm, _ := config.ParseLimits("ai_rpm", cfg.AIRPM)
+	for name, n := range rpm {
+		limit := limits[name]
+		limit.RPM = n
+		limits[name] = limit
+	}
+	concurrency, _ := config.ParseLimits("ai_concurrency", cfg.AIConcurrency)
+	for name, n := range concurrency {
+		limit := limits[name]
+		limit.Concurrent = n
+		limits[name] = limit
+	}
+	return limits
+}
+
+// useDataDir stores patterns, songs, sessions, macros, stamps, scenes, CC names, plugins, device
+// profiles, AI prompts, usage, model parameters and cached responses
+// under dir ("" keeps the current directory)
+func useDataDir(dir string) {
+	if dir != "" {
+		sequence.PatternsDir = filepath.Join(dir, "patterns")
+		commands.MacrosFile = filepath.Join(dir, "macros.json")
+		commands.StampsFile = filepath.Join(dir, "stamps.json")
+		commands.ScenesFile = filepath.Join(dir, "scenes.json")
+		commands.CCNamesFile = filepath.Join(dir, "cc-names.json")
+		commands.PluginsDir = filepath.Join(dir, "plugins")
+		device.Dir = filepath.Join(dir, "devices")
+		ai.PromptsDir = filepath.Join(dir, "prompts")
+		ai.UsageFile = filepath.Join(dir, "ai-usage.json")
+		ai.ChatsDir = filepath.Join(dir, "chats")
+		ai.ParamsFile = filepath.Join(dir, "model-params.json")
+		ai.CacheDir = filepath.Join(dir, "ai-cache")
+		style.Dir = filepath.Join(dir, "styles")
+		sequence.SongsDir = filepath.Join(dir, "songs")
+		commands.SessionsDir = filepath.Join(dir, "sessions")
+		comparison.Dir = filepath.Join(dir, "comparisons")
+	}
+}
+
+// setupLogging writes structured logs (JSON lines) to path at the given
+// level. Returns a function closing the log file.
+func setupLogging(path, level string) (func(), error) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q (use debug, info, warn or error)", level)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(f, &slog.HandlerOptions{Level: logLevel})))
+	return func() { f.Close() }, nil
+}
+
+// isFlagSet reports whether the named flag was given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// startupPattern builds the pattern playback starts with: the saved pattern
+// named by load, or an empty one (all rests) with the configured length and
+// tempo. Tempo and length given as flags also override a loaded pattern.
+func startupPattern(cfg config.Config, load string, flagSet func(name string) bool) (*sequence.Pattern, error) {
+	if load == "" {
+		p := sequence.New(cfg.Length)
+		if err := p.SetTempo(cfg.Tempo); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	p, err := sequence.Load(load)
+	if err != nil {
+		return nil, err
+	}
+	if flagSet("tempo") {
+		if err := p.SetTempo(cfg.Tempo); err != nil {
+			return nil, err
+		}
+	}
+	if flagSet("length") {
+		if err := p.Resize(cfg.Length); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// GC settings --realtime applies unless GOGC or GOMEMLIMIT are set: the
+// heap may grow to five times the live data between collections, so they
+// run rarely, and the soft memory limit keeps that growth bounded
+const (
+	realtimeGCPercent   = 400
+	realtimeMemoryLimit = 512 << 20 // bytes
+)
+
+// tuneGC applies the --realtime GC settings and returns them as
+// environment assignments, e.g. "GOGC=400"; getenv is os.Getenv
+func tuneGC(getenv func(string) string) []string {
+	var applied []string
+	if getenv("GOGC") == "" {
+		debug.SetGCPercent(realtimeGCPercent)
+		applied = append(applied, fmt.Sprintf("GOGC=%d", realtimeGCPercent))
+	}
+	if getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(realtimeMemoryLimit)
+		applied = append(applied, fmt.Sprintf("GOMEMLIMIT=%dMiB", realtimeMemoryLimit>>20))
+	}
+	return applied
+}
+
+// useRealtime applies the --realtime GC settings and asks engine to raise
+// its playback thread's priority
+func useRealtime(engine *playback.Engine, stdout io.Writer) {
+	applied := tuneGC(os.Getenv)
+	engine.SetRealtime(true)
+	slog.Info("realtime", "gc", applied)
+	if len(applied) > 0 {
+		fmt.Fprintf(stdout, "Realtime mode: %s\n", strings.Join(applied, ", "))
+	} else {
+		fmt.Fprintln(stdout, "Realtime mode (GC settings from GOGC/GOMEMLIMIT)")
+	}
+}
+
+// reportMIDIErrors prints when the MIDI device stops taking messages, e.g.
+// when it is unplugged, and when it is back
+func reportMIDIErrors(events <-chan playback.Event, w io.Writer) {
+	for ev := range events {
+		switch ev.Type {
+		case playback.EventSendFailed:
+			fmt.Fprintln(w, theme.Warning(fmt.Sprintf("MIDI device lost: %v", ev.Err)))
+		case playback.EventSendRecovered:
+			fmt.Fprintln(w, "MIDI device is back")
+		}
+	}
+}
+
+// midiPorts lists the system's MIDI ports for the 'ports' command
+type midiPorts struct {
+	out *midi.Output // the output playback sends to
+}
+
+// ListPorts returns the names of the input and output ports
+func (p midiPorts) ListPorts() (in, out []string, err error) {
+	if in, err = midi.ListInPorts(); err != nil {
+		return nil, nil, err
+	}
+	if out, err = midi.ListPorts(); err != nil {
+		return nil, nil, err
+	}
+	return in, out, nil
+}
+
+// OutputPort returns the index of the output port playback uses, and
+// whether it is open
+func (p midiPorts) OutputPort() (int, bool) {
+	return p.out.Port(), p.out.IsOpen()
+}
+
+// configureHandler connects h to the engine and MIDI output and applies
+// the config's AI, note name and device settings. Settings that can't be
+// applied are reported to stderr; the session starts without them.
+func configureHandler(h *commands.Handler, cfg config.Config, engine *playback.Engine, midiOut *midi.Output, stderr io.Writer) {
+	warn := func(err error) {
+		fmt.Fprintln(stderr, theme.Warning(fmt.Sprintf("Warning: %v", err)))
+	}
+
+	h.SetClock(engine)
+	h.SetTransport(engine)
+	h.SetVelocityCurver(engine)
+	h.SetLauncher(engine)
+	h.SetMuter(engine)
+	h.SetLooper(engine)
+	h.SetMIDIMonitor(engine)
+	h.SetPortLister(midiPorts{midiOut})
+	h.SetAITimeout(time.Duration(cfg.AITimeout) * time.Second)
+	ai.CustomModels = cfg.CustomModels()
+	h.SetAIParams(aiParams(cfg))
+	if err := h.SetAIAllowed(cfg.AIAllowed()); err != nil {
+		warn(err)
+	}
+	if cfg.OctaveConvention != "" {
+		if err := sequence.SetOctaveConvention(cfg.OctaveConvention); err != nil {
+			warn(err)
+		}
+	}
+	if err := ai.SetLimits(aiLimits(cfg)); err != nil {
+		warn(err)
+	}
+	if cfg.Offline {
+		if err := h.SetAIOffline(cfg.AIModel); err != nil {
+			warn(err)
+		}
+	} else if cfg.AIModel != "" {
+		if err := h.SetAIModel(cfg.AIModel); err != nil {
+			warn(err)
+		}
+	}
+	if cfg.Device != "" {
+		if err := h.UseDevice(cfg.Device); err != nil {
+			warn(err)
+		}
+	}
+}
+
+func main() {
+	// Logs are discarded unless --log-file is given
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+
+	// Non-interactive subcommands (export, list, play, mcp) skip the REPL entirely
+	if handled, exitCode := runSubcommand(os.Args[1:]); handled {
+		os.Exit(exitCode)
+	}
+
+	// Parse command-line flags
+	scriptFile := flag.String("script", "", "execute commands from file")
+	tuiMode := flag.Bool("tui", false, "show a live pattern view with playhead (interactive mode only)")
+	noColor := flag.Bool("no-color", false, "disable colored output (also honors NO_COLOR)")
+	themeName := flag.String("theme", theme.DefaultTheme, "color theme: "+strings.Join(theme.Names(), ", "))
+	configFile := flag.String("config", config.Path(), "config file (also INTERPLAY_CONFIG)")
+	flag.String("port", "", "MIDI port index or name substring, e.g. \"Elektron\" (overrides config)")
+	flag.Int("channel", 1, "MIDI channel 1-16 (overrides config)")
+	flag.String("model", string(ai.DefaultModel), "AI model (overrides config)")
+	flag.String("data-dir", "", "directory for patterns/ and macros.json (overrides config)")
+	flag.String("device", "", "device profile naming the synth's parameters, e.g. minilogue (overrides config)")
+	flag.Bool("verbose", false, "start with verbose step output (overrides config)")
+	flag.Bool("offline", false, "use only a local AI model via OLLAMA_HOST (overrides config)")
+	flag.Int("ai-timeout", int(ai.DefaultTimeout.Seconds()), "seconds an AI request may take (overrides config)")
+	flag.Float64("tempo", 80, "tempo of the starting pattern in BPM, e.g. 122.5 (overrides config)")
+	flag.Int("length", sequence.DefaultPatternLength, "length of the starting pattern in steps (overrides config)")
+	loadName := flag.String("load", "", "start with a saved pattern")
+	watchFiles := flag.Bool("watch", false, "reload the current pattern when its file changes on disk")
+	autoApply := flag.Bool("yes", false, "apply AI edits without asking for confirmation")
+	noCache := flag.Bool("no-cache", false, "don't reuse cached AI responses for repeated prompts")
+	hooksFile := flag.String("hooks", "", "run a Starlark hook script (on_loop, on_step, on_load)")
+	listenAddr := flag.String("listen", "", "accept commands on a Unix socket path or TCP address (e.g. /tmp/interplay.sock, :9000)")
+	httpAddr := flag.String("http", "", "serve the HTTP API on this address (e.g. :8080 for localhost, 0.0.0.0:8080 for all interfaces)")
+	httpFiles := flag.Bool("http-files", false, "let HTTP clients run commands that read or write files or load code (save, load, export, hooks, ...)")
+	httpOrigins := flag.String("http-origin", "", "comma-separated web page origins allowed to call the HTTP API besides its own (e.g. http://localhost:3000)")
+	oscListen := flag.String("osc-listen", "", "receive OSC commands on this UDP port or address (e.g. 9000)")
+	oscSend := flag.String("osc-send", "", "send OSC step/beat/note events to this host:port (e.g. 127.0.0.1:9001)")
+	logFile := flag.String("log-file", "", "write structured logs (JSON lines) to this file")
+	logLevel := flag.String("log-level", "debug", "log level: debug (includes MIDI events), info, warn, error")
+	realtime := flag.Bool("realtime", false, "raise the playback thread's priority and make GC rarer (see README)")
+	flag.Usage = printUsage
+	flag.Parse()
+
+	if *logFile != "" {
+		closeLog, err := setupLogging(*logFile, *logLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer closeLog()
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	theme.SetEnabled(colorsEnabled(*noColor))
+	if err := theme.Use(*themeName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	useDataDir(cfg.DataDir)
+	if err := ai.LoadPrompts(); err != nil {
+		fmt.Fprintln(os.Stderr, theme.Warning(fmt.Sprintf("Warning: %v", err)))
+	}
+
+	// Create initial pattern before touching MIDI, so a bad --load fails fast
+	initialPattern, err := startupPattern(cfg, *loadName, isFlagSet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// List available MIDI ports
+	ports, err := midi.ListPorts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing MIDI ports: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(ports) == 0 {
+		fmt.Fprintf(os.Stderr, "No MIDI output ports found\n")
+		os.Exit(1)
+	}
+
+	fmt.Println("Available MIDI ports:")
+	for i, port := range ports {
+		fmt.Printf("  %d: %s\n", i, port)
+	}
+
+	// Select MIDI port
+	var portIndex int
+	// Auto-select port 0 in batch mode (script file or piped input)
+	inBatchMode := *scriptFile != "" || !isTerminal()
+
+	// A port named by --port or config is matched by substring
+	matches := matchPorts(ports, cfg.Port)
+	if cfg.Port != "" && len(matches) == 0 {
+		fmt.Fprintf(os.Stderr, "No MIDI port matches %q\n", cfg.Port)
+		os.Exit(1)
+	}
+
+	if len(matches) == 1 {
+		portIndex = matches[0]
+		fmt.Printf("\nUsing port %d: %s\n\n", portIndex, ports[portIndex])
+	} else if len(matches) > 1 && inBatchMode {
+		fmt.Fprintf(os.Stderr, "MIDI port %q is ambiguous, matches: %s\n", cfg.Port, describePorts(ports, matches))
+		os.Exit(1)
+	} else if len(matches) == 0 && (len(ports) == 1 || inBatchMode) {
+		// Only one port, or batch mode - use port 0 automatically
+		portIndex = 0
+		fmt.Printf("\nUsing port %d: %s\n\n", portIndex, ports[portIndex])
+	} else {
+		// Multiple ports (or an ambiguous --port) in interactive mode, let user choose
+		fmt.Print("\n")
+		if len(matches) > 1 {
+			fmt.Printf("Multiple ports match %q: %s\n", cfg.Port, describePorts(ports, matches))
+		}
+		rl, err := readline.New(fmt.Sprintf("Select MIDI port (0-%d): ", len(ports)-1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating readline: %v\n", err)
+			os.Exit(1)
+		}
+		defer rl.Close()
+
+		input, err := rl.Readline()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			os.Exit(1)
+		}
+
+		input = strings.TrimSpace(input)
+		portIndex, err = strconv.Atoi(input)
+		if err != nil || portIndex < 0 || portIndex >= len(ports) {
+			fmt.Fprintf(os.Stderr, "Invalid port selection: %s\n", input)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Using port %d: %s\n\n", portIndex, ports[portIndex])
+	}
+
+	// Open MIDI output
+	midiOut, err := midi.Open(portIndex)
+	if err != nil {
+		slog.Error("opening MIDI port failed", "port", ports[portIndex], "error", err)
+		fmt.Fprintf(os.Stderr, "Error opening MIDI port: %v\n", err)
+		os.Exit(1)
+	}
+	slog.Info("started", "port", ports[portIndex], "channel", cfg.Channel, "tempo", cfg.Tempo, "length", cfg.Length)
+	defer midiOut.Close()
+
+	// Create playback engine
+	engine := playback.New(midiOut, initialPattern)
+	engine.SetChannel(cfg.Channel)
+	engine.SetVerbose(cfg.Verbose)
+	if *realtime {
+		useRealtime(engine, os.Stdout)
+	}
+
+	// Start playback in background
+	midiEvents := engine.Subscribe(0)
+	defer engine.Unsubscribe(midiEvents)
+	go reportMIDIErrors(midiEvents, os.Stderr)
+	engine.Start()
+
+	// Setup cleanup function for graceful shutdown (use sync.Once to prevent double-close)
+	var cleanupOnce sync.Once
+	cleanup := func() {
+		cleanupOnce.Do(func() {
+			engine.Stop()
+			midiOut.Close()
+			slog.Info("stopped", "loops", engine.LoopCount())
+		})
+	}
+	defer cleanup()
+
+	fmt.Println("Playback started! Type 'help' for commands, 'quit' to exit.")
+	fmt.Println()
+
+	// Create command handler that modifies the "next" pattern
+	cmdHandler := commands.New(engine.GetNextPattern(), engine)
+
+	// Setup signal handler for Ctrl+C to ensure clean shutdown. Ctrl+C
+	// during an AI request only cancels the request.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range sigChan {
+			if sig == os.Interrupt && cmdHandler.CancelAI() {
+				continue
+			}
+			fmt.Println("\nShutting down gracefully...")
+			cleanup()
+			os.Exit(0)
+		}
+	}()
+	configureHandler(cmdHandler, cfg, engine, midiOut, os.Stderr)
+	if *loadName != "" {
+		cmdHandler.MarkSaved(*loadName)
+	}
+	if *watchFiles {
+		cmdHandler.SetWatch(true)
+	}
+	if *autoApply {
+		cmdHandler.SetAIAutoApply(true)
+	}
+	if *noCache {
+		cmdHandler.SetAICache(false)
+	}
+
+	// The handler is fully configured before hooks and servers can run
+	// commands on it
+	if names, err := commands.LoadPlugins(cmdHandler.Output()); err != nil {
+		fmt.Fprintln(os.Stderr, theme.Warning(fmt.Sprintf("Warning: %v", err)))
+	} else if len(names) > 0 {
+		fmt.Fprintf(cmdHandler.Output(), "Plugins: %s\n\n", strings.Join(names, ", "))
+	}
+	if *hooksFile != "" {
+		if err := cmdHandler.LoadHooks(*hooksFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cleanup()
+			os.Exit(1)
+		}
+	}
+
+	// Accept commands from external tools while playing
+	if *listenAddr != "" {
+		server, err := remote.Listen(*listenAddr, cmdHandler)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cleanup()
+			os.Exit(1)
+		}
+		defer server.Close()
+		go server.Serve()
+		fmt.Printf("Listening for commands on %s\n\n", server.Addr())
+	}
+
+	// Serve the HTTP API for web frontends and scripts
+	if *httpAddr != "" {
+		api := httpapi.New(cmdHandler, engine.GetNextPattern(), engine)
+		api.SetAllowFiles(*httpFiles)
+		if *httpOrigins != "" {
+			api.SetOrigins(strings.Split(*httpOrigins, ","))
+		}
+		go func() {
+			if err := api.ListenAndServe(*httpAddr); err != nil {
+				slog.Error("HTTP API stopped", "error", err)
+				fmt.Fprintln(os.Stderr, theme.Error(fmt.Sprintf("HTTP API error: %v", err)))
+			}
+		}()
+		fmt.Printf("HTTP API on %s\n\n", httpapi.Address(*httpAddr))
+	}
+
+	// Open Sound Control for TouchOSC, Max/MSP, SuperCollider and friends
+	if *oscListen != "" {
+		server, err := osc.Listen(*oscListen, cmdHandler)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cleanup()
+			os.Exit(1)
+		}
+		defer server.Close()
+		go server.Serve()
+		fmt.Printf("Receiving OSC on %s\n\n", server.Addr())
+	}
+	if *oscSend != "" {
+		sender, err := osc.Dial(*oscSend)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cleanup()
+			os.Exit(1)
+		}
+		events := engine.Subscribe(0)
+		defer sender.Close()
+		defer engine.Unsubscribe(events)
+		go sender.Forward(events)
+		fmt.Printf("Sending OSC events to %s\n\n", *oscSend)
+	}
+	// runInteractive reads commands from the terminal, either line by line
+	// or in the live view when --tui is set
+	runInteractive := func() error {
+		if *tuiMode {
+			return tui.Run(engine, cmdHandler)
+		}
+		return cmdHandler.ReadLoop(os.Stdin)
+	}
+
+	// Handle script file mode
+	if *scriptFile != "" {
+		// Open script file
+		f, err := os.Open(*scriptFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening script file: %v\n", err)
+			os.Exit(2)
+		}
+		defer f.Close()
+
+		// Process script file
+		success, shouldExit := processBatchInput(f, cmdHandler)
+
+		// Exit with appropriate code if exit command present or on error
+		if shouldExit {
+			cleanup()
+			if success {
+				os.Exit(0)
+			} else {
+				os.Exit(1)
+			}
+		}
+		// Otherwise transition to interactive mode (script as preset)
+		fmt.Println("\nScript completed. Entering interactive mode...")
+		fmt.Println()
+		err = runInteractive()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading commands: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Goodbye!")
+		return
+	}
+
+	// Determine input mode based on stdin
+	if isTerminal() {
+		// Interactive mode (existing behavior)
+		err = runInteractive()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading commands: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		// Batch mode (piped input)
+		success, shouldExit := processBatchInput(os.Stdin, cmdHandler)
+
+		// Exit with appropriate code if exit command present
+		if shouldExit {
+			cleanup()
+			if success {
+				os.Exit(0)
+			} else {
+				os.Exit(1)
+			}
+		}
+
+		// Continue running with playback loop active (performance tool paradigm)
+		// User can stop with Ctrl+C
+		fmt.Println("\nBatch commands completed. Playback continues. Press Ctrl+C to exit.")
+		select {} // Block forever, playback goroutine keeps running
+	}
+
+	fmt.Println("Goodbye!")
+}
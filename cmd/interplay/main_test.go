@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/iltempo/interplay/commands"
+	"github.com/iltempo/interplay/config"
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// mockVerboseController implements VerboseController for testing
+type mockVerboseController struct {
+	verbose bool
+}
+
+func (m *mockVerboseController) SetVerbose(v bool) { m.verbose = v }
+func (m *mockVerboseController) IsVerbose() bool   { return m.verbose }
+
+func TestProcessBatchInput(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantSuccess bool
+		wantExit    bool
+	}{
+		{
+			name:        "empty input",
+			input:       "",
+			wantSuccess: true,
+			wantExit:    false,
+		},
+		{
+			name:        "comments only",
+			input:       "# comment\n# another comment\n",
+			wantSuccess: true,
+			wantExit:    false,
+		},
+		{
+			name:        "empty lines only",
+			input:       "\n\n\n",
+			wantSuccess: true,
+			wantExit:    false,
+		},
+		{
+			name:        "valid command",
+			input:       "show\n",
+			wantSuccess: true,
+			wantExit:    false,
+		},
+		{
+			name:        "exit command",
+			input:       "exit\n",
+			wantSuccess: true,
+			wantExit:    true,
+		},
+		{
+			name:        "quit command",
+			input:       "quit\n",
+			wantSuccess: true,
+			wantExit:    true,
+		},
+		{
+			name:        "mixed valid and comments",
+			input:       "# Setup pattern\nshow\n# Done\n",
+			wantSuccess: true,
+			wantExit:    false,
+		},
+		{
+			name:        "invalid command",
+			input:       "invalid_command_xyz\n",
+			wantSuccess: false,
+			wantExit:    false,
+		},
+		{
+			name:        "valid then invalid commands",
+			input:       "show\ninvalid_command\n",
+			wantSuccess: false,
+			wantExit:    false,
+		},
+		{
+			name:        "invalid then valid commands",
+			input:       "invalid_command\nshow\n",
+			wantSuccess: false,
+			wantExit:    false,
+		},
+		{
+			name:        "exit after error",
+			input:       "invalid_command\nexit\n",
+			wantSuccess: false,
+			wantExit:    true,
+		},
+		{
+			name:        "case insensitive exit",
+			input:       "EXIT\n",
+			wantSuccess: true,
+			wantExit:    true,
+		},
+		{
+			name:        "case insensitive quit",
+			input:       "QUIT\n",
+			wantSuccess: true,
+			wantExit:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			pattern := sequence.New(16)
+			mockController := &mockVerboseController{}
+			handler := commands.New(pattern, mockController)
+			reader := strings.NewReader(tt.input)
+
+			// Execute
+			gotSuccess, gotExit := processBatchInput(reader, handler)
+
+			// Verify
+			if gotSuccess != tt.wantSuccess {
+				t.Errorf("processBatchInput() success = %v, want %v", gotSuccess, tt.wantSuccess)
+			}
+			if gotExit != tt.wantExit {
+				t.Errorf("processBatchInput() exit = %v, want %v", gotExit, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestProcessBatchInput_CommandExecution(t *testing.T) {
+	// Test that commands actually execute
+	pattern := sequence.New(16)
+	mockController := &mockVerboseController{}
+	handler := commands.New(pattern, mockController)
+
+	// Execute length command (easy to verify)
+	input := "length 8\n"
+	reader := strings.NewReader(input)
+	success, exit := processBatchInput(reader, handler)
+
+	if !success {
+		t.Error("Expected length command to succeed")
+	}
+	if exit {
+		t.Error("Expected no exit for length command")
+	}
+
+	// Verify length was actually set
+	if pattern.Length() != 8 {
+		t.Errorf("Expected length to be 8, got %d", pattern.Length())
+	}
+}
+
+func TestProcessBatchInput_MultipleCommands(t *testing.T) {
+	// Test multiple commands execute in sequence
+	pattern := sequence.New(16)
+	mockController := &mockVerboseController{}
+	handler := commands.New(pattern, mockController)
+
+	input := `# Set up pattern
+length 8
+clear
+# Show result
+show
+`
+	reader := strings.NewReader(input)
+	success, exit := processBatchInput(reader, handler)
+
+	if !success {
+		t.Error("Expected all commands to succeed")
+	}
+	if exit {
+		t.Error("Expected no exit")
+	}
+
+	// Verify commands were executed
+	if pattern.Length() != 8 {
+		t.Errorf("Expected length to be 8, got %d", pattern.Length())
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("play", flag.ContinueOnError)
+	loops := fs.Int("loops", 1, "")
+	positional, err := parseInterspersed(fs, []string{"foo", "--loops", "4", "bar"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *loops != 4 || len(positional) != 2 || positional[0] != "foo" || positional[1] != "bar" {
+		t.Errorf("got loops=%d positional=%v, want loops=4 positional=[foo bar]", *loops, positional)
+	}
+}
+
+func TestSubcommands(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	pattern := sequence.New(16)
+	pattern.SetNote(1, 36)
+	if err := pattern.Save("bass"); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runList(nil, config.Default(), &out); err != nil {
+		t.Fatalf("list: unexpected error: %v", err)
+	}
+	if out.String() != "bass\n" {
+		t.Errorf("list output = %q, want %q", out.String(), "bass\n")
+	}
+
+	out.Reset()
+	if err := runExport([]string{"--pattern", "bass", "--out", "bass-x2.mid", "--loops", "2"}, config.Default(), &out); err != nil {
+		t.Fatalf("export: unexpected error: %v", err)
+	}
+	data, err := os.ReadFile("bass-x2.mid")
+	if err != nil {
+		t.Fatalf("exported file missing: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("MThd")) {
+		t.Errorf("exported file is not a MIDI file: % x", data[:min(len(data), 8)])
+	}
+
+	// Positional pattern name with default output file
+	if err := runExport([]string{"bass"}, config.Default(), &out); err != nil {
+		t.Fatalf("export: unexpected error: %v", err)
+	}
+	if _, err := os.Stat("bass.mid"); err != nil {
+		t.Errorf("expected bass.mid: %v", err)
+	}
+
+	if err := runExport(nil, config.Default(), &out); err == nil {
+		t.Error("export without pattern should return error")
+	}
+	if err := runExport([]string{"missing"}, config.Default(), &out); err == nil {
+		t.Error("export of missing pattern should return error")
+	}
+	if err := runPlay([]string{"bass", "--loops", "0"}, config.Default(), &out); err == nil {
+		t.Error("play with 0 loops should return error")
+	}
+
+	if handled, _ := runSubcommand([]string{"--script", "x.txt"}); handled {
+		t.Error("flags should not be treated as subcommands")
+	}
+}
+
+func TestMatchPorts(t *testing.T) {
+	ports := []string{"IAC Driver Bus 1", "Elektron Digitone", "Elektron Syntakt", "IAC Driver Bus 10"}
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"", nil},
+		{"digitone", []int{1}},
+		{"Elektron", []int{1, 2}},
+		{"iac driver bus 1", []int{0}}, // exact match wins over substring
+		{"Bus", []int{0, 3}},
+		{"2", []int{2}}, // index
+		{"9", nil},      // index out of range
+		{"Moog", nil},
+	}
+	for _, tt := range tests {
+		got := matchPorts(ports, tt.query)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("matchPorts(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if got := describePorts(ports, []int{1, 2}); got != "1: Elektron Digitone, 2: Elektron Syntakt" {
+		t.Errorf("describePorts() = %q", got)
+	}
+}
+
+func TestSetupLogging(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	path := filepath.Join(t.TempDir(), "interplay.log")
+	closeLog, err := setupLogging(path, "info")
+	if err != nil {
+		t.Fatalf("setupLogging() error = %v", err)
+	}
+
+	handler := commands.New(sequence.New(16), &mockVerboseController{})
+	handler.ProcessCommand("tempo 120")
+	handler.ProcessCommand("tempo 999")
+	slog.Debug("below level")
+	closeLog()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(lines), data)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if entry["level"] != "WARN" || entry["command"] != "tempo 999" || entry["error"] == nil {
+		t.Errorf("unexpected failed-command entry: %v", entry)
+	}
+
+	if _, err := setupLogging(path, "loud"); err == nil {
+		t.Error("setupLogging() with invalid level should return error")
+	}
+}
+
+func TestStartupPattern(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	cfg := config.Default()
+	cfg.Tempo = 140
+	cfg.Length = 32
+	noFlags := func(string) bool { return false }
+
+	p, err := startupPattern(cfg, "", noFlags)
+	if err != nil {
+		t.Fatalf("startupPattern() error = %v", err)
+	}
+	if p.Length() != 32 || p.GetBPM() != 140 {
+		t.Errorf("got %d steps at %g BPM, want 32 steps at 140 BPM", p.Length(), p.GetBPM())
+	}
+
+	saved := sequence.New(16)
+	saved.SetTempo(95)
+	saved.SetNote(1, 36)
+	saved.Save("groove")
+
+	// A loaded pattern keeps its own tempo and length unless flags override them
+	p, err = startupPattern(cfg, "groove", noFlags)
+	if err != nil {
+		t.Fatalf("startupPattern() error = %v", err)
+	}
+	if p.Length() != 16 || p.GetBPM() != 95 {
+		t.Errorf("loaded: got %d steps at %g BPM, want 16 steps at 95 BPM", p.Length(), p.GetBPM())
+	}
+
+	p, err = startupPattern(cfg, "groove", func(name string) bool { return name == "tempo" })
+	if err != nil {
+		t.Fatalf("startupPattern() error = %v", err)
+	}
+	if p.Length() != 16 || p.GetBPM() != 140 {
+		t.Errorf("--tempo override: got %d steps at %g BPM, want 16 steps at 140 BPM", p.Length(), p.GetBPM())
+	}
+
+	if _, err := startupPattern(cfg, "missing", noFlags); err == nil {
+		t.Error("loading a missing pattern should return error")
+	}
+}
+
+// TestTuneGC tests that --realtime's GC settings defer to GOGC and GOMEMLIMIT
+func TestTuneGC(t *testing.T) {
+	defer debug.SetGCPercent(debug.SetGCPercent(100))
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(-1))
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{"defaults", nil, []string{"GOGC=400", "GOMEMLIMIT=512MiB"}},
+		{"GOGC set", map[string]string{"GOGC": "200"}, []string{"GOMEMLIMIT=512MiB"}},
+		{"both set", map[string]string{"GOGC": "off", "GOMEMLIMIT": "1GiB"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tuneGC(func(key string) string { return tt.env[key] })
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tuneGC() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	tuneGC(func(string) string { return "" })
+	if percent := debug.SetGCPercent(realtimeGCPercent); percent != realtimeGCPercent {
+		t.Errorf("GC percent = %d, want %d", percent, realtimeGCPercent)
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != realtimeMemoryLimit {
+		t.Errorf("memory limit = %d, want %d", limit, realtimeMemoryLimit)
+	}
+}
+
+func TestReportMIDIErrors(t *testing.T) {
+	events := make(chan playback.Event, 4)
+	events <- playback.Event{Type: playback.EventStep, Step: 1}
+	events <- playback.Event{Type: playback.EventSendFailed, Err: fmt.Errorf("device unplugged")}
+	events <- playback.Event{Type: playback.EventSendRecovered}
+	close(events)
+
+	var out bytes.Buffer
+	reportMIDIErrors(events, &out)
+	for _, want := range []string{"MIDI device lost: device unplugged", "MIDI device is back"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q does not contain %q", out.String(), want)
+		}
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 2 {
+		t.Errorf("printed %d lines, want 2", lines)
+	}
+}
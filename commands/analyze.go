@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+)
+
+// histogramWidth is the longest bar in the 'analyze' pitch class histogram
+const histogramWidth = 20
+
+// pitchClasses names the histogram rows
+var pitchClasses = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// handleAnalyze: analyze
+// Reports key/scale, pitch classes, density, velocity and syncopation
+func (h *Handler) handleAnalyze(parts []string) error {
+	if len(parts) != 1 {
+		return fmt.Errorf("usage: analyze")
+	}
+
+	a := h.pattern.Analyze()
+	if a.Notes == 0 {
+		fmt.Fprintln(h.out, "Nothing to analyze: the pattern has no notes")
+		return nil
+	}
+
+	if a.Key == "" {
+		fmt.Fprintln(h.out, "Key: no clear key")
+	} else {
+		fmt.Fprintf(h.out, "Key: %s (confidence %.2f)", a.Key, a.KeyConfidence)
+		if len(a.OutOfKey) > 0 {
+			fmt.Fprintf(h.out, ", outside the key: %s", strings.Join(a.OutOfKey, " "))
+		}
+		fmt.Fprintln(h.out)
+	}
+
+	fmt.Fprintln(h.out, "Pitch classes:")
+	most := 0
+	for _, count := range a.PitchClasses {
+		most = max(most, count)
+	}
+	for pc, count := range a.PitchClasses {
+		if count == 0 {
+			continue
+		}
+		bar := strings.Repeat("█", max(1, count*histogramWidth/most))
+		fmt.Fprintf(h.out, "  %-2s %s %d\n", pitchClasses[pc], bar, count)
+	}
+
+	density := make([]string, len(a.BarDensity))
+	for i, d := range a.BarDensity {
+		density[i] = fmt.Sprintf("%d: %.0f%%", i+1, d*100)
+	}
+	fmt.Fprintf(h.out, "Note density per bar (%d steps): %s\n", h.pattern.StepsPerBar(), strings.Join(density, ", "))
+	fmt.Fprintf(h.out, "Velocity: %d-%d, mean %.0f, spread ±%.0f\n", a.VelocityMin, a.VelocityMax, a.VelocityMean, a.VelocityStdDev)
+	fmt.Fprintf(h.out, "Syncopation: %.0f%% of notes start off the beat\n", a.Syncopation*100)
+	return nil
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// Looper plays part of the pattern each loop. *playback.Engine implements it.
+type Looper interface {
+	LoopSteps(first, last int)
+	LoopedSteps() (first, last int)
+}
+
+// SetLooper connects the handler to the engine used by 'loop bar'
+func (h *Handler) SetLooper(looper Looper) {
+	h.looper = looper
+}
+
+// barSteps returns the first and last step (1-based) of bar n, in bars of
+// the pattern's meter (see 'meter'); the last bar may be shorter
+func (h *Handler) barSteps(arg string) (int, int, error) {
+	length, stepsPerBar := h.pattern.Length(), h.pattern.StepsPerBar()
+	bars := (length + stepsPerBar - 1) / stepsPerBar
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > bars {
+		return 0, 0, fmt.Errorf("bar must be 1-%d (the pattern has %d steps of %d per bar)", bars, length, stepsPerBar)
+	}
+	first := (n-1)*stepsPerBar + 1
+	return first, min(first+stepsPerBar-1, length), nil
+}
+
+// clearBar: clear bar <n>
+func (h *Handler) clearBar(arg string) error {
+	first, last, err := h.barSteps(arg)
+	if err != nil {
+		return err
+	}
+	steps := h.pattern.Snapshot()
+	for i := first - 1; i < last; i++ {
+		steps[i] = sequence.Step{IsRest: true, Velocity: 100, Gate: 90, Duration: 1}
+	}
+	if err := h.pattern.SetSteps(steps); err != nil {
+		return err
+	}
+	fmt.Fprintf(h.out, "Cleared bar %s (steps %d-%d)\n", arg, first, last)
+	return nil
+}
+
+// handleCopy: copy bar <from> <to>
+// Copies a bar's steps with their CCs over another bar
+func (h *Handler) handleCopy(parts []string) error {
+	if len(parts) != 4 || parts[1] != "bar" {
+		return fmt.Errorf("usage: copy bar <from> <to> (e.g., 'copy bar 1 3')")
+	}
+	from, fromLast, err := h.barSteps(parts[2])
+	if err != nil {
+		return err
+	}
+	to, toLast, err := h.barSteps(parts[3])
+	if err != nil {
+		return err
+	}
+
+	steps := h.pattern.Snapshot()
+	count := min(fromLast-from, toLast-to) + 1
+	copy(steps[to-1:to-1+count], h.pattern.Snapshot()[from-1:from-1+count])
+	if err := h.pattern.SetSteps(steps); err != nil {
+		return err
+	}
+	fmt.Fprintf(h.out, "Copied bar %s (steps %d-%d) to bar %s (steps %d-%d)\n", parts[2], from, from+count-1, parts[3], to, to+count-1)
+	return nil
+}
+
+// handleLoop: loop [bar <n>|off]
+// Plays only one bar each loop, to work on it, until 'loop off'
+func (h *Handler) handleLoop(parts []string) error {
+	if h.looper == nil {
+		return fmt.Errorf("'loop' requires playback to be running")
+	}
+	switch {
+	case len(parts) == 1:
+		if first, last := h.looper.LoopedSteps(); first > 0 {
+			fmt.Fprintf(h.out, "Looping steps %d-%d ('loop off' plays the whole pattern)\n", first, last)
+		} else {
+			fmt.Fprintln(h.out, "Playing the whole pattern")
+		}
+		return nil
+	case len(parts) == 2 && parts[1] == "off":
+		h.looper.LoopSteps(0, 0)
+		fmt.Fprintln(h.out, "Playing the whole pattern from the next loop")
+		return nil
+	case len(parts) == 3 && parts[1] == "bar":
+		first, last, err := h.barSteps(parts[2])
+		if err != nil {
+			return err
+		}
+		h.looper.LoopSteps(first, last)
+		fmt.Fprintf(h.out, "Looping bar %s (steps %d-%d) from the next loop ('loop off' to stop)\n", parts[2], first, last)
+		return nil
+	}
+	return fmt.Errorf("usage: loop bar <n> or loop off (e.g., 'loop bar 2')")
+}
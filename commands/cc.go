@@ -2,19 +2,33 @@ package commands
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 )
 
-// handleCC: cc <cc-number> <value>
-// Sets a global CC value that affects the entire pattern (transient, not saved)
+// handleCC: cc <cc-number|name> <value> [--save|--no-save]
+// Sets a global CC value that affects the entire pattern. It is transient
+// unless saved with --save (or 'cc-persist on'); a CC that is already saved
+// stays saved until --no-save.
 func (h *Handler) handleCC(parts []string) error {
+	usage := fmt.Errorf("usage: cc <cc-number|name> <value> [--save|--no-save] (e.g., 'cc cutoff 90')")
+
+	save := ""
+	if len(parts) == 4 {
+		save = strings.ToLower(parts[3])
+		if save != "--save" && save != "--no-save" {
+			return usage
+		}
+		parts = parts[:3]
+	}
 	if len(parts) != 3 {
-		return fmt.Errorf("usage: cc <cc-number> <value>")
+		return usage
 	}
 
-	ccNumber, err := strconv.Atoi(parts[1])
+	ccNumber, err := h.parseCCNumber(parts[1])
 	if err != nil {
-		return fmt.Errorf("invalid CC number: %s (must be 0-127)", parts[1])
+		return err
 	}
 
 	value, err := strconv.Atoi(parts[2])
@@ -22,11 +36,64 @@ func (h *Handler) handleCC(parts []string) error {
 		return fmt.Errorf("invalid CC value: %s (must be 0-127)", parts[2])
 	}
 
+	if err := h.checkCCValue(ccNumber, value); err != nil {
+		return err
+	}
+
 	// SetGlobalCC validates the CC number and value
 	if err := h.pattern.SetGlobalCC(ccNumber, value); err != nil {
 		return err
 	}
 
-	fmt.Printf("Set global CC#%d to %d (will take effect at next loop iteration)\n", ccNumber, value)
+	switch {
+	case save == "--save" || (save == "" && h.ccPersist):
+		h.pattern.SetGlobalCCSaved(ccNumber, true)
+	case save == "--no-save":
+		h.pattern.SetGlobalCCSaved(ccNumber, false)
+	}
+
+	if h.pattern.IsGlobalCCSaved(ccNumber) {
+		fmt.Fprintf(h.out, "Set global %s to %d, saved with the pattern (will take effect at next loop iteration)\n", h.ccLabel(ccNumber), value)
+	} else {
+		fmt.Fprintf(h.out, "Set global %s to %d (will take effect at next loop iteration)\n", h.ccLabel(ccNumber), value)
+	}
+	return nil
+}
+
+// handleCCPersist: cc-persist [on|off]
+// In persist mode, 'cc' saves global CC values with the pattern
+func (h *Handler) handleCCPersist(parts []string) error {
+	if len(parts) > 2 {
+		return fmt.Errorf("usage: cc-persist [on|off]")
+	}
+
+	if len(parts) == 2 {
+		switch strings.ToLower(parts[1]) {
+		case "on":
+			h.ccPersist = true
+		case "off":
+			h.ccPersist = false
+		default:
+			return fmt.Errorf("usage: cc-persist [on|off]")
+		}
+	}
+
+	if h.ccPersist {
+		fmt.Fprintln(h.out, "CC persist: ON ('cc' values are saved with the pattern)")
+	} else {
+		fmt.Fprintln(h.out, "CC persist: OFF ('cc' values are transient; use 'cc <cc> <value> --save')")
+	}
+
+	var saved []int
+	for ccNum := range h.pattern.GetAllGlobalCC() {
+		if h.pattern.IsGlobalCCSaved(ccNum) {
+			saved = append(saved, ccNum)
+		}
+	}
+	sort.Ints(saved)
+	for _, ccNum := range saved {
+		value, _ := h.pattern.GetGlobalCC(ccNum)
+		fmt.Fprintf(h.out, "  %s = %d (saved)\n", h.ccLabel(ccNum), value)
+	}
 	return nil
 }
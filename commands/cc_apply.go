@@ -2,19 +2,18 @@ package commands
 
 import (
 	"fmt"
-	"strconv"
 )
 
-// handleCCApply: cc-apply <cc-number>
+// handleCCApply: cc-apply <cc-number|name>
 // Applies global CC value to all steps with notes (converts transient to persistent)
 func (h *Handler) handleCCApply(parts []string) error {
 	if len(parts) != 2 {
-		return fmt.Errorf("usage: cc-apply <cc-number>")
+		return fmt.Errorf("usage: cc-apply <cc-number|name>")
 	}
 
-	ccNumber, err := strconv.Atoi(parts[1])
+	ccNumber, err := h.parseCCNumber(parts[1])
 	if err != nil {
-		return fmt.Errorf("invalid CC number: %s", parts[1])
+		return err
 	}
 
 	// ApplyGlobalCC checks if global value is set and applies it
@@ -25,6 +24,6 @@ func (h *Handler) handleCCApply(parts []string) error {
 	// Get the value that was applied
 	value, _ := h.pattern.GetGlobalCC(ccNumber)
 
-	fmt.Printf("Applied global CC#%d (value: %d) to all steps with notes\n", ccNumber, value)
+	fmt.Fprintf(h.out, "Applied global %s (value: %d) to all steps with notes\n", h.ccLabel(ccNumber), value)
 	return nil
 }
@@ -5,11 +5,11 @@ import (
 	"strconv"
 )
 
-// handleCCClear: cc-clear <step> [cc-number]
+// handleCCClear: cc-clear <step> [cc-number|name]
 // Clears CC automation from a step (all CC or specific CC number)
 func (h *Handler) handleCCClear(parts []string) error {
 	if len(parts) < 2 || len(parts) > 3 {
-		return fmt.Errorf("usage: cc-clear <step> [cc-number]")
+		return fmt.Errorf("usage: cc-clear <step> [cc-number|name]")
 	}
 
 	step, err := strconv.Atoi(parts[1])
@@ -19,23 +19,23 @@ func (h *Handler) handleCCClear(parts []string) error {
 
 	if len(parts) == 3 {
 		// Clear specific CC number
-		ccNumber, err := strconv.Atoi(parts[2])
+		ccNumber, err := h.parseCCNumber(parts[2])
 		if err != nil {
-			return fmt.Errorf("invalid CC number: %s", parts[2])
+			return err
 		}
 
 		if err := h.pattern.ClearStepCC(step, ccNumber); err != nil {
 			return err
 		}
 
-		fmt.Printf("Cleared CC#%d from step %d\n", ccNumber, step)
+		fmt.Fprintf(h.out, "Cleared %s from step %d\n", h.ccLabel(ccNumber), step)
 	} else {
 		// Clear all CC automation from step
 		if err := h.pattern.ClearStepCC(step, -1); err != nil {
 			return err
 		}
 
-		fmt.Printf("Cleared all CC automation from step %d\n", step)
+		fmt.Fprintf(h.out, "Cleared all CC automation from step %d\n", step)
 	}
 
 	return nil
@@ -0,0 +1,314 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/iltempo/interplay/theme"
+)
+
+// CCNamesFile is where user-defined CC names are persisted (next to patterns/)
+var CCNamesFile = "cc-names.json"
+
+// ccName maps a name to a CC number
+type ccName struct {
+	name   string
+	number int
+}
+
+// builtinCCNames are General MIDI controller names. The first name listed
+// for a number is the one displayed; the others are aliases.
+var builtinCCNames = []ccName{
+	{"modwheel", 1}, {"mod", 1},
+	{"breath", 2},
+	{"foot", 4},
+	{"portamento-time", 5},
+	{"volume", 7},
+	{"balance", 8},
+	{"pan", 10},
+	{"expression", 11},
+	{"sustain", 64},
+	{"portamento", 65},
+	{"sostenuto", 66},
+	{"soft", 67},
+	{"legato", 68},
+	{"resonance", 71},
+	{"release", 72},
+	{"attack", 73},
+	{"cutoff", 74}, {"filter", 74}, {"brightness", 74},
+	{"decay", 75},
+	{"vibrato-rate", 76},
+	{"vibrato-depth", 77},
+	{"vibrato-delay", 78},
+	{"reverb", 91},
+	{"tremolo", 92},
+	{"chorus", 93},
+	{"detune", 94},
+	{"phaser", 95},
+}
+
+// loadCCNames reads user-defined CC names. A missing file means none yet.
+func loadCCNames() (map[string]int, error) {
+	data, err := os.ReadFile(CCNamesFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]int{}, nil
+		}
+		return nil, fmt.Errorf("failed to read CC names file: %w", err)
+	}
+
+	names := map[string]int{}
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("failed to parse CC names file: %w", err)
+	}
+	return names, nil
+}
+
+// saveCCNames writes user-defined CC names to disk
+func saveCCNames(names map[string]int) error {
+	data, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal CC names: %w", err)
+	}
+	if err := os.WriteFile(CCNamesFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write CC names file: %w", err)
+	}
+	return nil
+}
+
+// allCCNames returns built-in names, then user names (sorted), then the
+// active device's CC parameters, so later names take precedence when looking
+// up or displaying. An unreadable user file is ignored here; 'cc-name'
+// reports it.
+func (h *Handler) allCCNames() []ccName {
+	names := append([]ccName(nil), builtinCCNames...)
+	if user, err := loadCCNames(); err == nil {
+		for _, name := range sortedNames(user) {
+			names = append(names, ccName{name, user[name]})
+		}
+	}
+	if h.device != nil {
+		for _, param := range h.device.Parameters {
+			if param.CC != nil {
+				names = append(names, ccName{param.Name, *param.CC})
+			}
+		}
+	}
+	return names
+}
+
+// sortedNames returns the keys of a CC name map in order
+func sortedNames(m map[string]int) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseCCNumber accepts a CC number (0-127) or a CC name like "cutoff"
+func (h *Handler) parseCCNumber(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > 127 {
+			return 0, fmt.Errorf("invalid CC number: %s (must be 0-127)", s)
+		}
+		return n, nil
+	}
+
+	lower := strings.ToLower(s)
+	if h.device != nil {
+		if param, ok := h.device.Find(lower); ok && param.NRPN != nil {
+			return 0, fmt.Errorf("'%s' is an NRPN parameter of %s; only CC parameters can be automated", lower, h.device.Name)
+		}
+	}
+	number := -1
+	for _, cc := range h.allCCNames() {
+		if cc.name == lower {
+			number = cc.number // later (user) names win
+		}
+	}
+	if number < 0 {
+		return 0, fmt.Errorf("invalid CC number: %s (must be 0-127 or a CC name, see 'cc-name')", s)
+	}
+	return number, nil
+}
+
+// ccDisplayName returns the name shown for a CC number, or "" if it has none.
+// Device parameter names win over user names, which win over built-in ones.
+func (h *Handler) ccDisplayName(number int) string {
+	display := ""
+	builtinSeen := false
+	for i, cc := range h.allCCNames() {
+		if cc.number != number {
+			continue
+		}
+		if i < len(builtinCCNames) {
+			if !builtinSeen {
+				display = cc.name
+				builtinSeen = true
+			}
+			continue
+		}
+		display = cc.name
+	}
+	return display
+}
+
+// ccLabel formats a CC number with its name, e.g. "CC#74 (cutoff)"
+func (h *Handler) ccLabel(number int) string {
+	if name := h.ccDisplayName(number); name != "" {
+		return fmt.Sprintf("CC#%d (%s)", number, name)
+	}
+	return fmt.Sprintf("CC#%d", number)
+}
+
+// isCCName reports whether name can be used as a CC name: letters, digits,
+// '-' and '_', starting with a letter
+func isCCName(name string) bool {
+	if name == "" || !unicode.IsLetter(rune(name[0])) {
+		return false
+	}
+	for _, r := range name {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// handleCCName: cc-name [define <name> <cc-number>|delete <name>]
+// Without arguments, lists all CC names
+func (h *Handler) handleCCName(parts []string) error {
+	if len(parts) == 1 {
+		return listCCNames(h.out)
+	}
+
+	switch strings.ToLower(parts[1]) {
+	case "define", "def":
+		if len(parts) != 4 {
+			return fmt.Errorf("usage: cc-name define <name> <cc-number> (e.g., 'cc-name define env-amount 79')")
+		}
+		return defineCCName(h.out, strings.ToLower(parts[2]), parts[3])
+
+	case "delete", "rm":
+		if len(parts) != 3 {
+			return fmt.Errorf("usage: cc-name delete <name>")
+		}
+		return deleteCCName(h.out, strings.ToLower(parts[2]))
+
+	default:
+		return fmt.Errorf("usage: cc-name [define <name> <cc-number>|delete <name>]")
+	}
+}
+
+// defineCCName stores a user CC name and persists it
+func defineCCName(w io.Writer, name, number string) error {
+	if !isCCName(name) {
+		return fmt.Errorf("invalid CC name: %s (use letters, digits, - and _, starting with a letter)", name)
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 || n > 127 {
+		return fmt.Errorf("invalid CC number: %s (must be 0-127)", number)
+	}
+
+	names, err := loadCCNames()
+	if err != nil {
+		return err
+	}
+	if old, exists := names[name]; exists && old != n {
+		fmt.Fprintln(w, theme.Warning(fmt.Sprintf("⚠️  Warning: CC name '%s' was CC#%d and will be overwritten.", name, old)))
+	}
+	names[name] = n
+
+	if err := saveCCNames(names); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Defined CC name '%s' = CC#%d\n", name, n)
+	return nil
+}
+
+// deleteCCName removes a user CC name; built-in names can't be deleted
+func deleteCCName(w io.Writer, name string) error {
+	names, err := loadCCNames()
+	if err != nil {
+		return err
+	}
+	if _, exists := names[name]; !exists {
+		for _, cc := range builtinCCNames {
+			if cc.name == name {
+				return fmt.Errorf("'%s' is a built-in CC name and can't be deleted", name)
+			}
+		}
+		return fmt.Errorf("CC name '%s' not found", name)
+	}
+	delete(names, name)
+
+	if err := saveCCNames(names); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Deleted CC name '%s'\n", name)
+	return nil
+}
+
+// listCCNames prints all CC names grouped by number
+func listCCNames(w io.Writer) error {
+	user, err := loadCCNames()
+	if err != nil {
+		return err
+	}
+
+	byNumber := map[int][]string{}
+	for _, cc := range builtinCCNames {
+		byNumber[cc.number] = append(byNumber[cc.number], cc.name)
+	}
+	for _, name := range sortedNames(user) {
+		byNumber[user[name]] = append(byNumber[user[name]], name+"*")
+	}
+
+	numbers := make([]int, 0, len(byNumber))
+	for n := range byNumber {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	fmt.Fprintln(w, theme.Header("CC names:"))
+	for _, n := range numbers {
+		fmt.Fprintf(w, "  %3d  %s\n", n, strings.Join(byNumber[n], ", "))
+	}
+	if len(user) > 0 {
+		fmt.Fprintf(w, "\n* user-defined (stored in %s)\n", CCNamesFile)
+	}
+	return nil
+}
+
+// checkCCValue checks a value against the active device's range for the CC
+func (h *Handler) checkCCValue(number, value int) error {
+	if h.device == nil {
+		return nil
+	}
+	if param, ok := h.device.ForCC(number); ok && (value < param.Min() || value > param.Max()) {
+		return fmt.Errorf("%s on %s must be %d-%d, got %d", param.Name, h.device.Name, param.Min(), param.Max(), value)
+	}
+	return nil
+}
+
+// ccNameList lists all CC names for tab completion
+func (h *Handler) ccNameList(string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, cc := range h.allCCNames() {
+		if !seen[cc.name] {
+			seen[cc.name] = true
+			names = append(names, cc.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,8 +3,16 @@ package commands
 import (
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
 )
 
+// curveHeight is the number of rows in a 'cc-show <cc> curve' plot
+const curveHeight = 8
+
 // ccEntry represents a single CC automation entry for display
 type ccEntry struct {
 	step     int
@@ -12,37 +20,54 @@ type ccEntry struct {
 	value    int
 }
 
-// handleCCShow: cc-show
-// Displays all active CC automation across all steps in a table format
+// handleCCShow: cc-show [cc-number|name] [curve]
+// Displays active CC automation across all steps in a table format,
+// optionally for one CC, or as a curve of that CC's values over the steps
 func (h *Handler) handleCCShow(parts []string) error {
-	if len(parts) != 1 {
-		return fmt.Errorf("usage: cc-show")
+	usage := fmt.Errorf("usage: cc-show [cc-number|name] [curve] (e.g., 'cc-show cutoff curve')")
+	if len(parts) > 3 {
+		return usage
 	}
 
-	// Collect all CC automation data
-	var entries []ccEntry
-
-	patternLen := h.pattern.Length()
-	for step := 1; step <= patternLen; step++ {
-		// Get step data to access CC map directly (more efficient than iterating 0-127)
-		stepData, err := h.pattern.GetStep(step)
+	onlyCC := -1
+	if len(parts) >= 2 {
+		ccNum, err := h.parseCCNumber(parts[1])
 		if err != nil {
-			continue // Skip invalid steps
+			return err
+		}
+		onlyCC = ccNum
+	}
+	if len(parts) == 3 {
+		if mode := strings.ToLower(parts[2]); mode != "curve" && mode != "--curve" {
+			return usage
 		}
+		return h.showCCCurve(onlyCC)
+	}
 
+	// Collect all CC automation data
+	var entries []ccEntry
+
+	h.pattern.ForEachStep(func(step int, stepData sequence.Step) {
 		// Iterate only over CC values that are actually set
 		for ccNum, value := range stepData.CCValues {
+			if onlyCC >= 0 && ccNum != onlyCC {
+				continue
+			}
 			entries = append(entries, ccEntry{
 				step:     step,
 				ccNumber: ccNum,
 				value:    value,
 			})
 		}
-	}
+	})
 
 	// Check if there's any CC automation
 	if len(entries) == 0 {
-		fmt.Println("No CC automation configured")
+		if onlyCC >= 0 {
+			fmt.Fprintf(h.out, "No automation for %s\n", h.ccLabel(onlyCC))
+		} else {
+			fmt.Fprintln(h.out, "No CC automation configured")
+		}
 		return nil
 	}
 
@@ -55,16 +80,16 @@ func (h *Handler) handleCCShow(parts []string) error {
 	})
 
 	// Display table header
-	fmt.Println("CC Automation:")
-	fmt.Println("  Step  CC#  Value")
-	fmt.Println("  ----  ---  -----")
+	fmt.Fprintln(h.out, theme.Header("CC Automation:"))
+	fmt.Fprintln(h.out, theme.Header("  Step  CC#  Value  Name"))
+	fmt.Fprintln(h.out, theme.Dim("  ----  ---  -----  ----"))
 
 	// Display entries
 	for _, entry := range entries {
-		fmt.Printf("  %4d  %3d  %5d\n", entry.step, entry.ccNumber, entry.value)
+		fmt.Fprintf(h.out, "  %4d  %3d  %5d  %s\n", entry.step, entry.ccNumber, entry.value, h.ccDisplayName(entry.ccNumber))
 	}
 
-	fmt.Printf("\nTotal: %d CC automation(s) across %d step(s)\n", len(entries), countUniqueSteps(entries))
+	fmt.Fprintf(h.out, "\nTotal: %d CC automation(s) across %d step(s)\n", len(entries), countUniqueSteps(entries))
 	return nil
 }
 
@@ -76,3 +101,90 @@ func countUniqueSteps(entries []ccEntry) int {
 	}
 	return len(steps)
 }
+
+// showCCCurve plots the value of a CC at every step. Steps without
+// automation hold the previous value, as the synth does during playback.
+func (h *Handler) showCCCurve(ccNum int) error {
+	patternLen := h.pattern.Length()
+	values := make([]int, patternLen)
+	automated := make([]bool, patternLen)
+	for step := 1; step <= patternLen; step++ {
+		if value, ok := h.pattern.GetStepCC(step, ccNum); ok {
+			values[step-1] = value
+			automated[step-1] = true
+		}
+	}
+
+	start, hasStart := h.pattern.GetGlobalCC(ccNum)
+	if !hasStart {
+		// Without a global value, the last automated value carries over from the previous loop
+		for i := patternLen - 1; i >= 0; i-- {
+			if automated[i] {
+				start, hasStart = values[i], true
+				break
+			}
+		}
+	}
+	if !hasStart {
+		fmt.Fprintf(h.out, "No automation for %s\n", h.ccLabel(ccNum))
+		return nil
+	}
+
+	held := start
+	for i := range values {
+		if automated[i] {
+			held = values[i]
+		}
+		values[i] = held
+	}
+
+	fmt.Fprintln(h.out, theme.Header(fmt.Sprintf("%s automation:", h.ccLabel(ccNum))))
+	for _, line := range ccCurve(values, automated, curveHeight) {
+		fmt.Fprintln(h.out, "  "+line)
+	}
+	fmt.Fprintln(h.out, theme.Dim("  █ automated step  ░ held value"))
+	return nil
+}
+
+// ccCurve renders values (0-127) as columns of the given height, one per
+// step, with a value axis on the left and step numbers below
+func ccCurve(values []int, automated []bool, height int) []string {
+	lines := make([]string, 0, height+2)
+	for row := height; row >= 1; row-- {
+		label := "    "
+		switch row {
+		case height:
+			label = " 127"
+		case (height + 1) / 2:
+			label = "  64"
+		case 1:
+			label = "   0"
+		}
+
+		var sb strings.Builder
+		sb.WriteString(label + " │")
+		for i, value := range values {
+			// Column height, rounded; every column shows at least one cell
+			level := max((value*height+63)/127, 1)
+			switch {
+			case level < row:
+				sb.WriteString(" ")
+			case automated[i]:
+				sb.WriteString("█")
+			default:
+				sb.WriteString("░")
+			}
+		}
+		lines = append(lines, strings.TrimRight(sb.String(), " "))
+	}
+
+	lines = append(lines, "     └"+strings.Repeat("─", len(values)))
+
+	// Step numbers every 4 steps (each number starts above its step)
+	ruler := []byte(strings.Repeat(" ", len(values)+4))
+	for step := 1; step <= len(values); step += 4 {
+		copy(ruler[step-1:], strconv.Itoa(step))
+	}
+	lines = append(lines, "      "+strings.TrimRight(string(ruler), " "))
+	return lines
+}
@@ -5,11 +5,11 @@ import (
 	"strconv"
 )
 
-// handleCCStep: cc-step <step> <cc-number> <value>
+// handleCCStep: cc-step <step> <cc-number|name> <value>
 // Sets CC automation for a specific step (persistent, saved with pattern)
 func (h *Handler) handleCCStep(parts []string) error {
 	if len(parts) != 4 {
-		return fmt.Errorf("usage: cc-step <step> <cc-number> <value>")
+		return fmt.Errorf("usage: cc-step <step> <cc-number|name> <value> (e.g., 'cc-step 1 cutoff 127')")
 	}
 
 	step, err := strconv.Atoi(parts[1])
@@ -17,9 +17,9 @@ func (h *Handler) handleCCStep(parts []string) error {
 		return fmt.Errorf("invalid step number: %s", parts[1])
 	}
 
-	ccNumber, err := strconv.Atoi(parts[2])
+	ccNumber, err := h.parseCCNumber(parts[2])
 	if err != nil {
-		return fmt.Errorf("invalid CC number: %s (must be 0-127)", parts[2])
+		return err
 	}
 
 	value, err := strconv.Atoi(parts[3])
@@ -27,11 +27,15 @@ func (h *Handler) handleCCStep(parts []string) error {
 		return fmt.Errorf("invalid CC value: %s (must be 0-127)", parts[3])
 	}
 
+	if err := h.checkCCValue(ccNumber, value); err != nil {
+		return err
+	}
+
 	// SetStepCC validates step, CC number, and value
 	if err := h.pattern.SetStepCC(step, ccNumber, value); err != nil {
 		return err
 	}
 
-	fmt.Printf("Set step %d CC#%d to %d\n", step, ccNumber, value)
+	fmt.Fprintf(h.out, "Set step %d %s to %d\n", step, h.ccLabel(ccNumber), value)
 	return nil
 }
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/iltempo/interplay/ai"
+)
+
+// handleChat: chat [save <name>|load <name>] - without arguments, lists
+// saved conversations
+func (h *Handler) handleChat(parts []string) error {
+	if h.aiClient == nil {
+		return errAIUnavailable
+	}
+
+	switch {
+	case len(parts) == 1:
+		names, err := ai.SavedChats()
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Fprintln(h.out, "No saved conversations")
+			return nil
+		}
+		fmt.Fprintln(h.out, "Saved conversations:")
+		for _, name := range names {
+			fmt.Fprintf(h.out, "  %s\n", name)
+		}
+		return nil
+	case len(parts) == 3 && parts[1] == "save":
+		if err := h.aiClient.SaveHistory(parts[2]); err != nil {
+			return err
+		}
+		fmt.Fprintf(h.out, "Conversation saved as '%s' (%d messages)\n", parts[2], h.aiClient.HistoryLen())
+		return nil
+	case len(parts) == 3 && parts[1] == "load":
+		if err := h.aiClient.LoadHistory(parts[2]); err != nil {
+			return err
+		}
+		h.resumeChat = true
+		fmt.Fprintf(h.out, "Conversation '%s' loaded (%d messages); 'ai' continues it\n", parts[2], h.aiClient.HistoryLen())
+		return nil
+	}
+	return fmt.Errorf("usage: chat [save <name>|load <name>]")
+}
+
+// autosaveChat saves the conversation as ai.AutosaveChat, so it can be
+// picked up again after a restart
+func (h *Handler) autosaveChat() {
+	if h.aiClient.HistoryLen() == 0 {
+		return
+	}
+	if err := h.aiClient.SaveHistory(ai.AutosaveChat); err != nil {
+		slog.Warn("conversation not autosaved", "error", err)
+	}
+}
+
+// savedChatNames completes a saved conversation name
+func savedChatNames(string) []string {
+	names, _ := ai.SavedChats()
+	return names
+}
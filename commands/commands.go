@@ -2,16 +2,23 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/chzyer/readline"
 	"github.com/iltempo/interplay/ai"
+	"github.com/iltempo/interplay/device"
+	"github.com/iltempo/interplay/hooks"
 	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/style"
+	"github.com/iltempo/interplay/theme"
 )
 
 // VerboseController allows controlling verbose output
@@ -24,19 +31,213 @@ type VerboseController interface {
 type Handler struct {
 	pattern           *sequence.Pattern
 	verboseController VerboseController
+	out               *output // where commands print, see SetOutput
 	aiClient          *ai.Client
+	macroDepth        int                     // nesting level of running macros
+	clock             Clock                   // playback clock for 'wait' (optional)
+	transport         Transport               // playback transport for 'pause'/'resume' (optional)
+	velCurver         VelocityCurver          // output velocity mapping for 'velcurve' (optional)
+	launcher          Launcher                // starts scenes at the next bar for 'scene launch' (optional)
+	muter             Muter                   // silences playback for 'perform' (optional)
+	looper            Looper                  // plays one bar for 'loop bar' (optional)
+	midiMonitor       MIDIMonitor             // logs MIDI messages for 'monitor' (optional)
+	monitoring        string                  // "console", the log file's path, or "" when not monitoring
+	monitorFile       *os.File                // log file written by 'monitor <file>'
+	ports             PortLister              // MIDI ports for 'ports' (optional)
+	recording         *recorder               // session being recorded, see 'record-session'
+	replayStop        chan struct{}           // stops the 'replay-session' goroutine (nil when not replaying)
+	vars              map[string]string       // script variables set with 'let'
+	savedState        string                  // pattern as last saved/loaded, see IsModified
+	patternName       string                  // name of the last saved/loaded pattern
+	savedModTime      time.Time               // modification time of patternName's file when saved/loaded
+	slots             [slotCount]*patternSlot // patterns kept in memory, see 'slot'
+	slot              int                     // current slot (0-based)
+	watchStop         chan struct{}           // stops the 'watch' goroutine (nil when not watching)
+	hooks             *hooks.Runner           // loaded hook script (optional)
+	device            *device.Profile         // active device profile (optional)
+	ccPersist         bool                    // 'cc' saves global CC values with the pattern
+	execMu            sync.Mutex              // serializes Execute across input sources
+	changeListeners   map[int]func()          // called after Execute changes the pattern
+	nextListenerID    int
+	listenersMu       sync.Mutex
+	readLine          func(prompt string) (string, error) // asks the user a question (nil when not interactive)
+	noFiles           bool                                // refuse commands touching files, see ExecuteNoFiles
+	aiAutoApply       bool                                // apply AI edits without asking
+	undoStack         []*sequence.Pattern                 // snapshots for 'undo'
+	genre             string                              // AI genre preset, see 'genre'
+	recentCommands    []string                            // last commands that changed the pattern, for the AI
+	showAIUsage       bool                                // print tokens and cost after each AI request
+	aiTimeout         time.Duration                       // AI request time limit (0 for the default)
+	aiParams          ai.Params                           // generation parameters for every model, see SetAIParams
+	aiNoCache         bool                                // don't reuse cached AI responses
+	aiAllowed         map[string]bool                     // destructive commands the AI may run, see 'ai-allow'
+	aiMu              sync.Mutex
+	aiCancel          context.CancelFunc  // cancels the AI request in flight (nil when idle)
+	resumeChat        bool                // the next 'ai' session continues a loaded conversation
+	varOriginal       *sequence.Pattern   // pattern the 'ai-vary' variations were made from
+	variations        []*sequence.Pattern // variations to audition, see 'ai-vary'
+	varPlaying        int                 // variation being auditioned (0 for the original)
+	style             *style.Style        // active style preset (optional), see 'style'
+	songStop          chan struct{}       // stops the 'song play' goroutine (nil when no song is playing)
+	globalTempo       bool                // song parts keep the current tempo, see 'tempo-mode'
+	morphStop         chan struct{}       // stops the 'morph' goroutine (nil when not morphing)
+	audition          *audition           // comparison result playing, see 'compare-play'
 }
 
+// maxRecentCommands is how many pattern-changing commands are remembered
+// as context for the AI
+const maxRecentCommands = 10
+
+// errAIUnavailable is returned by AI commands when no model can be reached
+var errAIUnavailable = fmt.Errorf("AI not available. Set ANTHROPIC_API_KEY, OPENAI_API_KEY or GEMINI_API_KEY, or pick a local model with 'model ollama:<name>'")
+
 // New creates a new command handler
 func New(pattern *sequence.Pattern, verboseController VerboseController) *Handler {
 	// Try to initialize AI client (optional)
 	aiClient, _ := ai.NewFromEnv()
 
-	return &Handler{
+	h := &Handler{
 		pattern:           pattern,
 		verboseController: verboseController,
+		out:               &output{},
 		aiClient:          aiClient,
 	}
+	h.MarkSaved("")
+	return h
+}
+
+// SetAIOffline restricts AI mode to local models, so it works without
+// internet access or API costs. model is used if it is local, otherwise
+// ai.DefaultLocalModel.
+func (h *Handler) SetAIOffline(model string) error {
+	if !ai.IsLocal(model) {
+		model = ai.DefaultLocalModel
+	}
+	client, err := ai.NewForModel(model)
+	if err != nil {
+		return err
+	}
+	client.SetOffline(true)
+	h.useAIClient(client)
+	return nil
+}
+
+// useAIClient switches to a new AI client, describing the instrument and
+// genre to it
+func (h *Handler) useAIClient(client *ai.Client) {
+	h.aiClient = client
+	h.setDevice(h.device)
+	h.setStyle(h.style)
+	if err := client.SetGenre(h.genre); err != nil {
+		h.genre = ""
+	}
+	client.SetTimeout(h.aiTimeout)
+	client.SetDefaultParams(h.aiParams)
+	client.SetCache(!h.aiNoCache)
+}
+
+// SetAIParams sets the generation parameters used for every model, unless
+// 'model-config' sets others for the model
+func (h *Handler) SetAIParams(p ai.Params) {
+	h.aiParams = p
+	if h.aiClient != nil {
+		h.aiClient.SetDefaultParams(p)
+	}
+}
+
+// SetAITimeout limits how long each AI request may take (0 for the default)
+func (h *Handler) SetAITimeout(d time.Duration) {
+	h.aiTimeout = d
+	if h.aiClient != nil {
+		h.aiClient.SetTimeout(d)
+	}
+}
+
+// startAIRequest returns a context for an AI request that CancelAI
+// cancels, and a function to call once the request is over
+func (h *Handler) startAIRequest(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	h.aiMu.Lock()
+	h.aiCancel = cancel
+	h.aiMu.Unlock()
+	return ctx, func() {
+		h.aiMu.Lock()
+		h.aiCancel = nil
+		h.aiMu.Unlock()
+		cancel()
+	}
+}
+
+// CancelAI cancels the AI request in flight, e.g. on Ctrl+C.
+// Returns false if there is none.
+func (h *Handler) CancelAI() bool {
+	h.aiMu.Lock()
+	defer h.aiMu.Unlock()
+	if h.aiCancel == nil {
+		return false
+	}
+	h.aiCancel()
+	return true
+}
+
+// SetAICache turns reusing cached AI responses for repeated prompts on or off
+func (h *Handler) SetAICache(on bool) {
+	h.aiNoCache = !on
+	if h.aiClient != nil {
+		h.aiClient.SetCache(on)
+	}
+}
+
+// SetAIAutoApply applies AI edits without asking for confirmation
+func (h *Handler) SetAIAutoApply(on bool) {
+	h.aiAutoApply = on
+}
+
+// SetAIModel selects the model used for AI mode. Any vendor's model can be
+// picked as long as its API key is set (Ollama models need none).
+func (h *Handler) SetAIModel(model string) error {
+	if h.aiClient != nil {
+		return h.aiClient.SetModel(model)
+	}
+	client, err := ai.NewForModel(model)
+	if err != nil {
+		return err
+	}
+	h.useAIClient(client)
+	return nil
+}
+
+// Execute runs a command line from one of several concurrent input sources
+// (prompt, script, socket), one at a time
+func (h *Handler) Execute(cmdLine string) error {
+	return h.Update(func() error {
+		return h.ProcessCommand(cmdLine)
+	})
+}
+
+// ExecuteNoFiles is Execute for clients that mustn't reach the file system:
+// commands reading or writing files or loading code (Command.Files) are
+// refused, also when run from a chain or macro
+func (h *Handler) ExecuteNoFiles(cmdLine string) error {
+	return h.Update(func() error {
+		h.noFiles = true
+		defer func() { h.noFiles = false }()
+		return h.ProcessCommand(cmdLine)
+	})
+}
+
+// Update runs fn serialized with Execute and notifies pattern change
+// listeners if fn changed the pattern. Hook scripts edit the pattern through it.
+func (h *Handler) Update(fn func() error) error {
+	h.execMu.Lock()
+	defer h.execMu.Unlock()
+
+	before := h.liveState()
+	err := fn()
+	if h.liveState() != before {
+		h.notifyPatternChange()
+	}
+	return err
 }
 
 // ProcessCommand parses and executes a single command string
@@ -52,67 +253,87 @@ func (h *Handler) ProcessCommand(cmdLine string) error {
 		return nil
 	}
 
-	cmd := strings.ToLower(parts[0])
-
-	switch cmd {
-	case "set":
-		return h.handleSet(parts)
-	case "rest":
-		return h.handleRest(parts)
-	case "clear":
-		return h.handleClear(parts)
-	case "reset":
-		return h.handleReset(parts)
-	case "tempo":
-		return h.handleTempo(parts)
-	case "velocity":
-		return h.handleVelocity(parts)
-	case "gate":
-		return h.handleGate(parts)
-	case "humanize":
-		return h.handleHumanize(parts)
-	case "swing":
-		return h.handleSwing(parts)
-	case "length":
-		return h.handleLength(parts)
-	case "cc":
-		return h.handleCC(parts)
-	case "cc-step":
-		return h.handleCCStep(parts)
-	case "cc-clear":
-		return h.handleCCClear(parts)
-	case "cc-apply":
-		return h.handleCCApply(parts)
-	case "cc-show":
-		return h.handleCCShow(parts)
-	case "show":
-		return h.handleShow(parts)
-	case "verbose":
-		return h.handleVerbose(parts)
-	case "save":
-		return h.handleSave(parts)
-	case "load":
-		return h.handleLoad(parts)
-	case "list":
-		return h.handleList(parts)
-	case "delete":
-		return h.handleDelete(parts)
-	case "ai":
-		return h.handleAI(parts)
-	case "clear-chat":
-		return h.handleClearChat(parts)
-	case "help":
-		return h.handleHelp(parts)
-	default:
-		return fmt.Errorf("unknown command: %s (type 'help' for available commands)", cmd)
+	command, ok := lookupCommand(parts[0])
+	if ok && command.NoChain {
+		// Semicolons belong to the arguments (e.g., AI prompts, macro bodies)
+		return h.run(command, parts)
+	}
+
+	if strings.Contains(cmdLine, ";") {
+		return h.processChain(cmdLine)
+	}
+
+	if strings.Contains(cmdLine, "$") {
+		expanded, err := h.expandVars(cmdLine)
+		if err != nil {
+			return err
+		}
+		parts = strings.Fields(expanded)
+		if len(parts) == 0 {
+			return nil
+		}
+		command, ok = lookupCommand(parts[0])
+	}
+
+	if !ok {
+		return fmt.Errorf("unknown command: %s (type 'help' for available commands)", strings.ToLower(parts[0]))
+	}
+
+	return h.run(command, parts)
+}
+
+// run executes a command, logging what ran, how long it took, and any error
+func (h *Handler) run(command *Command, parts []string) error {
+	if h.noFiles && command.Files != nil && command.Files(parts) {
+		return fmt.Errorf("'%s' reads or writes files, which this client may not do", command.Name)
+	}
+	before := h.liveState()
+	start := time.Now()
+	err := command.Run(h, parts)
+	duration := time.Since(start)
+
+	line := strings.Join(parts, " ")
+	if err != nil {
+		slog.Warn("command failed", "command", line, "duration", duration, "error", err)
+	} else {
+		slog.Info("command", "command", line, "duration", duration)
+		if h.macroDepth == 0 && h.liveState() != before {
+			h.recordCommand(line)
+		}
+		if h.macroDepth == 0 {
+			h.recordSessionCommand(command, line)
+		}
+	}
+	return err
+}
+
+// recordCommand remembers a command that changed the pattern, as context
+// for the AI
+func (h *Handler) recordCommand(line string) {
+	h.recentCommands = append(h.recentCommands, line)
+	if len(h.recentCommands) > maxRecentCommands {
+		h.recentCommands = h.recentCommands[1:]
+	}
+}
+
+// processChain runs semicolon-separated commands in order, e.g.
+// "tempo 120; swing 40; set 1 C2 vel:120". Every sub-command runs even if an
+// earlier one fails; failures are reported per sub-command.
+func (h *Handler) processChain(cmdLine string) error {
+	var errs []error
+	for _, cmd := range splitCommands(cmdLine) {
+		if err := h.ProcessCommand(cmd); err != nil {
+			errs = append(errs, fmt.Errorf("'%s': %w", cmd, err))
+		}
 	}
+	return errors.Join(errs...)
 }
 
-// handleSet: set <step> <note|rest> [vel:<value>] [gate:<percent>] [dur:<steps>]
+// handleSet: set <step> <note|rest> [vel:<value>] [gate:<percent|ms>] [dur:<steps>] [@<stamp>]
 func (h *Handler) handleSet(parts []string) error {
 	if len(parts) < 3 {
-		return fmt.Errorf("usage: set <step> <note|rest> [vel:<value>] [gate:<percent>] [dur:<steps>]\n" +
-			"e.g., 'set 1 C4' or 'set 1 rest' or 'set 1 C4 vel:120 gate:85 dur:3'")
+		return fmt.Errorf("usage: set <step> <note|rest> [vel:<value>] [gate:<percent|ms>] [dur:<steps>] [@<stamp>]\n" +
+			"e.g., 'set 1 C4' or 'set 1 rest' or 'set 1 C4 vel:120 gate:85 dur:3' or 'set 1 C4 @accent'")
 	}
 
 	stepNum, err := strconv.Atoi(parts[1])
@@ -128,7 +349,7 @@ func (h *Handler) handleSet(parts []string) error {
 		if err != nil {
 			return err
 		}
-		fmt.Printf("Set step %d to rest\n", stepNum)
+		fmt.Fprintf(h.out, "Set step %d to rest\n", stepNum)
 		return nil
 	}
 
@@ -143,11 +364,16 @@ func (h *Handler) handleSet(parts []string) error {
 	// Parse optional parameters
 	var velocity *uint8
 	var gate *int
+	gateMs := false
 	duration := 1 // default
 
-	for i := 3; i < len(parts); i++ {
-		param := parts[i]
+	// A stamp (@name) stands for the parameters it was defined with
+	params, err := expandStamps(parts[3:])
+	if err != nil {
+		return err
+	}
 
+	for _, param := range params {
 		if strings.HasPrefix(param, "vel:") {
 			velStr := strings.TrimPrefix(param, "vel:")
 			velInt, err := strconv.Atoi(velStr)
@@ -161,15 +387,11 @@ func (h *Handler) handleSet(parts []string) error {
 			velocity = &vel
 
 		} else if strings.HasPrefix(param, "gate:") {
-			gateStr := strings.TrimPrefix(param, "gate:")
-			gateInt, err := strconv.Atoi(gateStr)
+			gateInt, ms, err := parseGate(strings.TrimPrefix(param, "gate:"))
 			if err != nil {
-				return fmt.Errorf("invalid gate: %s", gateStr)
-			}
-			if gateInt < 1 || gateInt > 100 {
-				return fmt.Errorf("gate must be 1-100%%, got %d", gateInt)
+				return err
 			}
-			gate = &gateInt
+			gate, gateMs = &gateInt, ms
 
 		} else if strings.HasPrefix(param, "dur:") {
 			durStr := strings.TrimPrefix(param, "dur:")
@@ -201,11 +423,13 @@ func (h *Handler) handleSet(parts []string) error {
 	}
 
 	// Apply gate if specified
-	if gate != nil {
+	if gate != nil && gateMs {
+		err = h.pattern.SetGateMs(stepNum, *gate)
+	} else if gate != nil {
 		err = h.pattern.SetGate(stepNum, *gate)
-		if err != nil {
-			return err
-		}
+	}
+	if err != nil {
+		return err
 	}
 
 	// Build output message
@@ -213,14 +437,21 @@ func (h *Handler) handleSet(parts []string) error {
 	if velocity != nil {
 		msg += fmt.Sprintf(", vel:%d", *velocity)
 	}
-	if gate != nil {
+	if gate != nil && gateMs {
+		msg += fmt.Sprintf(", gate:%dms", *gate)
+	} else if gate != nil {
 		msg += fmt.Sprintf(", gate:%d%%", *gate)
 	}
 	if duration > 1 {
 		msg += fmt.Sprintf(", dur:%d", duration)
 	}
 	msg += ")"
-	fmt.Println(msg)
+	fmt.Fprintln(h.out, msg)
+
+	// A note running past the end of the loop is cut there unless it rings
+	if stepNum+duration-1 > patternLen && h.pattern.GetNoteOffMode() == sequence.NoteOffCut {
+		fmt.Fprintln(h.out, "The note runs past the end of the loop and is cut there; 'noteoff-mode ring' lets it sustain into the next loop")
+	}
 
 	return nil
 }
@@ -241,18 +472,21 @@ func (h *Handler) handleRest(parts []string) error {
 		return err
 	}
 
-	fmt.Printf("Set step %d to rest\n", stepNum)
+	fmt.Fprintf(h.out, "Set step %d to rest\n", stepNum)
 	return nil
 }
 
 // handleClear: clear
 func (h *Handler) handleClear(parts []string) error {
+	if len(parts) == 3 && parts[1] == "bar" {
+		return h.clearBar(parts[2])
+	}
 	if len(parts) != 1 {
-		return fmt.Errorf("usage: clear")
+		return fmt.Errorf("usage: clear or clear bar <n>")
 	}
 
 	h.pattern.Clear()
-	fmt.Println("Cleared all steps")
+	fmt.Fprintln(h.out, "Cleared all steps")
 	return nil
 }
 
@@ -268,17 +502,18 @@ func (h *Handler) handleReset(parts []string) error {
 	// Copy it into the current pattern
 	h.pattern.CopyFrom(defaultPattern)
 
-	fmt.Printf("Reset to default %d-step pattern\n", sequence.DefaultPatternLength)
+	fmt.Fprintf(h.out, "Reset to default %d-step pattern\n", sequence.DefaultPatternLength)
 	return nil
 }
 
 // handleTempo: tempo <bpm>
+// The BPM may be fractional, e.g. 122.5, to match a recording
 func (h *Handler) handleTempo(parts []string) error {
 	if len(parts) != 2 {
-		return fmt.Errorf("usage: tempo <bpm> (e.g., 'tempo 120')")
+		return fmt.Errorf("usage: tempo <bpm> (e.g., 'tempo 120' or 'tempo 122.5')")
 	}
 
-	bpm, err := strconv.Atoi(parts[1])
+	bpm, err := strconv.ParseFloat(parts[1], 64)
 	if err != nil {
 		return fmt.Errorf("invalid BPM: %s", parts[1])
 	}
@@ -288,7 +523,7 @@ func (h *Handler) handleTempo(parts []string) error {
 		return err
 	}
 
-	fmt.Printf("Set tempo to %d BPM\n", bpm)
+	fmt.Fprintf(h.out, "Set tempo to %s BPM\n", sequence.FormatBPM(h.pattern.GetBPM()))
 	return nil
 }
 
@@ -298,7 +533,7 @@ func (h *Handler) handleShow(parts []string) error {
 		return fmt.Errorf("usage: show")
 	}
 
-	fmt.Println(h.pattern.String())
+	fmt.Fprintln(h.out, h.pattern.StringWith(theme.StepLine))
 	return nil
 }
 
@@ -309,9 +544,9 @@ func (h *Handler) handleVerbose(parts []string) error {
 		currentState := h.verboseController.IsVerbose()
 		h.verboseController.SetVerbose(!currentState)
 		if !currentState {
-			fmt.Println("Verbose mode enabled (showing steps)")
+			fmt.Fprintln(h.out, "Verbose mode enabled (showing steps)")
 		} else {
-			fmt.Println("Verbose mode disabled")
+			fmt.Fprintln(h.out, "Verbose mode disabled")
 		}
 		return nil
 	}
@@ -323,10 +558,10 @@ func (h *Handler) handleVerbose(parts []string) error {
 	switch strings.ToLower(parts[1]) {
 	case "on":
 		h.verboseController.SetVerbose(true)
-		fmt.Println("Verbose mode enabled (showing steps)")
+		fmt.Fprintln(h.out, "Verbose mode enabled (showing steps)")
 	case "off":
 		h.verboseController.SetVerbose(false)
-		fmt.Println("Verbose mode disabled")
+		fmt.Fprintln(h.out, "Verbose mode disabled")
 	default:
 		return fmt.Errorf("usage: verbose [on|off]")
 	}
@@ -359,14 +594,15 @@ func (h *Handler) handleVelocity(parts []string) error {
 		return err
 	}
 
-	fmt.Printf("Set step %d velocity to %d\n", stepNum, velocity)
+	fmt.Fprintf(h.out, "Set step %d velocity to %d\n", stepNum, velocity)
 	return nil
 }
 
-// handleGate: gate <step> <percentage>
+// handleGate: gate <step> <percentage|ms>
+// A gate ending in "ms" is absolute: the note lasts that long at any tempo
 func (h *Handler) handleGate(parts []string) error {
 	if len(parts) != 3 {
-		return fmt.Errorf("usage: gate <step> <percentage> (e.g., 'gate 1 50')")
+		return fmt.Errorf("usage: gate <step> <percentage|ms> (e.g., 'gate 1 50' or 'gate 1 30ms')")
 	}
 
 	stepNum, err := strconv.Atoi(parts[1])
@@ -374,9 +610,17 @@ func (h *Handler) handleGate(parts []string) error {
 		return fmt.Errorf("invalid step number: %s", parts[1])
 	}
 
-	gate, err := strconv.Atoi(parts[2])
+	gate, ms, err := parseGate(parts[2])
 	if err != nil {
-		return fmt.Errorf("invalid gate: %s", parts[2])
+		return err
+	}
+
+	if ms {
+		if err := h.pattern.SetGateMs(stepNum, gate); err != nil {
+			return err
+		}
+		fmt.Fprintf(h.out, "Set step %d gate to %dms\n", stepNum, gate)
+		return nil
 	}
 
 	err = h.pattern.SetGate(stepNum, gate)
@@ -384,10 +628,26 @@ func (h *Handler) handleGate(parts []string) error {
 		return err
 	}
 
-	fmt.Printf("Set step %d gate to %d%%\n", stepNum, gate)
+	fmt.Fprintf(h.out, "Set step %d gate to %d%%\n", stepNum, gate)
 	return nil
 }
 
+// parseGate reads a gate percentage ("50", "50%") or milliseconds ("30ms")
+func parseGate(s string) (gate int, ms bool, err error) {
+	value, ms := strings.CutSuffix(strings.ToLower(s), "ms")
+	gate, err = strconv.Atoi(strings.TrimSuffix(value, "%"))
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid gate: %s (e.g., '50' for 50%% or '30ms')", s)
+	}
+	switch {
+	case ms && (gate < 1 || gate > sequence.MaxGateMs):
+		return 0, false, fmt.Errorf("gate must be 1-%dms, got %d", sequence.MaxGateMs, gate)
+	case !ms && (gate < 1 || gate > 100):
+		return 0, false, fmt.Errorf("gate must be 1-100%%, got %d", gate)
+	}
+	return gate, ms, nil
+}
+
 // handleHumanize: humanize <type> <amount>
 // type: velocity, timing, gate
 // amount: 0-64 for velocity, 0-50 for timing (ms), 0-50 for gate
@@ -395,12 +655,12 @@ func (h *Handler) handleHumanize(parts []string) error {
 	if len(parts) == 1 {
 		// Show current humanization settings
 		humanization := h.pattern.GetHumanization()
-		fmt.Printf("Humanization settings:\n")
-		fmt.Printf("  velocity: ±%d (0-64)\n", humanization.VelocityRange)
-		fmt.Printf("  timing:   ±%dms (0-50)\n", humanization.TimingMs)
-		fmt.Printf("  gate:     ±%d%% (0-50)\n", humanization.GateRange)
+		fmt.Fprintf(h.out, "Humanization settings:\n")
+		fmt.Fprintf(h.out, "  velocity: ±%d (0-64)\n", humanization.VelocityRange)
+		fmt.Fprintf(h.out, "  timing:   ±%dms (0-50)\n", humanization.TimingMs)
+		fmt.Fprintf(h.out, "  gate:     ±%d%% (0-50)\n", humanization.GateRange)
 		if humanization.VelocityRange == 0 && humanization.TimingMs == 0 && humanization.GateRange == 0 {
-			fmt.Println("  (humanization is OFF)")
+			fmt.Fprintln(h.out, "  (humanization is OFF)")
 		}
 		return nil
 	}
@@ -424,9 +684,9 @@ func (h *Handler) handleHumanize(parts []string) error {
 			return err
 		}
 		if amount == 0 {
-			fmt.Println("Velocity humanization OFF")
+			fmt.Fprintln(h.out, "Velocity humanization OFF")
 		} else {
-			fmt.Printf("Velocity humanization set to ±%d\n", amount)
+			fmt.Fprintf(h.out, "Velocity humanization set to ±%d\n", amount)
 		}
 
 	case "timing", "time":
@@ -435,9 +695,9 @@ func (h *Handler) handleHumanize(parts []string) error {
 			return err
 		}
 		if amount == 0 {
-			fmt.Println("Timing humanization OFF")
+			fmt.Fprintln(h.out, "Timing humanization OFF")
 		} else {
-			fmt.Printf("Timing humanization set to ±%dms\n", amount)
+			fmt.Fprintf(h.out, "Timing humanization set to ±%dms\n", amount)
 		}
 
 	case "gate":
@@ -446,9 +706,9 @@ func (h *Handler) handleHumanize(parts []string) error {
 			return err
 		}
 		if amount == 0 {
-			fmt.Println("Gate humanization OFF")
+			fmt.Fprintln(h.out, "Gate humanization OFF")
 		} else {
-			fmt.Printf("Gate humanization set to ±%d%%\n", amount)
+			fmt.Fprintf(h.out, "Gate humanization set to ±%d%%\n", amount)
 		}
 
 	default:
@@ -458,30 +718,47 @@ func (h *Handler) handleHumanize(parts []string) error {
 	return nil
 }
 
-// handleSwing: swing <percent>
-// percent: 0-75%, where 0 = straight, 50 = triplet swing, 66 = hard swing
+// handleSwing: swing [<percent> [8th|16th]] | swing exclude|include <step>...
+// percent: 0-75%, where 0 = straight, 50 = triplet swing, 66 = hard swing.
+// Swing delays the second 16th of each pair, or the off-beat 8th with 8th;
+// excluded steps stay on the grid (e.g. an 8th-note bassline under 16th swing).
 func (h *Handler) handleSwing(parts []string) error {
 	if len(parts) == 1 {
 		// Show current swing setting
 		swing := h.pattern.GetSwing()
 		if swing == 0 {
-			fmt.Println("Swing: OFF (straight timing)")
+			fmt.Fprintln(h.out, "Swing: OFF (straight timing)")
 		} else {
-			fmt.Printf("Swing: %d%%", swing)
+			fmt.Fprintf(h.out, "Swing: %d%% on %s", swing, swingUnitName(h.pattern.GetSwingUnit()))
 			if swing >= 48 && swing <= 52 {
-				fmt.Println(" (triplet swing)")
+				fmt.Fprintln(h.out, " (triplet swing)")
 			} else if swing >= 64 && swing <= 68 {
-				fmt.Println(" (hard swing)")
+				fmt.Fprintln(h.out, " (hard swing)")
 			} else {
-				fmt.Println()
+				fmt.Fprintln(h.out)
 			}
 		}
+		var straight []int
+		h.pattern.ForEachStep(func(stepNum int, step sequence.Step) {
+			if step.Straight {
+				straight = append(straight, stepNum)
+			}
+		})
+		if len(straight) > 0 {
+			fmt.Fprintf(h.out, "Excluded from swing: step(s) %s\n", joinInts(straight))
+		}
 		return nil
 	}
 
-	if len(parts) != 2 {
-		return fmt.Errorf("usage: swing <percent> (e.g., 'swing 50' for triplet swing)\n" +
+	switch strings.ToLower(parts[1]) {
+	case "exclude", "include":
+		return h.setStraight(parts)
+	}
+
+	if len(parts) > 3 {
+		return fmt.Errorf("usage: swing <percent> [8th|16th] (e.g., 'swing 50' for triplet swing, 'swing 55 8th')\n" +
 			"0 = straight, 50 = triplet swing, 66 = hard swing\n" +
+			"or: swing exclude|include <step>... (keep steps on the grid)\n" +
 			"or: swing (to show current setting)")
 	}
 
@@ -489,48 +766,174 @@ func (h *Handler) handleSwing(parts []string) error {
 	if err != nil {
 		return fmt.Errorf("invalid swing percentage: %s", parts[1])
 	}
+	unit := h.pattern.GetSwingUnit()
+	if len(parts) == 3 {
+		switch strings.ToLower(parts[2]) {
+		case "16th", "16":
+			unit = 1
+		case "8th", "8":
+			unit = 2
+		default:
+			return fmt.Errorf("invalid swing subdivision: %s (use 8th or 16th)", parts[2])
+		}
+	}
 
 	err = h.pattern.SetSwing(percent)
 	if err != nil {
 		return err
 	}
+	if err := h.pattern.SetSwingUnit(unit); err != nil {
+		return err
+	}
 
 	if percent == 0 {
-		fmt.Println("Swing OFF - straight timing")
+		fmt.Fprintln(h.out, "Swing OFF - straight timing")
 	} else {
-		fmt.Printf("Swing set to %d%%", percent)
+		fmt.Fprintf(h.out, "Swing set to %d%% on %s", percent, swingUnitName(unit))
 		if percent >= 48 && percent <= 52 {
-			fmt.Println(" (triplet swing - classic feel)")
+			fmt.Fprintln(h.out, " (triplet swing - classic feel)")
 		} else if percent >= 64 && percent <= 68 {
-			fmt.Println(" (hard swing - laid back groove)")
+			fmt.Fprintln(h.out, " (hard swing - laid back groove)")
 		} else {
-			fmt.Println()
+			fmt.Fprintln(h.out)
+		}
+	}
+
+	return nil
+}
+
+// setStraight handles 'swing exclude <step>...' and 'swing include
+// <step>...|all'
+func (h *Handler) setStraight(parts []string) error {
+	exclude := strings.ToLower(parts[1]) == "exclude"
+	if len(parts) < 3 {
+		return fmt.Errorf("usage: swing exclude <step>... or swing include <step>...|all (e.g., 'swing exclude 3 7')")
+	}
+
+	var steps []int
+	if !exclude && len(parts) == 3 && strings.ToLower(parts[2]) == "all" {
+		h.pattern.ForEachStep(func(stepNum int, step sequence.Step) {
+			if step.Straight {
+				steps = append(steps, stepNum)
+			}
+		})
+	} else {
+		for _, arg := range parts[2:] {
+			stepNum, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid step number: %s", arg)
+			}
+			steps = append(steps, stepNum)
+		}
+	}
+
+	for _, stepNum := range steps {
+		if err := h.pattern.SetStraight(stepNum, exclude); err != nil {
+			return err
 		}
 	}
 
+	switch {
+	case len(steps) == 0:
+		fmt.Fprintln(h.out, "No steps excluded from swing")
+	case exclude:
+		fmt.Fprintf(h.out, "Step(s) %s stay on the grid\n", joinInts(steps))
+	default:
+		fmt.Fprintf(h.out, "Step(s) %s swing again\n", joinInts(steps))
+	}
 	return nil
 }
 
-// handleLength: length <steps>
+// swingUnitName names what swing delays
+func swingUnitName(unit int) string {
+	if unit == 2 {
+		return "8ths"
+	}
+	return "16ths"
+}
+
+// handleLength: length <steps>|<n>bars [--keep-tail|--fold]
+// Bars follow the pattern's meter: 16 steps in 4/4 with 16ths, 12 in 6/8.
+// Shortening keeps the first steps, the last ones with --keep-tail, or
+// folds the notes past the end onto the rests they wrap around to with
+// --fold. Notes that would be lost are confirmed at the prompt and reported
+// elsewhere.
 func (h *Handler) handleLength(parts []string) error {
-	if len(parts) != 2 {
-		return fmt.Errorf("usage: length <steps> (e.g., 'length 32')")
+	mode := sequence.ResizeTruncate
+	var args []string
+	for _, part := range parts[1:] {
+		switch part {
+		case "--keep-tail":
+			mode = sequence.ResizeKeepTail
+		case "--fold":
+			mode = sequence.ResizeFold
+		default:
+			args = append(args, part)
+		}
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: length <steps>|<n>bars [--keep-tail|--fold] (e.g., 'length 32' or 'length 2bars --fold')")
 	}
 
-	length, err := strconv.Atoi(parts[1])
+	stepsPerBar := h.pattern.StepsPerBar()
+	length, err := parseLength(args[0], stepsPerBar)
 	if err != nil {
-		return fmt.Errorf("invalid length: %s", parts[1])
+		return err
+	}
+	if length <= 0 {
+		return fmt.Errorf("length must be positive")
 	}
 
-	err = h.pattern.Resize(length)
-	if err != nil {
+	steps, lost := sequence.ResizeSteps(h.pattern.Snapshot(), length, mode)
+	dropped := make([]string, len(lost))
+	for i, stepNum := range lost {
+		dropped[i] = strconv.Itoa(stepNum)
+	}
+	if len(lost) > 0 && h.readLine != nil {
+		answer, err := h.readLine(fmt.Sprintf("This removes %d notes (steps %s). Continue? (y/n) ", len(lost), strings.Join(dropped, ", ")))
+		if answer = strings.ToLower(strings.TrimSpace(answer)); err != nil || (answer != "y" && answer != "yes") {
+			fmt.Fprintln(h.out, "Length unchanged ('--keep-tail' keeps the last steps, '--fold' folds notes into the shorter pattern)")
+			return nil
+		}
+	}
+	if err := h.pattern.SetSteps(steps); err != nil {
 		return err
 	}
 
-	fmt.Printf("Pattern length set to %d steps\n", length)
+	if length%stepsPerBar == 0 {
+		fmt.Fprintf(h.out, "Pattern length set to %d steps (%d bars)\n", length, length/stepsPerBar)
+	} else {
+		fmt.Fprintf(h.out, "Pattern length set to %d steps\n", length)
+	}
+	if len(lost) > 0 {
+		fmt.Fprintln(h.out, theme.Warning(fmt.Sprintf("⚠️  Warning: %d notes were removed (steps %s); 'undo' brings them back.",
+			len(lost), strings.Join(dropped, ", "))))
+	}
 	return nil
 }
 
+// parseLength reads a pattern length in steps, or in bars of stepsPerBar
+// steps as "2bars" or "1bar"
+func parseLength(s string, stepsPerBar int) (int, error) {
+	bars, ok := strings.CutSuffix(strings.ToLower(s), "bars")
+	if !ok {
+		bars, ok = strings.CutSuffix(strings.ToLower(s), "bar")
+	}
+	if ok {
+		n, err := strconv.Atoi(bars)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid length: %s (e.g., '2bars')", s)
+		}
+		return n * stepsPerBar, nil
+	}
+
+	length, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid length: %s", s)
+	}
+	return length, nil
+}
+
 // handleSave: save <name>
 func (h *Handler) handleSave(parts []string) error {
 	if len(parts) < 2 {
@@ -541,30 +944,32 @@ func (h *Handler) handleSave(parts []string) error {
 	name := strings.Join(parts[1:], " ")
 
 	// Check if pattern file already exists (warn about overwrite)
-	// Note: We replicate sanitization logic here since it's not exported
-	sanitized := strings.ReplaceAll(name, " ", "_")
-	filename := sanitized + ".json"
-	patternPath := filepath.Join(sequence.PatternsDir, filename)
-	if _, err := os.Stat(patternPath); err == nil {
-		fmt.Printf("⚠️  Warning: Pattern '%s' already exists and will be overwritten.\n", name)
+	if _, err := os.Stat(sequence.Path(name)); err == nil {
+		fmt.Fprintln(h.out, theme.Warning(fmt.Sprintf("⚠️  Warning: Pattern '%s' already exists and will be overwritten.", name)))
 	}
 
-	// Warn if global CC values exist (they won't be saved)
+	// Warn if transient global CC values exist (they won't be saved)
 	globalCC := h.pattern.GetAllGlobalCC()
+	for ccNum := range globalCC {
+		if h.pattern.IsGlobalCCSaved(ccNum) {
+			delete(globalCC, ccNum)
+		}
+	}
 	if len(globalCC) > 0 {
-		fmt.Println("⚠️  Warning: Global CC values will not be saved (they are transient).")
-		fmt.Print("   Affected CC numbers: ")
+		fmt.Fprintln(h.out, theme.Warning("⚠️  Warning: Global CC values will not be saved (they are transient)."))
+		fmt.Fprint(h.out, "   Affected CC numbers: ")
 		first := true
 		for ccNum := range globalCC {
 			if !first {
-				fmt.Print(", ")
+				fmt.Fprint(h.out, ", ")
 			}
-			fmt.Printf("CC#%d", ccNum)
+			fmt.Fprintf(h.out, "CC#%d", ccNum)
 			first = false
 		}
-		fmt.Println()
-		fmt.Println("   Use 'cc-apply <cc-number>' to convert global CC to per-step automation before saving.")
-		fmt.Println()
+		fmt.Fprintln(h.out)
+		fmt.Fprintln(h.out, "   Use 'cc <cc-number> <value> --save' to save them as pattern defaults, or")
+		fmt.Fprintln(h.out, "   'cc-apply <cc-number>' to convert global CC to per-step automation before saving.")
+		fmt.Fprintln(h.out)
 	}
 
 	err := h.pattern.Save(name)
@@ -572,7 +977,8 @@ func (h *Handler) handleSave(parts []string) error {
 		return fmt.Errorf("failed to save pattern: %w", err)
 	}
 
-	fmt.Printf("Saved pattern '%s'\n", name)
+	h.MarkSaved(name)
+	fmt.Fprintf(h.out, "Saved pattern '%s'\n", name)
 	return nil
 }
 
@@ -592,32 +998,12 @@ func (h *Handler) handleLoad(parts []string) error {
 
 	// Copy loaded pattern data into current pattern
 	h.pattern.CopyFrom(loadedPattern)
-
-	fmt.Printf("Loaded pattern '%s' (Tempo: %d BPM, Length: %d steps)\n", name, loadedPattern.BPM, loadedPattern.Length())
-	return nil
-}
-
-// handleList: list
-func (h *Handler) handleList(parts []string) error {
-	if len(parts) != 1 {
-		return fmt.Errorf("usage: list")
-	}
-
-	patterns, err := sequence.List()
-	if err != nil {
-		return fmt.Errorf("failed to list patterns: %w", err)
-	}
-
-	if len(patterns) == 0 {
-		fmt.Println("No saved patterns found")
-		return nil
-	}
-
-	fmt.Printf("Saved patterns (%d):\n", len(patterns))
-	for _, name := range patterns {
-		fmt.Printf("  - %s\n", name)
+	h.MarkSaved(name)
+	if h.hooks != nil {
+		h.hooks.PatternLoaded(name)
 	}
 
+	fmt.Fprintf(h.out, "Loaded pattern '%s' (Tempo: %s BPM, Length: %d steps)\n", name, sequence.FormatBPM(loadedPattern.BPM), loadedPattern.Length())
 	return nil
 }
 
@@ -631,22 +1017,29 @@ func (h *Handler) handleDelete(parts []string) error {
 	name := strings.Join(parts[1:], " ")
 
 	// Warn about destructive operation
-	fmt.Printf("⚠️  Warning: This will permanently delete pattern '%s'.\n", name)
+	fmt.Fprintln(h.out, theme.Warning(fmt.Sprintf("⚠️  Warning: This will permanently delete pattern '%s'.", name)))
 
 	err := sequence.Delete(name)
 	if err != nil {
 		return fmt.Errorf("failed to delete pattern: %w", err)
 	}
 
-	fmt.Printf("Deleted pattern '%s'\n", name)
+	fmt.Fprintf(h.out, "Deleted pattern '%s'\n", name)
 	return nil
 }
 
 // handleAI: ai [prompt] - execute AI prompt inline or enter interactive session
 func (h *Handler) handleAI(parts []string) error {
-	// Check if AI client is available
+	if len(parts) >= 2 && parts[1] == "usage" {
+		return h.handleAIUsage(parts[1:])
+	}
+
+	// Without a model, simple requests are still answered by local rules
 	if h.aiClient == nil {
-		return fmt.Errorf("AI not available. Set ANTHROPIC_API_KEY environment variable to enable AI features")
+		if len(parts) == 1 {
+			return errAIUnavailable
+		}
+		return h.handleAILocal(strings.Join(parts[1:], " "))
 	}
 
 	// Two modes:
@@ -654,8 +1047,9 @@ func (h *Handler) handleAI(parts []string) error {
 	// 2. "ai <prompt>" (with args) - execute inline (for batch scripts)
 
 	if len(parts) == 1 {
-		// Mode 1: Interactive session
-		return h.handleAIInteractive()
+		// Mode 1: Interactive session. It reads from the terminal, so the
+		// prompt runs it (see ReadLoop); other sources would block on it.
+		return fmt.Errorf("'ai' without a request opens a session and only works at the interactive prompt; use 'ai <request>'")
 	}
 
 	// Mode 2: Inline execution
@@ -664,16 +1058,73 @@ func (h *Handler) handleAI(parts []string) error {
 	return h.handleAIInline(prompt)
 }
 
-// handleAIInteractive enters an interactive AI session with readline
-func (h *Handler) handleAIInteractive() error {
-	// Clear any previous conversation history to start fresh
-	h.aiClient.ClearHistory()
+// handleAIUsage: ai usage [on|off] - summarize token usage and cost, or
+// toggle showing it after each request
+func (h *Handler) handleAIUsage(parts []string) error {
+	if len(parts) == 2 {
+		switch parts[1] {
+		case "on":
+			h.showAIUsage = true
+			fmt.Fprintln(h.out, "Showing AI usage after each request")
+		case "off":
+			h.showAIUsage = false
+			fmt.Fprintln(h.out, "AI usage display off")
+		default:
+			return fmt.Errorf("usage: ai usage [on|off]")
+		}
+		return nil
+	}
+	if len(parts) > 2 {
+		return fmt.Errorf("usage: ai usage [on|off]")
+	}
+
+	if h.aiClient != nil {
+		fmt.Fprintln(h.out, "This session:")
+		printUsage(h.out, h.aiClient.SessionUsage())
+	}
+	total, err := ai.LoadUsage()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(h.out, "All sessions (%s):\n", ai.UsageFile)
+	printUsage(h.out, total)
+	return nil
+}
+
+// printUsage lists usage per model with a total
+func printUsage(w io.Writer, usage map[string]ai.Usage) {
+	if len(usage) == 0 {
+		fmt.Fprintln(w, "  no requests")
+		return
+	}
+	var total ai.Usage
+	for _, model := range ai.UsageModels(usage) {
+		u := usage[model]
+		total.Add(u)
+		fmt.Fprintf(w, "  %-28s %3d requests, %s\n", model, u.Requests, u)
+	}
+	if len(usage) > 1 {
+		fmt.Fprintf(w, "  %-28s %3d requests, %s\n", "total", total.Requests, total)
+	}
+}
+
+// aiSession runs an interactive AI session with readline. Like ReadLoop it
+// runs outside Update, running each input through it, so other input
+// sources aren't held up while the session waits for the user.
+func (h *Handler) aiSession() error {
+	// Start fresh, unless a saved conversation was just loaded
+	if h.resumeChat {
+		fmt.Fprintf(h.out, "Continuing the conversation (%d messages).\n", h.aiClient.HistoryLen())
+	} else {
+		h.aiClient.ClearHistory()
+	}
+	h.resumeChat = false
 
-	fmt.Println("Entering AI session. Commands work directly. Type 'exit' to return to command mode.")
-	fmt.Println()
+	fmt.Fprintln(h.out, "Entering AI session. Commands work directly. Type 'exit' to return to command mode.")
+	fmt.Fprintln(h.out)
 
 	// Create readline for AI session
-	rl, err := readline.New("AI> ")
+	rl, err := readline.NewEx(h.readlineConfig("AI> "))
 	if err != nil {
 		return fmt.Errorf("failed to initialize readline: %w", err)
 	}
@@ -685,7 +1136,7 @@ func (h *Handler) handleAIInteractive() error {
 		// Read user input
 		input, err := rl.Readline()
 		if err != nil { // io.EOF or other error
-			fmt.Println("\nExiting AI session.")
+			fmt.Fprintln(h.out, "\nExiting AI session.")
 			return nil
 		}
 
@@ -693,30 +1144,38 @@ func (h *Handler) handleAIInteractive() error {
 
 		// Check for exit command
 		if strings.ToLower(input) == "exit" {
-			fmt.Println("Exiting AI session.")
+			fmt.Fprintln(h.out, "Exiting AI session.")
 			return nil
 		}
 
 		// Empty line: show pattern
 		if input == "" {
-			fmt.Println(h.pattern.String())
+			fmt.Fprintln(h.out, h.pattern.StringWith(theme.StepLine))
 			continue
 		}
 
-		// Check if input is a known command - if so, execute it directly without AI
-		if h.isKnownCommand(input) {
-			if err := h.ProcessCommand(input); err != nil {
-				fmt.Printf("Error: %v\n", err)
+		// Known commands run directly without AI, anything else goes to
+		// the AI; confirmation prompts read from the session's line editor
+		known := h.isKnownCommand(input)
+		err = h.Update(func() error {
+			h.readLine = promptLine(rl)
+			defer func() { h.readLine = nil }()
+			if known {
+				return h.ProcessCommand(input)
+			}
+			return h.executeAIRequest(ctx, input)
+		})
+		if known {
+			if err != nil {
+				fmt.Fprintln(h.out, theme.Error(fmt.Sprintf("Error: %v", err)))
 			}
 			continue
 		}
-
-		// Not a known command - send to AI
-		if err := h.executeAIRequest(ctx, input); err != nil {
-			fmt.Printf("AI error: %v\n", err)
+		if err != nil {
+			fmt.Fprintln(h.out, theme.Error(fmt.Sprintf("AI error: %v", err)))
 		}
 
-		fmt.Println()
+		fmt.Fprintln(h.out)
 	}
 }
 
@@ -726,30 +1185,169 @@ func (h *Handler) handleAIInline(prompt string) error {
 	return h.executeAIRequest(ctx, prompt)
 }
 
-// executeAIRequest sends a prompt to AI and executes the response
+// executeAIRequest sends a prompt to AI, printing the reply as it streams.
+// The model's edits are made on a copy of the pattern and only applied once
+// confirmed, see applyAIEdits. CancelAI stops the request.
 func (h *Handler) executeAIRequest(ctx context.Context, prompt string) error {
-	// Send the entire pattern object to the AI session
-	response, err := h.aiClient.Session(ctx, prompt, h.pattern)
+	ctx, done := h.startAIRequest(ctx)
+	defer done()
+
+	preview := h.previewHandler()
+	var proposed []string
+	h.aiClient.SetRecentCommands(h.recentCommands)
+	fmt.Fprintln(h.out)
+	response, err := h.aiClient.SessionStream(ctx, prompt, preview.pattern, ai.StreamHandler{
+		Text: func(text string) {
+			fmt.Fprint(h.out, theme.AI(text))
+		},
+		Tool: func(call ai.ToolCall) (string, error) {
+			result, err := preview.runAITool(call)
+			if err == nil {
+				parts, _ := call.Command()
+				proposed = append(proposed, strings.Join(parts, " "))
+			}
+			return result, err
+		},
+	})
+	fmt.Fprintln(h.out)
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(h.out, theme.Warning("AI request cancelled"))
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	h.autosaveChat()
+	if h.showAIUsage {
+		fmt.Fprintln(h.out, theme.Dim(fmt.Sprintf("  [%s]", response.Usage)))
+	}
+	if len(proposed) > 0 {
+		h.applyAIEdits(preview, proposed)
+	}
+	return nil
+}
 
-	// Print AI response (clean up [EXECUTE] blocks for display)
-	displayMessage := cleanExecuteBlocks(response.Message)
-	fmt.Printf("\n%s\n", displayMessage)
+// handleAICritique: ai-critique - review the pattern without changing it
+func (h *Handler) handleAICritique(parts []string) error {
+	if h.aiClient == nil {
+		return errAIUnavailable
+	}
+	if len(parts) != 1 {
+		return fmt.Errorf("usage: ai-critique")
+	}
+
+	ctx, done := h.startAIRequest(context.Background())
+	defer done()
+	h.aiClient.SetRecentCommands(h.recentCommands)
+	fmt.Fprintln(h.out)
+	response, err := h.aiClient.Critique(ctx, h.pattern, func(text string) {
+		fmt.Fprint(h.out, theme.AI(text))
+	})
+	fmt.Fprintln(h.out)
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(h.out, theme.Warning("AI request cancelled"))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if h.showAIUsage {
+		fmt.Fprintln(h.out, theme.Dim(fmt.Sprintf("  [%s]", response.Usage)))
+	}
+	h.autosaveChat()
+	return nil
+}
+
+// previewHandler returns a handler editing a copy of the pattern
+func (h *Handler) previewHandler() *Handler {
+	return &Handler{
+		pattern:           h.pattern.Clone(),
+		verboseController: h.verboseController,
+		out:               h.out,
+		device:            h.device,
+		ccPersist:         h.ccPersist,
+		aiAllowed:         h.aiAllowed,
+	}
+}
 
-	// Execute any commands
-	if len(response.Commands) > 0 {
-		fmt.Printf("\nExecuting %d command(s):\n", len(response.Commands))
-		for _, cmd := range response.Commands {
-			fmt.Printf("  > %s\n", cmd)
-			if err := h.ProcessCommand(cmd); err != nil {
-				fmt.Printf("  Error: %v\n", err)
+// applyAIEdits shows what the AI's commands change and asks whether to
+// apply them. 'edit' lets the user keep, drop or rewrite each command. An
+// applied edit can be reverted with 'undo'. Without a terminal to ask on,
+// or with auto-apply on, the edits are applied straight away.
+func (h *Handler) applyAIEdits(preview *Handler, proposed []string) {
+	for {
+		fmt.Fprintln(h.out, "Proposed changes:")
+		printDiff(h.out, h.pattern, preview.pattern)
+
+		answer := "y"
+		if !h.aiAutoApply && h.readLine != nil {
+			var err error
+			if answer, err = h.readLine("Apply? (y/n/edit) "); err != nil {
+				answer = "n"
 			}
 		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			h.pushUndo()
+			h.pattern.CopyFrom(preview.pattern)
+			for _, cmd := range proposed {
+				h.recordCommand(cmd)
+			}
+			fmt.Fprintln(h.out, "Applied ('undo' to revert)")
+			return
+		case "e", "edit":
+			proposed = h.editAICommands(proposed)
+			preview = h.previewHandler()
+			for _, cmd := range proposed {
+				if err := preview.ProcessCommand(cmd); err != nil {
+					fmt.Fprintln(h.out, theme.Error(fmt.Sprintf("  %s: %v", cmd, err)))
+				}
+			}
+		default:
+			fmt.Fprintln(h.out, "Discarded")
+			return
+		}
 	}
+}
 
-	return nil
+// editAICommands asks about each proposed command: Enter keeps it, '-'
+// drops it, anything else replaces it
+func (h *Handler) editAICommands(proposed []string) []string {
+	fmt.Fprintln(h.out, "Enter keeps a command, '-' drops it, or type a replacement.")
+	var edited []string
+	for _, cmd := range proposed {
+		answer, err := h.readLine(fmt.Sprintf("  %s → ", cmd))
+		if err != nil {
+			return proposed
+		}
+		switch answer = strings.TrimSpace(answer); answer {
+		case "":
+			edited = append(edited, cmd)
+		case "-":
+		default:
+			edited = append(edited, answer)
+		}
+	}
+	return edited
+}
+
+// runAITool runs a tool call from an AI session through the matching
+// command's handler, so the model's edits are validated exactly like typed
+// commands, and destructive ones are refused unless allowed. The error, if
+// any, is reported back to the model.
+func (h *Handler) runAITool(call ai.ToolCall) (string, error) {
+	parts, err := call.Command()
+	if err != nil {
+		fmt.Fprintln(h.out, theme.Error(fmt.Sprintf("\n  Error: %v", err)))
+		return "", err
+	}
+	fmt.Fprintf(h.out, "\n  > %s\n", strings.Join(parts, " "))
+	if err := h.runAICommand(parts); err != nil {
+		fmt.Fprintln(h.out, theme.Error(fmt.Sprintf("  Error: %v", err)))
+		return "", err
+	}
+	return "ok", nil
 }
 
 // isKnownCommand checks if the input starts with a known command
@@ -759,52 +1357,186 @@ func (h *Handler) isKnownCommand(input string) bool {
 		return false
 	}
 
-	cmd := strings.ToLower(parts[0])
-	knownCommands := []string{
-		"set", "rest", "clear", "reset", "tempo", "velocity", "gate", "length",
-		"humanize", "swing",
-		"cc", "cc-step", "cc-clear", "cc-apply", "cc-show",
-		"show", "verbose", "save", "load", "list", "delete",
-		"clear-chat", "help", "quit",
+	command, ok := lookupCommand(parts[0])
+	if ok && command.Name == "ai" {
+		// Nested AI sessions make no sense; treat as natural language
+		return len(parts) > 1 && parts[1] == "usage"
+	}
+	if !ok {
+		return false
 	}
 
-	for _, known := range knownCommands {
-		if cmd == known {
-			return true
+	return true
+}
+
+// handleModel: model [name] - show or switch the AI model
+func (h *Handler) handleModel(parts []string) error {
+	if len(parts) > 2 {
+		return fmt.Errorf("usage: model [name]")
+	}
+	if len(parts) == 1 {
+		if h.aiClient == nil {
+			return errAIUnavailable
 		}
+	} else if err := h.SetAIModel(parts[1]); err != nil {
+		return err
 	}
 
-	return false
+	provider := h.aiClient.Provider()
+	if h.aiClient.Offline() {
+		provider += ", offline"
+	}
+	fmt.Fprintf(h.out, "AI model: %s (%s)\n", h.aiClient.Model(), provider)
+	return nil
 }
 
-// cleanExecuteBlocks removes [EXECUTE]...[/EXECUTE] blocks from display
-func cleanExecuteBlocks(text string) string {
-	executeStart := "[EXECUTE]"
-	executeEnd := "[/EXECUTE]"
+// handleModelConfig: model-config [temperature <t|default>] [max-tokens <n|default>] [thinking <tokens|off|default>] | model-config reset
+// Sets generation parameters for the current model; they are kept across sessions
+func (h *Handler) handleModelConfig(parts []string) error {
+	if h.aiClient == nil {
+		return errAIUnavailable
+	}
+	usage := fmt.Errorf("usage: model-config [temperature <0-2|default>] [max-tokens <n|default>] [thinking <tokens|off|default>] or model-config reset")
 
-	for {
-		startIdx := strings.Index(text, executeStart)
-		if startIdx == -1 {
-			break
+	if len(parts) == 2 && parts[1] == "reset" {
+		if err := h.aiClient.SetModelParams(ai.Params{}); err != nil {
+			return err
+		}
+	} else if len(parts) > 1 {
+		if len(parts)%2 != 1 {
+			return usage
+		}
+		p, err := h.aiClient.SavedParams()
+		if err != nil {
+			return err
 		}
+		for i := 1; i < len(parts); i += 2 {
+			name, value := strings.ToLower(parts[i]), strings.ToLower(parts[i+1])
+			switch name {
+			case "temperature":
+				p.Temperature = nil
+				if value != "default" {
+					t, err := strconv.ParseFloat(value, 64)
+					if err != nil {
+						return fmt.Errorf("invalid temperature: %s", parts[i+1])
+					}
+					p.Temperature = &t
+				}
+			case "max-tokens":
+				p.MaxTokens = 0
+				if value != "default" {
+					n, err := strconv.Atoi(value)
+					if err != nil || n < 1 {
+						return fmt.Errorf("invalid max tokens: %s (must be a positive number)", parts[i+1])
+					}
+					p.MaxTokens = n
+				}
+			case "thinking":
+				switch value {
+				case "default":
+					p.Thinking = 0
+				case "off", "0":
+					p.Thinking = ai.ThinkingOff
+				default:
+					n, err := strconv.Atoi(value)
+					if err != nil {
+						return fmt.Errorf("invalid thinking budget: %s (tokens, or 'off')", parts[i+1])
+					}
+					p.Thinking = n
+				}
+			default:
+				return usage
+			}
+		}
+		if err := h.aiClient.SetModelParams(p); err != nil {
+			return err
+		}
+	}
 
-		endIdx := strings.Index(text[startIdx:], executeEnd)
-		if endIdx == -1 {
-			break
+	params, err := h.aiClient.ModelParams()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(h.out, "%s: %s\n", h.aiClient.Model(), params)
+	return nil
+}
+
+// modelsTimeout limits how long 'models' waits for the providers
+const modelsTimeout = 10 * time.Second
+
+// handleModels: models - list the models the providers serve
+func (h *Handler) handleModels(parts []string) error {
+	if len(parts) != 1 {
+		return fmt.Errorf("usage: models")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), modelsTimeout)
+	defer cancel()
+	if err := ai.DiscoverModels(ctx); err != nil {
+		fmt.Fprintln(h.out, theme.Warning(fmt.Sprintf("⚠️  Could not list all models, showing known ones instead: %v", err)))
+	}
+
+	current, offline := "", false
+	if h.aiClient != nil {
+		current, offline = h.aiClient.Model(), h.aiClient.Offline()
+	}
+	var models []string
+	for _, model := range ai.Models() {
+		if !offline || ai.IsLocal(model) {
+			models = append(models, model)
 		}
+	}
+	fmt.Fprintf(h.out, "AI models (%d):\n", len(models))
+	for _, model := range models {
+		marker := " "
+		if model == current {
+			marker = "*"
+		}
+		fmt.Fprintf(h.out, " %s %s\n", marker, model)
+	}
+	fmt.Fprintln(h.out, "Switch with 'model <name>'")
+	return nil
+}
 
-		// Remove the entire block including markers
-		text = text[:startIdx] + text[startIdx+endIdx+len(executeEnd):]
+// handleGenre: genre [name|off] - steer the AI towards a genre's style
+func (h *Handler) handleGenre(parts []string) error {
+	if len(parts) > 2 {
+		return fmt.Errorf("usage: genre [name|off]")
+	}
+	if h.aiClient == nil {
+		return errAIUnavailable
+	}
+
+	if len(parts) == 1 {
+		current := h.genre
+		if current == "" {
+			current = "off"
+		}
+		fmt.Fprintf(h.out, "Genre: %s\nAvailable: %s\n", current, strings.Join(ai.Genres(), ", "))
+		return nil
 	}
 
-	return strings.TrimSpace(text)
+	name := parts[1]
+	if name == "off" {
+		name = ""
+	}
+	if err := h.aiClient.SetGenre(name); err != nil {
+		return err
+	}
+	h.genre = name
+	if name == "" {
+		fmt.Fprintln(h.out, "Genre preset off")
+	} else {
+		fmt.Fprintf(h.out, "AI now favors %s style\n", name)
+	}
+	return nil
 }
 
 // handleClearChat: clear-chat
 func (h *Handler) handleClearChat(parts []string) error {
 	// Check if AI client is available
 	if h.aiClient == nil {
-		return fmt.Errorf("AI not available. Set ANTHROPIC_API_KEY environment variable to enable AI features")
+		return errAIUnavailable
 	}
 
 	if len(parts) != 1 {
@@ -812,76 +1544,65 @@ func (h *Handler) handleClearChat(parts []string) error {
 	}
 
 	h.aiClient.ClearHistory()
-	fmt.Println("Conversation history cleared")
+	fmt.Fprintln(h.out, "Conversation history cleared")
 	return nil
 }
 
-// handleHelp: help
+// handleHelp: help [command]
 func (h *Handler) handleHelp(parts []string) error {
+	if len(parts) > 2 {
+		return fmt.Errorf("usage: help [command]")
+	}
+
+	if len(parts) == 2 {
+		command, ok := lookupCommand(parts[1])
+		if !ok {
+			return fmt.Errorf("unknown command: %s (type 'help' for available commands)", parts[1])
+		}
+		fmt.Fprintln(h.out, command.helpEntry())
+		return nil
+	}
+
 	aiStatus := "disabled"
 	if h.aiClient != nil {
-		aiStatus = "enabled"
+		aiStatus = h.aiClient.Model()
 	}
 
 	patternLen := h.pattern.Length()
 
-	helpText := fmt.Sprintf(`Available commands:
-  set <step> <note|rest> [vel:<val>] [gate:<%%>] [dur:<steps>]
-                          Set a step to play a note or rest
-                          (e.g., 'set 1 C4', 'set 1 rest', 'set 1 C4 vel:120 gate:85 dur:3')
-                          Optional parameters can be combined in any order
-  rest <step>             Set a step to rest/silence (e.g., 'rest 1')
-                          Same as 'set <step> rest'
-  velocity <step> <val>   Set step velocity 0-127 (e.g., 'velocity 1 80')
-  gate <step> <percent>   Set step gate length 1-100%% (e.g., 'gate 1 50')
-  humanize <type> <amt>   Add random variation (e.g., 'humanize velocity 10')
-                          Types: velocity (0-64), timing (0-50ms), gate (0-50)
-                          Use 'humanize' alone to show current settings
-  swing <percent>         Add swing/groove (e.g., 'swing 50' for triplet swing)
-                          0 = straight, 50 = triplet, 66 = hard swing (0-75)
-  cc <cc-num> <val>       Set global CC value (transient, not saved)
-                          e.g., 'cc 74 127' sets filter cutoff to max
-  cc-step <step> <cc> <val>
-                          Set per-step CC automation (persistent, saved)
-                          e.g., 'cc-step 1 74 127' sets filter on step 1
-  cc-clear <step> [cc]    Clear CC automation from a step
-                          e.g., 'cc-clear 1' clears all CC, 'cc-clear 1 74' clears CC#74
-  cc-apply <cc-num>       Apply global CC to all steps with notes
-                          e.g., 'cc-apply 74' converts global CC#74 to per-step
-  cc-show                 Display all CC automation in table format
-  length <steps>          Set pattern length (e.g., 'length 32')
-  clear                   Clear all steps to rests
-  reset                   Reset to default pattern
-  tempo <bpm>             Change tempo (e.g., 'tempo 120')
-  show                    Display current pattern (CC automation shown in brackets)
-  verbose [on|off]        Toggle or set verbose step output
-  save <name>             Save current pattern (e.g., 'save bass_line')
-  load <name>             Load a saved pattern (e.g., 'load bass_line')
-  list                    List all saved patterns
-  delete <name>           Delete a saved pattern (e.g., 'delete bass_line')
-  ai [prompt]             Execute AI prompt inline or enter interactive session (AI: %s)
-                          Usage: 'ai' to enter session, 'ai <prompt>' for inline execution
-                          All commands work directly in AI mode.
-                          Natural language is sent to AI for pattern changes.
-                          Type 'exit' to return to command mode.
-  clear-chat              Clear AI conversation history
-  help                    Show this help message
-  quit                    Exit the program
-  <enter>                 Show current pattern (same as 'show')
+	var sb strings.Builder
+	sb.WriteString("Available commands:\n")
+	for _, command := range registry {
+		sb.WriteString(command.helpEntry() + "\n")
+	}
+	sb.WriteString("  <enter>" + strings.Repeat(" ", helpColumn-len("<enter>")) + "Show current pattern (same as 'show')\n")
 
+	sb.WriteString(fmt.Sprintf(`
 Notes: C4, D#5, Bb3, etc. | Steps: 1-%d | Duration: 1-%d steps (default 1)
 Default velocity: 100 | Default gate: 90%% | CC numbers/values: 0-127
 Patterns saved in 'patterns/' directory as JSON files.
-AI features require ANTHROPIC_API_KEY environment variable.`, aiStatus, patternLen, patternLen)
+Chain commands with semicolons: 'tempo 120; swing 40; set 1 C2 vel:120'
+Tab completes commands, notes, and pattern names. History is kept in ~/.interplay_history.
+AI features need ANTHROPIC_API_KEY, OPENAI_API_KEY or GEMINI_API_KEY, or a local Ollama model (AI: %s).`, patternLen, patternLen, aiStatus))
 
-	fmt.Println(helpText)
+	fmt.Fprintln(h.out, sb.String())
 	return nil
 }
 
+// promptLine reads one line from rl with a temporary prompt
+func promptLine(rl *readline.Instance) func(prompt string) (string, error) {
+	return func(prompt string) (string, error) {
+		original := rl.Config.Prompt
+		rl.SetPrompt(prompt)
+		defer rl.SetPrompt(original)
+		return rl.Readline()
+	}
+}
+
 // ReadLoop reads commands from input until "quit" or EOF
 func (h *Handler) ReadLoop(reader io.Reader) error {
-	// Configure readline with history
-	rl, err := readline.New("> ")
+	// Configure readline with persistent history and tab completion
+	rl, err := readline.NewEx(h.readlineConfig("> "))
 	if err != nil {
 		return fmt.Errorf("failed to initialize readline: %w", err)
 	}
@@ -889,17 +1610,36 @@ func (h *Handler) ReadLoop(reader io.Reader) error {
 
 	for {
 		line, err := rl.Readline()
-		if err != nil { // io.EOF or other error
-			return nil
+		quit := err != nil // Ctrl+C, Ctrl+D (io.EOF) or other error
+		if command, ok := lookupCommand(strings.TrimSpace(line)); ok && command.Name == "quit" {
+			quit = true
 		}
-
-		if strings.TrimSpace(strings.ToLower(line)) == "quit" {
-			return nil
+		if quit {
+			if h.confirmQuit(promptLine(rl)) {
+				return nil
+			}
+			continue
+		}
+		if command, ok := lookupCommand(strings.TrimSpace(line)); ok && command.Name == "perform" {
+			h.perform(rl)
+			continue
+		}
+		if command, ok := lookupCommand(strings.TrimSpace(line)); ok && command.Name == "ai" && h.aiClient != nil {
+			if err := h.aiSession(); err != nil {
+				fmt.Fprintln(h.out, theme.Error(fmt.Sprintf("Error: %v", err)))
+			}
+			continue
 		}
 
-		err = h.ProcessCommand(line)
+		// Like Execute, but AI edits are confirmed at the prompt; commands
+		// from other input sources have no one to ask
+		err = h.Update(func() error {
+			h.readLine = promptLine(rl)
+			defer func() { h.readLine = nil }()
+			return h.ProcessCommand(line)
+		})
 		if err != nil {
-			fmt.Printf("Error: %v\n", err)
+			fmt.Fprintln(h.out, theme.Error(fmt.Sprintf("Error: %v", err)))
 		}
 	}
 }
@@ -1,9 +1,26 @@
 package commands
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/chzyer/readline"
+	"github.com/iltempo/interplay/ai"
+	"github.com/iltempo/interplay/comparison"
+	"github.com/iltempo/interplay/playback"
 	"github.com/iltempo/interplay/sequence"
 )
 
@@ -206,6 +223,66 @@ func TestHandleGate(t *testing.T) {
 	if err == nil {
 		t.Error("ProcessCommand('gate 1 101') should return error")
 	}
+
+	// Gates in milliseconds
+	if err := handler.ProcessCommand("gate 1 30ms"); err != nil {
+		t.Errorf("ProcessCommand('gate 1 30ms') unexpected error: %v", err)
+	}
+	if step, _ := pattern.GetStep(1); step.GateMs != 30 {
+		t.Errorf("gate 1 30ms set GateMs to %d, want 30", step.GateMs)
+	}
+	if err := handler.ProcessCommand("set 2 C4 gate:250ms"); err != nil {
+		t.Errorf("ProcessCommand('set 2 C4 gate:250ms') unexpected error: %v", err)
+	}
+	if step, _ := pattern.GetStep(2); step.GateMs != 250 {
+		t.Errorf("set 2 C4 gate:250ms set GateMs to %d, want 250", step.GateMs)
+	}
+	for _, cmd := range []string{"gate 1 0ms", "gate 1 99999ms", "gate 1 fastms", "set 1 C4 gate:0ms"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("ProcessCommand(%q) should return error", cmd)
+		}
+	}
+	if err := handler.ProcessCommand("gate 1 50"); err != nil {
+		t.Fatal(err)
+	}
+	if step, _ := pattern.GetStep(1); step.GateMs != 0 {
+		t.Errorf("gate 1 50 left GateMs at %d, want 0", step.GateMs)
+	}
+}
+
+// TestHandleMuteStep tests mute-step and unmute-step
+func TestHandleMuteStep(t *testing.T) {
+	pattern := sequence.New(16)
+	handler := New(pattern, &mockVerboseController{})
+	for _, cmd := range []string{"set 1 C3", "set 5 G3", "mute-step 1 5", "mute-step"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("ProcessCommand(%q) unexpected error: %v", cmd, err)
+		}
+	}
+	for _, stepNum := range []int{1, 5} {
+		if step, _ := pattern.GetStep(stepNum); !step.Muted || step.IsRest {
+			t.Errorf("step %d = %+v, want a muted note", stepNum, step)
+		}
+	}
+
+	if err := handler.ProcessCommand("unmute-step 1"); err != nil {
+		t.Fatal(err)
+	}
+	if step, _ := pattern.GetStep(1); step.Muted {
+		t.Error("unmute-step 1 left step 1 muted")
+	}
+	if err := handler.ProcessCommand("unmute-step all"); err != nil {
+		t.Fatal(err)
+	}
+	if step, _ := pattern.GetStep(5); step.Muted {
+		t.Error("unmute-step all left step 5 muted")
+	}
+
+	for _, cmd := range []string{"mute-step 2", "mute-step x", "mute-step 99", "unmute-step"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("ProcessCommand(%q) should return error", cmd)
+		}
+	}
 }
 
 // TestHandleLength tests the length command
@@ -281,6 +358,65 @@ func TestHandleLength(t *testing.T) {
 	if err == nil {
 		t.Error("ProcessCommand('length -5') should return error")
 	}
+
+	// Lengths in bars
+	for _, tt := range []struct {
+		arg  string
+		want int
+	}{{"2bars", 32}, {"1bar", 16}, {"4BARS", 64}} {
+		if err := handler.ProcessCommand("length " + tt.arg); err != nil {
+			t.Errorf("length %s: %v", tt.arg, err)
+		} else if pattern.Length() != tt.want {
+			t.Errorf("length %s = %d steps, want %d", tt.arg, pattern.Length(), tt.want)
+		}
+	}
+	for _, arg := range []string{"0bars", "xbars", "bars"} {
+		if err := handler.ProcessCommand("length " + arg); err == nil {
+			t.Errorf("length %s: expected error", arg)
+		}
+	}
+
+	// At the prompt, removing notes asks first
+	handler.ProcessCommand("set 20 C3")
+	handler.ProcessCommand("set 40 E3")
+	var asked string
+	handler.readLine = func(prompt string) (string, error) {
+		asked = prompt
+		return "n", nil
+	}
+	if err := handler.ProcessCommand("length 1bar"); err != nil {
+		t.Fatalf("length 1bar: %v", err)
+	}
+	if !strings.Contains(asked, "removes 2 notes (steps 20, 40)") || pattern.Length() != 64 {
+		t.Errorf("declined shortening: asked %q, length %d", asked, pattern.Length())
+	}
+
+	// Folding and keeping the tail lose nothing, so they don't ask
+	asked = ""
+	if err := handler.ProcessCommand("length 1bar --fold"); err != nil {
+		t.Fatalf("length 1bar --fold: %v", err)
+	}
+	if step, _ := pattern.GetStep(4); asked != "" || pattern.Length() != 16 || step.IsRest {
+		t.Errorf("folding: asked %q, length %d, step 4 = %+v", asked, pattern.Length(), step)
+	}
+	handler.ProcessCommand("length 2bars")
+	handler.ProcessCommand("clear")
+	handler.ProcessCommand("set 30 G3")
+	if err := handler.ProcessCommand("length 1bar --keep-tail"); err != nil {
+		t.Fatalf("length 1bar --keep-tail: %v", err)
+	}
+	if step, _ := pattern.GetStep(14); asked != "" || step.IsRest {
+		t.Errorf("keeping the tail: asked %q, step 14 = %+v", asked, step)
+	}
+	handler.readLine = nil
+
+	// Other input sources have no one to ask; the notes are removed
+	// with a warning, and 'undo' brings them back
+	handler.ProcessCommand("length 2bars")
+	handler.ProcessCommand("set 30 G3")
+	if err := handler.Execute("length 1bar"); err != nil || pattern.Length() != 16 {
+		t.Errorf("length 1bar from another source: %v, length %d", err, pattern.Length())
+	}
 }
 
 // TestHandleTempo tests the tempo command
@@ -294,7 +430,7 @@ func TestHandleTempo(t *testing.T) {
 		t.Errorf("ProcessCommand('tempo 120') unexpected error: %v", err)
 	}
 	if pattern.GetBPM() != 120 {
-		t.Errorf("tempo 120 set BPM to %d, want 120", pattern.GetBPM())
+		t.Errorf("tempo 120 set BPM to %g, want 120", pattern.GetBPM())
 	}
 
 	// Invalid: too few arguments
@@ -505,3 +641,2961 @@ func TestSetWithParameters(t *testing.T) {
 		t.Error("ProcessCommand('set 6 A4 invalid:50') should return error (unknown parameter)")
 	}
 }
+
+// TestCompleter tests tab completion of commands, notes, and steps
+func TestCompleter(t *testing.T) {
+	pattern := sequence.New(16)
+	handler := New(pattern, &mockVerboseController{})
+	completer := handler.completer()
+
+	tests := []struct {
+		name string
+		line string
+		want string // one expected completion suffix
+	}{
+		{"Command name", "tem", "po "},
+		{"Hyphenated command", "cc-s", "how "},
+		{"Step number", "set 1", "6 "},
+		{"Note name", "set 1 C#", "4 "},
+		{"Humanize type", "humanize ti", "ming "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates, _ := completer.Do([]rune(tt.line), len(tt.line))
+			for _, c := range candidates {
+				if string(c) == tt.want {
+					return
+				}
+			}
+			t.Errorf("completing %q: %q not among candidates %q", tt.line, tt.want, candidates)
+		})
+	}
+}
+
+// TestHistoryFile tests that history is stored in the home directory
+func TestHistoryFile(t *testing.T) {
+	t.Setenv("HOME", "/tmp/interplay-home")
+	if got := HistoryFile(); got != "/tmp/interplay-home/.interplay_history" {
+		t.Errorf("HistoryFile() = %q, want /tmp/interplay-home/.interplay_history", got)
+	}
+}
+
+// TestCommandAliases tests that aliases run the same handler as the full name
+func TestCommandAliases(t *testing.T) {
+	pattern := sequence.New(sequence.DefaultPatternLength)
+	handler := New(pattern, &mockVerboseController{})
+
+	if err := handler.ProcessCommand("t 140"); err != nil {
+		t.Fatalf("ProcessCommand('t 140') unexpected error: %v", err)
+	}
+	if pattern.GetBPM() != 140 {
+		t.Errorf("'t 140' should set tempo, got %g BPM", pattern.GetBPM())
+	}
+
+	pattern.SetNote(1, 60)
+	if err := handler.ProcessCommand("V 1 77"); err != nil {
+		t.Fatalf("ProcessCommand('V 1 77') unexpected error: %v", err)
+	}
+	step, _ := pattern.GetStep(1)
+	if step.Velocity != 77 {
+		t.Errorf("'V 1 77' should set velocity, got %d", step.Velocity)
+	}
+}
+
+// TestRegistry tests registry lookups and help rendering
+func TestRegistry(t *testing.T) {
+	for _, name := range Commands() {
+		command, ok := lookupCommand(name)
+		if !ok {
+			t.Errorf("lookupCommand(%q) not found", name)
+			continue
+		}
+		if command.Run == nil {
+			t.Errorf("command %q has no Run function", name)
+		}
+		if !strings.HasPrefix(command.Usage, name) {
+			t.Errorf("command %q usage %q should start with its name", name, command.Usage)
+		}
+	}
+
+	tempo, _ := lookupCommand("tempo")
+	entry := tempo.helpEntry()
+	if !strings.Contains(entry, "tempo <bpm>") || !strings.Contains(entry, "Alias: t, bpm") {
+		t.Errorf("tempo help entry missing usage or aliases: %q", entry)
+	}
+
+	pattern := sequence.New(sequence.DefaultPatternLength)
+	handler := New(pattern, &mockVerboseController{})
+	if err := handler.ProcessCommand("help tempo"); err != nil {
+		t.Errorf("ProcessCommand('help tempo') unexpected error: %v", err)
+	}
+	if err := handler.ProcessCommand("help nonsense"); err == nil {
+		t.Error("ProcessCommand('help nonsense') should return error")
+	}
+}
+
+// TestMacros tests defining, running, listing, and deleting macros
+// TestStamps tests defining stamps and applying them with 'set ... @name'
+func TestStamps(t *testing.T) {
+	tempDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(originalDir)
+
+	pattern := sequence.New(16)
+	handler := New(pattern, &mockVerboseController{})
+
+	for _, cmd := range []string{
+		"stamp define Accent vel:110 gate:40 dur:2",
+		"stamp define hit gate:30ms",
+		"set 5 C2 @accent",
+		"set 6 D2 @accent vel:90",
+		"set 9 E2 @hit @accent",
+		"stamp list",
+	} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("ProcessCommand(%q) unexpected error: %v", cmd, err)
+		}
+	}
+
+	tests := []struct {
+		step     int
+		velocity uint8
+		gate     int
+		gateMs   int
+		duration int
+	}{
+		{5, 110, 40, 0, 2},
+		{6, 90, 40, 0, 2},  // parameters after the stamp override it
+		{9, 110, 40, 0, 2}, // a percentage gate replaces the ms gate
+	}
+	for _, tt := range tests {
+		step, _ := pattern.GetStep(tt.step)
+		if step.Velocity != tt.velocity || step.Gate != tt.gate || step.GateMs != tt.gateMs || step.Duration != tt.duration {
+			t.Errorf("step %d = vel:%d gate:%d gateMs:%d dur:%d, want vel:%d gate:%d gateMs:%d dur:%d", tt.step,
+				step.Velocity, step.Gate, step.GateMs, step.Duration, tt.velocity, tt.gate, tt.gateMs, tt.duration)
+		}
+	}
+
+	stamps, err := loadStamps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stamps["accent"] != "vel:110 gate:40 dur:2" {
+		t.Errorf("saved stamps = %v", stamps)
+	}
+
+	for _, cmd := range []string{
+		"stamp define bad vel:200",
+		"stamp define bad pan:3",
+		"stamp define bad",
+		"set 1 C2 @missing",
+	} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("ProcessCommand(%q) should return error", cmd)
+		}
+	}
+
+	// Durations are checked against the pattern when the stamp is used
+	if err := handler.ProcessCommand("stamp define long dur:99"); err != nil {
+		t.Fatalf("stamp define long dur:99 unexpected error: %v", err)
+	}
+	if err := handler.ProcessCommand("set 1 C2 @long"); err == nil {
+		t.Error("set with a stamp longer than the pattern should fail")
+	}
+
+	if err := handler.ProcessCommand("stamp delete hit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.ProcessCommand("set 1 C2 @hit"); err == nil {
+		t.Error("set with a deleted stamp should fail")
+	}
+}
+
+func TestMacros(t *testing.T) {
+	tempDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(originalDir)
+
+	pattern := sequence.New(sequence.DefaultPatternLength)
+	handler := New(pattern, &mockVerboseController{})
+
+	err := handler.ProcessCommand("macro define init clear; tempo 120; swing 40")
+	if err != nil {
+		t.Fatalf("macro define unexpected error: %v", err)
+	}
+
+	// Macros persist on disk
+	macros, err := loadMacros()
+	if err != nil {
+		t.Fatalf("loadMacros() unexpected error: %v", err)
+	}
+	if macros["init"] != "clear; tempo 120; swing 40" {
+		t.Errorf("stored macro = %q, want %q", macros["init"], "clear; tempo 120; swing 40")
+	}
+
+	pattern.SetNote(1, 60)
+	if err := handler.ProcessCommand("macro run init"); err != nil {
+		t.Fatalf("macro run unexpected error: %v", err)
+	}
+	step, _ := pattern.GetStep(1)
+	if !step.IsRest || pattern.GetBPM() != 120 || pattern.GetSwing() != 40 {
+		t.Errorf("macro run did not apply all commands (rest=%v bpm=%g swing=%d)", step.IsRest, pattern.GetBPM(), pattern.GetSwing())
+	}
+
+	if err := handler.ProcessCommand("macro list"); err != nil {
+		t.Errorf("macro list unexpected error: %v", err)
+	}
+
+	// A failing command is reported but the rest still runs
+	handler.ProcessCommand("macro define broken tempo 999; tempo 90")
+	if err := handler.ProcessCommand("macro run broken"); err == nil {
+		t.Error("macro run with a failing command should return error")
+	}
+	if pattern.GetBPM() != 90 {
+		t.Errorf("commands after a failure should still run, got %g BPM", pattern.GetBPM())
+	}
+
+	// Recursive macros stop at the depth limit
+	handler.ProcessCommand("macro define loop macro run loop")
+	if err := handler.ProcessCommand("macro run loop"); err == nil {
+		t.Error("recursive macro should return error")
+	}
+
+	if err := handler.ProcessCommand("macro delete init"); err != nil {
+		t.Errorf("macro delete unexpected error: %v", err)
+	}
+	if err := handler.ProcessCommand("macro run init"); err == nil {
+		t.Error("running a deleted macro should return error")
+	}
+}
+
+// TestCommandChaining tests semicolon-separated commands on one line
+func TestCommandChaining(t *testing.T) {
+	pattern := sequence.New(sequence.DefaultPatternLength)
+	handler := New(pattern, &mockVerboseController{})
+
+	err := handler.ProcessCommand("tempo 120; swing 40; set 1 C2 vel:120")
+	if err != nil {
+		t.Fatalf("chained command unexpected error: %v", err)
+	}
+	step, _ := pattern.GetStep(1)
+	if pattern.GetBPM() != 120 || pattern.GetSwing() != 40 || step.Note != 36 || step.Velocity != 120 {
+		t.Errorf("chain not fully applied: bpm=%g swing=%d note=%d vel=%d", pattern.GetBPM(), pattern.GetSwing(), step.Note, step.Velocity)
+	}
+
+	// Errors are reported per sub-command and later commands still run
+	err = handler.ProcessCommand("tempo 999; bogus; tempo 90;")
+	if err == nil {
+		t.Fatal("chain with failing sub-commands should return error")
+	}
+	if !strings.Contains(err.Error(), "'tempo 999'") || !strings.Contains(err.Error(), "'bogus'") {
+		t.Errorf("error should name each failing sub-command, got: %v", err)
+	}
+	if pattern.GetBPM() != 90 {
+		t.Errorf("commands after a failure should still run, got %g BPM", pattern.GetBPM())
+	}
+
+	// Empty segments are ignored
+	if err := handler.ProcessCommand(";; show ;"); err != nil {
+		t.Errorf("empty segments should be ignored, got: %v", err)
+	}
+}
+
+// fakeClock emits a loop of step events followed by a loop event, forever
+type fakeClock struct {
+	steps int
+	mu    sync.Mutex
+	stops map[<-chan playback.Event]chan struct{}
+}
+
+func (c *fakeClock) Subscribe(buffer int) <-chan playback.Event {
+	ch := make(chan playback.Event, buffer)
+	stop := make(chan struct{})
+	c.mu.Lock()
+	if c.stops == nil {
+		c.stops = map[<-chan playback.Event]chan struct{}{}
+	}
+	c.stops[ch] = stop
+	c.mu.Unlock()
+	go func() {
+		for loop := 0; ; loop++ {
+			for step := 1; step <= c.steps; step++ {
+				select {
+				case ch <- playback.Event{Type: playback.EventStep, Step: step, Loop: loop}:
+				case <-stop:
+					return
+				}
+			}
+			select {
+			case ch <- playback.Event{Type: playback.EventLoop, Loop: loop + 1}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func (c *fakeClock) Unsubscribe(ch <-chan playback.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	close(c.stops[ch])
+	delete(c.stops, ch)
+}
+
+// TestWait tests the wait command against a playback clock
+func TestWait(t *testing.T) {
+	pattern := sequence.New(sequence.DefaultPatternLength)
+	handler := New(pattern, &mockVerboseController{})
+	handler.SetClock(&fakeClock{steps: 16})
+
+	for _, cmd := range []string{"wait 2 bars", "wait 3 beats", "wait 4", "wait loop", "wait 2 loops", "sleep 0.01", "wait 0.01 seconds"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+
+	for _, cmd := range []string{"wait", "wait 0 bars", "wait -1 beats", "wait 2 weeks", "wait 1.5 loops", "wait x"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+
+	// Without a clock, beats fall back to the pattern tempo and loops are unavailable
+	handler = New(pattern, &mockVerboseController{})
+	pattern.SetTempo(300)
+	start := time.Now()
+	if err := handler.ProcessCommand("wait 1 beat"); err != nil {
+		t.Errorf("wait without clock: unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("wait 1 beat at 300 BPM returned after %v, want ~200ms", elapsed)
+	}
+	if err := handler.ProcessCommand("wait loop"); err == nil {
+		t.Error("wait loop without clock should return error")
+	}
+}
+
+// TestVariables tests let and $var substitution with arithmetic
+func TestVariables(t *testing.T) {
+	pattern := sequence.New(sequence.DefaultPatternLength)
+	handler := New(pattern, &mockVerboseController{})
+
+	commands := []string{
+		"let root=C2",
+		"let start = 5",
+		"set $start $root",
+		"set ${start+4} ${root+7} vel:${100+start*2}",
+		"set ${(start-1)*4} ${root-12}",
+	}
+	for _, cmd := range commands {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+
+	checks := []struct {
+		step     int
+		note     uint8
+		velocity uint8
+	}{
+		{5, 36, 100},  // C2
+		{9, 43, 110},  // G2
+		{16, 24, 100}, // C1
+	}
+	for _, c := range checks {
+		step, _ := pattern.GetStep(c.step)
+		if step.Note != c.note || step.Velocity != c.velocity {
+			t.Errorf("step %d: got note %d vel %d, want note %d vel %d", c.step, step.Note, step.Velocity, c.note, c.velocity)
+		}
+	}
+
+	// Changing the root transposes the scripted line
+	if err := handler.ProcessCommand("let root=D2; set 1 ${root+7}"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if step, _ := pattern.GetStep(1); step.Note != 45 {
+		t.Errorf("transposed step 1: got note %d, want 45 (A2)", step.Note)
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"${2+3*4}", "14"},
+		{"${(2+3)*4}", "20"},
+		{"${-3+10/2}", "2"},
+		{"${G2-C2}", "7"},
+		{"${root}", "D2"},
+		{"$$root", "$root"},
+		{"$root-x", "D2-x"},
+	}
+	for _, tt := range tests {
+		got, err := handler.expandVars(tt.expr)
+		if err != nil || got != tt.want {
+			t.Errorf("expandVars(%q) = %q, %v, want %q", tt.expr, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"$missing", "${nope+1}", "${1/0}", "${C2+D2}", "${C2*2}", "${G9+12}", "${1+", "${(1+2}", "$"} {
+		if _, err := handler.expandVars(bad); err == nil {
+			t.Errorf("expandVars(%q) should return error", bad)
+		}
+	}
+
+	if err := handler.ProcessCommand("let"); err != nil {
+		t.Errorf("'let' should list variables, got: %v", err)
+	}
+	for _, bad := range []string{"let x", "let 1x=3", "let x="} {
+		if err := handler.ProcessCommand(bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+// TestConfirmQuit tests the unsaved-changes prompt on quit
+func TestConfirmQuit(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	// answers returns a readLine func replaying the given answers
+	answers := func(lines ...string) func(string) (string, error) {
+		return func(string) (string, error) {
+			if len(lines) == 0 {
+				return "", io.EOF
+			}
+			line := lines[0]
+			lines = lines[1:]
+			return line, nil
+		}
+	}
+
+	pattern := sequence.New(sequence.DefaultPatternLength)
+	handler := New(pattern, &mockVerboseController{})
+
+	if handler.IsModified() {
+		t.Error("new handler should not report modifications")
+	}
+	if !handler.confirmQuit(answers()) {
+		t.Error("unmodified pattern should quit without asking")
+	}
+
+	handler.ProcessCommand("set 1 C3")
+	if !handler.IsModified() {
+		t.Fatal("pattern should be modified after set")
+	}
+	if handler.confirmQuit(answers("")) {
+		t.Error("empty answer should cancel quit")
+	}
+	if !handler.confirmQuit(answers("n")) {
+		t.Error("'n' should quit without saving")
+	}
+
+	// 'y' without a known name asks for one
+	if !handler.confirmQuit(answers("y", "first")) {
+		t.Error("'y' with a name should save and quit")
+	}
+	if _, err := sequence.Load("first"); err != nil || handler.IsModified() {
+		t.Errorf("pattern should be saved as 'first' (err=%v, modified=%v)", err, handler.IsModified())
+	}
+
+	// 'y' reuses the last saved name; other text saves under that name
+	handler.ProcessCommand("set 2 D3")
+	handler.confirmQuit(answers("y"))
+	if loaded, _ := sequence.Load("first"); loaded == nil || loaded.Steps[1].Note != 50 {
+		t.Error("'y' should save under the last saved name")
+	}
+	handler.ProcessCommand("set 3 E3")
+	handler.confirmQuit(answers("second"))
+	if _, err := sequence.Load("second"); err != nil {
+		t.Errorf("typing a name should save under it: %v", err)
+	}
+
+	// Undoing an edit means nothing is unsaved
+	handler.ProcessCommand("set 4 F3")
+	handler.ProcessCommand("rest 4")
+	if handler.IsModified() {
+		t.Error("pattern matching the saved state should not be modified")
+	}
+
+	// Loading resets the modified state
+	handler.ProcessCommand("clear")
+	handler.ProcessCommand("load first")
+	if handler.IsModified() {
+		t.Error("freshly loaded pattern should not be modified")
+	}
+}
+
+// mockTransport implements Transport for testing
+type mockTransport struct{ paused bool }
+
+func (m *mockTransport) Pause()         { m.paused = true }
+func (m *mockTransport) Resume()        { m.paused = false }
+func (m *mockTransport) IsPaused() bool { return m.paused }
+
+// TestPauseResume tests the transport commands
+func TestPauseResume(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.ProcessCommand("pause"); err == nil {
+		t.Error("pause without transport should return error")
+	}
+
+	transport := &mockTransport{}
+	handler.SetTransport(transport)
+	for _, step := range []struct {
+		cmd    string
+		paused bool
+	}{
+		{"pause", true},
+		{"pause", true},
+		{"resume", false},
+		{"resume", false},
+	} {
+		if err := handler.ProcessCommand(step.cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", step.cmd, err)
+		}
+		if transport.paused != step.paused {
+			t.Errorf("after %s: paused = %v, want %v", step.cmd, transport.paused, step.paused)
+		}
+	}
+	if err := handler.ProcessCommand("pause now"); err == nil {
+		t.Error("pause with arguments should return error")
+	}
+}
+
+// TestHooks tests loading, reloading and stopping hook scripts
+func TestHooks(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	pattern := sequence.New(16)
+	pattern.Clear()
+	handler := New(pattern, &mockVerboseController{})
+	handler.SetClock(&fakeClock{steps: 16})
+
+	changes := 0
+	handler.OnPatternChange(func() { changes++ })
+
+	os.WriteFile("fills.star", []byte(`
+def on_loop(loop):
+    pattern.set_note(16, "G3")
+
+def on_load(name):
+    if name == "groove":
+        pattern.set_tempo(123)
+`), 0644)
+	os.WriteFile("broken.star", []byte("def on_loop(loop)\n"), 0644)
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			done := false
+			handler.Update(func() error { done = cond(); return nil })
+			if done {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if err := handler.Execute("hooks reload"); err == nil {
+		t.Error("hooks reload without hooks should return error")
+	}
+	if err := handler.LoadHooks("fills.star"); err != nil {
+		t.Fatalf("LoadHooks: %v", err)
+	}
+	waitFor("on_loop", func() bool {
+		step, _ := pattern.GetStep(16)
+		return !step.IsRest && changes > 0
+	})
+
+	// on_load runs after 'load'
+	sequence.New(16).Save("groove")
+	if err := handler.Execute("load groove"); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	waitFor("on_load", func() bool { return pattern.GetBPM() == 123 })
+
+	// A broken script leaves the previous hooks running
+	if err := handler.Execute("hooks load broken.star"); err == nil {
+		t.Error("loading a broken script should return error")
+	}
+	for _, cmd := range []string{"hooks", "hooks reload", "hooks off", "hooks off"} {
+		if err := handler.Execute(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if handler.hooks != nil {
+		t.Error("hooks off should stop the hooks")
+	}
+	for _, cmd := range []string{"hooks load", "hooks start", "hooks off now"} {
+		if err := handler.Execute(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+// TestPlugins tests loading and running exec-based plugin commands
+func TestPlugins(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+	defer unregisterPlugins()
+
+	os.Mkdir("plugins", 0755)
+	plugins := map[string]string{
+		"chord.sh": `#!/bin/sh
+if [ "$1" = "--describe" ]; then
+  echo "chord <root>"
+  echo "Play a triad from step 1"
+  exit 0
+fi
+cat > input.json
+echo "# building chord on $1"
+echo "set 1 $1"
+echo "set 2 \${$1+4}"
+`,
+		"broken":   "#!/bin/sh\necho 'bogus command'\necho 'tempo 99'\n",
+		"crash":    "#!/bin/sh\necho 'tempo 50'\nexit 3\n",
+		"set":      "#!/bin/sh\necho 'clear'\n",
+		"Bad Name": "#!/bin/sh\n",
+	}
+	for name, src := range plugins {
+		os.WriteFile(filepath.Join("plugins", name), []byte(src), 0755)
+	}
+	os.WriteFile(filepath.Join("plugins", "notes.txt"), []byte("not executable"), 0644)
+
+	names, err := LoadPlugins(io.Discard)
+	if err != nil {
+		t.Fatalf("LoadPlugins: %v", err)
+	}
+	if got := strings.Join(names, ","); got != "broken,chord,crash" {
+		t.Errorf("LoadPlugins = %s, want broken,chord,crash", got)
+	}
+
+	chord, ok := lookupCommand("chord")
+	if !ok || chord.Usage != "chord <root>" || chord.Help[0] != "Play a triad from step 1" {
+		t.Errorf("chord command = %+v", chord)
+	}
+	if broken, _ := lookupCommand("broken"); broken.Usage != "broken [args]" {
+		t.Errorf("plugin without --describe has usage %q", broken.Usage)
+	}
+	if set, _ := lookupCommand("set"); set.Plugin != "" {
+		t.Error("plugins must not override built-in commands")
+	}
+
+	pattern := sequence.New(16)
+	pattern.SetTempo(123)
+	handler := New(pattern, &mockVerboseController{})
+	if err := handler.ProcessCommand("chord E3"); err != nil {
+		t.Fatalf("chord: %v", err)
+	}
+	for stepNum, want := range map[int]uint8{1: 52, 2: 56} {
+		if step, _ := pattern.GetStep(stepNum); step.Note != want {
+			t.Errorf("step %d note = %d, want %d", stepNum, step.Note, want)
+		}
+	}
+	input, _ := os.ReadFile("input.json")
+	if !strings.Contains(string(input), `"tempo":123`) {
+		t.Errorf("plugin input = %s, want the current pattern", input)
+	}
+
+	// Like macros, a failing command is reported and the rest still run
+	if err := handler.ProcessCommand("broken"); err == nil || !strings.Contains(err.Error(), "1 command(s) failed") {
+		t.Errorf("broken: error = %v", err)
+	}
+	if pattern.GetBPM() != 99 {
+		t.Errorf("tempo = %g, want 99 from the command after the failing one", pattern.GetBPM())
+	}
+
+	// A plugin exiting with an error runs nothing
+	if err := handler.ProcessCommand("crash"); err == nil {
+		t.Error("crash: expected error")
+	}
+	if pattern.GetBPM() != 99 {
+		t.Error("output of a failed plugin must not run")
+	}
+
+	// Reloading drops removed plugins
+	os.Remove(filepath.Join("plugins", "crash"))
+	if err := handler.ProcessCommand("plugins reload"); err != nil {
+		t.Fatalf("plugins reload: %v", err)
+	}
+	if _, ok := lookupCommand("crash"); ok {
+		t.Error("removed plugin is still registered")
+	}
+	for _, cmd := range []string{"plugins", "help chord"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if err := handler.ProcessCommand("plugins now"); err == nil {
+		t.Error("plugins now: expected error")
+	}
+}
+
+// TestCCShowCurve tests the CC curve plot and filtered cc-show
+func TestCCShowCurve(t *testing.T) {
+	values := []int{0, 0, 40, 40, 127, 127, 127, 127, 64}
+	automated := []bool{true, false, true, false, true, false, false, false, true}
+	want := []string{
+		" 127 │    █░░░",
+		"     │    █░░░",
+		"     │    █░░░",
+		"     │    █░░░",
+		"  64 │    █░░░█",
+		"     │  █░█░░░█",
+		"     │  █░█░░░█",
+		"   0 │█░█░█░░░█",
+		"     └─────────",
+		"      1   5   9",
+	}
+	got := ccCurve(values, automated, 8)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ccCurve =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	pattern := sequence.New(16)
+	handler := New(pattern, &mockVerboseController{})
+	for _, cmd := range []string{"cc-show 74 curve", "cc-step 3 74 40", "cc-step 5 75 10", "cc-show", "cc-show 74", "cc-show 74 curve", "cc-show 74 --curve", "cc-show 1"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	for _, cmd := range []string{"cc-show x", "cc-show 128", "cc-show 74 bars", "cc-show 74 curve now"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+// TestCCNames tests symbolic CC numbers and user-defined CC names
+func TestCCNames(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+	pattern := sequence.New(16)
+	handler := New(pattern, &mockVerboseController{})
+
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"74", 74, false},
+		{"cutoff", 74, false},
+		{"Filter", 74, false},
+		{"modwheel", 1, false},
+		{"resonance", 71, false},
+		{"128", 0, true},
+		{"-1", 0, true},
+		{"wobble", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := handler.parseCCNumber(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCCNumber(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCCNumber(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+
+	if got := handler.ccLabel(74); got != "CC#74 (cutoff)" {
+		t.Errorf("ccLabel(74) = %q", got)
+	}
+	if got := handler.ccLabel(3); got != "CC#3" {
+		t.Errorf("ccLabel(3) = %q", got)
+	}
+
+	for _, cmd := range []string{
+		"cc cutoff 90",
+		"cc-step 1 resonance 40",
+		"cc-name define wobble 3",
+		"cc-name define Cutoff 16", // user names win over built-in ones
+		"cc-step 2 wobble 20",
+		"cc-step 3 cutoff 50",
+		"cc-show cutoff curve",
+		"cc-name",
+		"cc-clear 1 resonance",
+	} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if value, ok := pattern.GetGlobalCC(74); !ok || value != 90 {
+		t.Errorf("global CC74 = %d, %v, want 90", value, ok)
+	}
+	if value, _ := pattern.GetStepCC(2, 3); value != 20 {
+		t.Errorf("step 2 CC3 = %d, want 20 (user name)", value)
+	}
+	if value, _ := pattern.GetStepCC(3, 16); value != 50 {
+		t.Errorf("step 3 CC16 = %d, want 50 (user name overriding built-in)", value)
+	}
+	if _, ok := pattern.GetStepCC(1, 71); ok {
+		t.Error("cc-clear by name should clear CC71")
+	}
+	if got := handler.ccDisplayName(3); got != "wobble" {
+		t.Errorf("ccDisplayName(3) = %q, want wobble", got)
+	}
+
+	for _, cmd := range []string{
+		"cc-name delete cutoff", // user name removed, built-in remains
+		"cc-name delete wobble",
+	} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if n, _ := handler.parseCCNumber("cutoff"); n != 74 {
+		t.Errorf("cutoff = %d after deleting the user name, want 74", n)
+	}
+
+	for _, cmd := range []string{
+		"cc wobble 10",
+		"cc-name define 9lives 3",
+		"cc-name define bad 200",
+		"cc-name delete cutoff",
+		"cc-name delete nothing",
+		"cc-name rename x",
+	} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+// TestDevice tests device profiles: parameter names, ranges and user profiles
+func TestDevice(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+	pattern := sequence.New(16)
+	handler := New(pattern, &mockVerboseController{})
+
+	if err := handler.ProcessCommand("cc cutoff 90"); err != nil {
+		t.Fatalf("cc cutoff 90: unexpected error: %v", err)
+	}
+	if value, ok := pattern.GetGlobalCC(74); !ok || value != 90 {
+		t.Errorf("without a device, cutoff = CC74 %d, %v, want 90", value, ok)
+	}
+
+	for _, cmd := range []string{"device", "device list", "device use Minilogue", "device", "cc cutoff 100", "cc-step 2 resonance 30"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if value, ok := pattern.GetGlobalCC(43); !ok || value != 100 {
+		t.Errorf("minilogue cutoff = CC43 %d, %v, want 100", value, ok)
+	}
+	if value, _ := pattern.GetStepCC(2, 44); value != 30 {
+		t.Errorf("minilogue resonance = CC44 %d, want 30", value)
+	}
+	if got := handler.ccLabel(43); got != "CC#43 (cutoff)" {
+		t.Errorf("ccLabel(43) = %q", got)
+	}
+
+	// User profiles override built-in ones and restrict ranges
+	os.Mkdir("devices", 0755)
+	profile := `{"name": "mono", "parameters": [
+		{"name": "wave", "cc": 20, "range": [0, 3]},
+		{"name": "detune", "nrpn": 300}
+	]}`
+	if err := os.WriteFile(filepath.Join("devices", "mono.json"), []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []string{"device use mono", "cc-step 1 wave 2", "cc-step 1 20 3"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	for _, cmd := range []string{
+		"cc wave 4",       // out of the profile's range
+		"cc-step 1 20 10", // range applies to the number too
+		"cc detune 10",    // NRPN can't be automated
+		"cc-step 1 cutoff2 1",
+		"device use nothing",
+		"device use",
+		"device reset",
+	} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+	if handler.device == nil || handler.device.Name != "mono" {
+		t.Error("failed 'device use' should keep the active profile")
+	}
+
+	if err := handler.ProcessCommand("device off"); err != nil {
+		t.Fatalf("device off: unexpected error: %v", err)
+	}
+	if err := handler.ProcessCommand("cc-step 1 20 10"); err != nil {
+		t.Errorf("range should not apply after 'device off': %v", err)
+	}
+}
+
+// TestMixCommands tests the volume, pan and expression commands
+func TestMixCommands(t *testing.T) {
+	pattern := sequence.New(16)
+	handler := New(pattern, &mockVerboseController{})
+
+	for _, cmd := range []string{
+		"volume",
+		"volume 100",
+		"pan 1 L32",
+		"pan 2 c",
+		"pan 3 R63",
+		"pan 4 10",
+		"expression 5 90",
+		"expression 6 90",
+		"expression 6 off",
+	} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+
+	if volume, ok := pattern.GetVolume(); !ok || volume != 100 {
+		t.Errorf("volume = %d, %v, want 100", volume, ok)
+	}
+	for _, tt := range []struct{ step, cc, want int }{
+		{1, sequence.CCPan, 32},
+		{2, sequence.CCPan, 64},
+		{3, sequence.CCPan, 127},
+		{4, sequence.CCPan, 10},
+		{5, sequence.CCExpression, 90},
+	} {
+		if value, ok := pattern.GetStepCC(tt.step, tt.cc); !ok || value != tt.want {
+			t.Errorf("step %d CC%d = %d, %v, want %d", tt.step, tt.cc, value, ok, tt.want)
+		}
+	}
+	if _, ok := pattern.GetStepCC(6, sequence.CCExpression); ok {
+		t.Error("'expression 6 off' should clear CC11")
+	}
+
+	for _, cmd := range []string{
+		"volume 128",
+		"volume -1",
+		"volume loud",
+		"volume 1 2",
+		"pan 1",
+		"pan 1 L65",
+		"pan 1 R64",
+		"pan 1 X",
+		"pan 17 C",
+		"pan x C",
+		"expression 1 -1",
+		"expression 1 128",
+	} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+
+	if err := handler.ProcessCommand("volume off"); err != nil {
+		t.Fatalf("volume off: unexpected error: %v", err)
+	}
+	if _, ok := pattern.GetVolume(); ok {
+		t.Error("'volume off' should remove the volume")
+	}
+}
+
+// TestCCPersist tests saving global CC values with the pattern
+func TestCCPersist(t *testing.T) {
+	pattern := sequence.New(16)
+	handler := New(pattern, &mockVerboseController{})
+
+	for _, cmd := range []string{"cc 74 90", "cc reverb 40 --save", "cc 91 50"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if pattern.IsGlobalCCSaved(74) {
+		t.Error("plain 'cc' should be transient")
+	}
+	if !pattern.IsGlobalCCSaved(91) {
+		t.Error("changing a saved CC should keep it saved")
+	}
+	if !handler.IsModified() {
+		t.Error("saving a CC with the pattern should mark it modified")
+	}
+
+	for _, cmd := range []string{"cc-persist on", "cc 1 20", "cc 91 10 --no-save", "cc-persist", "cc-persist off", "cc 2 5"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if !pattern.IsGlobalCCSaved(1) || pattern.IsGlobalCCSaved(91) || pattern.IsGlobalCCSaved(2) {
+		t.Errorf("saved: CC1 %v, CC91 %v, CC2 %v; want true, false, false",
+			pattern.IsGlobalCCSaved(1), pattern.IsGlobalCCSaved(91), pattern.IsGlobalCCSaved(2))
+	}
+
+	for _, cmd := range []string{"cc 74 90 --keep", "cc 74 90 --save x", "cc-persist maybe", "cc-persist on off"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+// TestMeterCommand tests that the meter sets how many steps a bar has
+func TestMeterCommand(t *testing.T) {
+	pattern := sequence.New(16)
+	handler := New(pattern, &mockVerboseController{})
+
+	if err := handler.ProcessCommand("meter 6/8"); err != nil {
+		t.Fatalf("meter 6/8: %v", err)
+	}
+	if err := handler.ProcessCommand("length 2bars"); err != nil {
+		t.Fatalf("length 2bars: %v", err)
+	}
+	if pattern.Length() != 24 {
+		t.Errorf("length 2bars in 6/8 = %d steps, want 24", pattern.Length())
+	}
+
+	if err := handler.ProcessCommand("meter 3/4 8th"); err != nil {
+		t.Fatalf("meter 3/4 8th: %v", err)
+	}
+	if got := pattern.StepsPerBar(); got != 6 {
+		t.Errorf("3/4 in 8ths has %d steps per bar, want 6", got)
+	}
+
+	for _, cmd := range []string{"meter 12", "meter 0/4", "meter 4/3", "meter 4/4 12th", "meter 7/16 8th", "meter 4/4 16th 8th"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+	if beats, value := pattern.GetTimeSignature(); beats != 3 || value != 4 || pattern.GetResolution() != 8 {
+		t.Errorf("failed commands changed the meter to %d/%d in %ds", beats, value, pattern.GetResolution())
+	}
+}
+
+// TestNoteOffModeCommand tests the noteoff-mode command
+func TestNoteOffModeCommand(t *testing.T) {
+	pattern := sequence.New(16)
+	handler := New(pattern, &mockVerboseController{})
+
+	for _, cmd := range []string{"noteoff-mode", "noteoff-mode ring", "noteoff-mode retrigger off"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if pattern.GetNoteOffMode() != sequence.NoteOffRing || !pattern.GetLegato() {
+		t.Errorf("got %s, legato %v, want ring, true", pattern.GetNoteOffMode(), pattern.GetLegato())
+	}
+	if !handler.IsModified() {
+		t.Error("note-off settings are saved, so changing them should mark the pattern modified")
+	}
+
+	for _, cmd := range []string{"noteoff-mode cut", "noteoff-mode retrigger on"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if pattern.GetNoteOffMode() != sequence.NoteOffCut || pattern.GetLegato() {
+		t.Errorf("got %s, legato %v, want cut, false", pattern.GetNoteOffMode(), pattern.GetLegato())
+	}
+
+	for _, cmd := range []string{"noteoff-mode hold", "noteoff-mode retrigger", "noteoff-mode retrigger maybe", "noteoff-mode cut ring"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+// mockVelocityCurver implements VelocityCurver for testing
+type mockVelocityCurver struct{ curve *playback.VelocityCurve }
+
+func (m *mockVelocityCurver) SetVelocityCurve(curve *playback.VelocityCurve) { m.curve = curve }
+func (m *mockVelocityCurver) VelocityCurve() *playback.VelocityCurve         { return m.curve }
+
+// TestVelCurve tests the velcurve command and the curves it selects
+func TestVelCurve(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.ProcessCommand("velcurve soft"); err == nil {
+		t.Error("velcurve without playback should return error")
+	}
+
+	curver := &mockVelocityCurver{}
+	handler.SetVelocityCurver(curver)
+
+	tests := []struct {
+		cmd     string
+		in, out uint8
+	}{
+		{"velcurve", 100, 100},
+		{"velcurve soft", 127, 127},
+		{"velcurve soft", 64, 42},
+		{"velcurve hard", 64, 84},
+		{"velcurve soft", 1, 1}, // never 0, which would be a note off
+		{"velcurve fixed", 30, 100},
+		{"velcurve fixed 80", 127, 80},
+		{"velcurve custom 0:20 127:100", 0, 0},
+		{"velcurve custom 0:20 127:100", 1, 21},
+		{"velcurve custom 0:20 127:100", 127, 100},
+		{"velcurve custom 64:64 100:80", 10, 64},
+		{"velcurve custom 64:64 100:80", 82, 72},
+		{"velcurve custom 64:64 100:80", 120, 80},
+		{"velcurve linear", 57, 57},
+	}
+	for _, tt := range tests {
+		if err := handler.ProcessCommand(tt.cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.cmd, err)
+			continue
+		}
+		if got := curver.curve.Apply(tt.in); got != tt.out {
+			t.Errorf("%s: Apply(%d) = %d, want %d", tt.cmd, tt.in, got, tt.out)
+		}
+	}
+	if curver.curve != nil {
+		t.Error("'velcurve linear' should clear the curve")
+	}
+
+	for _, cmd := range []string{
+		"velcurve loud",
+		"velcurve soft 2",
+		"velcurve fixed 0",
+		"velcurve fixed 128",
+		"velcurve custom",
+		"velcurve custom 64:64 32:10",
+		"velcurve custom 0:200",
+		"velcurve custom 10",
+	} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+// TestAnalyzeCommand tests the analyze command
+func TestAnalyzeCommand(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	for _, cmd := range []string{"analyze", "set 1 C3", "set 5 E3", "set 9 G3", "analyze"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if err := handler.ProcessCommand("analyze key"); err == nil {
+		t.Error("analyze with arguments should return error")
+	}
+}
+
+// TestListAndTags tests 'list' options and the 'tag' command
+func TestListAndTags(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+	handler := New(sequence.New(16), &mockVerboseController{})
+
+	for _, cmd := range []string{
+		"list",
+		"tag",
+		"tag techno dark",
+		"tempo 130",
+		"save beat",
+		"tag --clear",
+		"tempo 90",
+		"set 1 C2",
+		"save ambient",
+		"list",
+		"list --sort date",
+		"list --sort tempo --tag techno",
+		"list --tag nothing",
+	} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	for _, cmd := range []string{"list --sort", "list --sort size", "list --order name", "tag a,b"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+
+	infos, err := sequence.ListInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortPatternInfos(infos, "tempo")
+	if infos[0].Name != "ambient" || infos[1].Name != "beat" {
+		t.Errorf("sorted by tempo: %s, %s; want ambient, beat", infos[0].Name, infos[1].Name)
+	}
+	sortPatternInfos(infos, "notes")
+	if infos[0].Name != "beat" {
+		t.Errorf("sorted by notes: %s first, want beat", infos[0].Name)
+	}
+	sortPatternInfos(infos, "name")
+	if infos[0].Name != "ambient" {
+		t.Errorf("sorted by name: %s first, want ambient", infos[0].Name)
+	}
+}
+
+// TestCollections tests saving, listing and loading patterns in collections
+func TestCollections(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+	handler := New(sequence.New(16), &mockVerboseController{})
+
+	for _, cmd := range []string{
+		"set 1 C2",
+		"save basslines/funk1",
+		"save drums/four",
+		"list basslines/",
+		"list drums --sort date",
+		"list empty/",
+		"load basslines/funk1",
+		"delete drums/four",
+	} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	names, _ := sequence.List()
+	if strings.Join(names, ",") != "basslines/funk1" {
+		t.Errorf("patterns = %v, want [basslines/funk1]", names)
+	}
+
+	for _, cmd := range []string{"list a/ b/", "list /"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+func TestReloadAndWatch(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+	handler := New(sequence.New(16), &mockVerboseController{})
+
+	if err := handler.ProcessCommand("reload"); err == nil {
+		t.Error("reload without a saved pattern: expected error")
+	}
+	for _, cmd := range []string{"tempo 100", "save groove", "watch", "watch on", "watch", "watch off"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if err := handler.ProcessCommand("watch maybe"); err == nil {
+		t.Error("watch maybe: expected error")
+	}
+
+	// editExternally rewrites the saved file as another tool would
+	later := time.Now().Add(time.Second)
+	editExternally := func(bpm float64) {
+		t.Helper()
+		p, err := sequence.Load("groove")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.SetTempo(bpm)
+		if err := p.Save("groove"); err != nil {
+			t.Fatal(err)
+		}
+		later = later.Add(time.Second)
+		os.Chtimes(sequence.Path("groove"), later, later)
+	}
+
+	editExternally(120)
+	if err := handler.ProcessCommand("reload"); err != nil {
+		t.Fatalf("reload: unexpected error: %v", err)
+	}
+	if got := handler.pattern.GetBPM(); got != 120 {
+		t.Errorf("after reload: tempo %g, want 120", got)
+	}
+
+	// Unchanged file: nothing to do
+	if err := handler.reloadIfChanged(); err != nil {
+		t.Fatal(err)
+	}
+
+	editExternally(130)
+	if err := handler.reloadIfChanged(); err != nil {
+		t.Fatal(err)
+	}
+	if got := handler.pattern.GetBPM(); got != 130 {
+		t.Errorf("after external edit: tempo %g, want 130", got)
+	}
+
+	// Unsaved local changes are kept
+	handler.ProcessCommand("tempo 90")
+	editExternally(140)
+	if err := handler.reloadIfChanged(); err != nil {
+		t.Fatal(err)
+	}
+	if got := handler.pattern.GetBPM(); got != 90 {
+		t.Errorf("with unsaved changes: tempo %g, want 90 (kept)", got)
+	}
+}
+
+func TestImportTab(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+
+	for _, cmd := range []string{
+		"set 2 E2 vel:80",
+		"import tab C1 x...x...x...x... D1 ....X.......X...",
+	} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	steps := handler.pattern.Steps
+	if steps[0].Note != 24 || steps[0].Velocity != sequence.TabHitVelocity {
+		t.Errorf("step 1 = %+v, want C1 hit", steps[0])
+	}
+	if steps[4].Note != 26 || steps[4].Velocity != sequence.TabAccentVelocity {
+		t.Errorf("step 5 = %+v, want D1 accent (later lane wins)", steps[4])
+	}
+	if steps[1].Note != 40 || steps[1].Velocity != 80 {
+		t.Errorf("step 2 = %+v, lanes should leave it alone", steps[1])
+	}
+
+	if err := handler.ProcessCommand("import tab C2 - . G2"); err != nil {
+		t.Fatalf("melody: unexpected error: %v", err)
+	}
+	if steps[0].Note != 36 || steps[0].Duration != 2 || !steps[1].IsRest || !steps[2].IsRest || steps[3].Note != 43 {
+		t.Errorf("melody steps = %+v", steps[:4])
+	}
+
+	for _, cmd := range []string{
+		"import",
+		"import tab",
+		"import midi x.mid",
+		"import tab C1 x...x...x...x...x",
+		"import tab C2 q",
+	} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+func TestExportScript(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	for _, cmd := range []string{
+		"tempo 132",
+		"swing 55 8th",
+		"humanize velocity 8",
+		"humanize timing 5",
+		"humanize gate 0",
+		"volume 90",
+		"noteoff-mode cut",
+		"noteoff-mode retrigger off",
+		"tag acid",
+		"cc 74 60 --save",
+		"cc 71 30",
+		"set 1 C2 vel:120 gate:50 dur:2",
+		"set 9 G#2",
+		"cc-step 9 74 110",
+		"cc-step 9 10 20",
+		"swing exclude 9",
+		"export script groove.txt",
+	} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("%s: unexpected error: %v", cmd, err)
+		}
+	}
+	if err := handler.ProcessCommand("export midi groove.mid"); err == nil {
+		t.Error("export midi: expected error")
+	}
+
+	data, err := os.ReadFile("groove.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"set 1 C2 vel:120 gate:50 dur:2\n", "swing 55 8th\n", "swing exclude 9\n", "cc 74 60 --save\n", "cc 71 30\n", "cc-step 9 10 20\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("script missing %q:\n%s", want, data)
+		}
+	}
+
+	// Replaying the script over a different pattern rebuilds the original
+	replay := New(sequence.New(32), &mockVerboseController{})
+	replay.ProcessCommand("set 5 C4")
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := replay.ProcessCommand(line); err != nil {
+			t.Fatalf("replay %q: %v", line, err)
+		}
+	}
+	if replay.liveState() != handler.liveState() {
+		t.Errorf("replayed pattern differs:\n%s\nwant\n%s", replay.liveState(), handler.liveState())
+	}
+	if got := replay.pattern.GetAllGlobalCC(); len(got) != 2 || got[71] != 30 {
+		t.Errorf("replayed global CCs = %v", got)
+	}
+
+	// The subdivision stays until changed; excluded steps can swing again
+	for _, cmd := range []string{"swing 40", "swing include all"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+	}
+	if step, _ := handler.pattern.GetStep(9); handler.pattern.GetSwingUnit() != 2 || step.Straight {
+		t.Errorf("after 'swing 40' and 'swing include all': unit %d, step 9 straight %v", handler.pattern.GetSwingUnit(), step.Straight)
+	}
+	for _, cmd := range []string{"swing 50 4th", "swing exclude", "swing exclude 99", "swing include x"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+func TestRandomize(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	for _, cmd := range []string{"set 1 C3", "set 5 E3", "set 9 G3", "set 13 C4", "gate 13 30ms"} {
+		handler.ProcessCommand(cmd)
+	}
+
+	if err := handler.ProcessCommand("randomize velocity 1-12 80-90"); err != nil {
+		t.Fatalf("randomize velocity: %v", err)
+	}
+	if err := handler.ProcessCommand("randomize gate all 20-40"); err != nil {
+		t.Fatalf("randomize gate: %v", err)
+	}
+	handler.pattern.ForEachStep(func(stepNum int, step sequence.Step) {
+		if step.IsRest {
+			return
+		}
+		if stepNum <= 12 && (step.Velocity < 80 || step.Velocity > 90) {
+			t.Errorf("step %d velocity %d, want 80-90", stepNum, step.Velocity)
+		}
+		if stepNum == 13 && step.Velocity != 100 {
+			t.Errorf("step 13 is outside the steps, velocity %d", step.Velocity)
+		}
+		if step.Gate < 20 || step.Gate > 40 || step.GateMs != 0 {
+			t.Errorf("step %d gate %d%% (%dms), want 20-40%%", stepNum, step.Gate, step.GateMs)
+		}
+	})
+
+	for _, cmd := range []string{"randomize velocity 1-16", "randomize pan 1-16 1-10", "randomize velocity 1-99 80-90",
+		"randomize velocity 1-16 0-200", "randomize gate 2-4 10-20", "randomize velocity x 1-2"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+func TestDensity(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	for _, cmd := range []string{"set 1 C3", "set 5 E3", "set 9 G3", "set 13 C4", "velocity 5 30"} {
+		handler.ProcessCommand(cmd)
+	}
+
+	if err := handler.ProcessCommand("density 50 C major"); err != nil {
+		t.Fatalf("density 50: %v", err)
+	}
+	if got := handler.density(); got != 50 {
+		t.Errorf("density after 'density 50' = %d%%, want 50%%", got)
+	}
+	if err := handler.ProcessCommand("density 12%"); err != nil {
+		t.Fatalf("density 12%%: %v", err)
+	}
+	if step, _ := handler.pattern.GetStep(5); handler.density() != 12 || !step.IsRest {
+		t.Errorf("density 12%%: %d%%, step 5 (the quietest) = %+v", handler.density(), step)
+	}
+
+	for _, cmd := range []string{"density x", "density 150", "density 50 H minor"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+func TestInsertRemove(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	handler.ProcessCommand("set 5 C3")
+	handler.ProcessCommand("set 16 G3")
+
+	if err := handler.ProcessCommand("insert 1"); err != nil {
+		t.Fatalf("insert 1: %v", err)
+	}
+	if step, _ := handler.pattern.GetStep(6); handler.pattern.Length() != 17 || step.IsRest {
+		t.Errorf("after 'insert 1': %d steps, step 6 = %+v", handler.pattern.Length(), step)
+	}
+	if err := handler.ProcessCommand("remove 1"); err != nil {
+		t.Fatalf("remove 1: %v", err)
+	}
+	if err := handler.ProcessCommand("insert 1 --wrap"); err != nil {
+		t.Fatalf("insert 1 --wrap: %v", err)
+	}
+	if step, _ := handler.pattern.GetStep(1); handler.pattern.Length() != 16 || step.IsRest {
+		t.Errorf("after 'insert 1 --wrap': %d steps, step 1 = %+v", handler.pattern.Length(), step)
+	}
+
+	for _, cmd := range []string{"insert", "insert x", "remove 1 x", "remove 1 2 3", "remove 17"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+type mockLooper struct{ first, last int }
+
+func (m *mockLooper) LoopSteps(first, last int)      { m.first, m.last = first, last }
+func (m *mockLooper) LoopedSteps() (first, last int) { return m.first, m.last }
+
+func TestBarCommands(t *testing.T) {
+	handler := New(sequence.New(40), &mockVerboseController{})
+	for _, cmd := range []string{"set 1 C3", "set 5 E3", "cc-step 5 74 90", "set 20 G3", "set 33 C4"} {
+		handler.ProcessCommand(cmd)
+	}
+
+	if err := handler.ProcessCommand("copy bar 1 2"); err != nil {
+		t.Fatalf("copy bar 1 2: %v", err)
+	}
+	if step, _ := handler.pattern.GetStep(21); step.IsRest || step.CCValues[74] != 90 {
+		t.Errorf("step 21 after 'copy bar 1 2' = %+v, want step 5's note and CC", step)
+	}
+	if step, _ := handler.pattern.GetStep(20); !step.IsRest {
+		t.Errorf("step 20 after 'copy bar 1 2' = %+v, want bar 1's rest", step)
+	}
+	// The last bar is 8 steps: only those are copied
+	if err := handler.ProcessCommand("copy bar 1 3"); err != nil {
+		t.Fatalf("copy bar 1 3: %v", err)
+	}
+	if step, _ := handler.pattern.GetStep(37); handler.pattern.Length() != 40 || step.IsRest {
+		t.Errorf("after 'copy bar 1 3': %d steps, step 37 = %+v", handler.pattern.Length(), step)
+	}
+
+	if err := handler.ProcessCommand("clear bar 2"); err != nil {
+		t.Fatalf("clear bar 2: %v", err)
+	}
+	handler.pattern.ForEachStep(func(stepNum int, step sequence.Step) {
+		if inBar2 := stepNum >= 17 && stepNum <= 32; inBar2 != step.IsRest && (inBar2 || stepNum == 1 || stepNum == 5) {
+			t.Errorf("after 'clear bar 2', step %d = %+v", stepNum, step)
+		}
+	})
+
+	if err := handler.ProcessCommand("loop bar 2"); err == nil {
+		t.Error("loop without playback should fail")
+	}
+	looper := &mockLooper{}
+	handler.SetLooper(looper)
+	if err := handler.ProcessCommand("loop bar 3"); err != nil || looper.first != 33 || looper.last != 40 {
+		t.Errorf("loop bar 3: %v, looping %d-%d, want 33-40", err, looper.first, looper.last)
+	}
+	if err := handler.ProcessCommand("loop off"); err != nil || looper.first != 0 {
+		t.Errorf("loop off: %v, looping %d-%d", err, looper.first, looper.last)
+	}
+
+	for _, cmd := range []string{"clear bar 4", "clear bar x", "copy bar 1", "copy bar 0 1", "loop bar 9", "loop 2"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+
+	// Bars follow the meter: in 6/8, 40 steps are three bars of 12 and one of 4
+	handler.ProcessCommand("meter 6/8")
+	if err := handler.ProcessCommand("loop bar 4"); err != nil || looper.first != 37 || looper.last != 40 {
+		t.Errorf("loop bar 4 in 6/8: %v, looping %d-%d, want 37-40", err, looper.first, looper.last)
+	}
+}
+
+type mockMonitor struct{ w io.Writer }
+
+func (m *mockMonitor) SetMonitor(w io.Writer) { m.w = w }
+
+func TestMonitor(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.ProcessCommand("monitor on"); err == nil {
+		t.Error("monitor without playback should fail")
+	}
+	monitor := &mockMonitor{}
+	handler.SetMIDIMonitor(monitor)
+
+	if err := handler.ProcessCommand("monitor on"); err != nil || monitor.w != handler.Output() {
+		t.Errorf("monitor on: %v, writing to %v", err, monitor.w)
+	}
+	path := filepath.Join(t.TempDir(), "midi.log")
+	if err := handler.ProcessCommand("monitor " + path); err != nil {
+		t.Fatalf("monitor %s: %v", path, err)
+	}
+	fmt.Fprintln(monitor.w, "note-on")
+	if err := handler.ProcessCommand("monitor off"); err != nil || monitor.w != nil {
+		t.Errorf("monitor off: %v, writing to %v", err, monitor.w)
+	}
+	if handler.monitorFile != nil {
+		t.Error("monitor off should close the log file")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "note-on\n" {
+		t.Errorf("log file: %q, %v", data, err)
+	}
+
+	for _, cmd := range []string{"monitor on off", "monitor " + filepath.Join(t.TempDir(), "missing", "midi.log")} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+type mockPorts struct {
+	in, out   []string
+	connected int
+	open      bool
+}
+
+func (m *mockPorts) ListPorts() ([]string, []string, error) { return m.in, m.out, nil }
+func (m *mockPorts) OutputPort() (int, bool)                { return m.connected, m.open }
+
+func TestPorts(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.ProcessCommand("ports"); err == nil {
+		t.Error("ports without a MIDI connection should fail")
+	}
+	handler.SetPortLister(&mockPorts{in: []string{"Keys"}, out: []string{"IAC Bus 1", "Synth"}, connected: 1, open: true})
+	if err := handler.ProcessCommand("ports"); err != nil {
+		t.Errorf("ports: %v", err)
+	}
+	if err := handler.ProcessCommand("ports 1"); err == nil {
+		t.Error("ports 1: expected error")
+	}
+}
+
+func TestSlots(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	handler.ProcessCommand("set 1 C3")
+	handler.ProcessCommand("tempo 100")
+	first := handler.pattern.String()
+
+	if err := handler.ProcessCommand("slot 2"); err != nil {
+		t.Fatalf("slot 2: %v", err)
+	}
+	if step, _ := handler.pattern.GetStep(1); !step.IsRest || handler.pattern.GetBPM() != 100 || handler.IsModified() {
+		t.Errorf("a new slot should be blank at the same tempo and unmodified, got step 1 %+v, %v BPM", step, handler.pattern.GetBPM())
+	}
+	handler.ProcessCommand("set 5 E3")
+	second := handler.pattern.String()
+
+	if err := handler.ProcessCommand("slot next"); err != nil {
+		t.Fatalf("slot next: %v", err)
+	}
+	if got := handler.pattern.String(); got != first {
+		t.Errorf("slot next should wrap to slot 1, got\n%s", got)
+	}
+	if err := handler.ProcessCommand("slot copy 2 3"); err != nil {
+		t.Fatalf("slot copy: %v", err)
+	}
+	handler.ProcessCommand("slot 3")
+	if got := handler.pattern.String(); got != second {
+		t.Errorf("slot 3 after copying slot 2:\n%s\nwant\n%s", got, second)
+	}
+	// Copying over the current slot replaces the pattern playing
+	handler.ProcessCommand("slot copy 1 3")
+	if got := handler.pattern.String(); got != first {
+		t.Errorf("after copying slot 1 over the current slot:\n%s", got)
+	}
+
+	for _, cmd := range []string{"slot 9", "slot x", "slot copy 4 1", "slot copy 1 1", "slot copy 1"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+	solo := New(sequence.New(16), &mockVerboseController{})
+	if err := solo.ProcessCommand("slot next"); err == nil {
+		t.Error("slot next with one slot in use: expected error")
+	}
+}
+
+func TestImportFiles(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+	os.WriteFile("groove.csv", []byte("step,note,velocity\n1,C1,110\n1,D1,90\n9,D1\n"), 0644)
+	os.WriteFile("song.h2song", []byte(`<song><bpm>140</bpm><patternList><pattern><name>a</name><size>384</size><noteList>
+<note><position>12</position><velocity>0.5</velocity><instrument>2</instrument></note>
+</noteList></pattern></patternList></song>`), 0644)
+
+	handler := New(sequence.New(48), &mockVerboseController{})
+	handler.ProcessCommand("tempo 123")
+
+	if err := handler.ProcessCommand("import csv groove.csv"); err != nil {
+		t.Fatalf("import csv: %v", err)
+	}
+	if handler.pattern.Length() != 16 || handler.pattern.GetBPM() != 123 {
+		t.Errorf("after csv: length %d tempo %g, want 16, 123 (kept)", handler.pattern.Length(), handler.pattern.GetBPM())
+	}
+	if s := handler.pattern.Steps[0]; s.Note != 24 || s.Velocity != 110 {
+		t.Errorf("step 1 = %+v, want the louder C1", s)
+	}
+
+	if err := handler.ProcessCommand("import hydrogen song.h2song a"); err != nil {
+		t.Fatalf("import hydrogen: %v", err)
+	}
+	if handler.pattern.Length() != 32 || handler.pattern.GetBPM() != 140 || handler.pattern.Steps[1].Note != 38 {
+		t.Errorf("after hydrogen: length %d tempo %g step 2 %+v", handler.pattern.Length(), handler.pattern.GetBPM(), handler.pattern.Steps[1])
+	}
+
+	for _, cmd := range []string{
+		"import csv",
+		"import csv missing.csv",
+		"import csv groove.csv extra",
+		"import hydrogen song.h2song b",
+		"import hydrogen song.h2song a extra",
+		"import midi song.mid",
+	} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+func TestImportABC(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+
+	if err := handler.ProcessCommand(`import abc "Q:1/4=110 L:1/8 K:G | G2 A>B c4"`); err != nil {
+		t.Fatalf("import abc: %v", err)
+	}
+	steps := handler.pattern.Steps
+	if steps[0].Note != 67 || steps[0].Duration != 4 || !steps[1].IsRest {
+		t.Errorf("step 1 = %+v, want G4 for 4 steps", steps[0])
+	}
+	if steps[4].Note != 69 || steps[4].Duration != 3 || steps[7].Note != 71 || steps[7].Duration != 1 {
+		t.Errorf("broken rhythm steps = %+v, %+v", steps[4], steps[7])
+	}
+	if handler.pattern.GetBPM() != 110 {
+		t.Errorf("tempo = %g, want 110", handler.pattern.GetBPM())
+	}
+
+	for _, cmd := range []string{"import abc", "import abc [CEG]", "import abc C8 C8"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+func TestRunAITool(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+
+	tests := []struct {
+		tool    string
+		input   string
+		wantErr bool
+	}{
+		{"set_step", `{"step": 1, "note": "C2", "velocity": 110}`, false},
+		{"set_tempo", `{"bpm": 95}`, false},
+		{"set_step", `{"step": 1, "note": "C2; clear"}`, true},
+		{"set_step", `{"step": 99, "note": "C2"}`, true},
+		{"set_volume", `{}`, true},
+		{"erase_disk", `{}`, true},
+	}
+	for _, tt := range tests {
+		result, err := handler.runAITool(ai.ToolCall{Name: tt.tool, Input: json.RawMessage(tt.input)})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s %s: error = %v, wantErr %v", tt.tool, tt.input, err, tt.wantErr)
+		}
+		if err == nil && result != "ok" {
+			t.Errorf("%s: result = %q, want ok", tt.tool, result)
+		}
+	}
+
+	step := handler.pattern.Steps[0]
+	if step.Note != 36 || step.Velocity != 110 || handler.pattern.GetBPM() != 95 {
+		t.Errorf("after tools: step 1 = %+v, tempo %g", step, handler.pattern.GetBPM())
+	}
+}
+
+func TestAIAllow(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	handler.pattern.SetNote(1, 36)
+	clearPattern := ai.ToolCall{Name: "clear_pattern", Input: json.RawMessage(`{}`)}
+
+	if _, err := handler.previewHandler().runAITool(clearPattern); err == nil {
+		t.Error("clear should be blocked for the AI by default")
+	}
+	if handler.pattern.Steps[0].IsRest {
+		t.Error("a blocked clear should leave the pattern alone")
+	}
+
+	if err := handler.handleAIAllow([]string{"ai-allow", "clear", "length"}); err != nil {
+		t.Fatalf("ai-allow: %v", err)
+	}
+	preview := handler.previewHandler()
+	if _, err := preview.runAITool(clearPattern); err != nil {
+		t.Errorf("allowed clear: %v", err)
+	}
+	if !preview.pattern.Steps[0].IsRest {
+		t.Error("allowed clear should clear the preview")
+	}
+
+	if err := handler.handleAIAllow([]string{"ai-allow", "tempo"}); err == nil {
+		t.Error("ai-allow with an unguarded command should fail")
+	}
+	if err := handler.handleAIAllow([]string{"ai-allow", "none"}); err != nil || handler.aiAllowed["clear"] {
+		t.Errorf("ai-allow none: %v, allowed %v", err, handler.aiAllowed)
+	}
+
+	// reset wipes the pattern like clear; ai-allow and other commands
+	// changing settings or running code are never the AI's to run
+	handler.pattern.SetNote(1, 36)
+	preview = handler.previewHandler()
+	dir := t.TempDir()
+	for _, parts := range [][]string{
+		{"reset"},
+		{"reload"},
+		{"import", "abc", "CDEF"},
+		{"ai-allow", "clear"},
+		{"model-config", "temperature", "1"},
+		{"plugins", "reload"},
+		{"hooks", "off"},
+		{"export", "script", filepath.Join(dir, "out.txt")},
+		{"monitor", filepath.Join(dir, "midi.log")},
+		{"compare-stats", "--export", filepath.Join(dir, "stats.csv")},
+		{"save", "x"},
+	} {
+		if err := preview.runAICommand(parts); err == nil {
+			t.Errorf("%v should be blocked for the AI", parts)
+		}
+	}
+	if preview.pattern.Steps[0].IsRest || preview.aiAllowed["clear"] {
+		t.Error("blocked commands should change nothing")
+	}
+	if files, _ := os.ReadDir(dir); len(files) > 0 {
+		t.Errorf("blocked commands wrote %v", files)
+	}
+	if err := preview.runAICommand([]string{"clear"}); err == nil {
+		t.Error("clear should still be blocked after the AI asked for ai-allow")
+	}
+
+	// Typed commands are never blocked
+	if err := handler.ProcessCommand("clear"); err != nil {
+		t.Errorf("clear: %v", err)
+	}
+}
+
+func TestApplyAIEdits(t *testing.T) {
+	tests := []struct {
+		name      string
+		answers   []string
+		autoApply bool
+		wantNote  uint8 // note on step 1 after applying, 0 if left a rest
+		wantStep5 bool  // step 5 plays after applying
+	}{
+		{"apply", []string{"y"}, false, 36, true},
+		{"discard", []string{"n"}, false, 0, false},
+		{"cancel with enter", []string{""}, false, 0, false},
+		{"input closed", nil, false, 0, false},
+		{"auto apply", nil, true, 36, true},
+		{"edit", []string{"edit", "set 1 D2", "-", "y"}, false, 38, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := New(sequence.New(16), &mockVerboseController{})
+			handler.SetAIAutoApply(tt.autoApply)
+			answers := tt.answers
+			handler.readLine = func(prompt string) (string, error) {
+				if len(answers) == 0 {
+					return "", io.EOF
+				}
+				answer := answers[0]
+				answers = answers[1:]
+				return answer, nil
+			}
+
+			proposed := []string{"set 1 C2", "set 5 G2"}
+			preview := handler.previewHandler()
+			for _, cmd := range proposed {
+				if err := preview.ProcessCommand(cmd); err != nil {
+					t.Fatal(err)
+				}
+			}
+			handler.applyAIEdits(preview, proposed)
+
+			step1 := handler.pattern.Steps[0]
+			if tt.wantNote == 0 && !step1.IsRest {
+				t.Errorf("step 1 = %+v, want rest", step1)
+			} else if tt.wantNote != 0 && (step1.IsRest || step1.Note != tt.wantNote) {
+				t.Errorf("step 1 = %+v, want note %d", step1, tt.wantNote)
+			}
+			if plays := !handler.pattern.Steps[4].IsRest; plays != tt.wantStep5 {
+				t.Errorf("step 5 plays = %v, want %v", plays, tt.wantStep5)
+			}
+
+			err := handler.handleUndo([]string{"undo"})
+			if applied := tt.wantNote != 0; (err == nil) != applied {
+				t.Errorf("undo error = %v, applied %v", err, applied)
+			}
+			if !handler.pattern.Steps[0].IsRest {
+				t.Errorf("after undo: step 1 = %+v, want rest", handler.pattern.Steps[0])
+			}
+		})
+	}
+}
+
+func TestModelCommand(t *testing.T) {
+	for _, key := range []string{"ANTHROPIC_API_KEY", "OPENAI_API_KEY", "GEMINI_API_KEY", "GOOGLE_API_KEY"} {
+		t.Setenv(key, "")
+	}
+	handler := New(sequence.New(16), &mockVerboseController{})
+
+	if err := handler.handleModel([]string{"model"}); err == nil {
+		t.Error("model without an AI client should fail")
+	}
+	if err := handler.handleModel([]string{"model", "gpt-4o"}); err == nil {
+		t.Error("model gpt-4o without OPENAI_API_KEY should fail")
+	}
+	if err := handler.handleModel([]string{"model", "ollama:llama3.1"}); err != nil {
+		t.Fatalf("model ollama:llama3.1: %v", err)
+	}
+	if err := handler.handleModel([]string{"model", "mistral"}); err == nil {
+		t.Error("unknown model should fail")
+	}
+	if got := handler.aiClient.Model(); got != "ollama:llama3.1" {
+		t.Errorf("model = %q, want ollama:llama3.1", got)
+	}
+}
+
+// TestCancelAI tests that an AI request in flight can be cancelled
+// without failing the command
+func TestCancelAI(t *testing.T) {
+	hang := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer server.Close()
+	defer close(hang)
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	handler.SetAITimeout(time.Minute)
+	if err := handler.SetAIModel("ollama:test"); err != nil {
+		t.Fatalf("SetAIModel: %v", err)
+	}
+	if got := handler.aiClient.Timeout(); got != time.Minute {
+		t.Errorf("timeout = %v, want 1m", got)
+	}
+	if handler.CancelAI() {
+		t.Error("CancelAI() with no request in flight = true")
+	}
+
+	done := make(chan error)
+	go func() { done <- handler.handleAIInline("add a kick") }()
+	for !handler.CancelAI() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("cancelled request error = %v, want nil", err)
+	}
+}
+
+func TestChatCommand(t *testing.T) {
+	orig := ai.ChatsDir
+	defer func() { ai.ChatsDir = orig }()
+	ai.ChatsDir = t.TempDir()
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.SetAIModel("ollama:test"); err != nil {
+		t.Fatalf("SetAIModel: %v", err)
+	}
+	if err := handler.handleChat([]string{"chat", "save", "empty"}); err == nil {
+		t.Error("saving an empty conversation should fail")
+	}
+
+	chat := `{"model": "ollama:test", "messages": [{"role": "user", "text": "hi"}, {"role": "assistant", "text": "hello"}]}`
+	if err := os.WriteFile(filepath.Join(ai.ChatsDir, "track.json"), []byte(chat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.handleChat([]string{"chat", "load", "track"}); err != nil {
+		t.Fatalf("chat load: %v", err)
+	}
+	if handler.aiClient.HistoryLen() != 2 || !handler.resumeChat {
+		t.Errorf("after load: %d messages, resume %v", handler.aiClient.HistoryLen(), handler.resumeChat)
+	}
+	if err := handler.handleChat([]string{"chat", "save", "copy"}); err != nil {
+		t.Fatalf("chat save: %v", err)
+	}
+	if names, _ := ai.SavedChats(); !reflect.DeepEqual(names, []string{"copy", "track"}) {
+		t.Errorf("saved chats = %v", names)
+	}
+
+	for _, parts := range [][]string{{"chat", "load"}, {"chat", "delete", "track"}, {"chat", "load", "nope"}} {
+		if err := handler.handleChat(parts); err == nil {
+			t.Errorf("%v should fail", parts)
+		}
+	}
+}
+
+// TestAIVary tests making variations and auditioning them against a fake
+// model that sets one step per variation
+func TestAIVary(t *testing.T) {
+	origUsage := ai.UsageFile
+	defer func() { ai.UsageFile = origUsage }()
+	ai.UsageFile = filepath.Join(t.TempDir(), "ai-usage.json")
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		event := `{"choices":[{"delta":{"content":"Moved a note."},"finish_reason":"stop"}]}`
+		if requests%2 == 1 {
+			args := fmt.Sprintf(`{\"step\": %d, \"note\": \"C3\"}`, (requests+1)/2)
+			event = `{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"set_step","arguments":"` + args + `"}}]},"finish_reason":"tool_calls"}]}`
+		}
+		fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", event)
+	}))
+	defer server.Close()
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.SetAIModel("ollama:test"); err != nil {
+		t.Fatalf("SetAIModel: %v", err)
+	}
+	if err := handler.handleAIVary([]string{"ai-vary", "try", "1"}); err == nil {
+		t.Error("try without variations should fail")
+	}
+	for _, parts := range [][]string{{"ai-vary", "0"}, {"ai-vary", "30", "9"}, {"ai-vary", "lots"}} {
+		if err := handler.handleAIVary(parts); err == nil {
+			t.Errorf("%v should fail", parts)
+		}
+	}
+
+	if err := handler.handleAIVary([]string{"ai-vary", "30%", "2"}); err != nil {
+		t.Fatalf("ai-vary: %v", err)
+	}
+	if len(handler.variations) != 2 || requests != 4 {
+		t.Fatalf("got %d variations from %d requests, want 2 from 4", len(handler.variations), requests)
+	}
+	// Variations are made on copies; the pattern is untouched until tried
+	if !handler.pattern.Steps[0].IsRest || handler.variations[0].Steps[0].IsRest || handler.variations[1].Steps[1].IsRest {
+		t.Error("variations should each set their own step, leaving the pattern alone")
+	}
+
+	if err := handler.handleAIVary([]string{"ai-vary", "try", "2"}); err != nil {
+		t.Fatalf("try 2: %v", err)
+	}
+	if handler.pattern.Steps[1].IsRest {
+		t.Error("try 2 should switch to variation 2")
+	}
+	if err := handler.handleAIVary([]string{"ai-vary", "try", "3"}); err == nil {
+		t.Error("try 3 of 2 should fail")
+	}
+	if err := handler.handleAIVary([]string{"ai-vary", "keep"}); err != nil {
+		t.Fatalf("keep: %v", err)
+	}
+	if handler.variations != nil || handler.pattern.Steps[1].IsRest {
+		t.Error("keep should keep variation 2 and drop the rest")
+	}
+	if err := handler.handleUndo([]string{"undo"}); err != nil || !handler.pattern.Steps[1].IsRest {
+		t.Errorf("undo after keep should restore the original: %v", err)
+	}
+}
+
+func TestStyleCommand(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	handler.aiClient = nil // styles work without AI
+
+	if err := handler.handleStyle([]string{"style", "neo-soul"}); err != nil {
+		t.Fatalf("style neo-soul: %v", err)
+	}
+	if handler.style == nil || handler.style.Swing != 55 {
+		t.Errorf("style = %+v, want neo-soul", handler.style)
+	}
+	if err := handler.handleStyle([]string{"style", "polka"}); err == nil {
+		t.Error("unknown style should fail")
+	}
+	if handler.style == nil || handler.style.Name != "neo-soul" {
+		t.Error("a failed switch should keep the active style")
+	}
+	if err := handler.handleStyle([]string{"style", "off"}); err != nil || handler.style != nil {
+		t.Errorf("style off: %v, style %v", err, handler.style)
+	}
+	if err := handler.handleStyle([]string{"style"}); err != nil {
+		t.Errorf("style: %v", err)
+	}
+}
+
+func TestAILocalRules(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	handler.aiClient = nil // no API key
+	handler.pattern.SetTempo(100)
+	handler.pattern.SetNote(1, 36)
+	handler.pattern.SetVelocity(1, 120)
+
+	for _, tc := range []struct {
+		prompt string
+		check  func() bool
+	}{
+		{"make it louder", func() bool { return handler.pattern.Steps[0].Velocity == 127 }},
+		{"Double time please", func() bool { return handler.pattern.GetBPM() == 200 }},
+		{"add some swing", func() bool { return handler.pattern.GetSwing() == 50 }},
+		{"octave up", func() bool { return handler.pattern.Steps[0].Note == 48 }},
+		{"straighten it out", func() bool { return handler.pattern.GetSwing() == 0 }},
+		{"90 bpm", func() bool { return handler.pattern.GetBPM() == 90 }},
+	} {
+		if err := handler.handleAI(append([]string{"ai"}, strings.Fields(tc.prompt)...)); err != nil {
+			t.Errorf("ai %s: %v", tc.prompt, err)
+		} else if !tc.check() {
+			t.Errorf("ai %s: pattern not changed as expected", tc.prompt)
+		}
+	}
+
+	if err := handler.handleAI([]string{"ai", "write", "a", "bossa", "nova"}); !errors.Is(err, errAIUnavailable) {
+		t.Errorf("unmatched prompt: err = %v, want errAIUnavailable", err)
+	}
+	if err := handler.handleAI([]string{"ai"}); !errors.Is(err, errAIUnavailable) {
+		t.Errorf("ai session: err = %v, want errAIUnavailable", err)
+	}
+	if err := handler.handleUndo([]string{"undo"}); err != nil || handler.pattern.GetBPM() != 200 {
+		t.Errorf("undo should revert the last local edit: %v, tempo %g", err, handler.pattern.GetBPM())
+	}
+}
+
+func TestAIOffline(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+
+	// A cloud model in the config falls back to the default local one
+	if err := handler.SetAIOffline("gpt-4o"); err != nil {
+		t.Fatalf("SetAIOffline: %v", err)
+	}
+	if got := handler.aiClient.Model(); got != ai.DefaultLocalModel {
+		t.Errorf("model = %q, want %q", got, ai.DefaultLocalModel)
+	}
+	if err := handler.handleModel([]string{"model", "claude-3-5-haiku-latest"}); err == nil {
+		t.Error("offline mode should reject a cloud model")
+	}
+	if err := handler.handleModel([]string{"model", "ollama:qwen2.5"}); err != nil {
+		t.Errorf("offline mode should accept a local model: %v", err)
+	}
+}
+
+func TestAISessionOnlyAtPrompt(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.SetAIModel("ollama:llama3.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A session would read the terminal, blocking remote clients and scripts
+	if err := handler.Execute("ai"); err == nil || !strings.Contains(err.Error(), "interactive prompt") {
+		t.Errorf("ai from another source: %v, want refused", err)
+	}
+}
+
+func TestGenreCommand(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.SetAIModel("ollama:llama3.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := handler.handleGenre([]string{"genre", "house"}); err != nil {
+		t.Fatalf("genre house: %v", err)
+	}
+	if err := handler.handleGenre([]string{"genre", "../../etc/passwd"}); err == nil {
+		t.Error("genre with a path should fail")
+	}
+	if handler.genre != "house" || handler.aiClient.Genre() != "house" {
+		t.Errorf("genre = %q, client genre = %q, want house", handler.genre, handler.aiClient.Genre())
+	}
+
+	// The preset carries over to a new client
+	if err := handler.SetAIOffline("ollama:qwen2.5"); err != nil {
+		t.Fatal(err)
+	}
+	if handler.aiClient.Genre() != "house" {
+		t.Errorf("after switching clients: genre = %q, want house", handler.aiClient.Genre())
+	}
+
+	if err := handler.handleGenre([]string{"genre", "off"}); err != nil || handler.aiClient.Genre() != "" {
+		t.Errorf("genre off: err %v, genre %q", err, handler.aiClient.Genre())
+	}
+}
+
+func TestRecentCommands(t *testing.T) {
+	handler := New(sequence.New(16), &mockVerboseController{})
+
+	for _, cmd := range []string{"set 1 C2", "show", "set 99 C2", "tempo 120; swing 20", "tempo 120"} {
+		handler.ProcessCommand(cmd)
+	}
+	want := []string{"set 1 C2", "tempo 120", "swing 20"} // unchanged, failed and read-only commands are left out
+	if !reflect.DeepEqual(handler.recentCommands, want) {
+		t.Errorf("recent commands = %q, want %q", handler.recentCommands, want)
+	}
+
+	for i := 1; i <= maxRecentCommands; i++ {
+		handler.ProcessCommand(fmt.Sprintf("set %d D2", i))
+	}
+	if len(handler.recentCommands) != maxRecentCommands || handler.recentCommands[0] != "set 1 D2" {
+		t.Errorf("recent commands = %q, want the last %d", handler.recentCommands, maxRecentCommands)
+	}
+}
+
+func TestSongCommand(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	for _, name := range []string{"intro", "verse"} {
+		if err := handler.pattern.Save(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := handler.handleSong([]string{"song", "new", "demo", "intro*2", "chorus"}); err == nil {
+		t.Error("song new with a missing pattern should fail")
+	}
+	if err := handler.handleSong([]string{"song", "new", "demo", "intro*2", "verse*4"}); err != nil {
+		t.Fatalf("song new: %v", err)
+	}
+	song, err := sequence.LoadSong("demo")
+	if err != nil || song.String() != "intro*2 verse*4" {
+		t.Fatalf("saved song = %v, %v", song, err)
+	}
+	for _, parts := range [][]string{{"song"}, {"song", "show", "demo"}} {
+		if err := handler.handleSong(parts); err != nil {
+			t.Errorf("%v: %v", parts, err)
+		}
+	}
+	if err := handler.handleSong([]string{"song", "play", "demo"}); err == nil {
+		t.Error("song play without playback should fail")
+	}
+	if err := handler.handleSong([]string{"song", "stop"}); err == nil {
+		t.Error("song stop with no song playing should fail")
+	}
+
+	// Tempo follows each part, or stays where it is in global mode
+	slow, fast := sequence.New(16), sequence.New(16)
+	slow.SetTempo(90)
+	fast.SetTempo(140)
+	patterns := []*sequence.Pattern{slow, fast}
+	handler.loadSongPart(song, patterns, 1)
+	if got := handler.pattern.GetBPM(); got != 140 {
+		t.Errorf("pattern mode: tempo = %g, want 140", got)
+	}
+	if err := handler.handleTempoMode([]string{"tempo-mode", "global"}); err != nil {
+		t.Fatalf("tempo-mode global: %v", err)
+	}
+	handler.loadSongPart(song, patterns, 0)
+	if got := handler.pattern.GetBPM(); got != 140 {
+		t.Errorf("global mode: tempo = %g, want 140", got)
+	}
+	if slow.GetBPM() != 90 {
+		t.Error("global mode should leave the song's patterns alone")
+	}
+	for _, parts := range [][]string{{"tempo-mode", "fast"}, {"tempo-mode", "global", "now"}} {
+		if err := handler.handleTempoMode(parts); err == nil {
+			t.Errorf("%v should fail", parts)
+		}
+	}
+}
+
+func TestMorphCommand(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	target := sequence.New(16)
+	target.SetTempo(140)
+	for i := 1; i <= 16; i += 4 {
+		target.SetNote(i, 55)
+	}
+	if err := target.Save("chorus"); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.ProcessCommand("morph chorus 4"); err == nil {
+		t.Error("morph without playback should fail")
+	}
+	handler.SetClock(&fakeClock{steps: 16})
+	for _, cmd := range []string{"morph chorus", "morph chorus 0", "morph nope 4", "morph stop"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+	if err := handler.ProcessCommand("morph chorus 4"); err != nil {
+		t.Fatalf("morph: %v", err)
+	}
+	if bpm := handler.pattern.GetBPM(); bpm != 95 {
+		t.Errorf("first stage tempo = %g, want 95 (a quarter of the way from 80 to 140)", bpm)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for running := true; running && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		handler.Update(func() error {
+			running = handler.morphStop != nil
+			return nil
+		})
+	}
+	if handler.pattern.String() != target.String() {
+		t.Errorf("after the morph: pattern =\n%s\nwant the target", handler.pattern)
+	}
+	if handler.patternName != "chorus" || handler.IsModified() {
+		t.Errorf("after the morph the pattern should be 'chorus', unmodified (name %q)", handler.patternName)
+	}
+}
+
+// mockLauncher implements Launcher for testing
+type mockLauncher struct{ cues int }
+
+func (m *mockLauncher) CueBar() { m.cues++ }
+
+func TestScene(t *testing.T) {
+	origScenes := ScenesFile
+	defer func() { ScenesFile = origScenes }()
+	ScenesFile = filepath.Join(t.TempDir(), "scenes.json")
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	for _, cmd := range []string{"set 1 C3", "set 5 E3", "mute-step 5", "tempo 128.5", "swing 30", "cc 74 90", "scene save 1"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+	}
+	saved := handler.pattern.String()
+	for _, cmd := range []string{"clear", "tempo 90", "swing 0", "cc 74 10", "scene save 2"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+	}
+
+	launcher := &mockLauncher{}
+	handler.SetLauncher(launcher)
+	if err := handler.ProcessCommand("scene launch 1"); err != nil {
+		t.Fatalf("scene launch: %v", err)
+	}
+	if launcher.cues != 1 {
+		t.Errorf("launch cued %d times, want 1", launcher.cues)
+	}
+	if got := handler.pattern.String(); got != saved {
+		t.Errorf("launched scene =\n%s\nwant\n%s", got, saved)
+	}
+	if step, _ := handler.pattern.GetStep(5); !step.Muted {
+		t.Error("step mutes should come back with the scene")
+	}
+	if value, ok := handler.pattern.GetGlobalCC(74); !ok || value != 90 {
+		t.Errorf("CC 74 = %d, want 90", value)
+	}
+
+	for _, cmd := range []string{"scene", "scene list", "scene delete 2"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: %v", cmd, err)
+		}
+	}
+	for _, cmd := range []string{"scene launch 2", "scene delete 2", "scene play 1", "scene save"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+// mockMuter implements Muter for testing
+type mockMuter struct{ muted bool }
+
+func (m *mockMuter) SetMuted(muted bool) { m.muted = muted }
+func (m *mockMuter) IsMuted() bool       { return m.muted }
+
+func TestPerformKeys(t *testing.T) {
+	origScenes := ScenesFile
+	defer func() { ScenesFile = origScenes }()
+	ScenesFile = filepath.Join(t.TempDir(), "scenes.json")
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.ProcessCommand("perform"); err == nil {
+		t.Error("perform outside the interactive prompt should fail")
+	}
+	for _, cmd := range []string{"set 1 C3", "set 9 G3 vel:90", "scene save 2", "tempo 140"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+	}
+	muter := &mockMuter{}
+	handler.SetMuter(muter)
+	handler.SetClock(&fakeClock{steps: 16})
+	p := &performer{h: handler}
+
+	p.key(' ')
+	if !muter.muted {
+		t.Error("space should mute")
+	}
+	p.key(' ')
+	if muter.muted {
+		t.Error("space again should unmute")
+	}
+
+	// Up a semitone, then up an octave: everything but the note stays
+	for _, r := range []rune{readline.CharPrev, readline.CharForward} {
+		p.key(r)
+	}
+	if step, _ := handler.pattern.GetStep(9); step.Note != 68 || step.Velocity != 90 {
+		t.Errorf("step 9 after transposing = %+v, want G#4 vel 90", step)
+	}
+	for _, r := range []rune{readline.CharNext, readline.CharBackward} {
+		p.key(r)
+	}
+	if p.transposed != 0 || handler.pattern.Steps[0].Note != 48 {
+		t.Errorf("transposing back: %+d, step 1 = %d", p.transposed, handler.pattern.Steps[0].Note)
+	}
+
+	p.key('2')
+	if handler.pattern.GetBPM() != 80 {
+		t.Errorf("key 2 should launch scene 2: tempo %g", handler.pattern.GetBPM())
+	}
+
+	p.key('f')
+	if handler.audition == nil || handler.pattern.Steps[15].IsRest {
+		t.Error("f should queue the fill for one loop")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for playing := true; playing && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		handler.Update(func() error {
+			playing = handler.audition != nil
+			return nil
+		})
+	}
+	if !handler.pattern.Steps[15].IsRest {
+		t.Error("the pattern should come back after the fill")
+	}
+}
+
+func TestSessions(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	handler.ProcessCommand("set 1 C3")
+	start := handler.pattern.String()
+	for _, cmd := range []string{"record-session jam", "set 5 E3", "tempo 100", "set 99 C3", "record-session jam2"} {
+		handler.ProcessCommand(cmd)
+	}
+	time.Sleep(30 * time.Millisecond)
+	for _, cmd := range []string{"velocity 5 90", "record-session stop"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+	}
+	end := handler.pattern.String()
+
+	s, err := loadSession("jam")
+	if err != nil {
+		t.Fatalf("loadSession: %v", err)
+	}
+	var got []string
+	for _, c := range s.Commands {
+		got = append(got, c.Command)
+	}
+	// Failed commands and recording controls are left out
+	if want := []string{"set 5 E3", "tempo 100", "velocity 5 90"}; !slices.Equal(got, want) {
+		t.Errorf("recorded %q, want %q", got, want)
+	}
+	if s.Commands[2].AtMs < 30 {
+		t.Errorf("last command at %dms, want at least 30ms", s.Commands[2].AtMs)
+	}
+
+	// Replaying restores the start and runs the commands on time
+	handler.ProcessCommand("clear")
+	began := time.Now()
+	if err := handler.ProcessCommand("replay-session jam"); err != nil {
+		t.Fatalf("replay-session: %v", err)
+	}
+	if got := handler.pattern.String(); got != start {
+		t.Errorf("replay should start from the recorded pattern, got\n%s", got)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for playing := true; playing && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		handler.Update(func() error {
+			playing = handler.replayStop != nil
+			return nil
+		})
+	}
+	if elapsed := time.Since(began); elapsed < 30*time.Millisecond {
+		t.Errorf("replay took %v, want at least 30ms", elapsed)
+	}
+	if got := handler.pattern.String(); got != end {
+		t.Errorf("after the replay:\n%s\nwant\n%s", got, end)
+	}
+
+	if err := handler.ProcessCommand("export session jam jam.txt"); err != nil {
+		t.Fatalf("export session: %v", err)
+	}
+	script, _ := os.ReadFile("jam.txt")
+	if !strings.Contains(string(script), "\nset 5 E3\n") || !strings.Contains(string(script), "\nsleep 0.") || !strings.HasSuffix(string(script), "velocity 5 90\n") {
+		t.Errorf("exported script:\n%s", script)
+	}
+
+	// A .mid file renders the performance, ending at the last tempo
+	if err := handler.ProcessCommand("export session jam jam.mid"); err != nil {
+		t.Fatalf("export session to MIDI: %v", err)
+	}
+	midi, _ := os.ReadFile("jam.mid")
+	if !bytes.HasPrefix(midi, []byte("MThd")) || !bytes.Contains(midi, []byte{0xFF, 0x51, 0x03, 0x09, 0x27, 0xC0}) {
+		t.Errorf("exported MIDI file has no 100 BPM tempo:\n% x", midi)
+	}
+
+	// Each loop plays the latest change before it; a change lasts a loop
+	// even when the session ends sooner
+	handler.ProcessCommand("tempo 120")
+	muted := handler.captureScene()
+	muted.Pattern.Tempo = 60
+	perf := &session{
+		Start:    handler.captureScene(),
+		LengthMs: 3000,
+		Changes:  []sessionChange{{AtMs: 1000, State: muted, Muted: true}},
+	}
+	loops, err := perf.performance()
+	if err != nil {
+		t.Fatalf("performance: %v", err)
+	}
+	if len(loops) != 2 || loops[0].GetBPM() != 120 || loops[1].GetBPM() != 60 {
+		t.Fatalf("performance has %d loops, want 120 then 60 BPM", len(loops))
+	}
+	if step, _ := loops[1].GetStep(1); !step.Muted {
+		t.Error("a muted change should mute the loop's steps")
+	}
+	if step, _ := loops[0].GetStep(1); step.Muted {
+		t.Error("loops before the mute should play")
+	}
+
+	for _, cmd := range []string{"record-session stop", "replay-session stop", "replay-session nope", "record-session ../x", "record-session"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+func TestAISong(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+	origUsage := ai.UsageFile
+	defer func() { ai.UsageFile = origUsage }()
+	ai.UsageFile = filepath.Join(t.TempDir(), "ai-usage.json")
+
+	calls := []struct{ name, args string }{
+		{"set_step", `{\"step\": 1, \"note\": \"C3\"}`}, // before any new_pattern: rejected
+		{"new_pattern", `{\"name\": \"intro\"}`},
+		{"set_step", `{\"step\": 1, \"note\": \"C3\"}`},
+		{"new_pattern", `{\"name\": \"drop\", \"from\": \"intro\"}`},
+		{"set_step", `{\"step\": 5, \"note\": \"G3\"}`},
+		{"arrange", `{\"name\": \"demo\", \"order\": \"intro*2 drop*4 nope\"}`}, // unknown pattern: rejected
+		{"arrange", `{\"name\": \"demo\", \"order\": \"intro*2 drop*4\"}`},
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := `{"choices":[{"delta":{"content":"A short song."},"finish_reason":"stop"}]}`
+		if requests < len(calls) {
+			call := calls[requests]
+			event = `{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"` + call.name + `","arguments":"` + call.args + `"}}]},"finish_reason":"tool_calls"}]}`
+		}
+		requests++
+		fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", event)
+	}))
+	defer server.Close()
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.SetAIModel("ollama:test"); err != nil {
+		t.Fatalf("SetAIModel: %v", err)
+	}
+	before := handler.pattern.String()
+	if err := handler.handleAISong([]string{"ai-song", "a", "short", "song"}); err != nil {
+		t.Fatalf("ai-song: %v", err)
+	}
+	if requests != len(calls)+1 {
+		t.Errorf("got %d requests, want %d", requests, len(calls)+1)
+	}
+
+	song, err := sequence.LoadSong("demo")
+	if err != nil {
+		t.Fatalf("LoadSong: %v", err)
+	}
+	if got := song.String(); got != "demo/intro*2 demo/drop*4" {
+		t.Errorf("song = %q", got)
+	}
+	intro, err := sequence.Load("demo/intro")
+	if err != nil {
+		t.Fatalf("Load(demo/intro): %v", err)
+	}
+	drop, err := sequence.Load("demo/drop")
+	if err != nil {
+		t.Fatalf("Load(demo/drop): %v", err)
+	}
+	// A new pattern starts empty; 'from' copies an earlier one
+	if intro.Steps[0].IsRest || !intro.Steps[4].IsRest || drop.Steps[0].IsRest || drop.Steps[4].IsRest {
+		t.Error("patterns should hold their own edits, with drop built on intro")
+	}
+	if handler.pattern.String() != before {
+		t.Error("ai-song should leave the current pattern alone")
+	}
+}
+
+func TestModelConfig(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.SetAIModel("ollama:test"); err != nil {
+		t.Fatalf("SetAIModel: %v", err)
+	}
+	if err := handler.handleModelConfig([]string{"model-config", "temperature", "0.2", "max-tokens", "800"}); err != nil {
+		t.Fatalf("model-config: %v", err)
+	}
+	params, _ := handler.aiClient.ModelParams()
+	if params.Temperature == nil || *params.Temperature != 0.2 || params.MaxTokens != 800 {
+		t.Errorf("params = %s", params)
+	}
+	for _, parts := range [][]string{
+		{"model-config", "thinking", "2000"}, // Claude only
+		{"model-config", "temperature"},
+		{"model-config", "temperature", "warm"},
+		{"model-config", "top-p", "0.9"},
+	} {
+		if err := handler.handleModelConfig(parts); err == nil {
+			t.Errorf("%v should fail", parts)
+		}
+	}
+	if err := handler.handleModelConfig([]string{"model-config", "temperature", "default"}); err != nil {
+		t.Fatalf("temperature default: %v", err)
+	}
+	if params, _ := handler.aiClient.ModelParams(); params.Temperature != nil || params.MaxTokens != 800 {
+		t.Errorf("after 'temperature default': %s", params)
+	}
+	if err := handler.handleModelConfig([]string{"model-config", "reset"}); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if params, _ := handler.aiClient.ModelParams(); params.MaxTokens != 0 {
+		t.Errorf("after reset: %s", params)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	var mu sync.Mutex
+	asked := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Model string }
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		asked[body.Model]++
+		mu.Unlock()
+		reply := "set 1 C3\nset 5 G3 vel:90 dur:2\nai make it louder"
+		if body.Model == "bad" {
+			reply = "Sure! A darker bassline:\nset 99 C3"
+		}
+		fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n", reply)
+	}))
+	defer server.Close()
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.SetAIModel("ollama:test"); err != nil {
+		t.Fatalf("SetAIModel: %v", err)
+	}
+	for _, parts := range [][]string{
+		{"compare"},
+		{"compare", "darker", "--runs", "0"},
+		{"compare", "darker", "--models"},
+		{"compare", "darker", "--models", "no-such-model"},
+	} {
+		if err := handler.handleCompare(parts); err == nil {
+			t.Errorf("%v: expected error", parts)
+		}
+	}
+
+	if err := handler.handleCompare([]string{"compare", "darker", "bassline", "--models", "ollama:a,ollama:b,ollama:bad", "--runs", "2"}); err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	if asked["a"] != 2 || asked["b"] != 2 || asked["bad"] != 2 {
+		t.Errorf("requests per model = %v, want 2 each", asked)
+	}
+	ids, err := comparison.List()
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("saved comparisons = %v, %v", ids, err)
+	}
+	c, err := comparison.Load(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Prompt != "darker bassline" || len(c.Results) != 6 || c.Results[3].Model != "ollama:b" || c.Results[3].Status != comparison.StatusOK {
+		t.Fatalf("comparison = %+v", c)
+	}
+
+	// Commands run through the handlers, so every argument counts; the AI
+	// can't start another request
+	result, err := sequence.FromPatternFile(c.Results[0].Pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step := result.Steps[4]; step.Note != 55 || step.Velocity != 90 || step.Duration != 2 {
+		t.Errorf("step 5 = %+v, want G3 vel 90 dur 2", step)
+	}
+	if len(c.Results[0].Failed) != 1 || !strings.HasPrefix(c.Results[0].Failed[0], "ai make it louder") {
+		t.Errorf("failed = %q", c.Results[0].Failed)
+	}
+	if r := c.Results[5]; r.Status != comparison.StatusParseError || r.Pattern != nil || !strings.HasPrefix(r.Raw, "Sure!") {
+		t.Errorf("unrunnable answer = %+v", r)
+	}
+	for _, parts := range [][]string{{"compare-list"}, {"compare-show", ids[0]}} {
+		if err := handler.ProcessCommand(strings.Join(parts, " ")); err != nil {
+			t.Errorf("%v: %v", parts, err)
+		}
+	}
+	if !handler.pattern.Steps[0].IsRest {
+		t.Error("compare should leave the pattern alone")
+	}
+
+	// Auditioning a result plays it, then brings the working pattern back
+	working := handler.pattern.String()
+	if err := handler.ProcessCommand("compare-play " + ids[0] + " A"); err == nil {
+		t.Error("compare-play without playback should fail")
+	}
+	handler.SetClock(&fakeClock{steps: 16})
+	for _, cmd := range []string{"compare-play " + ids[0] + " bad", "compare-play " + ids[0] + " A 0", "compare-play stop"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+	if err := handler.ProcessCommand("compare-play " + ids[0] + " ollama:b#2 3"); err != nil {
+		t.Fatalf("compare-play: %v", err)
+	}
+	if handler.pattern.Steps[0].IsRest {
+		t.Error("compare-play should queue the result's pattern")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for playing := true; playing && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		handler.Update(func() error {
+			playing = handler.audition != nil
+			return nil
+		})
+	}
+	if got := handler.pattern.String(); got != working {
+		t.Errorf("after the audition: pattern =\n%s\nwant the working pattern back", got)
+	}
+}
+
+func TestCompareResultCommands(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	handler.pattern.SetNote(1, 36)
+	if err := handler.ProcessCommand("save mybeat"); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(sequence.Path("mybeat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An answer is free text: only pattern edits run, so it can't touch
+	// saved patterns or the AI's guard
+	c := &comparison.Comparison{ID: "test", Results: []comparison.Result{{
+		Model:  "ollama:test",
+		Status: comparison.StatusOK,
+		Commands: []string{
+			"set 1 C3",
+			"save mybeat",
+			"ai-allow delete",
+			"delete mybeat",
+			"hooks",
+		},
+	}}}
+	handler.runResults(c)
+
+	r := c.Results[0]
+	if r.Status != comparison.StatusOK || len(r.Failed) != 4 {
+		t.Fatalf("result = %+v, want all but set to fail", r)
+	}
+	if data, err := os.ReadFile(sequence.Path("mybeat")); err != nil || !bytes.Equal(data, saved) {
+		t.Errorf("saved pattern changed: %v", err)
+	}
+	if handler.aiAllowed["delete"] {
+		t.Error("a result must not change which commands the AI may run")
+	}
+	for _, name := range ai.ToolCommands() {
+		if _, ok := lookupCommand(name); !ok {
+			t.Errorf("tool command %q is not a command", name)
+		}
+	}
+}
+
+func TestCompareBatch(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	var mu sync.Mutex
+	asked := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		asked++
+		mu.Unlock()
+		fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n", "set 1 C3")
+	}))
+	defer server.Close()
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	if err := handler.SetAIModel("ollama:test"); err != nil {
+		t.Fatalf("SetAIModel: %v", err)
+	}
+	os.WriteFile("empty.txt", []byte("# nothing yet\n\n"), 0644)
+	os.WriteFile("suite.txt", []byte("# bass\ndarker bassline\n\n  more   swing \ndarker bassline\n"), 0644)
+	for _, cmd := range []string{"compare-batch", "compare-batch missing.txt", "compare-batch empty.txt", "compare-batch suite.txt other.txt"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+
+	if err := handler.ProcessCommand("compare-batch suite.txt --models ollama:a,ollama:b"); err != nil {
+		t.Fatalf("compare-batch: %v", err)
+	}
+	if asked != 4 {
+		t.Errorf("asked %d times, want 2 prompts x 2 models", asked)
+	}
+
+	// Running the batch again only compares the prompts added since
+	os.WriteFile("suite.txt", []byte("darker bassline\nmore swing\nhalf time\n"), 0644)
+	if err := handler.ProcessCommand("compare-batch suite.txt --models ollama:a,ollama:b --blind"); err != nil {
+		t.Fatalf("compare-batch again: %v", err)
+	}
+	if asked != 6 {
+		t.Errorf("asked %d times after resuming, want 6", asked)
+	}
+	all, err := comparison.LoadAll()
+	if err != nil || len(all) != 3 {
+		t.Fatalf("saved comparisons = %d, %v", len(all), err)
+	}
+	if c := all[1]; c.Batch != "suite" || c.Prompt != "more swing" || c.Blind {
+		t.Errorf("second comparison = %+v", c)
+	}
+	if c := all[2]; c.Prompt != "half time" || !c.Blind {
+		t.Errorf("resumed comparison = %+v", c)
+	}
+}
+
+func TestAudition(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	handler := New(sequence.New(16), &mockVerboseController{})
+	c := &comparison.Comparison{ID: "blind", Prompt: "darker", Created: time.Now(), Models: []string{"ollama:a", "ollama:b"}, Runs: 1}
+	for i, model := range c.Models {
+		p := sequence.New(16)
+		p.SetNote(i+1, 36)
+		c.Results = append(c.Results, comparison.Result{Model: model, Run: 1, Status: comparison.StatusOK, Pattern: p.ToPatternFile("")})
+	}
+	c.Results = append(c.Results, comparison.Result{Model: "ollama:c", Run: 1, Status: comparison.StatusTimeout})
+	c.Blindfold()
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := handler.ProcessCommand("audition blind"); err == nil {
+		t.Error("audition without playback should fail")
+	}
+	handler.SetClock(&fakeClock{steps: 16})
+	if err := handler.ProcessCommand("compare-play blind ollama:a"); err == nil {
+		t.Error("a blind comparison should only take labels")
+	}
+	working := handler.pattern.String()
+	if err := handler.ProcessCommand("audition blind 2"); err != nil {
+		t.Fatalf("audition: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for playing := true; playing && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		handler.Update(func() error {
+			playing = handler.audition != nil
+			return nil
+		})
+	}
+	if got := handler.pattern.String(); got != working {
+		t.Errorf("after the audition: pattern =\n%s\nwant the working pattern back", got)
+	}
+
+	for _, cmd := range []string{"compare-vote blind A B", "compare-vote blind C B tie", "compare-rankings"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: %v", cmd, err)
+		}
+	}
+	for _, cmd := range []string{"compare-vote blind A A", "compare-vote blind A B maybe", "compare-vote blind A"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+	if rankings, err := comparison.LoadRankings(); err != nil || len(rankings) != 3 || rankings[0].Wins != 1 {
+		t.Errorf("rankings = %+v, %v", rankings, err)
+	}
+
+	// A blind evaluation picks up with the answers not rated yet
+	playable := slices.IndexFunc(c.Results, func(r comparison.Result) bool { return r.Pattern != nil })
+	if err := handler.ProcessCommand("compare-rate blind " + comparison.Label(playable) + " 3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.ProcessCommand("blind-resume blind 1"); err != nil {
+		t.Fatalf("blind-resume: %v", err)
+	}
+	handler.Update(func() error {
+		if handler.audition == nil || len(handler.audition.patterns) != 1 {
+			t.Errorf("blind-resume should audition the one unrated answer, got %+v", handler.audition)
+		}
+		return nil
+	})
+	if err := handler.ProcessCommand("audition stop"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := handler.ProcessCommand("compare-reveal blind"); err != nil {
+		t.Fatalf("compare-reveal: %v", err)
+	}
+	if err := handler.ProcessCommand("blind-resume blind"); err == nil {
+		t.Error("blind-resume after compare-reveal should fail")
+	}
+
+	for _, cmd := range []string{"compare-prune", "compare-prune --older-than soon", "compare-archive", "compare-archive missing"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+	for _, cmd := range []string{"compare-list", "compare-prune --older-than 30d"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: %v", cmd, err)
+		}
+	}
+	if _, err := comparison.Load("blind"); err != nil {
+		t.Errorf("a new comparison shouldn't be pruned: %v", err)
+	}
+	if revealed, err := comparison.Load("blind"); err != nil || revealed.Blind {
+		t.Errorf("after compare-reveal: %+v, %v", revealed, err)
+	}
+	if err := handler.ProcessCommand("compare-reveal blind"); err == nil {
+		t.Error("revealing twice should fail")
+	}
+
+	for _, cmd := range []string{"compare-rate blind A 4", "compare-rate blind ollama:b 5 Groove", "compare-stats", "compare-stats --export stats.md"} {
+		if err := handler.ProcessCommand(cmd); err != nil {
+			t.Errorf("%s: %v", cmd, err)
+		}
+	}
+	for _, cmd := range []string{"compare-rate blind A 0", "compare-rate blind Z 3", "compare-stats --export stats.txt"} {
+		if err := handler.ProcessCommand(cmd); err == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+	rated, _ := comparison.Load("blind")
+	if i, _ := rated.Find("ollama:b"); rated.Results[i].Ratings["groove"] != 5 {
+		t.Errorf("ratings of ollama:b = %v", rated.Results[i].Ratings)
+	}
+	if data, err := os.ReadFile("stats.md"); err != nil || !strings.Contains(string(data), "| ollama:b | 1 | 1 |") {
+		t.Errorf("exported stats = %q, %v", data, err)
+	}
+}
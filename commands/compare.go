@@ -0,0 +1,896 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iltempo/interplay/ai"
+	"github.com/iltempo/interplay/comparison"
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+const compareUsage = "usage: compare <prompt> [--models <model,...>] [--runs <n>] [--blind] (e.g., 'compare darker bassline --models haiku,sonnet --runs 3')"
+
+// maxCompareRuns limits how often each model is asked in one comparison
+const maxCompareRuns = 10
+
+// compareOptions are the options compare and compare-batch share
+type compareOptions struct {
+	words  []string // the rest of the command line
+	models []string // as named, see compareModels
+	runs   int
+	blind  bool
+}
+
+// parseCompareOptions parses --models, --runs and --blind out of parts,
+// failing with usage if an option lacks its value
+func parseCompareOptions(parts []string, usage string) (compareOptions, error) {
+	opts := compareOptions{runs: 1}
+	for i := 1; i < len(parts); i++ {
+		switch parts[i] {
+		case "--blind":
+			opts.blind = true
+		case "--models":
+			if i+1 == len(parts) {
+				return opts, errors.New(usage)
+			}
+			i++
+			opts.models = append(opts.models, strings.Split(parts[i], ",")...)
+		case "--runs":
+			if i+1 == len(parts) {
+				return opts, errors.New(usage)
+			}
+			i++
+			n, err := strconv.Atoi(parts[i])
+			if err != nil || n < 1 || n > maxCompareRuns {
+				return opts, fmt.Errorf("runs must be 1-%d, got %s", maxCompareRuns, parts[i])
+			}
+			opts.runs = n
+		default:
+			opts.words = append(opts.words, parts[i])
+		}
+	}
+	if len(opts.words) == 0 {
+		return opts, errors.New(usage)
+	}
+	return opts, nil
+}
+
+// handleCompare: compare <prompt> [--models <model,...>] [--runs <n>] [--blind]
+// - ask several models the same request and save their answers
+func (h *Handler) handleCompare(parts []string) error {
+	if h.aiClient == nil {
+		return errAIUnavailable
+	}
+	opts, err := parseCompareOptions(parts, compareUsage)
+	if err != nil {
+		return err
+	}
+	models, err := compareModels(opts.models, h.aiClient.Model())
+	if err != nil {
+		return err
+	}
+	runs := opts.runs
+
+	ctx, done := h.startAIRequest(context.Background())
+	defer done()
+	h.aiClient.SetRecentCommands(h.recentCommands)
+	fmt.Fprintf(h.out, "Asking %s", strings.Join(models, ", "))
+	if runs > 1 {
+		fmt.Fprintf(h.out, " (%d runs each)", runs)
+	}
+	fmt.Fprintln(h.out, "...")
+	c := comparison.Run(ctx, h.aiClient, strings.Join(opts.words, " "), h.pattern, models, runs, 0)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		fmt.Fprintln(h.out, theme.Warning("Comparison cancelled"))
+		return nil
+	}
+
+	h.runResults(c)
+	if opts.blind {
+		c.Blindfold()
+	}
+	printComparison(h.out, c)
+	if err := c.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(h.out, "Saved comparison %s\n", c.ID)
+	return nil
+}
+
+const compareBatchUsage = "usage: compare-batch <file> [--models <model,...>] [--runs <n>] [--blind] (e.g., 'compare-batch prompts.txt --models haiku,sonnet')"
+
+// handleCompareBatch: compare-batch <file> [--models <model,...>] [--runs <n>]
+// [--blind] - compare the models on every prompt in a file, one per line.
+// Each prompt is saved as a comparison of the batch as soon as it is done,
+// so running the batch again picks up where it stopped.
+func (h *Handler) handleCompareBatch(parts []string) error {
+	if h.aiClient == nil {
+		return errAIUnavailable
+	}
+	opts, err := parseCompareOptions(parts, compareBatchUsage)
+	if err != nil {
+		return err
+	}
+	if len(opts.words) != 1 {
+		return errors.New(compareBatchUsage)
+	}
+	file := opts.words[0]
+	prompts, err := readPrompts(file)
+	if err != nil {
+		return err
+	}
+	models, err := compareModels(opts.models, h.aiClient.Model())
+	if err != nil {
+		return err
+	}
+	batch := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	done, err := comparison.Batched(batch)
+	if err != nil {
+		return err
+	}
+
+	ctx, finish := h.startAIRequest(context.Background())
+	defer finish()
+	h.aiClient.SetRecentCommands(h.recentCommands)
+	fmt.Fprintf(h.out, "Batch %s: %d prompts, asking %s\n", batch, len(prompts), strings.Join(models, ", "))
+	saved := 0
+	for i, prompt := range prompts {
+		progress := fmt.Sprintf("[%d/%d]", i+1, len(prompts))
+		if done[prompt] {
+			fmt.Fprintln(h.out, theme.Dim(fmt.Sprintf("%s %s: done before", progress, prompt)))
+			continue
+		}
+		fmt.Fprintf(h.out, "%s %s ... ", progress, prompt)
+		c := comparison.Run(ctx, h.aiClient, prompt, h.pattern, models, opts.runs, 0)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			fmt.Fprintln(h.out)
+			fmt.Fprintln(h.out, theme.Warning(fmt.Sprintf("Batch cancelled after %d new comparisons; run it again to resume", saved)))
+			return nil
+		}
+		h.runResults(c)
+		if opts.blind {
+			c.Blindfold()
+		}
+		c.Batch = batch
+		if err := c.Save(); err != nil {
+			return err
+		}
+		saved++
+		ok := 0
+		for _, r := range c.Results {
+			if r.Status == comparison.StatusOK {
+				ok++
+			}
+		}
+		fmt.Fprintf(h.out, "%d/%d answers ok, saved %s\n", ok, len(c.Results), c.ID)
+	}
+	fmt.Fprintf(h.out, "Batch %s done: %d new comparisons\n", batch, saved)
+	return nil
+}
+
+// readPrompts reads a prompt file: one prompt per line, skipping blank
+// lines and # comments, and each prompt only once
+func readPrompts(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt file: %w", err)
+	}
+	var prompts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		prompt := strings.Join(strings.Fields(line), " ")
+		if prompt == "" || strings.HasPrefix(prompt, "#") || slices.Contains(prompts, prompt) {
+			continue
+		}
+		prompts = append(prompts, prompt)
+	}
+	if len(prompts) == 0 {
+		return nil, fmt.Errorf("no prompts in %s", file)
+	}
+	return prompts, nil
+}
+
+// compareModels resolves the models named for a comparison; without names
+// it compares the selected model with each vendor's default one
+func compareModels(names []string, selected string) ([]string, error) {
+	var models []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		model, err := ai.ResolveModel(name)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	if len(names) == 0 {
+		models = append([]string{selected}, ai.DefaultModels()...)
+	}
+	models = slices.Compact(models)
+	if len(models) == 0 {
+		return nil, errors.New(compareUsage)
+	}
+	return models, nil
+}
+
+// runResults runs each answer's commands on its own copy of the pattern,
+// through the same handlers as the AI's tool calls, keeping the pattern
+// they make and the commands that failed. An answer none of whose commands
+// run counts as a parse error. Only the pattern edits the AI's tools make
+// are run, see runResultCommand.
+func (h *Handler) runResults(c *comparison.Comparison) {
+	for i := range c.Results {
+		r := &c.Results[i]
+		if r.Status != comparison.StatusOK {
+			continue
+		}
+		preview := h.previewHandler()
+		for _, cmd := range r.Commands {
+			if err := preview.runResultCommand(strings.Fields(cmd)); err != nil {
+				r.Failed = append(r.Failed, fmt.Sprintf("%s: %v", cmd, err))
+			}
+		}
+		if len(r.Failed) == len(r.Commands) {
+			r.Status = comparison.StatusParseError
+			continue
+		}
+		r.Pattern = preview.pattern.ToPatternFile(fmt.Sprintf("%s %s #%d", c.ID, r.Model, r.Run))
+	}
+}
+
+// runResultCommand runs a command from a model's answer if it is one of
+// the pattern edits offered as tools. An answer is free text, so anything
+// else (save, delete, ai-allow, ...) is refused rather than run.
+func (h *Handler) runResultCommand(parts []string) error {
+	if len(parts) == 0 {
+		return errors.New("empty command")
+	}
+	if command, ok := lookupCommand(parts[0]); ok && !slices.Contains(ai.ToolCommands(), command.Name) {
+		return fmt.Errorf("'%s' is not a pattern edit", command.Name)
+	}
+	return h.runAICommand(parts)
+}
+
+// printComparison shows each model's answer; a blind comparison shows
+// labels instead of models, and no latencies, which could give them away
+func printComparison(w io.Writer, c *comparison.Comparison) {
+	fmt.Fprintf(w, "Comparison %s: %q\n", c.ID, c.Prompt)
+	if c.Blind {
+		fmt.Fprintln(w, theme.Dim("  Blind: listen with 'audition', then 'compare-reveal' shows the models"))
+	}
+	for i, r := range c.Results {
+		if c.Blind {
+			fmt.Fprintf(w, "  %-3s %s\n", comparison.Label(i), r.Status)
+		} else {
+			fmt.Fprintf(w, "  %-3s %-30s %-11s %6.1fs\n", comparison.Label(i), resultName(c, i), r.Status, float64(r.LatencyMs)/1000)
+		}
+		switch r.Status {
+		case comparison.StatusOK:
+			for _, cmd := range r.Commands {
+				fmt.Fprintln(w, theme.Dim("    "+cmd))
+			}
+			for _, failure := range r.Failed {
+				fmt.Fprintln(w, theme.Error("    "+failure))
+			}
+		case comparison.StatusParseError:
+			fmt.Fprintln(w, theme.Dim("    "+truncate(strings.Join(strings.Fields(r.Raw), " "), 100)))
+		default:
+			fmt.Fprintln(w, theme.Error("    "+r.Error))
+		}
+	}
+}
+
+// resultName names result i by its model, and its run if there are several
+func resultName(c *comparison.Comparison, i int) string {
+	r := c.Results[i]
+	if c.Runs > 1 {
+		return fmt.Sprintf("%s #%d", r.Model, r.Run)
+	}
+	return r.Model
+}
+
+// truncate shortens s to at most n runes, marking the cut with "..."
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// handleCompareList: compare-list - list saved comparisons
+func (h *Handler) handleCompareList(parts []string) error {
+	if len(parts) != 1 {
+		return fmt.Errorf("usage: compare-list")
+	}
+	ids, err := comparison.List()
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(h.out, "No saved comparisons")
+		return nil
+	}
+	var total int64
+	for _, id := range ids {
+		size, _ := comparison.Size(id)
+		total += size
+		c, err := comparison.Load(id)
+		if err != nil {
+			fmt.Fprintln(h.out, theme.Error(fmt.Sprintf("  %s: %v", id, err)))
+			continue
+		}
+		fmt.Fprintf(h.out, "  %-18s %8s  %-40s %s", id, formatSize(size), truncate(c.Prompt, 40), strings.Join(c.Models, ", "))
+		if c.Blind {
+			rated := 0
+			for _, r := range c.Results {
+				if len(r.Ratings) > 0 {
+					rated++
+				}
+			}
+			fmt.Fprint(h.out, theme.Dim(fmt.Sprintf("  blind, %d/%d rated", rated, len(c.Results))))
+		}
+		fmt.Fprintln(h.out)
+	}
+	summary := fmt.Sprintf("%d comparisons, %s", len(ids), formatSize(total))
+	if archived, err := comparison.ArchiveSize(); err == nil && archived > 0 {
+		summary += fmt.Sprintf(" (archive: %s)", formatSize(archived))
+	}
+	fmt.Fprintln(h.out, theme.Dim(summary))
+	return nil
+}
+
+// formatSize formats a file size: 512 B, 3.4 kB, 1.2 MB
+func formatSize(n int64) string {
+	switch {
+	case n < 1000:
+		return fmt.Sprintf("%d B", n)
+	case n < 1000*1000:
+		return fmt.Sprintf("%.1f kB", float64(n)/1000)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1000*1000))
+	}
+}
+
+// handleComparePrune: compare-prune --older-than <age> - delete comparisons
+// made longer ago than age (30d, 2w, 12h)
+func (h *Handler) handleComparePrune(parts []string) error {
+	if len(parts) != 3 || parts[1] != "--older-than" {
+		return fmt.Errorf("usage: compare-prune --older-than <age> (e.g., 'compare-prune --older-than 30d')")
+	}
+	age, err := comparison.ParseAge(parts[2])
+	if err != nil {
+		return err
+	}
+	ids, err := comparison.OlderThan(age)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		fmt.Fprintf(h.out, "No comparisons older than %s\n", parts[2])
+		return nil
+	}
+
+	var total int64
+	for _, id := range ids {
+		size, _ := comparison.Size(id)
+		total += size
+	}
+	fmt.Fprintf(h.out, "%d comparisons older than %s (%s), with their ratings\n", len(ids), parts[2], formatSize(total))
+	if h.readLine != nil {
+		answer, err := h.readLine("Delete them? (y/n) ")
+		if answer = strings.ToLower(strings.TrimSpace(answer)); err != nil || (answer != "y" && answer != "yes") {
+			fmt.Fprintln(h.out, "Kept them ('compare-archive <id>' keeps one compressed)")
+			return nil
+		}
+	}
+	for _, id := range ids {
+		if err := comparison.Delete(id); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(h.out, "Deleted %d comparisons, freeing %s\n", len(ids), formatSize(total))
+	return nil
+}
+
+// handleCompareArchive: compare-archive <id>... - compress comparisons into
+// the archive, out of compare-list and compare-stats
+func (h *Handler) handleCompareArchive(parts []string) error {
+	if len(parts) < 2 {
+		return fmt.Errorf("usage: compare-archive <id>... (e.g., 'compare-archive 20250301-142233')")
+	}
+	for _, id := range parts[1:] {
+		size, err := comparison.Size(id)
+		if err != nil {
+			return err
+		}
+		archived, err := comparison.Archive(id)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h.out, "Archived %s: %s → %s\n", id, formatSize(size), formatSize(archived))
+	}
+	return nil
+}
+
+// handleCompareShow: compare-show <id> - show a saved comparison
+func (h *Handler) handleCompareShow(parts []string) error {
+	if len(parts) != 2 {
+		return fmt.Errorf("usage: compare-show <id>")
+	}
+	c, err := comparison.Load(parts[1])
+	if err != nil {
+		return err
+	}
+	printComparison(h.out, c)
+	return nil
+}
+
+// handleCompareReveal: compare-reveal <id> - show which model gave each
+// answer of a blind comparison
+func (h *Handler) handleCompareReveal(parts []string) error {
+	if len(parts) != 2 {
+		return fmt.Errorf("usage: compare-reveal <id>")
+	}
+	c, err := comparison.Load(parts[1])
+	if err != nil {
+		return err
+	}
+	if !c.Blind {
+		return fmt.Errorf("comparison %s is not blind", c.ID)
+	}
+	c.Blind = false
+	if err := c.Save(); err != nil {
+		return err
+	}
+	printComparison(h.out, c)
+	return nil
+}
+
+// Loops each result plays unless told: 'compare-play' plays one result,
+// 'audition' rotates through them all
+const (
+	defaultPlayLoops     = 2
+	defaultAuditionLoops = 4
+)
+
+// audition plays comparison results in place of the working pattern, one
+// after the other, then queues the working pattern again
+type audition struct {
+	stop     chan struct{}
+	working  *sequence.Pattern   // the pattern to go back to
+	patterns []*sequence.Pattern // results to play, in order
+	names    []string            // announced as each result starts ("" for none)
+	loops    int                 // loops per result
+}
+
+// handleComparePlay: compare-play <id> <label|model> [loops] | compare-play stop
+// - play a result's pattern for a few loops, then the working pattern again
+func (h *Handler) handleComparePlay(parts []string) error {
+	if len(parts) == 2 && parts[1] == "stop" {
+		return h.endAudition()
+	}
+	if len(parts) < 3 || len(parts) > 4 {
+		return fmt.Errorf("usage: compare-play <id> <label|model> [loops] (e.g., 'compare-play 20250301-142233 B 4'), or compare-play stop")
+	}
+	loops, err := auditionLoops(parts[3:], defaultPlayLoops)
+	if err != nil {
+		return err
+	}
+	if h.clock == nil {
+		return fmt.Errorf("'compare-play' requires playback to be running")
+	}
+
+	c, err := comparison.Load(parts[1])
+	if err != nil {
+		return err
+	}
+	i, err := c.Find(parts[2])
+	if err != nil {
+		return err
+	}
+	if c.Results[i].Pattern == nil {
+		return fmt.Errorf("%s has no pattern to play: %s", describeResult(c, i), c.Results[i].Status)
+	}
+	p, err := sequence.FromPatternFile(c.Results[i].Pattern)
+	if err != nil {
+		return err
+	}
+
+	h.startAudition([]*sequence.Pattern{p}, []string{""}, loops)
+	fmt.Fprintf(h.out, "Playing %s from the next loop for %d loops, then your pattern again\n", describeResult(c, i), loops)
+	return nil
+}
+
+// handleAudition: audition <id> [loops] | audition stop - play every
+// result of a comparison in turn, announcing each, then the working pattern
+func (h *Handler) handleAudition(parts []string) error {
+	if len(parts) == 2 && parts[1] == "stop" {
+		return h.endAudition()
+	}
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("usage: audition <id> [loops per result] (e.g., 'audition 20250301-142233 4'), or audition stop")
+	}
+	loops, err := auditionLoops(parts[2:], defaultAuditionLoops)
+	if err != nil {
+		return err
+	}
+	if h.clock == nil {
+		return fmt.Errorf("'audition' requires playback to be running")
+	}
+
+	c, err := comparison.Load(parts[1])
+	if err != nil {
+		return err
+	}
+	all := make([]int, len(c.Results))
+	for i := range all {
+		all[i] = i
+	}
+	n, err := h.auditionResults(c, all, loops)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("comparison %s has no patterns to play", c.ID)
+	}
+	fmt.Fprintf(h.out, "Playing %d results from the next loop, %d loops each, then your pattern again ('audition stop' to end early)\n", n, loops)
+	return nil
+}
+
+// handleBlindResume: blind-resume <id> [loops] - pick up rating a blind
+// comparison: audition the answers not rated yet
+func (h *Handler) handleBlindResume(parts []string) error {
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("usage: blind-resume <id> [loops per result] (e.g., 'blind-resume 20250301-142233')")
+	}
+	loops, err := auditionLoops(parts[2:], defaultAuditionLoops)
+	if err != nil {
+		return err
+	}
+	if h.clock == nil {
+		return fmt.Errorf("'blind-resume' requires playback to be running")
+	}
+	c, err := comparison.Load(parts[1])
+	if err != nil {
+		return err
+	}
+	if !c.Blind {
+		return fmt.Errorf("comparison %s is not blind (any more)", c.ID)
+	}
+
+	var playable, unrated []int
+	for i, r := range c.Results {
+		if r.Pattern == nil {
+			continue
+		}
+		playable = append(playable, i)
+		if len(r.Ratings) == 0 {
+			unrated = append(unrated, i)
+		}
+	}
+	fmt.Fprintf(h.out, "Comparison %s: %q, %d of %d answers rated\n", c.ID, c.Prompt, len(playable)-len(unrated), len(playable))
+	if len(unrated) == 0 {
+		fmt.Fprintf(h.out, "All answers are rated: 'compare-reveal %s' shows the models\n", c.ID)
+		return nil
+	}
+	if _, err := h.auditionResults(c, unrated, loops); err != nil {
+		return err
+	}
+	labels := make([]string, len(unrated))
+	for i, r := range unrated {
+		labels[i] = comparison.Label(r)
+	}
+	fmt.Fprintf(h.out, "Playing %s from the next loop, %d loops each; rate them with 'compare-rate %s <label> <1-5>'\n", strings.Join(labels, ", "), loops, c.ID)
+	return nil
+}
+
+// auditionResults starts auditioning the results of c at the given
+// indices that have a pattern, returning how many will play
+func (h *Handler) auditionResults(c *comparison.Comparison, indices []int, loops int) (int, error) {
+	var patterns []*sequence.Pattern
+	var names []string
+	for _, i := range indices {
+		r := c.Results[i]
+		if r.Pattern == nil {
+			continue
+		}
+		p, err := sequence.FromPatternFile(r.Pattern)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", comparison.Label(i), err)
+		}
+		patterns = append(patterns, p)
+		names = append(names, describeResult(c, i))
+	}
+	if len(patterns) == 0 {
+		return 0, nil
+	}
+	for i := range names {
+		names[i] = fmt.Sprintf("Now playing %s (%d/%d)", names[i], i+1, len(names))
+	}
+	h.startAudition(patterns, names, loops)
+	return len(patterns), nil
+}
+
+// auditionLoops reads an optional loop count
+func auditionLoops(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("loops must be a positive number, got %s", args[0])
+	}
+	return n, nil
+}
+
+// describeResult names result i by its label and, unless the comparison is
+// blind, its model
+func describeResult(c *comparison.Comparison, i int) string {
+	if c.Blind {
+		return comparison.Label(i)
+	}
+	return fmt.Sprintf("%s (%s)", comparison.Label(i), resultName(c, i))
+}
+
+// startAudition queues the first pattern and follows the clock through the
+// rest. A running song or audition stops, keeping the pattern to go back to.
+func (h *Handler) startAudition(patterns []*sequence.Pattern, names []string, loops int) {
+	h.stopSong()
+	h.stopMorph()
+	working := h.pattern.Clone()
+	if h.audition != nil {
+		working = h.audition.working
+		h.stopAudition()
+	}
+	h.audition = &audition{stop: make(chan struct{}), working: working, patterns: patterns, names: names, loops: loops}
+	h.pattern.CopyFrom(patterns[0])
+	go h.runAudition(h.audition)
+}
+
+// endAudition stops the audition and queues the working pattern again
+func (h *Handler) endAudition() error {
+	if h.audition == nil {
+		return fmt.Errorf("no comparison result playing")
+	}
+	h.pattern.CopyFrom(h.audition.working)
+	h.stopAudition()
+	fmt.Fprintln(h.out, "Back to your pattern from the next loop")
+	return nil
+}
+
+// runAudition follows the playback clock, announcing each pattern as it
+// starts and queuing the next one (or the working pattern) during its last
+// loop, unless the audition is stopped first
+func (h *Handler) runAudition(a *audition) {
+	events := h.clock.Subscribe(waitEventBuffer)
+	defer h.clock.Unsubscribe(events)
+
+	part, left := 0, -1
+	for {
+		select {
+		case <-a.stop:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if ev.Type != playback.EventLoop {
+				continue
+			}
+		}
+		if left < 0 {
+			left = a.loops // the pattern has started
+			if a.names[part] != "" {
+				fmt.Fprintln(h.out, theme.Header(a.names[part]))
+			}
+		}
+		if left--; left > 0 {
+			continue
+		}
+		part, left = part+1, -1
+		done := part == len(a.patterns)
+		h.Update(func() error {
+			switch {
+			case h.audition != a:
+			case done:
+				h.pattern.CopyFrom(a.working)
+				h.audition = nil
+				fmt.Fprintln(h.out, theme.Dim("Back to your pattern from the next loop"))
+			default:
+				h.pattern.CopyFrom(a.patterns[part])
+			}
+			return nil
+		})
+		if done {
+			return
+		}
+	}
+}
+
+func (h *Handler) stopAudition() {
+	if h.audition == nil {
+		return
+	}
+	close(h.audition.stop)
+	h.audition = nil
+}
+
+// handleCompareRate: compare-rate <id> <label|model> <1-5> [criterion] -
+// rate an answer, overall unless a criterion like groove is named
+func (h *Handler) handleCompareRate(parts []string) error {
+	if len(parts) < 4 || len(parts) > 5 {
+		return fmt.Errorf("usage: compare-rate <id> <label|model> <1-5> [criterion] (e.g., 'compare-rate 20250301-142233 B 4 groove')")
+	}
+	c, err := comparison.Load(parts[1])
+	if err != nil {
+		return err
+	}
+	i, err := c.Find(parts[2])
+	if err != nil {
+		return err
+	}
+	score, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return fmt.Errorf("rating must be 1-5, got %s", parts[3])
+	}
+	criterion := comparison.Overall
+	if len(parts) == 5 {
+		criterion = strings.ToLower(parts[4])
+	}
+	if err := c.Results[i].Rate(criterion, score); err != nil {
+		return err
+	}
+	if err := c.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(h.out, "Rated %s %d/5 for %s\n", describeResult(c, i), score, criterion)
+	return nil
+}
+
+// handleCompareStats: compare-stats [--export <file.csv|file.md>] - sum up
+// all saved comparisons per model
+func (h *Handler) handleCompareStats(parts []string) error {
+	export := ""
+	switch {
+	case len(parts) == 3 && parts[1] == "--export":
+		export = parts[2]
+	case len(parts) != 1:
+		return fmt.Errorf("usage: compare-stats [--export <file.csv|file.md>]")
+	}
+	all, err := comparison.LoadAll()
+	if err != nil {
+		return err
+	}
+	stats, criteria := comparison.Stats(all)
+	if len(stats) == 0 {
+		fmt.Fprintln(h.out, "No saved comparisons")
+		return nil
+	}
+
+	if export != "" {
+		write := comparison.WriteMarkdown
+		switch strings.ToLower(filepath.Ext(export)) {
+		case ".csv":
+			write = comparison.WriteCSV
+		case ".md", ".markdown":
+		default:
+			return fmt.Errorf("export to a .csv or .md file, got %s", export)
+		}
+		f, err := os.Create(export)
+		if err != nil {
+			return fmt.Errorf("failed to export stats: %w", err)
+		}
+		defer f.Close()
+		if err := write(f, stats, criteria); err != nil {
+			return fmt.Errorf("failed to export stats: %w", err)
+		}
+		fmt.Fprintf(h.out, "Exported stats of %d comparisons to %s\n", len(all), export)
+		return nil
+	}
+
+	fmt.Fprintf(h.out, "Models across %d comparisons (ratings are means of 1-5):\n", len(all))
+	w := tabwriter.NewWriter(h.out, 0, 0, 2, ' ', 0)
+	header := []string{"MODEL", "ANSWERS", "OK", "WINS", "LATENCY", "MEDIAN"}
+	for _, criterion := range criteria {
+		header = append(header, strings.ToUpper(criterion))
+	}
+	fmt.Fprintln(w, "  "+strings.Join(header, "\t"))
+	for _, s := range stats {
+		row := []string{
+			s.Model,
+			strconv.Itoa(s.Answers),
+			fmt.Sprintf("%d%%", s.OK*100/s.Answers),
+			strconv.Itoa(s.Wins),
+			s.MeanLatency.Round(100 * time.Millisecond).String(),
+			s.MedianLatency.Round(100 * time.Millisecond).String(),
+		}
+		for _, criterion := range criteria {
+			if s.Rated[criterion] == 0 {
+				row = append(row, "-")
+			} else {
+				row = append(row, fmt.Sprintf("%.1f (%d)", s.Ratings[criterion], s.Rated[criterion]))
+			}
+		}
+		fmt.Fprintln(w, "  "+strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// handleCompareVote: compare-vote <id> <label> <label> [tie] - vote which of
+// two answers of a blind comparison is better, updating the models' Elo
+func (h *Handler) handleCompareVote(parts []string) error {
+	const usage = "usage: compare-vote <id> <better> <worse> | compare-vote <id> <label> <label> tie (e.g., 'compare-vote 20250301-142233 B A')"
+	if len(parts) < 4 || len(parts) > 5 || (len(parts) == 5 && parts[4] != "tie") {
+		return fmt.Errorf(usage)
+	}
+	c, err := comparison.Load(parts[1])
+	if err != nil {
+		return err
+	}
+	if !c.Blind {
+		return fmt.Errorf("votes only count for blind comparisons (run 'compare --blind ...')")
+	}
+	a, err := c.Find(parts[2])
+	if err != nil {
+		return err
+	}
+	b, err := c.Find(parts[3])
+	if err != nil {
+		return err
+	}
+	if a == b {
+		return fmt.Errorf("%s can't be voted against itself", comparison.Label(a))
+	}
+
+	score := 1.0
+	if len(parts) == 5 {
+		score = 0.5
+	}
+	// Two answers of the same model are voted on all the same, so the vote
+	// doesn't give the models away; they just don't move the rankings
+	if err := comparison.Vote(c.Results[a].Model, c.Results[b].Model, score); err != nil {
+		return err
+	}
+	if score == 1 {
+		fmt.Fprintf(h.out, "Voted %s over %s\n", comparison.Label(a), comparison.Label(b))
+	} else {
+		fmt.Fprintf(h.out, "Voted %s and %s a tie\n", comparison.Label(a), comparison.Label(b))
+	}
+	return nil
+}
+
+// handleCompareRankings: compare-rankings - show the models' Elo ratings
+// from head-to-head votes
+func (h *Handler) handleCompareRankings(parts []string) error {
+	if len(parts) != 1 {
+		return fmt.Errorf("usage: compare-rankings")
+	}
+	rankings, err := comparison.LoadRankings()
+	if err != nil {
+		return err
+	}
+	if len(rankings) == 0 {
+		fmt.Fprintln(h.out, "No votes yet (vote with 'compare-vote <id> <better> <worse>')")
+		return nil
+	}
+	fmt.Fprintln(h.out, "Elo rankings from head-to-head votes:")
+	w := tabwriter.NewWriter(h.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  #\tMODEL\tELO\tWINS\tLOSSES\tTIES")
+	for i, r := range rankings {
+		fmt.Fprintf(w, "  %d\t%s\t%.0f\t%d\t%d\t%d\n", i+1, r.Model, r.Elo, r.Wins, r.Losses, r.Ties)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/chzyer/readline"
+	"github.com/iltempo/interplay/comparison"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// historyFileName is the readline history file kept in the user's home directory
+const historyFileName = ".interplay_history"
+
+// historyLimit caps the number of lines kept in the history file
+const historyLimit = 1000
+
+// HistoryFile returns the path of the persistent command history,
+// or "" if the home directory can't be determined (history stays in memory)
+func HistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFileName)
+}
+
+// readlineConfig builds the readline configuration shared by the command
+// prompt and the AI session: persistent history plus tab completion
+func (h *Handler) readlineConfig(prompt string) *readline.Config {
+	return &readline.Config{
+		Prompt:            prompt,
+		HistoryFile:       HistoryFile(),
+		HistoryLimit:      historyLimit,
+		HistorySearchFold: true,
+		AutoComplete:      h.completer(),
+	}
+}
+
+// completer returns tab completion for command names and aliases, plus
+// per-command argument completion (steps, notes, pattern names, keywords)
+func (h *Handler) completer() readline.AutoCompleter {
+	names := make([]string, 0, len(commandIndex))
+	for name := range commandIndex {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var items []readline.PrefixCompleterInterface
+	for _, name := range names {
+		command := commandIndex[name]
+		var args []readline.PrefixCompleterInterface
+		if command.Args != nil {
+			args = command.Args(h)
+		}
+		items = append(items, readline.PcItem(name, args...))
+	}
+
+	return readline.NewPrefixCompleter(items...)
+}
+
+// stepNumbers lists valid step numbers for the current pattern length
+func (h *Handler) stepNumbers(string) []string {
+	length := h.pattern.Length()
+	steps := make([]string, length)
+	for i := range steps {
+		steps[i] = strconv.Itoa(i + 1)
+	}
+	return steps
+}
+
+// savedPatternNames lists saved patterns for completion (errors yield no candidates)
+func savedPatternNames(string) []string {
+	names, err := sequence.List()
+	if err != nil {
+		return nil
+	}
+	return names
+}
+
+// savedSongNames lists saved songs for completion (errors yield no candidates)
+func savedSongNames(string) []string {
+	names, err := sequence.ListSongs()
+	if err != nil {
+		return nil
+	}
+	return names
+}
+
+// comparisonIDs lists saved comparisons for completion (errors yield no candidates)
+func comparisonIDs(string) []string {
+	ids, err := comparison.List()
+	if err != nil {
+		return nil
+	}
+	return ids
+}
+
+// noteNames lists note names C0-B8 (sharps only, flats are accepted but not offered)
+func noteNames() []string {
+	pitches := []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+	names := make([]string, 0, len(pitches)*9)
+	for octave := 0; octave <= 8; octave++ {
+		for _, pitch := range pitches {
+			names = append(names, pitch+strconv.Itoa(octave))
+		}
+	}
+	return names
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// handleDensity: density [<percent> [<scale>]]
+// Thins the pattern to about percent of its steps holding a note, dropping
+// the quietest notes, or thickens it with notes from the scale (e.g.
+// 'density 60 D dorian'; the detected key without one, any note when no key
+// stands out)
+func (h *Handler) handleDensity(parts []string) error {
+	if len(parts) == 1 {
+		fmt.Fprintf(h.out, "Density: %d%% (%d of %d steps have a note)\n", h.density(), h.pattern.Analyze().Notes, h.pattern.Length())
+		return nil
+	}
+
+	percent, err := strconv.Atoi(strings.TrimSuffix(parts[1], "%"))
+	if err != nil {
+		return fmt.Errorf("usage: density <percent> [<scale>] (e.g., 'density 25' or 'density 60 D dorian')")
+	}
+
+	name := strings.Join(parts[2:], " ")
+	if name == "" {
+		name = h.pattern.Analyze().Key
+	}
+	if name == "" {
+		name = "C chromatic"
+	}
+	scale, err := sequence.ParseScale(name)
+	if err != nil {
+		return err
+	}
+
+	before := h.density()
+	p, removed, added, err := h.pattern.WithDensity(percent, scale, rand.Float64)
+	if err != nil {
+		return err
+	}
+	h.pattern.CopyFrom(p)
+
+	switch {
+	case removed > 0:
+		fmt.Fprintf(h.out, "Density %d%% → %d%%: removed the %d quietest notes\n", before, h.density(), removed)
+	case added > 0:
+		fmt.Fprintf(h.out, "Density %d%% → %d%%: added %d notes in %s\n", before, h.density(), added, name)
+	default:
+		fmt.Fprintf(h.out, "Density already %d%%\n", before)
+	}
+	return nil
+}
+
+// density returns the share of steps holding a note, in percent
+func (h *Handler) density() int {
+	return h.pattern.Analyze().Notes * 100 / h.pattern.Length()
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iltempo/interplay/device"
+)
+
+// handleDevice: device [list|use <name>|off]
+func (h *Handler) handleDevice(parts []string) error {
+	usage := fmt.Errorf("usage: device [list|use <name>|off] (e.g., 'device use minilogue')")
+
+	if len(parts) == 1 {
+		h.showDevice()
+		return nil
+	}
+
+	switch strings.ToLower(parts[1]) {
+	case "list":
+		if len(parts) != 2 {
+			return usage
+		}
+		names, err := device.List()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h.out, "Device profiles: %s\n", strings.Join(names, ", "))
+		return nil
+
+	case "use":
+		if len(parts) != 3 {
+			return usage
+		}
+		return h.useDevice(parts[2])
+
+	case "off":
+		if len(parts) != 2 {
+			return usage
+		}
+		if h.device == nil {
+			fmt.Fprintln(h.out, "No device profile active")
+			return nil
+		}
+		h.setDevice(nil)
+		fmt.Fprintln(h.out, "Device profile off")
+		return nil
+	}
+	return usage
+}
+
+// UseDevice activates a device profile, as 'device use <name>' does
+func (h *Handler) UseDevice(name string) error {
+	return h.Update(func() error {
+		return h.useDevice(name)
+	})
+}
+
+// useDevice loads a profile and makes its parameter names available
+func (h *Handler) useDevice(name string) error {
+	profile, err := device.Load(name)
+	if err != nil {
+		return err
+	}
+	h.setDevice(profile)
+	fmt.Fprintf(h.out, "Using device profile %s (%d parameters)\n", profile.Name, len(profile.Parameters))
+	return nil
+}
+
+// setDevice switches the active profile and tells the AI about it
+func (h *Handler) setDevice(profile *device.Profile) {
+	h.device = profile
+	if h.aiClient == nil {
+		return
+	}
+	if profile == nil {
+		h.aiClient.SetInstrument("")
+	} else {
+		h.aiClient.SetInstrument(profile.Describe())
+	}
+}
+
+// showDevice prints the active profile's parameters
+func (h *Handler) showDevice() {
+	if h.device == nil {
+		fmt.Fprintln(h.out, "No device profile active (use 'device use <name>', see 'device list')")
+		return
+	}
+	fmt.Fprintf(h.out, "Device: %s", h.device.Name)
+	if h.device.Description != "" {
+		fmt.Fprintf(h.out, " - %s", h.device.Description)
+	}
+	fmt.Fprintln(h.out)
+	for _, param := range h.device.Parameters {
+		line := fmt.Sprintf("  %-16s %-10s %d-%d", param.Name, param.Address(), param.Min(), param.Max())
+		if param.Description != "" {
+			line += "  " + param.Description
+		}
+		fmt.Fprintln(h.out, line)
+	}
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// handleExport: export script <file> | export session <name> <file>
+func (h *Handler) handleExport(parts []string) error {
+	if len(parts) >= 4 && parts[1] == "session" {
+		return exportSession(h.out, parts[2], strings.Join(parts[3:], " "))
+	}
+	if len(parts) < 3 || parts[1] != "script" {
+		return fmt.Errorf("usage: export script <file> or export session <name> <file> (e.g., 'export script groove.txt')")
+	}
+
+	// Join remaining parts as the file name (allows spaces)
+	path := strings.Join(parts[2:], " ")
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create script: %w", err)
+	}
+	if err := h.pattern.WriteScript(f, h.patternName); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write script: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write script: %w", err)
+	}
+
+	fmt.Fprintf(h.out, "Exported pattern to %s (replay with 'interplay --script %s')\n", path, path)
+	return nil
+}
+
+// exportSession writes a recorded session as a script, with 'sleep' keeping
+// the time between commands, or as a Standard MIDI File of the whole
+// performance when the file ends in .mid or .midi
+func exportSession(w io.Writer, name, path string) error {
+	s, err := loadSession(name)
+	if err != nil {
+		return err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".mid" || ext == ".midi" {
+		return exportSessionMIDI(w, s, path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create script: %w", err)
+	}
+	if err := s.writeScript(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write script: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write script: %w", err)
+	}
+
+	fmt.Fprintf(w, "Exported session '%s' to %s (replay with 'interplay --script %s')\n", name, path, path)
+	return nil
+}
+
+// exportSessionMIDI renders a recorded session loop by loop into a MIDI file
+func exportSessionMIDI(w io.Writer, s *session, path string) error {
+	loops, err := s.performance()
+	if err != nil {
+		return fmt.Errorf("session '%s': %w", s.Name, err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create MIDI file: %w", err)
+	}
+	if err := sequence.WriteMIDIPerformance(f, loops); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write MIDI file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write MIDI file: %w", err)
+	}
+
+	fmt.Fprintf(w, "Exported session '%s' to %s: %d loops as a MIDI performance\n", s.Name, path, len(loops))
+	return nil
+}
@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+// localRule turns a natural-language request into commands without AI
+type localRule struct {
+	match    *regexp.Regexp
+	example  string
+	commands func(p *sequence.Pattern, m []string) []string
+}
+
+// localRules are the requests 'ai <prompt>' understands when no model is
+// available, tried in order. Each is a deterministic edit of the pattern.
+var localRules = []localRule{
+	{regexp.MustCompile(`\b(double[ -]time|twice as fast)\b`), "double time", func(p *sequence.Pattern, m []string) []string {
+		return []string{"tempo " + sequence.FormatBPM(min(p.GetBPM()*2, 300))}
+	}},
+	{regexp.MustCompile(`\b(half[ -]time|half speed|twice as slow)\b`), "half time", func(p *sequence.Pattern, m []string) []string {
+		return []string{"tempo " + sequence.FormatBPM(max(p.GetBPM()/2, 20))}
+	}},
+	{regexp.MustCompile(`\b(\d{2,3}) ?bpm\b|\btempo (?:to )?(\d{2,3})\b`), "120 bpm", func(p *sequence.Pattern, m []string) []string {
+		return []string{"tempo " + m[1] + m[2]}
+	}},
+	{regexp.MustCompile(`\b(faster|speed (it )?up)\b`), "faster", func(p *sequence.Pattern, m []string) []string {
+		return []string{"tempo " + sequence.FormatBPM(min(p.GetBPM()+10, 300))}
+	}},
+	{regexp.MustCompile(`\b(slower|slow (it )?down)\b`), "slower", func(p *sequence.Pattern, m []string) []string {
+		return []string{"tempo " + sequence.FormatBPM(max(p.GetBPM()-10, 20))}
+	}},
+	{regexp.MustCompile(`\b(no swing|remove (the )?swing|straight(en)?)\b`), "no swing", func(p *sequence.Pattern, m []string) []string {
+		return []string{"swing 0"}
+	}},
+	{regexp.MustCompile(`\b(\d{1,2})\s?%? swing\b|\bswing\b`), "add swing", func(p *sequence.Pattern, m []string) []string {
+		if m[1] != "" {
+			return []string{"swing " + m[1]}
+		}
+		return []string{fmt.Sprintf("swing %d", min(max(p.GetSwing()+15, 50), 75))}
+	}},
+	{regexp.MustCompile(`\b(louder|harder|more (energy|punch))\b`), "louder", func(p *sequence.Pattern, m []string) []string {
+		return eachNote(p, func(step int, s sequence.Step) string {
+			return fmt.Sprintf("velocity %d %d", step, min(int(s.Velocity)+16, 127))
+		})
+	}},
+	{regexp.MustCompile(`\b(softer|quieter|gentler)\b`), "softer", func(p *sequence.Pattern, m []string) []string {
+		return eachNote(p, func(step int, s sequence.Step) string {
+			return fmt.Sprintf("velocity %d %d", step, max(int(s.Velocity)-16, 1))
+		})
+	}},
+	{regexp.MustCompile(`\boctave (up|higher)\b|\b(up|higher) an octave\b`), "octave up", func(p *sequence.Pattern, m []string) []string {
+		return transposeCommands(p, 12)
+	}},
+	{regexp.MustCompile(`\boctave (down|lower)\b|\b(down|lower) an octave\b`), "octave down", func(p *sequence.Pattern, m []string) []string {
+		return transposeCommands(p, -12)
+	}},
+	{regexp.MustCompile(`\b(staccato|shorter notes|tighter)\b`), "staccato", func(p *sequence.Pattern, m []string) []string {
+		return eachNote(p, func(step int, s sequence.Step) string { return fmt.Sprintf("gate %d 40", step) })
+	}},
+	{regexp.MustCompile(`\b(legato|longer notes|smoother)\b`), "legato", func(p *sequence.Pattern, m []string) []string {
+		return eachNote(p, func(step int, s sequence.Step) string { return fmt.Sprintf("gate %d 100", step) })
+	}},
+	{regexp.MustCompile(`\b(humani[sz]e|more human|less robotic|looser)\b`), "humanize", func(p *sequence.Pattern, m []string) []string {
+		return []string{"humanize velocity 10", "humanize timing 10", "humanize gate 10"}
+	}},
+}
+
+// eachNote returns the command made by fn for each step playing a note
+func eachNote(p *sequence.Pattern, fn func(step int, s sequence.Step) string) []string {
+	var commands []string
+	p.ForEachStep(func(step int, s sequence.Step) {
+		if !s.IsRest {
+			commands = append(commands, fn(step, s))
+		}
+	})
+	return commands
+}
+
+// transposeCommands moves every note by semitones, keeping its length;
+// notes that would leave the MIDI range stay where they are
+func transposeCommands(p *sequence.Pattern, semitones int) []string {
+	return eachNote(p, func(step int, s sequence.Step) string {
+		note, err := sequence.Transpose(s.Note, semitones)
+		if err != nil {
+			note = s.Note
+		}
+		return fmt.Sprintf("set %d %s dur:%d", step, sequence.MIDIToNoteName(note), max(s.Duration, 1))
+	})
+}
+
+// localExamples lists requests the local rules understand
+func localExamples() string {
+	examples := make([]string, len(localRules))
+	for i, rule := range localRules {
+		examples[i] = strconv.Quote(rule.example)
+	}
+	return strings.Join(examples, ", ")
+}
+
+// handleAILocal answers 'ai <prompt>' without a model: the first local rule
+// matching the prompt proposes its commands, shown and applied like the
+// AI's edits
+func (h *Handler) handleAILocal(prompt string) error {
+	lower := strings.ToLower(prompt)
+	for _, rule := range localRules {
+		m := rule.match.FindStringSubmatch(lower)
+		if m == nil {
+			continue
+		}
+		proposed := rule.commands(h.pattern, m)
+		fmt.Fprintln(h.out, theme.Warning(fmt.Sprintf("AI not available; applying the local rule for %q", rule.example)))
+		if len(proposed) == 0 {
+			fmt.Fprintln(h.out, "Nothing to change (no notes in the pattern)")
+			return nil
+		}
+		preview := h.previewHandler()
+		for _, cmd := range proposed {
+			if err := preview.ProcessCommand(cmd); err != nil {
+				return fmt.Errorf("%s: %w", cmd, err)
+			}
+		}
+		h.applyAIEdits(preview, proposed)
+		return nil
+	}
+	return fmt.Errorf("%w\nWithout AI, 'ai <request>' understands: %s", errAIUnavailable, localExamples())
+}
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// destructiveCommands returns the names of the commands that can throw away
+// work in one go (Command.Destructive), sorted. The AI may only run those
+// allowed with 'ai-allow' or ai_allow.
+func destructiveCommands() []string {
+	var names []string
+	for _, cmd := range registry {
+		if cmd.Destructive {
+			names = append(names, cmd.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetAIAllowed sets which destructive commands the AI may run; the others
+// are refused and the model is told to ask the user instead
+func (h *Handler) SetAIAllowed(names []string) error {
+	allowed := map[string]bool{}
+	guarded := destructiveCommands()
+	for _, name := range names {
+		if !slices.Contains(guarded, name) {
+			return fmt.Errorf("%q is not a guarded command (guarded: %s)", name, strings.Join(guarded, ", "))
+		}
+		allowed[name] = true
+	}
+	h.aiAllowed = allowed
+	return nil
+}
+
+// checkAIAllowed refuses a destructive command the AI isn't allowed to run
+func (h *Handler) checkAIAllowed(command *Command) error {
+	if !command.Destructive || h.aiAllowed[command.Name] {
+		return nil
+	}
+	return fmt.Errorf("'%s' is blocked for the AI; ask the user to run it (or to allow it with 'ai-allow %s')", command.Name, command.Name)
+}
+
+// runAICommand runs a command the AI asked for through its handler, unless
+// the AI may not run it: commands taking whole command lines (ai, macro,
+// ...), commands changing settings or running code (ai-allow, hooks, ...),
+// destructive commands not allowed, and others touching files (export,
+// monitor <file>, ...)
+func (h *Handler) runAICommand(parts []string) error {
+	command, ok := lookupCommand(parts[0])
+	if !ok {
+		return fmt.Errorf("unknown command: %s", parts[0])
+	}
+	if command.NoChain || command.NoAI {
+		return fmt.Errorf("'%s' can't be run by the AI", command.Name)
+	}
+	if err := h.checkAIAllowed(command); err != nil {
+		return err
+	}
+	if !command.Destructive && command.Files != nil && command.Files(parts) {
+		return fmt.Errorf("'%s' reads or writes files and can't be run by the AI; ask the user to run it", strings.Join(parts, " "))
+	}
+	return command.Run(h, parts)
+}
+
+// handleAIAllow: ai-allow [<command>...|none] - show or set the destructive
+// commands the AI may run
+func (h *Handler) handleAIAllow(parts []string) error {
+	switch {
+	case len(parts) == 2 && parts[1] == "none":
+		h.aiAllowed = nil
+	case len(parts) > 1:
+		if err := h.SetAIAllowed(parts[1:]); err != nil {
+			return fmt.Errorf("usage: ai-allow [<command>...|none]: %w", err)
+		}
+	}
+
+	var allowed, blocked []string
+	for _, name := range destructiveCommands() {
+		if h.aiAllowed[name] {
+			allowed = append(allowed, name)
+		} else {
+			blocked = append(blocked, name)
+		}
+	}
+	if len(allowed) > 0 {
+		fmt.Fprintf(h.out, "AI may run: %s\n", strings.Join(allowed, ", "))
+	}
+	if len(blocked) > 0 {
+		fmt.Fprintf(h.out, "Blocked for the AI: %s\n", strings.Join(blocked, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iltempo/interplay/hooks"
+)
+
+// handleHooks: hooks [load <file>|reload|off]
+func (h *Handler) handleHooks(parts []string) error {
+	usage := fmt.Errorf("usage: hooks [load <file>|reload|off] (e.g., 'hooks load fills.star')")
+
+	if len(parts) == 1 {
+		if h.hooks == nil {
+			fmt.Fprintln(h.out, "No hooks loaded")
+			return nil
+		}
+		fmt.Fprintf(h.out, "Hooks from %s: %s\n", h.hooks.Path(), strings.Join(h.hooks.Hooks(), ", "))
+		return nil
+	}
+
+	switch strings.ToLower(parts[1]) {
+	case "load":
+		if len(parts) < 3 {
+			return usage
+		}
+		// Join remaining parts as the path (allows spaces)
+		return h.loadHooks(strings.Join(parts[2:], " "))
+
+	case "reload":
+		if len(parts) != 2 {
+			return usage
+		}
+		if h.hooks == nil {
+			return fmt.Errorf("no hooks loaded (use 'hooks load <file>')")
+		}
+		return h.loadHooks(h.hooks.Path())
+
+	case "off":
+		if len(parts) != 2 {
+			return usage
+		}
+		if h.hooks == nil {
+			fmt.Fprintln(h.out, "No hooks loaded")
+			return nil
+		}
+		h.hooks.Stop()
+		h.hooks = nil
+		fmt.Fprintln(h.out, "Hooks stopped")
+		return nil
+	}
+	return usage
+}
+
+// LoadHooks loads a hook script, as 'hooks load <path>' does
+func (h *Handler) LoadHooks(path string) error {
+	return h.Update(func() error {
+		return h.loadHooks(path)
+	})
+}
+
+// loadHooks replaces the running hooks with a script's. If the script fails
+// to load, the previous hooks keep running, so a typo doesn't stop a live set.
+func (h *Handler) loadHooks(path string) error {
+	runner, err := hooks.Load(path, h, h.pattern)
+	if err != nil {
+		return err
+	}
+
+	if h.hooks != nil {
+		h.hooks.Stop()
+	}
+	h.hooks = runner
+	runner.Start(h.clock)
+
+	fmt.Fprintf(h.out, "Loaded hooks from %s: %s\n", path, strings.Join(runner.Hooks(), ", "))
+	return nil
+}
@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+// importUsage lists the import formats
+const importUsage = "usage: import tab <note> <grid>... | import tab <notes> | import abc \"<tune>\" | import csv <file> | import hydrogen <file> [pattern]\n" +
+	"e.g., 'import tab C1 x...x...x...x... D1 ....x.......x...', 'import abc \"L:1/8 K:G | G2 AB c2 B>A\"' or 'import hydrogen groove.h2song'"
+
+// handleImport: import tab <tab> | import abc <tune> | import csv <file> | import hydrogen <file> [pattern]
+func (h *Handler) handleImport(parts []string) error {
+	if len(parts) < 3 {
+		return fmt.Errorf(importUsage)
+	}
+	switch parts[1] {
+	case "tab":
+		return h.importTab(parts[2:])
+	case "abc":
+		return h.importABC(parts[2:])
+	case "csv":
+		if len(parts) != 3 {
+			return fmt.Errorf("usage: import csv <file>")
+		}
+		return h.importFile(parts[2], func(f *os.File) (*sequence.Imported, error) {
+			return sequence.ImportCSV(f)
+		})
+	case "hydrogen", "h2":
+		if len(parts) > 4 {
+			return fmt.Errorf("usage: import hydrogen <file> [pattern]")
+		}
+		name := ""
+		if len(parts) == 4 {
+			name = parts[3]
+		}
+		return h.importFile(parts[2], func(f *os.File) (*sequence.Imported, error) {
+			return sequence.ImportHydrogen(f, name)
+		})
+	default:
+		return fmt.Errorf(importUsage)
+	}
+}
+
+// importTab sets steps from text tablature
+func (h *Handler) importTab(fields []string) error {
+	tab, err := sequence.ParseTab(fields)
+	if err != nil {
+		return err
+	}
+	return h.applyTab(tab, "tab")
+}
+
+// importABC sets steps from an ABC notation snippet, optionally in quotes
+func (h *Handler) importABC(fields []string) error {
+	tune := strings.Join(fields, " ")
+	if len(tune) >= 2 && strings.HasPrefix(tune, `"`) && strings.HasSuffix(tune, `"`) {
+		tune = tune[1 : len(tune)-1]
+	}
+	tab, err := sequence.ParseABC(tune)
+	if err != nil {
+		return fmt.Errorf("invalid ABC tune: %w", err)
+	}
+	return h.applyTab(tab, "tune")
+}
+
+// applyTab sets the steps of parsed notation, starting at step 1; kind
+// names the notation in errors
+func (h *Handler) applyTab(tab *sequence.Tab, kind string) error {
+	if patternLen := h.pattern.Length(); tab.Length > patternLen {
+		return fmt.Errorf("%s has %d steps but the pattern has %d (use 'length %d' first)", kind, tab.Length, patternLen, tab.Length)
+	}
+	if tab.Tempo > 0 {
+		if err := h.pattern.SetTempo(float64(tab.Tempo)); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	for _, step := range tab.Steps {
+		if step.Rest {
+			err = h.pattern.SetRest(step.Step)
+		} else {
+			err = h.pattern.SetNoteWithDuration(step.Step, step.Note, step.Duration)
+			if err == nil && step.Velocity > 0 {
+				err = h.pattern.SetVelocity(step.Step, step.Velocity)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if tab.Lanes > 0 {
+		fmt.Fprintf(h.out, "Imported %d hits from %d lanes over %d steps\n", len(tab.Steps), tab.Lanes, tab.Length)
+	} else {
+		fmt.Fprintf(h.out, "Imported %d steps\n", tab.Length)
+	}
+	return nil
+}
+
+// importFile replaces the pattern with one read from another program's file.
+// The current tempo is kept if the file has none.
+func (h *Handler) importFile(path string, read func(f *os.File) (*sequence.Imported, error)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	imp, err := read(f)
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	if !imp.HasTempo {
+		imp.Pattern.SetTempo(h.pattern.GetBPM())
+	}
+	h.pattern.CopyFrom(imp.Pattern)
+
+	fmt.Fprintf(h.out, "Imported %s (Tempo: %s BPM, Length: %d steps)\n", path, sequence.FormatBPM(imp.Pattern.GetBPM()), imp.Pattern.Length())
+	if imp.Quantized > 0 {
+		fmt.Fprintf(h.out, "%d hits moved to the nearest 16th-note step\n", imp.Quantized)
+	}
+	if imp.Dropped > 0 {
+		fmt.Fprintln(h.out, theme.Warning(fmt.Sprintf("⚠️  %d simultaneous hits dropped (one note per step; the loudest is kept)", imp.Dropped)))
+	}
+	return nil
+}
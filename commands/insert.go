@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// handleInsert: insert <step> [count] [--wrap] | remove <step> [count] [--wrap]
+// Inserts rests before a step or removes steps, moving the later steps so a
+// rhythm that is a step off can be fixed in one go. The pattern grows or
+// shrinks; with --wrap it keeps its length and the steps moved past one end
+// come back at the other.
+func (h *Handler) handleInsert(parts []string) error {
+	insert := strings.ToLower(parts[0]) == "insert"
+	usage := fmt.Errorf("usage: %s <step> [count] [--wrap] (e.g., '%s 5' or '%s 5 2 --wrap')", parts[0], parts[0], parts[0])
+
+	wrap := false
+	var args []string
+	for _, part := range parts[1:] {
+		if part == "--wrap" {
+			wrap = true
+		} else {
+			args = append(args, part)
+		}
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return usage
+	}
+	stepNum, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid step number: %s", args[0])
+	}
+	count := 1
+	if len(args) == 2 {
+		if count, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid count: %s", args[1])
+		}
+	}
+
+	if insert {
+		err = h.pattern.InsertSteps(stepNum, count, wrap)
+	} else {
+		err = h.pattern.RemoveSteps(stepNum, count, wrap)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case insert && wrap:
+		fmt.Fprintf(h.out, "Moved steps %d-%d later by %d, wrapping the last ones around to step %d\n", stepNum, h.pattern.Length(), count, stepNum)
+	case insert:
+		fmt.Fprintf(h.out, "Inserted %d rest(s) at step %d; the pattern is now %d steps\n", count, stepNum, h.pattern.Length())
+	case wrap:
+		fmt.Fprintf(h.out, "Moved steps %d-%d earlier by %d, wrapping the removed ones to the end\n", stepNum+count, h.pattern.Length(), count)
+	default:
+		fmt.Fprintf(h.out, "Removed %d step(s) from step %d; the pattern is now %d steps\n", count, stepNum, h.pattern.Length())
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// listSorts are the 'list --sort' keys
+var listSorts = []string{"name", "date", "tempo", "length", "notes"}
+
+// handleList: list [collection/] [--sort name|date|tempo|length|notes] [--tag <tag>]
+// Shows saved patterns in a table with tempo, length, notes, date and tags
+func (h *Handler) handleList(parts []string) error {
+	usage := fmt.Errorf("usage: list [collection/] [--sort %s] [--tag <tag>] (e.g., 'list basslines/ --sort date')", strings.Join(listSorts, "|"))
+
+	sortBy, tag, collection := "name", "", ""
+	for i := 1; i < len(parts); i += 2 {
+		if !strings.HasPrefix(parts[i], "--") {
+			if collection != "" || strings.Trim(parts[i], "/") == "" {
+				return usage
+			}
+			collection = strings.Trim(parts[i], "/") + "/"
+			i-- // no value follows a collection
+			continue
+		}
+		if i+1 >= len(parts) {
+			return usage
+		}
+		switch strings.ToLower(parts[i]) {
+		case "--sort":
+			sortBy = strings.ToLower(parts[i+1])
+			if !slices.Contains(listSorts, sortBy) {
+				return usage
+			}
+		case "--tag":
+			tag = strings.ToLower(parts[i+1])
+		default:
+			return usage
+		}
+	}
+
+	infos, err := sequence.ListInfo()
+	if err != nil {
+		return fmt.Errorf("failed to list patterns: %w", err)
+	}
+	infos = slices.DeleteFunc(infos, func(info sequence.PatternInfo) bool {
+		return (tag != "" && !slices.Contains(info.Tags, tag)) ||
+			(collection != "" && !strings.HasPrefix(info.Name, collection))
+	})
+
+	if len(infos) == 0 {
+		switch {
+		case collection != "" && tag != "":
+			fmt.Fprintf(h.out, "No saved patterns in %s tagged '%s'\n", collection, tag)
+		case collection != "":
+			fmt.Fprintf(h.out, "No saved patterns in %s\n", collection)
+		case tag != "":
+			fmt.Fprintf(h.out, "No saved patterns tagged '%s'\n", tag)
+		default:
+			fmt.Fprintln(h.out, "No saved patterns found")
+		}
+		return nil
+	}
+
+	sortPatternInfos(infos, sortBy)
+
+	fmt.Fprintf(h.out, "Saved patterns (%d):\n", len(infos))
+	w := tabwriter.NewWriter(h.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  Name\tTempo\tLength\tNotes\tSaved\tTags")
+	for _, info := range infos {
+		if info.Err != nil {
+			fmt.Fprintf(w, "  %s\t(unreadable: %v)\n", info.Name, info.Err)
+			continue
+		}
+		saved := "-"
+		if !info.Saved.IsZero() {
+			saved = info.Saved.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%d\t%d\t%s\t%s\n", info.Name, sequence.FormatBPM(info.Tempo), info.Length, info.Notes, saved, strings.Join(info.Tags, ", "))
+	}
+	return w.Flush()
+}
+
+// sortPatternInfos orders patterns by a 'list --sort' key: dates newest
+// first, everything else ascending, with ties broken by name
+func sortPatternInfos(infos []sequence.PatternInfo, by string) {
+	sort.SliceStable(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		switch by {
+		case "date":
+			if !a.Saved.Equal(b.Saved) {
+				return a.Saved.After(b.Saved)
+			}
+		case "tempo":
+			if a.Tempo != b.Tempo {
+				return a.Tempo < b.Tempo
+			}
+		case "length":
+			if a.Length != b.Length {
+				return a.Length < b.Length
+			}
+		case "notes":
+			if a.Notes != b.Notes {
+				return a.Notes < b.Notes
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+// handleTag: tag [<tag>...|--clear]
+// Sets the tags saved with the current pattern, used by 'list --tag'
+func (h *Handler) handleTag(parts []string) error {
+	if len(parts) == 1 {
+		if tags := h.pattern.GetTags(); len(tags) > 0 {
+			fmt.Fprintf(h.out, "Tags: %s\n", strings.Join(tags, ", "))
+		} else {
+			fmt.Fprintln(h.out, "No tags (add some with 'tag <tag>...')")
+		}
+		return nil
+	}
+
+	if len(parts) == 2 && parts[1] == "--clear" {
+		h.pattern.SetTags(nil)
+		fmt.Fprintln(h.out, "Tags cleared")
+		return nil
+	}
+
+	if err := h.pattern.SetTags(parts[1:]); err != nil {
+		return err
+	}
+	fmt.Fprintf(h.out, "Tags: %s (saved with the pattern on 'save')\n", strings.Join(h.pattern.GetTags(), ", "))
+	return nil
+}
@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// MacrosFile is where user-defined macros are persisted (next to patterns/)
+var MacrosFile = "macros.json"
+
+// maxMacroDepth limits nested macro runs so a macro calling itself can't recurse forever
+const maxMacroDepth = 8
+
+// loadMacros reads macros from disk. A missing file means no macros yet.
+func loadMacros() (map[string]string, error) {
+	data, err := os.ReadFile(MacrosFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read macros file: %w", err)
+	}
+
+	macros := map[string]string{}
+	if err := json.Unmarshal(data, &macros); err != nil {
+		return nil, fmt.Errorf("failed to parse macros file: %w", err)
+	}
+	return macros, nil
+}
+
+// saveMacros writes all macros to disk
+func saveMacros(macros map[string]string) error {
+	data, err := json.MarshalIndent(macros, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal macros: %w", err)
+	}
+	if err := os.WriteFile(MacrosFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write macros file: %w", err)
+	}
+	return nil
+}
+
+// splitCommands splits a line like "clear; tempo 120" into individual commands,
+// dropping empty entries
+func splitCommands(line string) []string {
+	var cmds []string
+	for _, part := range strings.Split(line, ";") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			cmds = append(cmds, part)
+		}
+	}
+	return cmds
+}
+
+// handleMacro: macro <define|run|list|delete> ...
+func (h *Handler) handleMacro(parts []string) error {
+	usage := fmt.Errorf("usage: macro define <name> <command; command; ...> | macro run <name> | macro list | macro delete <name>")
+	if len(parts) < 2 {
+		return usage
+	}
+
+	switch strings.ToLower(parts[1]) {
+	case "define", "def":
+		if len(parts) < 4 {
+			return fmt.Errorf("usage: macro define <name> <command; command; ...>\n" +
+				"e.g., 'macro define init clear; tempo 120; swing 40; humanize velocity 15'")
+		}
+		return h.defineMacro(strings.ToLower(parts[2]), strings.Join(parts[3:], " "))
+
+	case "run":
+		if len(parts) != 3 {
+			return fmt.Errorf("usage: macro run <name>")
+		}
+		return h.runMacro(strings.ToLower(parts[2]))
+
+	case "list", "ls":
+		if len(parts) != 2 {
+			return fmt.Errorf("usage: macro list")
+		}
+		return h.listMacros()
+
+	case "delete", "rm":
+		if len(parts) != 3 {
+			return fmt.Errorf("usage: macro delete <name>")
+		}
+		return h.deleteMacro(strings.ToLower(parts[2]))
+
+	default:
+		return usage
+	}
+}
+
+// defineMacro stores a macro and persists it
+func (h *Handler) defineMacro(name, body string) error {
+	cmds := splitCommands(body)
+	if len(cmds) == 0 {
+		return fmt.Errorf("macro '%s' has no commands", name)
+	}
+
+	macros, err := loadMacros()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := macros[name]; exists {
+		fmt.Fprintf(h.out, "⚠️  Warning: Macro '%s' already exists and will be overwritten.\n", name)
+	}
+	macros[name] = strings.Join(cmds, "; ")
+
+	if err := saveMacros(macros); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(h.out, "Defined macro '%s' (%d command(s))\n", name, len(cmds))
+	return nil
+}
+
+// runMacro executes each command of a macro, reporting errors per command
+func (h *Handler) runMacro(name string) error {
+	macros, err := loadMacros()
+	if err != nil {
+		return err
+	}
+
+	body, ok := macros[name]
+	if !ok {
+		return fmt.Errorf("macro '%s' not found", name)
+	}
+
+	if h.macroDepth >= maxMacroDepth {
+		return fmt.Errorf("macro '%s' nested too deeply (limit %d)", name, maxMacroDepth)
+	}
+	h.macroDepth++
+	defer func() { h.macroDepth-- }()
+
+	failed := 0
+	for _, cmd := range splitCommands(body) {
+		fmt.Fprintf(h.out, "  > %s\n", cmd)
+		if err := h.ProcessCommand(cmd); err != nil {
+			fmt.Fprintf(h.out, "  Error: %v\n", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("macro '%s': %d command(s) failed", name, failed)
+	}
+	return nil
+}
+
+// listMacros prints all macros sorted by name
+func (h *Handler) listMacros() error {
+	macros, err := loadMacros()
+	if err != nil {
+		return err
+	}
+
+	if len(macros) == 0 {
+		fmt.Fprintln(h.out, "No macros defined")
+		return nil
+	}
+
+	names := make([]string, 0, len(macros))
+	for name := range macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(h.out, "Macros (%d):\n", len(macros))
+	for _, name := range names {
+		fmt.Fprintf(h.out, "  %s: %s\n", name, macros[name])
+	}
+	return nil
+}
+
+// deleteMacro removes a macro and persists the change
+func (h *Handler) deleteMacro(name string) error {
+	macros, err := loadMacros()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := macros[name]; !ok {
+		return fmt.Errorf("macro '%s' not found", name)
+	}
+	delete(macros, name)
+
+	if err := saveMacros(macros); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(h.out, "Deleted macro '%s'\n", name)
+	return nil
+}
+
+// macroNames lists defined macros for completion (errors yield no candidates)
+func macroNames(string) []string {
+	macros, err := loadMacros()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(macros))
+	for name := range macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
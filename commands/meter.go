@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// handleMeter: meter [<beats>/<value>] [<resolution>]
+// Shows or sets the time signature and the note value of a step, e.g.
+// 'meter 6/8' or 'meter 4/4 8th'. Both are saved with the pattern and set
+// how many steps 'length <n>bars' and 'bar' count per bar.
+func (h *Handler) handleMeter(parts []string) error {
+	usage := fmt.Errorf("usage: meter [<beats>/<value>] [4th|8th|16th|32nd] (e.g., 'meter 6/8' or 'meter 4/4 8th')")
+	if len(parts) > 3 {
+		return usage
+	}
+
+	beats, value := h.pattern.GetTimeSignature()
+	resolution := h.pattern.GetResolution()
+	for _, arg := range parts[1:] {
+		var err error
+		if strings.Contains(arg, "/") {
+			beats, value, err = sequence.ParseTimeSignature(arg)
+		} else {
+			resolution, err = sequence.ParseResolution(arg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(parts) > 1 {
+		if err := h.pattern.SetMeter(beats, value, resolution); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(h.out, "Meter: %s (%d steps per bar)\n", h.pattern.Meter(), h.pattern.StepsPerBar())
+	return nil
+}
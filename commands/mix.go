@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// handleVolume: volume [<0-127>|off]
+// Sets the pattern volume (CC 7), saved with the pattern and sent at the
+// start of each loop
+func (h *Handler) handleVolume(parts []string) error {
+	usage := fmt.Errorf("usage: volume [<0-127>|off] (e.g., 'volume 100')")
+
+	if len(parts) == 1 {
+		if volume, ok := h.pattern.GetVolume(); ok {
+			fmt.Fprintf(h.out, "Volume: %d\n", volume)
+		} else {
+			fmt.Fprintln(h.out, "Volume: not set (the synth keeps its own level)")
+		}
+		return nil
+	}
+	if len(parts) != 2 {
+		return usage
+	}
+
+	if strings.EqualFold(parts[1], "off") {
+		h.pattern.SetVolume(-1)
+		fmt.Fprintln(h.out, "Volume removed from pattern")
+		return nil
+	}
+
+	volume, err := strconv.Atoi(parts[1])
+	if err != nil || volume < 0 || volume > 127 {
+		return fmt.Errorf("invalid volume: %s (must be 0-127)", parts[1])
+	}
+	if err := h.checkCCValue(sequence.CCVolume, volume); err != nil {
+		return err
+	}
+	if err := h.pattern.SetVolume(volume); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(h.out, "Set volume to %d (will take effect at next loop iteration)\n", volume)
+	return nil
+}
+
+// handlePan: pan <step> <0-127|L1-L64|C|R1-R63|off>
+// Sets per-step pan (CC 10), saved with the pattern
+func (h *Handler) handlePan(parts []string) error {
+	if len(parts) != 3 {
+		return fmt.Errorf("usage: pan <step> <0-127|L<n>|C|R<n>|off> (e.g., 'pan 1 L32', 'pan 5 C')")
+	}
+	return h.setMixStep(parts[1], parts[2], sequence.CCPan, "pan", parsePan, formatPan)
+}
+
+// handleExpression: expression <step> <0-127|off>
+// Sets per-step expression (CC 11), saved with the pattern
+func (h *Handler) handleExpression(parts []string) error {
+	if len(parts) != 3 {
+		return fmt.Errorf("usage: expression <step> <0-127|off> (e.g., 'expression 1 90')")
+	}
+	parse := func(s string) (int, error) {
+		value, err := strconv.Atoi(s)
+		if err != nil || value < 0 || value > 127 {
+			return 0, fmt.Errorf("invalid expression: %s (must be 0-127)", s)
+		}
+		return value, nil
+	}
+	return h.setMixStep(parts[1], parts[2], sequence.CCExpression, "expression", parse, strconv.Itoa)
+}
+
+// setMixStep sets or clears ('off') a step's CC for a mix parameter
+func (h *Handler) setMixStep(stepArg, valueArg string, ccNumber int, name string, parse func(string) (int, error), format func(int) string) error {
+	step, err := strconv.Atoi(stepArg)
+	if err != nil {
+		return fmt.Errorf("invalid step number: %s", stepArg)
+	}
+
+	if strings.EqualFold(valueArg, "off") {
+		if err := h.pattern.ClearStepCC(step, ccNumber); err != nil {
+			return err
+		}
+		fmt.Fprintf(h.out, "Cleared %s from step %d\n", name, step)
+		return nil
+	}
+
+	value, err := parse(valueArg)
+	if err != nil {
+		return err
+	}
+	if err := h.checkCCValue(ccNumber, value); err != nil {
+		return err
+	}
+	if err := h.pattern.SetStepCC(step, ccNumber, value); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(h.out, "Set step %d %s to %s\n", step, name, format(value))
+	return nil
+}
+
+// parsePan accepts a CC value (0-127), C for center (64), L<n> for n left
+// of center (L64 = hard left), or R<n> for n right of center (R63 = hard right)
+func parsePan(s string) (int, error) {
+	invalid := fmt.Errorf("invalid pan: %s (use 0-127, C, L1-L64 or R1-R63)", s)
+
+	upper := strings.ToUpper(s)
+	switch {
+	case upper == "C" || upper == "CENTER":
+		return 64, nil
+	case strings.HasPrefix(upper, "L"):
+		n, err := strconv.Atoi(upper[1:])
+		if err != nil || n < 1 || n > 64 {
+			return 0, invalid
+		}
+		return 64 - n, nil
+	case strings.HasPrefix(upper, "R"):
+		n, err := strconv.Atoi(upper[1:])
+		if err != nil || n < 1 || n > 63 {
+			return 0, invalid
+		}
+		return 64 + n, nil
+	}
+
+	value, err := strconv.Atoi(s)
+	if err != nil || value < 0 || value > 127 {
+		return 0, invalid
+	}
+	return value, nil
+}
+
+// formatPan describes a pan value, e.g. "L32 (32)", "C (64)"
+func formatPan(value int) string {
+	switch {
+	case value < 64:
+		return fmt.Sprintf("L%d (%d)", 64-value, value)
+	case value > 64:
+		return fmt.Sprintf("R%d (%d)", value-64, value)
+	}
+	return "C (64)"
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// MIDIMonitor logs the MIDI messages playback sends. *playback.Engine
+// implements it.
+type MIDIMonitor interface {
+	SetMonitor(w io.Writer)
+}
+
+// SetMIDIMonitor connects the handler to the engine logged by 'monitor'
+func (h *Handler) SetMIDIMonitor(monitor MIDIMonitor) {
+	h.midiMonitor = monitor
+}
+
+// handleMonitor: monitor [on|off|<file>]
+// Prints every MIDI message sent (time, type, channel and data), or
+// appends them to a file, to see why a synth isn't responding
+func (h *Handler) handleMonitor(parts []string) error {
+	if h.midiMonitor == nil {
+		return fmt.Errorf("'monitor' requires playback to be running")
+	}
+	if len(parts) == 1 {
+		switch h.monitoring {
+		case "":
+			fmt.Fprintln(h.out, "Monitor off ('monitor on' prints MIDI messages, 'monitor <file>' logs them)")
+		case "console":
+			fmt.Fprintln(h.out, "Monitor on: printing MIDI messages")
+		default:
+			fmt.Fprintf(h.out, "Monitor on: logging MIDI messages to %s\n", h.monitoring)
+		}
+		return nil
+	}
+	if len(parts) != 2 {
+		return fmt.Errorf("usage: monitor [on|off|<file>] (e.g., 'monitor on' or 'monitor midi.log')")
+	}
+
+	switch parts[1] {
+	case "off":
+		h.stopMonitor()
+		fmt.Fprintln(h.out, "Monitor off")
+	case "on":
+		h.stopMonitor()
+		h.midiMonitor.SetMonitor(h.out)
+		h.monitoring = "console"
+		fmt.Fprintln(h.out, "Monitor on: printing MIDI messages ('monitor off' to stop)")
+	default:
+		f, err := os.OpenFile(parts[1], os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open monitor log: %w", err)
+		}
+		h.stopMonitor()
+		h.midiMonitor.SetMonitor(f)
+		h.monitorFile, h.monitoring = f, parts[1]
+		fmt.Fprintf(h.out, "Monitor on: logging MIDI messages to %s ('monitor off' to stop)\n", parts[1])
+	}
+	return nil
+}
+
+// stopMonitor stops monitoring and closes the log file, if any
+func (h *Handler) stopMonitor() {
+	if h.monitoring == "" {
+		return
+	}
+	h.midiMonitor.SetMonitor(nil)
+	if h.monitorFile != nil {
+		h.monitorFile.Close()
+		h.monitorFile = nil
+	}
+	h.monitoring = ""
+}
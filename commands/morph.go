@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+// handleMorph: morph <pattern> <loops> | morph stop
+// Moves from the current pattern to a saved one over a number of loops:
+// steps switch over a few at a time while velocities, CCs, tempo and swing
+// slide between the two
+func (h *Handler) handleMorph(parts []string) error {
+	if len(parts) == 2 && parts[1] == "stop" {
+		if h.morphStop == nil {
+			return fmt.Errorf("no morph running")
+		}
+		h.stopMorph()
+		fmt.Fprintln(h.out, "Morph stopped; the current pattern keeps looping")
+		return nil
+	}
+	if len(parts) != 3 {
+		return fmt.Errorf("usage: morph <pattern> <loops> or morph stop (e.g., 'morph chorus 8')")
+	}
+	loops, err := strconv.Atoi(parts[2])
+	if err != nil || loops < 1 || loops > 64 {
+		return fmt.Errorf("invalid loop count: %s (must be 1-64)", parts[2])
+	}
+	if h.clock == nil {
+		return fmt.Errorf("'morph' requires playback to be running")
+	}
+	target, err := sequence.Load(parts[1])
+	if err != nil {
+		return err
+	}
+
+	h.stopSong()
+	h.stopAudition()
+	h.stopMorph()
+	h.morphStop = make(chan struct{})
+	m := sequence.NewMorph(h.pattern, target, rand.Float64)
+	h.queueMorph(m, parts[1], 1, loops)
+	go h.runMorph(m, parts[1], loops, h.morphStop)
+	fmt.Fprintf(h.out, "Morphing to '%s' over %d loops from the next loop\n", parts[1], loops)
+	return nil
+}
+
+// queueMorph queues stage loop of loops; the last one is the target itself
+func (h *Handler) queueMorph(m *sequence.Morph, name string, loop, loops int) {
+	h.pattern.CopyFrom(m.At(float64(loop) / float64(loops)))
+	if loop == loops {
+		h.MarkSaved(name)
+	}
+}
+
+// runMorph follows the playback clock, queuing the next stage each time
+// the last one starts, until the target is queued or stop is closed
+func (h *Handler) runMorph(m *sequence.Morph, name string, loops int, stop chan struct{}) {
+	events := h.clock.Subscribe(waitEventBuffer)
+	defer h.clock.Unsubscribe(events)
+	defer h.Update(func() error {
+		if h.morphStop == stop {
+			h.morphStop = nil
+		}
+		return nil
+	})
+
+	for loop := 2; loop <= loops; {
+		select {
+		case <-stop:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if ev.Type != playback.EventLoop {
+				continue
+			}
+		}
+		h.Update(func() error {
+			select {
+			case <-stop:
+			default:
+				h.queueMorph(m, name, loop, loops)
+			}
+			return nil
+		})
+		loop++
+	}
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	fmt.Fprintln(h.out, theme.Dim(fmt.Sprintf("Morph reaches '%s' on the next loop", name)))
+}
+
+func (h *Handler) stopMorph() {
+	if h.morphStop == nil {
+		return
+	}
+	close(h.morphStop)
+	h.morphStop = nil
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// handleMuteStep: mute-step [<step>...] | unmute-step <step>...|all
+// Silences steps without losing their note, velocity, gate and CCs, or lets
+// them play again; 'mute-step' alone lists the muted steps
+func (h *Handler) handleMuteStep(parts []string) error {
+	mute := strings.ToLower(parts[0]) == "mute-step"
+	usage := fmt.Errorf("usage: mute-step [<step>...] or unmute-step <step>...|all (e.g., 'mute-step 5 13')")
+
+	if len(parts) == 1 {
+		if !mute {
+			return usage
+		}
+		var muted []string
+		h.pattern.ForEachStep(func(stepNum int, step sequence.Step) {
+			if step.Muted {
+				muted = append(muted, strconv.Itoa(stepNum))
+			}
+		})
+		if len(muted) == 0 {
+			fmt.Fprintln(h.out, "No muted steps")
+		} else {
+			fmt.Fprintf(h.out, "Muted steps: %s\n", strings.Join(muted, ", "))
+		}
+		return nil
+	}
+
+	var steps []int
+	if !mute && len(parts) == 2 && strings.ToLower(parts[1]) == "all" {
+		h.pattern.ForEachStep(func(stepNum int, step sequence.Step) {
+			if step.Muted {
+				steps = append(steps, stepNum)
+			}
+		})
+	} else {
+		for _, arg := range parts[1:] {
+			stepNum, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid step number: %s", arg)
+			}
+			steps = append(steps, stepNum)
+		}
+	}
+
+	for _, stepNum := range steps {
+		if err := h.pattern.SetMuted(stepNum, mute); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case len(steps) == 0:
+		fmt.Fprintln(h.out, "No muted steps")
+	case mute:
+		fmt.Fprintf(h.out, "Muted step(s) %s\n", joinInts(steps))
+	default:
+		fmt.Fprintf(h.out, "Unmuted step(s) %s\n", joinInts(steps))
+	}
+	return nil
+}
+
+// joinInts lists numbers separated by commas
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ", ")
+}
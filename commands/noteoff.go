@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// handleNoteOffMode: noteoff-mode [cut|ring] | noteoff-mode retrigger <on|off>
+// Controls whether notes are cut at the loop boundary or ring across it, and
+// whether retriggering a sounding note sends a NoteOff first
+func (h *Handler) handleNoteOffMode(parts []string) error {
+	usage := fmt.Errorf("usage: noteoff-mode [cut|ring] or noteoff-mode retrigger <on|off> (e.g., 'noteoff-mode ring')")
+
+	switch {
+	case len(parts) == 1:
+		h.showNoteOffMode()
+		return nil
+
+	case len(parts) == 2:
+		if err := h.pattern.SetNoteOffMode(parts[1]); err != nil {
+			return usage
+		}
+		if h.pattern.GetNoteOffMode() == sequence.NoteOffRing {
+			fmt.Fprintln(h.out, "Note-off mode: ring (notes ring across the loop boundary)")
+		} else {
+			fmt.Fprintln(h.out, "Note-off mode: cut (notes stop at the loop boundary)")
+		}
+		return nil
+
+	case len(parts) == 3 && strings.ToLower(parts[1]) == "retrigger":
+		switch strings.ToLower(parts[2]) {
+		case "on":
+			h.pattern.SetLegato(false)
+			fmt.Fprintln(h.out, "Retrigger: NoteOff is sent before a sounding note plays again")
+		case "off":
+			h.pattern.SetLegato(true)
+			fmt.Fprintln(h.out, "Retrigger: off (a sounding note plays again without a NoteOff)")
+		default:
+			return usage
+		}
+		return nil
+	}
+	return usage
+}
+
+// showNoteOffMode prints the current note-off settings
+func (h *Handler) showNoteOffMode() {
+	mode := h.pattern.GetNoteOffMode()
+	retrigger := "on"
+	if h.pattern.GetLegato() {
+		retrigger = "off"
+	}
+	fmt.Fprintf(h.out, "Note-off mode: %s, retrigger NoteOff: %s\n", mode, retrigger)
+}
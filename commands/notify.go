@@ -0,0 +1,40 @@
+package commands
+
+import "fmt"
+
+// OnPatternChange registers fn to be called after a command run through
+// Execute changes the pattern (including swing and humanization).
+// fn runs while commands are blocked, so it must not block. Returns a
+// function that removes the listener.
+func (h *Handler) OnPatternChange(fn func()) (remove func()) {
+	h.listenersMu.Lock()
+	defer h.listenersMu.Unlock()
+
+	if h.changeListeners == nil {
+		h.changeListeners = make(map[int]func())
+	}
+	id := h.nextListenerID
+	h.nextListenerID++
+	h.changeListeners[id] = fn
+
+	return func() {
+		h.listenersMu.Lock()
+		defer h.listenersMu.Unlock()
+		delete(h.changeListeners, id)
+	}
+}
+
+// notifyPatternChange calls all pattern change listeners
+func (h *Handler) notifyPatternChange() {
+	h.listenersMu.Lock()
+	defer h.listenersMu.Unlock()
+	for _, fn := range h.changeListeners {
+		fn()
+	}
+}
+
+// liveState fingerprints everything that affects playback, including
+// settings that aren't saved with the pattern
+func (h *Handler) liveState() string {
+	return fmt.Sprintf("%s|%d/%d|%+v", h.patternState(), h.pattern.GetSwing(), h.pattern.GetSwingUnit(), h.pattern.GetHumanization())
+}
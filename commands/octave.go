@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// handleOctaveConvention: octave-convention [yamaha|roland]
+// Shows or sets which octave number middle C gets in note names typed and shown
+func (h *Handler) handleOctaveConvention(parts []string) error {
+	switch len(parts) {
+	case 1:
+	case 2:
+		if err := sequence.SetOctaveConvention(parts[1]); err != nil {
+			return fmt.Errorf("usage: octave-convention [%s|%s]: %w", sequence.OctaveYamaha, sequence.OctaveRoland, err)
+		}
+	default:
+		return fmt.Errorf("usage: octave-convention [%s|%s]", sequence.OctaveYamaha, sequence.OctaveRoland)
+	}
+	fmt.Fprintf(h.out, "Octave convention: %s (middle C, MIDI 60, is %s)\n", sequence.OctaveConvention(), sequence.MIDIToNoteName(60))
+	return nil
+}
@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// output is where a handler prints. It can be pointed elsewhere while
+// commands, hooks and background goroutines print through it.
+type output struct {
+	mu sync.Mutex
+	w  io.Writer // nil prints to os.Stdout
+}
+
+// Write implements io.Writer
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.w == nil {
+		return os.Stdout.Write(p)
+	}
+	return o.w.Write(p)
+}
+
+// SetOutput sends what commands print to w instead of stdout, e.g. into
+// the live view. The MIDI monitor, when printing, follows.
+func (h *Handler) SetOutput(w io.Writer) {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+	h.out.w = w
+}
+
+// Output returns the writer commands print to
+func (h *Handler) Output() io.Writer {
+	return h.out
+}
@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/chzyer/readline"
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+// Muter silences playback while it keeps time. *playback.Engine implements it.
+type Muter interface {
+	SetMuted(muted bool)
+	IsMuted() bool
+}
+
+// SetMuter connects the handler to the engine muted by 'perform'
+func (h *Handler) SetMuter(muter Muter) {
+	h.muter = muter
+}
+
+// performKeys is shown when perform mode starts
+const performKeys = `Perform mode: keys act at once, without Enter
+  space      mute / unmute
+  f          fill: roll the last bar into the next loop
+  1-8        launch scene 1-8
+  up/down    transpose a semitone up/down
+  right/left transpose an octave up/down
+  q          back to the prompt`
+
+// handlePerform: perform
+// Perform mode reads single keys, so it only runs at the interactive prompt
+// (see ReadLoop); this handles it everywhere else
+func (h *Handler) handlePerform(parts []string) error {
+	return fmt.Errorf("'perform' reads single keys and only works at the interactive prompt")
+}
+
+// perform reads single keypresses through the prompt's line editor until
+// 'q', Ctrl+C or Ctrl+D. It runs outside Update so that what it starts
+// (fills, songs) keeps running between keys.
+func (h *Handler) perform(rl *readline.Instance) {
+	fmt.Fprintln(h.out, performKeys)
+	p := &performer{h: h}
+
+	cfg := rl.Config.Clone()
+	cfg.Prompt = "perform> "
+	done := false
+	cfg.FuncFilterInputRune = func(r rune) (rune, bool) {
+		switch r {
+		case readline.CharInterrupt, readline.CharDelete:
+			done = true
+			return r, true
+		case 'q', 'Q':
+			done = true
+			return readline.CharEnter, true
+		}
+		p.key(r)
+		return r, false
+	}
+	old := rl.SetConfig(cfg)
+	defer rl.SetConfig(old)
+
+	for !done {
+		if _, err := rl.Readline(); err != nil {
+			break
+		}
+	}
+	if h.muter != nil && h.muter.IsMuted() {
+		h.muter.SetMuted(false)
+		fmt.Fprintln(h.out, "Unmuted")
+	}
+	fmt.Fprintln(h.out, "Left perform mode")
+}
+
+// performer carries perform mode's state between keys
+type performer struct {
+	h          *Handler
+	transposed int // semitones moved so far
+}
+
+// key runs the action bound to a key, reporting what it did
+func (p *performer) key(r rune) {
+	var err error
+	switch {
+	case r == ' ':
+		err = p.toggleMute()
+	case r == 'f' || r == 'F':
+		err = p.h.Update(p.h.playFill)
+	case r >= '1' && r <= '8':
+		err = p.h.Update(func() error { return p.h.launchScene(strconv.Itoa(int(r - '0'))) })
+	case r == readline.CharPrev:
+		err = p.transpose(1)
+	case r == readline.CharNext:
+		err = p.transpose(-1)
+	case r == readline.CharForward:
+		err = p.transpose(12)
+	case r == readline.CharBackward:
+		err = p.transpose(-12)
+	default:
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(p.h.out, theme.Error(fmt.Sprintf("Error: %v", err)))
+	}
+}
+
+func (p *performer) toggleMute() error {
+	if p.h.muter == nil {
+		return fmt.Errorf("playback is not running")
+	}
+	muted := !p.h.muter.IsMuted()
+	p.h.muter.SetMuted(muted)
+	if muted {
+		fmt.Fprintln(p.h.out, "Muted")
+	} else {
+		fmt.Fprintln(p.h.out, "Unmuted")
+	}
+	return nil
+}
+
+func (p *performer) transpose(semitones int) error {
+	err := p.h.Update(func() error { return p.h.transpose(semitones) })
+	if err != nil {
+		return err
+	}
+	p.transposed += semitones
+	fmt.Fprintf(p.h.out, "Transposed %+d (%+d in total)\n", semitones, p.transposed)
+	return nil
+}
+
+// playFill plays the pattern's fill for one loop, then the pattern again
+func (h *Handler) playFill() error {
+	if h.clock == nil {
+		return fmt.Errorf("fills require playback to be running")
+	}
+	fill := h.pattern.Fill()
+	if h.audition != nil {
+		fill = h.audition.working.Fill()
+	}
+	h.startAudition([]*sequence.Pattern{fill}, []string{""}, 1)
+	fmt.Fprintln(h.out, "Fill on the next loop")
+	return nil
+}
+
+// transpose moves every note by semitones, keeping everything else; notes
+// that would leave the MIDI range stay where they are
+func (h *Handler) transpose(semitones int) error {
+	steps := h.pattern.Snapshot()
+	for i, step := range steps {
+		if step.IsRest {
+			continue
+		}
+		if note, err := sequence.Transpose(step.Note, semitones); err == nil {
+			steps[i].Note = note
+		}
+	}
+	return h.pattern.SetSteps(steps)
+}
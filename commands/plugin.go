@@ -0,0 +1,199 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+// PluginsDir holds plugin executables; each one becomes a command
+var PluginsDir = "plugins"
+
+// pluginTimeout limits how long a plugin may run before it is killed
+const pluginTimeout = 30 * time.Second
+
+// describeTimeout limits the '--describe' query made when loading plugins
+const describeTimeout = 2 * time.Second
+
+// pluginName matches file names usable as command names
+var pluginName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// pluginInput is written to a plugin's stdin: the pattern in the saved-file
+// format, plus settings that aren't saved
+type pluginInput struct {
+	*sequence.PatternFile
+	Swing        int                   `json:"swing"`
+	Humanization sequence.Humanization `json:"humanization"`
+}
+
+// LoadPlugins registers an executable in PluginsDir as a command named after
+// the file (without extension). Plugins loaded before are replaced; built-in
+// commands can't be overridden. Returns the registered names.
+//
+// Protocol: '<plugin> --describe' may print a usage line followed by help
+// lines. When run, the plugin gets the command's arguments, the current
+// pattern as JSON on stdin, and prints Interplay commands to stdout, one per
+// line ('#' lines are shown as comments). stderr is passed through.
+// Skipped plugins are reported on w.
+func LoadPlugins(w io.Writer) ([]string, error) {
+	unregisterPlugins()
+
+	entries, err := os.ReadDir(PluginsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read plugins: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		if !pluginName.MatchString(name) {
+			continue
+		}
+		path := filepath.Join(PluginsDir, entry.Name())
+		if _, exists := lookupCommand(name); exists {
+			fmt.Fprintln(w, theme.Warning(fmt.Sprintf("⚠️  Plugin %s skipped: '%s' is already a command", path, name)))
+			continue
+		}
+
+		usage, help := describePlugin(path, name)
+		register(&Command{
+			Name:   name,
+			Usage:  usage,
+			Help:   append(help, "Plugin: "+path),
+			Run:    runPlugin(path),
+			Plugin: path,
+		})
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// unregisterPlugins removes all plugin commands from the registry
+func unregisterPlugins() {
+	kept := registry[:0]
+	for _, cmd := range registry {
+		if cmd.Plugin == "" {
+			kept = append(kept, cmd)
+			continue
+		}
+		delete(commandIndex, cmd.Name)
+	}
+	registry = kept
+}
+
+// describePlugin asks a plugin for its usage and help. Plugins that don't
+// answer get a generic description.
+func describePlugin(path, name string) (usage string, help []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "--describe").Output()
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if err != nil || !strings.HasPrefix(lines[0], name) {
+		return name + " [args]", []string{"Plugin command"}
+	}
+	return strings.TrimSpace(lines[0]), lines[1:]
+}
+
+// runPlugin returns a command running the plugin at path and then the
+// commands it prints, reporting errors per command like macros do
+func runPlugin(path string) func(h *Handler, parts []string) error {
+	return func(h *Handler, parts []string) error {
+		name := parts[0]
+		if h.macroDepth >= maxMacroDepth {
+			return fmt.Errorf("plugin '%s' nested too deeply (limit %d)", name, maxMacroDepth)
+		}
+
+		pf := h.pattern.ToPatternFile("")
+		pf.CreatedAt = ""
+		input, err := json.Marshal(pluginInput{pf, h.pattern.GetSwing(), h.pattern.GetHumanization()})
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+		defer cancel()
+
+		var stdout bytes.Buffer
+		cmd := exec.CommandContext(ctx, path, parts[1:]...)
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("plugin '%s' timed out after %s", name, pluginTimeout)
+			}
+			return fmt.Errorf("plugin '%s' failed: %w", name, err)
+		}
+
+		h.macroDepth++
+		defer func() { h.macroDepth-- }()
+
+		failed := 0
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if strings.HasPrefix(line, "#") {
+				fmt.Fprintln(h.out, line)
+				continue
+			}
+			fmt.Fprintf(h.out, "  > %s\n", line)
+			if err := h.ProcessCommand(line); err != nil {
+				fmt.Fprintf(h.out, "  Error: %v\n", err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("plugin '%s': %d command(s) failed", name, failed)
+		}
+		return nil
+	}
+}
+
+// handlePlugins: plugins [reload]
+func (h *Handler) handlePlugins(parts []string) error {
+	switch {
+	case len(parts) == 2 && strings.ToLower(parts[1]) == "reload":
+		names, err := LoadPlugins(h.out)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h.out, "Loaded %d plugin(s) from %s\n", len(names), PluginsDir)
+		return nil
+	case len(parts) != 1:
+		return fmt.Errorf("usage: plugins [reload]")
+	}
+
+	found := false
+	for _, cmd := range registry {
+		if cmd.Plugin != "" {
+			fmt.Fprintf(h.out, "  %-20s %s\n", cmd.Name, cmd.Plugin)
+			found = true
+		}
+	}
+	if !found {
+		fmt.Fprintf(h.out, "No plugins loaded (add executables to %s/)\n", PluginsDir)
+	}
+	return nil
+}
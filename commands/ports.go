@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"fmt"
+)
+
+// PortLister lists the MIDI ports for 'ports'. cmd/interplay implements it
+// with the midi package, which needs cgo, so commands doesn't import it.
+type PortLister interface {
+	// ListPorts returns the names of the input and output ports by index
+	ListPorts() (in, out []string, err error)
+	// OutputPort returns the index of the output port playback sends to,
+	// and whether it is still open
+	OutputPort() (index int, open bool)
+}
+
+// SetPortLister connects the handler to the MIDI ports shown by 'ports'
+func (h *Handler) SetPortLister(ports PortLister) {
+	h.ports = ports
+}
+
+// handlePorts: ports
+// Lists the MIDI input and output ports with their indices, marking the
+// output playback sends to, e.g. to check a synth plugged in after startup
+func (h *Handler) handlePorts(parts []string) error {
+	if len(parts) != 1 {
+		return fmt.Errorf("usage: ports")
+	}
+	if h.ports == nil {
+		return fmt.Errorf("'ports' requires a MIDI connection")
+	}
+	in, out, err := h.ports.ListPorts()
+	if err != nil {
+		return fmt.Errorf("failed to list MIDI ports: %w", err)
+	}
+	connected, open := h.ports.OutputPort()
+
+	fmt.Fprintln(h.out, "MIDI outputs:")
+	if len(out) == 0 {
+		fmt.Fprintln(h.out, "  (none)")
+	}
+	for i, name := range out {
+		switch {
+		case i == connected && open:
+			fmt.Fprintf(h.out, "* %d: %s (connected)\n", i, name)
+		case i == connected:
+			fmt.Fprintf(h.out, "* %d: %s (closed)\n", i, name)
+		default:
+			fmt.Fprintf(h.out, "  %d: %s\n", i, name)
+		}
+	}
+	fmt.Fprintln(h.out, "MIDI inputs:")
+	if len(in) == 0 {
+		fmt.Fprintln(h.out, "  (none)")
+	}
+	for i, name := range in {
+		fmt.Fprintf(h.out, "  %d: %s\n", i, name)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// patternState fingerprints the pattern as it would be saved, so edits that
+// are undone again don't count as unsaved changes
+func (h *Handler) patternState() string {
+	pf := h.pattern.ToPatternFile("")
+	pf.CreatedAt = ""
+	data, _ := json.Marshal(pf)
+	return string(data)
+}
+
+// MarkSaved records the current pattern as saved (or loaded) under name,
+// e.g. after loading a pattern at startup
+func (h *Handler) MarkSaved(name string) {
+	h.savedState = h.patternState()
+	h.patternName = name
+	h.savedModTime = fileModTime(name)
+}
+
+// IsModified reports whether the pattern has changed since it was last
+// saved or loaded (or since startup)
+func (h *Handler) IsModified() bool {
+	return h.patternState() != h.savedState
+}
+
+// confirmQuit asks whether to save a modified pattern before exiting.
+// Answers: y saves (asking for a name if the pattern has none), n discards,
+// any other text is used as the pattern name, and an empty answer cancels.
+// Returns true if it is OK to exit.
+func (h *Handler) confirmQuit(readLine func(prompt string) (string, error)) bool {
+	if !h.IsModified() {
+		return true
+	}
+
+	for {
+		answer, err := readLine("Pattern modified — save before exit? (y/n/name) ")
+		if err != nil {
+			// Input closed: nothing more we can ask
+			return true
+		}
+
+		answer = strings.TrimSpace(answer)
+		name := answer
+		switch strings.ToLower(answer) {
+		case "":
+			fmt.Fprintln(h.out, "Quit cancelled")
+			return false
+		case "n", "no":
+			return true
+		case "y", "yes":
+			name = h.patternName
+			if name == "" {
+				if name, err = readLine("Pattern name: "); err != nil {
+					return true
+				}
+				name = strings.TrimSpace(name)
+				if name == "" {
+					continue
+				}
+			}
+		}
+
+		if err := h.handleSave([]string{"save", name}); err != nil {
+			fmt.Fprintf(h.out, "Error: %v\n", err)
+			continue
+		}
+		return true
+	}
+}
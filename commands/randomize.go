@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// handleRandomize: randomize velocity|gate <steps> <min>-<max>
+// Gives each note in the steps (e.g. '1-16', '5' or 'all') a random value
+// in the range, once: unlike humanize, the values stay the same every loop
+func (h *Handler) handleRandomize(parts []string) error {
+	usage := fmt.Errorf("usage: randomize velocity|gate <steps> <min>-<max> (e.g., 'randomize velocity 1-16 80-120')")
+	if len(parts) != 4 {
+		return usage
+	}
+
+	var limit int
+	switch parts[1] {
+	case "velocity", "vel":
+		limit = 127
+	case "gate":
+		limit = 100
+	default:
+		return usage
+	}
+
+	steps := h.pattern.Snapshot()
+	first, last := 1, len(steps)
+	if parts[2] != "all" {
+		var err error
+		if first, last, err = parseRange(parts[2], 1, len(steps)); err != nil {
+			return fmt.Errorf("invalid steps %s: %w", parts[2], err)
+		}
+	}
+	low, high, err := parseRange(parts[3], 1, limit)
+	if err != nil {
+		return fmt.Errorf("invalid %s range %s: %w", parts[1], parts[3], err)
+	}
+
+	notes := 0
+	for i := first - 1; i < last; i++ {
+		if steps[i].IsRest {
+			continue
+		}
+		value := low + rand.IntN(high-low+1)
+		if limit == 127 {
+			steps[i].Velocity = uint8(value)
+		} else {
+			steps[i].Gate = value
+			steps[i].GateMs = 0
+		}
+		notes++
+	}
+	if notes == 0 {
+		return fmt.Errorf("no notes in steps %d-%d", first, last)
+	}
+	if err := h.pattern.SetSteps(steps); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(h.out, "Randomized %s of %d notes in steps %d-%d (%d-%d)\n", parts[1], notes, first, last, low, high)
+	return nil
+}
+
+// parseRange reads "<a>-<b>", or a single number for a one-value range,
+// each within lo-hi
+func parseRange(s string, lo, hi int) (int, int, error) {
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		to = from
+	}
+	a, err := strconv.Atoi(from)
+	if err != nil {
+		return 0, 0, fmt.Errorf("not a number")
+	}
+	b, err := strconv.Atoi(to)
+	if err != nil {
+		return 0, 0, fmt.Errorf("not a number")
+	}
+	if a > b {
+		a, b = b, a
+	}
+	if a < lo || b > hi {
+		return 0, 0, fmt.Errorf("must be within %d-%d", lo, hi)
+	}
+	return a, b, nil
+}
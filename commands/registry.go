@@ -0,0 +1,1092 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/iltempo/interplay/ai"
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// Command describes a REPL command: how it is invoked, documented, and completed
+type Command struct {
+	Name    string   // primary name, e.g. "tempo"
+	Aliases []string // alternative names, e.g. "t"
+	Usage   string   // argument synopsis shown in help, e.g. "tempo <bpm>"
+	Help    []string // help text lines shown next to the usage
+	// Run executes the command; parts[0] is the name the user typed
+	Run func(h *Handler, parts []string) error
+	// Args returns tab completion for the command's arguments (optional)
+	Args func(h *Handler) []readline.PrefixCompleterInterface
+	// NoChain passes the whole line to Run instead of splitting it on semicolons
+	NoChain bool
+	// NoAI keeps the AI from running the command: it changes settings or runs code
+	NoAI bool
+	// Destructive commands can throw away work in one go; the AI may only
+	// run them when allowed with 'ai-allow'
+	Destructive bool
+	// Files reports whether the command, run with parts, reads or writes
+	// files or loads code (nil: never). HTTP clients may only run those
+	// with --http-files, the AI only destructive ones it is allowed.
+	Files func(parts []string) bool
+	// Plugin is the executable behind a plugin command, "" for built-in commands
+	Plugin string
+}
+
+// always is a Files func for commands that always touch files
+func always([]string) bool { return true }
+
+// registry lists all commands in the order they appear in help
+var registry []*Command
+
+// commandIndex maps names and aliases to commands
+var commandIndex = map[string]*Command{}
+
+// register adds a command to the registry. Panics on duplicate names,
+// since that is a programming error caught at startup.
+func register(cmd *Command) {
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		if _, exists := commandIndex[name]; exists {
+			panic(fmt.Sprintf("commands: duplicate command name %q", name))
+		}
+		commandIndex[name] = cmd
+	}
+	registry = append(registry, cmd)
+}
+
+// lookupCommand finds a command by name or alias (case-insensitive)
+func lookupCommand(name string) (*Command, bool) {
+	cmd, ok := commandIndex[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// Commands returns the names of all registered commands (without aliases), sorted
+func Commands() []string {
+	names := make([]string, 0, len(registry))
+	for _, cmd := range registry {
+		names = append(names, cmd.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// helpColumn is where help text starts in the help listing
+const helpColumn = 24
+
+// helpEntry renders one command's usage and help text for the help listing
+func (c *Command) helpEntry() string {
+	indent := strings.Repeat(" ", helpColumn+2)
+	lines := append([]string(nil), c.Help...)
+	if len(c.Aliases) > 0 {
+		lines = append(lines, "Alias: "+strings.Join(c.Aliases, ", "))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("  " + c.Usage)
+	if len(c.Usage) < helpColumn && len(lines) > 0 {
+		sb.WriteString(strings.Repeat(" ", helpColumn-len(c.Usage)) + lines[0])
+		lines = lines[1:]
+	}
+	for _, line := range lines {
+		sb.WriteString("\n" + indent + line)
+	}
+	return sb.String()
+}
+
+// stepArg completes a step number
+func stepArg(h *Handler) []readline.PrefixCompleterInterface {
+	return []readline.PrefixCompleterInterface{readline.PcItemDynamic(h.stepNumbers)}
+}
+
+// patternArg completes a saved pattern name
+func patternArg(h *Handler) []readline.PrefixCompleterInterface {
+	return []readline.PrefixCompleterInterface{readline.PcItemDynamic(savedPatternNames)}
+}
+
+// ccNameArg completes a CC name
+func ccNameArg(h *Handler) []readline.PrefixCompleterInterface {
+	return []readline.PrefixCompleterInterface{readline.PcItemDynamic(h.ccNameList)}
+}
+
+// genreArg completes a genre preset name
+func genreArg(h *Handler) []readline.PrefixCompleterInterface {
+	genres := func(string) []string { return append(ai.Genres(), "off") }
+	return []readline.PrefixCompleterInterface{readline.PcItemDynamic(genres)}
+}
+
+// words completes a fixed set of keywords
+func words(options ...string) func(h *Handler) []readline.PrefixCompleterInterface {
+	return func(h *Handler) []readline.PrefixCompleterInterface {
+		items := make([]readline.PrefixCompleterInterface, len(options))
+		for i, option := range options {
+			items[i] = readline.PcItem(option)
+		}
+		return items
+	}
+}
+
+func init() {
+	register(&Command{
+		Name:  "set",
+		Usage: "set <step> <note|rest> [vel:<val>] [gate:<%|ms>] [dur:<steps>] [@<stamp>]",
+		Help: []string{
+			"Set a step to play a note or rest",
+			"(e.g., 'set 1 C4', 'set 1 rest', 'set 1 C4 vel:120 gate:85 dur:3')",
+			"Optional parameters can be combined in any order",
+		},
+		Run: (*Handler).handleSet,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			notes := readline.PcItemDynamic(func(string) []string { return noteNames() })
+			return []readline.PrefixCompleterInterface{readline.PcItemDynamic(h.stepNumbers, notes)}
+		},
+	})
+	register(&Command{
+		Name:    "rest",
+		Aliases: []string{"r"},
+		Usage:   "rest <step>",
+		Help:    []string{"Set a step to rest/silence (e.g., 'rest 1')", "Same as 'set <step> rest'"},
+		Run:     (*Handler).handleRest,
+		Args:    stepArg,
+	})
+	register(&Command{
+		Name:  "insert",
+		Usage: "insert <step> [count] [--wrap]",
+		Help: []string{
+			"Insert rests before a step, moving the later steps along (e.g., 'insert 5')",
+			"The pattern grows; with --wrap it keeps its length and the last steps wrap around to the gap",
+		},
+		Run:  (*Handler).handleInsert,
+		Args: stepArg,
+	})
+	register(&Command{
+		Name:  "remove",
+		Usage: "remove <step> [count] [--wrap]",
+		Help: []string{
+			"Remove steps, moving the later steps back (e.g., 'remove 5' or 'remove 5 2')",
+			"The pattern shrinks; with --wrap it keeps its length and the removed steps go to the end",
+		},
+		Run:  (*Handler).handleInsert,
+		Args: stepArg,
+	})
+	register(&Command{
+		Name:  "mute-step",
+		Usage: "mute-step [<step>...]",
+		Help:  []string{"Silence steps but keep their note and CCs (e.g., 'mute-step 5')", "Without steps, lists the muted ones"},
+		Run:   (*Handler).handleMuteStep,
+		Args:  stepArg,
+	})
+	register(&Command{
+		Name:  "unmute-step",
+		Usage: "unmute-step <step>...|all",
+		Help:  []string{"Let muted steps play again (e.g., 'unmute-step 5', 'unmute-step all')"},
+		Run:   (*Handler).handleMuteStep,
+		Args:  stepArg,
+	})
+	register(&Command{
+		Name:  "import",
+		Usage: "import <tab|abc|csv|hydrogen> ...",
+		Help: []string{
+			"Set many steps at once from text notation",
+			"Drum lanes: 'import tab C1 x...x...x...x... D1 ....x.......x...'",
+			"  (x hit, X accent, o ghost, . or - leaves the step alone)",
+			"Melody: 'import tab C2 . . G2 | C3 - . .' (. rest, - holds the previous note)",
+			"ABC notation: 'import abc \"L:1/8 K:G | G2 AB c2 B>A | G4 z4\"' (lengths map onto 16th-note steps)",
+			"Replace the pattern from a file: 'import csv groove.csv' (rows of step,note[,velocity])",
+			"  or 'import hydrogen song.h2song [pattern]' (Hydrogen song or pattern file)",
+		},
+		Run:         (*Handler).handleImport,
+		Args:        words("tab", "abc", "csv", "hydrogen"),
+		Files:       func(parts []string) bool { return len(parts) > 1 && parts[1] != "tab" && parts[1] != "abc" },
+		Destructive: true,
+	})
+	register(&Command{
+		Name:    "velocity",
+		Aliases: []string{"v", "vel"},
+		Usage:   "velocity <step> <val>",
+		Help:    []string{"Set step velocity 0-127 (e.g., 'velocity 1 80')"},
+		Run:     (*Handler).handleVelocity,
+		Args:    stepArg,
+	})
+	register(&Command{
+		Name:    "gate",
+		Aliases: []string{"g"},
+		Usage:   "gate <step> <percent|ms>",
+		Help:    []string{"Set step gate length 1-100% or in milliseconds (e.g., 'gate 1 50', 'gate 1 30ms')"},
+		Run:     (*Handler).handleGate,
+		Args:    stepArg,
+	})
+	register(&Command{
+		Name:  "humanize",
+		Usage: "humanize <type> <amt>",
+		Help: []string{
+			"Add random variation (e.g., 'humanize velocity 10')",
+			"Types: velocity (0-64), timing (0-50ms), gate (0-50)",
+			"Use 'humanize' alone to show current settings",
+		},
+		Run:  (*Handler).handleHumanize,
+		Args: words("velocity", "timing", "gate"),
+	})
+	register(&Command{
+		Name:  "randomize",
+		Usage: "randomize velocity|gate <steps> <min>-<max>",
+		Help: []string{
+			"Give each note in the steps a random value once (e.g., 'randomize velocity 1-16 80-120')",
+			"Unlike humanize, the values stay the same every loop; steps may be a range, one step or 'all'",
+		},
+		Run:  (*Handler).handleRandomize,
+		Args: words("velocity", "gate"),
+	})
+	register(&Command{
+		Name:    "swing",
+		Aliases: []string{"sw"},
+		Usage:   "swing [<percent> [8th|16th]] | swing exclude|include <step>...",
+		Help: []string{
+			"Add swing/groove (e.g., 'swing 50' for triplet swing)",
+			"0 = straight, 50 = triplet, 66 = hard swing (0-75)",
+			"Swings 16ths unless told 8th (e.g., 'swing 55 8th' for an 8th-note groove)",
+			"'swing exclude 3 7' keeps steps on the grid; 'swing include all' lets them swing again",
+		},
+		Run:  (*Handler).handleSwing,
+		Args: words("exclude", "include"),
+	})
+	register(&Command{
+		Name:  "velcurve",
+		Usage: "velcurve [curve]",
+		Help: []string{
+			"Map velocities sent to the synth: linear, soft (quieter), hard (louder), fixed [n]",
+			"or custom breakpoints, e.g. 'velcurve custom 0:20 127:100'",
+			"Tames synths with an aggressive velocity response; 'velcurve' alone shows the curve",
+		},
+		Run:  (*Handler).handleVelCurve,
+		Args: words(playback.VelocityCurveNames...),
+	})
+	register(&Command{
+		Name:  "octave-convention",
+		Usage: "octave-convention [yamaha|roland]",
+		Help: []string{
+			"Set which octave middle C (MIDI 60) is in note names you type and see:",
+			"roland: C4 (default), yamaha: C3. Saved patterns are unaffected",
+		},
+		Run:  (*Handler).handleOctaveConvention,
+		Args: words(sequence.OctaveYamaha, sequence.OctaveRoland),
+	})
+	register(&Command{
+		Name:  "noteoff-mode",
+		Usage: "noteoff-mode [cut|ring]",
+		Help: []string{
+			"Cut notes at the loop boundary or let them ring into the next loop (default)",
+			"'noteoff-mode retrigger off' replays a sounding note without a NoteOff first",
+			"Both settings are saved with the pattern",
+		},
+		Run:  (*Handler).handleNoteOffMode,
+		Args: words("cut", "ring", "retrigger"),
+	})
+	register(&Command{
+		Name:  "meter",
+		Usage: "meter [<beats>/<value>] [<resolution>]",
+		Help: []string{
+			"Set the time signature and the note value of a step, e.g. 'meter 6/8' or 'meter 4/4 8th'",
+			"Bars in 'length <n>bars' and 'bar' follow it: 16 steps in 4/4 with 16ths, 12 in 6/8",
+			"Saved with the pattern; 'meter' alone shows it",
+		},
+		Run:  (*Handler).handleMeter,
+		Args: words("3/4", "4/4", "6/8", "7/8", "4th", "8th", "16th", "32nd"),
+	})
+	register(&Command{
+		Name:  "cc",
+		Usage: "cc <cc-num> <val> [--save]",
+		Help: []string{
+			"Set global CC value (transient unless --save)",
+			"e.g., 'cc 74 127' or 'cc cutoff 127' sets filter cutoff to max",
+			"--save keeps it with the pattern as a default sent each loop; --no-save undoes that",
+		},
+		Run:  (*Handler).handleCC,
+		Args: ccNameArg,
+	})
+	register(&Command{
+		Name:  "cc-step",
+		Usage: "cc-step <step> <cc> <val>",
+		Help:  []string{"Set per-step CC automation (persistent, saved)", "e.g., 'cc-step 1 cutoff 127' sets filter on step 1"},
+		Run:   (*Handler).handleCCStep,
+		Args:  stepArg,
+	})
+	register(&Command{
+		Name:  "cc-persist",
+		Usage: "cc-persist [on|off]",
+		Help: []string{
+			"When on, 'cc' values are saved with the pattern (as with --save)",
+			"'cc-persist' alone shows the mode and the saved CC values",
+		},
+		Run:  (*Handler).handleCCPersist,
+		Args: words("on", "off"),
+	})
+	register(&Command{
+		Name:  "volume",
+		Usage: "volume [<0-127>|off]",
+		Help: []string{
+			"Set the pattern volume (CC 7, saved with the pattern)",
+			"Sent at the start of each loop; 'volume off' removes it",
+		},
+		Run:  (*Handler).handleVolume,
+		Args: words("off"),
+	})
+	register(&Command{
+		Name:  "pan",
+		Usage: "pan <step> <value>",
+		Help: []string{
+			"Set step pan (CC 10, saved): 0-127, C, L1-L64 or R1-R63",
+			"e.g., 'pan 1 L32', 'pan 5 C'; 'pan 1 off' clears it",
+		},
+		Run:  (*Handler).handlePan,
+		Args: stepArg,
+	})
+	register(&Command{
+		Name:  "expression",
+		Usage: "expression <step> <value>",
+		Help: []string{
+			"Set step expression (CC 11, saved): 0-127",
+			"e.g., 'expression 1 90'; 'expression 1 off' clears it",
+		},
+		Run:  (*Handler).handleExpression,
+		Args: stepArg,
+	})
+	register(&Command{
+		Name:  "cc-clear",
+		Usage: "cc-clear <step> [cc]",
+		Help:  []string{"Clear CC automation from a step", "e.g., 'cc-clear 1' clears all CC, 'cc-clear 1 74' clears CC#74"},
+		Run:   (*Handler).handleCCClear,
+		Args:  stepArg,
+	})
+	register(&Command{
+		Name:  "cc-apply",
+		Usage: "cc-apply <cc-num>",
+		Help:  []string{"Apply global CC to all steps with notes", "e.g., 'cc-apply 74' converts global CC#74 to per-step"},
+		Run:   (*Handler).handleCCApply,
+		Args:  ccNameArg,
+	})
+	register(&Command{
+		Name:  "cc-show",
+		Usage: "cc-show [cc] [curve]",
+		Help: []string{
+			"Display CC automation in table format, optionally for one CC",
+			"'cc-show 74 curve' plots CC 74 across the steps",
+		},
+		Run:  (*Handler).handleCCShow,
+		Args: ccNameArg,
+	})
+	register(&Command{
+		Name:  "cc-name",
+		Usage: "cc-name [define|delete]",
+		Help: []string{
+			"List CC names usable instead of numbers (e.g., 'cc cutoff 90')",
+			"'cc-name define env-amount 79' adds a name (saved in cc-names.json)",
+			"'cc-name delete env-amount' removes it",
+		},
+		Run:  (*Handler).handleCCName,
+		Args: words("define", "delete"),
+	})
+	register(&Command{
+		Name:    "length",
+		Aliases: []string{"len"},
+		Usage:   "length <steps>|<n>bars [--keep-tail|--fold]",
+		Help: []string{
+			"Set pattern length (e.g., 'length 32'), or in 4/4 bars of 16 steps (e.g., 'length 2bars')",
+			"Shortening keeps the first steps; --keep-tail keeps the last ones instead, and",
+			"--fold moves notes past the end onto the rests they wrap around to",
+			"Asks before removing notes",
+		},
+		Run:         (*Handler).handleLength,
+		Args:        words("1bar", "2bars", "4bars", "8bars", "--keep-tail", "--fold"),
+		Destructive: true,
+	})
+	register(&Command{
+		Name:        "clear",
+		Usage:       "clear [bar <n>]",
+		Help:        []string{"Clear all steps to rests", "'clear bar 2' clears only steps 17-32 (bars are 16 steps of 4/4)"},
+		Run:         (*Handler).handleClear,
+		Args:        words("bar"),
+		Destructive: true,
+	})
+	register(&Command{
+		Name:  "slot",
+		Usage: "slot [<n>|next|prev] | slot copy <from> <to>",
+		Help: []string{
+			"Keep up to 8 patterns in memory and switch between them at the next bar (e.g., 'slot 2')",
+			"An empty slot starts blank; 'slot copy 1 2' duplicates one; 'slot' lists them",
+			"Slots are not saved: use 'save' to keep a pattern",
+		},
+		Run:  (*Handler).handleSlot,
+		Args: words("next", "prev", "copy"),
+	})
+	register(&Command{
+		Name:  "copy",
+		Usage: "copy bar <from> <to>",
+		Help:  []string{"Copy a bar's steps and CCs over another bar (e.g., 'copy bar 1 3')"},
+		Run:   (*Handler).handleCopy,
+		Args:  words("bar"),
+	})
+	register(&Command{
+		Name:  "loop",
+		Usage: "loop [bar <n>|off]",
+		Help: []string{
+			"Play only one bar each loop, to work on it (e.g., 'loop bar 2')",
+			"'loop off' plays the whole pattern again; 'loop' shows what plays",
+		},
+		Run:  (*Handler).handleLoop,
+		Args: words("bar", "off"),
+	})
+	register(&Command{
+		Name:        "reset",
+		Usage:       "reset",
+		Help:        []string{"Reset to default pattern"},
+		Run:         (*Handler).handleReset,
+		Destructive: true,
+	})
+	register(&Command{
+		Name:    "tempo",
+		Aliases: []string{"t", "bpm"},
+		Usage:   "tempo <bpm>",
+		Help:    []string{"Change tempo (e.g., 'tempo 120')"},
+		Run:     (*Handler).handleTempo,
+	})
+	register(&Command{
+		Name:    "show",
+		Aliases: []string{"s"},
+		Usage:   "show",
+		Help:    []string{"Display current pattern (CC automation shown in brackets)"},
+		Run:     (*Handler).handleShow,
+	})
+	register(&Command{
+		Name:  "analyze",
+		Usage: "analyze",
+		Help: []string{
+			"Detect the key and scale; show pitch classes, note density per bar,",
+			"velocity range and syncopation of the current pattern",
+		},
+		Run: (*Handler).handleAnalyze,
+	})
+	register(&Command{
+		Name:  "density",
+		Usage: "density [<percent> [<scale>]]",
+		Help: []string{
+			"Thin or thicken the pattern to about percent of its steps holding a note (e.g., 'density 25')",
+			"Removes the quietest notes first; adds notes from the scale on free steps,",
+			"in the detected key unless one is given (e.g., 'density 60 D dorian')",
+		},
+		Run: (*Handler).handleDensity,
+	})
+	register(&Command{
+		Name:  "pause",
+		Usage: "pause",
+		Help:  []string{"Pause playback (silences sounding notes)"},
+		Run:   (*Handler).handlePause,
+	})
+	register(&Command{
+		Name:  "resume",
+		Usage: "resume",
+		Help:  []string{"Resume paused playback"},
+		Run:   (*Handler).handleResume,
+	})
+	register(&Command{
+		Name:  "verbose",
+		Usage: "verbose [on|off]",
+		Help:  []string{"Toggle or set verbose step output"},
+		Run:   (*Handler).handleVerbose,
+		Args:  words("on", "off"),
+	})
+	register(&Command{
+		Name:  "ports",
+		Usage: "ports",
+		Help:  []string{"List MIDI input and output ports, marking the output in use"},
+		Run:   (*Handler).handlePorts,
+	})
+	register(&Command{
+		Name:  "monitor",
+		Usage: "monitor [on|off|<file>]",
+		Help: []string{
+			"Print every MIDI message sent: time, type, channel and data (e.g., 'monitor on')",
+			"'monitor midi.log' appends them to a file instead",
+		},
+		Run:   (*Handler).handleMonitor,
+		Args:  words("on", "off"),
+		Files: func(parts []string) bool { return len(parts) == 2 && parts[1] != "on" && parts[1] != "off" },
+	})
+	register(&Command{
+		Name:  "save",
+		Usage: "save <name>",
+		Help:  []string{"Save current pattern (e.g., 'save bass_line')"},
+		Run:   (*Handler).handleSave,
+		Args:  patternArg,
+		Files: always,
+	})
+	register(&Command{
+		Name:        "load",
+		Usage:       "load <name>",
+		Help:        []string{"Load a saved pattern (e.g., 'load bass_line')"},
+		Run:         (*Handler).handleLoad,
+		Args:        patternArg,
+		Files:       always,
+		Destructive: true,
+	})
+	register(&Command{
+		Name:        "reload",
+		Usage:       "reload",
+		Help:        []string{"Re-read the current pattern from disk, discarding unsaved changes"},
+		Run:         (*Handler).handleReload,
+		Files:       always,
+		Destructive: true,
+	})
+	register(&Command{
+		Name:  "watch",
+		Usage: "watch [on|off]",
+		Help: []string{
+			"Reload the current pattern automatically when its file changes on disk",
+			"(e.g. edited in another tool or updated by git pull)",
+		},
+		Run:   (*Handler).handleWatch,
+		Args:  words("on", "off"),
+		Files: always,
+	})
+	register(&Command{
+		Name:    "list",
+		Aliases: []string{"ls"},
+		Usage:   "list [collection/] [--sort <key>] [--tag <tag>]",
+		Help: []string{
+			"List saved patterns with tempo, length, notes, date saved and tags",
+			"'list basslines/' shows one collection (saved with 'save basslines/funk1')",
+			"Sort by name (default), date (newest first), tempo, length or notes",
+			"e.g., 'list --sort date', 'list --tag techno'",
+		},
+		Run: (*Handler).handleList,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{
+				readline.PcItem("--sort", words(listSorts...)(h)...),
+				readline.PcItem("--tag"),
+			}
+		},
+	})
+	register(&Command{
+		Name:  "tag",
+		Usage: "tag [<tag>...|--clear]",
+		Help: []string{
+			"Tag the current pattern (saved with it), e.g. 'tag techno dark'",
+			"'list --tag techno' then finds it; 'tag' alone shows the tags",
+		},
+		Run:   (*Handler).handleTag,
+		Files: always,
+	})
+	register(&Command{
+		Name:  "export",
+		Usage: "export script <file>",
+		Help: []string{
+			"Write the pattern as a script of commands (e.g., 'export script groove.txt')",
+			"Scripts diff well in git; replay one with --script",
+		},
+		Run:   (*Handler).handleExport,
+		Args:  words("script"),
+		Files: always,
+	})
+	register(&Command{
+		Name:        "delete",
+		Usage:       "delete <name>",
+		Help:        []string{"Delete a saved pattern (e.g., 'delete bass_line')"},
+		Run:         (*Handler).handleDelete,
+		Args:        patternArg,
+		Files:       always,
+		Destructive: true,
+	})
+	register(&Command{
+		Name:    "wait",
+		Aliases: []string{"sleep"},
+		Usage:   "wait <n> <unit>",
+		Help: []string{
+			"Pause script execution, synced to playback (e.g., 'wait 2 bars')",
+			"Units: beats, bars, seconds, loops; 'wait loop' waits for the next loop",
+			"'sleep <n>' waits n seconds",
+		},
+		Run:  (*Handler).handleWait,
+		Args: words("loop"),
+	})
+	register(&Command{
+		Name:  "let",
+		Usage: "let <name>=<value>",
+		Help: []string{
+			"Set a variable, used as $name in later commands",
+			"e.g., 'let root=C2' then 'set 1 $root' or 'set 5 ${root+7}'",
+			"${...} does arithmetic on numbers and notes; 'let' alone lists variables",
+		},
+		Run: (*Handler).handleLet,
+	})
+	register(&Command{
+		Name:  "hooks",
+		Usage: "hooks [load <file>|reload|off]",
+		Help: []string{
+			"Run a Starlark script's on_loop, on_step and on_load callbacks",
+			"e.g., 'hooks load fills.star'; 'hooks' alone shows the loaded script",
+		},
+		Run:   (*Handler).handleHooks,
+		Args:  words("load", "reload", "off"),
+		NoAI:  true,
+		Files: always,
+	})
+	register(&Command{
+		Name:  "device",
+		Usage: "device [list|use <name>|off]",
+		Help: []string{
+			"Load a synth profile naming its parameters (e.g., 'device use minilogue')",
+			"Then 'cc cutoff 90' uses the synth's CC numbers and ranges",
+			"'device' alone lists the active profile's parameters",
+		},
+		Run:  (*Handler).handleDevice,
+		Args: words("list", "use", "off"),
+	})
+	register(&Command{
+		Name:  "stamp",
+		Usage: "stamp [define|list|delete]",
+		Help: []string{
+			"Name recurring step parameters (saved in stamps.json)",
+			"e.g., 'stamp define accent vel:110 gate:40 dur:2'",
+			"then 'set 5 C2 @accent'. Also: 'stamp list', 'stamp delete accent'",
+		},
+		Run: (*Handler).handleStamp,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{
+				readline.PcItem("define"),
+				readline.PcItem("list"),
+				readline.PcItem("delete", readline.PcItemDynamic(stampNames)),
+			}
+		},
+	})
+	register(&Command{
+		Name:  "scene",
+		Usage: "scene [save|launch|list|delete]",
+		Help: []string{
+			"Snapshot the pattern, step mutes, tempo, swing and CC values (saved in scenes.json)",
+			"'scene save 1', then 'scene launch 1' switches everything at the next bar, like launching a clip",
+		},
+		Run: (*Handler).handleScene,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			names := readline.PcItemDynamic(sceneNames)
+			return []readline.PrefixCompleterInterface{
+				readline.PcItem("save", names),
+				readline.PcItem("launch", names),
+				readline.PcItem("list"),
+				readline.PcItem("delete", names),
+			}
+		},
+	})
+	register(&Command{
+		Name:  "perform",
+		Usage: "perform",
+		Help: []string{
+			"Live keys without Enter: space mutes, f plays a fill, 1-8 launch scenes,",
+			"arrows transpose (up/down a semitone, right/left an octave), q returns to the prompt",
+		},
+		Run: (*Handler).handlePerform,
+	})
+	register(&Command{
+		Name:  "record-session",
+		Usage: "record-session <name>|stop",
+		Help: []string{
+			"Record every command from now on with its timing, starting from the current pattern",
+			"'record-session stop' saves it in sessions/<name>.json; 'export session <name> <file>' writes it as a script, or as a MIDI performance to a .mid file",
+		},
+		Run:   (*Handler).handleRecordSession,
+		Args:  words("stop"),
+		Files: always,
+	})
+	register(&Command{
+		Name:  "replay-session",
+		Usage: "replay-session <name>|stop",
+		Help:  []string{"Restore a recorded session's starting pattern and run its commands again with the same timing"},
+		Run:   (*Handler).handleReplaySession,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{readline.PcItem("stop"), readline.PcItemDynamic(sessionNames)}
+		},
+		Files: always,
+	})
+	register(&Command{
+		Name:  "macro",
+		Usage: "macro <define|run|list|delete>",
+		Help: []string{
+			"Define and run command sequences (saved in macros.json)",
+			"e.g., 'macro define init clear; tempo 120; swing 40'",
+			"then 'macro run init'. Also: 'macro list', 'macro delete init'",
+		},
+		Run:     (*Handler).handleMacro,
+		NoChain: true,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			names := readline.PcItemDynamic(macroNames)
+			return []readline.PrefixCompleterInterface{
+				readline.PcItem("define"),
+				readline.PcItem("run", names),
+				readline.PcItem("list"),
+				readline.PcItem("delete", names),
+			}
+		},
+	})
+	register(&Command{
+		Name:  "plugins",
+		Usage: "plugins [reload]",
+		Help: []string{
+			"List plugin commands (executables in plugins/)",
+			"'plugins reload' picks up added or changed plugins",
+		},
+		Run:   (*Handler).handlePlugins,
+		Args:  words("reload"),
+		NoAI:  true,
+		Files: always,
+	})
+	register(&Command{
+		Name:  "ai",
+		Usage: "ai [prompt]",
+		Help: []string{
+			"Execute AI prompt inline or enter interactive session",
+			"Usage: 'ai' to enter session, 'ai <prompt>' for inline execution",
+			"'ai usage' sums up tokens and estimated cost per model; 'ai usage on' shows them after each request",
+			"All commands work directly in AI mode.",
+			"Natural language is sent to AI for pattern changes.",
+			"Type 'exit' to return to command mode.",
+		},
+		Run:     (*Handler).handleAI,
+		NoChain: true,
+	})
+	register(&Command{
+		Name:  "ai-critique",
+		Usage: "ai-critique",
+		Help: []string{
+			"Ask the AI to review the pattern: groove, harmony, dynamics and suggestions",
+			"Read-only; in an AI session you can then ask it to apply a suggestion",
+		},
+		Run: (*Handler).handleAICritique,
+	})
+	register(&Command{
+		Name:  "ai-vary",
+		Usage: "ai-vary [amount] [count]",
+		Help: []string{
+			"Ask the AI for variations of the pattern (default: 3, changing about 25% of the steps)",
+			"'ai-vary try <n>' plays variation n from the next loop ('try original' goes back),",
+			"'ai-vary list' shows what each changes, 'ai-vary keep' keeps the one playing",
+		},
+		Run:  (*Handler).handleAIVary,
+		Args: words("try", "keep", "list"),
+	})
+	register(&Command{
+		Name:  "compare",
+		Usage: "compare <prompt> [--models <model,...>] [--runs <n>] [--blind]",
+		Help: []string{
+			"Ask several AI models the same request at once and save their answers",
+			"e.g., 'compare darker bassline --models haiku,sonnet --runs 3'; short names match listed models",
+			"Without --models: the selected model and the default model of each vendor with a key",
+			"--blind shuffles the answers and hides the models until 'compare-reveal'",
+		},
+		Run:     (*Handler).handleCompare,
+		NoChain: true,
+	})
+	register(&Command{
+		Name:  "compare-batch",
+		Usage: "compare-batch <file> [--models <model,...>] [--runs <n>] [--blind]",
+		Help: []string{
+			"Compare the models on every prompt in a text file (one per line, # for comments)",
+			"Each prompt is saved as its own comparison as soon as it is done; run the batch",
+			"again after stopping it (Ctrl+C) and it picks up with the prompts not yet compared",
+		},
+		Run:     (*Handler).handleCompareBatch,
+		NoChain: true,
+		Files:   always,
+	})
+	register(&Command{
+		Name:  "compare-list",
+		Usage: "compare-list",
+		Help:  []string{"List saved comparisons with their sizes on disk"},
+		Run:   (*Handler).handleCompareList,
+	})
+	register(&Command{
+		Name:  "compare-prune",
+		Usage: "compare-prune --older-than <age>",
+		Help: []string{
+			"Delete comparisons made longer ago than age, e.g. 30d, 2w or 12h, with their ratings",
+			"Asks first; Elo rankings from votes are kept",
+		},
+		Run:  (*Handler).handleComparePrune,
+		Args: words("--older-than"),
+	})
+	register(&Command{
+		Name:  "compare-archive",
+		Usage: "compare-archive <id>...",
+		Help: []string{
+			"Compress comparisons into comparisons/archive/ (gzipped JSON), out of",
+			"compare-list and compare-stats; gunzip one back into comparisons/ to restore it",
+		},
+		Run: (*Handler).handleCompareArchive,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{readline.PcItemDynamic(comparisonIDs)}
+		},
+	})
+	register(&Command{
+		Name:  "compare-show",
+		Usage: "compare-show <id>",
+		Help:  []string{"Show each model's answer in a saved comparison"},
+		Run:   (*Handler).handleCompareShow,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{readline.PcItemDynamic(comparisonIDs)}
+		},
+	})
+	register(&Command{
+		Name:  "compare-play",
+		Usage: "compare-play <id> <label|model> [loops]",
+		Help: []string{
+			"Play a comparison result's pattern from the next loop for a few loops (default 2),",
+			"then go back to your pattern; pick the result by label (B) or model (haiku, haiku#2)",
+			"'compare-play stop' goes back right away",
+		},
+		Run: (*Handler).handleComparePlay,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{readline.PcItemDynamic(comparisonIDs), readline.PcItem("stop")}
+		},
+	})
+	register(&Command{
+		Name:  "audition",
+		Usage: "audition <id> [loops]",
+		Help: []string{
+			"Play every answer of a comparison in turn from the next loop, 4 loops each by default,",
+			"announcing each, then go back to your pattern; 'audition stop' goes back right away",
+		},
+		Run: (*Handler).handleAudition,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{readline.PcItemDynamic(comparisonIDs), readline.PcItem("stop")}
+		},
+	})
+	register(&Command{
+		Name:  "blind-resume",
+		Usage: "blind-resume <id> [loops]",
+		Help: []string{
+			"Pick up rating a blind comparison, e.g. after a restart: shows how many answers",
+			"are rated and auditions the others, without giving the models away",
+		},
+		Run: (*Handler).handleBlindResume,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{readline.PcItemDynamic(comparisonIDs)}
+		},
+	})
+	register(&Command{
+		Name:  "compare-reveal",
+		Usage: "compare-reveal <id>",
+		Help:  []string{"Show which model gave each answer of a blind comparison"},
+		Run:   (*Handler).handleCompareReveal,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{readline.PcItemDynamic(comparisonIDs)}
+		},
+	})
+	register(&Command{
+		Name:  "compare-rate",
+		Usage: "compare-rate <id> <label|model> <1-5> [criterion]",
+		Help: []string{
+			"Rate an answer of a comparison 1-5, overall or for a criterion",
+			"e.g., 'compare-rate 20250301-142233 B 4', 'compare-rate 20250301-142233 B 5 groove'",
+		},
+		Run: (*Handler).handleCompareRate,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{readline.PcItemDynamic(comparisonIDs)}
+		},
+	})
+	register(&Command{
+		Name:  "compare-stats",
+		Usage: "compare-stats [--export <file.csv|file.md>]",
+		Help: []string{
+			"Sum up all saved comparisons per model: answers that ran, wins (best-rated alone),",
+			"latency and mean ratings per criterion; --export writes the table as CSV or Markdown",
+		},
+		Run:   (*Handler).handleCompareStats,
+		Args:  words("--export"),
+		Files: func(parts []string) bool { return len(parts) > 1 },
+	})
+	register(&Command{
+		Name:  "compare-vote",
+		Usage: "compare-vote <id> <better> <worse> | compare-vote <id> <label> <label> tie",
+		Help: []string{
+			"Vote which of two answers of a blind comparison is better (A vs B), or a tie",
+			"Each vote updates the models' Elo ratings, saved in comparisons/rankings.json",
+			"e.g., 'compare-vote 20250301-142233 B A' (B was better than A)",
+		},
+		Run: (*Handler).handleCompareVote,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{readline.PcItemDynamic(comparisonIDs)}
+		},
+	})
+	register(&Command{
+		Name:  "compare-rankings",
+		Usage: "compare-rankings",
+		Help:  []string{"Show the models' Elo ratings from head-to-head votes, best first"},
+		Run:   (*Handler).handleCompareRankings,
+	})
+	register(&Command{
+		Name:  "ai-allow",
+		Usage: "ai-allow [<command>...|none]",
+		Help: []string{
+			"Show or set the destructive commands the AI may run (clear, delete, import, length, load, reload, reset)",
+			"They are blocked by default: the AI is told to ask you instead",
+			"e.g., 'ai-allow clear length'; 'ai-allow none' blocks them all again",
+		},
+		Run: (*Handler).handleAIAllow,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return words(append(destructiveCommands(), "none")...)(h)
+		},
+		NoAI: true,
+	})
+	register(&Command{
+		Name:  "undo",
+		Usage: "undo",
+		Help:  []string{"Revert the last applied AI edit"},
+		Run:   (*Handler).handleUndo,
+	})
+	register(&Command{
+		Name:  "model",
+		Usage: "model [name]",
+		Help: []string{
+			"Show or switch the AI model: claude-..., gpt-..., gemini-...",
+			"or ollama:<name> for a local Ollama model",
+		},
+		Run: (*Handler).handleModel,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return []readline.PrefixCompleterInterface{readline.PcItemDynamic(func(string) []string { return ai.Models() })}
+		},
+	})
+	register(&Command{
+		Name:  "model-config",
+		Usage: "model-config [temperature <t>] [max-tokens <n>] [thinking <tokens|off>]",
+		Help: []string{
+			"Show or set the current model's generation parameters, kept across sessions",
+			"e.g., 'model-config temperature 0.2' for precise edits, 'thinking 4000' lets Claude think first",
+			"'default' falls back to the config file (ai_temperature, ai_max_tokens, ai_thinking); 'reset' clears all",
+		},
+		Run:  (*Handler).handleModelConfig,
+		Args: words("temperature", "max-tokens", "thinking", "reset"),
+		NoAI: true,
+	})
+	register(&Command{
+		Name:  "models",
+		Usage: "models",
+		Help: []string{
+			"List the AI models the providers serve (asks each API with a key set, and the local server)",
+			"Add model IDs with ai_models in the config file",
+		},
+		Run: (*Handler).handleModels,
+	})
+	register(&Command{
+		Name:  "genre",
+		Usage: "genre [name|off]",
+		Help: []string{
+			"Steer the AI towards a genre's tempo, rhythm and harmony (e.g., 'genre techno')",
+			"Without a name, lists the presets; add your own in prompts/genres/<name>.txt",
+		},
+		Run:  (*Handler).handleGenre,
+		Args: genreArg,
+	})
+	register(&Command{
+		Name:  "ai-song",
+		Usage: "ai-song <description>",
+		Help: []string{
+			"Ask the AI for a whole song: several patterns and the order to play them in",
+			"Saves the patterns in a collection named after the song (e.g., 'ai-song techno with a breakdown')",
+		},
+		Run:     (*Handler).handleAISong,
+		NoChain: true,
+	})
+	register(&Command{
+		Name:  "song",
+		Usage: "song [show|new|play|stop]",
+		Help: []string{
+			"Chain saved patterns: 'song new <name> intro*2 verse*4' plays intro twice, then verse 4 times",
+			"'song play <name>' switches patterns at loop boundaries, 'song show <name>', 'song stop'; lists songs without arguments",
+		},
+		Run: (*Handler).handleSong,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			names := readline.PcItemDynamic(savedSongNames)
+			return []readline.PrefixCompleterInterface{
+				readline.PcItem("list"),
+				readline.PcItem("show", names),
+				readline.PcItem("new"),
+				readline.PcItem("play", names),
+				readline.PcItem("stop"),
+			}
+		},
+	})
+	register(&Command{
+		Name:  "morph",
+		Usage: "morph <pattern> <loops>",
+		Help: []string{
+			"Move to a saved pattern over a number of loops (e.g., 'morph chorus 8'): steps switch a few at a time",
+			"while velocities, CCs, tempo and swing slide across; 'morph stop' keeps the current stage looping",
+		},
+		Run:  (*Handler).handleMorph,
+		Args: patternArg,
+	})
+	register(&Command{
+		Name:  "tempo-mode",
+		Usage: "tempo-mode [pattern|global]",
+		Help: []string{
+			"Whether a playing song follows each pattern's tempo (default) or keeps the current one",
+			"In global mode, 'tempo' changes the tempo for the rest of the song",
+		},
+		Run:  (*Handler).handleTempoMode,
+		Args: words("pattern", "global"),
+	})
+	register(&Command{
+		Name:  "style",
+		Usage: "style [name|off]",
+		Help: []string{
+			"Use a style preset: tempo range, swing, note density and range for the AI (e.g., 'style neo-soul')",
+			"Without a name, shows the active one and lists the presets; add your own in styles/<name>.json",
+		},
+		Run:  (*Handler).handleStyle,
+		Args: styleArg,
+	})
+	register(&Command{
+		Name:  "chat",
+		Usage: "chat [save <name>|load <name>]",
+		Help: []string{
+			"Save or restore an AI conversation (in chats/); lists saved ones without arguments",
+			"The latest conversation is saved as 'last' after every request",
+		},
+		Run: (*Handler).handleChat,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			names := readline.PcItemDynamic(savedChatNames)
+			return []readline.PrefixCompleterInterface{
+				readline.PcItem("save", names),
+				readline.PcItem("load", names),
+			}
+		},
+		Files: func(parts []string) bool { return len(parts) > 1 },
+	})
+	register(&Command{
+		Name:  "clear-chat",
+		Usage: "clear-chat",
+		Help:  []string{"Clear AI conversation history"},
+		Run:   (*Handler).handleClearChat,
+	})
+	register(&Command{
+		Name:    "help",
+		Aliases: []string{"?"},
+		Usage:   "help [command]",
+		Help:    []string{"Show this help message, or details for one command"},
+		Run:     (*Handler).handleHelp,
+		Args: func(h *Handler) []readline.PrefixCompleterInterface {
+			return words(Commands()...)(h)
+		},
+	})
+	register(&Command{
+		Name:    "quit",
+		Aliases: []string{"exit"},
+		Usage:   "quit",
+		Help:    []string{"Exit the program"},
+		Run: func(h *Handler, parts []string) error {
+			// The prompt loops handle quit themselves; reaching here means
+			// we're inside a session that can't be quit from
+			return fmt.Errorf("'%s' is only available at the main prompt", parts[0])
+		},
+	})
+}
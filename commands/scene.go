@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// ScenesFile is where scenes are persisted (next to patterns/)
+var ScenesFile = "scenes.json"
+
+// Launcher starts the next pattern at the next bar. *playback.Engine
+// implements it.
+type Launcher interface {
+	CueBar()
+}
+
+// SetLauncher connects the handler to the engine used by 'scene launch'
+func (h *Handler) SetLauncher(launcher Launcher) {
+	h.launcher = launcher
+}
+
+// scene is everything a performance switches at once: the pattern with its
+// step mutes and tempo, plus the swing, humanization and every global CC
+// value playing when it was saved
+type scene struct {
+	Pattern      *sequence.PatternFile `json:"pattern"`
+	Swing        int                   `json:"swing,omitempty"`
+	SwingUnit    int                   `json:"swing_unit,omitempty"` // 2 swings 8ths
+	Humanization sequence.Humanization `json:"humanization"`
+	CC           map[string]int        `json:"cc,omitempty"`
+}
+
+// loadScenes reads scenes from disk. A missing file means no scenes yet.
+func loadScenes() (map[string]scene, error) {
+	data, err := os.ReadFile(ScenesFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]scene{}, nil
+		}
+		return nil, fmt.Errorf("failed to read scenes file: %w", err)
+	}
+
+	scenes := map[string]scene{}
+	if err := json.Unmarshal(data, &scenes); err != nil {
+		return nil, fmt.Errorf("failed to parse scenes file: %w", err)
+	}
+	return scenes, nil
+}
+
+// saveScenes writes all scenes to disk
+func saveScenes(scenes map[string]scene) error {
+	data, err := json.MarshalIndent(scenes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal scenes: %w", err)
+	}
+	if err := os.WriteFile(ScenesFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write scenes file: %w", err)
+	}
+	return nil
+}
+
+// handleScene: scene [list] | scene save <name> | scene launch <name> | scene delete <name>
+// Saves the whole performance state and switches back to it at the next bar
+func (h *Handler) handleScene(parts []string) error {
+	if len(parts) == 1 || (len(parts) == 2 && parts[1] == "list") {
+		return listScenes(h.out)
+	}
+	if len(parts) != 3 {
+		return fmt.Errorf("usage: scene [list|save <name>|launch <name>|delete <name>] (e.g., 'scene save 1')")
+	}
+	name := parts[2]
+
+	switch strings.ToLower(parts[1]) {
+	case "save":
+		return h.saveScene(name)
+	case "launch":
+		return h.launchScene(name)
+	case "delete", "rm":
+		scenes, err := loadScenes()
+		if err != nil {
+			return err
+		}
+		if _, ok := scenes[name]; !ok {
+			return fmt.Errorf("scene '%s' not found", name)
+		}
+		delete(scenes, name)
+		if err := saveScenes(scenes); err != nil {
+			return err
+		}
+		fmt.Fprintf(h.out, "Deleted scene '%s'\n", name)
+		return nil
+	}
+	return fmt.Errorf("usage: scene [list|save <name>|launch <name>|delete <name>] (e.g., 'scene save 1')")
+}
+
+// saveScene stores the current pattern and playing state under name
+func (h *Handler) saveScene(name string) error {
+	scenes, err := loadScenes()
+	if err != nil {
+		return err
+	}
+	_, replaced := scenes[name]
+	scenes[name] = h.captureScene()
+	if err := saveScenes(scenes); err != nil {
+		return err
+	}
+	if replaced {
+		fmt.Fprintf(h.out, "Replaced scene '%s'\n", name)
+	} else {
+		fmt.Fprintf(h.out, "Saved scene '%s'\n", name)
+	}
+	return nil
+}
+
+// captureScene snapshots the current pattern and playing state
+func (h *Handler) captureScene() scene {
+	s := scene{
+		Pattern:      h.pattern.ToPatternFile(h.patternName),
+		Swing:        h.pattern.GetSwing(),
+		SwingUnit:    h.pattern.GetSwingUnit(),
+		Humanization: h.pattern.GetHumanization(),
+	}
+	if cc := h.pattern.GetAllGlobalCC(); len(cc) > 0 {
+		s.CC = make(map[string]int, len(cc))
+		for ccNum, value := range cc {
+			s.CC[strconv.Itoa(ccNum)] = value
+		}
+	}
+	return s
+}
+
+// launchScene queues a scene, starting at the next bar when playback is
+// running. A running song, morph or audition stops.
+func (h *Handler) launchScene(name string) error {
+	scenes, err := loadScenes()
+	if err != nil {
+		return err
+	}
+	s, ok := scenes[name]
+	if !ok || s.Pattern == nil {
+		return fmt.Errorf("scene '%s' not found", name)
+	}
+	p, err := s.pattern()
+	if err != nil {
+		return fmt.Errorf("scene '%s': %w", name, err)
+	}
+
+	h.stopSong()
+	h.stopMorph()
+	h.stopAudition()
+	h.pattern.CopyFrom(p)
+	if h.launcher != nil {
+		h.launcher.CueBar()
+		fmt.Fprintf(h.out, "Launching scene '%s' at the next bar (%s BPM)\n", name, sequence.FormatBPM(p.GetBPM()))
+	} else {
+		fmt.Fprintf(h.out, "Launched scene '%s' (%s BPM)\n", name, sequence.FormatBPM(p.GetBPM()))
+	}
+	return nil
+}
+
+// pattern rebuilds the scene's pattern with its playing state
+func (s scene) pattern() (*sequence.Pattern, error) {
+	p, err := sequence.FromPatternFile(s.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.SetSwing(s.Swing); err != nil {
+		return nil, err
+	}
+	if s.SwingUnit != 0 {
+		if err := p.SetSwingUnit(s.SwingUnit); err != nil {
+			return nil, err
+		}
+	}
+	p.Humanization = s.Humanization
+	for ccNum, value := range s.CC {
+		n, err := strconv.Atoi(ccNum)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CC number %q", ccNum)
+		}
+		if err := p.SetGlobalCC(n, value); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// sceneNames lists the saved scenes for tab completion
+func sceneNames(string) []string {
+	scenes, err := loadScenes()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(scenes))
+	for name := range scenes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// listScenes prints the saved scenes
+func listScenes(w io.Writer) error {
+	scenes, err := loadScenes()
+	if err != nil {
+		return err
+	}
+	if len(scenes) == 0 {
+		fmt.Fprintln(w, "No scenes saved (save one with 'scene save <name>')")
+		return nil
+	}
+	fmt.Fprintf(w, "Scenes (%d):\n", len(scenes))
+	for _, name := range sceneNames("") {
+		s := scenes[name]
+		if s.Pattern == nil {
+			continue
+		}
+		from := ""
+		if s.Pattern.Name != "" {
+			from = fmt.Sprintf(", from '%s'", s.Pattern.Name)
+		}
+		fmt.Fprintf(w, "  %s: %d steps, %s BPM%s\n", name, s.Pattern.Length, sequence.FormatBPM(s.Pattern.Tempo), from)
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+// SessionsDir is where recorded sessions are saved; main points it into the
+// configured data directory
+var SessionsDir = "sessions"
+
+// session is a recorded performance: the state it started from, every
+// command issued and every change to what played, with when
+type session struct {
+	Name      string           `json:"name"`
+	CreatedAt string           `json:"created_at"`
+	LengthMs  int64            `json:"length_ms,omitempty"`
+	Start     scene            `json:"start"`
+	Commands  []sessionCommand `json:"commands"`
+	Changes   []sessionChange  `json:"changes,omitempty"`
+}
+
+// sessionCommand is a command and its time from the start of the session
+type sessionCommand struct {
+	AtMs    int64  `json:"at_ms"`
+	Command string `json:"command"`
+}
+
+// sessionChange is what played from a moment of the session on. Changes
+// come from commands and from whatever else changed the pattern or muted
+// playback (songs, morphs, perform mode), and are what 'export session'
+// renders to MIDI.
+type sessionChange struct {
+	AtMs  int64 `json:"at_ms"`
+	State scene `json:"state"`
+	Muted bool  `json:"muted,omitempty"`
+}
+
+// recorder collects the commands of a session being recorded
+type recorder struct {
+	session *session
+	start   time.Time
+	last    string        // fingerprint of the last recorded change
+	stop    chan struct{} // stops watching the playback clock
+}
+
+// sessionPath returns the file a session is saved in
+func sessionPath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid session name: %q", name)
+	}
+	return filepath.Join(SessionsDir, name+".json"), nil
+}
+
+// loadSession reads a recorded session
+func loadSession(name string) (*session, error) {
+	path, err := sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session '%s' not found", name)
+		}
+		return nil, fmt.Errorf("failed to read session file: %w", err)
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse session file: %w", err)
+	}
+	if s.Start.Pattern == nil {
+		return nil, fmt.Errorf("session '%s' has no starting pattern", name)
+	}
+	return &s, nil
+}
+
+// save writes the session to SessionsDir
+func (s *session) save() error {
+	path, err := sessionPath(s.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(SessionsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	return nil
+}
+
+// sessionNames lists the recorded sessions for tab completion
+func sessionNames(string) []string {
+	entries, err := os.ReadDir(SessionsDir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// length returns how long the session was recorded, or the time of its
+// last command for sessions saved without it
+func (s *session) length() time.Duration {
+	if s.LengthMs > 0 {
+		return time.Duration(s.LengthMs) * time.Millisecond
+	}
+	if len(s.Commands) == 0 {
+		return 0
+	}
+	return time.Duration(s.Commands[len(s.Commands)-1].AtMs) * time.Millisecond
+}
+
+// handleRecordSession: record-session <name> | record-session stop
+// Records every command from now on with its time, starting from the
+// current pattern, until 'record-session stop' saves it
+func (h *Handler) handleRecordSession(parts []string) error {
+	if len(parts) != 2 {
+		return fmt.Errorf("usage: record-session <name> or record-session stop (e.g., 'record-session jam1')")
+	}
+	if parts[1] == "stop" {
+		if h.recording == nil {
+			return fmt.Errorf("no session being recorded")
+		}
+		s := h.recording.session
+		s.LengthMs = time.Since(h.recording.start).Milliseconds()
+		close(h.recording.stop)
+		h.recording = nil
+		if err := s.save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(h.out, "Saved session '%s': %d commands over %s ('replay-session %s' to play it back)\n",
+			s.Name, len(s.Commands), s.length().Round(time.Second), s.Name)
+		return nil
+	}
+
+	if h.recording != nil {
+		return fmt.Errorf("already recording session '%s' ('record-session stop' first)", h.recording.session.Name)
+	}
+	if _, err := sessionPath(parts[1]); err != nil {
+		return err
+	}
+	h.recording = &recorder{
+		session: &session{Name: parts[1], CreatedAt: time.Now().Format(time.RFC3339), Start: h.captureScene()},
+		start:   time.Now(),
+		last:    h.playingState(),
+		stop:    make(chan struct{}),
+	}
+	if h.clock != nil {
+		go h.watchSession(h.recording)
+	}
+	fmt.Fprintf(h.out, "Recording session '%s' ('record-session stop' to save it)\n", parts[1])
+	return nil
+}
+
+// recordSessionCommand adds a command that ran to the session being
+// recorded. Recording and replay controls are left out.
+func (h *Handler) recordSessionCommand(command *Command, line string) {
+	if h.recording == nil || command.Name == "record-session" || command.Name == "replay-session" {
+		return
+	}
+	h.recording.session.Commands = append(h.recording.session.Commands, sessionCommand{
+		AtMs:    time.Since(h.recording.start).Milliseconds(),
+		Command: line,
+	})
+	h.recordSessionChange()
+}
+
+// recordSessionChange adds what plays now to the session being recorded
+// when it differs from the last change
+func (h *Handler) recordSessionChange() {
+	if h.recording == nil {
+		return
+	}
+	state := h.playingState()
+	if state == h.recording.last {
+		return
+	}
+	h.recording.last = state
+	h.recording.session.Changes = append(h.recording.session.Changes, sessionChange{
+		AtMs:  time.Since(h.recording.start).Milliseconds(),
+		State: h.captureScene(),
+		Muted: h.muter != nil && h.muter.IsMuted(),
+	})
+}
+
+// playingState fingerprints the live state and whether playback is muted
+func (h *Handler) playingState() string {
+	return fmt.Sprintf("%s|%t", h.liveState(), h.muter != nil && h.muter.IsMuted())
+}
+
+// watchSession records changes made outside commands at every loop until
+// the recording stops
+func (h *Handler) watchSession(rec *recorder) {
+	events := h.clock.Subscribe(waitEventBuffer)
+	defer h.clock.Unsubscribe(events)
+
+	for {
+		select {
+		case <-rec.stop:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if ev.Type != playback.EventLoop {
+				continue
+			}
+		}
+		h.Update(func() error {
+			if h.recording == rec {
+				h.recordSessionChange()
+			}
+			return nil
+		})
+	}
+}
+
+// handleReplaySession: replay-session <name> | replay-session stop
+// Restores the session's starting pattern and runs its commands again with
+// the same timing
+func (h *Handler) handleReplaySession(parts []string) error {
+	if len(parts) != 2 {
+		return fmt.Errorf("usage: replay-session <name> or replay-session stop (e.g., 'replay-session jam1')")
+	}
+	if parts[1] == "stop" {
+		if h.replayStop == nil {
+			return fmt.Errorf("no session replaying")
+		}
+		h.stopReplay()
+		fmt.Fprintln(h.out, "Replay stopped")
+		return nil
+	}
+
+	s, err := loadSession(parts[1])
+	if err != nil {
+		return err
+	}
+	p, err := s.Start.pattern()
+	if err != nil {
+		return fmt.Errorf("session '%s': %w", s.Name, err)
+	}
+
+	h.stopReplay()
+	h.stopSong()
+	h.stopMorph()
+	h.stopAudition()
+	h.pattern.CopyFrom(p)
+	h.replayStop = make(chan struct{})
+	go h.runReplay(s, h.replayStop)
+	fmt.Fprintf(h.out, "Replaying session '%s': %d commands over %s\n", s.Name, len(s.Commands), s.length().Round(time.Second))
+	return nil
+}
+
+// runReplay runs the session's commands at their times until the last one
+// or until stop is closed
+func (h *Handler) runReplay(s *session, stop chan struct{}) {
+	defer h.Update(func() error {
+		if h.replayStop == stop {
+			h.replayStop = nil
+		}
+		return nil
+	})
+
+	start := time.Now()
+	for _, c := range s.Commands {
+		timer := time.NewTimer(time.Until(start.Add(time.Duration(c.AtMs) * time.Millisecond)))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		fmt.Fprintln(h.out, theme.Dim("> "+c.Command))
+		if err := h.Execute(c.Command); err != nil {
+			fmt.Fprintln(h.out, theme.Error(fmt.Sprintf("Error: %v", err)))
+		}
+	}
+	fmt.Fprintln(h.out, theme.Dim(fmt.Sprintf("Session '%s' replayed", s.Name)))
+}
+
+func (h *Handler) stopReplay() {
+	if h.replayStop == nil {
+		return
+	}
+	close(h.replayStop)
+	h.replayStop = nil
+}
+
+// writeScript writes the session as a script: the starting pattern, then
+// each command after a 'sleep' for the time since the one before
+func (s *session) writeScript(w io.Writer) error {
+	p, err := s.Start.pattern()
+	if err != nil {
+		return err
+	}
+	if err := p.WriteScript(w, s.Start.Pattern.Name); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "# session %s, recorded %s\n", s.Name, s.CreatedAt)
+	var last int64
+	for _, c := range s.Commands {
+		if wait := c.AtMs - last; wait > 0 {
+			fmt.Fprintf(w, "sleep %s\n", strconv.FormatFloat(float64(wait)/1000, 'f', -1, 64))
+		}
+		last = c.AtMs
+		if _, err := fmt.Fprintln(w, c.Command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// performance lays the session out loop by loop as it played: each loop
+// plays what the latest change before it set, until the session's end and
+// at least one loop of its last change. Changes take effect at the next
+// loop, as queued patterns do; muted loops keep their time with every step
+// muted.
+func (s *session) performance() ([]*sequence.Pattern, error) {
+	current, err := s.Start.pattern()
+	if err != nil {
+		return nil, err
+	}
+	muted := false
+	end := float64(s.length().Milliseconds())
+
+	var loops []*sequence.Pattern
+	at := 0.0
+	next := 0
+	changed := true
+	for {
+		for ; next < len(s.Changes) && float64(s.Changes[next].AtMs) <= at; next++ {
+			c := s.Changes[next]
+			if current, err = c.State.pattern(); err != nil {
+				return nil, fmt.Errorf("change at %dms: %w", c.AtMs, err)
+			}
+			muted = c.Muted
+			changed = true
+		}
+		if at >= end && next == len(s.Changes) && !changed {
+			return loops, nil
+		}
+
+		loop := current
+		if muted {
+			loop = current.Clone()
+			steps := loop.Snapshot()
+			for i := range steps {
+				steps[i].Muted = true
+			}
+			if err := loop.SetSteps(steps); err != nil {
+				return nil, err
+			}
+		}
+		loops = append(loops, loop)
+		changed = false
+		// A quarter note is 60000ms / BPM; a step a 1/resolution note
+		at += float64(current.Length()) * 240_000 / float64(current.GetResolution()) / current.GetBPM()
+	}
+}
@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// slotCount is how many patterns 'slot' keeps in memory
+const slotCount = 8
+
+// patternSlot is a pattern kept in memory by 'slot', with where it was last
+// saved or loaded so switching back keeps track of unsaved changes
+type patternSlot struct {
+	pattern      *sequence.Pattern
+	name         string
+	savedState   string
+	savedModTime time.Time
+}
+
+// handleSlot: slot [<n>|next|prev] | slot copy <from> <to>
+// Keeps up to 8 patterns in memory to edit and switch between without
+// saving; the one playing is the current slot. Slots are lost on exit.
+func (h *Handler) handleSlot(parts []string) error {
+	usage := fmt.Errorf("usage: slot [1-%d|next|prev] or slot copy <from> <to> (e.g., 'slot 2', 'slot copy 1 2')", slotCount)
+	switch {
+	case len(parts) == 1:
+		h.listSlots()
+		return nil
+	case len(parts) == 2 && (parts[1] == "next" || parts[1] == "prev"):
+		step := 1
+		if parts[1] == "prev" {
+			step = slotCount - 1
+		}
+		for n := (h.slot + step) % slotCount; n != h.slot; n = (n + step) % slotCount {
+			if h.slots[n] != nil {
+				return h.switchSlot(n)
+			}
+		}
+		return fmt.Errorf("no other slot in use ('slot 2' starts one)")
+	case len(parts) == 2:
+		n, err := parseSlot(parts[1])
+		if err != nil {
+			return err
+		}
+		return h.switchSlot(n)
+	case len(parts) == 4 && parts[1] == "copy":
+		from, err := parseSlot(parts[2])
+		if err != nil {
+			return err
+		}
+		to, err := parseSlot(parts[3])
+		if err != nil {
+			return err
+		}
+		return h.copySlot(from, to)
+	}
+	return usage
+}
+
+// parseSlot reads a slot number 1-8 as an index
+func parseSlot(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > slotCount {
+		return 0, fmt.Errorf("slot must be 1-%d", slotCount)
+	}
+	return n - 1, nil
+}
+
+// storeSlot keeps the current pattern in the current slot
+func (h *Handler) storeSlot() {
+	h.slots[h.slot] = &patternSlot{
+		pattern:      h.pattern.Clone(),
+		name:         h.patternName,
+		savedState:   h.savedState,
+		savedModTime: h.savedModTime,
+	}
+}
+
+// switchSlot makes slot n the current pattern, at the next bar when
+// playback is running. An empty slot starts as an empty pattern of the
+// same length and tempo. A running song, morph or audition stops.
+func (h *Handler) switchSlot(n int) error {
+	if n == h.slot {
+		fmt.Fprintf(h.out, "Already on slot %d\n", n+1)
+		return nil
+	}
+	h.storeSlot()
+
+	h.stopSong()
+	h.stopMorph()
+	h.stopAudition()
+	target := h.slots[n]
+	if target == nil {
+		blank := sequence.New(h.pattern.Length())
+		blank.SetTempo(h.pattern.GetBPM())
+		h.pattern.CopyFrom(blank)
+		h.patternName, h.savedState, h.savedModTime = "", h.patternState(), time.Time{}
+	} else {
+		h.pattern.CopyFrom(target.pattern)
+		h.patternName, h.savedState, h.savedModTime = target.name, target.savedState, target.savedModTime
+	}
+	h.slot = n
+	if h.launcher != nil {
+		h.launcher.CueBar()
+	}
+
+	switch {
+	case target == nil:
+		fmt.Fprintf(h.out, "Slot %d: new empty pattern (%d steps)\n", n+1, h.pattern.Length())
+	case target.name != "":
+		fmt.Fprintf(h.out, "Slot %d: '%s'\n", n+1, target.name)
+	default:
+		fmt.Fprintf(h.out, "Slot %d\n", n+1)
+	}
+	return nil
+}
+
+// copySlot copies slot from over slot to; copying over the current slot
+// replaces the pattern playing
+func (h *Handler) copySlot(from, to int) error {
+	if from == to {
+		return fmt.Errorf("can't copy slot %d onto itself", from+1)
+	}
+	h.storeSlot()
+	source := h.slots[from]
+	if source == nil {
+		return fmt.Errorf("slot %d is empty", from+1)
+	}
+	h.slots[to] = &patternSlot{
+		pattern:      source.pattern.Clone(),
+		name:         source.name,
+		savedState:   source.savedState,
+		savedModTime: source.savedModTime,
+	}
+	if to == h.slot {
+		h.pattern.CopyFrom(source.pattern)
+		h.patternName, h.savedState, h.savedModTime = source.name, source.savedState, source.savedModTime
+	}
+	fmt.Fprintf(h.out, "Copied slot %d to slot %d\n", from+1, to+1)
+	return nil
+}
+
+// listSlots prints the slots in use and which one is current
+func (h *Handler) listSlots() {
+	h.storeSlot()
+	fmt.Fprintln(h.out, "Slots (* playing):")
+	for n, s := range h.slots {
+		marker := " "
+		if n == h.slot {
+			marker = "*"
+		}
+		if s == nil {
+			fmt.Fprintf(h.out, "%s %d: empty\n", marker, n+1)
+			continue
+		}
+		name := ""
+		if s.name != "" {
+			name = fmt.Sprintf(" '%s',", s.name)
+		}
+		fmt.Fprintf(h.out, "%s %d:%s %d steps, %d notes, %s BPM\n", marker, n+1, name, s.pattern.Length(), s.pattern.Analyze().Notes, sequence.FormatBPM(s.pattern.GetBPM()))
+	}
+}
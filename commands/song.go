@@ -0,0 +1,397 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/iltempo/interplay/ai"
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+// songPartName is what 'ai-song' accepts for song and pattern names, so
+// they save under the same name
+var songPartName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// handleSong: song [list] | song show <name> | song new <name> <pattern[*loops]>... | song play <name> | song stop
+func (h *Handler) handleSong(parts []string) error {
+	if len(parts) == 1 || parts[1] == "list" {
+		return listSongs(h.out)
+	}
+	switch parts[1] {
+	case "show":
+		if len(parts) != 3 {
+			return fmt.Errorf("usage: song show <name>")
+		}
+		song, err := sequence.LoadSong(parts[2])
+		if err != nil {
+			return err
+		}
+		printSong(h.out, song)
+		return nil
+	case "new":
+		if len(parts) < 4 {
+			return fmt.Errorf("usage: song new <name> <pattern[*loops]>... (e.g., 'song new demo intro*2 verse*4')")
+		}
+		songParts, err := sequence.ParseSongParts(parts[3:])
+		if err != nil {
+			return err
+		}
+		for _, part := range songParts {
+			if _, err := os.Stat(sequence.Path(part.Pattern)); err != nil {
+				return fmt.Errorf("pattern '%s' not found", part.Pattern)
+			}
+		}
+		song := &sequence.Song{Name: parts[2], Parts: songParts}
+		if err := song.Save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(h.out, "Saved song '%s' (%d loops)\n", song.Name, song.Loops())
+		return nil
+	case "play":
+		if len(parts) != 3 {
+			return fmt.Errorf("usage: song play <name>")
+		}
+		return h.playSong(parts[2])
+	case "stop":
+		if h.songStop == nil {
+			return fmt.Errorf("no song playing")
+		}
+		h.stopSong()
+		fmt.Fprintln(h.out, "Song stopped; the current pattern keeps looping")
+		return nil
+	}
+	return fmt.Errorf("usage: song [list|show <name>|new <name> <pattern[*loops]>...|play <name>|stop]")
+}
+
+// listSongs prints the saved songs with their arrangements
+func listSongs(w io.Writer) error {
+	names, err := sequence.ListSongs()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(w, "No saved songs (make one with 'song new' or 'ai-song')")
+		return nil
+	}
+	fmt.Fprintf(w, "Saved songs (%d):\n", len(names))
+	for _, name := range names {
+		song, err := sequence.LoadSong(name)
+		if err != nil {
+			fmt.Fprintf(w, "  %s (unreadable: %v)\n", name, err)
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %s\n", name, song)
+	}
+	return nil
+}
+
+// printSong shows a song's parts in order
+func printSong(w io.Writer, song *sequence.Song) {
+	fmt.Fprintf(w, "Song '%s' (%d loops):\n", song.Name, song.Loops())
+	for i, part := range song.Parts {
+		fmt.Fprintf(w, "  %d. %s × %d\n", i+1, part.Pattern, part.Repeats)
+	}
+}
+
+// playSong loads the song's patterns and plays them in order, each for its
+// loop count, switching at loop boundaries. The last pattern keeps looping.
+func (h *Handler) playSong(name string) error {
+	if h.clock == nil {
+		return fmt.Errorf("'song play' requires playback to be running")
+	}
+	song, err := sequence.LoadSong(name)
+	if err != nil {
+		return err
+	}
+	patterns := make([]*sequence.Pattern, len(song.Parts))
+	for i, part := range song.Parts {
+		if patterns[i], err = sequence.Load(part.Pattern); err != nil {
+			return fmt.Errorf("song '%s': %w", name, err)
+		}
+	}
+
+	h.stopSong()
+	h.stopAudition()
+	h.stopMorph()
+	h.songStop = make(chan struct{})
+	h.loadSongPart(song, patterns, 0)
+	go h.runSong(song, patterns, h.songStop)
+	fmt.Fprintf(h.out, "Playing song '%s' from the next loop: %s\n", song.Name, song)
+	if h.globalTempo {
+		fmt.Fprintf(h.out, "Tempo: %s BPM throughout (tempo-mode global)\n", sequence.FormatBPM(h.pattern.GetBPM()))
+	}
+	return nil
+}
+
+// handleTempoMode: tempo-mode [pattern|global]
+// Chooses whether a song's tempo follows each pattern or stays global
+func (h *Handler) handleTempoMode(parts []string) error {
+	if len(parts) > 2 {
+		return fmt.Errorf("usage: tempo-mode [pattern|global]")
+	}
+	if len(parts) == 2 {
+		switch strings.ToLower(parts[1]) {
+		case "pattern":
+			h.globalTempo = false
+		case "global":
+			h.globalTempo = true
+		default:
+			return fmt.Errorf("usage: tempo-mode [pattern|global] (e.g., 'tempo-mode global')")
+		}
+	}
+	if h.globalTempo {
+		fmt.Fprintf(h.out, "Tempo mode: global (song parts play at the current tempo, %s BPM)\n", sequence.FormatBPM(h.pattern.GetBPM()))
+	} else {
+		fmt.Fprintln(h.out, "Tempo mode: pattern (each song part plays at its saved tempo)")
+	}
+	return nil
+}
+
+// loadSongPart queues part i of a song; the engine plays it from the next
+// loop boundary. With a global tempo the part takes the current tempo
+// instead of its own, set before queuing so no loop plays at the old one.
+func (h *Handler) loadSongPart(song *sequence.Song, patterns []*sequence.Pattern, i int) {
+	part := patterns[i]
+	if h.globalTempo {
+		part = part.Clone()
+		part.SetTempo(h.pattern.GetBPM())
+	}
+	h.pattern.CopyFrom(part)
+	h.MarkSaved(song.Parts[i].Pattern)
+}
+
+// runSong follows the playback clock until the song ends or stop is closed.
+// EventLoop fires once the queued pattern has started, so the next part is
+// queued during the last loop of the current one.
+func (h *Handler) runSong(song *sequence.Song, patterns []*sequence.Pattern, stop chan struct{}) {
+	events := h.clock.Subscribe(waitEventBuffer)
+	defer h.clock.Unsubscribe(events)
+	defer h.Update(func() error {
+		if h.songStop == stop {
+			h.songStop = nil
+		}
+		return nil
+	})
+
+	part, left, started := 0, 0, false
+	for {
+		var ev playback.Event
+		var ok bool
+		select {
+		case <-stop:
+			return
+		case ev, ok = <-events:
+			if !ok {
+				return
+			}
+		}
+		if ev.Type != playback.EventLoop {
+			continue
+		}
+		if !started {
+			left, started = song.Parts[part].Repeats, true
+		}
+		if left--; left > 0 {
+			continue
+		}
+		if part == len(song.Parts)-1 {
+			fmt.Fprintln(h.out, theme.Dim(fmt.Sprintf("Song '%s' finished; '%s' keeps looping", song.Name, song.Parts[part].Pattern)))
+			return
+		}
+		part, started = part+1, false
+		h.Update(func() error {
+			select {
+			case <-stop:
+			default:
+				h.loadSongPart(song, patterns, part)
+			}
+			return nil
+		})
+	}
+}
+
+func (h *Handler) stopSong() {
+	if h.songStop == nil {
+		return
+	}
+	close(h.songStop)
+	h.songStop = nil
+}
+
+// songBuilder collects the patterns and arrangement of an 'ai-song'
+// request. Each pattern is edited on its own preview handler.
+type songBuilder struct {
+	h        *Handler
+	names    []string
+	patterns map[string]*Handler
+	current  *Handler
+	song     *sequence.Song
+}
+
+// runTool handles the song tools itself and passes the others to the
+// pattern being written
+func (b *songBuilder) runTool(call ai.ToolCall) (string, error) {
+	parts, err := call.Command()
+	if err != nil {
+		fmt.Fprintln(b.h.out, theme.Error(fmt.Sprintf("\n  Error: %v", err)))
+		return "", err
+	}
+	switch parts[0] {
+	case "song-pattern":
+		err = b.newPattern(parts[1:])
+	case "song-arrange":
+		err = b.arrange(parts[1:])
+	default:
+		if b.current == nil {
+			err = fmt.Errorf("start a pattern with new_pattern first")
+			break
+		}
+		return b.current.runAITool(call)
+	}
+	if err != nil {
+		fmt.Fprintln(b.h.out, theme.Error(fmt.Sprintf("\n  Error: %v", err)))
+		return "", err
+	}
+	return "ok", nil
+}
+
+// newPattern starts pattern name, empty or as a copy of an earlier one
+func (b *songBuilder) newPattern(args []string) error {
+	name := args[0]
+	if !songPartName.MatchString(name) {
+		return fmt.Errorf("invalid pattern name %q (use letters, digits, - and _)", name)
+	}
+	if _, ok := b.patterns[name]; ok {
+		return fmt.Errorf("pattern '%s' already exists in this song", name)
+	}
+	preview := b.h.previewHandler()
+	if len(args) > 1 {
+		from, ok := b.patterns[args[1]]
+		if !ok {
+			return fmt.Errorf("no pattern '%s' to start from", args[1])
+		}
+		preview.pattern.CopyFrom(from.pattern)
+		fmt.Fprintf(b.h.out, "\n  > new pattern %s (from %s)\n", name, args[1])
+	} else {
+		preview.pattern.Clear()
+		fmt.Fprintf(b.h.out, "\n  > new pattern %s\n", name)
+	}
+	b.names = append(b.names, name)
+	b.patterns[name] = preview
+	b.current = preview
+	return nil
+}
+
+// arrange sets the song's name and order
+func (b *songBuilder) arrange(args []string) error {
+	if !songPartName.MatchString(args[0]) {
+		return fmt.Errorf("invalid song name %q (use letters, digits, - and _)", args[0])
+	}
+	songParts, err := sequence.ParseSongParts(args[1:])
+	if err != nil {
+		return err
+	}
+	for _, part := range songParts {
+		if _, ok := b.patterns[part.Pattern]; !ok {
+			return fmt.Errorf("no pattern '%s' in this song", part.Pattern)
+		}
+	}
+	b.song = &sequence.Song{Name: args[0], Parts: songParts}
+	fmt.Fprintf(b.h.out, "\n  > arrange %s: %s\n", b.song.Name, b.song)
+	return nil
+}
+
+// handleAISong: ai-song <description>
+// Asks the AI for a whole song: several patterns and the order to play
+// them in. The patterns are saved in a collection named after the song.
+func (h *Handler) handleAISong(parts []string) error {
+	if h.aiClient == nil {
+		return errAIUnavailable
+	}
+	if len(parts) < 2 {
+		return fmt.Errorf("usage: ai-song <description> (e.g., 'ai-song a short techno track with a breakdown')")
+	}
+
+	ctx, done := h.startAIRequest(context.Background())
+	defer done()
+	h.aiClient.SetRecentCommands(h.recentCommands)
+	builder := &songBuilder{h: h, patterns: map[string]*Handler{}}
+	fmt.Fprintln(h.out, "Writing the song...")
+	response, err := h.aiClient.Song(ctx, strings.Join(parts[1:], " "), h.pattern, ai.StreamHandler{Tool: builder.runTool})
+	fmt.Fprintln(h.out)
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(h.out, theme.Warning("AI request cancelled"))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if message := strings.TrimSpace(response.Message); message != "" {
+		fmt.Fprintln(h.out, theme.AI(message))
+	}
+	if h.showAIUsage {
+		fmt.Fprintln(h.out, theme.Dim(fmt.Sprintf("  [%s]", response.Usage)))
+	}
+
+	if len(builder.names) == 0 {
+		return fmt.Errorf("the AI made no patterns")
+	}
+	song := builder.song
+	if song == nil {
+		// No arrangement: play the patterns once each, in the order made
+		song = &sequence.Song{Name: "song"}
+		for _, name := range builder.names {
+			song.Parts = append(song.Parts, sequence.SongPart{Pattern: name, Repeats: 1})
+		}
+		fmt.Fprintln(h.out, theme.Warning("The AI gave no arrangement; using each pattern once"))
+	}
+
+	fmt.Fprintf(h.out, "\nSong '%s': %s (%d loops)\n", song.Name, song, song.Loops())
+	for _, name := range builder.names {
+		p := builder.patterns[name].pattern
+		notes := 0
+		p.ForEachStep(func(_ int, step sequence.Step) {
+			if !step.IsRest {
+				notes++
+			}
+		})
+		fmt.Fprintf(h.out, "  %s: %d steps, %s BPM, %d notes\n", name, p.Length(), sequence.FormatBPM(p.GetBPM()), notes)
+	}
+	if _, err := os.Stat(sequence.SongPath(song.Name)); err == nil {
+		fmt.Fprintln(h.out, theme.Warning(fmt.Sprintf("⚠️  Warning: Song '%s' already exists and will be overwritten.", song.Name)))
+	}
+
+	if !h.aiAutoApply && h.readLine != nil {
+		answer, err := h.readLine("Save? (y/n) ")
+		if answer = strings.ToLower(strings.TrimSpace(answer)); err != nil || (answer != "y" && answer != "yes") {
+			fmt.Fprintln(h.out, "Discarded")
+			return nil
+		}
+	}
+	return saveAISong(h.out, song, builder)
+}
+
+// saveAISong saves the song's patterns as <song>/<pattern> and the song
+// pointing to them
+func saveAISong(w io.Writer, song *sequence.Song, builder *songBuilder) error {
+	for _, name := range builder.names {
+		if err := builder.patterns[name].pattern.Save(song.Name + "/" + name); err != nil {
+			return fmt.Errorf("failed to save pattern: %w", err)
+		}
+	}
+	for i := range song.Parts {
+		song.Parts[i].Pattern = song.Name + "/" + song.Parts[i].Pattern
+	}
+	if err := song.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Saved song '%s' and %d patterns in %s/ ('song play %s' to play it)\n", song.Name, len(builder.names), song.Name, song.Name)
+	return nil
+}
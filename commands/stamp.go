@@ -0,0 +1,202 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StampsFile is where step templates are persisted (next to patterns/)
+var StampsFile = "stamps.json"
+
+// loadStamps reads stamps from disk: name -> parameters, e.g.
+// "vel:110 gate:40 dur:2". A missing file means no stamps yet.
+func loadStamps() (map[string]string, error) {
+	data, err := os.ReadFile(StampsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read stamps file: %w", err)
+	}
+
+	stamps := map[string]string{}
+	if err := json.Unmarshal(data, &stamps); err != nil {
+		return nil, fmt.Errorf("failed to parse stamps file: %w", err)
+	}
+	return stamps, nil
+}
+
+// saveStamps writes all stamps to disk
+func saveStamps(stamps map[string]string) error {
+	data, err := json.MarshalIndent(stamps, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal stamps: %w", err)
+	}
+	if err := os.WriteFile(StampsFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write stamps file: %w", err)
+	}
+	return nil
+}
+
+// handleStamp: stamp [define|list|delete] ...
+// Names a set of 'set' parameters so 'set 5 C2 @accent' applies them
+func (h *Handler) handleStamp(parts []string) error {
+	usage := fmt.Errorf("usage: stamp define <name> <vel:|gate:|dur:>... | stamp list | stamp delete <name>")
+	if len(parts) == 1 {
+		return listStamps(h.out)
+	}
+
+	switch strings.ToLower(parts[1]) {
+	case "define", "def":
+		if len(parts) < 4 {
+			return fmt.Errorf("usage: stamp define <name> <vel:|gate:|dur:>... (e.g., 'stamp define accent vel:110 gate:40 dur:2')")
+		}
+		return defineStamp(h.out, strings.ToLower(parts[2]), parts[3:])
+
+	case "list", "ls":
+		if len(parts) != 2 {
+			return fmt.Errorf("usage: stamp list")
+		}
+		return listStamps(h.out)
+
+	case "delete", "rm":
+		if len(parts) != 3 {
+			return fmt.Errorf("usage: stamp delete <name>")
+		}
+		return deleteStamp(h.out, strings.ToLower(parts[2]))
+
+	default:
+		return usage
+	}
+}
+
+// defineStamp checks the parameters and stores them under name
+func defineStamp(w io.Writer, name string, params []string) error {
+	if strings.ContainsAny(name, "@:") {
+		return fmt.Errorf("invalid stamp name: %q", name)
+	}
+	for _, param := range params {
+		if err := checkStampParam(param); err != nil {
+			return err
+		}
+	}
+
+	stamps, err := loadStamps()
+	if err != nil {
+		return err
+	}
+	if _, exists := stamps[name]; exists {
+		fmt.Fprintf(w, "⚠️  Warning: Stamp '%s' already exists and will be overwritten.\n", name)
+	}
+	stamps[name] = strings.Join(params, " ")
+
+	if err := saveStamps(stamps); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Defined stamp '%s': %s (use 'set <step> <note> @%s')\n", name, stamps[name], name)
+	return nil
+}
+
+// checkStampParam validates one parameter as 'set' would; durations are
+// checked against the pattern length when the stamp is used
+func checkStampParam(param string) error {
+	key, value, _ := strings.Cut(param, ":")
+	switch strings.ToLower(key) {
+	case "vel":
+		if v, err := strconv.Atoi(value); err != nil || v < 0 || v > 127 {
+			return fmt.Errorf("velocity must be 0-127, got %s", value)
+		}
+	case "gate":
+		if _, _, err := parseGate(value); err != nil {
+			return err
+		}
+	case "dur":
+		if v, err := strconv.Atoi(value); err != nil || v < 1 {
+			return fmt.Errorf("invalid duration: %s", value)
+		}
+	default:
+		return fmt.Errorf("unknown parameter: %s (expected vel:, gate:, or dur:)", param)
+	}
+	return nil
+}
+
+// expandStamps replaces each @name among 'set' parameters with the
+// stamp's parameters, so parameters after it override the stamp's
+func expandStamps(params []string) ([]string, error) {
+	var stamps map[string]string
+	var expanded []string
+	for _, param := range params {
+		name, ok := strings.CutPrefix(param, "@")
+		if !ok {
+			expanded = append(expanded, param)
+			continue
+		}
+		if stamps == nil {
+			var err error
+			if stamps, err = loadStamps(); err != nil {
+				return nil, err
+			}
+		}
+		body, ok := stamps[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("stamp '%s' not found (see 'stamp list')", name)
+		}
+		expanded = append(expanded, strings.Fields(body)...)
+	}
+	return expanded, nil
+}
+
+// listStamps prints all stamps sorted by name
+func listStamps(w io.Writer) error {
+	stamps, err := loadStamps()
+	if err != nil {
+		return err
+	}
+	if len(stamps) == 0 {
+		fmt.Fprintln(w, "No stamps defined (e.g., 'stamp define accent vel:110 gate:40')")
+		return nil
+	}
+
+	fmt.Fprintf(w, "Stamps (%d):\n", len(stamps))
+	for _, name := range stampNames("") {
+		fmt.Fprintf(w, "  @%s: %s\n", name, stamps[name])
+	}
+	return nil
+}
+
+// deleteStamp removes a stamp and persists the change
+func deleteStamp(w io.Writer, name string) error {
+	stamps, err := loadStamps()
+	if err != nil {
+		return err
+	}
+	if _, ok := stamps[name]; !ok {
+		return fmt.Errorf("stamp '%s' not found", name)
+	}
+	delete(stamps, name)
+
+	if err := saveStamps(stamps); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Deleted stamp '%s'\n", name)
+	return nil
+}
+
+// stampNames lists defined stamps for completion (errors yield no candidates)
+func stampNames(string) []string {
+	stamps, err := loadStamps()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(stamps))
+	for name := range stamps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
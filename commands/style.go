@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/iltempo/interplay/style"
+)
+
+// handleStyle: style [name|off] - without arguments, shows the active
+// preset and lists the available ones
+func (h *Handler) handleStyle(parts []string) error {
+	if len(parts) > 2 {
+		return fmt.Errorf("usage: style [name|off] (e.g., 'style techno')")
+	}
+
+	if len(parts) == 1 {
+		if h.style == nil {
+			fmt.Fprintln(h.out, "Style: off")
+		} else {
+			fmt.Fprintf(h.out, "Style: %s - %s\n", h.style.Name, h.style.Summary())
+		}
+		names, err := style.List()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h.out, "Available: %s\n", strings.Join(names, ", "))
+		return nil
+	}
+
+	if strings.ToLower(parts[1]) == "off" {
+		h.setStyle(nil)
+		fmt.Fprintln(h.out, "Style preset off")
+		return nil
+	}
+	preset, err := style.Load(parts[1])
+	if err != nil {
+		return err
+	}
+	h.setStyle(preset)
+	fmt.Fprintf(h.out, "Style %s: %s\n", preset.Name, preset.Summary())
+	return nil
+}
+
+// setStyle switches the active style preset and tells the AI about it
+func (h *Handler) setStyle(preset *style.Style) {
+	h.style = preset
+	if h.aiClient == nil {
+		return
+	}
+	if preset == nil {
+		h.aiClient.SetStyle("")
+	} else {
+		h.aiClient.SetStyle(preset.Describe())
+	}
+}
+
+// styleArg completes a style preset name
+func styleArg(h *Handler) []readline.PrefixCompleterInterface {
+	names := func(string) []string {
+		list, _ := style.List()
+		return append(list, "off")
+	}
+	return []readline.PrefixCompleterInterface{readline.PcItemDynamic(names)}
+}
@@ -0,0 +1,49 @@
+package commands
+
+import "fmt"
+
+// Transport pauses and resumes playback. *playback.Engine implements it.
+type Transport interface {
+	Pause()
+	Resume()
+	IsPaused() bool
+}
+
+// SetTransport connects the handler to the playback transport used by 'pause' and 'resume'
+func (h *Handler) SetTransport(transport Transport) {
+	h.transport = transport
+}
+
+// handlePause: pause
+func (h *Handler) handlePause(parts []string) error {
+	if len(parts) != 1 {
+		return fmt.Errorf("usage: pause")
+	}
+	if h.transport == nil {
+		return fmt.Errorf("playback is not running")
+	}
+	if h.transport.IsPaused() {
+		fmt.Fprintln(h.out, "Playback already paused")
+		return nil
+	}
+	h.transport.Pause()
+	fmt.Fprintln(h.out, "Playback paused (type 'resume' to continue)")
+	return nil
+}
+
+// handleResume: resume
+func (h *Handler) handleResume(parts []string) error {
+	if len(parts) != 1 {
+		return fmt.Errorf("usage: resume")
+	}
+	if h.transport == nil {
+		return fmt.Errorf("playback is not running")
+	}
+	if !h.transport.IsPaused() {
+		fmt.Fprintln(h.out, "Playback is not paused")
+		return nil
+	}
+	h.transport.Resume()
+	fmt.Fprintln(h.out, "Playback resumed")
+	return nil
+}
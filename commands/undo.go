@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// maxUndo is how many snapshots 'undo' can go back
+const maxUndo = 20
+
+// pushUndo snapshots the pattern before an edit that can be undone
+func (h *Handler) pushUndo() {
+	h.undoStack = append(h.undoStack, h.pattern.Clone())
+	if len(h.undoStack) > maxUndo {
+		h.undoStack = h.undoStack[1:]
+	}
+}
+
+// handleUndo: undo - revert the last applied AI edit
+func (h *Handler) handleUndo(parts []string) error {
+	if len(parts) != 1 {
+		return fmt.Errorf("usage: undo")
+	}
+	if len(h.undoStack) == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	snapshot := h.undoStack[len(h.undoStack)-1]
+	h.undoStack = h.undoStack[:len(h.undoStack)-1]
+	printDiff(h.out, h.pattern, snapshot)
+	h.pattern.CopyFrom(snapshot)
+	fmt.Fprintln(h.out, "Undone")
+	return nil
+}
+
+// printDiff shows how after differs from before
+func printDiff(w io.Writer, before, after *sequence.Pattern) {
+	lines := sequence.Diff(before, after)
+	if len(lines) == 0 {
+		fmt.Fprintln(w, "  (no changes)")
+		return
+	}
+	for _, line := range lines {
+		fmt.Fprintln(w, "  "+line)
+	}
+}
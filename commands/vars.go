@@ -0,0 +1,280 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// handleLet: let [name=value]
+// Without arguments, lists all variables
+func (h *Handler) handleLet(parts []string) error {
+	if len(parts) == 1 {
+		return h.listVars()
+	}
+
+	name, value, ok := strings.Cut(strings.Join(parts[1:], " "), "=")
+	name = strings.TrimSpace(name)
+	value = strings.TrimSpace(value)
+	if !ok || value == "" {
+		return fmt.Errorf("usage: let <name>=<value> (e.g., 'let root=C2', 'let start=5')")
+	}
+	if !isVarName(name) {
+		return fmt.Errorf("invalid variable name: %s (use letters, digits and _, starting with a letter)", name)
+	}
+
+	if h.vars == nil {
+		h.vars = map[string]string{}
+	}
+	h.vars[name] = value
+	fmt.Fprintf(h.out, "%s = %s\n", name, value)
+	return nil
+}
+
+// listVars prints all variables sorted by name
+func (h *Handler) listVars() error {
+	if len(h.vars) == 0 {
+		fmt.Fprintln(h.out, "No variables defined")
+		return nil
+	}
+
+	names := make([]string, 0, len(h.vars))
+	for name := range h.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(h.out, "  %s = %s\n", name, h.vars[name])
+	}
+	return nil
+}
+
+// isVarName reports whether name is a valid variable name
+func isVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !(unicode.IsLetter(r) || r == '_' || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
+
+// expandVars substitutes variables in a command line:
+//
+//	$name      the variable's value
+//	${expr}    arithmetic on numbers, notes and variables, e.g. ${start+4} or ${root+7}
+//	$$         a literal $
+func (h *Handler) expandVars(line string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] != '$' {
+			sb.WriteByte(line[i])
+			continue
+		}
+
+		rest := line[i+1:]
+		switch {
+		case strings.HasPrefix(rest, "$"):
+			sb.WriteByte('$')
+			i++
+
+		case strings.HasPrefix(rest, "{"):
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated expression: $%s", rest)
+			}
+			result, err := h.evalExpr(rest[1:end])
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(result)
+			i += end + 1
+
+		default:
+			end := 0
+			for end < len(rest) && isVarName(rest[:end+1]) {
+				end++
+			}
+			name := rest[:end]
+			value, ok := h.vars[name]
+			if !ok {
+				return "", fmt.Errorf("undefined variable: $%s", name)
+			}
+			sb.WriteString(value)
+			i += end
+		}
+	}
+	return sb.String(), nil
+}
+
+// exprValue is an intermediate result: a plain number or a MIDI note
+type exprValue struct {
+	n    int
+	note bool
+}
+
+// evalExpr evaluates an arithmetic expression with + - * / and parentheses.
+// Notes behave like MIDI numbers: note+number is a note (transposition) and
+// note-note is a number (interval).
+func (h *Handler) evalExpr(expr string) (string, error) {
+	p := &exprParser{h: h, expr: expr}
+	v, err := p.parseSum()
+	if err != nil {
+		return "", fmt.Errorf("invalid expression ${%s}: %w", expr, err)
+	}
+	if p.skipSpace(); p.pos < len(p.expr) {
+		return "", fmt.Errorf("invalid expression ${%s}: unexpected '%s'", expr, p.expr[p.pos:])
+	}
+
+	if !v.note {
+		return strconv.Itoa(v.n), nil
+	}
+	if v.n < 0 || v.n > 127 {
+		return "", fmt.Errorf("invalid expression ${%s}: note out of range (MIDI %d)", expr, v.n)
+	}
+	return sequence.MIDIToNoteName(uint8(v.n)), nil
+}
+
+// exprParser is a small recursive-descent parser for evalExpr
+type exprParser struct {
+	h    *Handler
+	expr string
+	pos  int
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.expr) && p.expr[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.expr) {
+		return p.expr[p.pos]
+	}
+	return 0
+}
+
+// parseSum: product (('+'|'-') product)*
+func (p *exprParser) parseSum() (exprValue, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return left, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return left, err
+		}
+		switch {
+		case op == '+' && left.note && right.note:
+			return left, fmt.Errorf("can't add two notes")
+		case op == '+':
+			left = exprValue{n: left.n + right.n, note: left.note || right.note}
+		case left.note && right.note:
+			left = exprValue{n: left.n - right.n} // interval in semitones
+		case right.note:
+			return left, fmt.Errorf("can't subtract a note from a number")
+		default:
+			left = exprValue{n: left.n - right.n, note: left.note}
+		}
+	}
+	return left, nil
+}
+
+// parseProduct: factor (('*'|'/') factor)*
+func (p *exprParser) parseProduct() (exprValue, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return left, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return left, err
+		}
+		if left.note || right.note {
+			return left, fmt.Errorf("can't multiply or divide notes")
+		}
+		if op == '*' {
+			left.n *= right.n
+		} else {
+			if right.n == 0 {
+				return left, fmt.Errorf("division by zero")
+			}
+			left.n /= right.n
+		}
+	}
+	return left, nil
+}
+
+// parseFactor: '-' factor | '(' sum ')' | operand
+func (p *exprParser) parseFactor() (exprValue, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		v, err := p.parseFactor()
+		if err != nil {
+			return v, err
+		}
+		if v.note {
+			return v, fmt.Errorf("can't negate a note")
+		}
+		return exprValue{n: -v.n}, nil
+
+	case '(':
+		p.pos++
+		v, err := p.parseSum()
+		if err != nil {
+			return v, err
+		}
+		if p.peek() != ')' {
+			return v, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return v, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.expr) && isOperandChar(p.expr[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		return exprValue{}, fmt.Errorf("expected a number, note or variable")
+	}
+	return p.h.resolveOperand(p.expr[start:p.pos])
+}
+
+// isOperandChar reports whether c can appear in a number, note or variable name
+func isOperandChar(c byte) bool {
+	return c == '_' || c == '#' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// resolveOperand interprets a variable, number, or note name
+func (h *Handler) resolveOperand(token string) (exprValue, error) {
+	if value, ok := h.vars[token]; ok {
+		token = value
+	}
+	if n, err := strconv.Atoi(token); err == nil {
+		return exprValue{n: n}, nil
+	}
+	if note, err := sequence.NoteNameToMIDI(token); err == nil {
+		return exprValue{n: int(note), note: true}, nil
+	}
+	if isVarName(token) {
+		return exprValue{}, fmt.Errorf("undefined variable: %s", token)
+	}
+	return exprValue{}, fmt.Errorf("not a number or note: %s", token)
+}
@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iltempo/interplay/ai"
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+// Defaults and limits for 'ai-vary'
+const (
+	defaultVaryAmount = 25 // percent of steps to change
+	defaultVaryCount  = 3
+	maxVaryCount      = 8
+)
+
+// handleAIVary: ai-vary [amount] [count] | ai-vary try <n|original> | ai-vary keep | ai-vary list
+// Variations are kept in memory until one is kept or new ones are made
+func (h *Handler) handleAIVary(parts []string) error {
+	if len(parts) >= 2 {
+		switch parts[1] {
+		case "try":
+			if len(parts) != 3 {
+				return fmt.Errorf("usage: ai-vary try <n|original>")
+			}
+			return h.tryVariation(parts[2])
+		case "keep":
+			return h.keepVariation()
+		case "list":
+			return h.listVariations()
+		}
+	}
+	if len(parts) > 3 {
+		return fmt.Errorf("usage: ai-vary [amount] [count] (e.g., 'ai-vary 30 4')")
+	}
+
+	amount, count := defaultVaryAmount, defaultVaryCount
+	if len(parts) >= 2 {
+		n, err := strconv.Atoi(strings.TrimSuffix(parts[1], "%"))
+		if err != nil || n < 1 || n > 100 {
+			return fmt.Errorf("amount must be a percentage 1-100, got %s", parts[1])
+		}
+		amount = n
+	}
+	if len(parts) == 3 {
+		n, err := strconv.Atoi(parts[2])
+		if err != nil || n < 1 || n > maxVaryCount {
+			return fmt.Errorf("count must be 1-%d, got %s", maxVaryCount, parts[2])
+		}
+		count = n
+	}
+	return h.generateVariations(amount, count)
+}
+
+// generateVariations asks the AI for count variations of the pattern, each
+// made on its own copy
+func (h *Handler) generateVariations(amount, count int) error {
+	if h.aiClient == nil {
+		return errAIUnavailable
+	}
+	ctx, done := h.startAIRequest(context.Background())
+	defer done()
+
+	original := h.pattern.Clone()
+	h.aiClient.SetRecentCommands(h.recentCommands)
+	fmt.Fprintf(h.out, "Asking for %d variation(s), changing about %d%% of the steps...\n", count, amount)
+
+	var variations []*sequence.Pattern
+	var usage ai.Usage
+	var err error
+	for n := 1; n <= count; n++ {
+		preview := h.previewHandler()
+		var response *ai.SessionResponse
+		response, err = h.aiClient.Variation(ctx, original, amount, n, count, ai.StreamHandler{Tool: preview.runAITool})
+		if err != nil {
+			break
+		}
+		usage.Add(response.Usage)
+		variations = append(variations, preview.pattern)
+		changes := len(sequence.Diff(original, preview.pattern))
+		fmt.Fprintf(h.out, "  %d: %s %s\n", n, theme.AI(strings.TrimSpace(response.Message)), theme.Dim(fmt.Sprintf("(%d changes)", changes)))
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(h.out, theme.Warning("AI request cancelled"))
+		err = nil
+	}
+	if h.showAIUsage && usage.Requests > 0 {
+		fmt.Fprintln(h.out, theme.Dim(fmt.Sprintf("  [%s]", usage)))
+	}
+
+	if len(variations) > 0 {
+		h.varOriginal, h.variations, h.varPlaying = original, variations, 0
+		fmt.Fprintln(h.out, "'ai-vary try <n>' plays one from the next loop, 'ai-vary keep' keeps it")
+	}
+	return err
+}
+
+// tryVariation switches to a variation, or back to the original. The
+// engine picks up the change at the next loop boundary.
+func (h *Handler) tryVariation(arg string) error {
+	if len(h.variations) == 0 {
+		return fmt.Errorf("no variations (make some with 'ai-vary')")
+	}
+	n := 0
+	if arg != "original" {
+		var err error
+		n, err = strconv.Atoi(arg)
+		if err != nil || n < 0 || n > len(h.variations) {
+			return fmt.Errorf("variation must be 1-%d or 'original', got %s", len(h.variations), arg)
+		}
+	}
+
+	if n == 0 {
+		h.pattern.CopyFrom(h.varOriginal)
+		fmt.Fprintln(h.out, "Original from the next loop")
+	} else {
+		h.pattern.CopyFrom(h.variations[n-1])
+		fmt.Fprintf(h.out, "Variation %d from the next loop\n", n)
+	}
+	h.varPlaying = n
+	return nil
+}
+
+// keepVariation keeps the variation playing and drops the others; 'undo'
+// goes back to the original
+func (h *Handler) keepVariation() error {
+	if len(h.variations) == 0 {
+		return fmt.Errorf("no variations (make some with 'ai-vary')")
+	}
+	if h.varPlaying == 0 {
+		fmt.Fprintln(h.out, "Kept the original")
+	} else {
+		kept := h.pattern.Clone()
+		h.pattern.CopyFrom(h.varOriginal)
+		h.pushUndo()
+		h.pattern.CopyFrom(kept)
+		fmt.Fprintf(h.out, "Kept variation %d ('undo' to revert)\n", h.varPlaying)
+	}
+	h.varOriginal, h.variations, h.varPlaying = nil, nil, 0
+	return nil
+}
+
+// listVariations shows how each variation differs from the original
+func (h *Handler) listVariations() error {
+	if len(h.variations) == 0 {
+		fmt.Fprintln(h.out, "No variations (make some with 'ai-vary')")
+		return nil
+	}
+	for i, variation := range h.variations {
+		marker := " "
+		if h.varPlaying == i+1 {
+			marker = "*"
+		}
+		fmt.Fprintf(h.out, "%s Variation %d:\n", marker, i+1)
+		printDiff(h.out, h.varOriginal, variation)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iltempo/interplay/playback"
+)
+
+// VelocityCurver maps output velocities. *playback.Engine implements it.
+type VelocityCurver interface {
+	SetVelocityCurve(curve *playback.VelocityCurve)
+	VelocityCurve() *playback.VelocityCurve
+}
+
+// SetVelocityCurver connects the handler to the engine used by 'velcurve'
+func (h *Handler) SetVelocityCurver(curver VelocityCurver) {
+	h.velCurver = curver
+}
+
+// handleVelCurve: velcurve [linear|soft|hard|fixed [n]|custom <in:out>...]
+// Sets the velocity curve applied to every note sent to the synth
+func (h *Handler) handleVelCurve(parts []string) error {
+	if h.velCurver == nil {
+		return fmt.Errorf("playback is not running")
+	}
+
+	if len(parts) == 1 {
+		fmt.Fprintf(h.out, "Velocity curve: %s\n", h.velCurver.VelocityCurve())
+		return nil
+	}
+
+	curve, err := playback.ParseVelocityCurve(strings.Join(parts[1:], " "))
+	if err != nil {
+		return err
+	}
+	if curve.Name == "linear" {
+		curve = nil
+	}
+	h.velCurver.SetVelocityCurve(curve)
+	fmt.Fprintf(h.out, "Velocity curve: %s (will take effect at next loop iteration)\n", curve)
+	return nil
+}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iltempo/interplay/playback"
+)
+
+// Clock delivers playback events so commands can sync to the running loop.
+// *playback.Engine implements it.
+type Clock interface {
+	Subscribe(buffer int) <-chan playback.Event
+	Unsubscribe(ch <-chan playback.Event)
+}
+
+// SetClock connects the handler to the playback clock used by 'wait'
+func (h *Handler) SetClock(clock Clock) {
+	h.clock = clock
+}
+
+// stepsPerBeat and stepsPerBar describe the 16th-note grid
+const (
+	stepsPerBeat = 4
+	stepsPerBar  = 16
+)
+
+// waitEventBuffer is large enough that a waiting command never misses steps
+const waitEventBuffer = 256
+
+// handleWait: wait <n> <beats|bars|seconds> | wait loop | wait <n> loops
+// 'sleep <n>' is the same as 'wait <n> seconds'
+func (h *Handler) handleWait(parts []string) error {
+	usage := fmt.Errorf("usage: wait <n> <beats|bars|seconds|loops> or wait loop (e.g., 'wait 2 bars')")
+
+	if len(parts) == 2 && strings.ToLower(parts[1]) == "loop" {
+		return h.waitLoops(1)
+	}
+	if len(parts) < 2 || len(parts) > 3 {
+		return usage
+	}
+
+	amount, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || amount <= 0 {
+		return fmt.Errorf("invalid wait amount: %s (must be a positive number)", parts[1])
+	}
+
+	// Without a unit, 'sleep' counts seconds and 'wait' counts beats
+	unit := "beats"
+	if strings.ToLower(parts[0]) == "sleep" {
+		unit = "seconds"
+	}
+	if len(parts) == 3 {
+		unit = strings.ToLower(parts[2])
+	}
+
+	switch unit {
+	case "beat", "beats":
+		return h.waitSteps(amount * stepsPerBeat)
+	case "bar", "bars":
+		return h.waitSteps(amount * stepsPerBar)
+	case "second", "seconds", "sec", "s":
+		time.Sleep(time.Duration(amount * float64(time.Second)))
+		return nil
+	case "loop", "loops":
+		if amount != float64(int(amount)) {
+			return fmt.Errorf("invalid loop count: %s (must be a whole number)", parts[1])
+		}
+		return h.waitLoops(int(amount))
+	default:
+		return usage
+	}
+}
+
+// waitSteps blocks for the given number of 16th-note steps of the playback
+// clock, so tempo changes while waiting are followed. Without a clock it
+// falls back to sleeping at the pattern's tempo.
+func (h *Handler) waitSteps(steps float64) error {
+	count := int(steps + 0.5)
+	if count < 1 {
+		count = 1
+	}
+
+	if h.clock == nil {
+		stepDuration := time.Duration(float64(time.Minute) / h.pattern.GetBPM() / stepsPerBeat)
+		time.Sleep(time.Duration(count) * stepDuration)
+		return nil
+	}
+	return h.waitEvents(playback.EventStep, count)
+}
+
+// waitLoops blocks until the given number of loop boundaries have passed
+func (h *Handler) waitLoops(loops int) error {
+	if h.clock == nil {
+		return fmt.Errorf("'wait loop' requires playback to be running")
+	}
+	return h.waitEvents(playback.EventLoop, loops)
+}
+
+// waitEvents blocks until count events of the given type have been received
+func (h *Handler) waitEvents(eventType playback.EventType, count int) error {
+	events := h.clock.Subscribe(waitEventBuffer)
+	defer h.clock.Unsubscribe(events)
+
+	for count > 0 {
+		ev, ok := <-events
+		if !ok {
+			return fmt.Errorf("playback stopped while waiting")
+		}
+		if ev.Type == eventType {
+			count--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+// watchInterval is how often 'watch on' checks the current pattern's file
+const watchInterval = 500 * time.Millisecond
+
+// fileModTime returns the modification time of the saved pattern name, or
+// the zero time if it has no file
+func fileModTime(name string) time.Time {
+	if name == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(sequence.Path(name))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// handleReload: reload
+func (h *Handler) handleReload(parts []string) error {
+	if len(parts) != 1 {
+		return fmt.Errorf("usage: reload")
+	}
+	if h.patternName == "" {
+		return fmt.Errorf("no saved pattern to reload (load or save one first)")
+	}
+	return h.handleLoad([]string{"load", h.patternName})
+}
+
+// handleWatch: watch [on|off]
+func (h *Handler) handleWatch(parts []string) error {
+	if len(parts) == 1 {
+		if h.watchStop != nil {
+			fmt.Fprintln(h.out, "Watching the current pattern's file for changes")
+		} else {
+			fmt.Fprintln(h.out, "Not watching pattern files")
+		}
+		return nil
+	}
+	if len(parts) != 2 {
+		return fmt.Errorf("usage: watch [on|off]")
+	}
+	switch parts[1] {
+	case "on":
+		h.startWatching()
+		fmt.Fprintln(h.out, "Watching the current pattern's file; external edits are reloaded automatically")
+	case "off":
+		h.stopWatching()
+		fmt.Fprintln(h.out, "Stopped watching pattern files")
+	default:
+		return fmt.Errorf("usage: watch [on|off]")
+	}
+	return nil
+}
+
+// SetWatch starts or stops reloading the current pattern when its file
+// changes on disk (e.g. edited by another tool or updated by git pull)
+func (h *Handler) SetWatch(on bool) {
+	h.execMu.Lock()
+	defer h.execMu.Unlock()
+	if on {
+		h.startWatching()
+	} else {
+		h.stopWatching()
+	}
+}
+
+func (h *Handler) startWatching() {
+	if h.watchStop != nil {
+		return
+	}
+	h.watchStop = make(chan struct{})
+	go h.watch(h.watchStop)
+}
+
+func (h *Handler) stopWatching() {
+	if h.watchStop == nil {
+		return
+	}
+	close(h.watchStop)
+	h.watchStop = nil
+}
+
+// watch polls the current pattern's file until stop is closed
+func (h *Handler) watch(stop <-chan struct{}) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := h.Update(h.reloadIfChanged); err != nil {
+				fmt.Fprintln(h.out, theme.Error(fmt.Sprintf("Reload failed: %v", err)))
+			}
+		}
+	}
+}
+
+// reloadIfChanged reloads the current pattern if its file changed since it
+// was last saved or loaded. Unsaved local edits are never discarded; the
+// user is warned once and can 'reload' explicitly.
+func (h *Handler) reloadIfChanged() error {
+	modTime := fileModTime(h.patternName)
+	if modTime.IsZero() || modTime.Equal(h.savedModTime) {
+		return nil
+	}
+	if h.IsModified() {
+		h.savedModTime = modTime
+		fmt.Fprintln(h.out, theme.Warning(fmt.Sprintf("⚠️  Pattern '%s' changed on disk, but you have unsaved changes. Type 'reload' to discard them.", h.patternName)))
+		return nil
+	}
+	return h.handleLoad([]string{"load", h.patternName})
+}
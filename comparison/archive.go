@@ -0,0 +1,135 @@
+package comparison
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchiveDir returns where archived comparisons are kept, gzipped: out of
+// the way of List, but still there to unpack
+func ArchiveDir() string {
+	return filepath.Join(Dir, "archive")
+}
+
+// ParseAge reads an age like "30d", "2w" or anything time.ParseDuration
+// takes ("12h")
+func ParseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			days, err := strconv.Atoi(n)
+			if err != nil || days < 0 {
+				return 0, fmt.Errorf("invalid age %q (e.g., 30d, 2w, 12h)", s)
+			}
+			return time.Duration(days) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (e.g., 30d, 2w, 12h)", s)
+	}
+	return d, nil
+}
+
+// Size returns the bytes a saved comparison takes on disk
+func Size(id string) (int64, error) {
+	info, err := os.Stat(Path(id))
+	if err != nil {
+		return 0, fmt.Errorf("comparison '%s' not found", id)
+	}
+	return info.Size(), nil
+}
+
+// ArchiveSize returns the bytes the archived comparisons take on disk
+func ArchiveSize() (int64, error) {
+	entries, err := os.ReadDir(ArchiveDir())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read archive: %w", err)
+	}
+	var total int64
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			total += info.Size()
+		}
+	}
+	return total, nil
+}
+
+// OlderThan returns the IDs of the comparisons made more than age ago
+func OlderThan(age time.Duration) ([]string, error) {
+	all, err := LoadAll()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-age)
+	var ids []string
+	for _, c := range all {
+		if c.Created.Before(cutoff) {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids, nil
+}
+
+// Delete removes a saved comparison
+func Delete(id string) error {
+	if _, err := Load(id); err != nil {
+		return err
+	}
+	if err := os.Remove(Path(id)); err != nil {
+		return fmt.Errorf("failed to delete comparison: %w", err)
+	}
+	return nil
+}
+
+// Archive gzips a saved comparison into ArchiveDir and removes it from
+// Dir, returning the archive's size
+func Archive(id string) (int64, error) {
+	if _, err := Load(id); err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(ArchiveDir(), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create archive: %w", err)
+	}
+	in, err := os.Open(Path(id))
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive comparison: %w", err)
+	}
+	defer in.Close()
+
+	path := filepath.Join(ArchiveDir(), id+".json.gz")
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive comparison: %w", err)
+	}
+	zw := gzip.NewWriter(out)
+	zw.Name = id + ".json"
+	_, err = io.Copy(zw, in)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, fmt.Errorf("failed to archive comparison: %w", err)
+	}
+	in.Close()
+	if err := os.Remove(Path(id)); err != nil {
+		return 0, fmt.Errorf("failed to archive comparison: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive comparison: %w", err)
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,265 @@
+// Package comparison asks several AI models the same request, so their
+// answers can be compared side by side
+package comparison
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// Dir is where comparisons are saved; main points it into the configured data directory
+var Dir = "comparisons"
+
+// Result statuses
+const (
+	StatusOK         = "ok"
+	StatusError      = "error"       // the request failed
+	StatusTimeout    = "timeout"     // no answer within the time limit
+	StatusParseError = "parse_error" // the reply held no command that runs
+)
+
+// DefaultTimeout limits each model's request unless Run is given another limit
+const DefaultTimeout = 90 * time.Second
+
+// CommandGenerator asks a model for commands that carry out a request on a
+// pattern, returning its reply as written too; *ai.Client implements it
+type CommandGenerator interface {
+	GenerateCommandsWithModel(ctx context.Context, prompt string, p *sequence.Pattern, model string) ([]string, string, error)
+}
+
+// Comparison is a request put to several models, each possibly several times
+type Comparison struct {
+	ID      string                `json:"id"`
+	Prompt  string                `json:"prompt"`
+	Created time.Time             `json:"created"`
+	Pattern *sequence.PatternFile `json:"pattern"` // the pattern the request was made on
+	Models  []string              `json:"models"`
+	Runs    int                   `json:"runs"`
+	Results []Result              `json:"results"`         // by model, then run, unless shuffled for a blind comparison
+	Blind   bool                  `json:"blind,omitempty"` // results are named by label only until revealed
+	Batch   string                `json:"batch,omitempty"` // the prompt file of a batch it was made in
+}
+
+// Result is one model's answer
+type Result struct {
+	Model     string   `json:"model"`
+	Run       int      `json:"run"` // 1 for the first time the model was asked
+	Status    string   `json:"status"`
+	Commands  []string `json:"commands,omitempty"`
+	Raw       string   `json:"raw,omitempty"` // reply as written
+	Error     string   `json:"error,omitempty"`
+	LatencyMs int64    `json:"latency_ms"`
+
+	// Filled in by the caller running the commands on a copy of the pattern
+	Pattern *sequence.PatternFile `json:"result_pattern,omitempty"`
+	Failed  []string              `json:"failed,omitempty"` // commands that failed, with their errors
+
+	Ratings map[string]int `json:"ratings,omitempty"` // 1-5 per criterion, see Rate
+}
+
+// Run asks each model runs times, all at once and each request within its
+// own timeout (0 for DefaultTimeout), so a slow model doesn't hold up the
+// others. Results come back by model in the order given, then by run;
+// cancelling ctx stops the requests still open.
+func Run(ctx context.Context, gen CommandGenerator, prompt string, p *sequence.Pattern, models []string, runs int, timeout time.Duration) *Comparison {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	runs = max(runs, 1)
+	c := &Comparison{
+		ID:      newID(),
+		Prompt:  prompt,
+		Created: time.Now(),
+		Pattern: p.ToPatternFile(""),
+		Models:  models,
+		Runs:    runs,
+		Results: make([]Result, len(models)*runs),
+	}
+	var wg sync.WaitGroup
+	for i := range c.Results {
+		model, run := models[i/runs], i%runs+1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Results[i] = runOne(ctx, gen, prompt, p, model, timeout)
+			c.Results[i].Run = run
+		}()
+	}
+	wg.Wait()
+	return c
+}
+
+// runOne asks one model
+func runOne(ctx context.Context, gen CommandGenerator, prompt string, p *sequence.Pattern, model string, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	commands, raw, err := gen.GenerateCommandsWithModel(ctx, prompt, p, model)
+	r := Result{Model: model, Commands: commands, Raw: raw, LatencyMs: time.Since(start).Milliseconds()}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		r.Status, r.Error = StatusTimeout, "no answer within "+timeout.String()
+	case err != nil:
+		r.Status, r.Error = StatusError, err.Error()
+	case len(commands) == 0:
+		r.Status = StatusParseError
+	default:
+		r.Status = StatusOK
+	}
+	return r
+}
+
+// Blindfold shuffles the results, so their labels don't give the models
+// away, and hides the models until the comparison is revealed
+func (c *Comparison) Blindfold() {
+	rand.Shuffle(len(c.Results), func(i, j int) {
+		c.Results[i], c.Results[j] = c.Results[j], c.Results[i]
+	})
+	c.Blind = true
+}
+
+// Label names result i by letter: A, B, ..., Z, AA, AB, ...
+func Label(i int) string {
+	label := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		label = string(rune('A'+(i-1)%26)) + label
+	}
+	return label
+}
+
+// Find returns the index of the result named by its label ("b"), its model
+// ("claude-haiku-4-5", or part of it like "haiku") or its model and run
+// ("haiku#2"); a model alone means its first run
+func (c *Comparison) Find(name string) (int, error) {
+	for i := range c.Results {
+		if strings.EqualFold(name, Label(i)) {
+			return i, nil
+		}
+	}
+	if c.Blind {
+		return 0, fmt.Errorf("no result %q in comparison %s (it is blind: pick results by label)", name, c.ID)
+	}
+	model, run := name, 1
+	if m, r, found := strings.Cut(name, "#"); found {
+		n, err := strconv.Atoi(r)
+		if err != nil {
+			return 0, fmt.Errorf("invalid run in %q (use <model>#<run>)", name)
+		}
+		model, run = m, n
+	}
+	found := -1
+	for i, r := range c.Results {
+		if r.Run != run || !strings.Contains(r.Model, model) {
+			continue
+		}
+		if r.Model == model {
+			return i, nil
+		}
+		if found >= 0 && c.Results[found].Model != r.Model {
+			return 0, fmt.Errorf("%q matches both %s and %s", name, c.Results[found].Model, r.Model)
+		}
+		found = i
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("no result %q in comparison %s", name, c.ID)
+	}
+	return found, nil
+}
+
+// newID names a comparison by the time it is made, e.g. "20250301-142233",
+// adding a counter if one of that name is already saved
+func newID() string {
+	id := time.Now().Format("20060102-150405")
+	for n := 2; ; n++ {
+		if _, err := os.Stat(Path(id)); os.IsNotExist(err) {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), n)
+	}
+}
+
+// Path returns the file a comparison is saved in
+func Path(id string) string {
+	return filepath.Join(Dir, id+".json")
+}
+
+// Save saves the comparison to a JSON file in Dir
+func (c *Comparison) Save() error {
+	if err := os.MkdirAll(Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create comparisons directory: %w", err)
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal comparison: %w", err)
+	}
+	if err := os.WriteFile(Path(c.ID), data, 0644); err != nil {
+		return fmt.Errorf("failed to write comparison file: %w", err)
+	}
+	return nil
+}
+
+// Load loads a comparison from Dir
+func Load(id string) (*Comparison, error) {
+	if strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("invalid comparison id %q", id)
+	}
+	data, err := os.ReadFile(Path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("comparison '%s' not found", id)
+		}
+		return nil, fmt.Errorf("failed to read comparison file: %w", err)
+	}
+	var c Comparison
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse comparison file: %w", err)
+	}
+	return &c, nil
+}
+
+// Batched returns the prompts already compared in a batch
+func Batched(batch string) (map[string]bool, error) {
+	all, err := LoadAll()
+	if err != nil {
+		return nil, err
+	}
+	done := map[string]bool{}
+	for _, c := range all {
+		if c.Batch == batch {
+			done[c.Prompt] = true
+		}
+	}
+	return done, nil
+}
+
+// List returns the IDs of all saved comparisons, oldest first
+func List() ([]string, error) {
+	entries, err := os.ReadDir(Dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read comparisons directory: %w", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() && id != rankingsID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
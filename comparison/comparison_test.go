@@ -0,0 +1,274 @@
+package comparison
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// fakeGenerator answers per model after a delay
+type fakeGenerator struct {
+	delays  map[string]time.Duration
+	replies map[string]string
+}
+
+func (f fakeGenerator) GenerateCommandsWithModel(ctx context.Context, prompt string, p *sequence.Pattern, model string) ([]string, string, error) {
+	select {
+	case <-time.After(f.delays[model]):
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+	reply, ok := f.replies[model]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown model %q", model)
+	}
+	if reply == "" {
+		return nil, "I'd make it darker.", nil
+	}
+	return []string{reply}, reply, nil
+}
+
+func TestRun(t *testing.T) {
+	gen := fakeGenerator{
+		delays:  map[string]time.Duration{"slow": time.Second, "fast": 10 * time.Millisecond, "chatty": 20 * time.Millisecond},
+		replies: map[string]string{"slow": "set 1 C2", "fast": "set 1 D2", "chatty": ""},
+	}
+	models := []string{"slow", "fast", "chatty", "missing"}
+
+	start := time.Now()
+	c := Run(context.Background(), gen, "darker", sequence.New(16), models, 1, 200*time.Millisecond)
+	results := c.Results
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Run took %s, want the models asked at once", elapsed)
+	}
+
+	want := []string{StatusTimeout, StatusOK, StatusParseError, StatusError}
+	for i, r := range results {
+		if r.Model != models[i] || r.Status != want[i] {
+			t.Errorf("result %d = %s %s, want %s %s", i, r.Model, r.Status, models[i], want[i])
+		}
+	}
+	if results[1].Commands[0] != "set 1 D2" {
+		t.Errorf("fast commands = %q", results[1].Commands)
+	}
+	if results[2].Raw != "I'd make it darker." {
+		t.Errorf("parse error should keep the reply, got %q", results[2].Raw)
+	}
+}
+
+func TestRunsAndStorage(t *testing.T) {
+	origDir := Dir
+	defer func() { Dir = origDir }()
+	Dir = t.TempDir()
+
+	gen := fakeGenerator{replies: map[string]string{"a": "set 1 C2", "b": "set 1 D2"}}
+	c := Run(context.Background(), gen, "darker", sequence.New(16), []string{"a", "b"}, 3, 0)
+	if len(c.Results) != 6 {
+		t.Fatalf("got %d results, want 2 models x 3 runs", len(c.Results))
+	}
+	for i, r := range c.Results {
+		if wantModel, wantRun := []string{"a", "b"}[i/3], i%3+1; r.Model != wantModel || r.Run != wantRun {
+			t.Errorf("result %d = %s run %d, want %s run %d", i, r.Model, r.Run, wantModel, wantRun)
+		}
+	}
+
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	again := Run(context.Background(), gen, "brighter", sequence.New(16), []string{"a"}, 1, 0)
+	if again.ID == c.ID {
+		t.Errorf("second comparison reuses ID %s", c.ID)
+	}
+	if err := again.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(c.ID)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.Prompt != "darker" || loaded.Runs != 3 || len(loaded.Results) != 6 || loaded.Results[4].Commands[0] != "set 1 D2" {
+		t.Errorf("loaded = %+v", loaded)
+	}
+	if ids, err := List(); err != nil || len(ids) != 2 || ids[0] != c.ID {
+		t.Errorf("List() = %v, %v", ids, err)
+	}
+	for _, tt := range []struct {
+		name string
+		want int
+	}{
+		{"A", 0}, {"f", 5}, {"b", 1}, {"a#3", 2}, {"b#2", 4}, {"b#4", -1}, {"a#x", -1}, {"G", -1}, // labels come before models
+	} {
+		got, err := loaded.Find(tt.name)
+		if tt.want < 0 && err == nil {
+			t.Errorf("Find(%q) = %d, want an error", tt.name, got)
+		} else if tt.want >= 0 && (err != nil || got != tt.want) {
+			t.Errorf("Find(%q) = %d, %v; want %d", tt.name, got, err, tt.want)
+		}
+	}
+	if Label(0) != "A" || Label(25) != "Z" || Label(26) != "AA" || Label(27) != "AB" {
+		t.Errorf("labels = %s %s %s %s", Label(0), Label(25), Label(26), Label(27))
+	}
+
+	loaded.Blindfold()
+	if _, err := loaded.Find("b#2"); err == nil || len(loaded.Results) != 6 {
+		t.Errorf("a blind comparison should only find labels, err = %v", err)
+	}
+
+	if _, err := Load("../secrets"); err == nil {
+		t.Error("Load with a path should fail")
+	}
+}
+
+func TestRankings(t *testing.T) {
+	origDir := Dir
+	defer func() { Dir = origDir }()
+	Dir = t.TempDir()
+
+	for _, vote := range []struct {
+		a, b  string
+		score float64
+	}{
+		{"a", "b", 1}, {"a", "c", 1}, {"b", "c", 0.5}, {"a", "a", 1}, // a model against itself doesn't count
+	} {
+		if err := Vote(vote.a, vote.b, vote.score); err != nil {
+			t.Fatalf("Vote(%s, %s): %v", vote.a, vote.b, err)
+		}
+	}
+	rankings, err := LoadRankings()
+	if err != nil || len(rankings) != 3 {
+		t.Fatalf("LoadRankings() = %+v, %v", rankings, err)
+	}
+	a := rankings[0]
+	if a.Model != "a" || a.Wins != 2 || a.Games() != 2 || math.Abs(a.Elo-(1500+16+32*(1-1/(1+math.Pow(10, -16.0/400))))) > 1e-9 {
+		t.Errorf("a = %+v", a)
+	}
+	total := 0.0
+	for _, r := range rankings {
+		total += r.Elo
+	}
+	if math.Abs(total-3*initialElo) > 1e-9 {
+		t.Errorf("Elo ratings should sum to %d, got %f", 3*initialElo, total)
+	}
+	if ids, err := List(); err != nil || len(ids) != 0 {
+		t.Errorf("List() = %v, %v; rankings aren't a comparison", ids, err)
+	}
+}
+
+func TestPruneAndArchive(t *testing.T) {
+	origDir := Dir
+	defer func() { Dir = origDir }()
+	Dir = t.TempDir()
+
+	for _, tt := range []struct {
+		age  string
+		want time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour}, {"2w", 14 * 24 * time.Hour}, {"12h", 12 * time.Hour}, {"xd", -1}, {"-3d", -1}, {"soon", -1},
+	} {
+		got, err := ParseAge(tt.age)
+		if tt.want < 0 && err == nil {
+			t.Errorf("ParseAge(%q) = %s, want an error", tt.age, got)
+		} else if tt.want >= 0 && (err != nil || got != tt.want) {
+			t.Errorf("ParseAge(%q) = %s, %v; want %s", tt.age, got, err, tt.want)
+		}
+	}
+
+	old := &Comparison{ID: "old", Prompt: strings.Repeat("darker ", 200), Created: time.Now().AddDate(0, 0, -40)}
+	recent := &Comparison{ID: "recent", Prompt: "brighter", Created: time.Now().AddDate(0, 0, -1)}
+	for _, c := range []*Comparison{old, recent} {
+		if err := c.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids, err := OlderThan(30 * 24 * time.Hour); err != nil || !reflect.DeepEqual(ids, []string{"old"}) {
+		t.Errorf("OlderThan(30d) = %v, %v", ids, err)
+	}
+
+	size, err := Size("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived, err := Archive("old")
+	if err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	if archived >= size {
+		t.Errorf("archive is %d bytes, the comparison %d", archived, size)
+	}
+	if total, err := ArchiveSize(); err != nil || total != archived {
+		t.Errorf("ArchiveSize() = %d, %v; want %d", total, err, archived)
+	}
+	if ids, err := List(); err != nil || !reflect.DeepEqual(ids, []string{"recent"}) {
+		t.Errorf("List() after archiving = %v, %v", ids, err)
+	}
+	if _, err := Archive("old"); err == nil {
+		t.Error("archiving twice should fail")
+	}
+
+	if err := Delete("recent"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := Load("recent"); err == nil {
+		t.Error("a deleted comparison should be gone")
+	}
+	if err := Delete("../archive"); err == nil {
+		t.Error("Delete with a path should fail")
+	}
+}
+
+func TestStats(t *testing.T) {
+	rated := func(model string, latency int64, ratings map[string]int) Result {
+		return Result{Model: model, Run: 1, Status: StatusOK, LatencyMs: latency, Ratings: ratings}
+	}
+	comparisons := []*Comparison{
+		{Results: []Result{
+			rated("a", 1000, map[string]int{"overall": 4, "groove": 5}),
+			rated("b", 3000, map[string]int{"overall": 2}),
+		}},
+		{Results: []Result{
+			rated("a", 2000, map[string]int{"overall": 3}),
+			rated("b", 4000, map[string]int{"overall": 3}), // a tie: no win
+			{Model: "b", Run: 2, Status: StatusTimeout, LatencyMs: 9000},
+		}},
+	}
+	if err := comparisons[0].Results[0].Rate("groove", 6); err == nil {
+		t.Error("a rating of 6 should fail")
+	}
+	if err := comparisons[0].Results[0].Rate("Groove!", 3); err == nil {
+		t.Error("an odd criterion should fail")
+	}
+
+	stats, criteria := Stats(comparisons)
+	if len(stats) != 2 || stats[0].Model != "a" || !reflect.DeepEqual(criteria, []string{"groove", "overall"}) {
+		t.Fatalf("Stats() = %+v, criteria %v", stats, criteria)
+	}
+	a, b := stats[0], stats[1]
+	if a.Answers != 2 || a.Wins != 1 || a.Ratings[Overall] != 3.5 || a.Rated["groove"] != 1 || a.MeanLatency != 1500*time.Millisecond {
+		t.Errorf("a = %+v", a)
+	}
+	if b.Answers != 3 || b.OK != 2 || b.Wins != 0 || b.Ratings[Overall] != 2.5 || b.MedianLatency != 4*time.Second {
+		t.Errorf("b = %+v", b)
+	}
+
+	var sb strings.Builder
+	if err := WriteCSV(&sb, stats, criteria); err != nil {
+		t.Fatal(err)
+	}
+	if want := "model,answers,ok,wins,mean latency,median latency,groove,overall\na,2,2,1,1.5s,2s,5.00,3.50\nb,3,2,0,5.3s,4s,,2.50\n"; sb.String() != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", sb.String(), want)
+	}
+	sb.Reset()
+	if err := WriteMarkdown(&sb, stats, criteria); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(sb.String(), "\n"); len(lines) != 5 || lines[1] != "| --- | --- | --- | --- | --- | --- | --- | --- |" || lines[2] != "| a | 2 | 2 | 1 | 1.5s | 2s | 5.00 | 3.50 |" {
+		t.Errorf("Markdown =\n%s", sb.String())
+	}
+}
@@ -0,0 +1,114 @@
+package comparison
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// rankingsID is the file in Dir keeping the Elo ratings, not a comparison
+const rankingsID = "rankings"
+
+// Elo parameters: every model starts at initialElo, and a vote moves the
+// two ratings by up to eloK points
+const (
+	initialElo = 1500
+	eloK       = 32
+)
+
+// Ranking is a model's Elo rating from head-to-head votes
+type Ranking struct {
+	Model  string  `json:"model"`
+	Elo    float64 `json:"elo"`
+	Wins   int     `json:"wins"`
+	Losses int     `json:"losses"`
+	Ties   int     `json:"ties"`
+}
+
+// Games returns the number of votes the model took part in
+func (r *Ranking) Games() int {
+	return r.Wins + r.Losses + r.Ties
+}
+
+// rankingsPath returns the file the rankings are saved in
+func rankingsPath() string {
+	return filepath.Join(Dir, rankingsID+".json")
+}
+
+// LoadRankings reads the Elo ratings, best first
+func LoadRankings() ([]*Ranking, error) {
+	data, err := os.ReadFile(rankingsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rankings: %w", err)
+	}
+	var rankings []*Ranking
+	if err := json.Unmarshal(data, &rankings); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", rankingsPath(), err)
+	}
+	return rankings, nil
+}
+
+// Vote records a head-to-head vote between two models: score is 1 if a
+// was better, 0 if b was, 0.5 for a tie. Both Elo ratings move by how
+// surprising the outcome was and the rankings are saved.
+func Vote(a, b string, score float64) error {
+	if a == b {
+		return nil // nothing to learn from a model against itself
+	}
+	rankings, err := LoadRankings()
+	if err != nil {
+		return err
+	}
+	ra, rb := findRanking(&rankings, a), findRanking(&rankings, b)
+	expected := 1 / (1 + math.Pow(10, (rb.Elo-ra.Elo)/400))
+	ra.Elo += eloK * (score - expected)
+	rb.Elo -= eloK * (score - expected)
+	switch score {
+	case 1:
+		ra.Wins++
+		rb.Losses++
+	case 0:
+		ra.Losses++
+		rb.Wins++
+	default:
+		ra.Ties++
+		rb.Ties++
+	}
+	return saveRankings(rankings)
+}
+
+// findRanking returns model's ranking, adding one at the initial rating if
+// it has none
+func findRanking(rankings *[]*Ranking, model string) *Ranking {
+	for _, r := range *rankings {
+		if r.Model == model {
+			return r
+		}
+	}
+	r := &Ranking{Model: model, Elo: initialElo}
+	*rankings = append(*rankings, r)
+	return r
+}
+
+func saveRankings(rankings []*Ranking) error {
+	sort.Slice(rankings, func(i, j int) bool { return rankings[i].Elo > rankings[j].Elo })
+	data, err := json.MarshalIndent(rankings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(Dir, 0755); err != nil {
+		return fmt.Errorf("failed to save rankings: %w", err)
+	}
+	if err := os.WriteFile(rankingsPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to save rankings: %w", err)
+	}
+	return nil
+}
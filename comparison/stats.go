@@ -0,0 +1,199 @@
+package comparison
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Overall is the criterion a rating counts for unless another is named
+const Overall = "overall"
+
+// criterionName restricts criteria to simple words like "groove" or "fit-to-prompt"
+var criterionName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Rate scores the result 1-5 for criterion, replacing an earlier rating
+func (r *Result) Rate(criterion string, score int) error {
+	if score < 1 || score > 5 {
+		return fmt.Errorf("rating must be 1-5, got %d", score)
+	}
+	if !criterionName.MatchString(criterion) {
+		return fmt.Errorf("invalid criterion %q (use a word like groove or harmony)", criterion)
+	}
+	if r.Ratings == nil {
+		r.Ratings = map[string]int{}
+	}
+	r.Ratings[criterion] = score
+	return nil
+}
+
+// score is the result's mean rating over all criteria (0 if unrated)
+func (r *Result) score() float64 {
+	if len(r.Ratings) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, rating := range r.Ratings {
+		sum += rating
+	}
+	return float64(sum) / float64(len(r.Ratings))
+}
+
+// ModelStats sums up one model's answers across comparisons
+type ModelStats struct {
+	Model         string
+	Answers       int                // requests made
+	OK            int                // answers whose commands ran
+	Wins          int                // comparisons where it scored highest, alone
+	MeanLatency   time.Duration      // over all answers
+	MedianLatency time.Duration      // over all answers
+	Ratings       map[string]float64 // mean rating per criterion
+	Rated         map[string]int     // ratings per criterion
+}
+
+// Stats sums up the comparisons per model, sorted by mean overall score
+// (best first), then by name. It also returns the criteria rated, sorted.
+func Stats(comparisons []*Comparison) ([]*ModelStats, []string) {
+	byModel := map[string]*ModelStats{}
+	latencies := map[string][]time.Duration{}
+	sums := map[string]map[string]int{}
+	for _, c := range comparisons {
+		for i := range c.Results {
+			r := &c.Results[i]
+			s := byModel[r.Model]
+			if s == nil {
+				s = &ModelStats{Model: r.Model, Ratings: map[string]float64{}, Rated: map[string]int{}}
+				byModel[r.Model], sums[r.Model] = s, map[string]int{}
+			}
+			s.Answers++
+			if r.Status == StatusOK {
+				s.OK++
+			}
+			latencies[r.Model] = append(latencies[r.Model], time.Duration(r.LatencyMs)*time.Millisecond)
+			for criterion, rating := range r.Ratings {
+				sums[r.Model][criterion] += rating
+				s.Rated[criterion]++
+			}
+		}
+		if winner := c.winner(); winner != "" {
+			byModel[winner].Wins++
+		}
+	}
+
+	var stats []*ModelStats
+	criteria := map[string]bool{}
+	for model, s := range byModel {
+		for criterion, sum := range sums[model] {
+			s.Ratings[criterion] = float64(sum) / float64(s.Rated[criterion])
+			criteria[criterion] = true
+		}
+		l := latencies[model]
+		slices.Sort(l)
+		var total time.Duration
+		for _, d := range l {
+			total += d
+		}
+		s.MeanLatency, s.MedianLatency = total/time.Duration(len(l)), l[len(l)/2]
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if a, b := stats[i].Ratings[Overall], stats[j].Ratings[Overall]; a != b {
+			return a > b
+		}
+		return stats[i].Model < stats[j].Model
+	})
+	names := make([]string, 0, len(criteria))
+	for criterion := range criteria {
+		names = append(names, criterion)
+	}
+	sort.Strings(names)
+	return stats, names
+}
+
+// winner returns the model of the best-rated result, or "" if none is
+// rated or the best score is shared between models
+func (c *Comparison) winner() string {
+	best, winner := 0.0, ""
+	for _, r := range c.Results {
+		switch score := r.score(); {
+		case score > best:
+			best, winner = score, r.Model
+		case score == best && score > 0 && r.Model != winner:
+			winner = ""
+		}
+	}
+	return winner
+}
+
+// statsHeader names the columns of WriteCSV and WriteMarkdown
+func statsHeader(criteria []string) []string {
+	return append([]string{"model", "answers", "ok", "wins", "mean latency", "median latency"}, criteria...)
+}
+
+// statsRow formats one model's stats as the columns of statsHeader
+func statsRow(s *ModelStats, criteria []string) []string {
+	row := []string{
+		s.Model,
+		strconv.Itoa(s.Answers),
+		strconv.Itoa(s.OK),
+		strconv.Itoa(s.Wins),
+		s.MeanLatency.Round(100 * time.Millisecond).String(),
+		s.MedianLatency.Round(100 * time.Millisecond).String(),
+	}
+	for _, criterion := range criteria {
+		if s.Rated[criterion] == 0 {
+			row = append(row, "")
+		} else {
+			row = append(row, strconv.FormatFloat(s.Ratings[criterion], 'f', 2, 64))
+		}
+	}
+	return row
+}
+
+// WriteCSV writes the stats as CSV, one row per model
+func WriteCSV(w io.Writer, stats []*ModelStats, criteria []string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(statsHeader(criteria))
+	for _, s := range stats {
+		cw.Write(statsRow(s, criteria))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteMarkdown writes the stats as a Markdown table, one row per model
+func WriteMarkdown(w io.Writer, stats []*ModelStats, criteria []string) error {
+	header := statsHeader(criteria)
+	lines := []string{
+		"| " + strings.Join(header, " | ") + " |",
+		"|" + strings.Repeat(" --- |", len(header)),
+	}
+	for _, s := range stats {
+		lines = append(lines, "| "+strings.Join(statsRow(s, criteria), " | ")+" |")
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// LoadAll loads every saved comparison, oldest first
+func LoadAll() ([]*Comparison, error) {
+	ids, err := List()
+	if err != nil {
+		return nil, err
+	}
+	comparisons := make([]*Comparison, 0, len(ids))
+	for _, id := range ids {
+		c, err := Load(id)
+		if err != nil {
+			return nil, err
+		}
+		comparisons = append(comparisons, c)
+	}
+	return comparisons, nil
+}
@@ -0,0 +1,338 @@
+// Package config loads user defaults from ~/.config/interplay/config.toml,
+// with INTERPLAY_* environment variables overriding the file.
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Config holds startup defaults. Zero values mean "use the built-in default".
+type Config struct {
+	Port             string  // MIDI output port name
+	Channel          int     // MIDI channel 1-16
+	Tempo            float64 // BPM of the initial pattern, may be fractional
+	Length           int     // steps in the initial pattern
+	AIModel          string  // AI model: claude-..., gpt-..., gemini-... or ollama:<name>
+	DataDir          string  // directory holding patterns/ and macros.json
+	Device           string  // device profile used at startup
+	Verbose          bool    // start with verbose step output
+	Offline          bool    // AI mode uses only a local model
+	AITimeout        int     // seconds an AI request may take (0 for the built-in default)
+	AIModels         string  // extra model IDs offered by 'model', comma-separated, see CustomModels
+	AIAllow          string  // destructive commands the AI may run, comma-separated, see AIAllowed
+	OctaveConvention string  // octave convention of note names: roland (C4 = 60) or yamaha (C3 = 60)
+
+	// Generation parameters for every AI model ('model-config' sets them per model)
+	AITemperature float64 // negative for the provider's default
+	AIMaxTokens   int     // reply limit in tokens (0 for each request's own)
+	AIThinking    int     // Claude's extended thinking budget in tokens (0 for off)
+
+	// Throttling per AI provider: a number for all, or "claude=50, gemini=15"
+	AIRPM         string // requests per minute
+	AIConcurrency string // requests in flight at once
+}
+
+// Default returns the built-in defaults
+func Default() Config {
+	return Config{
+		Channel:       1,
+		Tempo:         80,
+		Length:        48,
+		AITemperature: -1,
+	}
+}
+
+// Path returns the config file location: $INTERPLAY_CONFIG if set, otherwise
+// $XDG_CONFIG_HOME/interplay/config.toml (default ~/.config/interplay/config.toml).
+// Returns "" if no location can be determined.
+func Path() string {
+	if path := os.Getenv("INTERPLAY_CONFIG"); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "interplay", "config.toml")
+}
+
+// Load returns the defaults overridden by the config file at path (a missing
+// file is fine) and then by environment variables
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil && !os.IsNotExist(err) {
+			return cfg, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err == nil {
+			defer f.Close()
+			if err := cfg.parse(f); err != nil {
+				return cfg, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// parse reads 'key = value' lines (a flat subset of TOML): strings in double
+// or single quotes, integers, booleans, and # comments
+func (c *Config) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return fmt.Errorf("line %d: tables are not supported, use top-level keys", lineNum)
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		key = strings.TrimSpace(key)
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if err := c.Set(key, value); err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// parseValue decodes a TOML scalar, returning strings unquoted and other
+// values as written (with any trailing comment removed)
+func parseValue(raw string) (string, error) {
+	if raw == "" {
+		return "", fmt.Errorf("missing value")
+	}
+
+	if quote := raw[0]; quote == '"' || quote == '\'' {
+		end := strings.IndexByte(raw[1:], quote)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string: %s", raw)
+		}
+		rest := strings.TrimSpace(raw[end+2:])
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected text after string: %s", rest)
+		}
+		value := raw[1 : end+1]
+		if quote == '"' {
+			value = strings.ReplaceAll(value, `\\`, `\`)
+		}
+		return value, nil
+	}
+
+	if i := strings.IndexByte(raw, '#'); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	return raw, nil
+}
+
+// Set assigns a setting by its config file key (e.g., "tempo"), as used
+// for the config file, environment variables, and command-line flags
+func (c *Config) Set(key, value string) error {
+	var err error
+	switch key {
+	case "port":
+		c.Port = value
+	case "channel":
+		c.Channel, err = parseInt(key, value)
+	case "tempo":
+		c.Tempo, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			err = fmt.Errorf("tempo must be a number, got %q", value)
+		}
+	case "length":
+		c.Length, err = parseInt(key, value)
+	case "ai_model":
+		c.AIModel = value
+	case "data_dir":
+		c.DataDir = expandHome(value)
+	case "device":
+		c.Device = value
+	case "verbose":
+		c.Verbose, err = strconv.ParseBool(value)
+		if err != nil {
+			err = fmt.Errorf("verbose must be true or false, got %q", value)
+		}
+	case "offline":
+		c.Offline, err = strconv.ParseBool(value)
+		if err != nil {
+			err = fmt.Errorf("offline must be true or false, got %q", value)
+		}
+	case "ai_timeout":
+		c.AITimeout, err = parseInt(key, value)
+	case "ai_models":
+		c.AIModels = value
+	case "ai_allow":
+		c.AIAllow = value
+	case "octave_convention":
+		c.OctaveConvention = value
+	case "ai_temperature":
+		c.AITemperature, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			err = fmt.Errorf("ai_temperature must be a number, got %q", value)
+		}
+	case "ai_max_tokens":
+		c.AIMaxTokens, err = parseInt(key, value)
+	case "ai_thinking":
+		c.AIThinking, err = parseInt(key, value)
+	case "ai_rpm":
+		c.AIRPM = value
+		_, err = ParseLimits(key, value)
+	case "ai_concurrency":
+		c.AIConcurrency = value
+		_, err = ParseLimits(key, value)
+	default:
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+	return err
+}
+
+func parseInt(key, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number, got %q", key, value)
+	}
+	return n, nil
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// envKeys maps environment variables to config keys
+var envKeys = []struct{ env, key string }{
+	{"INTERPLAY_PORT", "port"},
+	{"INTERPLAY_CHANNEL", "channel"},
+	{"INTERPLAY_TEMPO", "tempo"},
+	{"INTERPLAY_LENGTH", "length"},
+	{"INTERPLAY_AI_MODEL", "ai_model"},
+	{"INTERPLAY_DATA_DIR", "data_dir"},
+	{"INTERPLAY_DEVICE", "device"},
+	{"INTERPLAY_VERBOSE", "verbose"},
+	{"INTERPLAY_OFFLINE", "offline"},
+	{"INTERPLAY_AI_TIMEOUT", "ai_timeout"},
+	{"INTERPLAY_AI_MODELS", "ai_models"},
+	{"INTERPLAY_AI_ALLOW", "ai_allow"},
+	{"INTERPLAY_OCTAVE_CONVENTION", "octave_convention"},
+	{"INTERPLAY_AI_TEMPERATURE", "ai_temperature"},
+	{"INTERPLAY_AI_MAX_TOKENS", "ai_max_tokens"},
+	{"INTERPLAY_AI_THINKING", "ai_thinking"},
+	{"INTERPLAY_AI_RPM", "ai_rpm"},
+	{"INTERPLAY_AI_CONCURRENCY", "ai_concurrency"},
+}
+
+// applyEnv overrides settings from INTERPLAY_* environment variables
+func (c *Config) applyEnv() error {
+	for _, e := range envKeys {
+		if value, ok := os.LookupEnv(e.env); ok && value != "" {
+			if err := c.Set(e.key, value); err != nil {
+				return fmt.Errorf("%s: %w", e.env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks that settings are in range
+func (c Config) Validate() error {
+	if c.Channel < 1 || c.Channel > 16 {
+		return fmt.Errorf("channel must be 1-16, got %d", c.Channel)
+	}
+	if !(c.Tempo >= 20 && c.Tempo <= 300) {
+		return fmt.Errorf("tempo must be 20-300, got %g", c.Tempo)
+	}
+	if c.Length < 1 {
+		return fmt.Errorf("length must be positive, got %d", c.Length)
+	}
+	if c.AITimeout < 0 {
+		return fmt.Errorf("ai_timeout must not be negative, got %d", c.AITimeout)
+	}
+	if c.AITemperature > 2 {
+		return fmt.Errorf("ai_temperature must be 0-2, got %g", c.AITemperature)
+	}
+	if c.AIMaxTokens < 0 {
+		return fmt.Errorf("ai_max_tokens must not be negative, got %d", c.AIMaxTokens)
+	}
+	if c.AIThinking != 0 && c.AIThinking < 1024 {
+		return fmt.Errorf("ai_thinking must be 0 (off) or at least 1024 tokens, got %d", c.AIThinking)
+	}
+	for _, model := range strings.Split(c.AIModels, ",") {
+		if model = strings.TrimSpace(model); strings.ContainsAny(model, " \t") {
+			return fmt.Errorf("ai_models must be model IDs separated by commas, got %q", c.AIModels)
+		}
+	}
+	return nil
+}
+
+// ParseLimits reads a per-provider limit like ai_rpm: "50" for every
+// provider (returned under "*"), or "claude=50, gemini=15"
+func ParseLimits(key, value string) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, number, found := strings.Cut(item, "=")
+		if !found {
+			name, number = "*", item
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(number))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s must be a number, or provider=number pairs like \"claude=50, gemini=15\", got %q", key, value)
+		}
+		limits[strings.TrimSpace(name)] = n
+	}
+	return limits, nil
+}
+
+// CustomModels returns the model IDs listed in ai_models
+func (c Config) CustomModels() []string {
+	return splitList(c.AIModels)
+}
+
+// AIAllowed returns the commands listed in ai_allow
+func (c Config) AIAllowed() []string {
+	return splitList(c.AIAllow)
+}
+
+// splitList splits a comma-separated setting, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets INTERPLAY_* variables for the duration of a test
+func clearEnv(t *testing.T) {
+	for _, e := range envKeys {
+		t.Setenv(e.env, "")
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load(filepath.Join(t.TempDir(), "missing.toml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg != Default() {
+		t.Errorf("Load() = %+v, want defaults %+v", cfg, Default())
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "config.toml")
+	content := `# Interplay defaults
+port = "Elektron Digitone"   # my synth
+channel = 2
+tempo = 140
+length = 32
+ai_model = 'claude-sonnet-4-5'
+data_dir = "/tmp/interplay"
+device = "minilogue"
+verbose = true
+offline = true
+ai_timeout = 120
+ai_models = "claude-sonnet-9, ollama:qwen3"
+ai_allow = "clear, length"
+octave_convention = "yamaha"
+ai_temperature = 0.3
+ai_max_tokens = 2048
+ai_thinking = 4000
+ai_rpm = "40, gemini=15"
+ai_concurrency = 2
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := Config{
+		Port:      "Elektron Digitone",
+		Channel:   2,
+		Tempo:     140,
+		Length:    32,
+		AIModel:   "claude-sonnet-4-5",
+		DataDir:   "/tmp/interplay",
+		Device:    "minilogue",
+		Verbose:   true,
+		Offline:   true,
+		AITimeout: 120,
+		AIModels:  "claude-sonnet-9, ollama:qwen3",
+		AIAllow:   "clear, length",
+
+		OctaveConvention: "yamaha",
+
+		AITemperature: 0.3,
+		AIMaxTokens:   2048,
+		AIThinking:    4000,
+		AIRPM:         "40, gemini=15",
+		AIConcurrency: "2",
+	}
+	if cfg != want {
+		t.Errorf("Load() = %+v, want %+v", cfg, want)
+	}
+	if got := cfg.CustomModels(); len(got) != 2 || got[0] != "claude-sonnet-9" || got[1] != "ollama:qwen3" {
+		t.Errorf("CustomModels() = %q", got)
+	}
+	if got := cfg.AIAllowed(); len(got) != 2 || got[0] != "clear" || got[1] != "length" {
+		t.Errorf("AIAllowed() = %q", got)
+	}
+
+	// Environment overrides the file
+	t.Setenv("INTERPLAY_TEMPO", "95")
+	t.Setenv("INTERPLAY_PORT", "IAC Driver Bus 1")
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Tempo != 95 || cfg.Port != "IAC Driver Bus 1" || cfg.Channel != 2 {
+		t.Errorf("env override: got tempo=%g port=%q channel=%d", cfg.Tempo, cfg.Port, cfg.Channel)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		wantErr string
+	}{
+		{"unknown key", "colour = 1\n", nil, "line 1: unknown setting: colour"},
+		{"bad number", "tempo = fast\n", nil, "tempo must be a number"},
+		{"bad bool", "verbose = maybe\n", nil, "verbose must be true or false"},
+		{"bad offline", "offline = 1x\n", nil, "offline must be true or false"},
+		{"missing equals", "\ntempo 120\n", nil, "line 2: expected key = value"},
+		{"table", "[midi]\n", nil, "tables are not supported"},
+		{"unterminated string", "port = \"Elektron\n", nil, "unterminated string"},
+		{"out of range", "channel = 17\n", nil, "channel must be 1-16"},
+		{"negative timeout", "ai_timeout = -5\n", nil, "ai_timeout must not be negative"},
+		{"hot temperature", "ai_temperature = 2.5\n", nil, "ai_temperature must be 0-2"},
+		{"small thinking budget", "ai_thinking = 100\n", nil, "ai_thinking must be 0 (off) or at least 1024"},
+		{"bad limits", "ai_rpm = \"claude=lots\"\n", nil, "ai_rpm must be a number"},
+		{"bad model list", "ai_models = \"claude-x gpt-y\"\n", nil, "ai_models must be model IDs"},
+		{"bad env", "", map[string]string{"INTERPLAY_LENGTH": "x"}, "INTERPLAY_LENGTH: length must be a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	t.Setenv("INTERPLAY_CONFIG", "/etc/interplay.toml")
+	if got := Path(); got != "/etc/interplay.toml" {
+		t.Errorf("Path() = %q, want INTERPLAY_CONFIG value", got)
+	}
+
+	t.Setenv("INTERPLAY_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", "/home/me/.cfg")
+	if got := Path(); got != filepath.Join("/home/me/.cfg", "interplay", "config.toml") {
+		t.Errorf("Path() = %q, want under XDG_CONFIG_HOME", got)
+	}
+}
@@ -0,0 +1,218 @@
+// Package device loads synth profiles: JSON files naming a synth's useful
+// CC and NRPN parameters with their ranges. Profiles power symbolic
+// automation ('cc cutoff 90') and tell the AI about the target instrument.
+package device
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Dir holds user profiles (<name>.json); they take precedence over built-in ones
+var Dir = "devices"
+
+//go:embed profiles/*.json
+var builtinProfiles embed.FS
+
+// Profile describes a synthesizer
+type Profile struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  []Parameter `json:"parameters"`
+}
+
+// Parameter is a CC or NRPN parameter. Range is [min, max]; it defaults to
+// the full range (0-127 for CC, 0-16383 for NRPN).
+type Parameter struct {
+	Name        string `json:"name"`
+	CC          *int   `json:"cc,omitempty"`
+	NRPN        *int   `json:"nrpn,omitempty"`
+	Range       []int  `json:"range,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Min returns the lowest accepted value
+func (p Parameter) Min() int {
+	if len(p.Range) == 2 {
+		return p.Range[0]
+	}
+	return 0
+}
+
+// Max returns the highest accepted value
+func (p Parameter) Max() int {
+	if len(p.Range) == 2 {
+		return p.Range[1]
+	}
+	if p.NRPN != nil {
+		return 16383
+	}
+	return 127
+}
+
+// Address describes how the parameter is sent, e.g. "CC 43" or "NRPN 1025"
+func (p Parameter) Address() string {
+	if p.NRPN != nil {
+		return fmt.Sprintf("NRPN %d", *p.NRPN)
+	}
+	return fmt.Sprintf("CC %d", *p.CC)
+}
+
+// Parse decodes and validates a profile
+func Parse(data []byte) (*Profile, error) {
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid device profile: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid device profile: %w", err)
+	}
+	return &p, nil
+}
+
+// validate checks names, addresses and ranges
+func (p *Profile) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if len(p.Parameters) == 0 {
+		return fmt.Errorf("no parameters")
+	}
+
+	seen := map[string]bool{}
+	for i := range p.Parameters {
+		param := &p.Parameters[i]
+		param.Name = strings.ToLower(param.Name)
+		if !isParamName(param.Name) {
+			return fmt.Errorf("invalid parameter name %q (use letters, digits, - and _, starting with a letter)", param.Name)
+		}
+		if seen[param.Name] {
+			return fmt.Errorf("duplicate parameter %q", param.Name)
+		}
+		seen[param.Name] = true
+
+		switch {
+		case (param.CC == nil) == (param.NRPN == nil):
+			return fmt.Errorf("parameter %q needs either cc or nrpn", param.Name)
+		case param.CC != nil && (*param.CC < 0 || *param.CC > 127):
+			return fmt.Errorf("parameter %q: cc must be 0-127", param.Name)
+		case param.NRPN != nil && (*param.NRPN < 0 || *param.NRPN > 16383):
+			return fmt.Errorf("parameter %q: nrpn must be 0-16383", param.Name)
+		}
+
+		if param.Range != nil {
+			full := Parameter{CC: param.CC, NRPN: param.NRPN}
+			if len(param.Range) != 2 || param.Range[0] > param.Range[1] || param.Range[0] < 0 || param.Range[1] > full.Max() {
+				return fmt.Errorf("parameter %q: range must be [min, max] within 0-%d", param.Name, full.Max())
+			}
+		}
+	}
+	return nil
+}
+
+// isParamName reports whether name is a valid parameter name
+func isParamName(name string) bool {
+	if name == "" || !unicode.IsLetter(rune(name[0])) {
+		return false
+	}
+	for _, r := range name {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Load reads a profile by name from Dir, falling back to the built-in profiles
+func Load(name string) (*Profile, error) {
+	name = strings.ToLower(name)
+	if strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid device name: %s", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(Dir, name+".json"))
+	if os.IsNotExist(err) {
+		data, err = builtinProfiles.ReadFile("profiles/" + name + ".json")
+		if err != nil {
+			return nil, fmt.Errorf("device profile '%s' not found (see 'device list')", name)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read device profile: %w", err)
+	}
+	return Parse(data)
+}
+
+// List returns the names of all available profiles, built-in and user
+func List() ([]string, error) {
+	names := map[string]bool{}
+
+	builtin, _ := builtinProfiles.ReadDir("profiles")
+	for _, entry := range builtin {
+		names[strings.TrimSuffix(entry.Name(), ".json")] = true
+	}
+
+	entries, err := os.ReadDir(Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read devices directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+			names[strings.ToLower(strings.TrimSuffix(entry.Name(), ".json"))] = true
+		}
+	}
+
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// Find returns the parameter with the given name (case-insensitive)
+func (p *Profile) Find(name string) (Parameter, bool) {
+	name = strings.ToLower(name)
+	for _, param := range p.Parameters {
+		if param.Name == name {
+			return param, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// ForCC returns the parameter sent on a CC number
+func (p *Profile) ForCC(cc int) (Parameter, bool) {
+	for _, param := range p.Parameters {
+		if param.CC != nil && *param.CC == cc {
+			return param, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// Describe summarizes the profile for an AI prompt
+func (p *Profile) Describe() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "TARGET INSTRUMENT: %s", p.Name)
+	if p.Description != "" {
+		fmt.Fprintf(&sb, " (%s)", p.Description)
+	}
+	sb.WriteString("\nUse these parameter names in place of CC numbers, e.g. 'cc-step 1 <name> <value>'. Stay within each range.\n")
+	for _, param := range p.Parameters {
+		if param.NRPN != nil {
+			continue // NRPN parameters can't be automated with commands
+		}
+		fmt.Fprintf(&sb, "- %s: %s, %d-%d", param.Name, param.Address(), param.Min(), param.Max())
+		if param.Description != "" {
+			fmt.Fprintf(&sb, " (%s)", param.Description)
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,112 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"valid", `{"name": "x", "parameters": [{"name": "Cutoff", "cc": 74}, {"name": "fine", "nrpn": 1000, "range": [0, 1000]}]}`, ""},
+		{"bad json", `{"name": `, "invalid device profile"},
+		{"no name", `{"parameters": [{"name": "a", "cc": 1}]}`, "missing name"},
+		{"no parameters", `{"name": "x"}`, "no parameters"},
+		{"bad parameter name", `{"name": "x", "parameters": [{"name": "1st", "cc": 1}]}`, "invalid parameter name"},
+		{"duplicate", `{"name": "x", "parameters": [{"name": "a", "cc": 1}, {"name": "A", "cc": 2}]}`, "duplicate parameter"},
+		{"no address", `{"name": "x", "parameters": [{"name": "a"}]}`, "needs either cc or nrpn"},
+		{"both addresses", `{"name": "x", "parameters": [{"name": "a", "cc": 1, "nrpn": 1}]}`, "needs either cc or nrpn"},
+		{"cc out of range", `{"name": "x", "parameters": [{"name": "a", "cc": 128}]}`, "cc must be 0-127"},
+		{"nrpn out of range", `{"name": "x", "parameters": [{"name": "a", "nrpn": 16384}]}`, "nrpn must be 0-16383"},
+		{"range too wide", `{"name": "x", "parameters": [{"name": "a", "cc": 1, "range": [0, 200]}]}`, "range must be"},
+		{"range reversed", `{"name": "x", "parameters": [{"name": "a", "cc": 1, "range": [10, 5]}]}`, "range must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				if param, ok := p.Find("CUTOFF"); !ok || *param.CC != 74 || param.Max() != 127 {
+					t.Errorf("Find(CUTOFF) = %+v, %v", param, ok)
+				}
+				if param, _ := p.Find("fine"); param.Max() != 1000 || param.Address() != "NRPN 1000" {
+					t.Errorf("fine: max %d, address %s", param.Max(), param.Address())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuiltinProfiles(t *testing.T) {
+	entries, err := builtinProfiles.ReadDir("profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		data, _ := builtinProfiles.ReadFile("profiles/" + entry.Name())
+		if _, err := Parse(data); err != nil {
+			t.Errorf("%s: %v", entry.Name(), err)
+		}
+	}
+
+	p, err := Load("minilogue")
+	if err != nil {
+		t.Fatalf("Load(minilogue) error = %v", err)
+	}
+	if param, ok := p.ForCC(43); !ok || param.Name != "cutoff" {
+		t.Errorf("ForCC(43) = %+v, %v, want cutoff", param, ok)
+	}
+	if desc := p.Describe(); !strings.Contains(desc, "- cutoff: CC 43, 0-127") {
+		t.Errorf("Describe() missing cutoff:\n%s", desc)
+	}
+}
+
+func TestUserProfiles(t *testing.T) {
+	orig := Dir
+	defer func() { Dir = orig }()
+	Dir = t.TempDir()
+
+	// A user profile overrides the built-in one of the same name
+	profile := `{"name": "minilogue", "parameters": [{"name": "drive", "cc": 20}, {"name": "detune", "nrpn": 5}]}`
+	if err := os.WriteFile(filepath.Join(Dir, "minilogue.json"), []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(Dir, "mine.json"), []byte(`{"name": "mine", "parameters": [{"name": "a", "cc": 1}]}`), 0644)
+	os.WriteFile(filepath.Join(Dir, "broken.json"), []byte(`{`), 0644)
+
+	p, err := Load("minilogue")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, ok := p.Find("drive"); !ok {
+		t.Error("user profile should override the built-in one")
+	}
+	if strings.Contains(p.Describe(), "detune") {
+		t.Error("Describe() should skip NRPN parameters")
+	}
+
+	names, err := List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got := strings.Join(names, ","); !strings.Contains(got, "gm,") || !strings.Contains(got, "mine") || !strings.Contains(got, "minilogue") {
+		t.Errorf("List() = %v", names)
+	}
+
+	for _, name := range []string{"broken", "nothing", "../minilogue"} {
+		if _, err := Load(name); err == nil {
+			t.Errorf("Load(%q) should fail", name)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Command embed plays a pattern with the interplay sequencer in another
+// program: it prints the notes instead of sending them to a MIDI port, so
+// it runs without one. Pass a *midi.Output to playback.New to play a synth.
+package main
+
+import (
+	"fmt"
+
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// printer is a playback.Output printing what it is sent
+type printer struct{}
+
+func (printer) NoteOn(channel, note, velocity uint8) error {
+	fmt.Printf("note on  %-4s vel %d\n", sequence.MIDIToNoteName(note), velocity)
+	return nil
+}
+
+func (printer) NoteOff(channel, note uint8) error {
+	fmt.Printf("note off %s\n", sequence.MIDIToNoteName(note))
+	return nil
+}
+
+func (printer) SendCC(channel, ccNumber, value uint8) error {
+	fmt.Printf("cc %d = %d\n", ccNumber, value)
+	return nil
+}
+
+func main() {
+	p := sequence.New(16)
+	p.SetTempo(140)
+	for step, name := range map[int]string{1: "C3", 4: "Eb3", 7: "G3", 11: "C4"} {
+		note, err := sequence.NoteNameToMIDI(name)
+		if err != nil {
+			panic(err)
+		}
+		p.SetNote(step, note)
+	}
+
+	engine := playback.New(printer{}, p)
+	events := engine.Subscribe(16)
+	engine.Start()
+	defer engine.Stop()
+
+	// Transpose the next loop up a fifth, then stop after it
+	next := engine.GetNextPattern()
+	steps := next.Snapshot()
+	for i, step := range steps {
+		if note, err := sequence.Transpose(step.Note, 7); err == nil && !step.IsRest {
+			steps[i].Note = note
+		}
+	}
+	if err := next.SetSteps(steps); err != nil {
+		panic(err)
+	}
+	loops := 0
+	for ev := range events {
+		if ev.Type == playback.EventLoop {
+			if loops++; loops == 2 {
+				return
+			}
+			fmt.Println("-- loop")
+		}
+	}
+}
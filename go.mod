@@ -7,6 +7,8 @@ require (
 	github.com/chzyer/readline v1.5.1
 	github.com/mattn/go-isatty v0.0.20
 	gitlab.com/gomidi/midi/v2 v2.3.16
+	go.starlark.net v0.0.0-20260908191801-89a6a09411d5
+	golang.org/x/sys v0.42.0
 )
 
 require (
@@ -14,5 +16,4 @@ require (
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
-	golang.org/x/sys v0.34.0 // indirect
 )
@@ -0,0 +1,248 @@
+package hooks
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/iltempo/interplay/sequence"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// predeclared returns the names available to scripts:
+//
+//	pattern       functions mirroring the Pattern methods (see patternModule)
+//	run(cmd)      run any Interplay command, e.g. run("swing 40")
+//	random()      float in [0, 1)
+//	randint(a, b) integer in [a, b]
+//	choice(seq)   random element of a list, tuple or string
+//	state         dict kept between hook calls (script globals are frozen)
+func predeclared(pattern *sequence.Pattern, host Host) starlark.StringDict {
+	return starlark.StringDict{
+		"pattern": patternModule(pattern),
+		"run": starlark.NewBuiltin("run", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var cmd string
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &cmd); err != nil {
+				return nil, err
+			}
+			if err := host.ProcessCommand(cmd); err != nil {
+				return nil, fmt.Errorf("%s: %w", cmd, err)
+			}
+			return starlark.None, nil
+		}),
+		"random": starlark.NewBuiltin("random", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+				return nil, err
+			}
+			return starlark.Float(rand.Float64()), nil
+		}),
+		"randint": starlark.NewBuiltin("randint", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var lo, hi int
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &lo, &hi); err != nil {
+				return nil, err
+			}
+			if hi < lo {
+				return nil, fmt.Errorf("%s: empty range %d-%d", b.Name(), lo, hi)
+			}
+			return starlark.MakeInt(lo + rand.IntN(hi-lo+1)), nil
+		}),
+		"choice": starlark.NewBuiltin("choice", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var seq starlark.Indexable
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &seq); err != nil {
+				return nil, err
+			}
+			if seq.Len() == 0 {
+				return nil, fmt.Errorf("%s: empty sequence", b.Name())
+			}
+			return seq.Index(rand.IntN(seq.Len())), nil
+		}),
+		"state": starlark.NewDict(0),
+	}
+}
+
+// builtinFunc is the signature of a Starlark builtin implementation
+type builtinFunc func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error)
+
+// patternModule exposes Pattern methods in snake_case. Notes may be names
+// ("C3", "F#2") or MIDI numbers; steps are 1-based.
+func patternModule(p *sequence.Pattern) *starlarkstruct.Module {
+	members := starlark.StringDict{}
+	add := func(name string, fn builtinFunc) {
+		members[name] = starlark.NewBuiltin(name, fn)
+	}
+
+	// set_note(step, note, duration=1)
+	add("set_note", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var step int
+		var noteValue starlark.Value
+		duration := 1
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "step", &step, "note", &noteValue, "duration?", &duration); err != nil {
+			return nil, err
+		}
+		note, err := toNote(noteValue)
+		if err != nil {
+			return nil, err
+		}
+		return starlark.None, p.SetNoteWithDuration(step, note, duration)
+	})
+
+	// set_rest(step)
+	add("set_rest", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var step int
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "step", &step); err != nil {
+			return nil, err
+		}
+		return starlark.None, p.SetRest(step)
+	})
+
+	// set_velocity(step, velocity)
+	add("set_velocity", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var step, velocity int
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "step", &step, "velocity", &velocity); err != nil {
+			return nil, err
+		}
+		if velocity < 0 || velocity > 127 {
+			return nil, fmt.Errorf("velocity must be 0-127")
+		}
+		return starlark.None, p.SetVelocity(step, uint8(velocity))
+	})
+
+	// set_gate(step, percent)
+	add("set_gate", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var step, gate int
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "step", &step, "percent", &gate); err != nil {
+			return nil, err
+		}
+		return starlark.None, p.SetGate(step, gate)
+	})
+
+	// get_step(step) -> struct(note, midi, rest, velocity, gate, duration)
+	add("get_step", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var stepNum int
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "step", &stepNum); err != nil {
+			return nil, err
+		}
+		step, err := p.GetStep(stepNum)
+		if err != nil {
+			return nil, err
+		}
+		var note starlark.Value = starlark.None
+		if !step.IsRest {
+			note = starlark.String(sequence.MIDIToNoteName(step.Note))
+		}
+		return starlarkstruct.FromStringDict(starlark.String("step"), starlark.StringDict{
+			"note":     note,
+			"midi":     starlark.MakeInt(int(step.Note)),
+			"rest":     starlark.Bool(step.IsRest),
+			"velocity": starlark.MakeInt(int(step.Velocity)),
+			"gate":     starlark.MakeInt(step.Gate),
+			"duration": starlark.MakeInt(step.Duration),
+		}), nil
+	})
+
+	// clear()
+	add("clear", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+			return nil, err
+		}
+		p.Clear()
+		return starlark.None, nil
+	})
+
+	// length() and resize(steps)
+	add("length", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+			return nil, err
+		}
+		return starlark.MakeInt(p.Length()), nil
+	})
+	add("resize", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var steps int
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "steps", &steps); err != nil {
+			return nil, err
+		}
+		return starlark.None, p.Resize(steps)
+	})
+
+	// tempo() and set_tempo(bpm)
+	add("tempo", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+			return nil, err
+		}
+		// Whole tempos stay ints so existing scripts can do integer math
+		bpm := p.GetBPM()
+		if bpm == math.Trunc(bpm) {
+			return starlark.MakeInt(int(bpm)), nil
+		}
+		return starlark.Float(bpm), nil
+	})
+	add("set_tempo", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var bpm starlark.Value
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "bpm", &bpm); err != nil {
+			return nil, err
+		}
+		f, ok := starlark.AsFloat(bpm)
+		if !ok {
+			return nil, fmt.Errorf("%s: bpm must be a number, got %s", b.Name(), bpm.Type())
+		}
+		return starlark.None, p.SetTempo(f)
+	})
+
+	// swing() and set_swing(percent)
+	add("swing", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+			return nil, err
+		}
+		return starlark.MakeInt(p.GetSwing()), nil
+	})
+	add("set_swing", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var percent int
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "percent", &percent); err != nil {
+			return nil, err
+		}
+		return starlark.None, p.SetSwing(percent)
+	})
+
+	// set_global_cc(cc, value), set_step_cc(step, cc, value), clear_step_cc(step, cc=-1)
+	add("set_global_cc", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var cc, value int
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "cc", &cc, "value", &value); err != nil {
+			return nil, err
+		}
+		return starlark.None, p.SetGlobalCC(cc, value)
+	})
+	add("set_step_cc", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var step, cc, value int
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "step", &step, "cc", &cc, "value", &value); err != nil {
+			return nil, err
+		}
+		return starlark.None, p.SetStepCC(step, cc, value)
+	})
+	add("clear_step_cc", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var step int
+		cc := -1
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "step", &step, "cc?", &cc); err != nil {
+			return nil, err
+		}
+		return starlark.None, p.ClearStepCC(step, cc)
+	})
+
+	return &starlarkstruct.Module{Name: "pattern", Members: members}
+}
+
+// toNote converts a note name or MIDI number
+func toNote(v starlark.Value) (uint8, error) {
+	switch v := v.(type) {
+	case starlark.String:
+		return sequence.NoteNameToMIDI(string(v))
+	case starlark.Int:
+		n, ok := v.Int64()
+		if !ok || n < 0 || n > 127 {
+			return 0, fmt.Errorf("note must be 0-127, got %s", v)
+		}
+		return uint8(n), nil
+	default:
+		return 0, fmt.Errorf("note must be a name like C3 or a MIDI number, got %s", v.Type())
+	}
+}
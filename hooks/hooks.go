@@ -0,0 +1,231 @@
+// Package hooks runs Starlark scripts with callbacks into the playback loop:
+//
+//	def on_loop(loop):   # at every loop boundary (loop = completed loops)
+//	def on_step(step):   # at the start of every step (1-based)
+//	def on_load(name):   # after the script is loaded ("") and after each 'load <name>'
+//
+// Scripts edit the pattern through the 'pattern' module, whose functions
+// mirror the Pattern methods, and can run any command with run(). Edits
+// apply to the next pattern, so they are heard from the following loop.
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// maxExecutionSteps stops runaway scripts (e.g. an endless while loop)
+// before they hold up other commands for long
+const maxExecutionSteps = 1_000_000
+
+// eventBuffer lets hooks fall behind briefly without missing steps
+const eventBuffer = 256
+
+// hookNames are the callbacks a script may define
+var hookNames = []string{"on_load", "on_loop", "on_step"}
+
+// fileOptions enable the Starlark dialect features useful in scripts
+var fileOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+}
+
+// Host runs hook code serialized with other commands; *commands.Handler implements it
+type Host interface {
+	// Update runs fn while commands are blocked and reports pattern changes
+	Update(fn func() error) error
+	// ProcessCommand runs a command line; run() calls it inside Update
+	ProcessCommand(cmdLine string) error
+	// Output is where scripts print and failures are reported
+	Output() io.Writer
+}
+
+// Clock delivers playback events; *playback.Engine implements it
+type Clock interface {
+	Subscribe(buffer int) <-chan playback.Event
+	Unsubscribe(ch <-chan playback.Event)
+}
+
+// Runner calls the hooks of one loaded script
+type Runner struct {
+	path        string
+	host        Host
+	predeclared starlark.StringDict
+	hooks       map[string]starlark.Callable
+	loads       chan string
+	stop        chan struct{}
+}
+
+// Load runs a script's top-level code and collects its hooks. The caller
+// must hold the host's command lock (e.g. run Load inside Update), since the
+// top level may edit the pattern. Call Start to begin calling hooks.
+func Load(path string, host Host, pattern *sequence.Pattern) (*Runner, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks: %w", err)
+	}
+
+	r := &Runner{
+		path:  path,
+		host:  host,
+		hooks: map[string]starlark.Callable{},
+		loads: make(chan string, 4),
+		stop:  make(chan struct{}),
+	}
+	r.predeclared = predeclared(pattern, host)
+
+	globals, err := starlark.ExecFileOptions(fileOptions, r.thread(), path, src, r.predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hooks: %s", describeError(err))
+	}
+
+	for _, name := range hookNames {
+		value, ok := globals[name]
+		if !ok {
+			continue
+		}
+		fn, ok := value.(starlark.Callable)
+		if !ok {
+			return nil, fmt.Errorf("failed to load hooks: %s must be a function, got %s", name, value.Type())
+		}
+		r.hooks[name] = fn
+	}
+	if len(r.hooks) == 0 {
+		return nil, fmt.Errorf("no hooks in %s (define on_loop, on_step or on_load)", path)
+	}
+	return r, nil
+}
+
+// Path returns the script file
+func (r *Runner) Path() string {
+	return r.path
+}
+
+// Hooks returns the names of the defined hooks
+func (r *Runner) Hooks() []string {
+	var names []string
+	for _, name := range hookNames {
+		if _, ok := r.hooks[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Start calls hooks in the background until Stop: on_load once now, then
+// on_loop and on_step from clock (if non-nil) and on_load from PatternLoaded
+func (r *Runner) Start(clock Clock) {
+	var events <-chan playback.Event
+	if clock != nil && (r.hooks["on_loop"] != nil || r.hooks["on_step"] != nil) {
+		events = clock.Subscribe(eventBuffer)
+	}
+	r.PatternLoaded("")
+
+	go func() {
+		if events != nil {
+			defer clock.Unsubscribe(events)
+		}
+		for {
+			select {
+			case <-r.stop:
+				return
+			case name := <-r.loads:
+				r.call("on_load", starlark.String(name))
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				switch ev.Type {
+				case playback.EventLoop:
+					r.call("on_loop", starlark.MakeInt(ev.Loop))
+				case playback.EventStep:
+					r.call("on_step", starlark.MakeInt(ev.Step))
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops calling hooks. It doesn't wait, so it is safe to call while
+// holding the host's command lock.
+func (r *Runner) Stop() {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+}
+
+// PatternLoaded queues an on_load call after a pattern was loaded
+func (r *Runner) PatternLoaded(name string) {
+	if r.hooks["on_load"] == nil {
+		return
+	}
+	select {
+	case r.loads <- name:
+	default: // hooks are behind; skip rather than block the load command
+	}
+}
+
+// call runs a hook if defined, reporting errors without stopping the script
+func (r *Runner) call(name string, arg starlark.Value) {
+	fn := r.hooks[name]
+	if fn == nil {
+		return
+	}
+
+	start := time.Now()
+	err := r.host.Update(func() error {
+		select {
+		case <-r.stop:
+			return nil // stopped while waiting for the lock
+		default:
+		}
+		_, err := starlark.Call(r.thread(), fn, starlark.Tuple{arg}, nil)
+		return err
+	})
+	if err != nil {
+		slog.Warn("hook failed", "hook", name, "error", err)
+		fmt.Fprintf(r.host.Output(), "[hooks] %s failed: %s\n", name, describeError(err))
+		return
+	}
+	slog.Debug("hook", "hook", name, "arg", arg.String(), "duration", time.Since(start))
+}
+
+// thread returns a Starlark thread printing to the host's output
+func (r *Runner) thread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: r.path,
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(r.host.Output(), "[hooks]", msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(maxExecutionSteps)
+	return thread
+}
+
+// describeError includes the script position for evaluation errors
+func describeError(err error) string {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		// The innermost frame may be a builtin without a position
+		for i := range evalErr.CallStack {
+			if pos := evalErr.CallStack.At(i).Pos; pos.IsValid() && pos.Filename() != "<builtin>" {
+				return fmt.Sprintf("%s: %s", pos, evalErr.Msg)
+			}
+		}
+		return evalErr.Msg
+	}
+	return err.Error()
+}
@@ -0,0 +1,239 @@
+package hooks
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// fakeHost serializes updates and records commands run by scripts
+type fakeHost struct {
+	mu       sync.Mutex
+	commands []string
+	updates  int
+}
+
+func (f *fakeHost) Update(fn func() error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates++
+	return fn()
+}
+
+func (f *fakeHost) ProcessCommand(cmdLine string) error {
+	f.commands = append(f.commands, cmdLine)
+	return nil
+}
+
+func (f *fakeHost) Output() io.Writer {
+	return io.Discard
+}
+
+func (f *fakeHost) Updates() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.updates
+}
+
+// fakeClock sends events pushed by the test
+type fakeClock struct {
+	events chan playback.Event
+}
+
+func (c *fakeClock) Subscribe(buffer int) <-chan playback.Event { return c.events }
+func (c *fakeClock) Unsubscribe(ch <-chan playback.Event)       {}
+
+// writeScript writes a hook script to a temp file and returns its path
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hooks.star")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		hooks   []string
+		wantErr string
+	}{
+		{"all hooks", "def on_load(name): pass\ndef on_loop(loop): pass\ndef on_step(step): pass\n", []string{"on_load", "on_loop", "on_step"}, ""},
+		{"one hook", "def on_loop(loop): pass\n", []string{"on_loop"}, ""},
+		{"no hooks", "x = 1\n", nil, "no hooks"},
+		{"not a function", "on_loop = 4\n", nil, "must be a function"},
+		{"syntax error", "def on_loop(loop)\n", nil, "want ':'"},
+		{"runtime error", "def on_loop(loop): pass\npattern.set_note(99, 'C3')\n", nil, "step must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Load(writeScript(t, tt.src), &fakeHost{}, sequence.New(16))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if got := strings.Join(r.Hooks(), ","); got != strings.Join(tt.hooks, ",") {
+				t.Errorf("Hooks() = %s, want %s", got, strings.Join(tt.hooks, ","))
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.star"), &fakeHost{}, sequence.New(16)); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestPatternAPI(t *testing.T) {
+	pattern := sequence.New(16)
+	pattern.Clear()
+	host := &fakeHost{}
+
+	src := `
+pattern.set_note(1, "C3")
+pattern.set_note(step = 2, note = 50, duration = 2)
+pattern.set_velocity(1, 110)
+pattern.set_gate(1, 50)
+pattern.set_rest(3)
+pattern.set_tempo(pattern.tempo() + 20)
+pattern.set_swing(30)
+pattern.set_step_cc(1, 74, 90)
+pattern.resize(8)
+
+s = pattern.get_step(1)
+if s.note != "C3" or s.midi != 48 or s.velocity != 110 or s.gate != 50 or s.rest:
+    fail("get_step(1) = %s" % s)
+if pattern.get_step(3).note != None:
+    fail("step 3 should be a rest")
+if pattern.length() != 8 or pattern.swing() != 30:
+    fail("length/swing")
+
+n = randint(1, 3)
+if n < 1 or n > 3:
+    fail("randint out of range: %d" % n)
+if choice(["x"]) != "x" or random() >= 1:
+    fail("choice/random")
+
+run("humanize velocity 8")
+state["count"] = 1
+
+def on_loop(loop):
+    pass
+`
+	if _, err := Load(writeScript(t, src), host, pattern); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	step, _ := pattern.GetStep(2)
+	if step.Note != 50 || step.Duration != 2 {
+		t.Errorf("step 2 = %+v, want MIDI 50 for 2 steps", step)
+	}
+	if pattern.GetBPM() != 100 {
+		t.Errorf("tempo = %g, want 100", pattern.GetBPM())
+	}
+	if cc, ok := pattern.GetStepCC(1, 74); !ok || cc != 90 {
+		t.Errorf("step 1 CC74 = %d, %v, want 90", cc, ok)
+	}
+	if len(host.commands) != 1 || host.commands[0] != "humanize velocity 8" {
+		t.Errorf("run() commands = %q", host.commands)
+	}
+
+	for _, bad := range []string{
+		`pattern.set_note(1, "H9")`,
+		`pattern.set_note(1, 200)`,
+		`pattern.set_velocity(1, 128)`,
+		`pattern.set_tempo(5)`,
+		`randint(3, 1)`,
+		`choice([])`,
+		`while True: pass`,
+	} {
+		if _, err := Load(writeScript(t, bad+"\ndef on_loop(loop): pass\n"), host, pattern); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestRunner(t *testing.T) {
+	pattern := sequence.New(16)
+	pattern.Clear()
+	host := &fakeHost{}
+	clock := &fakeClock{events: make(chan playback.Event, 16)}
+
+	// Fill the last step every 4th loop; count steps and loads in state
+	src := `
+def on_load(name):
+    state["loads"] = state.get("loads", []) + [name]
+
+def on_loop(loop):
+    if loop % 4 == 3:
+        pattern.set_note(16, "G3")
+    else:
+        pattern.set_rest(16)
+
+def on_step(step):
+    state["steps"] = state.get("steps", 0) + 1
+    if step == 99:
+        fail("boom")
+`
+	r, err := Load(writeScript(t, src), host, pattern)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	r.Start(clock)
+	defer r.Stop()
+
+	r.PatternLoaded("groove")
+	clock.events <- playback.Event{Type: playback.EventStep, Step: 1}
+	clock.events <- playback.Event{Type: playback.EventStep, Step: 99} // error is reported, runner keeps going
+	clock.events <- playback.Event{Type: playback.EventLoop, Loop: 3}
+
+	waitFor(t, "fill", func() bool {
+		step, _ := pattern.GetStep(16)
+		return !step.IsRest && step.Note == 55
+	})
+
+	clock.events <- playback.Event{Type: playback.EventLoop, Loop: 4}
+	waitFor(t, "fill removed", func() bool {
+		step, _ := pattern.GetStep(16)
+		return step.IsRest
+	})
+
+	state := r.predeclared["state"].String()
+	if !strings.Contains(state, `"loads": ["", "groove"]`) || !strings.Contains(state, `"steps": 2`) {
+		t.Errorf("state = %s", state)
+	}
+
+	// Stopped runners don't call hooks
+	r.Stop()
+	before := host.Updates()
+	clock.events <- playback.Event{Type: playback.EventLoop, Loop: 7}
+	time.Sleep(20 * time.Millisecond)
+	if step, _ := pattern.GetStep(16); !step.IsRest {
+		t.Errorf("hook ran after Stop (%d -> %d updates)", before, host.Updates())
+	}
+}
@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// eventBuffer is the per-client playback event buffer; events are dropped
+// for clients that fall this far behind
+const eventBuffer = 256
+
+// writeTimeout limits how long a message may take to send; a client that
+// stops reading is disconnected instead of holding its stream forever
+const writeTimeout = 5 * time.Second
+
+// eventMessage is one message on the /events WebSocket
+type eventMessage struct {
+	Type     string           `json:"type"` // step, note-on, note-off, loop, send-failed, send-recovered, pattern
+	Step     int              `json:"step,omitempty"`
+	Loop     int              `json:"loop"`
+	Note     uint8            `json:"note,omitempty"`
+	NoteName string           `json:"note_name,omitempty"`
+	Velocity uint8            `json:"velocity,omitempty"`
+	Error    string           `json:"error,omitempty"` // why MIDI sending failed, for send-failed
+	Time     *time.Time       `json:"time,omitempty"`
+	Pattern  *patternResponse `json:"pattern,omitempty"`
+}
+
+// newEventMessage converts a playback event to a message
+func newEventMessage(ev playback.Event) eventMessage {
+	msg := eventMessage{Type: ev.Type.String(), Step: ev.Step, Loop: ev.Loop, Time: &ev.Time}
+	if ev.Type == playback.EventNoteOn || ev.Type == playback.EventNoteOff {
+		msg.Note = ev.Note
+		msg.NoteName = sequence.MIDIToNoteName(ev.Note)
+		msg.Velocity = ev.Velocity
+	}
+	if ev.Err != nil {
+		msg.Error = ev.Err.Error()
+	}
+	return msg
+}
+
+// streamEvents upgrades to a WebSocket and streams playback events and
+// pattern changes until the client disconnects. The current pattern is sent
+// first. Like every request, the upgrade is refused for pages from other
+// origins (see ServeHTTP), so other sites can't watch the session.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	conn, rw, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+	slog.Info("websocket connected", "addr", r.RemoteAddr)
+	defer slog.Info("websocket disconnected", "addr", r.RemoteAddr)
+
+	var writeMu sync.Mutex
+	send := func(opcode byte, payload []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return writeFrame(rw.Writer, opcode, payload)
+	}
+	sendJSON := func(msg eventMessage) error {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return send(opText, data)
+	}
+
+	events := s.player.Subscribe(eventBuffer)
+	defer s.player.Unsubscribe(events)
+
+	changed := make(chan struct{}, 1)
+	removeListener := s.exec.OnPatternChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default: // a change notification is already pending
+		}
+	})
+	defer removeListener()
+
+	// Read client frames: answer pings, stop on close or error
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := readFrame(rw.Reader)
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case opClose:
+				send(opClose, nil)
+				return
+			case opPing:
+				send(opPong, payload)
+			}
+		}
+	}()
+
+	patternMessage := func() eventMessage {
+		p := s.currentPattern()
+		return eventMessage{Type: "pattern", Loop: s.player.LoopCount(), Pattern: &p}
+	}
+	if err := sendJSON(patternMessage()); err != nil {
+		return
+	}
+
+	for {
+		var msg eventMessage
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			msg = newEventMessage(ev)
+		case <-changed:
+			msg = patternMessage()
+		case <-closed:
+			return
+		}
+		if err := sendJSON(msg); err != nil {
+			return
+		}
+	}
+}
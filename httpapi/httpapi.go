@@ -0,0 +1,355 @@
+// Package httpapi serves a JSON REST API for remote control:
+//
+//	GET    /pattern             current pattern
+//	POST   /commands            run commands (JSON {"commands": [...]})
+//	GET    /transport           playback state
+//	POST   /transport/pause     pause playback
+//	POST   /transport/resume    resume playback
+//	GET    /patterns            saved pattern names
+//	GET    /patterns/{name}     a saved pattern (name may include collections: basslines/funk1)
+//	PUT    /patterns/{name}     store a pattern (pattern file JSON)
+//	POST   /patterns/{name}     save the current pattern under name
+//	DELETE /patterns/{name}     delete a saved pattern
+//	GET    /events              WebSocket stream of playback events and pattern changes
+//
+// Request bodies must be JSON. Browsers may only call the API from its own
+// origin or one allowed with SetOrigins, and commands touching files or
+// loading code need SetAllowFiles.
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// maxBodySize limits request bodies; patterns and command lists are small
+const maxBodySize = 1 << 20
+
+// Executor runs command lines and reports pattern changes; *commands.Handler implements it
+type Executor interface {
+	Execute(cmdLine string) error
+	// ExecuteNoFiles runs cmdLine, refusing commands that touch files or load code
+	ExecuteNoFiles(cmdLine string) error
+	OnPatternChange(fn func()) (remove func())
+}
+
+// Player reports playback state and events; *playback.Engine implements it
+type Player interface {
+	IsPaused() bool
+	LoopCount() int
+	Subscribe(buffer int) <-chan playback.Event
+	Unsubscribe(ch <-chan playback.Event)
+}
+
+// Server serves the API for one session
+type Server struct {
+	exec       Executor
+	pattern    *sequence.Pattern
+	player     Player
+	mux        *http.ServeMux
+	allowFiles bool     // POST /commands may touch files, see SetAllowFiles
+	origins    []string // browser origins allowed besides the server's own
+}
+
+// New creates an API server. Edits go through exec, so they are serialized
+// with the other input sources; pattern is read for GET /pattern.
+func New(exec Executor, pattern *sequence.Pattern, player Player) *Server {
+	s := &Server{
+		exec:    exec,
+		pattern: pattern,
+		player:  player,
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /pattern", s.getPattern)
+	s.mux.HandleFunc("POST /commands", s.postCommands)
+	s.mux.HandleFunc("GET /transport", s.getTransport)
+	s.mux.HandleFunc("POST /transport/pause", s.transportCommand("pause"))
+	s.mux.HandleFunc("POST /transport/resume", s.transportCommand("resume"))
+	s.mux.HandleFunc("GET /patterns", s.listPatterns)
+	s.mux.HandleFunc("GET /patterns/{name...}", s.getSavedPattern)
+	s.mux.HandleFunc("PUT /patterns/{name...}", s.putSavedPattern)
+	s.mux.HandleFunc("POST /patterns/{name...}", s.saveCurrentPattern)
+	s.mux.HandleFunc("DELETE /patterns/{name...}", s.deleteSavedPattern)
+	s.mux.HandleFunc("GET /events", s.streamEvents)
+	return s
+}
+
+// SetAllowFiles lets POST /commands run commands that read or write files
+// or load code (save, load, export, hooks, plugins, ...). Off by default,
+// since any client reaching the API could otherwise write files or run
+// programs as the user.
+func (s *Server) SetAllowFiles(allow bool) {
+	s.allowFiles = allow
+}
+
+// SetOrigins allows browser pages from these origins (e.g.
+// "http://localhost:3000") to call the API, besides the API's own
+func (s *Server) SetOrigins(origins []string) {
+	s.origins = origins
+}
+
+// allowedOrigin reports whether a request may be served: requests without
+// an Origin header don't come from a web page, others must come from the
+// API's own origin or an allowed one, so other sites can't drive the API
+// through the user's browser
+func (s *Server) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if slices.Contains(s.origins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host == r.Host
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if s.allowedOrigin(r) {
+		s.mux.ServeHTTP(w, r)
+	} else {
+		writeError(w, http.StatusForbidden, fmt.Errorf("origin %s not allowed", r.Header.Get("Origin")))
+	}
+	slog.Info("http request", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+}
+
+// Address returns the address to listen on for an --http value: a bare
+// port ("8080" or ":8080") listens on localhost only, anything else (e.g.
+// "0.0.0.0:8080") as given
+func Address(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "127.0.0.1" + addr
+	}
+	if _, err := strconv.Atoi(addr); err == nil {
+		return "127.0.0.1:" + addr
+	}
+	return addr
+}
+
+// ListenAndServe serves the API on addr (see Address) until the server fails
+func (s *Server) ListenAndServe(addr string) error {
+	server := &http.Server{
+		Addr:              Address(addr),
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+// patternResponse is the current pattern in the saved-file format, plus
+// settings that aren't saved
+type patternResponse struct {
+	*sequence.PatternFile
+	Swing        int                   `json:"swing"`
+	Humanization sequence.Humanization `json:"humanization"`
+}
+
+// commandsRequest is the JSON body of POST /commands
+type commandsRequest struct {
+	Commands []string `json:"commands"`
+}
+
+// commandResult reports the outcome of one command
+type commandResult struct {
+	Command string `json:"command"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// writeJSON writes v with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// requireJSON refuses a request body that isn't JSON with 415 Unsupported
+// Media Type. Browsers can't send JSON to other sites without asking first,
+// so a page can't post commands with a plain form.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("request body must be JSON (Content-Type: application/json)"))
+		return false
+	}
+	return true
+}
+
+// writeError writes {"error": message}
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// currentPattern describes the pattern being edited
+func (s *Server) currentPattern() patternResponse {
+	pf := s.pattern.ToPatternFile("")
+	pf.CreatedAt = ""
+	return patternResponse{
+		PatternFile:  pf,
+		Swing:        s.pattern.GetSwing(),
+		Humanization: s.pattern.GetHumanization(),
+	}
+}
+
+// getPattern: GET /pattern - the current pattern
+func (s *Server) getPattern(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.currentPattern())
+}
+
+// postCommands: POST /commands - run commands, reporting each one's outcome
+func (s *Server) postCommands(w http.ResponseWriter, r *http.Request) {
+	if !requireJSON(w, r) {
+		return
+	}
+	var req commandsRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON: %w", err))
+		return
+	}
+	execute := s.exec.ExecuteNoFiles
+	if s.allowFiles {
+		execute = s.exec.Execute
+	}
+
+	results := []commandResult{}
+	failed := false
+	for _, line := range req.Commands {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result := commandResult{Command: line, OK: true}
+		if err := execute(line); err != nil {
+			result.OK = false
+			result.Error = err.Error()
+			failed = true
+		}
+		results = append(results, result)
+	}
+
+	status := http.StatusOK
+	if failed {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, map[string]any{"results": results})
+}
+
+// getTransport: GET /transport - playback state
+func (s *Server) getTransport(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"playing": !s.player.IsPaused(),
+		"loop":    s.player.LoopCount(),
+		"tempo":   s.pattern.GetBPM(),
+	})
+}
+
+// transportCommand runs a transport command and reports the new state
+func (s *Server) transportCommand(command string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.exec.Execute(command); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		s.getTransport(w, r)
+	}
+}
+
+// listPatterns: GET /patterns - saved pattern names
+func (s *Server) listPatterns(w http.ResponseWriter, r *http.Request) {
+	names, err := sequence.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"patterns": names})
+}
+
+// getSavedPattern: GET /patterns/{name} - a saved pattern
+func (s *Server) getSavedPattern(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	p, err := sequence.Load(name)
+	if err != nil {
+		writeError(w, loadStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.ToPatternFile(name))
+}
+
+// putSavedPattern: PUT /patterns/{name} - store a pattern sent as pattern file JSON
+func (s *Server) putSavedPattern(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !requireJSON(w, r) {
+		return
+	}
+
+	var pf sequence.PatternFile
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&pf); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid pattern JSON: %w", err))
+		return
+	}
+	p, err := sequence.FromPatternFile(&pf)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := p.Save(name); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.ToPatternFile(name))
+}
+
+// saveCurrentPattern: POST /patterns/{name} - save the current pattern.
+// It runs the save command, so the session knows the pattern is saved; the
+// name is refused if the command line would split or rewrite it.
+func (s *Server) saveCurrentPattern(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if strings.ContainsAny(name, ";$") || strings.Join(strings.Fields(name), " ") != name {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid pattern name %q: no ';', '$' or extra spaces", name))
+		return
+	}
+	if err := s.exec.Execute("save " + name); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.pattern.ToPatternFile(name))
+}
+
+// deleteSavedPattern: DELETE /patterns/{name} - delete a saved pattern
+func (s *Server) deleteSavedPattern(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, err := sequence.Load(name); err != nil {
+		writeError(w, loadStatus(err), err)
+		return
+	}
+	if err := sequence.Delete(name); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadStatus maps a sequence.Load error to an HTTP status
+func loadStatus(err error) int {
+	if strings.Contains(err.Error(), "not found") {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
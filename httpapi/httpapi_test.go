@@ -0,0 +1,405 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iltempo/interplay/commands"
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// mockVerboseController implements commands.VerboseController for testing
+type mockVerboseController struct{ verbose bool }
+
+func (m *mockVerboseController) SetVerbose(v bool) { m.verbose = v }
+func (m *mockVerboseController) IsVerbose() bool   { return m.verbose }
+
+// mockPlayer implements Player and commands.Transport for testing
+type mockPlayer struct {
+	paused bool
+	events chan playback.Event
+}
+
+func (m *mockPlayer) Pause()         { m.paused = true }
+func (m *mockPlayer) Resume()        { m.paused = false }
+func (m *mockPlayer) IsPaused() bool { return m.paused }
+func (m *mockPlayer) LoopCount() int { return 3 }
+
+func (m *mockPlayer) Subscribe(buffer int) <-chan playback.Event { return m.events }
+func (m *mockPlayer) Unsubscribe(ch <-chan playback.Event)       {}
+
+// newTestServer returns an API server backed by a real command handler
+func newTestServer(t *testing.T) (*httptest.Server, *sequence.Pattern, *mockPlayer) {
+	t.Helper()
+	origDir, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(origDir) })
+	os.Chdir(t.TempDir())
+
+	pattern := sequence.New(16)
+	player := &mockPlayer{events: make(chan playback.Event, 16)}
+	handler := commands.New(pattern, &mockVerboseController{})
+	handler.SetTransport(player)
+
+	server := httptest.NewServer(New(handler, pattern, player))
+	t.Cleanup(server.Close)
+	return server, pattern, player
+}
+
+// do sends a request and decodes the JSON response into out (if non-nil)
+func do(t *testing.T, method, url, contentType, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestCommandsAndPattern(t *testing.T) {
+	server, pattern, _ := newTestServer(t)
+
+	var result struct {
+		Results []commandResult `json:"results"`
+	}
+	status := do(t, "POST", server.URL+"/commands", "application/json", `{"commands": ["tempo 120", "set 1 C2 vel:110"]}`, &result)
+	if status != http.StatusOK || len(result.Results) != 2 || !result.Results[1].OK {
+		t.Errorf("POST /commands = %d %+v", status, result)
+	}
+	if pattern.GetBPM() != 120 {
+		t.Errorf("tempo not applied, got %g", pattern.GetBPM())
+	}
+
+	// Failures give 422 with per-command errors
+	status = do(t, "POST", server.URL+"/commands", "application/json; charset=utf-8", `{"commands": ["swing 40", "bogus"]}`, &result)
+	if status != http.StatusUnprocessableEntity || !result.Results[0].OK || result.Results[1].Error == "" {
+		t.Errorf("POST /commands with a failure = %d %+v", status, result)
+	}
+
+	// Bodies must be JSON, so a web form can't post commands
+	for _, contentType := range []string{"text/plain", "application/x-www-form-urlencoded", ""} {
+		if status := do(t, "POST", server.URL+"/commands", contentType, "tempo 90", nil); status != http.StatusUnsupportedMediaType {
+			t.Errorf("POST /commands as %q = %d, want 415", contentType, status)
+		}
+	}
+	if pattern.GetBPM() != 120 {
+		t.Errorf("non-JSON body ran a command: tempo %g", pattern.GetBPM())
+	}
+
+	var p struct {
+		Tempo  int `json:"tempo"`
+		Length int `json:"length"`
+		Swing  int `json:"swing"`
+		Steps  []sequence.PatternStep
+	}
+	if status := do(t, "GET", server.URL+"/pattern", "", "", &p); status != http.StatusOK {
+		t.Fatalf("GET /pattern = %d", status)
+	}
+	if p.Tempo != 120 || p.Length != 16 || p.Swing != 40 || len(p.Steps) != 1 || p.Steps[0].Note != "C2" || p.Steps[0].Velocity != 110 {
+		t.Errorf("GET /pattern = %+v", p)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server, _, _ := newTestServer(t)
+
+	var state map[string]any
+	do(t, "POST", server.URL+"/transport/pause", "", "", &state)
+	if state["playing"] != false || state["loop"] != float64(3) {
+		t.Errorf("after pause: %v", state)
+	}
+	do(t, "POST", server.URL+"/transport/resume", "", "", &state)
+	if state["playing"] != true {
+		t.Errorf("after resume: %v", state)
+	}
+	if status := do(t, "GET", server.URL+"/transport/pause", "", "", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET /transport/pause = %d, want 405", status)
+	}
+}
+
+func TestSavedPatterns(t *testing.T) {
+	server, pattern, _ := newTestServer(t)
+
+	var list struct{ Patterns []string }
+	do(t, "GET", server.URL+"/patterns", "", "", &list)
+	if len(list.Patterns) != 0 {
+		t.Errorf("expected no patterns, got %v", list.Patterns)
+	}
+
+	body := `{"name": "bass", "tempo": 100, "length": 8, "steps": [{"step": 1, "note": "E2"}]}`
+	if status := do(t, "PUT", server.URL+"/patterns/bass", "application/json", body, nil); status != http.StatusOK {
+		t.Errorf("PUT /patterns/bass = %d", status)
+	}
+	if status := do(t, "PUT", server.URL+"/patterns/bad", "application/json", `{"tempo": 100, "length": 8, "steps": [{"step": 1, "note": "H9"}]}`, nil); status != http.StatusBadRequest {
+		t.Errorf("PUT invalid pattern = %d, want 400", status)
+	}
+	if status := do(t, "PUT", server.URL+"/patterns/plain", "text/plain", body, nil); status != http.StatusUnsupportedMediaType {
+		t.Errorf("PUT non-JSON pattern = %d, want 415", status)
+	}
+	if status := do(t, "POST", server.URL+"/patterns/current", "", "", nil); status != http.StatusOK {
+		t.Errorf("POST /patterns/current = %d", status)
+	}
+
+	do(t, "GET", server.URL+"/patterns", "", "", &list)
+	if strings.Join(list.Patterns, ",") != "bass,current" {
+		t.Errorf("patterns = %v, want [bass current]", list.Patterns)
+	}
+
+	var pf sequence.PatternFile
+	if status := do(t, "GET", server.URL+"/patterns/bass", "", "", &pf); status != http.StatusOK || pf.Tempo != 100 || len(pf.Steps) != 1 {
+		t.Errorf("GET /patterns/bass = %d %+v", status, pf)
+	}
+
+	if status := do(t, "DELETE", server.URL+"/patterns/bass", "", "", nil); status != http.StatusNoContent {
+		t.Errorf("DELETE /patterns/bass = %d", status)
+	}
+	if status := do(t, "GET", server.URL+"/patterns/bass", "", "", nil); status != http.StatusNotFound {
+		t.Errorf("GET deleted pattern = %d, want 404", status)
+	}
+	if status := do(t, "DELETE", server.URL+"/patterns/bass", "", "", nil); status != http.StatusNotFound {
+		t.Errorf("DELETE missing pattern = %d, want 404", status)
+	}
+
+	// The name goes on a save command line, so it can't chain another
+	// command or expand variables
+	pattern.SetNote(1, 36)
+	for _, name := range []string{"a%3Bclear", "x%24y", "a%20%20b"} {
+		if status := do(t, "POST", server.URL+"/patterns/"+name, "", "", nil); status != http.StatusBadRequest {
+			t.Errorf("POST /patterns/%s = %d, want 400", name, status)
+		}
+	}
+	if pattern.Steps[0].IsRest {
+		t.Error("saving under a name with ';' ran the command after it")
+	}
+	do(t, "GET", server.URL+"/patterns", "", "", &list)
+	if strings.Join(list.Patterns, ",") != "current" {
+		t.Errorf("patterns = %v, want [current]", list.Patterns)
+	}
+
+	// Names may include collections
+	if status := do(t, "PUT", server.URL+"/patterns/sets/live/bass", "application/json", body, nil); status != http.StatusOK {
+		t.Errorf("PUT /patterns/sets/live/bass = %d", status)
+	}
+	do(t, "GET", server.URL+"/patterns", "", "", &list)
+	if strings.Join(list.Patterns, ",") != "current,sets/live/bass" {
+		t.Errorf("patterns = %v, want [current sets/live/bass]", list.Patterns)
+	}
+	if status := do(t, "GET", server.URL+"/patterns/sets/live/bass", "", "", &pf); status != http.StatusOK || pf.Tempo != 100 {
+		t.Errorf("GET /patterns/sets/live/bass = %d %+v", status, pf)
+	}
+}
+
+func TestFileCommands(t *testing.T) {
+	server, _, _ := newTestServer(t)
+
+	// Commands touching files are refused, also inside chains and macros
+	var result struct {
+		Results []commandResult `json:"results"`
+	}
+	body := `{"commands": ["save a", "tempo 100; export script out.txt", "macro define m save b", "macro run m", "monitor midi.log", "hooks load x.star"]}`
+	if status := do(t, "POST", server.URL+"/commands", "application/json", body, &result); status != http.StatusUnprocessableEntity {
+		t.Errorf("POST /commands with file commands = %d, want 422", status)
+	}
+	for _, r := range result.Results {
+		switch r.Command {
+		case "macro define m save b":
+		case "macro run m":
+			if r.OK {
+				t.Errorf("%s ran", r.Command)
+			}
+		default:
+			if !strings.Contains(r.Error, "reads or writes files") {
+				t.Errorf("%s: error %q, want refused", r.Command, r.Error)
+			}
+		}
+	}
+	for _, file := range []string{"patterns/a.json", "patterns/b.json", "out.txt", "midi.log"} {
+		if _, err := os.Stat(file); err == nil {
+			t.Errorf("%s was written", file)
+		}
+	}
+
+	// The pattern endpoints still work
+	if status := do(t, "POST", server.URL+"/patterns/current", "", "", nil); status != http.StatusOK {
+		t.Errorf("POST /patterns/current = %d", status)
+	}
+
+	// Allowed when the server opts in
+	pattern := sequence.New(16)
+	handler := commands.New(pattern, &mockVerboseController{})
+	api := New(handler, pattern, &mockPlayer{})
+	api.SetAllowFiles(true)
+	allowing := httptest.NewServer(api)
+	defer allowing.Close()
+	if status := do(t, "POST", allowing.URL+"/commands", "application/json", `{"commands": ["save a"]}`, nil); status != http.StatusOK {
+		t.Errorf("POST save with files allowed = %d", status)
+	}
+	if _, err := os.Stat("patterns/a.json"); err != nil {
+		t.Errorf("save with files allowed: %v", err)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	server, _, _ := newTestServer(t)
+	request := func(origin string) int {
+		req, _ := http.NewRequest("GET", server.URL+"/transport", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusOK}, // not a browser
+		{server.URL, http.StatusOK},
+		{"http://evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+		{"http://localhost:3000", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := request(tt.origin); got != tt.want {
+			t.Errorf("Origin %q: %d, want %d", tt.origin, got, tt.want)
+		}
+	}
+
+	server.Config.Handler.(*Server).SetOrigins([]string{"http://localhost:3000"})
+	if got := request("http://localhost:3000"); got != http.StatusOK {
+		t.Errorf("allowed origin: %d, want 200", got)
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := map[string]string{
+		":8080":        "127.0.0.1:8080",
+		"8080":         "127.0.0.1:8080",
+		"0.0.0.0:8080": "0.0.0.0:8080",
+		"[::1]:8080":   "[::1]:8080",
+	}
+	for addr, want := range tests {
+		if got := Address(addr); got != want {
+			t.Errorf("Address(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestWebsocketAccept(t *testing.T) {
+	// Example from RFC 6455, section 1.3
+	if got := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("websocketAccept() = %q", got)
+	}
+}
+
+// dialWebSocket performs a client handshake against url's /events endpoint
+func dialWebSocket(t *testing.T, serverURL string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET /events HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake failed: %s %v", resp.Status, resp.Header)
+	}
+	return conn, reader
+}
+
+// readMessage reads one text frame and decodes it
+func readMessage(t *testing.T, reader *bufio.Reader) eventMessage {
+	t.Helper()
+	opcode, payload, err := readFrame(reader)
+	if err != nil || opcode != opText {
+		t.Fatalf("readFrame() = %d, %v", opcode, err)
+	}
+	var msg eventMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		t.Fatalf("invalid message %s: %v", payload, err)
+	}
+	return msg
+}
+
+func TestEventStream(t *testing.T) {
+	server, _, player := newTestServer(t)
+	conn, reader := dialWebSocket(t, server.URL)
+
+	if msg := readMessage(t, reader); msg.Type != "pattern" || msg.Pattern == nil || msg.Pattern.Length != 16 {
+		t.Errorf("first message = %+v, want current pattern", msg)
+	}
+
+	player.events <- playback.Event{Type: playback.EventStep, Step: 5, Loop: 1}
+	player.events <- playback.Event{Type: playback.EventNoteOn, Step: 5, Note: 36, Velocity: 100, Loop: 1}
+	if msg := readMessage(t, reader); msg.Type != "step" || msg.Step != 5 || msg.Loop != 1 {
+		t.Errorf("step message = %+v", msg)
+	}
+	if msg := readMessage(t, reader); msg.Type != "note-on" || msg.NoteName != "C2" || msg.Velocity != 100 {
+		t.Errorf("note-on message = %+v", msg)
+	}
+
+	// Edits from any source are pushed as pattern messages
+	do(t, "POST", server.URL+"/commands", "application/json", `{"commands": ["set 1 G2"]}`, nil)
+	if msg := readMessage(t, reader); msg.Type != "pattern" || len(msg.Pattern.Steps) != 1 || msg.Pattern.Steps[0].Note != "G2" {
+		t.Errorf("pattern change message = %+v", msg)
+	}
+
+	// Masked client ping gets a pong
+	conn.Write([]byte{0x80 | opPing, 0x80 | 2, 1, 2, 3, 4, 'h' ^ 1, 'i' ^ 2})
+	if opcode, payload, err := readFrame(reader); err != nil || opcode != opPong || string(payload) != "hi" {
+		t.Errorf("pong = %d %q %v", opcode, payload, err)
+	}
+
+	if status := do(t, "GET", server.URL+"/events", "", "", nil); status != http.StatusBadRequest {
+		t.Errorf("plain GET /events = %d, want 400", status)
+	}
+
+	// Pages from other sites can't open the stream
+	req, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	for name, value := range map[string]string{"Upgrade": "websocket", "Connection": "Upgrade", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ==",
+		"Sec-WebSocket-Version": "13", "Origin": "http://evil.example"} {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-origin WebSocket upgrade = %d, want 403", resp.StatusCode)
+	}
+}
@@ -0,0 +1,144 @@
+package httpapi
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// A minimal RFC 6455 WebSocket server: enough to push text messages to a
+// browser and notice when it goes away. Fragmented messages from the client
+// are not supported (clients only send control frames here).
+
+// websocketGUID is appended to the client key to compute the accept key
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxClientFrame limits frames read from clients (only control frames are expected)
+const maxClientFrame = 4096
+
+// WebSocket opcodes
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// websocketAccept computes Sec-WebSocket-Accept for a client key
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains reports whether a comma-separated header contains token (case-insensitive)
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket performs the WebSocket handshake and takes over the connection
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		return nil, nil, fmt.Errorf("expected a WebSocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, nil, fmt.Errorf("unsupported WebSocket version (need 13)")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection does not support WebSocket upgrade")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, rw, nil
+}
+
+// writeFrame writes one unmasked, unfragmented frame (server-to-client)
+func writeFrame(w *bufio.Writer, opcode byte, payload []byte) error {
+	w.WriteByte(0x80 | opcode) // FIN + opcode
+
+	switch n := len(payload); {
+	case n < 126:
+		w.WriteByte(byte(n))
+	case n <= 0xFFFF:
+		w.WriteByte(126)
+		binary.Write(w, binary.BigEndian, uint16(n))
+	default:
+		w.WriteByte(127)
+		binary.Write(w, binary.BigEndian, uint64(n))
+	}
+
+	w.Write(payload)
+	return w.Flush()
+}
+
+// readFrame reads one frame from the client, unmasking its payload
+func readFrame(r *bufio.Reader) (opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(n)
+	case 127:
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return 0, nil, err
+		}
+	}
+	if length > maxClientFrame {
+		return 0, nil, errors.New("WebSocket frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
@@ -0,0 +1,205 @@
+// Package mcp serves Interplay as a Model Context Protocol server over
+// stdio, so MCP clients (Claude Desktop, editors, agents) can edit the live
+// pattern with tools such as set_step, set_tempo, get_pattern and save_pattern.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"time"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// ProtocolVersion is the newest MCP revision this server implements
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions are the revisions accepted from clients
+var supportedVersions = []string{"2024-11-05", "2025-03-26", ProtocolVersion}
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Executor runs command lines; *commands.Handler implements it
+type Executor interface {
+	Execute(cmdLine string) error
+}
+
+// Server answers MCP requests for one session
+type Server struct {
+	exec    Executor
+	pattern *sequence.Pattern
+}
+
+// New creates a server. Edits go through exec, so they are serialized with
+// other input sources; pattern is read by get_pattern.
+func New(exec Executor, pattern *sequence.Pattern) *Server {
+	return &Server{exec: exec, pattern: pattern}
+}
+
+// request is a JSON-RPC request or notification (no ID)
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// response is a JSON-RPC response carrying a result or an error
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// Serve reads newline-delimited JSON-RPC messages from r and writes
+// responses to w until r is closed
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReader(r)
+	enc := json.NewEncoder(w)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if resp := s.handle(line); resp != nil {
+				if err := enc.Encode(resp); err != nil {
+					return err
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle processes one message; notifications get no response
+func (s *Server) handle(line []byte) *response {
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		if len(bytes.TrimSpace(line)) == 0 {
+			return nil
+		}
+		return &response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{codeParseError, "parse error: " + err.Error()}}
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return &response{JSONRPC: "2.0", ID: idOrNull(req.ID), Error: &rpcError{codeInvalidRequest, "invalid JSON-RPC 2.0 request"}}
+	}
+
+	start := time.Now()
+	result, err := s.dispatch(req)
+	if err != nil {
+		slog.Warn("mcp request failed", "method", req.Method, "error", err)
+	} else {
+		slog.Info("mcp request", "method", req.Method, "duration", time.Since(start))
+	}
+
+	if req.ID == nil {
+		return nil // notification
+	}
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	if err != nil {
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &rpcError{codeInvalidParams, err.Error()}
+		}
+		resp.Error = rpcErr
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
+
+// dispatch runs a method and returns its result
+func (s *Server) dispatch(req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				return nil, fmt.Errorf("invalid initialize params: %w", err)
+			}
+		}
+		version := ProtocolVersion
+		if slices.Contains(supportedVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "interplay", "version": buildVersion()},
+			"instructions":    instructions,
+		}, nil
+
+	case "ping":
+		return map[string]any{}, nil
+
+	case "tools/list":
+		list := make([]map[string]any, 0, len(tools))
+		for _, t := range tools {
+			list = append(list, map[string]any{
+				"name":        t.name,
+				"description": t.description,
+				"inputSchema": t.schema,
+			})
+		}
+		return map[string]any{"tools": list}, nil
+
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid tools/call params: %w", err)
+		}
+		return s.callTool(params.Name, params.Arguments)
+	}
+
+	if req.ID == nil {
+		return nil, nil // unknown notifications (e.g. notifications/initialized) are ignored
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not found: " + req.Method}
+}
+
+// buildVersion returns the module version from the build info ("(devel)" for local builds)
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// idOrNull returns id, or JSON null when the request had none
+func idOrNull(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return json.RawMessage("null")
+	}
+	return id
+}
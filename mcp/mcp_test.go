@@ -0,0 +1,180 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iltempo/interplay/commands"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// mockVerboseController implements commands.VerboseController for testing
+type mockVerboseController struct{ verbose bool }
+
+func (m *mockVerboseController) SetVerbose(v bool) { m.verbose = v }
+func (m *mockVerboseController) IsVerbose() bool   { return m.verbose }
+
+// session sends newline-delimited requests to a server backed by a real
+// command handler and returns the decoded responses
+func session(t *testing.T, pattern *sequence.Pattern, requests ...string) []response {
+	t.Helper()
+	handler := commands.New(pattern, &mockVerboseController{})
+	var out bytes.Buffer
+	if err := New(handler, pattern).Serve(strings.NewReader(strings.Join(requests, "\n")+"\n"), &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	var responses []response
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var resp response
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+// toolText returns the text and error flag of a tools/call result
+func toolText(t *testing.T, resp response) (string, bool) {
+	t.Helper()
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %v", resp.Error.Message)
+	}
+	result := resp.Result.(map[string]any)
+	content := result["content"].([]any)[0].(map[string]any)
+	return content["text"].(string), result["isError"].(bool)
+}
+
+func TestProtocol(t *testing.T) {
+	responses := session(t, sequence.New(16),
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		``,
+		`{"jsonrpc":"2.0","id":"two","method":"ping"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"resources/list"}`,
+		`not json`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"nope","arguments":{}}}`,
+	)
+	if len(responses) != 6 {
+		t.Fatalf("got %d responses, want 6 (notifications and blank lines get none)", len(responses))
+	}
+
+	init := responses[0].Result.(map[string]any)
+	if init["protocolVersion"] != "2025-03-26" {
+		t.Errorf("protocolVersion = %v, want the client's supported version", init["protocolVersion"])
+	}
+	if _, ok := init["capabilities"].(map[string]any)["tools"]; !ok {
+		t.Error("initialize should advertise the tools capability")
+	}
+
+	if string(responses[1].ID) != `"two"` {
+		t.Errorf("ping ID = %s, want \"two\"", responses[1].ID)
+	}
+
+	listed := responses[2].Result.(map[string]any)["tools"].([]any)
+	if len(listed) != len(tools) {
+		t.Errorf("tools/list returned %d tools, want %d", len(listed), len(tools))
+	}
+	for _, want := range []string{"set_step", "set_tempo", "get_pattern", "save_pattern"} {
+		found := false
+		for _, item := range listed {
+			if item.(map[string]any)["name"] == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("tools/list is missing %s", want)
+		}
+	}
+
+	for i, code := range map[int]int{3: codeMethodNotFound, 4: codeParseError, 5: codeInvalidParams} {
+		if responses[i].Error == nil || responses[i].Error.Code != code {
+			t.Errorf("response %d error = %+v, want code %d", i, responses[i].Error, code)
+		}
+	}
+
+	// Unknown protocol versions get the server's newest
+	responses = session(t, sequence.New(16), `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"1999-01-01"}}`)
+	if v := responses[0].Result.(map[string]any)["protocolVersion"]; v != ProtocolVersion {
+		t.Errorf("protocolVersion = %v, want %s", v, ProtocolVersion)
+	}
+}
+
+func TestTools(t *testing.T) {
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(t.TempDir())
+
+	pattern := sequence.New(16)
+	pattern.Clear()
+	call := func(name, args string) string {
+		return `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + name + `","arguments":` + args + `}}`
+	}
+
+	responses := session(t, pattern,
+		call("set_step", `{"step":1,"note":"C3","velocity":110,"gate":50}`),
+		call("set_tempo", `{"bpm":125}`),
+		call("set_length", `{"steps":8}`),
+		call("run_commands", `{"commands":["set 3 E3","swing 40"]}`),
+		call("save_pattern", `{"name":"groove"}`),
+		call("list_patterns", `{}`),
+		call("get_pattern", `null`),
+	)
+
+	for i := 0; i < 6; i++ {
+		if text, isError := toolText(t, responses[i]); isError {
+			t.Errorf("call %d failed: %s", i, text)
+		}
+	}
+	if text, _ := toolText(t, responses[0]); text != "OK: set 1 C3 vel:110 gate:50" {
+		t.Errorf("set_step = %q", text)
+	}
+	if text, _ := toolText(t, responses[5]); text != "groove" {
+		t.Errorf("list_patterns = %q, want groove", text)
+	}
+
+	var got struct {
+		Tempo int `json:"tempo"`
+		Swing int `json:"swing"`
+		Steps []struct {
+			Step     int    `json:"step"`
+			Note     string `json:"note"`
+			Velocity int    `json:"velocity"`
+		} `json:"steps"`
+	}
+	text, _ := toolText(t, responses[6])
+	if err := json.Unmarshal([]byte(text), &got); err != nil {
+		t.Fatalf("get_pattern returned invalid JSON: %v\n%s", err, text)
+	}
+	if got.Tempo != 125 || got.Swing != 40 || pattern.Length() != 8 {
+		t.Errorf("pattern tempo=%d swing=%d length=%d, want 125, 40, 8", got.Tempo, got.Swing, pattern.Length())
+	}
+	step, _ := pattern.GetStep(1)
+	if step.Note != 48 || step.Velocity != 110 {
+		t.Errorf("step 1 = %+v, want C3 at velocity 110", step)
+	}
+
+	// Failures are tool errors the model can see, not protocol errors
+	responses = session(t, pattern,
+		call("set_step", `{"step":99,"note":"C3"}`),
+		call("set_step", `{"step":1,"note":"C3; clear"}`),
+		call("set_tempo", `{"bpm":"fast"}`),
+		call("set_tempo", `{"bpm":120,"extra":1}`),
+		call("load_pattern", `{"name":"missing"}`),
+		call("run_commands", `{"commands":["tempo 100","bogus","tempo 90"]}`),
+	)
+	for i, resp := range responses {
+		if text, isError := toolText(t, resp); !isError {
+			t.Errorf("call %d should fail, got %q", i, text)
+		}
+	}
+	if pattern.GetBPM() != 100 {
+		t.Errorf("run_commands should stop at the failing command, tempo = %g", pattern.GetBPM())
+	}
+}
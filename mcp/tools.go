@@ -0,0 +1,281 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// instructions tell clients how the tools relate to the sequencer
+const instructions = `Interplay is a live MIDI step sequencer; every change is heard at the next loop.
+Steps are 1-based 16th notes. Notes are names like C3, F#2 or Bb4 (C3 = MIDI 48).
+Use get_pattern to inspect the pattern, the set_* tools for common edits, and
+run_commands for anything else (e.g. "swing 50", "humanize velocity 8", "cc 74 90").`
+
+// tool is an MCP tool; call returns text for the client or an error, which
+// is reported as a tool error so the model can correct itself
+type tool struct {
+	name        string
+	description string
+	schema      map[string]any
+	call        func(s *Server, args json.RawMessage) (string, error)
+}
+
+// object returns a JSON schema for an object with the given properties
+func object(required []string, properties map[string]any) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// integer and str return JSON schemas for tool arguments
+func integer(description string, minimum, maximum int) map[string]any {
+	return map[string]any{"type": "integer", "description": description, "minimum": minimum, "maximum": maximum}
+}
+
+func number(description string, minimum, maximum float64) map[string]any {
+	return map[string]any{"type": "number", "description": description, "minimum": minimum, "maximum": maximum}
+}
+
+func str(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+// tools are listed in this order by tools/list
+var tools = []tool{
+	{
+		name:        "get_pattern",
+		description: "Get the current pattern as JSON: tempo, length, swing, humanization and every step.",
+		schema:      object(nil, map[string]any{}),
+		call:        (*Server).getPattern,
+	},
+	{
+		name:        "set_step",
+		description: "Set a step to a note (or 'rest'), with optional velocity, gate and duration.",
+		schema: object([]string{"step", "note"}, map[string]any{
+			"step":     integer("step number, 1-based", 1, 1024),
+			"note":     str("note name like C3, F#2, Bb4, or 'rest'"),
+			"velocity": integer("note velocity", 1, 127),
+			"gate":     integer("gate length in percent of the step", 1, 100),
+			"duration": integer("note length in steps", 1, 1024),
+		}),
+		call: (*Server).setStep,
+	},
+	{
+		name:        "set_tempo",
+		description: "Set the tempo in BPM.",
+		schema:      object([]string{"bpm"}, map[string]any{"bpm": number("beats per minute, fractions allowed", 20, 300)}),
+		call:        (*Server).setTempo,
+	},
+	{
+		name:        "set_length",
+		description: "Change the pattern length in steps. Shortening drops steps from the end.",
+		schema:      object([]string{"steps"}, map[string]any{"steps": integer("pattern length in steps", 1, 1024)}),
+		call:        (*Server).setLength,
+	},
+	{
+		name:        "clear_pattern",
+		description: "Turn every step into a rest.",
+		schema:      object(nil, map[string]any{}),
+		call:        (*Server).clearPattern,
+	},
+	{
+		name:        "run_commands",
+		description: "Run Interplay commands in order, as typed at the prompt (e.g. 'swing 50', 'velocity 1 110', 'cc 74 90'). Stops at the first failing command.",
+		schema: object([]string{"commands"}, map[string]any{
+			"commands": map[string]any{"type": "array", "items": str("one command"), "description": "commands to run"},
+		}),
+		call: (*Server).runCommands,
+	},
+	{
+		name:        "save_pattern",
+		description: "Save the current pattern under a name.",
+		schema:      object([]string{"name"}, map[string]any{"name": str("pattern name")}),
+		call:        (*Server).savePattern,
+	},
+	{
+		name:        "load_pattern",
+		description: "Load a saved pattern; it starts playing at the next loop.",
+		schema:      object([]string{"name"}, map[string]any{"name": str("pattern name")}),
+		call:        (*Server).loadPattern,
+	},
+	{
+		name:        "list_patterns",
+		description: "List saved pattern names.",
+		schema:      object(nil, map[string]any{}),
+		call:        (*Server).listPatterns,
+	},
+}
+
+// callTool runs a tool and wraps its output as an MCP tool result
+func (s *Server) callTool(name string, args json.RawMessage) (any, error) {
+	for _, t := range tools {
+		if t.name != name {
+			continue
+		}
+		if len(args) == 0 || string(args) == "null" {
+			args = json.RawMessage("{}")
+		}
+		text, err := t.call(s, args)
+		isError := err != nil
+		if isError {
+			text = err.Error()
+		}
+		return map[string]any{
+			"content": []map[string]any{{"type": "text", "text": text}},
+			"isError": isError,
+		}, nil
+	}
+	return nil, &rpcError{codeInvalidParams, "unknown tool: " + name}
+}
+
+// run executes command lines in order and describes what ran
+func (s *Server) run(lines ...string) (string, error) {
+	for i, line := range lines {
+		if err := s.exec.Execute(line); err != nil {
+			if i > 0 {
+				return "", fmt.Errorf("'%s' failed after running %d command(s): %w", line, i, err)
+			}
+			return "", fmt.Errorf("'%s' failed: %w", line, err)
+		}
+	}
+	return "OK: " + strings.Join(lines, "; "), nil
+}
+
+// decode unmarshals tool arguments, rejecting unknown fields
+func decode(args json.RawMessage, v any) error {
+	dec := json.NewDecoder(strings.NewReader(string(args)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) getPattern(args json.RawMessage) (string, error) {
+	pf := s.pattern.ToPatternFile("")
+	pf.CreatedAt = ""
+	data, err := json.MarshalIndent(struct {
+		*sequence.PatternFile
+		Swing        int                   `json:"swing"`
+		Humanization sequence.Humanization `json:"humanization"`
+	}{pf, s.pattern.GetSwing(), s.pattern.GetHumanization()}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *Server) setStep(args json.RawMessage) (string, error) {
+	var a struct {
+		Step     int    `json:"step"`
+		Note     string `json:"note"`
+		Velocity *int   `json:"velocity"`
+		Gate     *int   `json:"gate"`
+		Duration *int   `json:"duration"`
+	}
+	if err := decode(args, &a); err != nil {
+		return "", err
+	}
+	if a.Note == "" || strings.ContainsAny(a.Note, " ;$") {
+		return "", fmt.Errorf("invalid note: %q", a.Note)
+	}
+
+	line := fmt.Sprintf("set %d %s", a.Step, a.Note)
+	if a.Velocity != nil {
+		line += fmt.Sprintf(" vel:%d", *a.Velocity)
+	}
+	if a.Gate != nil {
+		line += fmt.Sprintf(" gate:%d", *a.Gate)
+	}
+	if a.Duration != nil {
+		line += fmt.Sprintf(" dur:%d", *a.Duration)
+	}
+	return s.run(line)
+}
+
+func (s *Server) setTempo(args json.RawMessage) (string, error) {
+	var a struct {
+		BPM float64 `json:"bpm"`
+	}
+	if err := decode(args, &a); err != nil {
+		return "", err
+	}
+	return s.run("tempo " + sequence.FormatBPM(a.BPM))
+}
+
+func (s *Server) setLength(args json.RawMessage) (string, error) {
+	var a struct {
+		Steps int `json:"steps"`
+	}
+	if err := decode(args, &a); err != nil {
+		return "", err
+	}
+	return s.run(fmt.Sprintf("length %d", a.Steps))
+}
+
+func (s *Server) clearPattern(args json.RawMessage) (string, error) {
+	return s.run("clear")
+}
+
+func (s *Server) runCommands(args json.RawMessage) (string, error) {
+	var a struct {
+		Commands []string `json:"commands"`
+	}
+	if err := decode(args, &a); err != nil {
+		return "", err
+	}
+	if len(a.Commands) == 0 {
+		return "", fmt.Errorf("no commands given")
+	}
+	return s.run(a.Commands...)
+}
+
+// validName rejects names that would be split into several arguments or commands
+func validName(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t;$") {
+		return fmt.Errorf("invalid pattern name: %q", name)
+	}
+	return nil
+}
+
+func (s *Server) savePattern(args json.RawMessage) (string, error) {
+	var a struct {
+		Name string `json:"name"`
+	}
+	if err := decode(args, &a); err != nil {
+		return "", err
+	}
+	if err := validName(a.Name); err != nil {
+		return "", err
+	}
+	return s.run("save " + a.Name)
+}
+
+func (s *Server) loadPattern(args json.RawMessage) (string, error) {
+	var a struct {
+		Name string `json:"name"`
+	}
+	if err := decode(args, &a); err != nil {
+		return "", err
+	}
+	if err := validName(a.Name); err != nil {
+		return "", err
+	}
+	return s.run("load " + a.Name)
+}
+
+func (s *Server) listPatterns(args json.RawMessage) (string, error) {
+	names, err := sequence.List()
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "No saved patterns", nil
+	}
+	return strings.Join(names, "\n"), nil
+}
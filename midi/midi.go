@@ -1,17 +1,31 @@
+// Package midi opens MIDI output ports (through RtMidi, so it needs cgo
+// and the system's MIDI libraries). An *Output can be passed to
+// playback.New.
 package midi
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 
 	"gitlab.com/gomidi/midi/v2"
 	"gitlab.com/gomidi/midi/v2/drivers"
 	_ "gitlab.com/gomidi/midi/v2/drivers/rtmididrv" // auto-register RtMIDI driver
 )
 
-// Output represents a MIDI output connection
+// ErrClosed is returned for messages sent after Close
+var ErrClosed = errors.New("MIDI output is closed")
+
+// Output represents a MIDI output connection. It is safe for concurrent
+// use: the playback engine and other senders (a metronome, clock, 'panic')
+// can share one Output. Each message is written whole, one at a time, in
+// the order the calls are made; a message sent while another is being
+// written waits for it. Close may be called more than once.
 type Output struct {
-	port drivers.Out
-	send func(msg midi.Message) error
+	mu     sync.Mutex // held while writing to the port
+	port   drivers.Out
+	send   func(msg midi.Message) error
+	closed bool
 }
 
 // ListPorts returns a list of available MIDI output port names
@@ -24,6 +38,17 @@ func ListPorts() ([]string, error) {
 	return names, nil
 }
 
+// ListInPorts returns a list of available MIDI input port names, indexed
+// like ListPorts
+func ListInPorts() ([]string, error) {
+	ports := midi.GetInPorts()
+	names := make([]string, len(ports))
+	for i, port := range ports {
+		names[i] = port.String()
+	}
+	return names, nil
+}
+
 // Open opens a MIDI output port by index
 func Open(portIndex int) (*Output, error) {
 	port, err := midi.OutPort(portIndex)
@@ -42,22 +67,51 @@ func Open(portIndex int) (*Output, error) {
 	}, nil
 }
 
-// Close closes the MIDI output port
+// Close closes the MIDI output port, after any message being written
 func (o *Output) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil
+	}
+	o.closed = true
 	return o.port.Close()
 }
 
+// Port returns the index of the output port, as in ListPorts
+func (o *Output) Port() int {
+	return o.port.Number()
+}
+
+// IsOpen reports whether the port is open: not closed with Close, and
+// still open in the driver
+func (o *Output) IsOpen() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return !o.closed && o.port.IsOpen()
+}
+
+// write sends a message, unless the port is closed
+func (o *Output) write(msg midi.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return ErrClosed
+	}
+	return o.send(msg)
+}
+
 // NoteOn sends a MIDI Note On message
 // note: MIDI note number (0-127, where C4=60)
 // velocity: note velocity (0-127)
 // channel: MIDI channel (0-15, where 0 = channel 1)
 func (o *Output) NoteOn(channel, note, velocity uint8) error {
-	return o.send(midi.NoteOn(channel, note, velocity))
+	return o.write(midi.NoteOn(channel, note, velocity))
 }
 
 // NoteOff sends a MIDI Note Off message
 func (o *Output) NoteOff(channel, note uint8) error {
-	return o.send(midi.NoteOff(channel, note))
+	return o.write(midi.NoteOff(channel, note))
 }
 
 // SendCC sends a MIDI Control Change (CC) message
@@ -65,5 +119,5 @@ func (o *Output) NoteOff(channel, note uint8) error {
 // ccNumber: CC parameter number (0-127)
 // value: CC parameter value (0-127)
 func (o *Output) SendCC(channel, ccNumber, value uint8) error {
-	return o.send(midi.ControlChange(channel, ccNumber, value))
+	return o.write(midi.ControlChange(channel, ccNumber, value))
 }
@@ -1,7 +1,12 @@
 package midi
 
 import (
+	"errors"
+	"sync"
 	"testing"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
 )
 
 // TestListPorts tests that ListPorts returns without error
@@ -19,6 +24,17 @@ func TestListPorts(t *testing.T) {
 	}
 }
 
+// TestListInPorts tests that ListInPorts returns without error
+func TestListInPorts(t *testing.T) {
+	ports, err := ListInPorts()
+	if err != nil {
+		t.Errorf("ListInPorts() unexpected error: %v", err)
+	}
+	if ports == nil {
+		t.Error("ListInPorts() returned nil instead of empty slice")
+	}
+}
+
 // TestOpenInvalidPort tests opening an invalid port index
 func TestOpenInvalidPort(t *testing.T) {
 	// Try to open a port that definitely doesn't exist
@@ -73,3 +89,95 @@ func TestListPortsReturnType(t *testing.T) {
 		}
 	}
 }
+
+// fakePort is a port that only counts how often it was closed
+type fakePort struct {
+	drivers.Out
+	closes int
+}
+
+func (p *fakePort) Close() error {
+	p.closes++
+	return nil
+}
+
+func (p *fakePort) IsOpen() bool { return p.closes == 0 }
+
+// newFakeOutput returns an Output recording what it sends in sent, which
+// is not safe for concurrent use itself: run with -race to check that
+// Output serializes the writes
+func newFakeOutput(sent *[]midi.Message) (*Output, *fakePort) {
+	port := &fakePort{}
+	return &Output{port: port, send: func(msg midi.Message) error {
+		*sent = append(*sent, msg)
+		return nil
+	}}, port
+}
+
+// TestConcurrentSends tests that messages from several goroutines are all
+// written, one at a time
+func TestConcurrentSends(t *testing.T) {
+	var sent []midi.Message
+	o, _ := newFakeOutput(&sent)
+
+	const senders, messages = 8, 100
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(channel uint8) {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				switch i % 3 {
+				case 0:
+					o.NoteOn(channel, 60, 100)
+				case 1:
+					o.NoteOff(channel, 60)
+				default:
+					o.SendCC(channel, 74, 64)
+				}
+			}
+		}(uint8(s))
+	}
+	wg.Wait()
+
+	if len(sent) != senders*messages {
+		t.Errorf("sent %d messages, want %d", len(sent), senders*messages)
+	}
+}
+
+// TestClose tests that Close closes the port once and later messages fail,
+// also while other goroutines are sending
+func TestClose(t *testing.T) {
+	var sent []midi.Message
+	o, port := newFakeOutput(&sent)
+
+	var wg sync.WaitGroup
+	for s := 0; s < 4; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := o.NoteOn(0, 60, 100); err != nil && !errors.Is(err, ErrClosed) {
+					t.Errorf("NoteOn: %v", err)
+				}
+			}
+		}()
+	}
+	if err := o.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	wg.Wait()
+
+	if err := o.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if port.closes != 1 {
+		t.Errorf("port closed %d times, want 1", port.closes)
+	}
+	if o.IsOpen() {
+		t.Error("IsOpen after Close")
+	}
+	if err := o.SendCC(0, 74, 64); !errors.Is(err, ErrClosed) {
+		t.Errorf("SendCC after Close: %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,180 @@
+// Package osc adds Open Sound Control input and output: commands arrive as
+// /interplay/<command> messages on a UDP port, and playback events can be
+// sent to another host (TouchOSC, Max/MSP, SuperCollider, ...).
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Message is an OSC message with int32, float32 and string arguments
+type Message struct {
+	Address string
+	Args    []any // int32, float32 or string
+}
+
+// MarshalBinary encodes the message in OSC 1.0 format
+func (m Message) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	writeString(&buf, m.Address)
+
+	tags := ","
+	for _, arg := range m.Args {
+		switch arg.(type) {
+		case int32:
+			tags += "i"
+		case float32:
+			tags += "f"
+		case string:
+			tags += "s"
+		default:
+			return nil, fmt.Errorf("unsupported OSC argument type %T", arg)
+		}
+	}
+	writeString(&buf, tags)
+
+	for _, arg := range m.Args {
+		switch v := arg.(type) {
+		case int32:
+			binary.Write(&buf, binary.BigEndian, v)
+		case float32:
+			binary.Write(&buf, binary.BigEndian, math.Float32bits(v))
+		case string:
+			writeString(&buf, v)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeString writes a null-terminated string padded to a multiple of 4 bytes
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteString(s)
+	buf.Write(make([]byte, 4-len(s)%4))
+}
+
+// Parse decodes a packet: a single message or a bundle of messages
+func Parse(data []byte) ([]Message, error) {
+	if bytes.HasPrefix(data, []byte("#bundle\x00")) {
+		return parseBundle(data)
+	}
+	msg, err := parseMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	return []Message{msg}, nil
+}
+
+// parseBundle decodes "#bundle", a time tag (ignored: messages run on
+// arrival), and size-prefixed elements
+func parseBundle(data []byte) ([]Message, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("truncated OSC bundle")
+	}
+	data = data[16:]
+	var msgs []Message
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("truncated OSC bundle")
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		data = data[4:]
+		if size < 0 || size > len(data) {
+			return nil, fmt.Errorf("truncated OSC bundle element")
+		}
+		elements, err := Parse(data[:size])
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, elements...)
+		data = data[size:]
+	}
+	return msgs, nil
+}
+
+// parseMessage decodes one message
+func parseMessage(data []byte) (Message, error) {
+	var msg Message
+	address, rest, err := readString(data)
+	if err != nil {
+		return msg, err
+	}
+	if !strings.HasPrefix(address, "/") {
+		return msg, fmt.Errorf("invalid OSC address: %q", address)
+	}
+	msg.Address = address
+
+	if len(rest) == 0 {
+		return msg, nil // no type tags: no arguments
+	}
+	tags, rest, err := readString(rest)
+	if err != nil {
+		return msg, err
+	}
+	if !strings.HasPrefix(tags, ",") {
+		return msg, fmt.Errorf("invalid OSC type tags: %q", tags)
+	}
+
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i':
+			if len(rest) < 4 {
+				return msg, fmt.Errorf("truncated OSC int argument")
+			}
+			msg.Args = append(msg.Args, int32(binary.BigEndian.Uint32(rest)))
+			rest = rest[4:]
+		case 'f':
+			if len(rest) < 4 {
+				return msg, fmt.Errorf("truncated OSC float argument")
+			}
+			msg.Args = append(msg.Args, math.Float32frombits(binary.BigEndian.Uint32(rest)))
+			rest = rest[4:]
+		case 's':
+			var s string
+			if s, rest, err = readString(rest); err != nil {
+				return msg, err
+			}
+			msg.Args = append(msg.Args, s)
+		case 'T':
+			msg.Args = append(msg.Args, int32(1))
+		case 'F':
+			msg.Args = append(msg.Args, int32(0))
+		default:
+			return msg, fmt.Errorf("unsupported OSC argument type '%c'", tag)
+		}
+	}
+	return msg, nil
+}
+
+// readString reads a padded, null-terminated string
+func readString(data []byte) (string, []byte, error) {
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return "", nil, fmt.Errorf("unterminated OSC string")
+	}
+	padded := (end/4 + 1) * 4
+	if padded > len(data) {
+		return "", nil, fmt.Errorf("truncated OSC string")
+	}
+	return string(data[:end]), data[padded:], nil
+}
+
+// formatArg renders an argument as command text; whole floats become
+// integers, since faders often send 120.0 for 120
+func formatArg(arg any) string {
+	switch v := arg.(type) {
+	case int32:
+		return strconv.Itoa(int(v))
+	case float32:
+		if v == float32(math.Round(float64(v))) {
+			return strconv.Itoa(int(v))
+		}
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,215 @@
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iltempo/interplay/playback"
+)
+
+// recorder is an Executor remembering the commands it ran
+type recorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *recorder) Output() io.Writer {
+	return io.Discard
+}
+
+func (r *recorder) Execute(line string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, line)
+	return nil
+}
+
+func (r *recorder) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.lines...)
+}
+
+func TestMarshalParse(t *testing.T) {
+	tests := []Message{
+		{Address: "/interplay/tempo", Args: []any{int32(120)}},
+		{Address: "/interplay/set", Args: []any{int32(1), "C3"}},
+		{Address: "/interplay/swing", Args: []any{float32(0.5)}},
+		{Address: "/interplay/clear"},
+		{Address: "/abc", Args: []any{"abcd"}}, // string exactly 4 bytes still gets a terminator
+	}
+	for _, msg := range tests {
+		data, err := msg.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary(%v): %v", msg, err)
+		}
+		if len(data)%4 != 0 {
+			t.Errorf("MarshalBinary(%v) length %d is not a multiple of 4", msg, len(data))
+		}
+		got, err := Parse(data)
+		if err != nil {
+			t.Fatalf("Parse(%v): %v", msg, err)
+		}
+		if len(got) != 1 || got[0].Address != msg.Address || len(got[0].Args) != len(msg.Args) ||
+			(len(msg.Args) > 0 && !reflect.DeepEqual(got[0].Args, msg.Args)) {
+			t.Errorf("round trip of %v = %v", msg, got)
+		}
+	}
+
+	// Known encoding from the OSC 1.0 spec style
+	data, _ := Message{Address: "/oscillator/4/frequency", Args: []any{float32(440)}}.MarshalBinary()
+	want := append([]byte("/oscillator/4/frequency\x00,f\x00\x00"), 0x43, 0xdc, 0x00, 0x00)
+	if !bytes.Equal(data, want) {
+		t.Errorf("MarshalBinary = % x, want % x", data, want)
+	}
+
+	if _, err := (Message{Address: "/x", Args: []any{1.5}}).MarshalBinary(); err == nil {
+		t.Error("expected error for float64 argument")
+	}
+}
+
+func TestParseBundle(t *testing.T) {
+	first, _ := Message{Address: "/interplay/tempo", Args: []any{int32(100)}}.MarshalBinary()
+	second, _ := Message{Address: "/interplay/clear"}.MarshalBinary()
+
+	var bundle bytes.Buffer
+	bundle.WriteString("#bundle\x00")
+	binary.Write(&bundle, binary.BigEndian, uint64(1)) // time tag "immediately"
+	for _, element := range [][]byte{first, second} {
+		binary.Write(&bundle, binary.BigEndian, uint32(len(element)))
+		bundle.Write(element)
+	}
+
+	msgs, err := Parse(bundle.Bytes())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Address != "/interplay/tempo" || msgs[1].Address != "/interplay/clear" {
+		t.Errorf("Parse bundle = %v", msgs)
+	}
+
+	for _, bad := range [][]byte{
+		[]byte("#bundle\x00"),
+		[]byte("interplay\x00\x00\x00"),
+		[]byte("/x\x00\x00,i\x00\x00"),
+		[]byte("/x\x00\x00,q\x00\x00"),
+		[]byte("/unterminated"),
+	} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q): expected error", bad)
+		}
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		msg     Message
+		want    string
+		wantErr bool
+	}{
+		{Message{"/interplay/set", []any{int32(1), "C3"}}, "set 1 C3", false},
+		{Message{"/interplay/tempo", []any{float32(120)}}, "tempo 120", false},
+		{Message{"/interplay/swing", []any{float32(12.5)}}, "swing 12.5", false},
+		{Message{"/interplay/clear", nil}, "clear", false},
+		{Message{"/interplay/command", []any{"tempo 90; swing 20"}}, "tempo 90; swing 20", false},
+		{Message{"/interplay/command", []any{int32(1)}}, "", true},
+		{Message{"/interplay/", nil}, "", true},
+		{Message{"/interplay/set/1", nil}, "", true},
+		{Message{"/other/set", nil}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := CommandLine(tt.msg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CommandLine(%v) error = %v, wantErr %v", tt.msg, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CommandLine(%v) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	rec := &recorder{}
+	server, err := Listen("127.0.0.1:0", rec)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer server.Close()
+	go server.Serve()
+
+	conn, err := net.Dial("udp", server.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	for _, msg := range []Message{
+		{Address: "/interplay/tempo", Args: []any{int32(120)}},
+		{Address: "/elsewhere"},
+		{Address: "/interplay/set", Args: []any{int32(1), "C3"}},
+	} {
+		data, _ := msg.MarshalBinary()
+		conn.Write(data)
+	}
+
+	want := []string{"tempo 120", "set 1 C3"}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.Lines()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := rec.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("executed %q, want %q", got, want)
+	}
+}
+
+func TestSenderForward(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+
+	sender, err := Dial(listener.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer sender.Close()
+
+	events := make(chan playback.Event, 8)
+	events <- playback.Event{Type: playback.EventStep, Step: 1, Loop: 2}
+	events <- playback.Event{Type: playback.EventNoteOn, Step: 1, Note: 48, Velocity: 100}
+	events <- playback.Event{Type: playback.EventStep, Step: 2, Loop: 2}
+	events <- playback.Event{Type: playback.EventLoop, Loop: 3}
+	close(events)
+	sender.Forward(events)
+
+	want := []Message{
+		{"/interplay/step", []any{int32(1), int32(2)}},
+		{"/interplay/beat", []any{int32(1), int32(2)}},
+		{"/interplay/note", []any{int32(48), int32(100)}},
+		{"/interplay/step", []any{int32(2), int32(2)}},
+		{"/interplay/loop", []any{int32(3)}},
+	}
+	buf := make([]byte, maxPacketSize)
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, w := range want {
+		n, _, err := listener.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		got, err := Parse(buf[:n])
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		if len(got) != 1 || !reflect.DeepEqual(got[0], w) {
+			t.Errorf("received %v, want %v", got, w)
+		}
+	}
+}
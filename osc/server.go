@@ -0,0 +1,185 @@
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/iltempo/interplay/playback"
+)
+
+// AddressPrefix starts every Interplay OSC address
+const AddressPrefix = "/interplay/"
+
+// maxPacketSize is the largest UDP packet read
+const maxPacketSize = 65536
+
+// Executor runs a command line and says where its output goes;
+// *commands.Handler implements it
+type Executor interface {
+	Execute(cmdLine string) error
+	Output() io.Writer
+}
+
+// CommandLine converts a message to a command line: /interplay/set 1 "C3"
+// becomes "set 1 C3". /interplay/command runs its string argument as typed,
+// e.g. "tempo 120; swing 40".
+func CommandLine(msg Message) (string, error) {
+	command, ok := strings.CutPrefix(msg.Address, AddressPrefix)
+	if !ok || command == "" || strings.Contains(command, "/") {
+		return "", fmt.Errorf("unsupported OSC address: %s (use %s<command>)", msg.Address, AddressPrefix)
+	}
+
+	if command == "command" {
+		if len(msg.Args) != 1 {
+			return "", fmt.Errorf("%scommand takes one string argument", AddressPrefix)
+		}
+		line, ok := msg.Args[0].(string)
+		if !ok {
+			return "", fmt.Errorf("%scommand takes one string argument", AddressPrefix)
+		}
+		return line, nil
+	}
+
+	parts := []string{command}
+	for _, arg := range msg.Args {
+		parts = append(parts, formatArg(arg))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// ListenAddr returns the UDP address for an --osc-listen value; a bare
+// port listens on all interfaces, so controllers on the network can reach it
+func ListenAddr(addr string) string {
+	if _, err := strconv.Atoi(addr); err == nil {
+		return ":" + addr
+	}
+	return addr
+}
+
+// Server receives OSC commands over UDP
+type Server struct {
+	conn net.PacketConn
+	exec Executor
+}
+
+// Listen opens a UDP port for OSC input (see ListenAddr). Call Serve to process messages.
+func Listen(addr string, exec Executor) (*Server, error) {
+	conn, err := net.ListenPacket("udp", ListenAddr(addr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for OSC on %s: %w", addr, err)
+	}
+	return &Server{conn: conn, exec: exec}, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Serve runs received commands until Close is called
+func (s *Server) Serve() error {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		msgs, err := Parse(buf[:n])
+		if err != nil {
+			slog.Warn("invalid OSC packet", "from", from.String(), "error", err)
+			continue
+		}
+		for _, msg := range msgs {
+			s.handle(msg)
+		}
+	}
+}
+
+// handle runs one message as a command; OSC has no replies, so errors
+// are shown on the console and logged
+func (s *Server) handle(msg Message) {
+	line, err := CommandLine(msg)
+	if err != nil {
+		slog.Warn("OSC message ignored", "address", msg.Address, "error", err)
+		fmt.Fprintf(s.exec.Output(), "[osc] %v\n", err)
+		return
+	}
+
+	fmt.Fprintln(s.exec.Output(), "[osc] >", line)
+	if err := s.exec.Execute(line); err != nil {
+		fmt.Fprintf(s.exec.Output(), "[osc] Error: %v\n", err)
+	}
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// Sender sends playback events to an OSC host
+type Sender struct {
+	conn net.Conn
+}
+
+// Dial creates a sender for host:port
+func Dial(addr string) (*Sender, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OSC output to %s: %w", addr, err)
+	}
+	return &Sender{conn: conn}, nil
+}
+
+// Send sends one message
+func (s *Sender) Send(msg Message) error {
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Write(data)
+	return err
+}
+
+// Forward sends playback events until the channel is closed:
+//
+//	/interplay/step <step> <loop>   every step (1-based)
+//	/interplay/beat <beat> <loop>   every quarter note (1-based within the pattern)
+//	/interplay/note <note> <vel>    every note on
+//	/interplay/loop <loop>          every loop boundary
+func (s *Sender) Forward(events <-chan playback.Event) {
+	for ev := range events {
+		var msgs []Message
+		switch ev.Type {
+		case playback.EventStep:
+			msgs = append(msgs, Message{AddressPrefix + "step", []any{int32(ev.Step), int32(ev.Loop)}})
+			if (ev.Step-1)%4 == 0 {
+				msgs = append(msgs, Message{AddressPrefix + "beat", []any{int32((ev.Step-1)/4 + 1), int32(ev.Loop)}})
+			}
+		case playback.EventNoteOn:
+			msgs = append(msgs, Message{AddressPrefix + "note", []any{int32(ev.Note), int32(ev.Velocity)}})
+		case playback.EventLoop:
+			msgs = append(msgs, Message{AddressPrefix + "loop", []any{int32(ev.Loop)}})
+		}
+
+		for _, msg := range msgs {
+			if err := s.Send(msg); err != nil {
+				// UDP errors (e.g. nobody listening) shouldn't disturb playback
+				slog.Debug("OSC send failed", "address", msg.Address, "error", err)
+			}
+		}
+	}
+}
+
+// Close closes the sender
+func (s *Sender) Close() error {
+	return s.conn.Close()
+}
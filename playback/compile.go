@@ -0,0 +1,98 @@
+package playback
+
+import (
+	"sort"
+	"time"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// ccValue is a control change to send
+type ccValue struct {
+	cc, value int
+}
+
+// compiledStep is a step with its defaults, swing and CCs worked out
+type compiledStep struct {
+	note     uint8
+	play     bool // a note to play: not a rest, muted or out of range
+	muted    bool
+	velocity uint8
+	gate     int // percent of duration
+	gateMs   int
+	duration int
+	swing    time.Duration // delay of the Note On
+	ccs      []ccValue     // sent before the note, by CC number
+}
+
+// compiledPattern is a pattern ready to play: everything the playback loop
+// would otherwise work out each step, so playing a step allocates nothing
+// and takes no locks however long the pattern is. Humanization and the
+// velocity curve are still applied as each note plays, since they change
+// from loop to loop.
+type compiledPattern struct {
+	pattern        *sequence.Pattern
+	steps          []compiledStep
+	loopCCs        []ccValue // the volume, then global CCs, sent each loop
+	stepDurationMs float64
+	stepDuration   time.Duration
+	stepsPerBar    int // where a cued pattern may start, see Engine.CueBar
+}
+
+// compile prepares a pattern to play; the pattern must not change afterwards
+func compile(p *sequence.Pattern) *compiledPattern {
+	// At 80 BPM: quarter note = 750ms, sixteenth note = 187.5ms
+	stepDurationMs := (60_000.0 / p.BPM) * 4.0 / float64(p.GetResolution())
+	c := &compiledPattern{
+		pattern:        p,
+		steps:          make([]compiledStep, len(p.Steps)),
+		stepDurationMs: stepDurationMs,
+		stepDuration:   time.Duration(stepDurationMs * float64(time.Millisecond)),
+		stepsPerBar:    p.StepsPerBar(),
+	}
+
+	if volume, ok := p.GetVolume(); ok {
+		c.loopCCs = append(c.loopCCs, ccValue{sequence.CCVolume, volume})
+	}
+	c.loopCCs = append(c.loopCCs, sortedCCs(p.GetAllGlobalCC())...)
+
+	for i, step := range p.Steps {
+		s := compiledStep{
+			note:     step.Note,
+			play:     !step.IsRest && !step.Muted && step.Note < 128,
+			muted:    step.Muted,
+			velocity: step.Velocity,
+			gate:     step.Gate,
+			gateMs:   step.GateMs,
+			duration: max(step.Duration, 1),
+		}
+		if s.velocity == 0 {
+			s.velocity = 100 // default
+		}
+		if s.gate == 0 {
+			s.gate = 90 // default
+		}
+		// Swing delays the second 16th or 8th of each pair
+		if delay := p.SwingDelay(i); delay > 0 {
+			s.swing = time.Duration(stepDurationMs * float64(delay) / 100.0 * float64(time.Millisecond))
+		}
+		if !step.Muted {
+			s.ccs = sortedCCs(step.CCValues)
+		}
+		c.steps[i] = s
+	}
+	return c
+}
+
+// sortedCCs returns CC values ordered by CC number, nil for none
+func sortedCCs(values map[int]int) []ccValue {
+	if len(values) == 0 {
+		return nil
+	}
+	ccs := make([]ccValue, 0, len(values))
+	for cc, value := range values {
+		ccs = append(ccs, ccValue{cc, value})
+	}
+	sort.Slice(ccs, func(a, b int) bool { return ccs[a].cc < ccs[b].cc })
+	return ccs
+}
@@ -0,0 +1,111 @@
+package playback
+
+import (
+	"time"
+)
+
+// EventType identifies what happened in the playback loop
+type EventType int
+
+const (
+	// EventStep fires at the start of every step (rests included)
+	EventStep EventType = iota
+	// EventNoteOn fires after a Note On message is sent
+	EventNoteOn
+	// EventNoteOff fires after a Note Off message is sent
+	EventNoteOff
+	// EventLoop fires at the loop boundary, after the next pattern is swapped
+	// in; BPM is the tempo the new loop plays at
+	EventLoop
+	// EventSendFailed fires when a MIDI message can't be sent after retrying,
+	// e.g. the device was unplugged; Err is why. It fires once until sending
+	// works again.
+	EventSendFailed
+	// EventSendRecovered fires when a MIDI message is sent after a failure
+	EventSendRecovered
+)
+
+// String returns a short name for the event type
+func (t EventType) String() string {
+	switch t {
+	case EventStep:
+		return "step"
+	case EventNoteOn:
+		return "note-on"
+	case EventNoteOff:
+		return "note-off"
+	case EventLoop:
+		return "loop"
+	case EventSendFailed:
+		return "send-failed"
+	case EventSendRecovered:
+		return "send-recovered"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes something that happened in the playback loop.
+// Step is 1-based; Note and Velocity are only set for note events.
+type Event struct {
+	Type     EventType
+	Step     int
+	Note     uint8
+	Velocity uint8
+	Loop     int     // number of completed loop iterations
+	BPM      float64 // tempo of the loop starting, for EventLoop
+	Err      error   // the send error, for EventSendFailed
+	Time     time.Time
+}
+
+// defaultEventBuffer is used when Subscribe is called with a non-positive size
+const defaultEventBuffer = 64
+
+// Subscribe returns a channel receiving playback events.
+// Events are delivered without blocking the playback loop: if the
+// subscriber's buffer is full, the event is dropped for that subscriber.
+func (e *Engine) Subscribe(buffer int) <-chan Event {
+	if buffer <= 0 {
+		buffer = defaultEventBuffer
+	}
+	ch := make(chan Event, buffer)
+
+	e.eventsMu.Lock()
+	defer e.eventsMu.Unlock()
+	if e.subscribers == nil {
+		e.subscribers = make(map[<-chan Event]chan Event)
+	}
+	e.subscribers[ch] = ch
+	return ch
+}
+
+// Unsubscribe stops delivery to a channel returned by Subscribe and closes it
+func (e *Engine) Unsubscribe(ch <-chan Event) {
+	e.eventsMu.Lock()
+	defer e.eventsMu.Unlock()
+
+	if sub, ok := e.subscribers[ch]; ok {
+		delete(e.subscribers, ch)
+		close(sub)
+	}
+}
+
+// publish sends an event to all subscribers without blocking
+func (e *Engine) publish(ev Event) {
+	e.eventsMu.RLock()
+	defer e.eventsMu.RUnlock()
+
+	if len(e.subscribers) == 0 {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	for _, sub := range e.subscribers {
+		select {
+		case sub <- ev:
+		default:
+			// Slow subscriber: drop rather than stall playback timing
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package playback
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// SetMonitor writes a line to w for every MIDI message the engine sends:
+// the time, message type, channel and data, and the error of a failed
+// send. nil stops it. Lines are written from the playback loop, so w
+// should be quick to write to, like the console or a file.
+func (e *Engine) SetMonitor(w io.Writer) {
+	e.monitorMu.Lock()
+	defer e.monitorMu.Unlock()
+	e.monitor = w
+}
+
+// String returns the name of the message kind as the monitor shows it
+func (k messageKind) String() string {
+	switch k {
+	case noteOnMessage:
+		return "note-on"
+	case noteOffMessage:
+		return "note-off"
+	default:
+		return "cc"
+	}
+}
+
+// monitorMessage writes a message sent to the monitor, if one is set
+func (e *Engine) monitorMessage(kind messageKind, channel, data1, data2 uint8, err error) {
+	e.monitorMu.RLock()
+	defer e.monitorMu.RUnlock()
+	if e.monitor == nil {
+		return
+	}
+
+	var data string
+	switch kind {
+	case noteOnMessage:
+		data = fmt.Sprintf("%s (%d) vel %d", sequence.MIDIToNoteName(data1), data1, data2)
+	case noteOffMessage:
+		data = fmt.Sprintf("%s (%d)", sequence.MIDIToNoteName(data1), data1)
+	case ccMessage:
+		data = fmt.Sprintf("cc %d = %d", data1, data2)
+	}
+	if err != nil {
+		data += fmt.Sprintf("  FAILED: %v", err)
+	}
+	fmt.Fprintf(e.monitor, "%s %-8s ch %-2d %s\n", e.clock.Now().Format("15:04:05.000"), kind, channel+1, data)
+}
@@ -1,33 +1,83 @@
+// Package playback plays a sequence.Pattern in a loop, sending its notes
+// and CC automation to an Output. Edits to the pattern returned by
+// Engine.GetNextPattern take effect at the start of the next loop, and
+// Subscribe streams what happens as it plays.
 package playback
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"math/rand"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/iltempo/interplay/midi"
 	"github.com/iltempo/interplay/sequence"
 )
 
+// Output receives the MIDI messages the engine plays. *midi.Output sends
+// them to a MIDI port; embedding programs can pass their own, e.g. to
+// record or forward them.
+type Output interface {
+	NoteOn(channel, note, velocity uint8) error
+	NoteOff(channel, note uint8) error
+	SendCC(channel, ccNumber, value uint8) error
+}
+
+// clock is the time source of the playback loop, replaced by a fake clock
+// in tests
+type clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
 // Engine manages the playback loop
 type Engine struct {
-	midiOut        *midi.Output
-	currentPattern *sequence.Pattern
+	midiOut        Output
+	clock          clock
+	currentPattern *compiledPattern // only the playback loop's, compiled, never changed
+	playedVersion  uint64           // nextPattern's version currentPattern was cloned at
+	cueVersion     uint64           // nextPattern's version to start at the next bar, see CueBar
+	loopFirst      int              // first step played each loop (1-based), 0 = all steps, see LoopSteps
+	loopLast       int              // last step played each loop
 	nextPattern    *sequence.Pattern
 	mu             sync.RWMutex
 	stopChan       chan struct{}
 	stoppedChan    chan struct{}
 	verbose        bool
+	out            io.Writer // where verbose output goes, see SetOutput
 	verboseMu      sync.RWMutex
+	subscribers    map[<-chan Event]chan Event
+	eventsMu       sync.RWMutex
+	loopCount      int
+	channel        uint8          // MIDI channel (0-indexed)
+	velocityCurve  *VelocityCurve // output velocity mapping, nil = linear
+	resumeChan     chan struct{}  // non-nil while paused, closed on Resume
+	realtime       bool           // raise the loop thread's priority (SetRealtime)
+	muted          atomic.Bool    // keep time but play no notes (SetMuted)
+	sendFailing    bool           // the last MIDI message failed, see send
+	monitor        io.Writer      // gets each MIDI message sent, see SetMonitor
+	monitorMu      sync.RWMutex
+	pauseMu        sync.Mutex
 }
 
-// New creates a new playback engine
-func New(midiOut *midi.Output, initialPattern *sequence.Pattern) *Engine {
+// New creates a new playback engine sending to midiOut
+func New(midiOut Output, initialPattern *sequence.Pattern) *Engine {
 	return &Engine{
 		midiOut:        midiOut,
-		currentPattern: initialPattern,
+		clock:          realClock{},
+		currentPattern: compile(initialPattern.Clone()),
 		nextPattern:    initialPattern.Clone(),
+		out:            os.Stdout,
 		stopChan:       make(chan struct{}),
 		stoppedChan:    make(chan struct{}),
 	}
@@ -40,6 +90,39 @@ func (e *Engine) GetNextPattern() *sequence.Pattern {
 	return e.nextPattern
 }
 
+// LoopCount returns the number of completed loop iterations
+func (e *Engine) LoopCount() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.loopCount
+}
+
+// SetChannel selects the MIDI output channel (1-16). Call before Start.
+func (e *Engine) SetChannel(channel int) error {
+	if channel < 1 || channel > 16 {
+		return fmt.Errorf("MIDI channel must be 1-16, got %d", channel)
+	}
+	e.mu.Lock()
+	e.channel = uint8(channel - 1)
+	e.mu.Unlock()
+	return nil
+}
+
+// SetVelocityCurve sets the output velocity mapping (nil = linear). It takes
+// effect at the next loop iteration.
+func (e *Engine) SetVelocityCurve(curve *VelocityCurve) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.velocityCurve = curve
+}
+
+// VelocityCurve returns the output velocity mapping (nil = linear)
+func (e *Engine) VelocityCurve() *VelocityCurve {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.velocityCurve
+}
+
 // SetVerbose enables or disables step-by-step output
 func (e *Engine) SetVerbose(verbose bool) {
 	e.verboseMu.Lock()
@@ -54,6 +137,20 @@ func (e *Engine) IsVerbose() bool {
 	return e.verbose
 }
 
+// SetOutput sends verbose step output to w instead of stdout
+func (e *Engine) SetOutput(w io.Writer) {
+	e.verboseMu.Lock()
+	defer e.verboseMu.Unlock()
+	e.out = w
+}
+
+// verbosef prints verbose step output
+func (e *Engine) verbosef(format string, args ...any) {
+	e.verboseMu.RLock()
+	defer e.verboseMu.RUnlock()
+	fmt.Fprintf(e.out, format, args...)
+}
+
 // Start begins the playback loop in a goroutine
 func (e *Engine) Start() {
 	go e.playbackLoop()
@@ -69,109 +166,225 @@ func (e *Engine) Stop() {
 func (e *Engine) playbackLoop() {
 	defer close(e.stoppedChan)
 
-	const channel = 0 // MIDI channel 1 (0-indexed)
+	e.mu.RLock()
+	channel := e.channel
+	realtime := e.realtime
+	e.mu.RUnlock()
+	if realtime {
+		startRealtime()
+	}
+
+	// debug is checked once per loop: building the arguments of a
+	// slog.Debug call allocates even when debug logging is off
+	debug := false
+
+	// Failed sends are logged here and reported to subscribers by send (as
+	// EventSendFailed), rather than printed each time
+
+	// sendNoteOff turns a note off and notifies event subscribers
+	sendNoteOff := func(note uint8, step int) {
+		err := e.send(noteOffMessage, channel, note, 0)
+		if err != nil {
+			slog.Error("MIDI note off failed", "note", note, "step", step, "error", err)
+		} else if debug {
+			slog.Debug("note off", "note", note, "step", step, "loop", e.loopCount)
+		}
+		e.publish(Event{Type: EventNoteOff, Step: step, Note: note, Loop: e.loopCount})
+	}
+
+	// sendCC sends a control change, logging it
+	sendCC := func(ccNum, value, step int) {
+		err := e.send(ccMessage, channel, uint8(ccNum), uint8(value))
+		if err != nil {
+			slog.Error("MIDI CC failed", "cc", ccNum, "value", value, "step", step, "error", err)
+		} else if debug {
+			slog.Debug("cc", "cc", ccNum, "value", value, "step", step)
+		}
+	}
+
+	// Track active notes with countdown timers: the steps each note has
+	// left to sound, by note number (0 = not sounding). A fixed table keeps
+	// the hot loop free of map allocations. Notes carry over into the next
+	// loop iteration unless the pattern cuts them (see the loop boundary).
+	var activeNotes [128]int
+
+	// The step (0-based) each sounding note started on, to tell whether the
+	// pattern swapped in at the loop boundary still plays it
+	var noteStarts [128]int
+
+	// Notes with a gate in milliseconds end at a time instead: gateEnds
+	// holds when each stops (zero = not sounding), gated how many there are
+	var gateEnds [128]time.Time
+	gated := 0
+
+	// sounding reports whether a note is still on, by either count
+	sounding := func(note uint8) bool {
+		return activeNotes[note] > 0 || !gateEnds[note].IsZero()
+	}
+	// forget stops tracking a note without sending anything
+	forget := func(note uint8) {
+		activeNotes[note] = 0
+		if !gateEnds[note].IsZero() {
+			gateEnds[note] = time.Time{}
+			gated--
+		}
+	}
+	allNotesOff := func(step int) {
+		for note := range activeNotes {
+			if sounding(uint8(note)) {
+				sendNoteOff(uint8(note), step)
+				forget(uint8(note))
+			}
+		}
+	}
+	// releaseGates sleeps through the millisecond gates ending before
+	// until, turning each note off on time
+	releaseGates := func(until time.Time, step int) {
+		for gated > 0 {
+			var next time.Time
+			for note := range gateEnds {
+				if end := gateEnds[note]; !end.IsZero() && (next.IsZero() || end.Before(next)) {
+					next = end
+				}
+			}
+			if next.After(until) {
+				return
+			}
+			if wait := next.Sub(e.clock.Now()); wait > 0 {
+				e.clock.Sleep(wait)
+			}
+			for note := range gateEnds {
+				if end := gateEnds[note]; !end.IsZero() && !end.After(next) {
+					sendNoteOff(uint8(note), step)
+					forget(uint8(note))
+				}
+			}
+		}
+	}
+	// sleepUntil waits until the given time, ending notes with millisecond
+	// gates on the way
+	sleepUntil := func(until time.Time, step int) {
+		releaseGates(until, step)
+		if wait := until.Sub(e.clock.Now()); wait > 0 {
+			e.clock.Sleep(wait)
+		}
+	}
+
+	// How far a swung 8th ran past the end of its step
+	var swungPast time.Duration
 
 	for {
-		// Atomically get a clone of the current pattern for this loop iteration.
-		// This is the most important part of the concurrency model.
-		// The playback loop operates on a completely isolated copy of the pattern.
+		// The current pattern is the playback loop's own copy, which nothing
+		// else changes: this is the most important part of the concurrency
+		// model. It is replaced, never modified, at the loop boundary.
 		e.mu.RLock()
-		pattern := e.currentPattern.Clone()
+		compiled := e.currentPattern
+		pattern := compiled.pattern
+		velocityCurve := e.velocityCurve
+		loopFirst, loopLast := e.loopFirst, e.loopLast
 		e.mu.RUnlock()
+		debug = slog.Default().Enabled(context.Background(), slog.LevelDebug)
 
 		bpm := pattern.BPM
 		numSteps := len(pattern.Steps)
 
-		// Calculate step duration in milliseconds
-		// At 80 BPM: quarter note = 750ms, sixteenth note = 187.5ms
-		stepDurationMs := (60_000.0 / float64(bpm)) / 4.0
-		stepDuration := time.Duration(stepDurationMs * float64(time.Millisecond))
+		// A loop region (LoopSteps) plays only its steps
+		firstStep := 0
+		if loopFirst > 0 && loopFirst <= numSteps {
+			firstStep = loopFirst - 1
+			numSteps = min(max(loopLast, loopFirst), numSteps)
+		}
 
-		// Track active notes with countdown timers
-		// map: note number -> remaining steps
-		activeNotes := make(map[uint8]int)
+		stepDuration := compiled.stepDuration
 
-		// Send global CC messages at the start of each loop iteration
-		globalCC := pattern.GetAllGlobalCC()
-		if len(globalCC) > 0 {
-			for ccNum, value := range globalCC {
-				err := e.midiOut.SendCC(channel, uint8(ccNum), uint8(value))
-				if err != nil {
-					fmt.Printf("Error sending global CC#%d: %v\n", ccNum, err)
-				}
-			}
+		// Send the pattern volume, then global CC messages, at the start of
+		// each loop iteration (so 'cc volume' can override the saved volume)
+		for _, cc := range compiled.loopCCs {
+			sendCC(cc.cc, cc.value, 0)
 		}
 
 		// Play all steps in the pattern
-		for stepIdx := 0; stepIdx < numSteps; stepIdx++ {
+		for stepIdx := firstStep; stepIdx < numSteps; stepIdx++ {
+			// A cued pattern starts at the next bar, ending this loop early
+			if stepIdx > firstStep && stepIdx%compiled.stepsPerBar == 0 && e.cued() {
+				numSteps = stepIdx
+				break
+			}
+
 			// Check for stop signal
 			select {
 			case <-e.stopChan:
 				// Turn off all active notes before stopping
-				for note := range activeNotes {
-					e.midiOut.NoteOff(channel, note)
-				}
+				allNotesOff(stepIdx + 1)
 				return
 			default:
 			}
 
-			stepStart := time.Now()
+			// Pause: silence sounding notes and wait for Resume (or Stop)
+			if resume := e.pausedChan(); resume != nil {
+				allNotesOff(stepIdx + 1)
+				select {
+				case <-resume:
+				case <-e.stopChan:
+					return
+				}
+			}
+
+			stepStart := e.clock.Now()
+			catchUp := swungPast
+			swungPast = 0
+			e.publish(Event{Type: EventStep, Step: stepIdx + 1, Loop: e.loopCount, Time: stepStart})
 
 			// Decrement active note counters and send NoteOff if they expire
-			for note, stepsRemaining := range activeNotes {
-				if stepsRemaining-1 <= 0 {
-					err := e.midiOut.NoteOff(channel, note)
-					if err != nil {
-						fmt.Printf("Error sending Note Off: %v\n", err)
-					}
-					delete(activeNotes, note)
-				} else {
+			for note, stepsRemaining := range &activeNotes {
+				switch {
+				case stepsRemaining == 0:
+				case stepsRemaining == 1:
+					sendNoteOff(uint8(note), stepIdx+1)
+					activeNotes[note] = 0
+				default:
 					activeNotes[note] = stepsRemaining - 1
 				}
 			}
 
-			// Get the current step from our cloned pattern
-			step := pattern.Steps[stepIdx]
+			// Get the current step, compiled from our cloned pattern
+			step := &compiled.steps[stepIdx]
 
-			// Send CC messages for this step (even on rest steps)
-			// This allows parameter automation without notes (e.g., filter sweeps on sustained notes)
-			if len(step.CCValues) > 0 {
-				for ccNum, value := range step.CCValues {
-					err := e.midiOut.SendCC(channel, uint8(ccNum), uint8(value))
-					if err != nil {
-						fmt.Printf("Error sending CC#%d: %v\n", ccNum, err)
-					}
-				}
+			// Send CC messages for this step (even on rest steps), before its
+			// Note On so parameters are set before the note triggers. This
+			// allows parameter automation without notes (e.g., filter sweeps
+			// on sustained notes). Muted steps have none.
+			for _, cc := range step.ccs {
+				sendCC(cc.cc, cc.value, stepIdx+1)
 			}
 
-			if !step.IsRest {
-				velocity := step.Velocity
-				if velocity == 0 {
-					velocity = 100 // default
-				}
-				gate := step.Gate
-				if gate == 0 {
-					gate = 90 // default
-				}
-				duration := step.Duration
-				if duration < 1 {
-					duration = 1 // default
-				}
+			// Muted playback keeps time, but sounding notes stop and no new
+			// ones start
+			muted := e.muted.Load()
+			if muted {
+				allNotesOff(stepIdx + 1)
+			}
+
+			// Muted steps keep their contents but play nothing
+			if !muted && step.play {
+				duration := step.duration
 
-				// Apply swing timing (delays even-numbered steps)
-				if pattern.SwingPercent > 0 && (stepIdx%2 == 1) {
-					// Step indices are 0-based, so stepIdx%2==1 means steps 2, 4, 6, etc.
-					swingDelay := time.Duration(stepDurationMs*float64(pattern.SwingPercent)/100.0) * time.Millisecond
-					time.Sleep(swingDelay)
+				// Apply swing timing (delays the second 16th or 8th of each pair)
+				if step.swing > 0 {
+					sleepUntil(e.clock.Now().Add(step.swing), stepIdx+1)
+					// A swung 8th can start after its step ends; the next
+					// step catches up
+					swungPast = max(step.swing-stepDuration, 0)
 				}
 
-				// Apply humanization to velocity and gate
-				humanizedVelocity, humanizedGate := applyHumanization(velocity, gate, pattern.Humanization)
+				// Apply humanization to velocity and gate, then the output velocity curve
+				humanizedVelocity, humanizedGate := applyHumanization(step.velocity, step.gate, pattern.Humanization)
+				humanizedVelocity = velocityCurve.Apply(humanizedVelocity)
 
 				// Apply timing humanization (add random delay/advance)
 				timingOffset := getTimingOffset(pattern.Humanization)
 				if timingOffset > 0 {
-					time.Sleep(timingOffset)
+					sleepUntil(e.clock.Now().Add(timingOffset), stepIdx+1)
 				} else if timingOffset < 0 {
 					// For negative offsets, we can't go back in time, but we can shorten the wait later
 					// This is handled by adjusting the remaining time calculation
@@ -183,59 +396,70 @@ func (e *Engine) playbackLoop() {
 					gateSteps = 1 // Note should sound for at least one step
 				}
 
-				// If this note is already playing, send a NoteOff first (re-trigger)
-				if _, playing := activeNotes[step.Note]; playing {
-					err := e.midiOut.NoteOff(channel, step.Note)
-					if err != nil {
-						fmt.Printf("Error sending Note Off (retrigger): %v\n", err)
-					}
-					delete(activeNotes, step.Note)
-				}
-
-				// Send CC messages for this step before Note On (ensures parameters are set before note triggers)
-				if len(step.CCValues) > 0 {
-					for ccNum, value := range step.CCValues {
-						err := e.midiOut.SendCC(channel, uint8(ccNum), uint8(value))
-						if err != nil {
-							fmt.Printf("Error sending CC#%d: %v\n", ccNum, err)
-						}
+				// If this note is already playing, send a NoteOff first (re-trigger),
+				// unless the pattern is legato: then the new gate simply replaces the old one
+				if sounding(step.note) {
+					if !pattern.Legato {
+						sendNoteOff(step.note, stepIdx+1)
 					}
+					forget(step.note)
 				}
 
 				// Send Note On with humanized velocity
-				err := e.midiOut.NoteOn(channel, step.Note, humanizedVelocity)
+				err := e.send(noteOnMessage, channel, step.note, humanizedVelocity)
 				if err != nil {
-					fmt.Printf("Error sending Note On: %v\n", err)
+					slog.Error("MIDI note on failed", "note", step.note, "step", stepIdx+1, "error", err)
+				} else if debug {
+					slog.Debug("note on", "note", step.note, "velocity", humanizedVelocity, "gate_steps", gateSteps, "step", stepIdx+1, "loop", e.loopCount)
 				}
+				e.publish(Event{Type: EventNoteOn, Step: stepIdx + 1, Note: step.note, Velocity: humanizedVelocity, Loop: e.loopCount})
 
 				if e.IsVerbose() {
-					noteName := midiToNoteName(step.Note)
+					noteName := sequence.MIDIToNoteName(step.note)
+					gateDesc := fmt.Sprintf("%d%%", humanizedGate)
+					if step.gateMs > 0 {
+						gateDesc = fmt.Sprintf("%dms", step.gateMs)
+					}
 					if duration > 1 {
-						fmt.Printf("♪ Step %2d: %s (vel:%d gate:%d%% dur:%d)\n", stepIdx+1, noteName, humanizedVelocity, humanizedGate, duration)
+						e.verbosef("♪ Step %2d: %s (vel:%d gate:%s dur:%d)\n", stepIdx+1, noteName, humanizedVelocity, gateDesc, duration)
 					} else {
-						fmt.Printf("♪ Step %2d: %s (vel:%d gate:%d%%)\n", stepIdx+1, noteName, humanizedVelocity, humanizedGate)
+						e.verbosef("♪ Step %2d: %s (vel:%d gate:%s)\n", stepIdx+1, noteName, humanizedVelocity, gateDesc)
 					}
 				}
 
-				// Add to active notes map to track its duration
-				activeNotes[step.Note] = gateSteps
+				// Track the note's duration: an absolute gate ignores tempo,
+				// duration and gate humanization
+				noteStarts[step.note] = stepIdx
+				if step.gateMs > 0 {
+					gateEnds[step.note] = e.clock.Now().Add(time.Duration(step.gateMs) * time.Millisecond)
+					gated++
+				} else {
+					activeNotes[step.note] = gateSteps
+				}
+			} else if e.IsVerbose() && step.muted {
+				e.verbosef("  Step %2d: --- (muted)\n", stepIdx+1)
 			} else if e.IsVerbose() {
-				fmt.Printf("  Step %2d: ---\n", stepIdx+1)
+				e.verbosef("  Step %2d: ---\n", stepIdx+1)
 			}
 
 			// Wait for the remainder of the step duration
-			elapsed := time.Since(stepStart)
-			remaining := stepDuration - elapsed
-			if remaining > 0 {
-				time.Sleep(remaining)
+			elapsed := e.clock.Now().Sub(stepStart)
+			if elapsed >= stepDuration && swungPast == 0 {
+				// Timing problem: the step's work took longer than the step itself
+				slog.Warn("step overran", "step", stepIdx+1, "elapsed", elapsed, "step_duration", stepDuration)
 			}
+			sleepUntil(stepStart.Add(stepDuration-catchUp), stepIdx+1)
 		}
 
-		// Loop boundary: turn off all remaining active notes (clean cut)
-		for note := range activeNotes {
-			err := e.midiOut.NoteOff(channel, note)
-			if err != nil {
-				fmt.Printf("Error sending Note Off (loop boundary): %v\n", err)
+		// Loop boundary: notes still sounding ring into the next loop, unless
+		// the pattern cuts them here (clean cut)
+		if pattern.GetNoteOffMode() == sequence.NoteOffCut {
+			for note := range activeNotes {
+				if !sounding(uint8(note)) {
+					continue
+				}
+				sendNoteOff(uint8(note), numSteps)
+				forget(uint8(note))
 			}
 		}
 
@@ -243,25 +467,61 @@ func (e *Engine) playbackLoop() {
 		// We grab the lock, and replace the current pattern with a CLONE of the
 		// next pattern. The command handler goroutine can continue to modify the
 		// `nextPattern` without interfering with the `currentPattern` that the
-		// next loop iteration will use.
+		// next loop iteration will use. While the next pattern hasn't changed,
+		// the current one is played again instead of copying it every loop.
+		// The version is read before cloning, so a change made in between is
+		// copied now and merely copied again next loop. The clone is compiled
+		// here, once, rather than step by step while it plays.
+		e.mu.RLock()
+		version := e.nextPattern.Version()
+		var clone *sequence.Pattern
+		if version != e.playedVersion {
+			clone = e.nextPattern.Clone()
+		}
+		e.mu.RUnlock()
+		if clone != nil {
+			compiled = compile(clone)
+		}
 		e.mu.Lock()
-		e.currentPattern = e.nextPattern.Clone()
+		if clone != nil {
+			e.currentPattern = compiled
+			e.playedVersion = version
+		}
+		next := compiled.pattern.BPM
+		e.loopCount++
 		e.mu.Unlock()
 
+		// A note whose step the new pattern changed (another note, a rest,
+		// muted or gone) doesn't belong to it any more: it stops here
+		if clone != nil {
+			for note := range activeNotes {
+				if !sounding(uint8(note)) {
+					continue
+				}
+				if start := noteStarts[note]; start >= len(compiled.steps) ||
+					!compiled.steps[start].play || compiled.steps[start].note != uint8(note) {
+					sendNoteOff(uint8(note), numSteps)
+					forget(uint8(note))
+				}
+			}
+		}
+
+		// A tempo change, e.g. between the parts of a song, takes effect
+		// here: the next loop's steps are all timed at the new tempo
+		e.publish(Event{Type: EventLoop, Loop: e.loopCount, BPM: next})
+		if debug {
+			slog.Debug("loop", "loop", e.loopCount, "bpm", bpm, "steps", numSteps)
+			if next != bpm {
+				slog.Debug("tempo change", "from", bpm, "to", next, "loop", e.loopCount)
+			}
+		}
+
 		if e.IsVerbose() {
-			fmt.Println("--- Loop ---")
+			e.verbosef("--- Loop ---\n")
 		}
 	}
 }
 
-// midiToNoteName converts MIDI note number to name (same as in sequence package)
-func midiToNoteName(note uint8) string {
-	noteNames := []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
-	octave := int(note/12) - 1
-	noteName := noteNames[note%12]
-	return fmt.Sprintf("%s%d", noteName, octave)
-}
-
 // applyHumanization applies random variations to velocity and gate based on humanization settings
 // Returns humanized velocity and gate values
 func applyHumanization(velocity uint8, gate int, humanization sequence.Humanization) (uint8, int) {
@@ -0,0 +1,709 @@
+package playback
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// fakeClock is a clock whose Sleep advances virtual time instantly. Once
+// the time reaches limit, done is closed so the test can stop the engine.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	limit time.Time
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newFakeClock(limit time.Duration) *fakeClock {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &fakeClock{now: start, limit: start.Add(limit), done: make(chan struct{})}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+	if !c.now.Before(c.limit) {
+		c.once.Do(func() { close(c.done) })
+	}
+}
+
+// noteOn is a Note On the mock output received, and when
+type noteOn struct {
+	note, velocity uint8
+	at             time.Time
+}
+
+// mockOutput records Note On and Note Off messages with the fake clock's
+// time (velocity is 0 for a Note Off)
+type mockOutput struct {
+	mu       sync.Mutex
+	clock    *fakeClock
+	noteOns  []noteOn
+	noteOffs []noteOn
+}
+
+func (m *mockOutput) NoteOn(channel, note, velocity uint8) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.noteOns = append(m.noteOns, noteOn{note: note, velocity: velocity, at: m.clock.Now()})
+	return nil
+}
+
+func (m *mockOutput) NoteOff(channel, note uint8) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.noteOffs = append(m.noteOffs, noteOn{note: note, at: m.clock.Now()})
+	return nil
+}
+
+func (m *mockOutput) SendCC(channel, ccNumber, value uint8) error { return nil }
+
+// recorded returns the Note Ons received so far
+func (m *mockOutput) recorded() []noteOn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]noteOn(nil), m.noteOns...)
+}
+
+// runFake plays pattern on a fake clock for the given number of loops and
+// returns the clock's start time and the Note Ons sent in those loops
+func runFake(t testing.TB, pattern *sequence.Pattern, loops int) (time.Time, []noteOn) {
+	t.Helper()
+	stepDuration := time.Duration(60_000.0 / float64(pattern.BPM) / 4.0 * float64(time.Millisecond))
+	clock := newFakeClock(time.Duration(loops*len(pattern.Steps)) * stepDuration)
+	start := clock.Now()
+	out := &mockOutput{clock: clock}
+
+	e := New(out, pattern)
+	e.clock = clock
+	e.Start()
+	<-clock.done
+	e.Stop()
+
+	var played []noteOn
+	for _, n := range out.recorded() {
+		if n.at.Before(clock.limit) {
+			played = append(played, n)
+		}
+	}
+	return start, played
+}
+
+// TestTiming checks that every Note On is sent on its step, delayed only by
+// swing and timing humanization, across tempos
+func TestTiming(t *testing.T) {
+	tests := []struct {
+		name     string
+		bpm      int
+		swing    int
+		humanize sequence.Humanization
+	}{
+		{"straight 60 BPM", 60, 0, sequence.Humanization{}},
+		{"straight 120 BPM", 120, 0, sequence.Humanization{}},
+		{"straight 300 BPM", 300, 0, sequence.Humanization{}},
+		{"swing 50%", 120, 50, sequence.Humanization{}},
+		{"swing 75% at 300 BPM", 300, 75, sequence.Humanization{}},
+		{"humanized", 120, 0, sequence.Humanization{VelocityRange: 8, TimingMs: 10, GateRange: 5}},
+		{"humanized with swing", 90, 60, sequence.Humanization{VelocityRange: 64, TimingMs: 20, GateRange: 50}},
+	}
+
+	const loops = 3
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := sequence.New(16)
+			p.BPM = float64(tt.bpm)
+			p.SwingPercent = tt.swing
+			p.Humanization = tt.humanize
+			for i := 1; i <= 16; i++ {
+				if err := p.SetNote(i, uint8(47+i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			start, played := runFake(t, p, loops)
+			if len(played) != loops*16 {
+				t.Fatalf("got %d Note Ons in %d loops, want %d", len(played), loops, loops*16)
+			}
+
+			stepDurationMs := 60_000.0 / float64(tt.bpm) / 4.0
+			stepDuration := time.Duration(stepDurationMs * float64(time.Millisecond))
+			swingDelay := time.Duration(stepDurationMs * float64(tt.swing) / 100.0 * float64(time.Millisecond))
+			maxOffset := time.Duration(tt.humanize.TimingMs) * time.Millisecond
+
+			for i, n := range played {
+				step := i % 16
+				if want := uint8(48 + step); n.note != want {
+					t.Fatalf("Note On %d: got note %d, want %d", i, n.note, want)
+				}
+
+				earliest := start.Add(time.Duration(i) * stepDuration)
+				if step%2 == 1 {
+					earliest = earliest.Add(swingDelay)
+				}
+				if late := n.at.Sub(earliest); late < 0 || late > maxOffset {
+					t.Errorf("Note On %d (step %d): %v after its time, want 0-%v", i, step+1, late, maxOffset)
+				}
+
+				low, high := 100-tt.humanize.VelocityRange, 100+tt.humanize.VelocityRange
+				if high > 127 {
+					high = 127
+				}
+				if int(n.velocity) < low || int(n.velocity) > high {
+					t.Errorf("Note On %d: velocity %d outside %d-%d", i, n.velocity, low, high)
+				}
+			}
+		})
+	}
+}
+
+// TestTimingRests checks that rests keep time: notes after them still land
+// on their steps
+func TestTimingRests(t *testing.T) {
+	p := sequence.New(16)
+	p.BPM = 120
+	p.Humanization = sequence.Humanization{}
+	for _, i := range []int{1, 5, 9, 16} {
+		if err := p.SetNote(i, 60); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start, played := runFake(t, p, 2)
+	if len(played) != 8 {
+		t.Fatalf("got %d Note Ons, want 8", len(played))
+	}
+	stepDuration := 125 * time.Millisecond
+	for i, step := range []int{0, 4, 8, 15, 16, 20, 24, 31} {
+		if want := start.Add(time.Duration(step) * stepDuration); !played[i].at.Equal(want) {
+			t.Errorf("Note On %d: at %v, want %v", i, played[i].at.Sub(start), want.Sub(start))
+		}
+	}
+}
+
+// TestSwingEighths checks that 8th swing delays only the off-beat 8ths,
+// by more than a step, without pushing later steps off the grid, and that
+// straight steps stay on it
+func TestSwingEighths(t *testing.T) {
+	p := sequence.New(16)
+	p.BPM = 120
+	p.Humanization = sequence.Humanization{}
+	p.SwingPercent = 66
+	p.SwingUnit = 2
+	for i := 1; i <= 16; i += 2 {
+		if err := p.SetNote(i, 60); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.SetStraight(7, true)
+
+	start, played := runFake(t, p, 2)
+	if len(played) != 16 {
+		t.Fatalf("got %d Note Ons, want 16", len(played))
+	}
+	stepDuration := 125 * time.Millisecond
+	for i, n := range played {
+		step := 2 * i
+		want := start.Add(time.Duration(step) * stepDuration)
+		if step%4 == 2 && step%16 != 6 {
+			want = want.Add(165 * time.Millisecond) // 66% of an 8th
+		}
+		if late := n.at.Sub(want); late < -time.Microsecond || late > time.Microsecond {
+			t.Errorf("Note On %d (step %d): at %v, want %v", i, step%16+1, n.at.Sub(start), want.Sub(start))
+		}
+	}
+}
+
+// TestMutedStep checks that a muted step plays nothing
+func TestMutedStep(t *testing.T) {
+	p := sequence.New(16)
+	p.BPM = 120
+	p.Humanization = sequence.Humanization{}
+	p.SetNote(1, 60)
+	p.SetNote(5, 64)
+	if err := p.SetMuted(5, true); err != nil {
+		t.Fatal(err)
+	}
+
+	_, played := runFake(t, p, 1)
+	if len(played) != 1 || played[0].note != 60 {
+		t.Errorf("played %+v, want only note 60", played)
+	}
+}
+
+// TestTempoChange checks that a tempo change, as between the parts of a
+// song, times the whole next loop at the new tempo and is reported with
+// the loop event
+func TestTempoChange(t *testing.T) {
+	p := sequence.New(16)
+	p.BPM = 120
+	p.Humanization = sequence.Humanization{}
+	p.SetNote(1, 60)
+	p.SetNote(9, 64)
+
+	// One loop at 120 BPM (2s), then one at 60 BPM (4s)
+	clock := newFakeClock(6 * time.Second)
+	start := clock.Now()
+	out := &mockOutput{clock: clock}
+	e := New(out, p)
+	e.clock = clock
+	if err := e.GetNextPattern().SetTempo(60); err != nil {
+		t.Fatal(err)
+	}
+	events := e.Subscribe(256)
+	e.Start()
+	<-clock.done
+	e.Stop()
+
+	var played []time.Duration
+	for _, n := range out.recorded() {
+		if n.at.Before(clock.limit) {
+			played = append(played, n.at.Sub(start))
+		}
+	}
+	want := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second}
+	if fmt.Sprint(played) != fmt.Sprint(want) {
+		t.Errorf("Note Ons at %v, want %v", played, want)
+	}
+
+	for ev := range events {
+		if ev.Type == EventLoop {
+			if ev.BPM != 60 {
+				t.Errorf("loop event BPM = %g, want 60", ev.BPM)
+			}
+			break
+		}
+	}
+}
+
+// TestCueBar checks that a cued pattern starts at the next bar, ending the
+// loop early once, and then plays its full length
+func TestCueBar(t *testing.T) {
+	p := sequence.New(32)
+	p.BPM = 120 // 2s per bar
+	p.Humanization = sequence.Humanization{}
+	p.SetNote(1, 60)
+	p.SetNote(17, 62)
+
+	clock := newFakeClock(6500 * time.Millisecond)
+	start := clock.Now()
+	out := &mockOutput{clock: clock}
+	e := New(out, p)
+	e.clock = clock
+	next := e.GetNextPattern()
+	next.SetRest(17)
+	next.SetNote(1, 64)
+	e.CueBar()
+	e.Start()
+	<-clock.done
+	e.Stop()
+
+	var played []string
+	for _, n := range out.recorded() {
+		if n.at.Before(clock.limit) {
+			played = append(played, fmt.Sprintf("%d@%v", n.note, n.at.Sub(start)))
+		}
+	}
+	if got, want := strings.Join(played, " "), "60@0s 64@2s 64@6s"; got != want {
+		t.Errorf("Note Ons %s, want %s", got, want)
+	}
+
+	// In 6/8 a bar is 12 steps, 1.5s at 120 BPM
+	p = sequence.New(24)
+	p.BPM = 120
+	p.Humanization = sequence.Humanization{}
+	p.SetMeter(6, 8, 16)
+	p.SetNote(1, 60)
+	p.SetNote(13, 62)
+
+	clock = newFakeClock(5000 * time.Millisecond)
+	start = clock.Now()
+	out = &mockOutput{clock: clock}
+	e = New(out, p)
+	e.clock = clock
+	next = e.GetNextPattern()
+	next.SetRest(13)
+	next.SetNote(1, 64)
+	e.CueBar()
+	e.Start()
+	<-clock.done
+	e.Stop()
+
+	played = nil
+	for _, n := range out.recorded() {
+		if n.at.Before(clock.limit) {
+			played = append(played, fmt.Sprintf("%d@%v", n.note, n.at.Sub(start)))
+		}
+	}
+	if got, want := strings.Join(played, " "), "60@0s 64@1.5s 64@4.5s"; got != want {
+		t.Errorf("6/8 Note Ons %s, want %s", got, want)
+	}
+}
+
+// TestLoopSteps checks that a loop region plays only its steps, on time
+func TestLoopSteps(t *testing.T) {
+	p := sequence.New(32)
+	p.BPM = 120 // 2s per bar
+	p.Humanization = sequence.Humanization{}
+	p.SetNote(1, 60)
+	p.SetNote(17, 62)
+	p.SetNote(20, 64)
+
+	clock := newFakeClock(4500 * time.Millisecond)
+	start := clock.Now()
+	out := &mockOutput{clock: clock}
+	e := New(out, p)
+	e.clock = clock
+	e.LoopSteps(17, 32)
+	if first, last := e.LoopedSteps(); first != 17 || last != 32 {
+		t.Errorf("LoopedSteps() = %d, %d, want 17, 32", first, last)
+	}
+	e.Start()
+	<-clock.done
+	e.Stop()
+
+	var played []string
+	for _, n := range out.recorded() {
+		if n.at.Before(clock.limit) {
+			played = append(played, fmt.Sprintf("%d@%v", n.note, n.at.Sub(start)))
+		}
+	}
+	if got, want := strings.Join(played, " "), "62@0s 64@375ms 62@2s 64@2.375s 62@4s 64@4.375s"; got != want {
+		t.Errorf("Note Ons %s, want %s", got, want)
+	}
+}
+
+// TestSetMuted checks that muted playback plays no notes
+func TestSetMuted(t *testing.T) {
+	p := sequence.New(16)
+	p.BPM = 120
+	p.Humanization = sequence.Humanization{}
+	p.SetNoteWithDuration(1, 60, 16)
+	p.SetNote(9, 64)
+
+	clock := newFakeClock(2 * time.Second)
+	out := &mockOutput{clock: clock}
+	e := New(out, p)
+	e.clock = clock
+	e.SetMuted(true)
+	if !e.IsMuted() {
+		t.Fatal("IsMuted = false after SetMuted(true)")
+	}
+	e.Start()
+	<-clock.done
+	e.Stop()
+
+	if played := out.recorded(); len(played) != 0 {
+		t.Errorf("muted playback sent %d Note Ons", len(played))
+	}
+}
+
+// TestLoopBoundarySustain checks that a note longer than the rest of the
+// loop rings into the next one by default, also when the pattern changes at
+// the boundary but still plays it, and is cut there in cut mode or when
+// the new pattern changes its step
+func TestLoopBoundarySustain(t *testing.T) {
+	const stepDuration = 125 * time.Millisecond // 16ths at 120 BPM
+
+	tests := []struct {
+		mode    string // "" for the default
+		swap    string // what the pattern swapped in at the first boundary changes: "", "other step" or "its step"
+		wantOff int    // step (counted from 0 across loops) of the Note Off
+	}{
+		{"", "", 13 + 16},
+		{"", "other step", 13 + 16},
+		{"", "its step", 16},
+		{"ring", "", 13 + 16},
+		{"ring", "its step", 16},
+		{"cut", "", 16},
+		{"cut", "other step", 16},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("mode=%q swap=%q", tt.mode, tt.swap), func(t *testing.T) {
+			p := sequence.New(16)
+			p.BPM = 120
+			p.Humanization = sequence.Humanization{}
+			if tt.mode != "" {
+				if err := p.SetNoteOffMode(tt.mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := p.SetNoteWithDuration(14, 40, 16); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.SetGate(14, 100); err != nil {
+				t.Fatal(err)
+			}
+
+			clock := newFakeClock(3 * 16 * stepDuration)
+			out := &mockOutput{clock: clock}
+			e := New(out, p)
+			e.clock = clock
+			next := e.GetNextPattern()
+			if tt.swap == "its step" {
+				// The next pattern doesn't play the long note any more
+				if err := next.SetRest(14); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.swap != "" {
+				if err := next.SetNote(1, 52); err != nil {
+					t.Fatal(err)
+				}
+			}
+			e.Start()
+			<-clock.done
+			e.Stop()
+
+			start := clock.limit.Add(-3 * 16 * stepDuration)
+			var offs []time.Duration
+			for _, n := range out.noteOffs {
+				if n.note == 40 && n.at.Before(clock.limit) {
+					offs = append(offs, n.at.Sub(start))
+				}
+			}
+			if len(offs) == 0 {
+				t.Fatal("long note never turned off")
+			}
+			if want := time.Duration(tt.wantOff) * stepDuration; offs[0] != want {
+				t.Errorf("long note turned off at %v, want %v (step %d)", offs[0], want, tt.wantOff)
+			}
+		})
+	}
+}
+
+// TestGateMs checks that a gate in milliseconds ends the note that long
+// after it starts, at any tempo, within a step or across several
+func TestGateMs(t *testing.T) {
+	tests := []struct {
+		name   string
+		bpm    int
+		swing  int
+		gateMs int
+	}{
+		{"short hit at 120 BPM", 120, 0, 30},
+		{"short hit at 60 BPM", 60, 0, 30},
+		{"short hit on a swung step", 120, 50, 30},
+		{"across steps", 120, 0, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := sequence.New(16)
+			p.BPM = float64(tt.bpm)
+			p.SwingPercent = tt.swing
+			p.Humanization = sequence.Humanization{GateRange: 50}
+			for _, step := range []int{1, 2, 9} {
+				if err := p.SetNote(step, uint8(59+step)); err != nil {
+					t.Fatal(err)
+				}
+				if err := p.SetGateMs(step, tt.gateMs); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			clock := newFakeClock(time.Duration(16*15_000/tt.bpm) * time.Millisecond)
+			out := &mockOutput{clock: clock}
+			e := New(out, p)
+			e.clock = clock
+			e.Start()
+			<-clock.done
+			e.Stop()
+
+			ons, offs := map[uint8]time.Time{}, map[uint8]time.Time{}
+			for _, n := range out.recorded() {
+				if _, ok := ons[n.note]; !ok {
+					ons[n.note] = n.at
+				}
+			}
+			out.mu.Lock()
+			for _, n := range out.noteOffs {
+				if _, ok := offs[n.note]; !ok {
+					offs[n.note] = n.at
+				}
+			}
+			out.mu.Unlock()
+
+			for _, note := range []uint8{60, 61, 68} {
+				on, ok := ons[note]
+				if !ok {
+					t.Fatalf("note %d never played", note)
+				}
+				if got, want := offs[note].Sub(on), time.Duration(tt.gateMs)*time.Millisecond; got != want {
+					t.Errorf("note %d sounded for %v, want %v", note, got, want)
+				}
+			}
+		})
+	}
+}
+
+// failingOutput fails every message while failures > 0, counting them down
+type failingOutput struct {
+	failures int
+	sent     int
+}
+
+func (o *failingOutput) fail() error {
+	if o.failures > 0 {
+		o.failures--
+		return fmt.Errorf("device unplugged")
+	}
+	o.sent++
+	return nil
+}
+
+func (o *failingOutput) NoteOn(channel, note, velocity uint8) error  { return o.fail() }
+func (o *failingOutput) NoteOff(channel, note uint8) error           { return o.fail() }
+func (o *failingOutput) SendCC(channel, ccNumber, value uint8) error { return o.fail() }
+
+// TestSendRetry checks that failed MIDI messages are retried, and that
+// subscribers hear once when sending fails and when it works again
+func TestSendRetry(t *testing.T) {
+	out := &failingOutput{}
+	e := New(out, sequence.New(16))
+	e.clock = newFakeClock(time.Hour)
+	events := e.Subscribe(16)
+
+	// A message failing fewer times than it is tried gets through
+	out.failures = sendAttempts - 1
+	if err := e.send(noteOnMessage, 0, 60, 100); err != nil || out.sent != 1 {
+		t.Fatalf("send after %d failures: %v, %d sent", sendAttempts-1, err, out.sent)
+	}
+
+	// A lost device: the first failure is reported, the next ones are
+	// tried once and not reported again
+	out.failures = sendAttempts + 2
+	for i := 0; i < 3; i++ {
+		if err := e.send(ccMessage, 0, 74, 64); err == nil {
+			t.Fatalf("send %d to a lost device succeeded", i+1)
+		}
+	}
+	if err := e.send(noteOffMessage, 0, 60, 0); err != nil || out.sent != 2 {
+		t.Fatalf("send after the device came back: %v, %d sent", err, out.sent)
+	}
+
+	var got []string
+	for len(events) > 0 {
+		ev := <-events
+		got = append(got, ev.Type.String())
+		if ev.Type == EventSendFailed && ev.Err == nil {
+			t.Error("EventSendFailed without Err")
+		}
+	}
+	if want := []string{"send-failed", "send-recovered"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events %v, want %v", got, want)
+	}
+}
+
+// TestMonitor checks the lines written for each MIDI message sent
+func TestMonitor(t *testing.T) {
+	out := &failingOutput{}
+	e := New(out, sequence.New(16))
+	e.clock = newFakeClock(time.Hour)
+
+	var log strings.Builder
+	e.SetMonitor(&log)
+	e.send(noteOnMessage, 0, 60, 100)
+	e.send(ccMessage, 9, 74, 64)
+	out.failures = sendAttempts
+	e.send(noteOffMessage, 0, 60, 0)
+	e.SetMonitor(nil)
+	e.send(noteOnMessage, 0, 62, 100)
+
+	want := "00:00:00.000 note-on  ch 1  C4 (60) vel 100\n" +
+		"00:00:00.000 cc       ch 10 cc 74 = 64\n" +
+		"00:00:00.002 note-off ch 1  C4 (60)  FAILED: device unplugged\n"
+	if log.String() != want {
+		t.Errorf("monitor wrote\n%s\nwant\n%s", log.String(), want)
+	}
+}
+
+// TestCompile checks the defaults, swing and CCs worked out before a
+// pattern plays
+func TestCompile(t *testing.T) {
+	p := sequence.New(4)
+	p.BPM = 120
+	p.SwingPercent = 50
+	p.Steps[0] = sequence.Step{Note: 60, Duration: 0, CCValues: map[int]int{74: 10, 1: 20}}
+	p.Steps[1] = sequence.Step{Note: 62, Velocity: 80, Gate: 50, Duration: 2}
+	p.Steps[2] = sequence.Step{Note: 64, Muted: true, CCValues: map[int]int{74: 30}}
+	p.Steps[3] = sequence.Step{IsRest: true, Straight: true, CCValues: map[int]int{74: 40}}
+	if err := p.SetVolume(90); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetGlobalCC(74, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	c := compile(p)
+	if c.stepDuration != 125*time.Millisecond {
+		t.Errorf("step duration %v, want 125ms", c.stepDuration)
+	}
+	if want := []ccValue{{sequence.CCVolume, 90}, {74, 5}}; fmt.Sprint(c.loopCCs) != fmt.Sprint(want) {
+		t.Errorf("loop CCs %v, want %v", c.loopCCs, want)
+	}
+	want := []compiledStep{
+		{note: 60, play: true, velocity: 100, gate: 90, duration: 1, ccs: []ccValue{{1, 20}, {74, 10}}},
+		{note: 62, play: true, velocity: 80, gate: 50, duration: 2, swing: 62500 * time.Microsecond},
+		{note: 64, muted: true, velocity: 100, gate: 90, duration: 1},
+		{velocity: 100, gate: 90, duration: 1, ccs: []ccValue{{74, 40}}},
+	}
+	for i := range want {
+		if got := fmt.Sprintf("%+v", c.steps[i]); got != fmt.Sprintf("%+v", want[i]) {
+			t.Errorf("step %d: %s, want %+v", i+1, got, want[i])
+		}
+	}
+}
+
+// BenchmarkPlaybackLoop measures the work of the playback loop per step,
+// with the sleeping taken out by the fake clock, for a short and a long
+// pattern
+func BenchmarkPlaybackLoop(b *testing.B) {
+	for _, length := range []int{16, 256} {
+		b.Run(fmt.Sprintf("%d steps", length), func(b *testing.B) {
+			p := sequence.New(length)
+			p.BPM = 120
+			p.SwingPercent = 20
+			for i := 1; i <= length; i++ {
+				if err := p.SetNote(i, uint8(48+i%24)); err != nil {
+					b.Fatal(err)
+				}
+				if err := p.SetStepCC(i, 74, i%128); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			clock := newFakeClock(time.Duration(b.N) * 125 * time.Millisecond)
+			e := New(&mockOutput{clock: clock}, p)
+			e.clock = clock
+			b.ReportAllocs()
+			b.ResetTimer()
+			e.Start()
+			<-clock.done
+			b.StopTimer()
+			e.Stop()
+		})
+	}
+}
+
+// BenchmarkApplyHumanization measures the per-note humanization
+func BenchmarkApplyHumanization(b *testing.B) {
+	humanization := sequence.Humanization{VelocityRange: 8, TimingMs: 10, GateRange: 5}
+	for i := 0; i < b.N; i++ {
+		applyHumanization(100, 90, humanization)
+		getTimingOffset(humanization)
+	}
+}
@@ -0,0 +1,30 @@
+package playback
+
+import (
+	"log/slog"
+	"runtime"
+)
+
+// realtimePriority is the SCHED_FIFO priority asked for on Linux (1-99):
+// above normal threads, below the audio server (JACK and PipeWire use 80+)
+const realtimePriority = 40
+
+// SetRealtime asks the OS to schedule the playback loop ahead of other
+// threads, so timing holds up under load. Call before Start. Only Linux
+// supports this; where it isn't supported or permitted (e.g. without
+// CAP_SYS_NICE or an rtprio limit), playback logs a warning and runs at
+// normal priority.
+func (e *Engine) SetRealtime(realtime bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.realtime = realtime
+}
+
+// startRealtime pins the playback loop to its OS thread and raises that
+// thread's priority
+func startRealtime() {
+	runtime.LockOSThread()
+	if err := raisePriority(); err != nil {
+		slog.Warn("realtime priority unavailable, playing at normal priority", "error", err)
+	}
+}
@@ -0,0 +1,16 @@
+package playback
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// raisePriority switches the calling thread to SCHED_FIFO
+func raisePriority() error {
+	attr := unix.SchedAttr{Policy: unix.SCHED_FIFO, Priority: realtimePriority}
+	if err := unix.SchedSetAttr(0, &attr, 0); err != nil {
+		return fmt.Errorf("SCHED_FIFO needs CAP_SYS_NICE or an rtprio limit (see 'ulimit -r'): %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package playback
+
+import "fmt"
+
+// raisePriority isn't supported on this OS. On macOS a thread needs a Mach
+// time-constraint policy, which takes cgo this package avoids, and lowering
+// the whole process's nice value needs root; --realtime only tunes the GC.
+func raisePriority() error {
+	return fmt.Errorf("not supported on this OS")
+}
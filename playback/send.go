@@ -0,0 +1,64 @@
+package playback
+
+import (
+	"time"
+)
+
+// A MIDI message is tried sendAttempts times, sendRetryDelay apart, before
+// its send fails: enough to ride out a busy driver without throwing the
+// step's timing off
+const (
+	sendAttempts   = 3
+	sendRetryDelay = time.Millisecond
+)
+
+// messageKind is the kind of MIDI message send sends
+type messageKind int
+
+const (
+	noteOnMessage  messageKind = iota // data: note, velocity
+	noteOffMessage                    // data: note
+	ccMessage                         // data: CC number, value
+)
+
+// send sends a MIDI message to the output, retrying when it fails. Once
+// sending fails, messages are tried only once until one gets through, so a
+// lost device doesn't slow every step down. Subscribers get an
+// EventSendFailed when sending starts to fail and an EventSendRecovered
+// when it works again. Only the playback loop sends.
+func (e *Engine) send(kind messageKind, channel, data1, data2 uint8) error {
+	attempts := sendAttempts
+	if e.sendFailing {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			e.clock.Sleep(sendRetryDelay)
+		}
+		switch kind {
+		case noteOnMessage:
+			err = e.midiOut.NoteOn(channel, data1, data2)
+		case noteOffMessage:
+			err = e.midiOut.NoteOff(channel, data1)
+		case ccMessage:
+			err = e.midiOut.SendCC(channel, data1, data2)
+		}
+		if err == nil {
+			break
+		}
+	}
+
+	e.monitorMessage(kind, channel, data1, data2, err)
+
+	switch {
+	case err != nil && !e.sendFailing:
+		e.sendFailing = true
+		e.publish(Event{Type: EventSendFailed, Loop: e.loopCount, Err: err})
+	case err == nil && e.sendFailing:
+		e.sendFailing = false
+		e.publish(Event{Type: EventSendRecovered, Loop: e.loopCount})
+	}
+	return err
+}
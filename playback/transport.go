@@ -0,0 +1,76 @@
+package playback
+
+// Pause silences playback at the next step until Resume is called.
+// Sounding notes are turned off; the loop position is kept.
+func (e *Engine) Pause() {
+	e.pauseMu.Lock()
+	defer e.pauseMu.Unlock()
+	if e.resumeChan == nil {
+		e.resumeChan = make(chan struct{})
+	}
+}
+
+// Resume continues playback from the step where it was paused
+func (e *Engine) Resume() {
+	e.pauseMu.Lock()
+	defer e.pauseMu.Unlock()
+	if e.resumeChan != nil {
+		close(e.resumeChan)
+		e.resumeChan = nil
+	}
+}
+
+// IsPaused reports whether playback is paused
+func (e *Engine) IsPaused() bool {
+	return e.pausedChan() != nil
+}
+
+// SetMuted silences playback without stopping it: the loop keeps time and
+// sends CCs, but sounding notes stop and no new ones start
+func (e *Engine) SetMuted(muted bool) {
+	e.muted.Store(muted)
+}
+
+// IsMuted reports whether playback is muted
+func (e *Engine) IsMuted() bool {
+	return e.muted.Load()
+}
+
+// CueBar makes the changes made so far to the next pattern start at the
+// next bar (Pattern.StepsPerBar steps) instead of at the end of the loop,
+// like launching a clip. The loop ends there as it would at its last step.
+func (e *Engine) CueBar() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cueVersion = e.nextPattern.Version()
+}
+
+// LoopSteps plays only steps first to last (1-based) each loop from the
+// next loop on, e.g. a single bar to work on it; steps outside the pattern
+// are left out. LoopSteps(0, 0) plays the whole pattern again.
+func (e *Engine) LoopSteps(first, last int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.loopFirst, e.loopLast = first, last
+}
+
+// LoopedSteps returns the steps played each loop, 0, 0 for all of them
+func (e *Engine) LoopedSteps() (first, last int) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.loopFirst, e.loopLast
+}
+
+// cued reports whether a cued pattern is waiting to start
+func (e *Engine) cued() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.cueVersion > e.playedVersion
+}
+
+// pausedChan returns a channel closed on Resume, or nil when playing
+func (e *Engine) pausedChan() chan struct{} {
+	e.pauseMu.Lock()
+	defer e.pauseMu.Unlock()
+	return e.resumeChan
+}
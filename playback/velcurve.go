@@ -0,0 +1,129 @@
+package playback
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// VelocityCurve maps pattern velocities to the velocities sent to the synth,
+// compensating for synths whose velocity response is too aggressive (or too
+// flat). A nil curve is linear.
+type VelocityCurve struct {
+	Name  string // spec the curve was parsed from, e.g. "soft" or "fixed 100"
+	table [128]uint8
+}
+
+// VelocityCurveNames lists the curve types accepted by ParseVelocityCurve
+var VelocityCurveNames = []string{"linear", "soft", "hard", "fixed", "custom"}
+
+// ParseVelocityCurve parses a curve spec:
+//
+//	linear                 velocities unchanged
+//	soft                   quieter: mid velocities come out lower
+//	hard                   louder: mid velocities come out higher
+//	fixed [n]              every note at velocity n (default 100)
+//	custom <in:out> ...    breakpoints, interpolated linearly (e.g. "custom 0:20 127:100")
+func ParseVelocityCurve(spec string) (*VelocityCurve, error) {
+	fields := strings.Fields(strings.ToLower(spec))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("missing velocity curve (use %s)", strings.Join(VelocityCurveNames, ", "))
+	}
+
+	curve := &VelocityCurve{Name: strings.Join(fields, " ")}
+	switch fields[0] {
+	case "linear", "soft", "hard":
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("velocity curve '%s' takes no arguments", fields[0])
+		}
+		exponent := map[string]float64{"linear": 1, "soft": 1.6, "hard": 0.6}[fields[0]]
+		for v := range curve.table {
+			curve.table[v] = uint8(math.Round(127 * math.Pow(float64(v)/127, exponent)))
+		}
+
+	case "fixed":
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("usage: fixed [velocity]")
+		}
+		value := 100
+		if len(fields) == 2 {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 1 || n > 127 {
+				return nil, fmt.Errorf("fixed velocity must be 1-127, got %s", fields[1])
+			}
+			value = n
+		}
+		for v := range curve.table {
+			curve.table[v] = uint8(value)
+		}
+
+	case "custom":
+		points, err := parseBreakpoints(fields[1:])
+		if err != nil {
+			return nil, err
+		}
+		for v := range curve.table {
+			curve.table[v] = uint8(math.Round(interpolate(points, v)))
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown velocity curve: %s (use %s)", fields[0], strings.Join(VelocityCurveNames, ", "))
+	}
+	return curve, nil
+}
+
+// parseBreakpoints parses "in:out" pairs with ascending inputs
+func parseBreakpoints(fields []string) ([][2]int, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("custom velocity curve needs in:out points (e.g., 'custom 0:20 64:50 127:100')")
+	}
+	var points [][2]int
+	for _, field := range fields {
+		in, out, ok := strings.Cut(field, ":")
+		x, errIn := strconv.Atoi(in)
+		y, errOut := strconv.Atoi(out)
+		if !ok || errIn != nil || errOut != nil || x < 0 || x > 127 || y < 0 || y > 127 {
+			return nil, fmt.Errorf("invalid curve point: %s (use in:out with values 0-127)", field)
+		}
+		if len(points) > 0 && x <= points[len(points)-1][0] {
+			return nil, fmt.Errorf("curve points must have ascending inputs: %s", field)
+		}
+		points = append(points, [2]int{x, y})
+	}
+	return points, nil
+}
+
+// interpolate returns the curve value at v; it is flat outside the points
+func interpolate(points [][2]int, v int) float64 {
+	if v <= points[0][0] {
+		return float64(points[0][1])
+	}
+	for i := 1; i < len(points); i++ {
+		x0, y0 := points[i-1][0], points[i-1][1]
+		x1, y1 := points[i][0], points[i][1]
+		if v <= x1 {
+			return float64(y0) + float64(y1-y0)*float64(v-x0)/float64(x1-x0)
+		}
+	}
+	return float64(points[len(points)-1][1])
+}
+
+// Apply maps a velocity. Notes never map to 0, which would be a note off.
+func (c *VelocityCurve) Apply(velocity uint8) uint8 {
+	if c == nil || velocity == 0 {
+		return velocity
+	}
+	if out := c.table[min(velocity, 127)]; out > 0 {
+		return out
+	}
+	return 1
+}
+
+// String returns the curve's spec ("linear" for a nil curve)
+func (c *VelocityCurve) String() string {
+	if c == nil {
+		return "linear"
+	}
+	return c.Name
+}
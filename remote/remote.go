@@ -0,0 +1,146 @@
+// Package remote accepts commands over a Unix socket or TCP connection so
+// external tools can drive a running session.
+//
+// The protocol is line based: each line is a command, answered with "ok" or
+// "error: <message>". Sending "quit" closes the connection.
+package remote
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Executor runs a command line and says where its output goes;
+// *commands.Handler implements it
+type Executor interface {
+	Execute(cmdLine string) error
+	Output() io.Writer
+}
+
+// Server accepts connections and runs the commands they send
+type Server struct {
+	listener net.Listener
+	exec     Executor
+	conns    map[net.Conn]struct{}
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// Network returns the network and address for a --listen value: a path
+// (containing "/" or ending in ".sock") is a Unix socket, a bare port number
+// listens on localhost, anything else is a TCP address like ":9000"
+func Network(addr string) (network, address string) {
+	if strings.Contains(addr, "/") || strings.HasSuffix(addr, ".sock") {
+		return "unix", addr
+	}
+	if _, err := strconv.Atoi(addr); err == nil {
+		return "tcp", "localhost:" + addr
+	}
+	return "tcp", addr
+}
+
+// Listen starts listening on addr (see Network). Call Serve to accept connections.
+func Listen(addr string, exec Executor) (*Server, error) {
+	network, address := Network(addr)
+	if network == "unix" {
+		// Remove a stale socket left behind by a previous run
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(address)
+		}
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return &Server{
+		listener: listener,
+		exec:     exec,
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve accepts connections until Close is called
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// Close stops accepting connections and closes open ones
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// handle runs commands from one connection
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	remoteAddr := conn.RemoteAddr().String()
+	slog.Info("remote connected", "addr", remoteAddr)
+	defer slog.Info("remote disconnected", "addr", remoteAddr)
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if lower := strings.ToLower(line); lower == "quit" || lower == "exit" {
+			return
+		}
+
+		// Show injected commands on the console, like script commands
+		fmt.Fprintln(s.exec.Output(), "[remote] >", line)
+
+		reply := "ok"
+		if err := s.exec.Execute(line); err != nil {
+			// Keep the reply on one line
+			reply = "error: " + strings.ReplaceAll(err.Error(), "\n", "; ")
+		}
+		if _, err := fmt.Fprintln(conn, reply); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package remote
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recorder is an Executor remembering the commands it ran
+type recorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *recorder) Output() io.Writer {
+	return io.Discard
+}
+
+func (r *recorder) Execute(line string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, line)
+	if strings.HasPrefix(line, "bad") {
+		return fmt.Errorf("unknown command: bad\nsecond line")
+	}
+	return nil
+}
+
+func TestNetwork(t *testing.T) {
+	tests := []struct {
+		addr, network, address string
+	}{
+		{"/tmp/interplay.sock", "unix", "/tmp/interplay.sock"},
+		{"interplay.sock", "unix", "interplay.sock"},
+		{"9000", "tcp", "localhost:9000"},
+		{":9000", "tcp", ":9000"},
+		{"0.0.0.0:9000", "tcp", "0.0.0.0:9000"},
+	}
+	for _, tt := range tests {
+		network, address := Network(tt.addr)
+		if network != tt.network || address != tt.address {
+			t.Errorf("Network(%q) = %q, %q, want %q, %q", tt.addr, network, address, tt.network, tt.address)
+		}
+	}
+}
+
+// exchange sends lines over a connection and returns the replies
+func exchange(t *testing.T, network, addr string, lines ...string) []string {
+	t.Helper()
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	var replies []string
+	for _, line := range lines {
+		fmt.Fprintln(conn, line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading reply to %q: %v", line, err)
+		}
+		replies = append(replies, strings.TrimSpace(reply))
+	}
+	return replies
+}
+
+func TestServer(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			addr := "127.0.0.1:0"
+			if network == "unix" {
+				addr = filepath.Join(t.TempDir(), "interplay.sock")
+			}
+
+			rec := &recorder{}
+			server, err := Listen(addr, rec)
+			if err != nil {
+				t.Fatalf("Listen() error = %v", err)
+			}
+			done := make(chan error)
+			go func() { done <- server.Serve() }()
+
+			replies := exchange(t, network, server.Addr().String(), "tempo 120", "# comment", "", "bad cmd")
+			want := []string{"ok", "error: unknown command: bad; second line"}
+			if fmt.Sprint(replies) != fmt.Sprint(want) {
+				t.Errorf("replies = %q, want %q", replies, want)
+			}
+			if fmt.Sprint(rec.lines) != fmt.Sprint([]string{"tempo 120", "bad cmd"}) {
+				t.Errorf("executed %q", rec.lines)
+			}
+
+			if err := server.Close(); err != nil {
+				t.Errorf("Close() error = %v", err)
+			}
+			if err := <-done; err != nil {
+				t.Errorf("Serve() error = %v", err)
+			}
+		})
+	}
+}
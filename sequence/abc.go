@@ -0,0 +1,451 @@
+package sequence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// abcSharpOrder is the order sharps are added to a key signature; flats are
+// added in reverse
+const abcSharpOrder = "FCGDAEB"
+
+// abcMajorFifths is each major key's position on the circle of fifths
+// (sharps positive, flats negative)
+var abcMajorFifths = map[string]int{
+	"Cb": -7, "Gb": -6, "Db": -5, "Ab": -4, "Eb": -3, "Bb": -2, "F": -1,
+	"C": 0, "G": 1, "D": 2, "A": 3, "E": 4, "B": 5, "F#": 6, "C#": 7,
+}
+
+// abcModeFifths shifts a tonic's major key signature for other modes
+var abcModeFifths = map[string]int{
+	"": 0, "maj": 0, "ion": 0, "mix": -1, "dor": -2,
+	"m": -3, "min": -3, "aeo": -3, "phr": -4, "loc": -5, "lyd": 1,
+}
+
+// abcSemitones maps ABC note letters to semitones above C
+var abcSemitones = map[rune]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+// abcParser reads a tune snippet one rune at a time
+type abcParser struct {
+	src   []rune
+	pos   int
+	unit  fraction       // L: default note length
+	key   map[rune]int   // key signature accidentals by letter
+	bar   map[string]int // accidentals set earlier in the bar, by letter+octave
+	tab   *Tab
+	notes []abcNote
+}
+
+// abcNote is a parsed note or rest before it is placed on the step grid
+type abcNote struct {
+	rest   bool
+	note   int
+	length fraction // of a whole note
+}
+
+// fraction is a small exact rational for ABC note lengths
+type fraction struct{ num, den int }
+
+// abcMaxTerm bounds the numbers in a tune's lengths and fields. Note
+// lengths are kept to at most MaxImportSteps 16ths with a denominator no
+// larger than this, see checkLength, so no arithmetic on them overflows.
+const abcMaxTerm = 1 << 16
+
+// checkLength rejects a note length longer than an imported pattern may
+// be, or divided too finely to be worked with
+func checkLength(f fraction) error {
+	if f.den > abcMaxTerm || f.num*StepsPerBar > MaxImportSteps*f.den {
+		return fmt.Errorf("note length %d/%d is out of range (at most %d 16th notes)", f.num, f.den, MaxImportSteps)
+	}
+	return nil
+}
+
+func (f fraction) mul(g fraction) fraction {
+	return fraction{f.num * g.num, f.den * g.den}.reduce()
+}
+
+func (f fraction) add(g fraction) fraction {
+	return fraction{f.num*g.den + g.num*f.den, f.den * g.den}.reduce()
+}
+
+func (f fraction) reduce() fraction {
+	a, b := f.num, f.den
+	for b != 0 {
+		a, b = b, a%b
+	}
+	if a == 0 {
+		return f
+	}
+	return fraction{f.num / a, f.den / a}
+}
+
+// ParseABC parses a short ABC notation snippet into a melody line on the
+// 16th-note grid, e.g. "L:1/8 K:G | G2 AB c2 B>A | G4 z4". Supported: the
+// L: (default length, 1/8 if unset), K: (key and mode) and Q: (tempo)
+// fields, inline as well as in [K:D] form; accidentals (^ _ =), octave
+// marks (' ,), lengths (A2 A/2 A3/2), rests (z), ties (-), broken rhythm
+// (> <) and bar lines. Chord symbols, decorations, slurs and grace notes
+// are skipped. Chords and tuplets can't be played on the monophonic step
+// grid and are rejected.
+func ParseABC(tune string) (*Tab, error) {
+	p := &abcParser{
+		src:  []rune(tune),
+		unit: fraction{1, 8},
+		key:  map[rune]int{},
+		bar:  map[string]int{},
+		tab:  &Tab{},
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	if len(p.notes) == 0 {
+		return nil, fmt.Errorf("no notes in ABC tune")
+	}
+
+	// Check every length and the total before making any steps
+	length := 0
+	for _, n := range p.notes {
+		steps := n.length.mul(fraction{StepsPerBar, 1})
+		if steps.den != 1 || steps.num < 1 {
+			return nil, fmt.Errorf("note length %d/%d is shorter than a 16th note or off the 16th-note grid", n.length.num, n.length.den)
+		}
+		if length += steps.num; length > MaxImportSteps {
+			return nil, fmt.Errorf("tune is longer than %d steps", MaxImportSteps)
+		}
+	}
+
+	for _, n := range p.notes {
+		steps := n.length.mul(fraction{StepsPerBar, 1})
+		start := p.tab.Length + 1
+		p.tab.Length += steps.num
+		if n.rest {
+			for s := start; s <= p.tab.Length; s++ {
+				p.tab.Steps = append(p.tab.Steps, TabStep{Step: s, Rest: true})
+			}
+			continue
+		}
+		if n.note < 0 || n.note > 127 {
+			return nil, fmt.Errorf("note out of MIDI range")
+		}
+		p.tab.Steps = append(p.tab.Steps, TabStep{Step: start, Note: uint8(n.note), Duration: steps.num})
+		for s := start + 1; s <= p.tab.Length; s++ {
+			p.tab.Steps = append(p.tab.Steps, TabStep{Step: s, Rest: true})
+		}
+	}
+	return p.tab, nil
+}
+
+func (p *abcParser) peek() rune {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// skipPast advances past the next occurrence of end
+func (p *abcParser) skipPast(end rune) error {
+	start := p.src[p.pos-1]
+	for p.pos < len(p.src) {
+		p.pos++
+		if p.src[p.pos-1] == end {
+			return nil
+		}
+	}
+	return fmt.Errorf("unterminated %c", start)
+}
+
+// atField reports whether a header field such as K:G starts here
+func (p *abcParser) atField() bool {
+	if p.pos+1 >= len(p.src) || p.src[p.pos+1] != ':' {
+		return false
+	}
+	return strings.ContainsRune("KLQMTX", p.src[p.pos])
+}
+
+func (p *abcParser) parse() error {
+	var brokenNext fraction // length factor for the note after > or <
+	tie := false
+	for p.pos < len(p.src) {
+		c := p.peek()
+		switch {
+		case unicode.IsSpace(c) || c == '\\' || c == ')' || c == '~' || c == '.':
+			p.pos++
+		case (p.pos == 0 || unicode.IsSpace(p.src[p.pos-1])) && p.atField():
+			end := p.pos
+			for end < len(p.src) && !unicode.IsSpace(p.src[end]) {
+				end++
+			}
+			if err := p.field(string(p.src[p.pos:end])); err != nil {
+				return err
+			}
+			p.pos = end
+		case c == '[' && p.pos+2 < len(p.src) && p.src[p.pos+2] == ':':
+			start := p.pos + 1
+			p.pos++
+			if err := p.skipPast(']'); err != nil {
+				return err
+			}
+			if err := p.field(string(p.src[start : p.pos-1])); err != nil {
+				return err
+			}
+		case c == '|' || c == ':' || c == ']' || (c == '[' && p.pos+1 < len(p.src) && (p.src[p.pos+1] == '|' || unicode.IsDigit(p.src[p.pos+1]))):
+			p.pos++
+			for p.pos < len(p.src) && (unicode.IsDigit(p.peek()) || p.peek() == '|' || p.peek() == ':' || p.peek() == ']') {
+				p.pos++
+			}
+			p.bar = map[string]int{}
+		case c == '[':
+			return fmt.Errorf("chords can't be played on the step grid (one note per step)")
+		case c == '"':
+			p.pos++
+			if err := p.skipPast('"'); err != nil {
+				return err
+			}
+		case c == '!' || c == '+':
+			p.pos++
+			if err := p.skipPast(c); err != nil {
+				return err
+			}
+		case c == '{':
+			p.pos++
+			if err := p.skipPast('}'); err != nil {
+				return err
+			}
+		case c == '(':
+			p.pos++
+			if unicode.IsDigit(p.peek()) {
+				return fmt.Errorf("tuplets can't be played on the 16th-note grid")
+			}
+		case c == '-':
+			if len(p.notes) == 0 || p.notes[len(p.notes)-1].rest {
+				return fmt.Errorf("tie '-' has no note to hold")
+			}
+			tie = true
+			p.pos++
+		case c == '>' || c == '<':
+			if len(p.notes) == 0 {
+				return fmt.Errorf("broken rhythm '%c' has no note before it", c)
+			}
+			dotted, short := fraction{3, 2}, fraction{1, 2}
+			if c == '<' {
+				dotted, short = short, dotted
+			}
+			last := &p.notes[len(p.notes)-1]
+			last.length = last.length.mul(dotted)
+			if err := checkLength(last.length); err != nil {
+				return err
+			}
+			brokenNext = short
+			p.pos++
+		case strings.ContainsRune("^_=ABCDEFGabcdefgzx", c):
+			n, err := p.note()
+			if err != nil {
+				return err
+			}
+			if brokenNext.den != 0 {
+				n.length = n.length.mul(brokenNext)
+				brokenNext = fraction{}
+			}
+			if err := checkLength(n.length); err != nil {
+				return err
+			}
+			if tie {
+				tie = false
+				last := &p.notes[len(p.notes)-1]
+				if !n.rest && n.note == last.note {
+					last.length = last.length.add(n.length)
+					if err := checkLength(last.length); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			p.notes = append(p.notes, n)
+		default:
+			return fmt.Errorf("unexpected %q in ABC tune", c)
+		}
+	}
+	return nil
+}
+
+// field applies a header field such as L:1/16, K:Am or Q:1/4=120
+func (p *abcParser) field(field string) error {
+	name, value := field[0], strings.TrimSpace(field[2:])
+	switch name {
+	case 'L':
+		f, err := parseFraction(value)
+		if err != nil {
+			return fmt.Errorf("invalid L: field %q", value)
+		}
+		p.unit = f
+	case 'K':
+		return p.setKey(value)
+	case 'Q':
+		// Q:120 or Q:1/4=120; tempo is in quarter notes per minute
+		beat, bpmText := fraction{1, 4}, value
+		if i := strings.IndexByte(value, '='); i >= 0 {
+			f, err := parseFraction(value[:i])
+			if err != nil {
+				return fmt.Errorf("invalid Q: field %q", value)
+			}
+			beat, bpmText = f, value[i+1:]
+		}
+		bpm, err := strconv.Atoi(bpmText)
+		if err != nil || bpm < 1 || bpm > abcMaxTerm {
+			return fmt.Errorf("invalid Q: field %q", value)
+		}
+		bpm = bpm * beat.num * 4 / beat.den
+		if bpm < 20 || bpm > 300 {
+			return fmt.Errorf("tempo must be 20-300 BPM, got %d", bpm)
+		}
+		p.tab.Tempo = bpm
+	}
+	return nil
+}
+
+// setKey sets the key signature from a K: value such as G, Am, Ddor or Bb
+func (p *abcParser) setKey(value string) error {
+	if value == "" || value == "none" {
+		p.key = map[rune]int{}
+		return nil
+	}
+	tonic := value[:1]
+	rest := value[1:]
+	if len(rest) > 0 && (rest[0] == '#' || rest[0] == 'b') {
+		tonic, rest = value[:2], rest[1:]
+	}
+	mode := strings.ToLower(rest)
+	if len(mode) > 3 {
+		mode = mode[:3]
+	}
+	// The tonic's major key sets the base; the mode shifts it
+	base, ok := abcMajorFifths[strings.ToUpper(tonic[:1])+tonic[1:]]
+	shift, modeOK := abcModeFifths[mode]
+	if !ok || !modeOK {
+		return fmt.Errorf("unknown key %q (e.g., K:G, K:Am, K:Ddor)", value)
+	}
+	fifths := base + shift
+	if fifths < -7 || fifths > 7 {
+		return fmt.Errorf("unsupported key %q", value)
+	}
+	p.key = map[rune]int{}
+	for i := 0; i < fifths; i++ {
+		p.key[rune(abcSharpOrder[i])] = 1
+	}
+	for i := 0; i < -fifths; i++ {
+		p.key[rune(abcSharpOrder[6-i])] = -1
+	}
+	return nil
+}
+
+// note parses a note or rest with its accidental, octave marks and length
+func (p *abcParser) note() (abcNote, error) {
+	accidental, explicit := 0, false
+	for strings.ContainsRune("^_=", p.peek()) {
+		explicit = true
+		switch p.peek() {
+		case '^':
+			accidental++
+		case '_':
+			accidental--
+		}
+		p.pos++
+	}
+
+	c := p.peek()
+	p.pos++
+	n := abcNote{}
+	if c == 'z' || c == 'x' {
+		if explicit {
+			return n, fmt.Errorf("accidental before a rest")
+		}
+		n.rest = true
+	} else if c == 0 || !strings.ContainsRune("ABCDEFGabcdefg", c) {
+		return n, fmt.Errorf("accidental without a note")
+	} else {
+		letter := unicode.ToUpper(c)
+		n.note = 60 + abcSemitones[letter] // C is middle C
+		if unicode.IsLower(c) {
+			n.note += 12
+		}
+		for p.peek() == '\'' || p.peek() == ',' {
+			if p.peek() == '\'' {
+				n.note += 12
+			} else {
+				n.note -= 12
+			}
+			p.pos++
+		}
+		// Accidentals last until the end of the bar, at that octave only
+		barKey := fmt.Sprintf("%c%d", letter, n.note)
+		if explicit {
+			p.bar[barKey] = accidental
+		} else if a, ok := p.bar[barKey]; ok {
+			accidental = a
+		} else {
+			accidental = p.key[letter]
+		}
+		n.note += accidental
+	}
+
+	// Length: A, A2, A/2, A/, A//, A3/2
+	start := p.pos
+	for p.pos < len(p.src) && (unicode.IsDigit(p.peek()) || p.peek() == '/') {
+		p.pos++
+	}
+	multiplier, err := parseLength(string(p.src[start:p.pos]))
+	if err != nil {
+		return n, err
+	}
+	n.length = p.unit.mul(multiplier)
+	return n, nil
+}
+
+// parseLength parses an ABC length multiplier ("", "2", "/2", "/", "//", "3/2")
+func parseLength(s string) (fraction, error) {
+	if s == "" {
+		return fraction{1, 1}, nil
+	}
+	num, den := 1, 1
+	numText, denText, hasSlash := strings.Cut(s, "/")
+	if numText != "" {
+		n, err := strconv.Atoi(numText)
+		if err != nil || n < 1 || n > abcMaxTerm {
+			return fraction{}, fmt.Errorf("invalid note length %q", s)
+		}
+		num = n
+	}
+	if hasSlash {
+		den = 2
+		if strings.Trim(denText, "/") == "" {
+			// "/" halves, "//" quarters
+			if len(denText) > 15 {
+				return fraction{}, fmt.Errorf("invalid note length %q", s)
+			}
+			den <<= len(denText)
+		} else {
+			d, err := strconv.Atoi(denText)
+			if err != nil || d < 1 || d > abcMaxTerm {
+				return fraction{}, fmt.Errorf("invalid note length %q", s)
+			}
+			den = d
+		}
+	}
+	return fraction{num, den}.reduce(), nil
+}
+
+// parseFraction parses "1/8"
+func parseFraction(s string) (fraction, error) {
+	numText, denText, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return fraction{}, fmt.Errorf("invalid fraction %q", s)
+	}
+	num, err1 := strconv.Atoi(numText)
+	den, err2 := strconv.Atoi(denText)
+	if err1 != nil || err2 != nil || num < 1 || den < 1 || num > abcMaxTerm || den > abcMaxTerm {
+		return fraction{}, fmt.Errorf("invalid fraction %q", s)
+	}
+	return fraction{num, den}.reduce(), nil
+}
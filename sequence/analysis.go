@@ -0,0 +1,186 @@
+package sequence
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// StepsPerBar is the number of steps in a bar in the default meter, 4/4
+// with 16ths. Imports use it; patterns count bars with Pattern.StepsPerBar.
+const StepsPerBar = 16
+
+// pitchClassNames names pitch classes 0-11
+var pitchClassNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// Krumhansl-Kessler key profiles, starting at the tonic
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// Scale intervals used to find notes outside the detected key
+var (
+	majorScale = []int{0, 2, 4, 5, 7, 9, 11}
+	minorScale = []int{0, 2, 3, 5, 7, 8, 10}
+)
+
+// Analysis describes the musical content of a pattern
+type Analysis struct {
+	Notes          int       // number of notes (non-rest steps)
+	Key            string    // best matching key, e.g. "C minor"; "" if none stands out
+	KeyConfidence  float64   // correlation of the pitch classes with the key profile (-1 to 1)
+	OutOfKey       []string  // pitch classes played that are not in the key's scale
+	PitchClasses   [12]int   // notes per pitch class, C to B
+	BarDensity     []float64 // share of steps with a note, per bar (0-1)
+	VelocityMin    int
+	VelocityMax    int
+	VelocityMean   float64
+	VelocityStdDev float64
+	Syncopation    float64 // share of notes starting off the beat (0-1)
+}
+
+// Analyze detects the key and summarizes pitches, density, velocity and rhythm
+func (p *Pattern) Analyze() Analysis {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var a Analysis
+	var weights [12]float64 // pitch classes weighted by note duration
+	var velocitySum float64
+	var velocities []int
+	offbeat := 0
+
+	stepsPerBar := p.stepsPerBar()
+	for bar := 0; bar*stepsPerBar < len(p.Steps); bar++ {
+		steps := min(stepsPerBar, len(p.Steps)-bar*stepsPerBar)
+		notes := 0
+		for i := bar * stepsPerBar; i < bar*stepsPerBar+steps; i++ {
+			if !p.Steps[i].IsRest {
+				notes++
+			}
+		}
+		a.BarDensity = append(a.BarDensity, float64(notes)/float64(steps))
+	}
+
+	for i, step := range p.Steps {
+		if step.IsRest {
+			continue
+		}
+		a.Notes++
+		pc := int(step.Note) % 12
+		a.PitchClasses[pc]++
+		weights[pc] += float64(max(step.Duration, 1))
+
+		velocity := int(step.Velocity)
+		velocities = append(velocities, velocity)
+		velocitySum += float64(velocity)
+		if a.Notes == 1 || velocity < a.VelocityMin {
+			a.VelocityMin = velocity
+		}
+		if velocity > a.VelocityMax {
+			a.VelocityMax = velocity
+		}
+
+		if i%4 != 0 { // beats fall on every fourth step
+			offbeat++
+		}
+	}
+	if a.Notes == 0 {
+		return a
+	}
+
+	a.VelocityMean = velocitySum / float64(a.Notes)
+	var variance float64
+	for _, v := range velocities {
+		variance += (float64(v) - a.VelocityMean) * (float64(v) - a.VelocityMean)
+	}
+	a.VelocityStdDev = math.Sqrt(variance / float64(a.Notes))
+	a.Syncopation = float64(offbeat) / float64(a.Notes)
+
+	a.Key, a.KeyConfidence, a.OutOfKey = detectKey(weights, a.PitchClasses)
+	return a
+}
+
+// detectKey correlates pitch class weights with the major and minor profiles
+// in all twelve keys (Krumhansl-Schmuckler) and returns the best match
+func detectKey(weights [12]float64, counts [12]int) (string, float64, []string) {
+	bestKey, bestScale, bestScore := "", []int(nil), math.Inf(-1)
+	for tonic := 0; tonic < 12; tonic++ {
+		for _, mode := range []struct {
+			name    string
+			profile [12]float64
+			scale   []int
+		}{{"major", majorProfile, majorScale}, {"minor", minorProfile, minorScale}} {
+			var rotated [12]float64
+			for pc := 0; pc < 12; pc++ {
+				rotated[pc] = mode.profile[(pc-tonic+12)%12]
+			}
+			if score := correlation(weights, rotated); score > bestScore {
+				bestKey = pitchClassNames[tonic] + " " + mode.name
+				bestScore = score
+				bestScale = make([]int, len(mode.scale))
+				for i, interval := range mode.scale {
+					bestScale[i] = (tonic + interval) % 12
+				}
+			}
+		}
+	}
+
+	if bestKey == "" {
+		return "", 0, nil // every pitch class equally often: no key stands out
+	}
+
+	inScale := map[int]bool{}
+	for _, pc := range bestScale {
+		inScale[pc] = true
+	}
+	var outOfKey []string
+	for pc, count := range counts {
+		if count > 0 && !inScale[pc] {
+			outOfKey = append(outOfKey, pitchClassNames[pc])
+		}
+	}
+	return bestKey, bestScore, outOfKey
+}
+
+// correlation returns the Pearson correlation of x and y (NaN if x is constant)
+func correlation(x, y [12]float64) float64 {
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i] / 12
+		meanY += y[i] / 12
+	}
+	var cov, varX, varY float64
+	for i := range x {
+		cov += (x[i] - meanX) * (y[i] - meanY)
+		varX += (x[i] - meanX) * (x[i] - meanX)
+		varY += (y[i] - meanY) * (y[i] - meanY)
+	}
+	return cov / math.Sqrt(varX*varY)
+}
+
+// Summary describes the analysis in one line, e.g. for AI prompts
+func (a Analysis) Summary() string {
+	if a.Notes == 0 {
+		return "no notes"
+	}
+	parts := []string{"no clear key"}
+	if a.Key != "" {
+		parts[0] = fmt.Sprintf("key %s (confidence %.2f)", a.Key, a.KeyConfidence)
+	}
+	if len(a.OutOfKey) > 0 {
+		parts = append(parts, "outside the key: "+strings.Join(a.OutOfKey, " "))
+	}
+	density := make([]string, len(a.BarDensity))
+	for i, d := range a.BarDensity {
+		density[i] = fmt.Sprintf("%.0f%%", d*100)
+	}
+	parts = append(parts,
+		fmt.Sprintf("%d notes", a.Notes),
+		"density per bar "+strings.Join(density, "/"),
+		fmt.Sprintf("velocity %d-%d (mean %.0f)", a.VelocityMin, a.VelocityMax, a.VelocityMean),
+		fmt.Sprintf("%.0f%% of notes off the beat", a.Syncopation*100),
+	)
+	return strings.Join(parts, ", ")
+}
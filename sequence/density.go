@@ -0,0 +1,91 @@
+package sequence
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// WithDensity returns a copy of the pattern with about percent of its steps
+// holding a note, and how many notes it removed and added. Thinning removes
+// the quietest notes first, off-beat before on-beat. Thickening puts notes
+// from the scale, within the pattern's pitch range and at its mean velocity,
+// on random free steps (rests no held note covers). random returns numbers
+// in [0, 1), e.g. rand.Float64.
+func (p *Pattern) WithDensity(percent int, scale Scale, random func() float64) (*Pattern, int, int, error) {
+	if percent < 0 || percent > 100 {
+		return nil, 0, 0, fmt.Errorf("density must be 0-100%%")
+	}
+	out := p.Clone()
+	steps := out.Steps
+	target := int(math.Round(float64(percent) * float64(len(steps)) / 100))
+
+	var notes []int
+	for i, step := range steps {
+		if !step.IsRest {
+			notes = append(notes, i)
+		}
+	}
+
+	if len(notes) > target {
+		sort.SliceStable(notes, func(a, b int) bool {
+			x, y := steps[notes[a]], steps[notes[b]]
+			if x.Velocity != y.Velocity {
+				return x.Velocity < y.Velocity
+			}
+			return notes[a]%4 != 0 && notes[b]%4 == 0
+		})
+		removed := notes[:len(notes)-target]
+		for _, i := range removed {
+			steps[i] = Step{IsRest: true, Velocity: 100, Gate: 90, Duration: 1, CCValues: steps[i].CCValues}
+		}
+		return out, len(removed), 0, nil
+	}
+	if len(notes) == target {
+		return out, 0, 0, nil
+	}
+	if len(notes) == 0 {
+		return nil, 0, 0, fmt.Errorf("the pattern has no notes to take a pitch range from")
+	}
+
+	// Notes to choose from: the scale within the pattern's range
+	low, high := steps[notes[0]].Note, steps[notes[0]].Note
+	velocitySum := 0
+	for _, i := range notes {
+		low, high = min(low, steps[i].Note), max(high, steps[i].Note)
+		velocitySum += int(steps[i].Velocity)
+	}
+	var pitches []uint8
+	for note := int(low); note <= int(high); note++ {
+		if IsInScale(uint8(note), scale) {
+			pitches = append(pitches, uint8(note))
+		}
+	}
+	if len(pitches) == 0 {
+		return nil, 0, 0, fmt.Errorf("no notes of the scale within the pattern's range %s-%s", MIDIToNoteName(low), MIDIToNoteName(high))
+	}
+	velocity := uint8(velocitySum / len(notes))
+
+	held := make([]bool, len(steps))
+	for _, i := range notes {
+		for j := i + 1; j < i+steps[i].Duration && j < len(steps); j++ {
+			held[j] = true
+		}
+	}
+	var free []int
+	for i, step := range steps {
+		if step.IsRest && !held[i] {
+			free = append(free, i)
+		}
+	}
+
+	added := 0
+	for ; added < target-len(notes) && len(free) > 0; added++ {
+		k := int(random() * float64(len(free)))
+		i := free[k]
+		free = append(free[:k], free[k+1:]...)
+		note := pitches[int(random()*float64(len(pitches)))]
+		steps[i] = Step{Note: note, Velocity: velocity, Gate: 90, Duration: 1, CCValues: steps[i].CCValues}
+	}
+	return out, 0, added, nil
+}
@@ -0,0 +1,119 @@
+package sequence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// describeStep formats a step like the 'set' command, omitting defaults
+func describeStep(step Step) string {
+	if step.IsRest {
+		return "rest"
+	}
+	desc := MIDIToNoteName(step.Note)
+	if step.Velocity != 100 {
+		desc += fmt.Sprintf(" vel:%d", step.Velocity)
+	}
+	if step.GateMs > 0 {
+		desc += fmt.Sprintf(" gate:%dms", step.GateMs)
+	} else if step.Gate != 90 {
+		desc += fmt.Sprintf(" gate:%d", step.Gate)
+	}
+	if step.Duration != 1 {
+		desc += fmt.Sprintf(" dur:%d", step.Duration)
+	}
+	if step.Muted {
+		desc += " muted"
+	}
+	if step.Straight {
+		desc += " straight"
+	}
+	return desc
+}
+
+// describeCC formats an optional CC value
+func describeCC(value int, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%d", value)
+}
+
+// Diff lists the differences between two patterns, one line each, e.g.
+// "tempo: 80 → 120" or "step 5: rest → C2 vel:110". Returns nil if they
+// are the same.
+func Diff(before, after *Pattern) []string {
+	before.mu.RLock()
+	defer before.mu.RUnlock()
+	after.mu.RLock()
+	defer after.mu.RUnlock()
+
+	var lines []string
+	changed := func(name string, from, to any) {
+		if from != to {
+			lines = append(lines, fmt.Sprintf("%s: %v → %v", name, from, to))
+		}
+	}
+	changed("tempo", before.BPM, after.BPM)
+	changed("length", len(before.Steps), len(after.Steps))
+	changed("swing", before.SwingPercent, after.SwingPercent)
+	changed("swing unit", max(before.SwingUnit, 1), max(after.SwingUnit, 1))
+	changed("humanize velocity", before.Humanization.VelocityRange, after.Humanization.VelocityRange)
+	changed("humanize timing", before.Humanization.TimingMs, after.Humanization.TimingMs)
+	changed("humanize gate", before.Humanization.GateRange, after.Humanization.GateRange)
+	changed("volume", describeCC(before.Volume, before.Volume >= 0), describeCC(after.Volume, after.Volume >= 0))
+	changed("noteoff-mode", before.NoteOff.orRing(), after.NoteOff.orRing())
+	changed("retrigger", !before.Legato, !after.Legato)
+	changed("meter", before.meter(), after.meter())
+	changed("tags", strings.Join(before.Tags, " "), strings.Join(after.Tags, " "))
+
+	for _, cc := range sortedKeys(mergeKeys(before.globalCC, after.globalCC)) {
+		from, fromOK := before.globalCC[cc]
+		to, toOK := after.globalCC[cc]
+		changed(fmt.Sprintf("cc %d", cc), describeCC(from, fromOK), describeCC(to, toOK))
+	}
+
+	for i := 0; i < max(len(before.Steps), len(after.Steps)); i++ {
+		var from, to Step
+		fromDesc, toDesc := "-", "-"
+		if i < len(before.Steps) {
+			from = before.Steps[i]
+			fromDesc = describeStep(from)
+		}
+		if i < len(after.Steps) {
+			to = after.Steps[i]
+			toDesc = describeStep(to)
+		}
+		// Steps beyond the shorter pattern are covered by the length line
+		if (fromDesc == "-" && to.IsRest) || (toDesc == "-" && from.IsRest) {
+			continue
+		}
+		changed(fmt.Sprintf("step %d", i+1), fromDesc, toDesc)
+		for _, cc := range sortedKeys(mergeKeys(from.CCValues, to.CCValues)) {
+			fromValue, fromOK := from.CCValues[cc]
+			toValue, toOK := to.CCValues[cc]
+			changed(fmt.Sprintf("step %d cc %d", i+1, cc), describeCC(fromValue, fromOK), describeCC(toValue, toOK))
+		}
+	}
+	return lines
+}
+
+// orRing returns the mode, with the default spelled out
+func (m NoteOffMode) orRing() NoteOffMode {
+	if m == "" {
+		return NoteOffRing
+	}
+	return m
+}
+
+// mergeKeys returns a map with the keys of both CC maps
+func mergeKeys(a, b map[int]int) map[int]int {
+	keys := make(map[int]int, len(a)+len(b))
+	for k := range a {
+		keys[k] = 0
+	}
+	for k := range b {
+		keys[k] = 0
+	}
+	return keys
+}
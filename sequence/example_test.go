@@ -0,0 +1,42 @@
+package sequence_test
+
+import (
+	"fmt"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+func Example() {
+	p := sequence.New(16)
+	p.SetTempo(120)
+	for step, name := range map[int]string{1: "C2", 5: "Eb2", 9: "G2", 13: "Bb2"} {
+		note, _ := sequence.NoteNameToMIDI(name)
+		p.SetNote(step, note)
+	}
+	p.SetVelocity(1, 120)
+
+	// Save and load through a Store; DirStore keeps JSON files instead
+	var store sequence.MemoryStore
+	store.Save("bass", p)
+	loaded, _ := store.Load("bass")
+	fmt.Println(loaded.GetBPM(), loaded.Length(), sequence.MIDIToNoteName(loaded.Steps[4].Note))
+	// Output: 120 16 D#2
+}
+
+func ExampleIsInScale() {
+	scale, _ := sequence.ParseScale("C minor")
+	for _, name := range []string{"Eb3", "E3"} {
+		note, _ := sequence.NoteNameToMIDI(name)
+		fmt.Println(name, sequence.IsInScale(note, scale))
+	}
+	// Output:
+	// Eb3 true
+	// E3 false
+}
+
+func ExampleTranspose() {
+	note, _ := sequence.NoteNameToMIDI("C3")
+	fifth, _ := sequence.Transpose(note, 7)
+	fmt.Println(sequence.MIDIToNoteName(fifth), sequence.Interval(note, fifth))
+	// Output: G3 7
+}
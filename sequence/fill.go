@@ -0,0 +1,29 @@
+package sequence
+
+// Fill returns a copy of the pattern whose last bar rolls into the next
+// loop: each rest in it repeats the note before it as a short hit, getting
+// louder towards the end. Notes already there stay; rests before the
+// pattern's first note stay rests.
+func (p *Pattern) Fill() *Pattern {
+	fill := p.Clone()
+	start := max(len(fill.Steps)-fill.stepsPerBar(), 0)
+	last := len(fill.Steps) - 1
+
+	var prev *Step
+	for i := range fill.Steps {
+		step := &fill.Steps[i]
+		if !step.IsRest && !step.Muted {
+			prev = step
+			continue
+		}
+		if i < start || prev == nil || !step.IsRest {
+			continue
+		}
+		velocity := 127
+		if last > start {
+			velocity = 70 + (127-70)*(i-start)/(last-start)
+		}
+		*step = Step{Note: prev.Note, Velocity: uint8(velocity), Gate: 50, Duration: 1, CCValues: step.CCValues}
+	}
+	return fill
+}
@@ -0,0 +1,217 @@
+package sequence
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// hydrogenTicksPerStep is one 16th note in Hydrogen's 48 ticks per quarter
+const hydrogenTicksPerStep = 12
+
+// hydrogenBaseNote is the MIDI note of instrument 0 when a Hydrogen kit
+// doesn't set one (Hydrogen's own default: kick on 36, GM drum map)
+const hydrogenBaseNote = 36
+
+// MaxImportSteps is the longest pattern an import makes (64 bars), so a
+// corrupt or hostile file can't make it allocate without bound
+const MaxImportSteps = 1024
+
+// Imported is a pattern read from another program's file
+type Imported struct {
+	Pattern   *Pattern
+	HasTempo  bool // the file set the tempo
+	Dropped   int  // hits dropped because a louder note plays on the same step
+	Quantized int  // hits moved to the nearest 16th-note step
+}
+
+// setHit sets a step unless a louder note is already on it; Interplay
+// patterns play one note per step, so simultaneous drum hits collapse
+func (imp *Imported) setHit(step int, note, velocity uint8) {
+	s := &imp.Pattern.Steps[step-1]
+	if !s.IsRest {
+		imp.Dropped++
+		if s.Velocity >= velocity {
+			return
+		}
+	}
+	*s = Step{Note: note, Velocity: velocity, Gate: 90, Duration: 1}
+}
+
+// hydrogenFile covers both .h2song files (<song>) and exported
+// .h2pattern files (<drumkit_pattern>)
+type hydrogenFile struct {
+	BPM         float64              `xml:"bpm"`
+	Instruments []hydrogenInstrument `xml:"instrumentList>instrument"`
+	Patterns    []hydrogenPattern    `xml:"patternList>pattern"`
+	Pattern     *hydrogenPattern     `xml:"pattern"`
+}
+
+type hydrogenInstrument struct {
+	ID          int  `xml:"id"`
+	MIDIOutNote *int `xml:"midiOutNote"`
+}
+
+type hydrogenPattern struct {
+	Name  string         `xml:"name"`
+	Size  int            `xml:"size"`
+	Notes []hydrogenNote `xml:"noteList>note"`
+}
+
+type hydrogenNote struct {
+	Position   int     `xml:"position"`
+	Velocity   float64 `xml:"velocity"`
+	Instrument int     `xml:"instrument"`
+}
+
+// ImportHydrogen reads a pattern from a Hydrogen .h2song or .h2pattern
+// file. name selects one of the song's patterns; "" takes the first.
+// Instruments play their MIDI out note (36 + instrument id by default).
+func ImportHydrogen(r io.Reader, name string) (*Imported, error) {
+	var file hydrogenFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid Hydrogen file: %w", err)
+	}
+
+	patterns := file.Patterns
+	if file.Pattern != nil {
+		patterns = append(patterns, *file.Pattern)
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no patterns in Hydrogen file")
+	}
+	hp := &patterns[0]
+	if name != "" {
+		hp = nil
+		var names []string
+		for i := range patterns {
+			names = append(names, patterns[i].Name)
+			if strings.EqualFold(patterns[i].Name, name) {
+				hp = &patterns[i]
+			}
+		}
+		if hp == nil {
+			return nil, fmt.Errorf("no pattern '%s' in Hydrogen file (patterns: %s)", name, strings.Join(names, ", "))
+		}
+	}
+
+	notes := make(map[int]uint8)
+	for _, inst := range file.Instruments {
+		if inst.MIDIOutNote != nil && *inst.MIDIOutNote >= 0 && *inst.MIDIOutNote <= 127 {
+			notes[inst.ID] = uint8(*inst.MIDIOutNote)
+		}
+	}
+
+	length := hp.Size / hydrogenTicksPerStep
+	if length > MaxImportSteps {
+		return nil, fmt.Errorf("pattern '%s' is %d steps long, more than %d", hp.Name, length, MaxImportSteps)
+	}
+	if length < 1 {
+		length = StepsPerBar // Hydrogen's default pattern: one 4/4 bar
+	}
+	imp := &Imported{Pattern: New(length)}
+	if file.BPM >= 20 && file.BPM <= 300 {
+		imp.Pattern.BPM = math.Round(file.BPM*100) / 100
+		imp.HasTempo = true
+	}
+
+	for _, n := range hp.Notes {
+		step := int(math.Round(float64(n.Position)/hydrogenTicksPerStep)) + 1
+		if n.Position%hydrogenTicksPerStep != 0 {
+			imp.Quantized++
+		}
+		if step < 1 || step > length {
+			continue
+		}
+		note, ok := notes[n.Instrument]
+		if !ok {
+			if hydrogenBaseNote+n.Instrument > 127 {
+				return nil, fmt.Errorf("instrument %d has no MIDI note", n.Instrument)
+			}
+			note = uint8(hydrogenBaseNote + n.Instrument)
+		}
+		velocity := uint8(max(1, min(127, math.Round(n.Velocity*127))))
+		imp.setHit(step, note, velocity)
+	}
+	return imp, nil
+}
+
+// ImportCSV reads a pattern from CSV rows of step,note[,velocity], e.g.
+// "1,C1,110" or "5,38". Steps are 1-based, notes are names or MIDI numbers,
+// and velocity defaults to 100. A header row and # comments are skipped.
+// The pattern is as long as the last step, rounded up to a whole bar.
+func ImportCSV(r io.Reader) (*Imported, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	type hit struct {
+		step     int
+		note     uint8
+		velocity uint8
+	}
+	var hits []hit
+	length := 0
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("row %d: want step,note[,velocity], got %d fields", row, len(record))
+		}
+		step, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil {
+			if row == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("row %d: invalid step %q", row, record[0])
+		}
+		if step < 1 || step > MaxImportSteps {
+			return nil, fmt.Errorf("row %d: step must be 1-%d, got %d", row, MaxImportSteps, step)
+		}
+		note, err := parseNoteOrNumber(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		velocity := 100
+		if len(record) == 3 && strings.TrimSpace(record[2]) != "" {
+			velocity, err = strconv.Atoi(strings.TrimSpace(record[2]))
+			if err != nil || velocity < 1 || velocity > 127 {
+				return nil, fmt.Errorf("row %d: velocity must be 1-127, got %q", row, record[2])
+			}
+		}
+		hits = append(hits, hit{step, note, uint8(velocity)})
+		length = max(length, step)
+	}
+	if len(hits) == 0 {
+		return nil, fmt.Errorf("no notes in CSV")
+	}
+
+	length = (length + StepsPerBar - 1) / StepsPerBar * StepsPerBar
+	imp := &Imported{Pattern: New(length)}
+	for _, h := range hits {
+		imp.setHit(h.step, h.note, h.velocity)
+	}
+	return imp, nil
+}
+
+// parseNoteOrNumber accepts a note name (C1) or a MIDI note number (36)
+func parseNoteOrNumber(s string) (uint8, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > 127 {
+			return 0, fmt.Errorf("note must be 0-127, got %d", n)
+		}
+		return uint8(n), nil
+	}
+	return NoteNameToMIDI(s)
+}
@@ -0,0 +1,144 @@
+package sequence
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultResolution is the note value of a step unless set otherwise: 16ths
+const DefaultResolution = 16
+
+// resolutions are the note values a step can have
+var resolutions = []int{4, 8, 16, 32}
+
+// beatValues are the note values a time signature's beat can have
+var beatValues = []int{2, 4, 8, 16}
+
+// maxBeats limits the beats per bar
+const maxBeats = 32
+
+// ParseTimeSignature reads a time signature such as "4/4" or "6/8"
+func ParseTimeSignature(s string) (beats, value int, err error) {
+	num, den, ok := strings.Cut(s, "/")
+	beats, err1 := strconv.Atoi(num)
+	value, err2 := strconv.Atoi(den)
+	if !ok || err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("invalid time signature %q (e.g., 4/4 or 6/8)", s)
+	}
+	return beats, value, nil
+}
+
+// ParseResolution reads a step note value such as "16th", "8th" or "16"
+func ParseResolution(s string) (int, error) {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(s), "th"), "nd")
+	r, err := strconv.Atoi(num)
+	if err != nil || !slices.Contains(resolutions, r) {
+		return 0, fmt.Errorf("resolution must be 4th, 8th, 16th or 32nd, got %q", s)
+	}
+	return r, nil
+}
+
+// checkMeter validates a time signature and resolution: a bar must be a
+// whole number of steps
+func checkMeter(beats, value, resolution int) error {
+	if beats < 1 || beats > maxBeats {
+		return fmt.Errorf("beats per bar must be 1-%d, got %d", maxBeats, beats)
+	}
+	if !slices.Contains(beatValues, value) {
+		return fmt.Errorf("beat value must be 2, 4, 8 or 16, got %d", value)
+	}
+	if !slices.Contains(resolutions, resolution) {
+		return fmt.Errorf("resolution must be 4, 8, 16 or 32, got %d", resolution)
+	}
+	if beats*resolution%value != 0 {
+		return fmt.Errorf("a %d/%d bar isn't a whole number of 1/%d steps", beats, value, resolution)
+	}
+	return nil
+}
+
+// timeSignature returns the time signature with defaults filled in. The
+// caller holds the lock.
+func (p *Pattern) timeSignature() (beats, value int) {
+	beats, value = p.Beats, p.BeatValue
+	if beats == 0 {
+		beats = 4
+	}
+	if value == 0 {
+		value = 4
+	}
+	return beats, value
+}
+
+// resolution returns the note value of a step. The caller holds the lock.
+func (p *Pattern) resolution() int {
+	if p.Resolution == 0 {
+		return DefaultResolution
+	}
+	return p.Resolution
+}
+
+// SetMeter sets the time signature, e.g. 6 and 8 for 6/8, and the note
+// value of a step, e.g. 16 for 16ths. The resolution changes how long a
+// step plays at a given tempo.
+func (p *Pattern) SetMeter(beats, value, resolution int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := checkMeter(beats, value, resolution); err != nil {
+		return err
+	}
+	p.Beats, p.BeatValue, p.Resolution = beats, value, resolution
+	p.version++
+	return nil
+}
+
+// GetTimeSignature returns the beats per bar and the note value of a beat
+func (p *Pattern) GetTimeSignature() (beats, value int) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.timeSignature()
+}
+
+// GetResolution returns the note value of a step (16 for 16ths)
+func (p *Pattern) GetResolution() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.resolution()
+}
+
+// StepsPerBar returns the number of steps in a bar, from the time
+// signature and resolution: 16 in 4/4 with 16ths, 12 in 6/8
+func (p *Pattern) StepsPerBar() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.stepsPerBar()
+}
+
+// stepsPerBar is StepsPerBar for callers holding the lock
+func (p *Pattern) stepsPerBar() int {
+	beats, value := p.timeSignature()
+	return beats * p.resolution() / value
+}
+
+// Meter describes the time signature and resolution, e.g. "6/8 in 16ths"
+func (p *Pattern) Meter() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.meter()
+}
+
+// meter is Meter for callers holding the lock
+func (p *Pattern) meter() string {
+	beats, value := p.timeSignature()
+	return fmt.Sprintf("%d/%d in %ss", beats, value, ordinal(p.resolution()))
+}
+
+// ordinal spells a note value: 4th, 8th, 16th, 32nd
+func ordinal(n int) string {
+	if n%10 == 2 && n%100 != 12 {
+		return fmt.Sprintf("%dnd", n)
+	}
+	return fmt.Sprintf("%dth", n)
+}
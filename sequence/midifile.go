@@ -0,0 +1,208 @@
+package sequence
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// TicksPerQuarter is the time resolution of exported MIDI files
+const TicksPerQuarter = 96
+
+// ticksPerStep is the length of one step, from the resolution: 24 ticks
+// for 16ths. The caller holds the lock.
+func (p *Pattern) ticksPerStep() int {
+	return TicksPerQuarter * 4 / p.resolution()
+}
+
+// midiFileEvent is a channel or meta event at an absolute tick
+type midiFileEvent struct {
+	tick     int
+	priority int // orders events at the same tick: note-offs, then CCs, then note-ons
+	data     []byte
+}
+
+// WriteMIDIFile writes the pattern as a Standard MIDI File (format 0) on
+// channel 1, repeated for the given number of loops. Tempo, swing, velocity,
+// gate, duration and CC automation are exported; humanization is not, since
+// it is random per playback.
+func (p *Pattern) WriteMIDIFile(w io.Writer, loops int) error {
+	if loops < 1 {
+		return fmt.Errorf("loops must be at least 1, got %d", loops)
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	loopTicks := len(p.Steps) * p.ticksPerStep()
+	events := []midiFileEvent{tempoEvent(0, p.BPM)}
+	for loop := 0; loop < loops; loop++ {
+		events = p.appendLoopEvents(events, loop*loopTicks)
+	}
+	return writeMIDITrack(w, events, loops*loopTicks)
+}
+
+// WriteMIDIPerformance writes patterns played one loop each, one after
+// another, as a single Standard MIDI File: a whole performance with its
+// pattern changes, instead of one pattern repeated. Each loop plays at its
+// pattern's tempo, with a tempo change wherever it differs from the loop
+// before.
+func WriteMIDIPerformance(w io.Writer, loops []*Pattern) error {
+	if len(loops) == 0 {
+		return fmt.Errorf("a performance needs at least one loop")
+	}
+
+	var events []midiFileEvent
+	tick := 0
+	bpm := 0.0
+	for _, p := range loops {
+		p.mu.RLock()
+		if p.BPM != bpm {
+			events = append(events, tempoEvent(tick, p.BPM))
+			bpm = p.BPM
+		}
+		events = p.appendLoopEvents(events, tick)
+		tick += len(p.Steps) * p.ticksPerStep()
+		p.mu.RUnlock()
+	}
+	return writeMIDITrack(w, events, tick)
+}
+
+// tempoEvent sets the tempo, in microseconds per quarter note
+func tempoEvent(tick int, bpm float64) midiFileEvent {
+	usPerQuarter := int(math.Round(60_000_000 / bpm))
+	return midiFileEvent{
+		tick: tick,
+		data: []byte{0xFF, 0x51, 0x03, byte(usPerQuarter >> 16), byte(usPerQuarter >> 8), byte(usPerQuarter)},
+	}
+}
+
+// appendLoopEvents adds one loop of the pattern starting at loopStart. The
+// caller holds the read lock.
+func (p *Pattern) appendLoopEvents(events []midiFileEvent, loopStart int) []midiFileEvent {
+	const channel = 0
+	ticksPerStep := p.ticksPerStep()
+	loopEnd := loopStart + len(p.Steps)*ticksPerStep
+	if p.Volume >= 0 {
+		events = append(events, midiFileEvent{loopStart, 1, []byte{0xB0 | channel, CCVolume, byte(p.Volume)}})
+	}
+	for _, ccNum := range sortedKeys(p.globalCC) {
+		events = append(events, midiFileEvent{loopStart, 1, []byte{0xB0 | channel, byte(ccNum), byte(p.globalCC[ccNum])}})
+	}
+
+	for i, step := range p.Steps {
+		start := loopStart + i*ticksPerStep
+
+		// Swing delays the off-beat 16ths or 8ths, as in playback
+		start += ticksPerStep * p.swingDelay(i) / 100
+
+		// Muted steps are silent, as in playback
+		if step.Muted {
+			continue
+		}
+
+		for _, ccNum := range sortedKeys(step.CCValues) {
+			events = append(events, midiFileEvent{start, 1, []byte{0xB0 | channel, byte(ccNum), byte(step.CCValues[ccNum])}})
+		}
+
+		if step.IsRest {
+			continue
+		}
+
+		velocity := step.Velocity
+		if velocity == 0 {
+			velocity = 100
+		}
+		gate := step.Gate
+		if gate == 0 {
+			gate = 90
+		}
+		duration := step.Duration
+		if duration < 1 {
+			duration = 1
+		}
+
+		length := duration * ticksPerStep * gate / 100
+		if step.GateMs > 0 {
+			// A quarter note lasts 60000/BPM milliseconds
+			length = int(float64(step.GateMs*TicksPerQuarter) * p.BPM / 60_000)
+		}
+		if length < 1 {
+			length = 1
+		}
+		// Notes ring past the loop boundary, as in playback, unless cut
+		end := start + length
+		if p.NoteOff == NoteOffCut {
+			end = min(end, loopEnd)
+		}
+
+		events = append(events,
+			midiFileEvent{start, 2, []byte{0x90 | channel, step.Note, velocity}},
+			midiFileEvent{end, 0, []byte{0x80 | channel, step.Note, 0}},
+		)
+	}
+	return events
+}
+
+// writeMIDITrack sorts the events into a format 0 Standard MIDI File whose
+// track ends at endTick
+func writeMIDITrack(w io.Writer, events []midiFileEvent, endTick int) error {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].tick != events[j].tick {
+			return events[i].tick < events[j].tick
+		}
+		return events[i].priority < events[j].priority
+	})
+
+	var track bytes.Buffer
+	lastTick := 0
+	for _, ev := range events {
+		writeVarLen(&track, ev.tick-lastTick)
+		track.Write(ev.data)
+		lastTick = ev.tick
+	}
+	// End of track after the last loop
+	writeVarLen(&track, endTick-lastTick)
+	track.Write([]byte{0xFF, 0x2F, 0x00})
+
+	var out bytes.Buffer
+	out.WriteString("MThd")
+	binary.Write(&out, binary.BigEndian, uint32(6))
+	binary.Write(&out, binary.BigEndian, uint16(0)) // format 0: single track
+	binary.Write(&out, binary.BigEndian, uint16(1)) // one track
+	binary.Write(&out, binary.BigEndian, uint16(TicksPerQuarter))
+	out.WriteString("MTrk")
+	binary.Write(&out, binary.BigEndian, uint32(track.Len()))
+	out.Write(track.Bytes())
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// writeVarLen writes a MIDI variable-length quantity
+func writeVarLen(buf *bytes.Buffer, value int) {
+	var stack [4]byte
+	n := 0
+	stack[n] = byte(value & 0x7F)
+	n++
+	for value >>= 7; value > 0; value >>= 7 {
+		stack[n] = byte(value&0x7F) | 0x80
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		buf.WriteByte(stack[i])
+	}
+}
+
+// sortedKeys returns the keys of a CC map in ascending order, so exports are deterministic
+func sortedKeys(m map[int]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,86 @@
+package sequence
+
+import "math"
+
+// Morph moves from one pattern to another in stages, e.g. over several
+// loops of a live transition. Each step switches to the target at its own
+// random point along the way and stays switched, so the pattern changes a
+// few steps at a time instead of flickering between the two.
+type Morph struct {
+	from, to *Pattern
+	order    []float64 // amount at which each step switches to the target
+}
+
+// NewMorph prepares a morph between copies of from and to. random returns
+// numbers in [0, 1), e.g. rand.Float64.
+func NewMorph(from, to *Pattern, random func() float64) *Morph {
+	m := &Morph{from: from.Clone(), to: to.Clone()}
+	m.order = make([]float64, len(m.from.Steps))
+	for i := range m.order {
+		// Above 0, so no step switches before the morph starts
+		m.order[i] = 1 - random()
+	}
+	return m
+}
+
+// At returns the pattern amount of the way from the start to the target
+// (0-1). Switched steps play the target's note, the others the start's;
+// where both steps are notes the velocity is interpolated, as are CC
+// values both have, tempo, swing, humanization and volume. The pattern
+// keeps the start's length until amount reaches 1, when it is the target.
+func (m *Morph) At(amount float64) *Pattern {
+	if amount >= 1 {
+		return m.to.Clone()
+	}
+	amount = math.Max(amount, 0)
+
+	p := m.from.Clone()
+	for i := range p.Steps {
+		from := m.from.Steps[i]
+		to := Step{IsRest: true, Velocity: 100, Gate: 90, Duration: 1}
+		if i < len(m.to.Steps) {
+			to = m.to.Steps[i]
+		}
+		step, other := from, to
+		if amount >= m.order[i] {
+			step, other = to, from
+		}
+		step = step.clone()
+		if !step.IsRest && !other.IsRest {
+			step.Velocity = uint8(lerp(int(from.Velocity), int(to.Velocity), amount))
+		}
+		for ccNum := range step.CCValues {
+			if a, ok := from.CCValues[ccNum]; ok {
+				if b, ok := to.CCValues[ccNum]; ok {
+					step.CCValues[ccNum] = lerp(a, b, amount)
+				}
+			}
+		}
+		p.Steps[i] = step
+	}
+
+	p.BPM = math.Round((m.from.BPM+(m.to.BPM-m.from.BPM)*amount)*100) / 100
+	p.SwingPercent = lerp(m.from.SwingPercent, m.to.SwingPercent, amount)
+	if amount >= 0.5 {
+		p.SwingUnit = m.to.SwingUnit
+	}
+	p.Humanization = Humanization{
+		VelocityRange: lerp(m.from.Humanization.VelocityRange, m.to.Humanization.VelocityRange, amount),
+		TimingMs:      lerp(m.from.Humanization.TimingMs, m.to.Humanization.TimingMs, amount),
+		GateRange:     lerp(m.from.Humanization.GateRange, m.to.Humanization.GateRange, amount),
+	}
+	if m.from.Volume >= 0 && m.to.Volume >= 0 {
+		p.Volume = lerp(m.from.Volume, m.to.Volume, amount)
+	}
+	for ccNum, a := range p.globalCC {
+		if b, ok := m.to.globalCC[ccNum]; ok {
+			p.globalCC[ccNum] = lerp(a, b, amount)
+		}
+	}
+	return p
+}
+
+// lerp returns the integer amount of the way from a to b
+func lerp(a, b int, amount float64) int {
+	return a + int(math.Round(float64(b-a)*amount))
+}
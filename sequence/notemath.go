@@ -0,0 +1,89 @@
+package sequence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// scaleModes are the intervals of each mode from its tonic
+var scaleModes = map[string][]int{
+	"major":            majorScale,
+	"minor":            minorScale,
+	"dorian":           {0, 2, 3, 5, 7, 9, 10},
+	"phrygian":         {0, 1, 3, 5, 7, 8, 10},
+	"lydian":           {0, 2, 4, 6, 7, 9, 11},
+	"mixolydian":       {0, 2, 4, 5, 7, 9, 10},
+	"locrian":          {0, 1, 3, 5, 6, 8, 10},
+	"harmonic-minor":   {0, 2, 3, 5, 7, 8, 11},
+	"pentatonic":       {0, 2, 4, 7, 9},
+	"minor-pentatonic": {0, 3, 5, 7, 10},
+	"blues":            {0, 3, 5, 6, 7, 10},
+	"chromatic":        {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+}
+
+// Scale is a mode on a tonic, e.g. D dorian
+type Scale struct {
+	Tonic     int   // pitch class of the tonic, 0 for C to 11 for B
+	Intervals []int // semitones above the tonic, ascending from 0
+}
+
+// ScaleModes lists the modes ParseScale knows, sorted
+func ScaleModes() []string {
+	modes := make([]string, 0, len(scaleModes))
+	for mode := range scaleModes {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// ParseScale reads a tonic and a mode, e.g. "C minor", "F# dorian" or
+// "Bb blues"; the mode defaults to major
+func ParseScale(s string) (Scale, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return Scale{}, fmt.Errorf("invalid scale %q (e.g., 'C minor', 'F# dorian')", s)
+	}
+	// The tonic is a note name without an octave, so give it one to parse
+	note, err := StandardNoteNameToMIDI(fields[0] + "4")
+	if err != nil {
+		return Scale{}, fmt.Errorf("invalid tonic %q in scale %q", fields[0], s)
+	}
+	mode := "major"
+	if len(fields) == 2 {
+		mode = strings.ToLower(fields[1])
+	}
+	intervals, ok := scaleModes[mode]
+	if !ok {
+		return Scale{}, fmt.Errorf("unknown mode %q (known: %s)", fields[1], strings.Join(ScaleModes(), ", "))
+	}
+	return Scale{Tonic: int(note) % 12, Intervals: intervals}, nil
+}
+
+// Transpose moves a note by semitones (negative for down), failing if it
+// would leave the MIDI range
+func Transpose(note uint8, semitones int) (uint8, error) {
+	moved := int(note) + semitones
+	if moved < 0 || moved > 127 {
+		return note, fmt.Errorf("%s transposed by %d is out of the MIDI range", MIDIToNoteName(note), semitones)
+	}
+	return uint8(moved), nil
+}
+
+// Interval returns the semitones from a up to b (negative if b is lower)
+func Interval(a, b uint8) int {
+	return int(b) - int(a)
+}
+
+// IsInScale reports whether the note's pitch class belongs to the scale,
+// in any octave
+func IsInScale(note uint8, scale Scale) bool {
+	degree := (int(note) - scale.Tonic + 12) % 12
+	for _, interval := range scale.Intervals {
+		if interval == degree {
+			return true
+		}
+	}
+	return false
+}
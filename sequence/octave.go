@@ -0,0 +1,52 @@
+package sequence
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Octave conventions: which octave number gear gives middle C (MIDI 60)
+const (
+	OctaveRoland = "roland" // C4 = 60 (scientific pitch notation, the default)
+	OctaveYamaha = "yamaha" // C3 = 60
+)
+
+// octaveConventions maps each convention to how many octaves its names are
+// below scientific pitch notation
+var octaveConventions = map[string]int32{OctaveRoland: 0, OctaveYamaha: 1}
+
+// octaveOffset is the current convention's offset, see SetOctaveConvention
+var octaveOffset atomic.Int32
+
+// SetOctaveConvention sets how note names are read and shown: "roland"
+// (C4 = 60) or "yamaha" (C3 = 60). Saved patterns and styles always use
+// scientific pitch notation, so they load the same under either.
+func SetOctaveConvention(name string) error {
+	offset, ok := octaveConventions[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown octave convention %q (use %s or %s)", name, OctaveRoland, OctaveYamaha)
+	}
+	octaveOffset.Store(offset)
+	return nil
+}
+
+// OctaveConvention returns the convention note names are read and shown in
+func OctaveConvention() string {
+	if octaveOffset.Load() == octaveConventions[OctaveYamaha] {
+		return OctaveYamaha
+	}
+	return OctaveRoland
+}
+
+// StandardNoteName names a MIDI note in scientific pitch notation (60 is
+// "C4") whatever the octave convention, for files and other programs
+func StandardNoteName(note uint8) string {
+	return noteName(note, 0)
+}
+
+// StandardNoteNameToMIDI reads a note name in scientific pitch notation
+// ("C4" is 60) whatever the octave convention
+func StandardNoteNameToMIDI(name string) (uint8, error) {
+	return noteNameToMIDI(name, 0)
+}
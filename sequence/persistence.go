@@ -4,14 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 )
 
-const (
-	PatternsDir = "patterns"
-)
+// PatternsDir is where patterns are saved; main points it into the configured data directory
+var PatternsDir = "patterns"
 
 // PatternStep represents a single step in the JSON format
 type PatternStep struct {
@@ -19,17 +17,27 @@ type PatternStep struct {
 	Note     string         `json:"note"`
 	Velocity uint8          `json:"velocity,omitempty"`
 	Gate     int            `json:"gate,omitempty"`
+	GateMs   int            `json:"gate_ms,omitempty"`  // absolute gate, replaces gate
+	Muted    bool           `json:"muted,omitempty"`    // silenced, see Pattern.SetMuted
+	Straight bool           `json:"straight,omitempty"` // not swung, see Pattern.SetStraight
 	Duration int            `json:"duration,omitempty"`
 	CC       map[string]int `json:"cc,omitempty"` // CC automation: "74" -> 127 (JSON keys are strings)
 }
 
 // PatternFile represents the JSON structure for saving/loading patterns
 type PatternFile struct {
-	Name      string        `json:"name"`
-	Tempo     int           `json:"tempo"`
-	Length    int           `json:"length"`
-	Steps     []PatternStep `json:"steps"`
-	CreatedAt string        `json:"created_at,omitempty"`
+	Name      string         `json:"name"`
+	Tempo     float64        `json:"tempo"` // BPM, whole numbers in files from before fractional tempos
+	Length    int            `json:"length"`
+	Volume    *int           `json:"volume,omitempty"`       // CC 7 sent at loop start
+	CC        map[string]int `json:"cc,omitempty"`           // pattern-level CC defaults sent at loop start
+	NoteOff   string         `json:"noteoff_mode,omitempty"` // "cut" stops notes at the loop boundary; default ring
+	Legato    bool           `json:"legato,omitempty"`       // retriggers skip the NoteOff
+	Tags      []string       `json:"tags,omitempty"`
+	TimeSig   string         `json:"time_signature,omitempty"` // e.g. "6/8"; default 4/4
+	StepNote  int            `json:"resolution,omitempty"`     // note value of a step, e.g. 8 for 8ths; default 16
+	Steps     []PatternStep  `json:"steps"`
+	CreatedAt string         `json:"created_at,omitempty"`
 }
 
 // ToPatternFile converts a Pattern to the JSON-serializable format
@@ -45,6 +53,27 @@ func (p *Pattern) ToPatternFile(name string) *PatternFile {
 		Steps:     make([]PatternStep, 0, patternLen),
 		CreatedAt: time.Now().Format(time.RFC3339),
 	}
+	if p.Volume >= 0 {
+		volume := p.Volume
+		pf.Volume = &volume
+	}
+	if p.NoteOff == NoteOffCut {
+		pf.NoteOff = string(p.NoteOff)
+	}
+	pf.Legato = p.Legato
+	pf.Tags = append([]string(nil), p.Tags...)
+	if beats, value := p.timeSignature(); beats != 4 || value != 4 {
+		pf.TimeSig = fmt.Sprintf("%d/%d", beats, value)
+	}
+	if p.resolution() != DefaultResolution {
+		pf.StepNote = p.resolution()
+	}
+	if len(p.savedCC) > 0 {
+		pf.CC = make(map[string]int)
+		for ccNum := range p.savedCC {
+			pf.CC[fmt.Sprintf("%d", ccNum)] = p.globalCC[ccNum]
+		}
+	}
 
 	// Only include non-rest steps
 	for i := 0; i < patternLen; i++ {
@@ -52,7 +81,7 @@ func (p *Pattern) ToPatternFile(name string) *PatternFile {
 			step := p.Steps[i]
 			ps := PatternStep{
 				Step: i + 1, // 1-indexed for user
-				Note: midiToNoteName(step.Note),
+				Note: StandardNoteName(step.Note),
 			}
 			// Only include velocity/gate/duration if non-default
 			if step.Velocity != 100 {
@@ -61,6 +90,9 @@ func (p *Pattern) ToPatternFile(name string) *PatternFile {
 			if step.Gate != 90 {
 				ps.Gate = step.Gate
 			}
+			ps.GateMs = step.GateMs
+			ps.Muted = step.Muted
+			ps.Straight = step.Straight
 			if step.Duration != 1 {
 				ps.Duration = step.Duration
 			}
@@ -91,6 +123,52 @@ func FromPatternFile(pf *PatternFile) (*Pattern, error) {
 
 	p := New(length)
 	p.BPM = pf.Tempo
+	if pf.Volume != nil {
+		if *pf.Volume < 0 || *pf.Volume > 127 {
+			return nil, fmt.Errorf("invalid volume %d (must be 0-127)", *pf.Volume)
+		}
+		p.Volume = *pf.Volume
+	}
+
+	if pf.NoteOff != "" {
+		if err := p.SetNoteOffMode(pf.NoteOff); err != nil {
+			return nil, err
+		}
+	}
+	p.Legato = pf.Legato
+	if err := p.SetTags(pf.Tags); err != nil {
+		return nil, err
+	}
+
+	if pf.TimeSig != "" || pf.StepNote != 0 {
+		beats, value, resolution := 4, 4, DefaultResolution
+		if pf.StepNote != 0 {
+			resolution = pf.StepNote
+		}
+		if pf.TimeSig != "" {
+			var err error
+			if beats, value, err = ParseTimeSignature(pf.TimeSig); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.SetMeter(beats, value, resolution); err != nil {
+			return nil, err
+		}
+	}
+
+	// Pattern-level CC defaults become saved global CCs
+	for ccNumStr, value := range pf.CC {
+		var ccNum int
+		if _, err := fmt.Sscanf(ccNumStr, "%d", &ccNum); err != nil {
+			fmt.Printf("warning: invalid CC number '%s' in pattern '%s', skipping\n", ccNumStr, pf.Name)
+			continue
+		}
+		if err := p.SetGlobalCC(ccNum, value); err != nil {
+			fmt.Printf("warning: %v in pattern '%s', skipping\n", err, pf.Name)
+			continue
+		}
+		p.SetGlobalCCSaved(ccNum, true)
+	}
 
 	// Set notes from file
 	for _, ps := range pf.Steps {
@@ -100,7 +178,7 @@ func FromPatternFile(pf *PatternFile) (*Pattern, error) {
 			continue
 		}
 
-		midiNote, err := NoteNameToMIDI(ps.Note)
+		midiNote, err := StandardNoteNameToMIDI(ps.Note)
 		if err != nil {
 			return nil, fmt.Errorf("invalid note in step %d: %w", ps.Step, err)
 		}
@@ -118,6 +196,9 @@ func FromPatternFile(pf *PatternFile) (*Pattern, error) {
 		if duration == 0 {
 			duration = 1
 		}
+		if ps.GateMs < 0 || ps.GateMs > MaxGateMs {
+			return nil, fmt.Errorf("invalid gate_ms in step %d: must be 1-%d", ps.Step, MaxGateMs)
+		}
 
 		// Convert CC map from JSON (string keys) to internal format (int keys)
 		var ccValues map[int]int
@@ -144,7 +225,10 @@ func FromPatternFile(pf *PatternFile) (*Pattern, error) {
 			IsRest:   false,
 			Velocity: velocity,
 			Gate:     gate,
+			GateMs:   ps.GateMs,
 			Duration: duration,
+			Muted:    ps.Muted,
+			Straight: ps.Straight,
 			CCValues: ccValues,
 		}
 	}
@@ -152,100 +236,99 @@ func FromPatternFile(pf *PatternFile) (*Pattern, error) {
 	return p, nil
 }
 
-// Save saves the pattern to a JSON file in the patterns directory
-func (p *Pattern) Save(name string) error {
-	// Ensure patterns directory exists
-	if err := os.MkdirAll(PatternsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create patterns directory: %w", err)
-	}
-
-	// Convert to JSON format
-	pf := p.ToPatternFile(name)
-
-	// Create file path
-	filename := sanitizeFilename(name) + ".json"
-	filepath := filepath.Join(PatternsDir, filename)
+// Path returns the file a pattern is saved in. Names may contain
+// collections separated by slashes, e.g. "basslines/funk1".
+func Path(name string) string {
+	return DirStore{Dir: PatternsDir}.Path(name)
+}
 
-	// Marshal to JSON with indentation
-	data, err := json.MarshalIndent(pf, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal pattern: %w", err)
+// sanitizeName sanitizes each collection and the pattern name in a
+// slash-separated name, dropping empty segments
+func sanitizeName(name string) string {
+	var segments []string
+	for _, segment := range strings.Split(name, "/") {
+		if strings.TrimSpace(segment) != "" {
+			segments = append(segments, sanitizeFilename(segment))
+		}
 	}
-
-	// Write to file
-	if err := os.WriteFile(filepath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write pattern file: %w", err)
+	if len(segments) == 0 {
+		return sanitizeFilename("")
 	}
+	return strings.Join(segments, "/")
+}
 
-	return nil
+// Save saves the pattern to a JSON file in the patterns directory
+// (creating the collection directory for names like "basslines/funk1")
+func (p *Pattern) Save(name string) error {
+	return DirStore{Dir: PatternsDir}.Save(name, p)
 }
 
 // Load loads a pattern from a JSON file in the patterns directory
 func Load(name string) (*Pattern, error) {
-	// Create file path
-	filename := sanitizeFilename(name) + ".json"
-	filepath := filepath.Join(PatternsDir, filename)
-
-	// Read file
-	data, err := os.ReadFile(filepath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("pattern '%s' not found", name)
-		}
-		return nil, fmt.Errorf("failed to read pattern file: %w", err)
-	}
-
-	// Unmarshal JSON
-	var pf PatternFile
-	if err := json.Unmarshal(data, &pf); err != nil {
-		return nil, fmt.Errorf("failed to parse pattern file: %w", err)
-	}
-
-	// Convert to Pattern
-	return FromPatternFile(&pf)
+	return DirStore{Dir: PatternsDir}.Load(name)
 }
 
-// List returns a list of all saved pattern names
+// List returns the names of all saved patterns, including those in
+// collections (e.g. "basslines/funk1")
 func List() ([]string, error) {
-	// Check if patterns directory exists
-	if _, err := os.Stat(PatternsDir); os.IsNotExist(err) {
-		return []string{}, nil
-	}
+	return DirStore{Dir: PatternsDir}.List()
+}
 
-	// Read directory
-	entries, err := os.ReadDir(PatternsDir)
+// PatternInfo summarizes a saved pattern for listings
+type PatternInfo struct {
+	Name   string
+	Tempo  float64
+	Length int
+	Notes  int
+	Saved  time.Time // created_at from the file, or the file's modification time
+	Tags   []string
+	Err    error // set if the file could not be read
+}
+
+// ListInfo returns a summary of every saved pattern, read from the files
+func ListInfo() ([]PatternInfo, error) {
+	names, err := List()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read patterns directory: %w", err)
+		return nil, err
 	}
 
-	// Collect .json files
-	var patterns []string
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
-			// Remove .json extension
-			name := strings.TrimSuffix(entry.Name(), ".json")
-			patterns = append(patterns, name)
+	infos := make([]PatternInfo, 0, len(names))
+	for _, name := range names {
+		info := PatternInfo{Name: name}
+		path := Path(name)
+		if stat, err := os.Stat(path); err == nil {
+			info.Saved = stat.ModTime()
 		}
-	}
-
-	return patterns, nil
-}
 
-// Delete deletes a saved pattern
-func Delete(name string) error {
-	// Create file path
-	filename := sanitizeFilename(name) + ".json"
-	filepath := filepath.Join(PatternsDir, filename)
+		var pf PatternFile
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &pf)
+		}
+		if err != nil {
+			info.Err = err
+			infos = append(infos, info)
+			continue
+		}
 
-	// Delete file
-	if err := os.Remove(filepath); err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("pattern '%s' not found", name)
+		info.Tempo = pf.Tempo
+		info.Length = pf.Length
+		if info.Length <= 0 {
+			info.Length = DefaultPatternLength
+		}
+		info.Notes = len(pf.Steps)
+		info.Tags = pf.Tags
+		if created, err := time.Parse(time.RFC3339, pf.CreatedAt); err == nil {
+			info.Saved = created
 		}
-		return fmt.Errorf("failed to delete pattern: %w", err)
+		infos = append(infos, info)
 	}
+	return infos, nil
+}
 
-	return nil
+// Delete deletes a saved pattern
+func Delete(name string) error {
+	return DirStore{Dir: PatternsDir}.Delete(name)
 }
 
 // sanitizeFilename removes potentially problematic characters from filenames
@@ -0,0 +1,42 @@
+package sequence
+
+// ResizeMode says what happens to the steps a shorter pattern has no room for
+type ResizeMode int
+
+const (
+	// ResizeTruncate keeps the first steps and drops the rest
+	ResizeTruncate ResizeMode = iota
+	// ResizeKeepTail keeps the last steps and drops those at the start
+	ResizeKeepTail
+	// ResizeFold moves each dropped note onto the step it lands on when the
+	// pattern wraps around, if that step is a rest
+	ResizeFold
+)
+
+// ResizeSteps returns steps resized to length, and the numbers (1-based, in
+// steps) of the notes that did not fit. Longer patterns get rests at the
+// end whatever the mode. length must be positive.
+func ResizeSteps(steps []Step, length int, mode ResizeMode) ([]Step, []int) {
+	resized := make([]Step, length)
+	for i := range resized {
+		resized[i] = Step{IsRest: true, Velocity: 100, Gate: 90, Duration: 1}
+	}
+
+	offset := 0
+	if mode == ResizeKeepTail && len(steps) > length {
+		offset = len(steps) - length
+	}
+	var lost []int
+	for i, step := range steps {
+		switch {
+		case i >= offset && i-offset < length:
+			resized[i-offset] = step.clone()
+		case step.IsRest:
+		case mode == ResizeFold && resized[i%length].IsRest:
+			resized[i%length] = step.clone()
+		default:
+			lost = append(lost, i+1)
+		}
+	}
+	return resized, lost
+}
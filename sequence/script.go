@@ -0,0 +1,87 @@
+package sequence
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteScript writes the pattern as Interplay commands that rebuild it from
+// scratch when run with --script: settings first, then one 'set' per note and
+// one 'cc-step' per automated value. Most defaults are omitted, so the script is
+// short and diffs cleanly. Transient global CCs are written without --save.
+func (p *Pattern) WriteScript(w io.Writer, name string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	if name != "" {
+		fmt.Fprintf(bw, "# Interplay pattern '%s'\n", name)
+	} else {
+		fmt.Fprintln(bw, "# Interplay pattern")
+	}
+	fmt.Fprintln(bw, "reset")
+	fmt.Fprintf(bw, "length %d\n", len(p.Steps))
+	fmt.Fprintln(bw, "clear")
+	fmt.Fprintf(bw, "tempo %s\n", FormatBPM(p.BPM))
+	if p.SwingPercent > 0 && p.SwingUnit == 2 {
+		fmt.Fprintf(bw, "swing %d 8th\n", p.SwingPercent)
+	} else if p.SwingPercent > 0 {
+		fmt.Fprintf(bw, "swing %d\n", p.SwingPercent)
+	}
+	// Always written: 'reset' restores non-zero default humanization
+	fmt.Fprintf(bw, "humanize velocity %d\n", p.Humanization.VelocityRange)
+	fmt.Fprintf(bw, "humanize timing %d\n", p.Humanization.TimingMs)
+	fmt.Fprintf(bw, "humanize gate %d\n", p.Humanization.GateRange)
+	if p.Volume >= 0 {
+		fmt.Fprintf(bw, "volume %d\n", p.Volume)
+	}
+	if beats, value := p.timeSignature(); beats != 4 || value != 4 || p.resolution() != DefaultResolution {
+		fmt.Fprintf(bw, "meter %d/%d %s\n", beats, value, ordinal(p.resolution()))
+	}
+	if p.NoteOff == NoteOffCut {
+		fmt.Fprintln(bw, "noteoff-mode cut")
+	}
+	if p.Legato {
+		fmt.Fprintln(bw, "noteoff-mode retrigger off")
+	}
+	if len(p.Tags) > 0 {
+		fmt.Fprintf(bw, "tag %s\n", strings.Join(p.Tags, " "))
+	}
+	for _, ccNum := range sortedKeys(p.globalCC) {
+		if p.savedCC[ccNum] {
+			fmt.Fprintf(bw, "cc %d %d --save\n", ccNum, p.globalCC[ccNum])
+		} else {
+			fmt.Fprintf(bw, "cc %d %d\n", ccNum, p.globalCC[ccNum])
+		}
+	}
+
+	for i, step := range p.Steps {
+		if !step.IsRest {
+			line := fmt.Sprintf("set %d %s", i+1, MIDIToNoteName(step.Note))
+			if step.Velocity != 100 {
+				line += fmt.Sprintf(" vel:%d", step.Velocity)
+			}
+			if step.GateMs > 0 {
+				line += fmt.Sprintf(" gate:%dms", step.GateMs)
+			} else if step.Gate != 90 {
+				line += fmt.Sprintf(" gate:%d", step.Gate)
+			}
+			if step.Duration != 1 {
+				line += fmt.Sprintf(" dur:%d", step.Duration)
+			}
+			fmt.Fprintln(bw, line)
+			if step.Muted {
+				fmt.Fprintf(bw, "mute-step %d\n", i+1)
+			}
+			if step.Straight {
+				fmt.Fprintf(bw, "swing exclude %d\n", i+1)
+			}
+		}
+		for _, ccNum := range sortedKeys(step.CCValues) {
+			fmt.Fprintf(bw, "cc-step %d %d %d\n", i+1, ccNum, step.CCValues[ccNum])
+		}
+	}
+	return bw.Flush()
+}
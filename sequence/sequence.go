@@ -1,7 +1,16 @@
+// Package sequence holds a step-sequencer pattern and everything done to
+// it: notes, velocity, gate, duration, swing, humanization and CC
+// automation on each step, note name parsing and note math, analysis, and
+// saving patterns as JSON through a Store.
+//
+// A Pattern is safe for concurrent use: edit it while a playback.Engine
+// plays it, and the changes are heard from the next loop.
 package sequence
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -11,13 +20,31 @@ import (
 // while still representing a manageable loop length.
 const DefaultPatternLength = 48
 
+// Standard CC numbers for mix parameters
+const (
+	CCVolume     = 7
+	CCPan        = 10
+	CCExpression = 11
+)
+
+// NoteOffMode controls notes still sounding at the loop boundary
+type NoteOffMode string
+
+const (
+	NoteOffCut  NoteOffMode = "cut"  // notes are cut at the loop boundary
+	NoteOffRing NoteOffMode = "ring" // notes ring into the next loop for their full gate (default)
+)
+
 // Step represents a single step in the sequence
 type Step struct {
 	Note     uint8       // MIDI note number (0-127), 0 means rest
 	IsRest   bool        // true if this step is a rest/silence
 	Velocity uint8       // MIDI velocity (0-127), default 100
 	Gate     int         // Gate length as percentage (1-100), default 90
+	GateMs   int         // Gate length in milliseconds (1-10000), 0 = use Gate
 	Duration int         // Note duration in steps (1-16), default 1
+	Muted    bool        // silenced, but keeps its note and CCs (see SetMuted)
+	Straight bool        // played on the grid even when the pattern swings
 	CCValues map[int]int // CC automation: CC# → Value (0-127), nil if no automation
 }
 
@@ -30,14 +57,35 @@ type Humanization struct {
 
 // Pattern represents a musical sequence pattern
 type Pattern struct {
-	Steps        []Step       // A slice of steps, allowing variable length
-	BPM          int
+	Steps        []Step       // A slice of steps, allowing variable length; change with SetSteps
+	BPM          float64      // tempo, may be fractional (e.g. 122.5)
 	SwingPercent int          // Swing/groove timing (0-75%), 0 = off, 50 = triplet swing
+	SwingUnit    int          // steps per swung note: 1 = 16ths (also 0), 2 = 8ths
 	Humanization Humanization // humanization settings
-	globalCC     map[int]int  // Global CC values (transient, not saved): CC# → Value
+	Volume       int          // Pattern volume sent as CC 7 at loop start (0-127), -1 = not set
+	NoteOff      NoteOffMode  // loop boundary behavior, "" = ring
+	Legato       bool         // retriggering a sounding note skips its NoteOff
+	Tags         []string     // labels for organizing saved patterns, e.g. "techno"
+	Beats        int          // time signature beats per bar, 0 = 4 (see SetMeter)
+	BeatValue    int          // time signature note value of a beat, 0 = 4
+	Resolution   int          // note value of a step, 0 = 16ths
+	globalCC     map[int]int  // Global CC values (transient unless in savedCC): CC# → Value
+	savedCC      map[int]bool // Global CCs saved with the pattern as pattern-level defaults
+	version      uint64       // counts changes made through methods, see Version
 	mu           sync.RWMutex // protects concurrent access
 }
 
+// Version returns a number that changes whenever a method changes the
+// pattern, so a copy can be skipped while it stays the same. Failed changes
+// leave it alone. Only a pattern no one else holds yet (just made, cloned
+// or loaded) may have its fields written directly; after that, change the
+// steps with SetSteps and the rest with their setters, or Version misses it.
+func (p *Pattern) Version() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.version
+}
+
 // New creates a new pattern with a default length and starting sequence.
 func New(length int) *Pattern {
 	if length <= 0 {
@@ -45,7 +93,8 @@ func New(length int) *Pattern {
 	}
 
 	p := &Pattern{
-		BPM: 80, // default tempo
+		BPM:    80, // default tempo
+		Volume: -1,
 		// Default humanization for more organic, alive-sounding patterns
 		Humanization: Humanization{
 			VelocityRange: 8,  // Subtle velocity variation
@@ -104,6 +153,7 @@ func (p *Pattern) SetNoteWithDuration(stepNum int, note uint8, duration int) err
 	existingStep := p.Steps[stepNum-1]
 	velocity := existingStep.Velocity
 	gate := existingStep.Gate
+	gateMs := existingStep.GateMs
 	if velocity == 0 {
 		velocity = 100
 	}
@@ -116,8 +166,11 @@ func (p *Pattern) SetNoteWithDuration(stepNum int, note uint8, duration int) err
 		IsRest:   false,
 		Velocity: velocity,
 		Gate:     gate,
+		GateMs:   gateMs,
 		Duration: duration,
+		Straight: existingStep.Straight,
 	}
+	p.version++
 	return nil
 }
 
@@ -139,6 +192,7 @@ func (p *Pattern) SetRest(stepNum int) error {
 	}
 
 	p.Steps[stepNum-1] = Step{IsRest: true, Velocity: 100, Gate: 90, Duration: 1}
+	p.version++
 	return nil
 }
 
@@ -156,10 +210,12 @@ func (p *Pattern) SetVelocity(stepNum int, velocity uint8) error {
 	}
 
 	p.Steps[stepNum-1].Velocity = velocity
+	p.version++
 	return nil
 }
 
-// SetGate sets the gate length (as percentage) for a specific step
+// SetGate sets the gate length (as percentage) for a specific step,
+// replacing a gate in milliseconds
 func (p *Pattern) SetGate(stepNum int, gate int) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -173,6 +229,51 @@ func (p *Pattern) SetGate(stepNum int, gate int) error {
 	}
 
 	p.Steps[stepNum-1].Gate = gate
+	p.Steps[stepNum-1].GateMs = 0
+	p.version++
+	return nil
+}
+
+// SetMuted silences a step without changing it, or lets it play again.
+// Unlike SetRest, the note, velocity, gate and CCs are kept; setting a
+// new note or a rest unmutes the step.
+func (p *Pattern) SetMuted(stepNum int, muted bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	numSteps := len(p.Steps)
+	if stepNum < 1 || stepNum > numSteps {
+		return fmt.Errorf("step must be 1-%d", numSteps)
+	}
+	if muted && p.Steps[stepNum-1].IsRest {
+		return fmt.Errorf("step %d is a rest, nothing to mute", stepNum)
+	}
+
+	p.Steps[stepNum-1].Muted = muted
+	p.version++
+	return nil
+}
+
+// MaxGateMs is the longest gate in milliseconds
+const MaxGateMs = 10_000
+
+// SetGateMs sets an absolute gate length in milliseconds for a specific
+// step: the note ends that long after it starts, whatever the tempo and
+// duration. SetGate returns the step to a percentage gate.
+func (p *Pattern) SetGateMs(stepNum int, ms int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	numSteps := len(p.Steps)
+	if stepNum < 1 || stepNum > numSteps {
+		return fmt.Errorf("step must be 1-%d", numSteps)
+	}
+	if ms < 1 || ms > MaxGateMs {
+		return fmt.Errorf("gate must be 1-%dms", MaxGateMs)
+	}
+
+	p.Steps[stepNum-1].GateMs = ms
+	p.version++
 	return nil
 }
 
@@ -184,18 +285,21 @@ func (p *Pattern) Clear() {
 	for i := range p.Steps {
 		p.Steps[i] = Step{IsRest: true, Velocity: 100, Gate: 90, Duration: 1}
 	}
+	p.version++
 }
 
-// SetTempo changes the BPM
-func (p *Pattern) SetTempo(bpm int) error {
-	if bpm < 20 || bpm > 300 {
+// SetTempo changes the BPM, rounded to hundredths
+func (p *Pattern) SetTempo(bpm float64) error {
+	if !(bpm >= 20 && bpm <= 300) { // also rejects NaN
 		return fmt.Errorf("BPM must be 20-300")
 	}
+	bpm = math.Round(bpm*100) / 100
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	p.BPM = bpm
+	p.version++
 	return nil
 }
 
@@ -209,16 +313,21 @@ func (p *Pattern) GetStep(stepNum int) (Step, error) {
 		return Step{}, fmt.Errorf("step must be 1-%d", numSteps)
 	}
 
-	return p.Steps[stepNum-1], nil
+	return p.Steps[stepNum-1].clone(), nil
 }
 
 // GetBPM returns the current BPM (thread-safe read)
-func (p *Pattern) GetBPM() int {
+func (p *Pattern) GetBPM() float64 {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	return p.BPM
 }
 
+// FormatBPM writes a tempo without trailing zeros, e.g. "120" or "122.5"
+func FormatBPM(bpm float64) string {
+	return strconv.FormatFloat(bpm, 'f', -1, 64)
+}
+
 // Length returns the number of steps in the pattern (thread-safe).
 func (p *Pattern) Length() int {
 	p.mu.RLock()
@@ -234,20 +343,21 @@ func (p *Pattern) Clone() *Pattern {
 	clone := &Pattern{
 		BPM:          p.BPM,
 		SwingPercent: p.SwingPercent,
+		SwingUnit:    p.SwingUnit,
 		Humanization: p.Humanization, // Copy humanization settings
+		Volume:       p.Volume,
+		NoteOff:      p.NoteOff,
+		Legato:       p.Legato,
+		Tags:         append([]string(nil), p.Tags...),
+		Beats:        p.Beats,
+		BeatValue:    p.BeatValue,
+		Resolution:   p.Resolution,
 		Steps:        make([]Step, len(p.Steps)),
 	}
 
 	// Deep copy steps (including CC values maps)
 	for i, step := range p.Steps {
-		clone.Steps[i] = step
-		// Deep copy CCValues map if present
-		if step.CCValues != nil {
-			clone.Steps[i].CCValues = make(map[int]int)
-			for ccNum, value := range step.CCValues {
-				clone.Steps[i].CCValues[ccNum] = value
-			}
-		}
+		clone.Steps[i] = step.clone()
 	}
 
 	// Deep copy globalCC map if present
@@ -257,6 +367,12 @@ func (p *Pattern) Clone() *Pattern {
 			clone.globalCC[ccNum] = value
 		}
 	}
+	if p.savedCC != nil {
+		clone.savedCC = make(map[int]bool)
+		for ccNum := range p.savedCC {
+			clone.savedCC[ccNum] = true
+		}
+	}
 
 	return clone
 }
@@ -271,18 +387,20 @@ func (p *Pattern) CopyFrom(other *Pattern) {
 
 	p.BPM = other.BPM
 	p.SwingPercent = other.SwingPercent
+	p.SwingUnit = other.SwingUnit
 	p.Humanization = other.Humanization
+	p.Volume = other.Volume
+	p.NoteOff = other.NoteOff
+	p.Legato = other.Legato
+	p.Tags = append([]string(nil), other.Tags...)
+	p.Beats = other.Beats
+	p.BeatValue = other.BeatValue
+	p.Resolution = other.Resolution
 
 	// Deep copy steps (including CC values)
 	p.Steps = make([]Step, len(other.Steps))
 	for i, step := range other.Steps {
-		p.Steps[i] = step
-		if step.CCValues != nil {
-			p.Steps[i].CCValues = make(map[int]int)
-			for ccNum, value := range step.CCValues {
-				p.Steps[i].CCValues[ccNum] = value
-			}
-		}
+		p.Steps[i] = step.clone()
 	}
 
 	// Deep copy globalCC
@@ -294,6 +412,14 @@ func (p *Pattern) CopyFrom(other *Pattern) {
 	} else {
 		p.globalCC = nil
 	}
+	p.savedCC = nil
+	if other.savedCC != nil {
+		p.savedCC = make(map[int]bool)
+		for ccNum := range other.savedCC {
+			p.savedCC[ccNum] = true
+		}
+	}
+	p.version++
 }
 
 // Resize changes the number of steps in the pattern.
@@ -325,30 +451,50 @@ func (p *Pattern) Resize(newLength int) error {
 	}
 
 	p.Steps = newSteps
+	p.version++
 	return nil
 }
 
 // String returns a human-readable representation of the pattern
 func (p *Pattern) String() string {
+	return p.StringWith(nil)
+}
+
+// StringWith returns the same representation as String, passing each step
+// line through decorate (e.g., to add terminal colors). A nil decorate
+// leaves lines unchanged.
+func (p *Pattern) StringWith(decorate func(step Step, line string) string) string {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
+	if decorate == nil {
+		decorate = func(_ Step, line string) string { return line }
+	}
+
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("Tempo: %d BPM, Length: %d steps\n", p.BPM, len(p.Steps)))
+	sb.WriteString(fmt.Sprintf("Tempo: %s BPM, Length: %d steps", FormatBPM(p.BPM), len(p.Steps)))
+	if p.Volume >= 0 {
+		sb.WriteString(fmt.Sprintf(", Volume: %d", p.Volume))
+	}
+	sb.WriteString("\n")
 	sb.WriteString("Steps:\n")
 
 	for i, step := range p.Steps {
 		stepNum := i + 1
 		if step.IsRest {
-			sb.WriteString(fmt.Sprintf("  %2d: rest\n", stepNum))
+			sb.WriteString(decorate(step, fmt.Sprintf("  %2d: rest", stepNum)) + "\n")
 		} else {
-			noteName := midiToNoteName(step.Note)
+			noteName := MIDIToNoteName(step.Note)
 			// Build base info string
 			var info string
+			gate := fmt.Sprintf("%d%%", step.Gate)
+			if step.GateMs > 0 {
+				gate = fmt.Sprintf("%dms", step.GateMs)
+			}
 			if step.Duration > 1 {
-				info = fmt.Sprintf("  %2d: %s (vel:%d gate:%d%% dur:%d)", stepNum, noteName, step.Velocity, step.Gate, step.Duration)
+				info = fmt.Sprintf("  %2d: %s (vel:%d gate:%s dur:%d)", stepNum, noteName, step.Velocity, gate, step.Duration)
 			} else {
-				info = fmt.Sprintf("  %2d: %s (vel:%d gate:%d%%)", stepNum, noteName, step.Velocity, step.Gate)
+				info = fmt.Sprintf("  %2d: %s (vel:%d gate:%s)", stepNum, noteName, step.Velocity, gate)
 			}
 
 			// Add CC automation indicators if present
@@ -364,66 +510,77 @@ func (p *Pattern) String() string {
 				}
 				info += "]"
 			}
+			if step.Muted {
+				info += " muted"
+			}
+			if step.Straight {
+				info += " straight"
+			}
 
-			sb.WriteString(info + "\n")
+			sb.WriteString(decorate(step, info) + "\n")
 		}
 	}
 
 	return sb.String()
 }
 
-// midiToNoteName converts MIDI note number to name (e.g., 60 -> "C4")
-func midiToNoteName(note uint8) string {
+// MIDIToNoteName converts MIDI note number to name (e.g., 60 -> "C4"),
+// in the octave convention set (60 is "C3" for yamaha)
+func MIDIToNoteName(note uint8) string {
+	return noteName(note, int(octaveOffset.Load()))
+}
+
+// noteName names a MIDI note with octave numbers offset octaves lower
+func noteName(note uint8, offset int) string {
 	noteNames := []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
-	octave := int(note/12) - 1
-	noteName := noteNames[note%12]
-	return fmt.Sprintf("%s%d", noteName, octave)
+	octave := int(note/12) - 1 - offset
+	return fmt.Sprintf("%s%d", noteNames[note%12], octave)
 }
 
-// NoteNameToMIDI converts note name to MIDI number (e.g., "C4" -> 60)
+// NoteNameToMIDI converts note name to MIDI number (e.g., "C4" -> 60).
+// Accidentals may be doubled ("F##3", "Bbb2", or "x" for a double sharp)
+// and octaves go down to -1 ("C-1" -> 0), where some synths put drums.
+// Octaves follow the convention set: "C3" is 60 for yamaha, and "C-2" 0.
 func NoteNameToMIDI(name string) (uint8, error) {
-	noteMap := map[string]int{
-		"C": 0, "C#": 1, "Db": 1,
-		"D": 2, "D#": 3, "Eb": 3,
-		"E": 4,
-		"F": 5, "F#": 6, "Gb": 6,
-		"G": 7, "G#": 8, "Ab": 8,
-		"A": 9, "A#": 10, "Bb": 10,
-		"B": 11,
-	}
+	return noteNameToMIDI(name, int(octaveOffset.Load()))
+}
+
+// noteNameToMIDI reads a note name with octave numbers offset octaves lower
+func noteNameToMIDI(name string, offset int) (uint8, error) {
+	noteMap := map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
 
 	if len(name) < 2 {
 		return 0, fmt.Errorf("invalid note name: %s", name)
 	}
-
-	// Extract note and octave
-	var notePart string
-	var octave int
-
-	if len(name) == 2 {
-		// e.g., "C4"
-		notePart = name[0:1]
-		_, err := fmt.Sscanf(name[1:2], "%d", &octave)
-		if err != nil {
-			return 0, fmt.Errorf("invalid note name: %s", name)
-		}
-	} else if len(name) == 3 {
-		// e.g., "C#4" or "Bb4"
-		notePart = name[0:2]
-		_, err := fmt.Sscanf(name[2:3], "%d", &octave)
-		if err != nil {
-			return 0, fmt.Errorf("invalid note name: %s", name)
-		}
-	} else {
+	noteValue, ok := noteMap[name[0]]
+	if !ok {
 		return 0, fmt.Errorf("invalid note name: %s", name)
 	}
 
-	noteValue, ok := noteMap[notePart]
-	if !ok {
+	// Accidentals: up to two sharps or two flats
+	rest := name[1:]
+	switch {
+	case strings.HasPrefix(rest, "##") || strings.HasPrefix(rest, "x"):
+		noteValue += 2
+		rest = strings.TrimPrefix(strings.TrimPrefix(rest, "x"), "##")
+	case strings.HasPrefix(rest, "#"):
+		noteValue++
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "bb"):
+		noteValue -= 2
+		rest = rest[2:]
+	case strings.HasPrefix(rest, "b"):
+		noteValue--
+		rest = rest[1:]
+	}
+
+	// Octave: -1 to 9, e.g. "C-1" is MIDI 0
+	octave, err := strconv.Atoi(rest)
+	if err != nil || rest == "" || rest[0] == '+' || len(strings.TrimPrefix(rest, "-")) > 1 {
 		return 0, fmt.Errorf("invalid note name: %s", name)
 	}
 
-	midiNote := (octave+1)*12 + noteValue
+	midiNote := (octave+1+offset)*12 + noteValue
 	if midiNote < 0 || midiNote > 127 {
 		return 0, fmt.Errorf("note out of range: %s", name)
 	}
@@ -440,6 +597,7 @@ func (p *Pattern) SetHumanizeVelocity(amount int) error {
 		return fmt.Errorf("velocity humanization must be 0-64")
 	}
 	p.Humanization.VelocityRange = amount
+	p.version++
 	return nil
 }
 
@@ -452,6 +610,7 @@ func (p *Pattern) SetHumanizeTiming(ms int) error {
 		return fmt.Errorf("timing humanization must be 0-50ms")
 	}
 	p.Humanization.TimingMs = ms
+	p.version++
 	return nil
 }
 
@@ -464,6 +623,7 @@ func (p *Pattern) SetHumanizeGate(amount int) error {
 		return fmt.Errorf("gate humanization must be 0-50")
 	}
 	p.Humanization.GateRange = amount
+	p.version++
 	return nil
 }
 
@@ -484,6 +644,7 @@ func (p *Pattern) SetSwing(percent int) error {
 		return fmt.Errorf("swing must be 0-75%%")
 	}
 	p.SwingPercent = percent
+	p.version++
 	return nil
 }
 
@@ -494,8 +655,161 @@ func (p *Pattern) GetSwing() int {
 	return p.SwingPercent
 }
 
-// SetGlobalCC sets a global CC value (transient, not saved with pattern)
-// Global CC values are sent at the start of each loop iteration
+// SetSwingUnit sets what swing delays: the second of each pair of 16th
+// notes (1 step) or of 8th notes (2 steps)
+func (p *Pattern) SetSwingUnit(steps int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if steps != 1 && steps != 2 {
+		return fmt.Errorf("swing applies to 16ths (1 step) or 8ths (2 steps)")
+	}
+	p.SwingUnit = steps
+	p.version++
+	return nil
+}
+
+// GetSwingUnit returns the steps per swung note: 1 for 16ths, 2 for 8ths
+func (p *Pattern) GetSwingUnit() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return max(p.SwingUnit, 1)
+}
+
+// SetStraight keeps a step on the grid when the pattern swings, or lets it
+// swing again
+func (p *Pattern) SetStraight(stepNum int, straight bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	numSteps := len(p.Steps)
+	if stepNum < 1 || stepNum > numSteps {
+		return fmt.Errorf("step must be 1-%d", numSteps)
+	}
+	p.Steps[stepNum-1].Straight = straight
+	p.version++
+	return nil
+}
+
+// SwingDelay returns how late the step at index i (0-based) plays, in
+// percent of a step: swing delays the second 16th (or 8th) of each pair by
+// the swing percentage of its length, unless the step is straight
+func (p *Pattern) SwingDelay(i int) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.swingDelay(i)
+}
+
+// swingDelay is SwingDelay for callers holding the lock
+func (p *Pattern) swingDelay(i int) int {
+	unit := max(p.SwingUnit, 1)
+	if p.SwingPercent == 0 || i%(2*unit) != unit || p.Steps[i].Straight {
+		return 0
+	}
+	return unit * p.SwingPercent
+}
+
+// SetVolume sets the pattern volume (0-127), saved with the pattern and
+// sent as CC 7 at the start of each loop. -1 removes it.
+func (p *Pattern) SetVolume(volume int) error {
+	if volume < -1 || volume > 127 {
+		return fmt.Errorf("volume must be 0-127")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Volume = volume
+	p.version++
+	return nil
+}
+
+// GetVolume returns the pattern volume
+// Returns (volume, true) if set, (0, false) if not set
+func (p *Pattern) GetVolume() (int, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.Volume < 0 {
+		return 0, false
+	}
+	return p.Volume, true
+}
+
+// SetNoteOffMode sets whether notes are cut at the loop boundary or ring
+// into the next loop ("cut" or "ring")
+func (p *Pattern) SetNoteOffMode(mode string) error {
+	m := NoteOffMode(strings.ToLower(mode))
+	if m != NoteOffCut && m != NoteOffRing {
+		return fmt.Errorf("note-off mode must be cut or ring, got %q", mode)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.NoteOff = m
+	p.version++
+	return nil
+}
+
+// GetNoteOffMode returns the loop boundary behavior
+func (p *Pattern) GetNoteOffMode() NoteOffMode {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.NoteOff == "" {
+		return NoteOffRing
+	}
+	return p.NoteOff
+}
+
+// SetLegato sets whether retriggering a sounding note skips its NoteOff
+func (p *Pattern) SetLegato(legato bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Legato = legato
+	p.version++
+}
+
+// GetLegato reports whether retriggers skip the NoteOff
+func (p *Pattern) GetLegato() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.Legato
+}
+
+// SetTags replaces the pattern's tags (lowercased, without duplicates)
+func (p *Pattern) SetTags(tags []string) error {
+	var clean []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || strings.ContainsAny(tag, " ,") {
+			return fmt.Errorf("invalid tag %q (tags are single words)", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			clean = append(clean, tag)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Tags = clean
+	p.version++
+	return nil
+}
+
+// GetTags returns a copy of the pattern's tags
+func (p *Pattern) GetTags() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]string(nil), p.Tags...)
+}
+
+// SetGlobalCC sets a global CC value (transient unless marked with
+// SetGlobalCCSaved). Global CC values are sent at the start of each loop iteration
 func (p *Pattern) SetGlobalCC(ccNumber, value int) error {
 	if err := ValidateCC(ccNumber, value); err != nil {
 		return err
@@ -508,9 +822,39 @@ func (p *Pattern) SetGlobalCC(ccNumber, value int) error {
 		p.globalCC = make(map[int]int)
 	}
 	p.globalCC[ccNumber] = value
+	p.version++
 	return nil
 }
 
+// SetGlobalCCSaved marks a global CC as saved with the pattern (a
+// pattern-level default) or as transient again
+func (p *Pattern) SetGlobalCCSaved(ccNumber int, saved bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.globalCC[ccNumber]; !ok {
+		return fmt.Errorf("no global value set for CC#%d", ccNumber)
+	}
+	if !saved {
+		delete(p.savedCC, ccNumber)
+		p.version++
+		return nil
+	}
+	if p.savedCC == nil {
+		p.savedCC = make(map[int]bool)
+	}
+	p.savedCC[ccNumber] = true
+	p.version++
+	return nil
+}
+
+// IsGlobalCCSaved reports whether a global CC is saved with the pattern
+func (p *Pattern) IsGlobalCCSaved(ccNumber int) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.savedCC[ccNumber]
+}
+
 // GetGlobalCC returns the global CC value for a specific CC number
 // Returns (value, true) if set, (0, false) if not set
 func (p *Pattern) GetGlobalCC(ccNumber int) (int, bool) {
@@ -560,6 +904,7 @@ func (p *Pattern) SetStepCC(stepNum, ccNumber, value int) error {
 		step.CCValues = make(map[int]int)
 	}
 	step.CCValues[ccNumber] = value
+	p.version++
 	return nil
 }
 
@@ -611,6 +956,7 @@ func (p *Pattern) ClearStepCC(stepNum, ccNumber int) error {
 		}
 	}
 
+	p.version++
 	return nil
 }
 
@@ -639,5 +985,6 @@ func (p *Pattern) ApplyGlobalCC(ccNumber int) error {
 		}
 	}
 
+	p.version++
 	return nil
 }
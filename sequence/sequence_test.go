@@ -1,8 +1,16 @@
 package sequence
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -33,6 +41,18 @@ func TestNoteNameToMIDI(t *testing.T) {
 
 		// Edge cases
 		{"C8", "C8", 108, false},
+		{"G9", "G9", 127, false},
+
+		// Negative octaves, where some synths put drums
+		{"C-1", "C-1", 0, false},
+		{"G#-1", "G#-1", 8, false},
+
+		// Uncommon accidentals
+		{"Cb4", "Cb4", 59, false},
+		{"B#3", "B#3", 60, false},
+		{"F##3", "F##3", 55, false},
+		{"Fx3", "Fx3", 55, false},
+		{"Bbb2", "Bbb2", 45, false},
 
 		// Invalid inputs
 		{"Empty", "", 0, true},
@@ -40,6 +60,12 @@ func TestNoteNameToMIDI(t *testing.T) {
 		{"InvalidNote", "X4", 0, true},
 		{"InvalidOctave", "C99", 0, true},
 		{"TooLong", "C#4extra", 0, true},
+		{"TripleSharp", "C###4", 0, true},
+		{"BelowRange", "Cb-1", 0, true},
+		{"AboveRange", "G#9", 0, true},
+		{"OctaveTooLow", "C-2", 0, true},
+		{"PlusOctave", "C+4", 0, true},
+		{"NoOctave", "C#", 0, true},
 	}
 
 	for _, tt := range tests {
@@ -71,16 +97,205 @@ func TestMidiToNoteName(t *testing.T) {
 		{"C#4", 61, "C#4"},
 		{"D#3", 51, "D#3"},
 		{"Highest C", 108, "C8"},
+		{"Lowest note", 0, "C-1"},
+		{"Highest note", 127, "G9"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := midiToNoteName(tt.note)
+			got := MIDIToNoteName(tt.note)
 			if got != tt.want {
-				t.Errorf("midiToNoteName(%d) = %v, want %v", tt.note, got, tt.want)
+				t.Errorf("MIDIToNoteName(%d) = %v, want %v", tt.note, got, tt.want)
 			}
 		})
 	}
+
+	for note := 0; note <= 127; note++ {
+		if got, err := NoteNameToMIDI(MIDIToNoteName(uint8(note))); err != nil || got != uint8(note) {
+			t.Errorf("round trip of %d via %s = %d, %v", note, MIDIToNoteName(uint8(note)), got, err)
+		}
+	}
+}
+
+// TestOctaveConvention tests reading and showing notes with middle C as C3
+func TestOctaveConvention(t *testing.T) {
+	defer SetOctaveConvention(OctaveRoland)
+	if err := SetOctaveConvention("korg"); err == nil {
+		t.Error("SetOctaveConvention(korg) should fail")
+	}
+	if err := SetOctaveConvention("Yamaha"); err != nil || OctaveConvention() != OctaveYamaha {
+		t.Fatalf("SetOctaveConvention(Yamaha) = %v, convention %s", err, OctaveConvention())
+	}
+
+	for name, want := range map[string]uint8{"C3": 60, "C-2": 0, "C-1": 12, "G8": 127, "A3": 69} {
+		if got, err := NoteNameToMIDI(name); err != nil || got != want {
+			t.Errorf("NoteNameToMIDI(%q) = %d, %v; want %d", name, got, err, want)
+		}
+		if got := MIDIToNoteName(want); got != name {
+			t.Errorf("MIDIToNoteName(%d) = %s, want %s", want, got, name)
+		}
+	}
+	if _, err := NoteNameToMIDI("G#8"); err == nil {
+		t.Error("G#8 is above MIDI 127 for yamaha")
+	}
+
+	// Saved patterns use scientific pitch notation either way
+	p := New(4)
+	p.SetNote(1, 60)
+	pf := p.ToPatternFile("c")
+	if pf.Steps[0].Note != "C4" {
+		t.Errorf("saved note = %s, want C4", pf.Steps[0].Note)
+	}
+	loaded, err := FromPatternFile(pf)
+	if err != nil || loaded.Steps[0].Note != 60 {
+		t.Errorf("loaded note = %d, %v; want 60", loaded.Steps[0].Note, err)
+	}
+}
+
+// TestNoteMath tests transposing, intervals and scale membership
+func TestNoteMath(t *testing.T) {
+	if got, err := Transpose(60, 7); err != nil || got != 67 {
+		t.Errorf("Transpose(60, 7) = %d, %v", got, err)
+	}
+	if got, err := Transpose(60, -12); err != nil || got != 48 {
+		t.Errorf("Transpose(60, -12) = %d, %v", got, err)
+	}
+	for _, semitones := range []int{68, -61} {
+		if _, err := Transpose(60, semitones); err == nil {
+			t.Errorf("Transpose(60, %d) should leave the MIDI range", semitones)
+		}
+	}
+	if Interval(60, 67) != 7 || Interval(67, 60) != -7 || Interval(60, 60) != 0 {
+		t.Errorf("intervals = %d %d %d", Interval(60, 67), Interval(67, 60), Interval(60, 60))
+	}
+
+	tests := []struct {
+		scale string
+		note  string
+		want  bool
+	}{
+		{"C major", "E4", true},
+		{"C major", "Eb4", false},
+		{"C minor", "Eb2", true},
+		{"C", "B7", true},
+		{"F# dorian", "D#3", true},
+		{"F# dorian", "D3", false},
+		{"Bb blues", "E4", true},
+		{"A minor-pentatonic", "G3", true},
+	}
+	for _, tt := range tests {
+		scale, err := ParseScale(tt.scale)
+		if err != nil {
+			t.Fatalf("ParseScale(%q): %v", tt.scale, err)
+		}
+		note, _ := NoteNameToMIDI(tt.note)
+		if got := IsInScale(note, scale); got != tt.want {
+			t.Errorf("IsInScale(%s, %s) = %v, want %v", tt.note, tt.scale, got, tt.want)
+		}
+	}
+	for _, s := range []string{"", "H major", "a minor", "C bebop", "C major extra"} {
+		if _, err := ParseScale(s); err == nil {
+			t.Errorf("ParseScale(%q) should fail", s)
+		}
+	}
+}
+
+// TestStepAccessors tests reading and replacing steps without reaching into Steps
+func TestStepAccessors(t *testing.T) {
+	p := New(4)
+	p.SetNote(1, 60)
+	p.SetStepCC(1, 74, 100)
+
+	snapshot := p.Snapshot()
+	snapshot[0].Note = 62
+	snapshot[0].CCValues[74] = 1
+	if step, _ := p.GetStep(1); step.Note != 60 || step.CCValues[74] != 100 {
+		t.Errorf("changing a snapshot changed the pattern: %+v", step)
+	}
+	step, _ := p.GetStep(1)
+	step.CCValues[74] = 2
+	if value, _ := p.GetStepCC(1, 74); value != 100 {
+		t.Errorf("changing a step from GetStep changed the pattern: CC 74 = %d", value)
+	}
+
+	var visited []int
+	p.ForEachStep(func(stepNum int, step Step) {
+		visited = append(visited, stepNum)
+		if stepNum == 1 {
+			p.SetNote(2, step.Note) // calling back into the pattern doesn't deadlock
+		}
+	})
+	if len(visited) != 4 || visited[0] != 1 || visited[3] != 4 {
+		t.Errorf("ForEachStep visited %v", visited)
+	}
+
+	snapshot = append(snapshot, Step{Note: 67, Velocity: 90, Gate: 50, Duration: 1})
+	if err := p.SetSteps(snapshot); err != nil {
+		t.Fatalf("SetSteps: %v", err)
+	}
+	if p.Length() != 5 || p.Steps[0].Note != 62 || p.Steps[4].Note != 67 {
+		t.Errorf("after SetSteps: length %d, steps %+v", p.Length(), p.Steps)
+	}
+	snapshot[4].Note = 0
+	if p.Steps[4].Note != 67 {
+		t.Error("SetSteps should copy the steps")
+	}
+
+	for _, steps := range [][]Step{
+		nil,
+		{{Note: 60, Velocity: 100, Gate: 0, Duration: 1}},
+		{{Note: 128, Velocity: 100, Gate: 90, Duration: 1}},
+		{{Note: 60, Velocity: 100, Gate: 90, Duration: 0}},
+		{{Note: 60, Velocity: 100, Gate: 90, Duration: 1, CCValues: map[int]int{74: 200}}},
+	} {
+		if err := p.SetSteps(steps); err == nil {
+			t.Errorf("SetSteps(%+v) should fail", steps)
+		}
+	}
+	if p.Length() != 5 {
+		t.Errorf("a failed SetSteps changed the length to %d", p.Length())
+	}
+}
+
+// TestVersion tests that changes, and only changes, move the version
+func TestVersion(t *testing.T) {
+	p := New(4)
+	v := p.Version()
+	p.GetStep(1)
+	p.Snapshot()
+	p.Clone()
+	if p.Version() != v {
+		t.Error("reading the pattern changed its version")
+	}
+	for _, change := range []func(){
+		func() { p.SetNote(1, 60) },
+		func() { p.SetTempo(120) },
+		func() { p.SetStepCC(2, 74, 10) },
+		func() { p.SetSteps(p.Snapshot()) },
+		func() { p.CopyFrom(New(8)) },
+		func() { p.Resize(16) },
+	} {
+		change()
+		if p.Version() == v {
+			t.Errorf("a change left the version at %d", v)
+		}
+		v = p.Version()
+	}
+
+	// Failed changes leave the pattern, and so the version, as it was
+	for _, change := range []func() error{
+		func() error { return p.SetNote(99, 60) },
+		func() error { return p.SetVelocity(1, 128) },
+		func() error { return p.SetTempo(5) },
+		func() error { return p.SetSwing(90) },
+		func() error { return p.SetSteps(nil) },
+		func() error { return p.Resize(0) },
+		func() error { return p.RemoveSteps(1, 99, false) },
+	} {
+		if err := change(); err == nil || p.Version() != v {
+			t.Errorf("failed change (%v) moved the version from %d to %d", err, v, p.Version())
+		}
+	}
 }
 
 // TestSetNote tests setting notes on steps
@@ -197,6 +412,119 @@ func TestSetGate(t *testing.T) {
 	}
 }
 
+// TestSetGateMs tests absolute gates: range, persistence, and SetGate
+// switching back to a percentage
+func TestSetGateMs(t *testing.T) {
+	p := New(16)
+	p.SetNoteWithDuration(1, 36, 2)
+
+	for _, ms := range []int{0, -5, MaxGateMs + 1} {
+		if err := p.SetGateMs(1, ms); err == nil {
+			t.Errorf("SetGateMs(1, %d) should return error", ms)
+		}
+	}
+	if err := p.SetGateMs(17, 30); err == nil {
+		t.Error("SetGateMs(17, 30) should return error")
+	}
+	if err := p.SetGateMs(1, 30); err != nil {
+		t.Fatalf("SetGateMs(1, 30) unexpected error: %v", err)
+	}
+
+	// Changing the note keeps the gate
+	p.SetNote(1, 38)
+	if step, _ := p.GetStep(1); step.GateMs != 30 {
+		t.Errorf("GateMs after SetNote = %d, want 30", step.GateMs)
+	}
+
+	// Saved and loaded, written as a script
+	loaded, err := FromPatternFile(p.ToPatternFile("hits"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step, _ := loaded.GetStep(1); step.GateMs != 30 {
+		t.Errorf("GateMs after round trip = %d, want 30", step.GateMs)
+	}
+	var script strings.Builder
+	if err := p.WriteScript(&script, "hits"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script.String(), "set 1 D2 gate:30ms") {
+		t.Errorf("script doesn't set the gate in ms:\n%s", script.String())
+	}
+
+	if _, err := FromPatternFile(&PatternFile{Name: "bad", Tempo: 120, Length: 16,
+		Steps: []PatternStep{{Step: 1, Note: "C2", GateMs: MaxGateMs + 1}}}); err == nil {
+		t.Error("loading a gate_ms out of range should fail")
+	}
+	bad := p.Snapshot()
+	bad[0].GateMs = -1
+	if err := p.SetSteps(bad); err == nil {
+		t.Error("SetSteps with a negative GateMs should fail")
+	}
+
+	// A percentage gate replaces it
+	if err := p.SetGate(1, 50); err != nil {
+		t.Fatal(err)
+	}
+	if step, _ := p.GetStep(1); step.GateMs != 0 || step.Gate != 50 {
+		t.Errorf("after SetGate: gate %d, GateMs %d, want 50 and 0", step.Gate, step.GateMs)
+	}
+}
+
+// TestSetMuted tests muting: the step keeps its contents and is saved muted
+func TestSetMuted(t *testing.T) {
+	p := New(16)
+	p.SetNoteWithDuration(5, 48, 2)
+	p.SetVelocity(5, 110)
+	p.SetStepCC(5, 74, 90)
+
+	if err := p.SetMuted(5, true); err != nil {
+		t.Fatalf("SetMuted(5, true) unexpected error: %v", err)
+	}
+	step, _ := p.GetStep(5)
+	if !step.Muted || step.Note != 48 || step.Velocity != 110 || step.Duration != 2 || step.CCValues[74] != 90 {
+		t.Errorf("muted step = %+v, want its contents kept", step)
+	}
+	if err := p.SetMuted(1, true); err == nil {
+		t.Error("SetMuted on a rest should return error")
+	}
+	if err := p.SetMuted(17, true); err == nil {
+		t.Error("SetMuted(17, true) should return error")
+	}
+	if !strings.Contains(p.String(), " 5: C3 (vel:110 gate:90% dur:2) [CC74:90] muted") {
+		t.Errorf("String() doesn't show the muted step:\n%s", p.String())
+	}
+
+	loaded, err := FromPatternFile(p.ToPatternFile("muted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step, _ := loaded.GetStep(5); !step.Muted {
+		t.Error("Muted lost in save and load")
+	}
+	var script strings.Builder
+	if err := p.WriteScript(&script, "muted"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script.String(), "mute-step 5\n") {
+		t.Errorf("script doesn't mute step 5:\n%s", script.String())
+	}
+
+	if err := p.SetMuted(5, false); err != nil {
+		t.Fatal(err)
+	}
+	if step, _ := p.GetStep(5); step.Muted {
+		t.Error("SetMuted(5, false) left the step muted")
+	}
+
+	// A new note unmutes
+	p.SetMuted(5, true)
+	p.SetNote(5, 50)
+	if step, _ := p.GetStep(5); step.Muted {
+		t.Error("SetNote left the step muted")
+	}
+}
+
 // TestSetRest tests setting rests
 func TestSetRest(t *testing.T) {
 	p := New(DefaultPatternLength)
@@ -354,7 +682,7 @@ func TestSetTempo(t *testing.T) {
 		t.Errorf("SetTempo(120) unexpected error: %v", err)
 	}
 	if p.GetBPM() != 120 {
-		t.Errorf("SetTempo(120) got BPM %d, want 120", p.GetBPM())
+		t.Errorf("SetTempo(120) got BPM %g, want 120", p.GetBPM())
 	}
 
 	// Min tempo
@@ -380,6 +708,40 @@ func TestSetTempo(t *testing.T) {
 	if err == nil {
 		t.Error("SetTempo(301) should return error")
 	}
+
+	// Fractional tempos are rounded to hundredths and saved as they are
+	if err := p.SetTempo(122.504); err != nil {
+		t.Fatalf("SetTempo(122.504) unexpected error: %v", err)
+	}
+	if p.GetBPM() != 122.5 || FormatBPM(p.GetBPM()) != "122.5" {
+		t.Errorf("SetTempo(122.504) got BPM %g (%s), want 122.5", p.GetBPM(), FormatBPM(p.GetBPM()))
+	}
+	loaded, err := FromPatternFile(p.ToPatternFile("fractional"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.GetBPM() != 122.5 {
+		t.Errorf("round trip: BPM %g, want 122.5", loaded.GetBPM())
+	}
+	if err := p.SetTempo(math.NaN()); err == nil {
+		t.Error("SetTempo(NaN) should return error")
+	}
+
+	// Files from before fractional tempos still load
+	var pf PatternFile
+	if err := json.Unmarshal([]byte(`{"name":"old","tempo":120,"length":16,"steps":[]}`), &pf); err != nil {
+		t.Fatal(err)
+	}
+	old, err := FromPatternFile(&pf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.GetBPM() != 120 {
+		t.Errorf("old file: BPM %g, want 120", old.GetBPM())
+	}
+	if data, _ := json.Marshal(New(16).ToPatternFile("whole")); !strings.Contains(string(data), `"tempo":80,`) {
+		t.Errorf("whole tempos should still be written as integers: %s", data)
+	}
 }
 
 // TestDefaultPattern tests that New() creates expected default pattern
@@ -388,7 +750,7 @@ func TestDefaultPattern(t *testing.T) {
 
 	// Check default tempo
 	if p.BPM != 80 {
-		t.Errorf("Default pattern BPM = %d, want 80", p.BPM)
+		t.Errorf("Default pattern BPM = %g, want 80", p.BPM)
 	}
 
 	// Check that default pattern starts with silence (all rests)
@@ -540,7 +902,7 @@ func TestSaveAndLoad(t *testing.T) {
 		t.Errorf("PatternFile.Name = %s, want test_pattern", pf.Name)
 	}
 	if pf.Tempo != 100 {
-		t.Errorf("PatternFile.Tempo = %d, want 100", pf.Tempo)
+		t.Errorf("PatternFile.Tempo = %g, want 100", pf.Tempo)
 	}
 	if len(pf.Steps) != 2 {
 		t.Errorf("PatternFile.Steps length = %d, want 2", len(pf.Steps))
@@ -553,7 +915,7 @@ func TestSaveAndLoad(t *testing.T) {
 	}
 
 	if loadedPattern.BPM != 100 {
-		t.Errorf("Loaded pattern BPM = %d, want 100", loadedPattern.BPM)
+		t.Errorf("Loaded pattern BPM = %g, want 100", loadedPattern.BPM)
 	}
 
 	step1, _ := loadedPattern.GetStep(1)
@@ -592,7 +954,7 @@ func TestSaveAndLoad(t *testing.T) {
 
 	// Verify it matches
 	if loadedPattern2.BPM != p.BPM {
-		t.Errorf("Loaded pattern BPM = %d, want %d", loadedPattern2.BPM, p.BPM)
+		t.Errorf("Loaded pattern BPM = %g, want %g", loadedPattern2.BPM, p.BPM)
 	}
 }
 
@@ -696,6 +1058,48 @@ func TestDurationPreservesVelocityGate(t *testing.T) {
 	}
 }
 
+// TestMeter tests the time signature and resolution: steps per bar,
+// validation and save/load
+func TestMeter(t *testing.T) {
+	p := New(DefaultPatternLength)
+	if p.StepsPerBar() != StepsPerBar || p.GetResolution() != DefaultResolution {
+		t.Errorf("new pattern has %d steps per bar in 1/%d, want %d in 1/%d",
+			p.StepsPerBar(), p.GetResolution(), StepsPerBar, DefaultResolution)
+	}
+
+	if err := p.SetMeter(6, 8, 16); err != nil {
+		t.Fatalf("SetMeter(6, 8, 16): %v", err)
+	}
+	if p.StepsPerBar() != 12 {
+		t.Errorf("6/8 in 16ths has %d steps per bar, want 12", p.StepsPerBar())
+	}
+	version := p.Version()
+	if err := p.SetMeter(7, 16, 8); err == nil {
+		t.Error("7/16 in 8ths isn't a whole number of steps and should fail")
+	}
+	if p.Version() != version || p.Meter() != "6/8 in 16ths" {
+		t.Errorf("a failed SetMeter changed the pattern to %s", p.Meter())
+	}
+
+	pf := p.ToPatternFile("meter")
+	if pf.TimeSig != "6/8" || pf.StepNote != 0 {
+		t.Errorf("saved time_signature %q, resolution %d, want \"6/8\", 0", pf.TimeSig, pf.StepNote)
+	}
+	pf.StepNote = 32
+	loaded, err := FromPatternFile(pf)
+	if err != nil {
+		t.Fatalf("FromPatternFile: %v", err)
+	}
+	if loaded.Meter() != "6/8 in 32nds" || loaded.StepsPerBar() != 24 {
+		t.Errorf("loaded %s with %d steps per bar, want 6/8 in 32nds with 24", loaded.Meter(), loaded.StepsPerBar())
+	}
+
+	pf.TimeSig = "6-8"
+	if _, err := FromPatternFile(pf); err == nil {
+		t.Error("an invalid time signature should fail to load")
+	}
+}
+
 // TestDurationJSONRoundTrip tests that duration is preserved through save/load
 func TestDurationJSONRoundTrip(t *testing.T) {
 	tempDir := t.TempDir()
@@ -992,6 +1396,48 @@ func TestSwingInClone(t *testing.T) {
 	}
 }
 
+func TestSwingDelay(t *testing.T) {
+	p := New(8)
+	p.SetSwing(50)
+	p.SetStraight(4, true)
+
+	// Delay in percent of a step for each step index
+	want16 := []int{0, 50, 0, 0, 0, 50, 0, 50}
+	for i, want := range want16 {
+		if got := p.SwingDelay(i); got != want {
+			t.Errorf("16th swing: SwingDelay(%d) = %v, want %v", i, got, want)
+		}
+	}
+
+	if err := p.SetSwingUnit(2); err != nil {
+		t.Fatal(err)
+	}
+	p.SetStraight(4, false)
+	p.SetStraight(7, true)
+	want8 := []int{0, 0, 100, 0, 0, 0, 0, 0}
+	for i, want := range want8 {
+		if got := p.SwingDelay(i); got != want {
+			t.Errorf("8th swing: SwingDelay(%d) = %v, want %v", i, got, want)
+		}
+	}
+	if err := p.SetSwingUnit(3); err == nil {
+		t.Error("SetSwingUnit(3) should fail")
+	}
+
+	// Straight survives a new note and a save
+	p.SetNote(7, 40)
+	loaded, err := FromPatternFile(p.ToPatternFile("straight"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step, _ := loaded.GetStep(7); !step.Straight {
+		t.Error("Straight lost in a new note or in save and load")
+	}
+	if clone := p.Clone(); clone.GetSwingUnit() != 2 {
+		t.Errorf("Cloned swing unit = %d, want 2", clone.GetSwingUnit())
+	}
+}
+
 func TestSwingInCopyFrom(t *testing.T) {
 	p1 := New(16)
 	p1.SetSwing(66)
@@ -1725,3 +2171,947 @@ func containsCheck(s, substr string) bool {
 	}
 	return false
 }
+
+func TestWriteMIDIFile(t *testing.T) {
+	p := New(4)
+	p.SetTempo(120)
+	p.SetNote(1, 36)
+	p.SetVelocity(1, 127)
+	p.SetNoteWithDuration(3, 43, 2)
+
+	var buf bytes.Buffer
+	if err := p.WriteMIDIFile(&buf, 1); err != nil {
+		t.Fatalf("WriteMIDIFile() error = %v", err)
+	}
+
+	want := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96,
+		'M', 'T', 'r', 'k', 0, 0, 0, 27,
+		0x00, 0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20, // tempo 500000us = 120 BPM
+		0x00, 0x90, 36, 127, // step 1 on
+		0x15, 0x80, 36, 0, // off after 90% of 24 ticks
+		0x1B, 0x90, 43, 100, // step 3 on (tick 48)
+		0x2B, 0x80, 43, 0, // off after 90% of 48 ticks (tick 91)
+		0x05, 0xFF, 0x2F, 0x00, // end of track at tick 96
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("WriteMIDIFile() =\n% x\nwant\n% x", buf.Bytes(), want)
+	}
+
+	if err := p.WriteMIDIFile(&buf, 0); err == nil {
+		t.Error("WriteMIDIFile() with 0 loops should return error")
+	}
+}
+
+func TestWriteMIDIPerformance(t *testing.T) {
+	first := New(2)
+	first.SetTempo(120)
+	first.SetNote(1, 36)
+	second := New(2)
+	second.SetTempo(60)
+	second.SetNote(1, 43)
+
+	var buf bytes.Buffer
+	if err := WriteMIDIPerformance(&buf, []*Pattern{first, second}); err != nil {
+		t.Fatalf("WriteMIDIPerformance() error = %v", err)
+	}
+
+	want := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96,
+		'M', 'T', 'r', 'k', 0, 0, 0, 34,
+		0x00, 0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20, // tempo 120 BPM
+		0x00, 0x90, 36, 100, // first loop
+		0x15, 0x80, 36, 0,
+		0x1B, 0xFF, 0x51, 0x03, 0x0F, 0x42, 0x40, // tempo 60 BPM at the second loop (tick 48)
+		0x00, 0x90, 43, 100,
+		0x15, 0x80, 43, 0,
+		0x1B, 0xFF, 0x2F, 0x00, // end of track at tick 96
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("WriteMIDIPerformance() =\n% x\nwant\n% x", buf.Bytes(), want)
+	}
+
+	if err := WriteMIDIPerformance(&buf, nil); err == nil {
+		t.Error("WriteMIDIPerformance() with no loops should return error")
+	}
+}
+
+func TestResizeSteps(t *testing.T) {
+	p := New(8)
+	p.SetNote(1, 36)
+	p.SetNote(3, 38)
+	p.SetNote(6, 40)
+	p.SetNote(7, 43)
+	steps := p.Snapshot()
+
+	tests := []struct {
+		name   string
+		length int
+		mode   ResizeMode
+		notes  string // note on each step, "." for rests
+		lost   []int
+	}{
+		{"truncate", 4, ResizeTruncate, "36 . 38 .", []int{6, 7}},
+		{"keep tail", 4, ResizeKeepTail, ". 40 43 .", []int{1, 3}},
+		{"fold", 4, ResizeFold, "36 40 38 .", []int{7}},
+		{"fold onto notes", 2, ResizeFold, "36 40", []int{3, 7}},
+		{"grow", 10, ResizeKeepTail, "36 . 38 . . 40 43 . . .", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resized, lost := ResizeSteps(steps, tt.length, tt.mode)
+			var notes []string
+			for _, step := range resized {
+				if step.IsRest {
+					notes = append(notes, ".")
+				} else {
+					notes = append(notes, strconv.Itoa(int(step.Note)))
+				}
+			}
+			if got := strings.Join(notes, " "); got != tt.notes {
+				t.Errorf("notes = %s, want %s", got, tt.notes)
+			}
+			if !slices.Equal(lost, tt.lost) {
+				t.Errorf("lost = %v, want %v", lost, tt.lost)
+			}
+		})
+	}
+}
+
+func TestWithDensity(t *testing.T) {
+	p := New(8)
+	p.SetNote(1, 48)
+	p.SetNote(2, 60)
+	p.SetNote(5, 55)
+	p.SetNote(6, 52)
+	p.SetVelocity(1, 120)
+	p.SetVelocity(2, 40)
+	p.SetVelocity(5, 40)
+	p.SetVelocity(6, 90)
+	cMajor, _ := ParseScale("C major")
+
+	// Thinning drops the quietest, off-beat first: step 2 before step 5
+	thin, removed, added, err := p.WithDensity(25, cMajor, func() float64 { return 0 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []int
+	for i, step := range thin.Steps {
+		if !step.IsRest {
+			kept = append(kept, i+1)
+		}
+	}
+	if removed != 2 || added != 0 || !slices.Equal(kept, []int{1, 6}) {
+		t.Errorf("thinned to 25%%: removed %d, added %d, kept steps %v; want 2, 0, [1 6]", removed, added, kept)
+	}
+	if len(p.Snapshot()) != 8 || p.Steps[1].IsRest {
+		t.Error("WithDensity changed the original")
+	}
+
+	// Thickening adds scale notes within the range, on free steps
+	p.SetNoteWithDuration(6, 52, 2) // holds step 7
+	thick, removed, added, err := p.WithDensity(100, cMajor, rand.Float64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 || added != 3 {
+		t.Errorf("thickened to 100%%: removed %d, added %d; want 0, 3", removed, added)
+	}
+	if !thick.Steps[6].IsRest {
+		t.Error("a note was added on a held step")
+	}
+	for i, step := range thick.Steps {
+		if !step.IsRest && (!IsInScale(step.Note, cMajor) || step.Note < 48 || step.Note > 60) {
+			t.Errorf("step %d: %s is outside C major or the range C3-C4", i+1, MIDIToNoteName(step.Note))
+		}
+	}
+
+	if _, _, _, err := New(8).WithDensity(50, cMajor, rand.Float64); err == nil {
+		t.Error("thickening an empty pattern should fail")
+	}
+	if _, _, _, err := p.WithDensity(101, cMajor, rand.Float64); err == nil {
+		t.Error("density 101 should fail")
+	}
+}
+
+func TestInsertRemoveSteps(t *testing.T) {
+	notes := func(p *Pattern) string {
+		var s []string
+		for _, step := range p.Snapshot() {
+			if step.IsRest {
+				s = append(s, ".")
+			} else {
+				s = append(s, strconv.Itoa(int(step.Note)))
+			}
+		}
+		return strings.Join(s, " ")
+	}
+	newPattern := func() *Pattern {
+		p := New(4)
+		for i := 1; i <= 4; i++ {
+			p.SetNote(i, uint8(i))
+		}
+		return p
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *Pattern) error
+		want   string
+	}{
+		{"insert", func(p *Pattern) error { return p.InsertSteps(2, 1, false) }, "1 . 2 3 4"},
+		{"insert at the end", func(p *Pattern) error { return p.InsertSteps(5, 2, false) }, "1 2 3 4 . ."},
+		{"insert wrapping", func(p *Pattern) error { return p.InsertSteps(2, 1, true) }, "1 4 2 3"},
+		{"insert wrapping past the length", func(p *Pattern) error { return p.InsertSteps(3, 3, true) }, "1 2 4 3"},
+		{"remove", func(p *Pattern) error { return p.RemoveSteps(2, 2, false) }, "1 4"},
+		{"remove wrapping", func(p *Pattern) error { return p.RemoveSteps(1, 1, true) }, "2 3 4 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPattern()
+			if err := tt.change(p); err != nil {
+				t.Fatal(err)
+			}
+			if got := notes(p); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	p := newPattern()
+	for _, err := range []error{
+		p.InsertSteps(6, 1, false), p.InsertSteps(5, 1, true), p.InsertSteps(1, 0, false),
+		p.RemoveSteps(0, 1, false), p.RemoveSteps(3, 3, false), p.RemoveSteps(1, 4, false),
+	} {
+		if err == nil {
+			t.Error("expected error")
+		}
+	}
+	if got := notes(p); got != "1 2 3 4" {
+		t.Errorf("failed changes left %s", got)
+	}
+}
+
+func TestWriteVarLen(t *testing.T) {
+	tests := []struct {
+		value int
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7F, []byte{0x7F}},
+		{0x80, []byte{0x81, 0x00}},
+		{0x3FFF, []byte{0xFF, 0x7F}},
+		{0x200000, []byte{0x81, 0x80, 0x80, 0x00}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeVarLen(&buf, tt.value)
+		if !bytes.Equal(buf.Bytes(), tt.want) {
+			t.Errorf("writeVarLen(%#x) = % x, want % x", tt.value, buf.Bytes(), tt.want)
+		}
+	}
+}
+
+// TestVolume tests the pattern volume and its persistence
+func TestVolume(t *testing.T) {
+	p := New(16)
+	if _, ok := p.GetVolume(); ok {
+		t.Error("new pattern should have no volume")
+	}
+	if pf := p.ToPatternFile("x"); pf.Volume != nil {
+		t.Errorf("ToPatternFile().Volume = %d, want nil", *pf.Volume)
+	}
+
+	for _, volume := range []int{-2, 128} {
+		if err := p.SetVolume(volume); err == nil {
+			t.Errorf("SetVolume(%d) should fail", volume)
+		}
+	}
+	if err := p.SetVolume(0); err != nil {
+		t.Fatalf("SetVolume(0) error = %v", err)
+	}
+	if !strings.Contains(p.String(), "Volume: 0") {
+		t.Errorf("String() should show the volume:\n%s", p.String())
+	}
+
+	loaded, err := FromPatternFile(p.Clone().ToPatternFile("x"))
+	if err != nil {
+		t.Fatalf("FromPatternFile() error = %v", err)
+	}
+	if volume, ok := loaded.GetVolume(); !ok || volume != 0 {
+		t.Errorf("loaded volume = %d, %v, want 0", volume, ok)
+	}
+
+	p.SetVolume(-1)
+	loaded.CopyFrom(p)
+	if _, ok := loaded.GetVolume(); ok {
+		t.Error("CopyFrom should copy an unset volume")
+	}
+
+	bad := 200
+	if _, err := FromPatternFile(&PatternFile{Length: 16, Tempo: 80, Volume: &bad}); err == nil {
+		t.Error("FromPatternFile should reject volume 200")
+	}
+}
+
+// TestSavedGlobalCC tests global CCs saved as pattern-level defaults
+func TestSavedGlobalCC(t *testing.T) {
+	p := New(16)
+	if err := p.SetGlobalCCSaved(74, true); err == nil {
+		t.Error("SetGlobalCCSaved should fail for an unset CC")
+	}
+
+	p.SetGlobalCC(74, 90)
+	p.SetGlobalCC(91, 40)
+	if err := p.SetGlobalCCSaved(91, true); err != nil {
+		t.Fatalf("SetGlobalCCSaved() error = %v", err)
+	}
+
+	pf := p.ToPatternFile("x")
+	if len(pf.CC) != 1 || pf.CC["91"] != 40 {
+		t.Errorf("ToPatternFile().CC = %v, want only 91: 40", pf.CC)
+	}
+
+	loaded, err := FromPatternFile(pf)
+	if err != nil {
+		t.Fatalf("FromPatternFile() error = %v", err)
+	}
+	if value, ok := loaded.GetGlobalCC(91); !ok || value != 40 || !loaded.IsGlobalCCSaved(91) {
+		t.Errorf("loaded CC91 = %d, %v, saved %v, want 40 saved", value, ok, loaded.IsGlobalCCSaved(91))
+	}
+	if _, ok := loaded.GetGlobalCC(74); ok {
+		t.Error("transient CC74 should not be saved")
+	}
+	if !p.Clone().IsGlobalCCSaved(91) {
+		t.Error("Clone should keep saved CCs")
+	}
+
+	p.SetGlobalCCSaved(91, false)
+	if pf := p.ToPatternFile("x"); pf.CC != nil {
+		t.Errorf("ToPatternFile().CC = %v after unsaving, want nil", pf.CC)
+	}
+}
+
+// TestNoteOffMode tests the note-off settings, their persistence and export
+func TestNoteOffMode(t *testing.T) {
+	p := New(4)
+	if p.GetNoteOffMode() != NoteOffRing || p.GetLegato() {
+		t.Errorf("defaults = %s, legato %v, want ring, false", p.GetNoteOffMode(), p.GetLegato())
+	}
+	if err := p.SetNoteOffMode("sustain"); err == nil {
+		t.Error("SetNoteOffMode(sustain) should fail")
+	}
+	if pf := p.ToPatternFile("x"); pf.NoteOff != "" || pf.Legato {
+		t.Errorf("default ToPatternFile() = %q, %v, want omitted", pf.NoteOff, pf.Legato)
+	}
+
+	// A two-step note on the last step rings for its full gate...
+	p.SetNoteWithDuration(4, 36, 2)
+	var buf bytes.Buffer
+	p.WriteMIDIFile(&buf, 1)
+	if !bytes.Contains(buf.Bytes(), []byte{0x2B, 0x80, 36, 0}) {
+		t.Errorf("ring: note should end after 43 ticks:\n% x", buf.Bytes())
+	}
+
+	// ...or is cut at the loop boundary
+	if err := p.SetNoteOffMode("CUT"); err != nil {
+		t.Fatalf("SetNoteOffMode(CUT) error = %v", err)
+	}
+	p.SetLegato(true)
+	buf.Reset()
+	p.WriteMIDIFile(&buf, 1)
+	if !bytes.Contains(buf.Bytes(), []byte{0x18, 0x80, 36, 0}) {
+		t.Errorf("cut: note should end after 24 ticks:\n% x", buf.Bytes())
+	}
+
+	loaded, err := FromPatternFile(p.Clone().ToPatternFile("x"))
+	if err != nil {
+		t.Fatalf("FromPatternFile() error = %v", err)
+	}
+	if loaded.GetNoteOffMode() != NoteOffCut || !loaded.GetLegato() {
+		t.Errorf("loaded = %s, legato %v, want cut, true", loaded.GetNoteOffMode(), loaded.GetLegato())
+	}
+	if loaded, _ := FromPatternFile(&PatternFile{Length: 4, Tempo: 80, NoteOff: "ring"}); loaded.GetNoteOffMode() != NoteOffRing {
+		t.Errorf("ring from a file saved before ring was the default = %s", loaded.GetNoteOffMode())
+	}
+	if _, err := FromPatternFile(&PatternFile{Length: 4, Tempo: 80, NoteOff: "hold"}); err == nil {
+		t.Error("FromPatternFile should reject an unknown note-off mode")
+	}
+}
+
+// TestAnalyze tests key detection and pattern statistics
+func TestAnalyze(t *testing.T) {
+	if a := New(16).Analyze(); a.Notes != 0 || a.Key != "" || a.Summary() != "no notes" {
+		t.Errorf("empty pattern: %+v", a)
+	}
+
+	tests := []struct {
+		name     string
+		notes    []string // on steps 1, 2, 3, ...
+		wantKey  string
+		outOfKey string
+	}{
+		{"C major scale", []string{"C3", "D3", "E3", "F3", "G3", "A3", "B3", "C4"}, "C major", ""},
+		{"A minor arpeggio", []string{"A2", "C3", "E3", "A3", "E3", "C3", "A2", "E2"}, "A minor", ""},
+		{"G major with F natural", []string{"G2", "B2", "D3", "G3", "B2", "D3", "G2", "F3"}, "G major", "F"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(32)
+			for i, note := range tt.notes {
+				midi, _ := NoteNameToMIDI(note)
+				p.SetNote(i*2+1, midi)
+			}
+			a := p.Analyze()
+			if a.Key != tt.wantKey {
+				t.Errorf("Key = %q, want %q (confidence %.2f)", a.Key, tt.wantKey, a.KeyConfidence)
+			}
+			if got := strings.Join(a.OutOfKey, " "); got != tt.outOfKey {
+				t.Errorf("OutOfKey = %q, want %q", got, tt.outOfKey)
+			}
+		})
+	}
+
+	// Statistics: notes on steps 1, 3, 5, 7, 9 (bar 1) and 18 (bar 2)
+	p := New(32)
+	for _, step := range []int{1, 3, 5, 7, 9, 18} {
+		p.SetNote(step, 36)
+	}
+	p.SetVelocity(1, 120)
+	p.SetVelocity(18, 60)
+	a := p.Analyze()
+	if a.Notes != 6 || a.PitchClasses[0] != 6 {
+		t.Errorf("Notes = %d, C count = %d, want 6, 6", a.Notes, a.PitchClasses[0])
+	}
+	if len(a.BarDensity) != 2 || a.BarDensity[0] != 5.0/16 || a.BarDensity[1] != 1.0/16 {
+		t.Errorf("BarDensity = %v, want [0.3125 0.0625]", a.BarDensity)
+	}
+	if a.VelocityMin != 60 || a.VelocityMax != 120 || a.VelocityMean != 580.0/6 {
+		t.Errorf("velocity = %d-%d mean %.2f, want 60-120 mean 96.67", a.VelocityMin, a.VelocityMax, a.VelocityMean)
+	}
+	// Off the beat: steps 3, 7 and 18
+	if a.Syncopation != 0.5 {
+		t.Errorf("Syncopation = %.2f, want 0.50", a.Syncopation)
+	}
+	if !strings.Contains(a.Summary(), "6 notes") {
+		t.Errorf("Summary() = %q", a.Summary())
+	}
+
+	// A pattern shorter than a bar has one partial bar
+	short := New(6)
+	short.SetNote(1, 60)
+	short.SetNote(4, 60)
+	if a := short.Analyze(); len(a.BarDensity) != 1 || a.BarDensity[0] != 2.0/6 {
+		t.Errorf("short BarDensity = %v, want [0.33]", a.BarDensity)
+	}
+}
+
+// TestListInfo tests pattern summaries for listings, including tags
+func TestListInfo(t *testing.T) {
+	originalDir, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(originalDir)
+
+	p := New(32)
+	p.SetTempo(128)
+	p.SetNote(1, 36)
+	p.SetNote(9, 36)
+	if err := p.SetTags([]string{"Techno", "dark", "techno"}); err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+	if err := p.SetTags([]string{"two words"}); err == nil {
+		t.Error("SetTags should reject tags with spaces")
+	}
+	if err := p.Save("beat"); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(PatternsDir, "broken.json"), []byte("{"), 0644)
+
+	infos, err := ListInfo()
+	if err != nil {
+		t.Fatalf("ListInfo() error = %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("ListInfo() returned %d patterns, want 2", len(infos))
+	}
+	for _, info := range infos {
+		switch info.Name {
+		case "beat":
+			if info.Tempo != 128 || info.Length != 32 || info.Notes != 2 || info.Saved.IsZero() {
+				t.Errorf("beat = %+v", info)
+			}
+			if strings.Join(info.Tags, ",") != "techno,dark" {
+				t.Errorf("beat tags = %v, want [techno dark]", info.Tags)
+			}
+		case "broken":
+			if info.Err == nil {
+				t.Error("broken pattern should report an error")
+			}
+		}
+	}
+
+	loaded, err := Load("beat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(loaded.Clone().GetTags(), ",") != "techno,dark" {
+		t.Errorf("loaded tags = %v", loaded.GetTags())
+	}
+}
+
+// TestCollections tests saving patterns in collection subdirectories
+func TestCollections(t *testing.T) {
+	originalDir, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(originalDir)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"funk1", filepath.Join("patterns", "funk1.json")},
+		{"basslines/funk 1", filepath.Join("patterns", "basslines", "funk_1.json")},
+		{"/basslines//funk1/", filepath.Join("patterns", "basslines", "funk1.json")},
+		{"../../etc/passwd", filepath.Join("patterns", "unnamed", "unnamed", "etc", "passwd.json")},
+	}
+	for _, tt := range tests {
+		if got := Path(tt.name); got != tt.want {
+			t.Errorf("Path(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	p := New(8)
+	for _, name := range []string{"top", "basslines/funk1", "basslines/acid/303"} {
+		if err := p.Save(name); err != nil {
+			t.Fatalf("Save(%q) error = %v", name, err)
+		}
+	}
+	names, err := List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got := strings.Join(names, ","); got != "basslines/acid/303,basslines/funk1,top" {
+		t.Errorf("List() = %s", got)
+	}
+	if _, err := Load("basslines/acid/303"); err != nil {
+		t.Errorf("Load() error = %v", err)
+	}
+
+	// Deleting the last pattern of a collection removes its directory
+	if err := Delete("basslines/acid/303"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("patterns", "basslines", "acid")); !os.IsNotExist(err) {
+		t.Error("empty collection directory should be removed")
+	}
+	if _, err := os.Stat(filepath.Join("patterns", "basslines")); err != nil {
+		t.Error("non-empty collection directory should remain")
+	}
+}
+
+func TestParseTab(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string // step:note/duration/velocity, "step:rest"
+		length  int
+		lanes   int
+		wantErr bool
+	}{
+		{"one lane", "C1 x...x...", "1:C1/1/100 5:C1/1/100", 8, 1, false},
+		{"accent and ghost", "C1 X.o.", "1:C1/1/127 3:C1/1/60", 4, 1, false},
+		{"grouped grid", "C1 x... | x...", "1:C1/1/100 5:C1/1/100", 8, 1, false},
+		{"two lanes", "C1 x... D1 ..x.", "1:C1/1/100 3:D1/1/100", 4, 2, false},
+		{"melody", "C2 . . G2", "1:C2/1/0 2:rest 3:rest 4:G2/1/0", 4, 0, false},
+		{"melody with holds", "C2 - - | G2 ..", "1:C2/3/0 2:rest 3:rest 4:G2/1/0 5:rest 6:rest", 6, 0, false},
+		{"hold without note", "- C2", "", 0, 0, true},
+		{"lane without note", "x...", "", 0, 0, true},
+		{"lane without grid", "C1 D1 x...", "", 0, 0, true},
+		{"bad lane character", "C1 x.y.", "", 0, 0, true},
+		{"bad melody token", "C2 foo", "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tab, err := ParseTab(strings.Fields(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTab(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got []string
+			for _, s := range tab.Steps {
+				if s.Rest {
+					got = append(got, fmt.Sprintf("%d:rest", s.Step))
+				} else {
+					got = append(got, fmt.Sprintf("%d:%s/%d/%d", s.Step, MIDIToNoteName(s.Note), s.Duration, s.Velocity))
+				}
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("ParseTab(%q) steps = %s, want %s", tt.input, strings.Join(got, " "), tt.want)
+			}
+			if tab.Length != tt.length || tab.Lanes != tt.lanes {
+				t.Errorf("ParseTab(%q) length %d lanes %d, want %d %d", tt.input, tab.Length, tab.Lanes, tt.length, tt.lanes)
+			}
+		})
+	}
+}
+
+func TestImportHydrogen(t *testing.T) {
+	song := `<?xml version="1.0" encoding="UTF-8"?>
+<song>
+ <bpm>96.5</bpm>
+ <instrumentList>
+  <instrument><id>0</id><name>Kick</name></instrument>
+  <instrument><id>1</id><name>Snare</name><midiOutNote>38</midiOutNote></instrument>
+ </instrumentList>
+ <patternList>
+  <pattern>
+   <name>intro</name>
+   <size>96</size>
+   <noteList>
+    <note><position>0</position><velocity>0.8</velocity><instrument>0</instrument></note>
+   </noteList>
+  </pattern>
+  <pattern>
+   <name>groove</name>
+   <size>192</size>
+   <noteList>
+    <note><position>0</position><velocity>1</velocity><instrument>0</instrument></note>
+    <note><position>0</position><velocity>0.5</velocity><instrument>1</instrument></note>
+    <note><position>50</position><velocity>0.6</velocity><instrument>1</instrument></note>
+   </noteList>
+  </pattern>
+ </patternList>
+</song>`
+
+	imp, err := ImportHydrogen(strings.NewReader(song), "")
+	if err != nil {
+		t.Fatalf("ImportHydrogen() error = %v", err)
+	}
+	if imp.Pattern.Length() != 8 || imp.Pattern.GetBPM() != 96.5 || !imp.HasTempo {
+		t.Errorf("first pattern: length %d tempo %g, want 8, 96.5 (fractional tempos are kept)", imp.Pattern.Length(), imp.Pattern.GetBPM())
+	}
+
+	imp, err = ImportHydrogen(strings.NewReader(song), "Groove")
+	if err != nil {
+		t.Fatalf("ImportHydrogen(groove) error = %v", err)
+	}
+	p := imp.Pattern
+	if p.Length() != 16 {
+		t.Errorf("length = %d, want 16", p.Length())
+	}
+	if p.Steps[0].Note != 36 || p.Steps[0].Velocity != 127 {
+		t.Errorf("step 1 = %+v, want the louder kick", p.Steps[0])
+	}
+	if p.Steps[4].Note != 38 || p.Steps[4].Velocity != 76 {
+		t.Errorf("step 5 = %+v, want snare quantized from tick 50", p.Steps[4])
+	}
+	if imp.Dropped != 1 || imp.Quantized != 1 {
+		t.Errorf("dropped %d quantized %d, want 1 1", imp.Dropped, imp.Quantized)
+	}
+
+	if _, err := ImportHydrogen(strings.NewReader(song), "verse"); err == nil {
+		t.Error("unknown pattern: expected error")
+	}
+	if _, err := ImportHydrogen(strings.NewReader("not xml"), ""); err == nil {
+		t.Error("invalid file: expected error")
+	}
+
+	// Exported .h2pattern files hold a single pattern
+	h2pattern := `<drumkit_pattern><pattern><name>p</name><size>48</size><noteList>
+<note><position>24</position><velocity>0.8</velocity><instrument>6</instrument></note>
+</noteList></pattern></drumkit_pattern>`
+	imp, err = ImportHydrogen(strings.NewReader(h2pattern), "")
+	if err != nil {
+		t.Fatalf("ImportHydrogen(h2pattern) error = %v", err)
+	}
+	if imp.HasTempo || imp.Pattern.Length() != 4 || imp.Pattern.Steps[2].Note != 42 {
+		t.Errorf("h2pattern: tempo %v length %d step 3 %+v", imp.HasTempo, imp.Pattern.Length(), imp.Pattern.Steps[2])
+	}
+
+	// The size comes from the file, so it is bounded before allocating
+	huge := `<drumkit_pattern><pattern><name>p</name><size>1920000000000</size></pattern></drumkit_pattern>`
+	if _, err := ImportHydrogen(strings.NewReader(huge), ""); err == nil {
+		t.Error("huge pattern: expected error")
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		length  int
+		wantErr bool
+	}{
+		{"header and names", "step,note,velocity\n1,C1,110\n5,D1\n", 16, false},
+		{"numbers and comments", "# groove\n1, 36, 100\n17, 38, 90\n", 32, false},
+		{"empty", "step,note\n", 0, true},
+		{"bad step", "1,C1\nx,C1\n", 0, true},
+		{"bad note", "1,H1\n", 0, true},
+		{"bad velocity", "1,C1,200\n", 0, true},
+		{"too many fields", "1,C1,100,90\n", 0, true},
+		{"longest step", "1024,C1\n", MaxImportSteps, false},
+		{"step too far", "1,C1\n2000000000,C1\n", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imp, err := ImportCSV(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImportCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && imp.Pattern.Length() != tt.length {
+				t.Errorf("length = %d, want %d", imp.Pattern.Length(), tt.length)
+			}
+		})
+	}
+
+	imp, _ := ImportCSV(strings.NewReader("1,C1,110\n5,D1\n"))
+	if s := imp.Pattern.Steps[0]; s.Note != 24 || s.Velocity != 110 {
+		t.Errorf("step 1 = %+v", s)
+	}
+	if s := imp.Pattern.Steps[4]; s.Note != 26 || s.Velocity != 100 {
+		t.Errorf("step 5 = %+v", s)
+	}
+}
+
+func TestParseABC(t *testing.T) {
+	// tabString renders notes as note/duration and rests as "."
+	tabString := func(tab *Tab) string {
+		var out []string
+		for _, s := range tab.Steps {
+			if s.Rest {
+				out = append(out, ".")
+			} else {
+				out = append(out, fmt.Sprintf("%s/%d", MIDIToNoteName(s.Note), s.Duration))
+			}
+		}
+		return strings.Join(out, " ")
+	}
+
+	tests := []struct {
+		name    string
+		tune    string
+		want    string
+		tempo   int
+		wantErr bool
+	}{
+		{"default eighths", "C D E", "C4/2 . D4/2 . E4/2 .", 0, false},
+		{"unit and lengths", "L:1/16 C2 D E/2", "", 0, true}, // E/2 is a 32nd note
+		{"sixteenths", "L:1/16 C2 D z", "C4/2 . D4/1 .", 0, false},
+		{"octaves", "L:1/16 c C, c'", "C5/1 C3/1 C6/1", 0, false},
+		{"key signature", "L:1/16 K:D F C =F", "F#4/1 C#4/1 F4/1", 0, false},
+		{"minor key", "L:1/16 K:Am G B", "G4/1 B4/1", 0, false},
+		{"flat key", "L:1/16 K:F B", "A#4/1", 0, false},
+		{"bar accidentals", "L:1/16 ^F F | F", "F#4/1 F#4/1 F4/1", 0, false},
+		{"tie", "L:1/16 C2-C2 D", "C4/4 . . . D4/1", 0, false},
+		{"broken rhythm", "C>D", "C4/3 . . D4/1", 0, false},
+		{"inline field and decorations", `L:1/16 "Am"!p!~C [K:G] F | {g}G`, "C4/1 F#4/1 G4/1", 0, false},
+		{"tempo", "Q:1/4=96 L:1/16 C", "C4/1", 96, false},
+		{"half note tempo", "Q:1/2=60 L:1/16 C", "C4/1", 120, false},
+		{"repeats and endings", "L:1/16 |: C :|1 D |2 E |]", "C4/1 D4/1 E4/1", 0, false},
+		{"chord", "[CEG]", "", 0, true},
+		{"tuplet", "(3CDE", "", 0, true},
+		{"bad key", "K:H C", "", 0, true},
+		{"empty", "K:G", "", 0, true},
+		{"bad character", "C & D", "", 0, true},
+		{"huge length", "A000200000000000", "", 0, true},
+		{"overflowing length", "A9223372036854775807/3", "", 0, true},
+		{"overflowing halves", "C" + strings.Repeat("/", 70), "", 0, true},
+		{"overflowing broken rhythm", "C" + strings.Repeat(">", 70) + "D", "", 0, true},
+		{"overflowing tempo", "Q:1/4=9223372036854775807 C", "", 0, true},
+		{"tune too long", "L:1/1 " + strings.Repeat("C ", 65), "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tab, err := ParseABC(tt.tune)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseABC(%q) error = %v, wantErr %v", tt.tune, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := tabString(tab); got != tt.want {
+				t.Errorf("ParseABC(%q) = %s, want %s", tt.tune, got, tt.want)
+			}
+			if tab.Tempo != tt.tempo {
+				t.Errorf("ParseABC(%q) tempo = %d, want %d", tt.tune, tab.Tempo, tt.tempo)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := New(16)
+	before.SetNote(1, 36)
+
+	after := before.Clone()
+	if len(Diff(before, after)) != 0 {
+		t.Errorf("Diff of a clone = %v, want none", Diff(before, after))
+	}
+
+	after.SetTempo(120)
+	after.SetRest(1)
+	after.SetNote(5, 36)
+	after.SetVelocity(5, 110)
+	after.SetStepCC(5, 74, 64)
+	after.Resize(32)
+
+	want := []string{
+		"tempo: 80 → 120",
+		"length: 16 → 32",
+		"step 1: C2 → rest",
+		"step 5: rest → C2 vel:110",
+		"step 5 cc 74: - → 64",
+	}
+	got := Diff(before, after)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Diff = %q, want %q", got, want)
+	}
+}
+
+func TestSong(t *testing.T) {
+	orig := SongsDir
+	defer func() { SongsDir = orig }()
+	SongsDir = t.TempDir()
+
+	parts, err := ParseSongParts([]string{"demo/intro*2", "verse*4", "outro"})
+	if err != nil {
+		t.Fatalf("ParseSongParts() error = %v", err)
+	}
+	song := &Song{Name: "demo", Parts: parts}
+	if got := song.String(); got != "demo/intro*2 verse*4 outro" {
+		t.Errorf("String() = %q", got)
+	}
+	if song.Loops() != 7 {
+		t.Errorf("Loops() = %d, want 7", song.Loops())
+	}
+	for _, args := range [][]string{nil, {"verse*0"}, {"verse*x"}, {"*2"}} {
+		if _, err := ParseSongParts(args); err == nil {
+			t.Errorf("ParseSongParts(%v) should fail", args)
+		}
+	}
+
+	if err := song.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := LoadSong("demo")
+	if err != nil {
+		t.Fatalf("LoadSong() error = %v", err)
+	}
+	if loaded.String() != song.String() {
+		t.Errorf("LoadSong() = %q, want %q", loaded, song)
+	}
+	if names, _ := ListSongs(); len(names) != 1 || names[0] != "demo" {
+		t.Errorf("ListSongs() = %v", names)
+	}
+	if _, err := LoadSong("missing"); err == nil {
+		t.Error("LoadSong(missing) should fail")
+	}
+}
+
+// TestMorph tests the stages between two patterns
+func TestMorph(t *testing.T) {
+	from, to := New(8), New(8)
+	from.SetTempo(100)
+	to.SetTempo(140)
+	to.SetSwing(40)
+	for i := 1; i <= 8; i++ {
+		from.SetNote(i, 48)
+		from.SetVelocity(i, 40)
+		to.SetNote(i, 55)
+		to.SetVelocity(i, 120)
+	}
+	from.SetStepCC(1, 74, 0)
+	to.SetStepCC(1, 74, 100)
+
+	// Steps switch in a known order: step i at amount (i+1)/8
+	calls := 0
+	random := func() float64 {
+		calls++
+		return 1 - float64(calls)/8
+	}
+	m := NewMorph(from, to, random)
+	switched := func(p *Pattern) int {
+		n := 0
+		for _, step := range p.Steps {
+			if step.Note == 55 {
+				n++
+			}
+		}
+		return n
+	}
+
+	if p := m.At(0); p.String() != from.String() {
+		t.Errorf("At(0) =\n%s\nwant the start pattern", p)
+	}
+	half := m.At(0.5)
+	if n := switched(half); n != 4 {
+		t.Errorf("At(0.5): %d steps switched, want 4", n)
+	}
+	for i, step := range half.Steps {
+		if step.Velocity != 80 {
+			t.Errorf("At(0.5) step %d velocity = %d, want 80", i+1, step.Velocity)
+		}
+	}
+	if half.BPM != 120 || half.SwingPercent != 20 || half.Steps[0].CCValues[74] != 50 {
+		t.Errorf("At(0.5): BPM %g, swing %d, CC 74 %d; want 120, 20, 50", half.BPM, half.SwingPercent, half.Steps[0].CCValues[74])
+	}
+	// Switched steps stay switched as the morph goes on
+	for i, step := range m.At(0.25).Steps {
+		if step.Note == 55 && half.Steps[i].Note != 55 {
+			t.Errorf("step %d switched back", i+1)
+		}
+	}
+	if p := m.At(1); p.String() != to.String() {
+		t.Errorf("At(1) =\n%s\nwant the target", p)
+	}
+
+	// Steps beyond the target's length turn into rests; the start's length
+	// is kept until the end
+	calls = 0
+	m = NewMorph(from, New(4), random)
+	if p := m.At(0.99); len(p.Steps) != 8 || !p.Steps[6].IsRest || p.Steps[7].Note != 48 {
+		t.Errorf("At(0.99) against a shorter target =\n%s", p)
+	}
+	if p := m.At(1); len(p.Steps) != 4 {
+		t.Errorf("At(1) has %d steps, want the target's 4", len(p.Steps))
+	}
+}
+
+// TestFill tests the rolling last bar of a fill
+func TestFill(t *testing.T) {
+	p := New(32)
+	p.SetNote(1, 48)
+	p.SetNote(21, 55)
+	p.SetNote(25, 60)
+	p.SetMuted(25, true)
+
+	fill := p.Fill()
+	if fill.String() == p.String() || !p.Steps[16].IsRest {
+		t.Fatal("Fill should change a copy, not the pattern")
+	}
+	for i := 0; i < 16; i++ {
+		if fill.Steps[i].IsRest != p.Steps[i].IsRest {
+			t.Errorf("step %d outside the last bar changed", i+1)
+		}
+	}
+	for i, want := range map[int]uint8{16: 48, 19: 48, 20: 55, 23: 55, 24: 60, 25: 55, 31: 55} {
+		if step := fill.Steps[i]; step.IsRest || step.Note != want {
+			t.Errorf("step %d = %+v, want note %d", i+1, step, want)
+		}
+	}
+	if !fill.Steps[24].Muted {
+		t.Error("a muted step should stay muted")
+	}
+	if first, end := fill.Steps[16].Velocity, fill.Steps[31].Velocity; first != 70 || end != 127 {
+		t.Errorf("velocity rises %d → %d, want 70 → 127", first, end)
+	}
+
+	// Nothing to repeat before the first note
+	empty := New(16)
+	empty.SetNote(9, 50)
+	if fill := empty.Fill(); !fill.Steps[0].IsRest || fill.Steps[9].Note != 50 {
+		t.Errorf("fill =\n%s", fill)
+	}
+}
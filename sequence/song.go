@@ -0,0 +1,135 @@
+package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SongsDir is where songs are saved; main points it into the configured data directory
+var SongsDir = "songs"
+
+// Song chains saved patterns into an arrangement
+type Song struct {
+	Name  string     `json:"name"`
+	Parts []SongPart `json:"parts"`
+}
+
+// SongPart plays a saved pattern for a number of loops
+type SongPart struct {
+	Pattern string `json:"pattern"`
+	Repeats int    `json:"repeats"`
+}
+
+// ParseSongParts reads an arrangement written as pattern names with
+// optional repeat counts, e.g. "intro*2 verse*4 outro"
+func ParseSongParts(args []string) ([]SongPart, error) {
+	var parts []SongPart
+	for _, arg := range args {
+		name, count, found := strings.Cut(arg, "*")
+		part := SongPart{Pattern: name, Repeats: 1}
+		if found {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid repeat count in %q (use <pattern>*<loops>, e.g. verse*4)", arg)
+			}
+			part.Repeats = n
+		}
+		if part.Pattern == "" {
+			return nil, fmt.Errorf("missing pattern name in %q", arg)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("a song needs at least one pattern")
+	}
+	return parts, nil
+}
+
+// String writes the arrangement as ParseSongParts reads it
+func (s *Song) String() string {
+	parts := make([]string, len(s.Parts))
+	for i, part := range s.Parts {
+		parts[i] = part.Pattern
+		if part.Repeats != 1 {
+			parts[i] += "*" + strconv.Itoa(part.Repeats)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Loops returns the song's length in pattern loops
+func (s *Song) Loops() int {
+	loops := 0
+	for _, part := range s.Parts {
+		loops += part.Repeats
+	}
+	return loops
+}
+
+// SongPath returns the file a song is saved in
+func SongPath(name string) string {
+	return filepath.Join(SongsDir, sanitizeFilename(name)+".json")
+}
+
+// Save saves the song to a JSON file in the songs directory
+func (s *Song) Save() error {
+	if err := os.MkdirAll(SongsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create songs directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal song: %w", err)
+	}
+	if err := os.WriteFile(SongPath(s.Name), data, 0644); err != nil {
+		return fmt.Errorf("failed to write song file: %w", err)
+	}
+	return nil
+}
+
+// LoadSong loads a song from the songs directory
+func LoadSong(name string) (*Song, error) {
+	data, err := os.ReadFile(SongPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("song '%s' not found", name)
+		}
+		return nil, fmt.Errorf("failed to read song file: %w", err)
+	}
+	var s Song
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse song file: %w", err)
+	}
+	if len(s.Parts) == 0 {
+		return nil, fmt.Errorf("song '%s' has no parts", name)
+	}
+	for i := range s.Parts {
+		if s.Parts[i].Repeats < 1 {
+			s.Parts[i].Repeats = 1
+		}
+	}
+	return &s, nil
+}
+
+// ListSongs returns the names of all saved songs
+func ListSongs() ([]string, error) {
+	entries, err := os.ReadDir(SongsDir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read songs directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,150 @@
+package sequence
+
+import "fmt"
+
+// clone returns a copy of the step that shares no CC map with it
+func (s Step) clone() Step {
+	if s.CCValues != nil {
+		values := make(map[int]int, len(s.CCValues))
+		for ccNum, value := range s.CCValues {
+			values[ccNum] = value
+		}
+		s.CCValues = values
+	}
+	return s
+}
+
+// validate checks a step's values are in range
+func (s Step) validate() error {
+	switch {
+	case s.IsRest:
+		return nil
+	case s.Note > 127:
+		return fmt.Errorf("note must be 0-127")
+	case s.Velocity > 127:
+		return fmt.Errorf("velocity must be 0-127")
+	case s.Gate < 1 || s.Gate > 100:
+		return fmt.Errorf("gate must be 1-100 (percentage)")
+	case s.GateMs < 0 || s.GateMs > MaxGateMs:
+		return fmt.Errorf("gate must be 1-%dms", MaxGateMs)
+	case s.Duration < 1:
+		return fmt.Errorf("duration must be at least 1 step")
+	}
+	for ccNum, value := range s.CCValues {
+		if ccNum < 0 || ccNum > 127 || value < 0 || value > 127 {
+			return fmt.Errorf("CC %d = %d is out of range (0-127)", ccNum, value)
+		}
+	}
+	return nil
+}
+
+// Snapshot returns a copy of the steps, taken at once, that callers may
+// read and change without locking
+func (p *Pattern) Snapshot() []Step {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	steps := make([]Step, len(p.Steps))
+	for i, step := range p.Steps {
+		steps[i] = step.clone()
+	}
+	return steps
+}
+
+// ForEachStep calls fn with each step number (1-based) and a copy of the
+// step, from a snapshot, so fn may call the pattern's methods itself
+func (p *Pattern) ForEachStep(fn func(stepNum int, step Step)) {
+	for i, step := range p.Snapshot() {
+		fn(i+1, step)
+	}
+}
+
+// SetSteps replaces all steps at once, changing the length to theirs.
+// Nothing changes if a step is out of range.
+func (p *Pattern) SetSteps(steps []Step) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("a pattern needs at least one step")
+	}
+	copied := make([]Step, len(steps))
+	for i, step := range steps {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		copied[i] = step.clone()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Steps = copied
+	p.version++
+	return nil
+}
+
+// InsertSteps inserts count rests before step stepNum (1-based; one past
+// the end appends), moving the steps from there on later. The pattern
+// grows, unless wrap keeps its length: then the steps pushed past the end
+// come back in at stepNum instead of the rests.
+func (p *Pattern) InsertSteps(stepNum, count int, wrap bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	numSteps := len(p.Steps)
+	last := numSteps + 1
+	if wrap {
+		last = numSteps
+	}
+	if stepNum < 1 || stepNum > last {
+		return fmt.Errorf("step must be 1-%d", last)
+	}
+	if count < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+
+	i := stepNum - 1
+	if wrap {
+		tail := p.Steps[i:]
+		n := count % len(tail)
+		rotated := append(append([]Step{}, tail[len(tail)-n:]...), tail[:len(tail)-n]...)
+		copy(tail, rotated)
+		p.version++
+		return nil
+	}
+	rests := make([]Step, count)
+	for j := range rests {
+		rests[j] = Step{IsRest: true, Velocity: 100, Gate: 90, Duration: 1}
+	}
+	p.Steps = append(p.Steps[:i], append(rests, p.Steps[i:]...)...)
+	p.version++
+	return nil
+}
+
+// RemoveSteps removes count steps from step stepNum (1-based) on, moving
+// the later steps earlier. The pattern shrinks, unless wrap keeps its
+// length: then the removed steps go to the end instead.
+func (p *Pattern) RemoveSteps(stepNum, count int, wrap bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	numSteps := len(p.Steps)
+	if stepNum < 1 || stepNum > numSteps {
+		return fmt.Errorf("step must be 1-%d", numSteps)
+	}
+	if count < 1 || stepNum-1+count > numSteps {
+		return fmt.Errorf("count must be 1-%d from step %d", numSteps-stepNum+1, stepNum)
+	}
+
+	i := stepNum - 1
+	if wrap {
+		tail := p.Steps[i:]
+		rotated := append(append([]Step{}, tail[count:]...), tail[:count]...)
+		copy(tail, rotated)
+		p.version++
+		return nil
+	}
+	if count == numSteps {
+		return fmt.Errorf("a pattern needs at least one step")
+	}
+	p.Steps = append(p.Steps[:i], p.Steps[i+count:]...)
+	p.version++
+	return nil
+}
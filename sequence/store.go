@@ -0,0 +1,166 @@
+package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store saves and loads patterns by name. Names may contain collections
+// separated by slashes, e.g. "basslines/funk1".
+type Store interface {
+	Save(name string, p *Pattern) error
+	Load(name string) (*Pattern, error)
+	List() ([]string, error)
+	Delete(name string) error
+}
+
+// DirStore keeps patterns as JSON files in a directory, one subdirectory
+// per collection. Save, Load, List and Delete use one on PatternsDir.
+type DirStore struct {
+	Dir string
+}
+
+// Path returns the file a pattern is saved in
+func (s DirStore) Path(name string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(sanitizeName(name))+".json")
+}
+
+// Save writes the pattern to its file, creating the collection directory
+func (s DirStore) Save(name string, p *Pattern) error {
+	path := s.Path(name)
+
+	// Ensure patterns (and collection) directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create patterns directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(p.ToPatternFile(name), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal pattern: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write pattern file: %w", err)
+	}
+	return nil
+}
+
+// Load reads a pattern from its file
+func (s DirStore) Load(name string) (*Pattern, error) {
+	data, err := os.ReadFile(s.Path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("pattern '%s' not found", name)
+		}
+		return nil, fmt.Errorf("failed to read pattern file: %w", err)
+	}
+
+	var pf PatternFile
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return nil, fmt.Errorf("failed to parse pattern file: %w", err)
+	}
+	return FromPatternFile(&pf)
+}
+
+// List returns the names of all patterns in the directory, walking
+// collection subdirectories in lexical order
+func (s DirStore) List() ([]string, error) {
+	if _, err := os.Stat(s.Dir); os.IsNotExist(err) {
+		return []string{}, nil
+	}
+
+	var patterns []string
+	err := filepath.WalkDir(s.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			rel, err := filepath.Rel(s.Dir, path)
+			if err != nil {
+				return err
+			}
+			patterns = append(patterns, strings.TrimSuffix(filepath.ToSlash(rel), ".json"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patterns directory: %w", err)
+	}
+	return patterns, nil
+}
+
+// Delete removes a pattern's file, and collection directories left empty
+func (s DirStore) Delete(name string) error {
+	path := s.Path(name)
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("pattern '%s' not found", name)
+		}
+		return fmt.Errorf("failed to delete pattern: %w", err)
+	}
+
+	// Fails harmlessly on directories that aren't empty
+	for dir := filepath.Dir(path); dir != filepath.Clean(s.Dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// MemoryStore keeps patterns in memory, e.g. for tests or programs that
+// store patterns their own way. The zero value is ready to use.
+type MemoryStore struct {
+	mu       sync.Mutex
+	patterns map[string]*PatternFile
+}
+
+// Save keeps a copy of the pattern
+func (s *MemoryStore) Save(name string, p *Pattern) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.patterns == nil {
+		s.patterns = map[string]*PatternFile{}
+	}
+	s.patterns[sanitizeName(name)] = p.ToPatternFile(name)
+	return nil
+}
+
+// Load returns a copy of a saved pattern
+func (s *MemoryStore) Load(name string) (*Pattern, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pf, ok := s.patterns[sanitizeName(name)]
+	if !ok {
+		return nil, fmt.Errorf("pattern '%s' not found", name)
+	}
+	return FromPatternFile(pf)
+}
+
+// List returns the names of the saved patterns, sorted
+func (s *MemoryStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.patterns))
+	for name := range s.patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete forgets a saved pattern
+func (s *MemoryStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.patterns[sanitizeName(name)]; !ok {
+		return fmt.Errorf("pattern '%s' not found", name)
+	}
+	delete(s.patterns, sanitizeName(name))
+	return nil
+}
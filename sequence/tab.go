@@ -0,0 +1,129 @@
+package sequence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Velocities for drum lane hits
+const (
+	TabHitVelocity    = 100 // x
+	TabAccentVelocity = 127 // X
+	TabGhostVelocity  = 60  // o
+)
+
+// TabStep is one step set by text tablature
+type TabStep struct {
+	Step     int   // 1-based step number
+	Rest     bool  // clear the step
+	Note     uint8 // MIDI note (unless Rest)
+	Duration int   // steps the note lasts
+	Velocity uint8 // 0 = keep the step's velocity
+}
+
+// Tab is a parsed block of text tablature
+type Tab struct {
+	Steps  []TabStep // steps to set, in order; later entries win
+	Length int       // steps covered by the grid
+	Lanes  int       // drum lanes, 0 for a melody line
+	Tempo  int       // BPM set by the notation, 0 if none
+}
+
+// ParseTab parses compact text notation, one of:
+//
+//	C1 x...x...x...x... D1 ....x.......x...   drum lanes: a note and a grid each
+//	C2 . . G2 | C3 - . .                      a melody line, one token per step
+//
+// In a lane grid, x is a hit, X an accent, o a ghost note, and . or - leaves
+// the step alone. In a melody, . is a rest and - holds the previous note one
+// more step. | and spaces only group the steps for reading.
+func ParseTab(fields []string) (*Tab, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty tab")
+	}
+	for _, field := range fields {
+		if strings.ContainsAny(field, "xXo") {
+			return parseLanes(fields)
+		}
+	}
+	return parseMelody(fields)
+}
+
+// parseLanes parses drum lanes: a note followed by its grid, which may be
+// split into several fields ("x... x...")
+func parseLanes(fields []string) (*Tab, error) {
+	tab := &Tab{}
+	var note uint8
+	step := 0
+	for _, field := range fields {
+		if n, err := NoteNameToMIDI(field); err == nil {
+			if tab.Lanes > 0 && step == 0 {
+				return nil, fmt.Errorf("lane %s has no grid", MIDIToNoteName(note))
+			}
+			note, step = n, 0
+			tab.Lanes++
+			continue
+		}
+		if tab.Lanes == 0 {
+			return nil, fmt.Errorf("tab must start with a note name, got %q", field)
+		}
+		for _, c := range field {
+			var velocity uint8
+			switch c {
+			case 'x':
+				velocity = TabHitVelocity
+			case 'X':
+				velocity = TabAccentVelocity
+			case 'o':
+				velocity = TabGhostVelocity
+			case '.', '-':
+			case '|':
+				continue
+			default:
+				return nil, fmt.Errorf("invalid character %q in lane %s (use x, X, o, . or -)", c, MIDIToNoteName(note))
+			}
+			step++
+			if velocity > 0 {
+				tab.Steps = append(tab.Steps, TabStep{Step: step, Note: note, Duration: 1, Velocity: velocity})
+			}
+		}
+		tab.Length = max(tab.Length, step)
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("lane %s has no grid", MIDIToNoteName(note))
+	}
+	return tab, nil
+}
+
+// parseMelody parses a melody line of notes, rests (.) and holds (-)
+func parseMelody(fields []string) (*Tab, error) {
+	tab := &Tab{}
+	last := -1 // index in tab.Steps of the note a hold extends; held steps are rests
+	for _, field := range fields {
+		if n, err := NoteNameToMIDI(field); err == nil {
+			tab.Length++
+			tab.Steps = append(tab.Steps, TabStep{Step: tab.Length, Note: n, Duration: 1})
+			last = len(tab.Steps) - 1
+			continue
+		}
+		for _, c := range field {
+			switch c {
+			case '.':
+				tab.Length++
+				tab.Steps = append(tab.Steps, TabStep{Step: tab.Length, Rest: true})
+				last = -1
+			case '-':
+				if last < 0 {
+					return nil, fmt.Errorf("'-' at step %d has no note to hold", tab.Length+1)
+				}
+				tab.Length++
+				tab.Steps[last].Duration++
+				tab.Steps = append(tab.Steps, TabStep{Step: tab.Length, Rest: true})
+			case '|':
+			default:
+				return nil, fmt.Errorf("invalid tab token %q (use note names, . for rest, - to hold)", field)
+			}
+		}
+	}
+	return tab, nil
+}
@@ -0,0 +1,152 @@
+// Package style loads style presets: JSON files describing a genre in
+// numbers (tempo range, swing, note density and range) plus hints. Presets
+// are described to the AI and give generators sensible defaults.
+package style
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// Dir holds user presets (<name>.json); they take precedence over built-in ones
+var Dir = "styles"
+
+//go:embed presets/*.json
+var builtinPresets embed.FS
+
+// Style describes a genre
+type Style struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Tempo       [2]int    `json:"tempo"`           // BPM range [min, max]
+	Swing       int       `json:"swing"`           // default swing percent
+	Density     [2]int    `json:"density"`         // notes per 16-step bar [min, max]
+	Notes       [2]string `json:"notes"`           // typical note range [lowest, highest], e.g. ["C1", "C3"]
+	Hints       []string  `json:"hints,omitempty"` // rhythm, harmony and sound advice
+	low, high   uint8
+}
+
+// Parse decodes and validates a preset
+func Parse(data []byte) (*Style, error) {
+	var s Style
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid style preset: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("invalid style preset: %w", err)
+	}
+	return &s, nil
+}
+
+// validate checks the ranges and parses the note range
+func (s *Style) validate() error {
+	switch {
+	case s.Name == "":
+		return fmt.Errorf("missing name")
+	case s.Tempo[0] < 20 || s.Tempo[1] > 300 || s.Tempo[0] > s.Tempo[1]:
+		return fmt.Errorf("tempo must be [min, max] within 20-300")
+	case s.Swing < 0 || s.Swing > 75:
+		return fmt.Errorf("swing must be 0-75")
+	case s.Density[0] < 1 || s.Density[1] > 16 || s.Density[0] > s.Density[1]:
+		return fmt.Errorf("density must be [min, max] notes per bar within 1-16")
+	}
+
+	var err error
+	if s.low, err = sequence.StandardNoteNameToMIDI(s.Notes[0]); err != nil {
+		return fmt.Errorf("notes: %w", err)
+	}
+	if s.high, err = sequence.StandardNoteNameToMIDI(s.Notes[1]); err != nil {
+		return fmt.Errorf("notes: %w", err)
+	}
+	if s.low > s.high {
+		return fmt.Errorf("notes must be [lowest, highest]")
+	}
+	return nil
+}
+
+// NoteRange returns the lowest and highest typical MIDI notes
+func (s *Style) NoteRange() (low, high uint8) {
+	return s.low, s.high
+}
+
+// DefaultTempo returns the middle of the tempo range
+func (s *Style) DefaultTempo() int {
+	return (s.Tempo[0] + s.Tempo[1]) / 2
+}
+
+// Load reads a preset by name from Dir, falling back to the built-in presets
+func Load(name string) (*Style, error) {
+	name = strings.ToLower(name)
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid style name: %q", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(Dir, name+".json"))
+	if os.IsNotExist(err) {
+		data, err = builtinPresets.ReadFile("presets/" + name + ".json")
+		if err != nil {
+			return nil, fmt.Errorf("style '%s' not found (see 'style')", name)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read style preset: %w", err)
+	}
+	return Parse(data)
+}
+
+// List returns the names of all available presets, built-in and user
+func List() ([]string, error) {
+	names := map[string]bool{}
+
+	builtin, _ := builtinPresets.ReadDir("presets")
+	for _, entry := range builtin {
+		names[strings.TrimSuffix(entry.Name(), ".json")] = true
+	}
+
+	entries, err := os.ReadDir(Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read styles directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+			names[strings.ToLower(strings.TrimSuffix(entry.Name(), ".json"))] = true
+		}
+	}
+
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// Summary describes the numbers on one line, e.g.
+// "125-135 BPM, swing 0%, 8-12 notes per bar, notes C1-C3", with notes
+// named in the octave convention set
+func (s *Style) Summary() string {
+	return fmt.Sprintf("%d-%d BPM, swing %d%%, %d-%d notes per bar, notes %s-%s",
+		s.Tempo[0], s.Tempo[1], s.Swing, s.Density[0], s.Density[1], sequence.MIDIToNoteName(s.low), sequence.MIDIToNoteName(s.high))
+}
+
+// Describe summarizes the preset for an AI prompt
+func (s *Style) Describe() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "STYLE: %s", s.Name)
+	if s.Description != "" {
+		fmt.Fprintf(&sb, " (%s)", s.Description)
+	}
+	fmt.Fprintf(&sb, "\nUnless the user asks otherwise, stay within: tempo %d-%d BPM, swing around %d, "+
+		"%d-%d notes per 16-step bar, notes between %s and %s.",
+		s.Tempo[0], s.Tempo[1], s.Swing, s.Density[0], s.Density[1], sequence.MIDIToNoteName(s.low), sequence.MIDIToNoteName(s.high))
+	for _, hint := range s.Hints {
+		fmt.Fprintf(&sb, "\n- %s", hint)
+	}
+	return sb.String()
+}
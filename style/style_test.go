@@ -0,0 +1,108 @@
+package style
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"valid", `{"name": "x", "tempo": [120, 130], "swing": 20, "density": [4, 8], "notes": ["C1", "G3"]}`, ""},
+		{"bad json", `{"name": `, "invalid style preset"},
+		{"no name", `{"tempo": [120, 130], "density": [4, 8], "notes": ["C1", "G3"]}`, "missing name"},
+		{"no tempo", `{"name": "x", "density": [4, 8], "notes": ["C1", "G3"]}`, "tempo must be"},
+		{"tempo reversed", `{"name": "x", "tempo": [130, 120], "density": [4, 8], "notes": ["C1", "G3"]}`, "tempo must be"},
+		{"swing too high", `{"name": "x", "tempo": [120, 130], "swing": 80, "density": [4, 8], "notes": ["C1", "G3"]}`, "swing must be 0-75"},
+		{"density too high", `{"name": "x", "tempo": [120, 130], "density": [4, 17], "notes": ["C1", "G3"]}`, "density must be"},
+		{"bad note", `{"name": "x", "tempo": [120, 130], "density": [4, 8], "notes": ["C1", "H3"]}`, "notes:"},
+		{"notes reversed", `{"name": "x", "tempo": [120, 130], "density": [4, 8], "notes": ["G3", "C1"]}`, "notes must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				if low, high := s.NoteRange(); low != 24 || high != 55 || s.DefaultTempo() != 125 {
+					t.Errorf("NoteRange() = %d-%d, DefaultTempo() = %d", low, high, s.DefaultTempo())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuiltinPresets(t *testing.T) {
+	entries, err := builtinPresets.ReadDir("presets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		data, _ := builtinPresets.ReadFile("presets/" + entry.Name())
+		s, err := Parse(data)
+		if err != nil {
+			t.Errorf("%s: %v", entry.Name(), err)
+			continue
+		}
+		if s.Name+".json" != entry.Name() {
+			t.Errorf("%s is named %q", entry.Name(), s.Name)
+		}
+	}
+
+	s, err := Load("Techno")
+	if err != nil {
+		t.Fatalf("Load(Techno) error = %v", err)
+	}
+	if got := s.Summary(); got != "125-135 BPM, swing 0%, 8-14 notes per bar, notes C1-C3" {
+		t.Errorf("Summary() = %q", got)
+	}
+	if desc := s.Describe(); !strings.HasPrefix(desc, "STYLE: techno") || !strings.Contains(desc, "tempo 125-135 BPM") || !strings.Contains(desc, "\n- Minor keys") {
+		t.Errorf("Describe() =\n%s", desc)
+	}
+}
+
+func TestUserPresets(t *testing.T) {
+	orig := Dir
+	defer func() { Dir = orig }()
+	Dir = t.TempDir()
+
+	// A user preset overrides the built-in one of the same name
+	preset := `{"name": "techno", "tempo": [140, 150], "density": [12, 16], "notes": ["C0", "C2"]}`
+	if err := os.WriteFile(filepath.Join(Dir, "techno.json"), []byte(preset), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(Dir, "polka.json"), []byte(`{"name": "polka", "tempo": [100, 120], "density": [8, 8], "notes": ["C2", "C4"]}`), 0644)
+	os.WriteFile(filepath.Join(Dir, "broken.json"), []byte(`{`), 0644)
+
+	s, err := Load("techno")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if s.Tempo[0] != 140 {
+		t.Error("user preset should override the built-in one")
+	}
+
+	names, err := List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got := strings.Join(names, ","); !strings.Contains(got, "neo-soul,polka,techno") {
+		t.Errorf("List() = %v", names)
+	}
+
+	for _, name := range []string{"broken", "nothing", "../techno", ""} {
+		if _, err := Load(name); err == nil {
+			t.Errorf("Load(%q) should fail", name)
+		}
+	}
+}
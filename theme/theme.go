@@ -0,0 +1,144 @@
+package theme
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// ANSI reset sequence appended after every colored span
+const reset = "\x1b[0m"
+
+// Theme maps output roles to ANSI escape sequences
+type Theme struct {
+	Name    string
+	Error   string // error messages
+	Warning string // warnings (overwrite, delete, ...)
+	Success string // confirmations
+	Dim     string // rests and secondary information
+	AI      string // AI responses
+	Header  string // table and section headers
+	// Velocity heatmap for notes: soft (<50), medium (<90), loud (<110), accent (>=110)
+	Velocity [4]string
+}
+
+// themes contains the built-in color themes
+var themes = map[string]Theme{
+	"dark": {
+		Name:     "dark",
+		Error:    "\x1b[1;31m",
+		Warning:  "\x1b[33m",
+		Success:  "\x1b[32m",
+		Dim:      "\x1b[2m",
+		AI:       "\x1b[36m",
+		Header:   "\x1b[1m",
+		Velocity: [4]string{"\x1b[34m", "\x1b[32m", "\x1b[33m", "\x1b[1;31m"},
+	},
+	"light": {
+		Name:     "light",
+		Error:    "\x1b[31m",
+		Warning:  "\x1b[35m",
+		Success:  "\x1b[32m",
+		Dim:      "\x1b[90m",
+		AI:       "\x1b[34m",
+		Header:   "\x1b[1m",
+		Velocity: [4]string{"\x1b[36m", "\x1b[34m", "\x1b[35m", "\x1b[1;31m"},
+	},
+}
+
+// DefaultTheme is the theme used unless another one is selected
+const DefaultTheme = "dark"
+
+// Colors start disabled so library users and tests get plain text;
+// main enables them after checking --no-color, NO_COLOR and the terminal.
+var (
+	current = themes[DefaultTheme]
+	enabled = false
+)
+
+// SetEnabled turns colored output on or off (e.g., for --no-color or NO_COLOR)
+func SetEnabled(on bool) {
+	enabled = on
+}
+
+// Enabled reports whether colored output is on
+func Enabled() bool {
+	return enabled
+}
+
+// Use selects a built-in theme by name
+func Use(name string) error {
+	t, ok := themes[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown theme: %s (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	current = t
+	return nil
+}
+
+// Current returns the name of the selected theme
+func Current() string {
+	return current.Name
+}
+
+// Names returns the names of all built-in themes, sorted
+func Names() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// paint wraps text in a color code when colors are enabled
+func paint(code, text string) string {
+	if !enabled || code == "" || text == "" {
+		return text
+	}
+	return code + text + reset
+}
+
+// Error colors an error message
+func Error(text string) string { return paint(current.Error, text) }
+
+// Warning colors a warning message
+func Warning(text string) string { return paint(current.Warning, text) }
+
+// Success colors a confirmation message
+func Success(text string) string { return paint(current.Success, text) }
+
+// Dim de-emphasizes secondary text
+func Dim(text string) string { return paint(current.Dim, text) }
+
+// AI colors a response from the AI
+func AI(text string) string { return paint(current.AI, text) }
+
+// Header emphasizes table and section headers
+func Header(text string) string { return paint(current.Header, text) }
+
+// Velocity colors text by note velocity (heatmap from soft to accented)
+func Velocity(velocity uint8, text string) string {
+	switch {
+	case velocity < 50:
+		return paint(current.Velocity[0], text)
+	case velocity < 90:
+		return paint(current.Velocity[1], text)
+	case velocity < 110:
+		return paint(current.Velocity[2], text)
+	default:
+		return paint(current.Velocity[3], text)
+	}
+}
+
+// StepLine decorates one line of the pattern display: rests and muted
+// steps are dimmed, notes are colored by velocity. Suitable for
+// sequence.Pattern.StringWith.
+func StepLine(step sequence.Step, line string) string {
+	if step.IsRest || step.Muted {
+		return Dim(line)
+	}
+	return Velocity(step.Velocity, line)
+}
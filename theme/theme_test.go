@@ -0,0 +1,77 @@
+package theme
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iltempo/interplay/sequence"
+)
+
+// TestDisabledIsPlain tests that no escape codes are emitted when colors are off
+func TestDisabledIsPlain(t *testing.T) {
+	SetEnabled(false)
+	defer SetEnabled(false)
+
+	for _, got := range []string{Error("e"), Warning("w"), Success("s"), Dim("d"), AI("a"), Header("h"), Velocity(127, "v")} {
+		if strings.Contains(got, "\x1b[") {
+			t.Errorf("colored output %q while colors are disabled", got)
+		}
+	}
+}
+
+// TestEnabledWrapsText tests that colored text is wrapped and reset
+func TestEnabledWrapsText(t *testing.T) {
+	SetEnabled(true)
+	defer SetEnabled(false)
+
+	got := Error("boom")
+	if !strings.HasPrefix(got, "\x1b[") || !strings.HasSuffix(got, reset) || !strings.Contains(got, "boom") {
+		t.Errorf("Error(\"boom\") = %q, want wrapped in escape codes", got)
+	}
+
+	if Dim("") != "" {
+		t.Error("empty text should stay empty")
+	}
+}
+
+// TestVelocityHeatmap tests that velocity ranges map to distinct colors
+func TestVelocityHeatmap(t *testing.T) {
+	SetEnabled(true)
+	defer SetEnabled(false)
+
+	soft := Velocity(20, "x")
+	accent := Velocity(120, "x")
+	if soft == accent {
+		t.Error("soft and accented notes should use different colors")
+	}
+}
+
+// TestStepLine tests rest dimming and note coloring
+func TestStepLine(t *testing.T) {
+	SetEnabled(true)
+	defer SetEnabled(false)
+
+	rest := StepLine(sequence.Step{IsRest: true}, "rest")
+	if rest != Dim("rest") {
+		t.Errorf("rest line = %q, want dimmed", rest)
+	}
+	note := StepLine(sequence.Step{Note: 60, Velocity: 100}, "C4")
+	if note != Velocity(100, "C4") {
+		t.Errorf("note line = %q, want velocity colored", note)
+	}
+}
+
+// TestUse tests theme selection
+func TestUse(t *testing.T) {
+	defer Use(DefaultTheme)
+
+	if err := Use("light"); err != nil {
+		t.Fatalf("Use(\"light\") unexpected error: %v", err)
+	}
+	if Current() != "light" {
+		t.Errorf("Current() = %q, want light", Current())
+	}
+	if err := Use("neon"); err == nil {
+		t.Error("Use(\"neon\") should return error for unknown theme")
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !unix
+
+package tui
+
+import "os"
+
+// readKeys reads keystrokes from stdin until stop is called. A read can't
+// be interrupted on this OS: after stop, the reader ends with the next
+// keystroke, which it drops.
+func readKeys(fd int) (keys <-chan byte, stop func()) {
+	out := make(chan byte, 64)
+	done := make(chan struct{})
+	go func() {
+		defer close(out)
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			for _, b := range buf[:n] {
+				select {
+				case out <- b:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return out, func() { close(done) }
+}
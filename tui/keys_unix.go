@@ -0,0 +1,59 @@
+//go:build unix
+
+package tui
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// keyPollMs is how often the key reader checks whether it should stop
+const keyPollMs = 100
+
+// readKeys reads keystrokes from the terminal fd until stop is called. It
+// only reads once input is waiting, so stop can end it between keys, and
+// stop waits for it: no keystroke is taken after the live view closes.
+func readKeys(fd int) (keys <-chan byte, stop func()) {
+	out := make(chan byte, 64)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer close(out)
+		buf := make([]byte, 64)
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			n, err := unix.Poll(fds, keyPollMs)
+			if errors.Is(err, unix.EINTR) || (err == nil && n == 0) {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			n, err = unix.Read(fd, buf)
+			if errors.Is(err, unix.EINTR) || errors.Is(err, unix.EAGAIN) {
+				continue
+			}
+			if err != nil || n == 0 {
+				return
+			}
+			for _, b := range buf[:n] {
+				select {
+				case out <- b:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return out, func() {
+		close(done)
+		<-finished
+	}
+}
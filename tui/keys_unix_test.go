@@ -0,0 +1,48 @@
+//go:build unix
+
+package tui
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// TestReadKeysStops tests that no keystroke is read after stop returns
+func TestReadKeysStops(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	keys, stop := readKeys(int(r.Fd()))
+	w.Write([]byte("a"))
+	select {
+	case b := <-keys:
+		if b != 'a' {
+			t.Errorf("key = %q, want 'a'", b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no key read")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop didn't return")
+	}
+
+	// Input after stop stays unread
+	w.Write([]byte("b"))
+	buf := make([]byte, 1)
+	if _, err := r.Read(buf); err != nil || buf[0] != 'b' {
+		t.Errorf("read after stop = %q, %v, want 'b'", buf, err)
+	}
+}
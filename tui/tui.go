@@ -0,0 +1,380 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/iltempo/interplay/commands"
+	"github.com/iltempo/interplay/playback"
+	"github.com/iltempo/interplay/sequence"
+	"github.com/iltempo/interplay/theme"
+)
+
+// ANSI escape sequences used for drawing
+const (
+	enterAltScreen = "\x1b[?1049h"
+	exitAltScreen  = "\x1b[?1049l"
+	hideCursor     = "\x1b[?25l"
+	showCursor     = "\x1b[?25h"
+	cursorHome     = "\x1b[H"
+	clearLine      = "\x1b[K"
+	clearBelow     = "\x1b[J"
+	reverseVideo   = "\x1b[7m"
+	resetStyle     = "\x1b[0m"
+)
+
+// stepsPerRow is the number of steps drawn per grid row (one bar of 16ths)
+const stepsPerRow = 16
+
+// maxLogLines is how many lines of command output are kept for display
+const maxLogLines = 200
+
+// prompt is shown in front of the command entry line
+const prompt = "> "
+
+// view holds the state of the screen between redraws
+type view struct {
+	playhead int // 1-based step currently playing, 0 = not started
+	loop     int // completed loop iterations
+	input    []rune
+	log      []string
+	width    int
+	height   int
+	// quitWarned is set after warning that quitting discards unsaved changes
+	quitWarned bool
+}
+
+// addLog appends output lines to the scrollback, trimming old lines
+func (v *view) addLog(line string) {
+	v.log = append(v.log, line)
+	if len(v.log) > maxLogLines {
+		v.log = v.log[len(v.log)-maxLogLines:]
+	}
+}
+
+// logWriter collects what commands and the engine print while the live
+// view runs, as lines for the log area. Writes never block, so printing
+// doesn't stall playback while the view is busy.
+type logWriter struct {
+	mu      sync.Mutex
+	partial []byte   // text after the last newline
+	lines   []string // complete lines not yet shown
+	ready   chan struct{}
+}
+
+func newLogWriter() *logWriter {
+	return &logWriter{ready: make(chan struct{}, 1)}
+}
+
+// Write implements io.Writer, signalling ready when lines are complete
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.lines = append(w.lines, strings.TrimSuffix(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+	if len(w.lines) > maxLogLines {
+		w.lines = w.lines[len(w.lines)-maxLogLines:]
+	}
+	if len(w.lines) > 0 {
+		select {
+		case w.ready <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// take returns the lines written since the last call
+func (w *logWriter) take() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	lines := w.lines
+	w.lines = nil
+	return lines
+}
+
+// Run takes over the terminal and shows a live view of the pattern with a
+// moving playhead, driven by the engine's event bus. Commands typed on the
+// entry line are passed to the handler; their output is shown below the grid.
+// Returns when the user types 'quit' or presses Ctrl+C.
+func Run(engine *playback.Engine, handler *commands.Handler) error {
+	inFd := int(os.Stdin.Fd())
+	term := os.Stdout
+	outFd := int(term.Fd())
+
+	state, err := readline.MakeRaw(inFd)
+	if err != nil {
+		return fmt.Errorf("failed to enter raw terminal mode: %w", err)
+	}
+	defer readline.Restore(inFd, state)
+
+	// Collect everything printed by commands and the engine so it can be
+	// drawn inside the log area instead of scrolling the screen
+	output := newLogWriter()
+	handler.SetOutput(output)
+	engine.SetOutput(output)
+	defer func() {
+		handler.SetOutput(term)
+		engine.SetOutput(term)
+	}()
+
+	keys, stopKeys := readKeys(inFd)
+	defer stopKeys()
+
+	events := engine.Subscribe(256)
+	defer engine.Unsubscribe(events)
+
+	fmt.Fprint(term, enterAltScreen)
+	defer fmt.Fprint(term, showCursor+exitAltScreen)
+
+	v := &view{loop: engine.LoopCount()}
+	v.addLog("Live view started. Type 'help' for commands, 'quit' to exit.")
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	var esc escapeState
+	dirty := true
+	for {
+		if dirty {
+			v.width, v.height = terminalSize(outFd)
+			fmt.Fprint(term, render(engine.GetNextPattern(), v))
+			dirty = false
+		}
+
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			switch ev.Type {
+			case playback.EventStep:
+				v.playhead = ev.Step
+				dirty = true
+			case playback.EventLoop:
+				v.loop = ev.Loop
+				dirty = true
+			case playback.EventSendFailed:
+				v.addLog(fmt.Sprintf("MIDI device lost: %v", ev.Err))
+				dirty = true
+			case playback.EventSendRecovered:
+				v.addLog("MIDI device is back")
+				dirty = true
+			}
+
+		case <-output.ready:
+			for _, line := range output.take() {
+				v.addLog(line)
+			}
+			dirty = true
+
+		case b, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if esc.consume(b) {
+				continue
+			}
+			dirty = true
+			switch b {
+			case 3, 4: // Ctrl+C, Ctrl+D
+				if quit := execute(handler, v, "quit"); quit {
+					return nil
+				}
+			case '\r', '\n':
+				line := strings.TrimSpace(string(v.input))
+				v.input = v.input[:0]
+				if quit := execute(handler, v, line); quit {
+					return nil
+				}
+			case 127, 8: // Backspace
+				if len(v.input) > 0 {
+					v.input = v.input[:len(v.input)-1]
+				}
+			case 21: // Ctrl+U clears the entry line
+				v.input = v.input[:0]
+			default:
+				if b >= 32 && b < 127 {
+					v.input = append(v.input, rune(b))
+				}
+			}
+
+		case <-ticker.C:
+			// Periodic redraw picks up pattern edits and terminal resizes
+			dirty = true
+		}
+	}
+}
+
+// execute runs a command line from the entry line.
+// Returns true if the user asked to leave the live view.
+func execute(handler *commands.Handler, v *view, line string) bool {
+	switch strings.ToLower(line) {
+	case "quit", "exit":
+		if handler.IsModified() && !v.quitWarned {
+			v.quitWarned = true
+			v.addLog(theme.Warning("Pattern modified — 'save <name>' to keep it, or quit again to discard."))
+			return false
+		}
+		return true
+	case "ai":
+		v.addLog("> ai")
+		v.addLog("Interactive AI sessions are not available in the live view. Use 'ai <prompt>' instead.")
+		return false
+	}
+
+	v.quitWarned = false
+	v.addLog(prompt + line)
+	if err := handler.Execute(line); err != nil {
+		v.addLog(theme.Error(fmt.Sprintf("Error: %v", err)))
+	}
+	return false
+}
+
+// escapeState skips multi-byte escape sequences such as arrow keys
+type escapeState struct {
+	active  bool
+	bracket bool
+}
+
+// consume returns true if the byte belongs to an escape sequence
+func (s *escapeState) consume(b byte) bool {
+	switch {
+	case b == 27:
+		s.active, s.bracket = true, false
+		return true
+	case !s.active:
+		return false
+	case !s.bracket && b == '[':
+		s.bracket = true
+		return true
+	case s.bracket && b >= 0x40 && b <= 0x7e:
+		// Final byte of a CSI sequence
+		s.active, s.bracket = false, false
+		return true
+	case s.bracket:
+		return true
+	default:
+		// Alt+key or lone ESC followed by a regular key
+		s.active = false
+		return true
+	}
+}
+
+// terminalSize returns the terminal dimensions with a sane fallback
+func terminalSize(fd int) (int, int) {
+	width, height, err := readline.GetSize(fd)
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// render draws the full screen: header, step grid with playhead,
+// command output and the entry line
+func render(p *sequence.Pattern, v *view) string {
+	var lines []string
+
+	swing := p.GetSwing()
+	swingText := "off"
+	if swing > 0 {
+		swingText = fmt.Sprintf("%d%%", swing)
+	}
+	lines = append(lines, fmt.Sprintf("Interplay  Loop: %d  Tempo: %s BPM  Swing: %s  Length: %d steps",
+		v.loop, sequence.FormatBPM(p.GetBPM()), swingText, p.Length()))
+	lines = append(lines, "")
+	lines = append(lines, renderGrid(p, v.playhead)...)
+	lines = append(lines, "")
+
+	// Log area fills the space between the grid and the entry line
+	logRows := v.height - len(lines) - 2
+	if logRows < 0 {
+		logRows = 0
+	}
+	start := len(v.log) - logRows
+	if start < 0 {
+		start = 0
+	}
+	logLines := v.log[start:]
+	for _, line := range logLines {
+		lines = append(lines, truncate(line, v.width))
+	}
+	for i := len(logLines); i < logRows; i++ {
+		lines = append(lines, "")
+	}
+	lines = append(lines, strings.Repeat("─", max(v.width, 1)))
+
+	entry := prompt + string(v.input)
+
+	var sb strings.Builder
+	sb.WriteString(hideCursor + cursorHome)
+	for _, line := range lines {
+		sb.WriteString(line + clearLine + "\r\n")
+	}
+	sb.WriteString(truncate(entry, v.width) + clearLine + clearBelow)
+	sb.WriteString(showCursor)
+	return sb.String()
+}
+
+// renderGrid draws the pattern as rows of one bar each, highlighting the
+// step under the playhead. Sustained steps of longer notes are shown as '~',
+// muted notes are dimmed and in lower case.
+func renderGrid(p *sequence.Pattern, playhead int) []string {
+	steps := p.Snapshot()
+	length := len(steps)
+	var rows []string
+	sustain := 0
+
+	for rowStart := 1; rowStart <= length; rowStart += stepsPerRow {
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("Bar %-2d │ ", (rowStart-1)/stepsPerRow+1))
+
+		for stepNum := rowStart; stepNum < rowStart+stepsPerRow && stepNum <= length; stepNum++ {
+			step := steps[stepNum-1]
+
+			var cell string
+			switch {
+			case !step.IsRest && step.Muted:
+				cell = theme.Dim(fmt.Sprintf("%-4s", strings.ToLower(sequence.MIDIToNoteName(step.Note))))
+				sustain = step.Duration - 1
+			case !step.IsRest:
+				cell = theme.Velocity(step.Velocity, fmt.Sprintf("%-4s", sequence.MIDIToNoteName(step.Note)))
+				sustain = step.Duration - 1
+			case sustain > 0:
+				cell = theme.Dim("~   ")
+				sustain--
+			default:
+				cell = theme.Dim(".   ")
+			}
+
+			if stepNum == playhead {
+				cell = reverseVideo + cell + resetStyle
+			}
+			sb.WriteString(cell)
+		}
+		rows = append(rows, sb.String())
+	}
+
+	return rows
+}
+
+// truncate shortens a line to the terminal width
+func truncate(line string, width int) string {
+	runes := []rune(line)
+	if width > 0 && len(runes) > width {
+		return string(runes[:width])
+	}
+	return line
+}
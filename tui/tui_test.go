@@ -0,0 +1,132 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/iltempo/interplay/commands"
+	"github.com/iltempo/interplay/sequence"
+)
+
+// TestRenderGrid tests grid layout, sustain markers and playhead highlighting
+func TestRenderGrid(t *testing.T) {
+	p := sequence.New(32)
+	p.SetNoteWithDuration(1, 36, 3)
+	p.SetNote(17, 43)
+
+	rows := renderGrid(p, 2)
+	if len(rows) != 2 {
+		t.Fatalf("renderGrid() returned %d rows, want 2 (one per bar)", len(rows))
+	}
+
+	if !strings.HasPrefix(rows[0], "Bar 1 ") || !strings.HasPrefix(rows[1], "Bar 2 ") {
+		t.Errorf("rows should be labelled by bar, got %q and %q", rows[0], rows[1])
+	}
+	if !strings.Contains(rows[0], "C2") {
+		t.Errorf("bar 1 should contain C2, got %q", rows[0])
+	}
+	if !strings.Contains(rows[1], "G2") {
+		t.Errorf("bar 2 should contain G2, got %q", rows[1])
+	}
+
+	// Step 2 is sustained by the dur:3 note and under the playhead
+	if !strings.Contains(rows[0], reverseVideo+"~   "+resetStyle) {
+		t.Errorf("playhead on sustained step 2 not highlighted, got %q", rows[0])
+	}
+	if strings.Contains(rows[1], reverseVideo) {
+		t.Errorf("bar 2 should not contain the playhead, got %q", rows[1])
+	}
+}
+
+// TestRenderLogArea tests that only the most recent output lines fit on screen
+func TestRenderLogArea(t *testing.T) {
+	p := sequence.New(16)
+	v := &view{width: 80, height: 10}
+	for i := 0; i < 20; i++ {
+		v.addLog(strings.Repeat("x", i+1))
+	}
+	v.input = []rune("tempo 120")
+
+	out := render(p, v)
+	if !strings.Contains(out, "Tempo: 80 BPM") {
+		t.Error("render() should include the tempo header")
+	}
+	if !strings.Contains(out, prompt+"tempo 120") {
+		t.Error("render() should include the entry line with typed input")
+	}
+	if strings.Contains(out, "\r\nx\x1b[K") {
+		t.Error("render() should drop the oldest log lines when the screen is full")
+	}
+	if !strings.Contains(out, strings.Repeat("x", 20)) {
+		t.Error("render() should show the newest log line")
+	}
+}
+
+// TestEscapeState tests that arrow keys are swallowed
+func TestEscapeState(t *testing.T) {
+	var esc escapeState
+	for _, b := range []byte{27, '[', 'A'} {
+		if !esc.consume(b) {
+			t.Errorf("consume(%q) should be part of the escape sequence", b)
+		}
+	}
+	if esc.consume('a') {
+		t.Error("consume('a') after a complete sequence should not be swallowed")
+	}
+}
+
+// TestAddLogTrims tests the scrollback limit
+func TestAddLogTrims(t *testing.T) {
+	v := &view{}
+	for i := 0; i < maxLogLines+10; i++ {
+		v.addLog("line")
+	}
+	if len(v.log) != maxLogLines {
+		t.Errorf("log length = %d, want %d", len(v.log), maxLogLines)
+	}
+}
+
+// TestQuitWarnsWhenModified tests that quitting with unsaved changes needs confirmation
+func TestQuitWarnsWhenModified(t *testing.T) {
+	p := sequence.New(16)
+	handler := commands.New(p, nil)
+	v := &view{}
+
+	if !execute(handler, v, "quit") {
+		t.Error("quit with no changes should exit")
+	}
+
+	execute(handler, v, "set 1 C3")
+	if execute(handler, v, "quit") {
+		t.Error("first quit with unsaved changes should warn instead of exiting")
+	}
+	if !strings.Contains(v.log[len(v.log)-1], "Pattern modified") {
+		t.Errorf("expected warning in log, got %q", v.log[len(v.log)-1])
+	}
+	if !execute(handler, v, "exit") {
+		t.Error("second quit should exit")
+	}
+}
+
+// TestLogWriter tests that output is split into lines without blocking
+func TestLogWriter(t *testing.T) {
+	w := newLogWriter()
+	fmt.Fprint(w, "one\r\ntw")
+	fmt.Fprint(w, "o\nthree")
+	if got := w.take(); strings.Join(got, "|") != "one|two" {
+		t.Errorf("take() = %q, want [one two]", got)
+	}
+	if got := w.take(); len(got) != 0 {
+		t.Errorf("second take() = %q, want nothing", got)
+	}
+
+	// Nobody reads: writes still return, keeping the latest lines
+	for i := 0; i < maxLogLines*2; i++ {
+		fmt.Fprintln(w, i)
+	}
+	got := w.take()
+	if len(got) != maxLogLines || got[len(got)-1] != fmt.Sprint(maxLogLines*2-1) {
+		t.Errorf("take() kept %d lines ending %q", len(got), got[len(got)-1])
+	}
+}